@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -24,7 +25,6 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
-	"k8s.io/utils/exec"
 )
 
 // GetApplyCommand returns `apply` command used to create mpdev resources.
@@ -39,48 +39,141 @@ func GetApplyCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&c.DryRun, "dryrun", c.DryRun, "if set, validates configuration files without creating resource")
-	cmd.Flags().StringSliceVarP(&c.Filenames, "filename", "f", c.Filenames, "that contains the configuration to apply")
-	_ = cobra.MarkFlagRequired(cmd.Flags(), "filename")
+	addFilenamesFlag(cmd, &c.Filenames, "that contains the configuration to apply")
+	addDiscoveryFlags(cmd, &c.Discovery)
+	cmd.Flags().StringVar(&c.StateFile, "state-file", c.StateFile, stateFileUsage)
+	cmd.Flags().IntVar(&c.Parallelism, "parallelism", c.Parallelism, "maximum number of resources applied at once. Defaults to the parallelism of the selected profile, or 1")
+	cmd.Flags().BoolVar(&c.NoInput, "no-input", c.NoInput, "if set, fails instead of prompting for required fields that are missing")
+	addOutputFlag(cmd, &c.Output, outputText)
+	addJUnitReportFlag(cmd, &c.JUnitReport)
+	addCostFlags(cmd, &c.Cost)
 
 	return cmd
 }
 
 type command struct {
-	Filenames []string
-	DryRun    bool
+	Filenames   []string
+	DryRun      bool
+	StateFile   string
+	Parallelism int
+	Output      string
+	NoInput     bool
+	Discovery   fileDiscovery
+	JUnitReport string
+	Cost        costLimit
 }
 
 // RunE Executes the `apply` command
-func (c *command) RunE(_ *cobra.Command, _ []string) (err error) {
-	registry := apply.NewRegistry(exec.New())
-	for _, file := range c.Filenames {
-		objs, err := decodeFile(file)
-		if err != nil {
-			return err
+func (c *command) RunE(_ *cobra.Command, _ []string) error {
+	return c.run(func(registry apply.Registry) error {
+		return registry.Apply(c.DryRun)
+	})
+}
+
+// run registers the resources of the configuration files, loads the state
+// file and applies the resources with applyFunc.
+func (c *command) run(applyFunc func(registry apply.Registry) error) (err error) {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	logDir, logErr := apply.NewCommandLogDir(filepath.Join(c.baseDir(), commandLogsDir), keepCommandLogs)
+	if logErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: commands executed by mpdev are not logged: %v\n", logErr)
+	}
+	commandLogDir = logDir
+	defer func() {
+		if err != nil && logDir != "" {
+			fmt.Fprintf(os.Stderr, "The commands executed by mpdev and their output are logged in %s\n", logDir)
 		}
+	}()
+	registry := newRegistry()
+	parallelism := c.Parallelism
+	if parallelism == 0 {
+		parallelism = profile.Parallelism
+	}
+	registry.SetParallelism(parallelism)
+	apply.UseSpinner(colorEnabled() && parallelism <= 1 && c.Output == outputText)
+	if err := c.Cost.use(); err != nil {
+		return err
+	}
+	// Configurations read from stdin leave no terminal to prompt on.
+	var p *prompter
+	if nonInteractive && !c.NoInput {
+		p = &prompter{fail: true}
+	} else if !c.NoInput && isInteractive() && !readsStdin(c.Filenames) {
+		p = newPrompter()
+	}
+	if err := c.Discovery.register(registry, c.Filenames, p); err != nil {
+		return err
+	}
 
-		dir := filepath.Dir(file)
+	stateFile, err := c.stateFile()
+	if err != nil {
+		return err
+	}
+	err = registry.LoadState(stateFile)
+	if err != nil {
+		return err
+	}
 
-		for _, obj := range objs {
-			resource, err := apply.UnstructuredToResource(obj)
-			if err != nil {
-				return err
-			}
-			registry.RegisterResource(resource, dir)
+	restore := redirectProgress(c.Output)
+	err = applyFunc(registry)
+	restore()
+	if reportErr := writeJUnitReport(c.JUnitReport, registry.Summary()); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	if c.Output != outputText {
+		if printErr := printOutput(c.Output, registry.Summary(), nil); printErr != nil && err == nil {
+			err = printErr
 		}
 	}
 
-	err = registry.Apply(c.DryRun)
-
 	return err
 }
 
+// commandLogsDir is the directory, relative to the directory of the first
+// configuration file, in which the commands executed by each run are logged.
+// Only the logs of the last keepCommandLogs runs are kept.
+const (
+	commandLogsDir  = ".mpdev/logs"
+	keepCommandLogs = 20
+)
+
+// stateFileUsage is the usage of the --state-file flag of the commands that
+// apply resources.
+const stateFileUsage = "file that records the state of applied resources. Defaults to a file in the user cache directory, such as ~/.cache/mpdev/state, keyed by the directory of the first configuration file"
+
+// stateFile returns the state file passed to --state-file, or the default
+// state file of the configuration.
+func (c *command) stateFile() (string, error) {
+	if c.StateFile != "" {
+		return c.StateFile, nil
+	}
+	return apply.StateFilePath(c.baseDir())
+}
+
+// baseDir returns the directory of the first configuration file, or the
+// current directory if configurations are read from stdin.
+func (c *command) baseDir() string {
+	dir := "."
+	if len(c.Filenames) > 0 && c.Filenames[0] != stdinFilename {
+		dir = filepath.Dir(c.Filenames[0])
+		if info, err := os.Stat(c.Filenames[0]); err == nil && info.IsDir() {
+			dir = c.Filenames[0]
+		}
+	}
+	return dir
+}
+
+// decodeFile decodes the resources in a configuration file, or in the
+// multi-document yaml stream read from stdin if file is "-". Empty documents
+// are skipped.
 func decodeFile(file string) ([]apply.Unstructured, error) {
 	var objs []apply.Unstructured
 
 	var f *os.File
 	var err error
-	if file == "-" {
+	if file == stdinFilename {
 		f = os.Stdin
 	} else {
 		f, err = os.Open(file)
@@ -94,13 +187,17 @@ func decodeFile(file string) ([]apply.Unstructured, error) {
 	for err == nil {
 		var m apply.Unstructured
 		err = dec.Decode(&m)
-		if err == nil {
+		if err == nil && len(m) > 0 {
+			cloudDefaults.SetDefaults(m)
 			objs = append(objs, m)
 		}
 	}
 
 	if err != io.EOF {
-		return objs, errors.Wrap(err, "failed to parse yaml")
+		if file == stdinFilename {
+			return objs, apply.ValidationError(errors.Wrap(err, "failed to parse yaml from stdin"))
+		}
+		return objs, apply.ValidationError(errors.Wrapf(err, "failed to parse yaml in %s", file))
 	}
 
 	return objs, nil
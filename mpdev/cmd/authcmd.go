@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetAuthCommand returns the `auth` command, whose subcommands check the
+// credentials used by mpdev.
+func GetAuthCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: docs.AuthShort,
+		Long:  docs.AuthLong,
+	}
+	cmd.AddCommand(getAuthCheckCommand())
+	return cmd
+}
+
+func getAuthCheckCommand() *cobra.Command {
+	c := authCheckCommand{Roles: apply.DefaultMpdevRoles}
+	cmd := &cobra.Command{
+		Use:     "check --project PROJECT_ID",
+		Short:   docs.AuthCheckShort,
+		Long:    docs.AuthCheckLong,
+		Example: docs.AuthCheckExamples,
+		RunE:    c.RunE,
+	}
+
+	cmd.Flags().StringSliceVar(&c.Roles, "role", c.Roles, "roles that the principal must be granted")
+	cmd.Flags().StringVar(&c.Principal, "principal", "", "principal:// or principalSet:// member of the workload identity pool that the credentials authenticate as, such as the principalSet of a repository. Defaults to the whole pool")
+	addOutputFlag(cmd, &c.Output, outputText)
+
+	return cmd
+}
+
+type authCheckCommand struct {
+	Roles     []string
+	Principal string
+	Output    string
+}
+
+// authCheckOutput is the json and yaml output of the `auth check` command.
+type authCheckOutput struct {
+	Principal    string   `json:"principal"`
+	Project      string   `json:"project"`
+	MissingRoles []string `json:"missingRoles"`
+}
+
+// RunE executes the `auth check` command
+func (c *authCheckCommand) RunE(_ *cobra.Command, _ []string) error {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	if cloudDefaults.Project == "" {
+		return apply.UsageError(errors.New("--project must be set to the project whose IAM policy is checked"))
+	}
+	if credentialFile == "" {
+		return apply.UsageError(errors.New("--credential-file must be set to check workload identity federation credentials"))
+	}
+	config, err := apply.LoadCredentialConfig(credentialFile)
+	if err != nil {
+		return apply.AuthError(err)
+	}
+
+	principal := config.Principal()
+	if c.Principal != "" {
+		if err := config.CheckPrincipal(c.Principal); err != nil {
+			return apply.UsageError(err)
+		}
+		principal = c.Principal
+	}
+	missing, err := config.MissingRoles(newExecutor(), cloudDefaults.Project, principal, c.Roles)
+	if err != nil {
+		return err
+	}
+	if c.Output != outputText {
+		out := authCheckOutput{Principal: principal, Project: cloudDefaults.Project, MissingRoles: append([]string{}, missing...)}
+		if err := printOutput(c.Output, out, nil); err != nil {
+			return err
+		}
+	}
+	if len(missing) > 0 {
+		return apply.AuthError(fmt.Errorf("%s is missing roles in project %s:\n  - %s", principal, cloudDefaults.Project, strings.Join(missing, "\n  - ")))
+	}
+	if c.Output == outputText {
+		fmt.Printf("%s has all required roles in project %s\n", principal, cloudDefaults.Project)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetCleanCommand returns the `clean` command, which removes the temporary
+// directories of mpdev and the stale entries of state files.
+func GetCleanCommand() *cobra.Command {
+	var c cleanCommand
+	c.OlderThan = time.Hour
+	cmd := &cobra.Command{
+		Use:     "clean [-f FILENAME] [--dryrun] [-o FORMAT]",
+		Short:   docs.CleanShort,
+		Long:    docs.CleanLong,
+		Example: docs.CleanExamples,
+		RunE:    c.RunE,
+	}
+
+	cmd.Flags().StringSliceVarP(&c.Filenames, "filename", "f", c.Filenames, "configuration files whose state file is pruned of resources they no longer contain")
+	_ = cobra.MarkFlagFilename(cmd.Flags(), "filename", configExtensions...)
+	addDiscoveryFlags(cmd, &c.Discovery)
+	cmd.Flags().StringVar(&c.StateFile, "state-file", c.StateFile, "state file to prune. Defaults to the state file of the first configuration file in the user cache directory")
+	cmd.Flags().DurationVar(&c.OlderThan, "older-than", c.OlderThan, "only removes temporary directories and cached files last modified before this duration, so that those of running commands are kept")
+	cmd.Flags().BoolVar(&c.DryRun, "dryrun", c.DryRun, "if set, lists what would be removed without removing it")
+	addOutputFlag(cmd, &c.Output, outputText)
+	return cmd
+}
+
+type cleanCommand struct {
+	command
+	OlderThan time.Duration
+}
+
+// cleanOutput is the json and yaml output of the `clean` command.
+type cleanOutput struct {
+	DryRun     bool     `json:"dryRun"`
+	TempDirs   []string `json:"tempDirs"`
+	CacheFiles []string `json:"cacheFiles"`
+	StateFile  string   `json:"stateFile,omitempty"`
+	StaleState []string `json:"staleState,omitempty"`
+}
+
+// RunE executes the `clean` command
+func (c *cleanCommand) RunE(_ *cobra.Command, _ []string) error {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	out, err := c.clean()
+	if err != nil {
+		return err
+	}
+	verb := "Removed"
+	if c.DryRun {
+		verb = "Would remove"
+	}
+	return printOutput(c.Output, out, func() {
+		for _, dir := range out.TempDirs {
+			fmt.Printf("%s temporary directory %s\n", verb, dir)
+		}
+		for _, file := range out.CacheFiles {
+			fmt.Printf("%s cached file %s\n", verb, file)
+		}
+		for _, key := range out.StaleState {
+			fmt.Printf("%s state of %s from %s\n", verb, key, out.StateFile)
+		}
+	})
+}
+
+// clean removes the temporary directories, the cached files and the stale
+// entries of the state file, unless DryRun is set, and returns what was
+// removed.
+func (c *cleanCommand) clean() (*cleanOutput, error) {
+	out := &cleanOutput{DryRun: c.DryRun}
+	cutoff := time.Now().Add(-c.OlderThan)
+	var err error
+	out.TempDirs, err = c.remove(apply.TempDirs(cutoff))
+	if err != nil {
+		return nil, err
+	}
+	out.CacheFiles, err = c.remove(apply.CacheFiles(cutoff))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(c.Filenames) == 0 && c.StateFile == "" {
+		return out, nil
+	}
+	if len(c.Filenames) == 0 {
+		return nil, apply.UsageError(fmt.Errorf("--filename must be set to prune state file %s", c.StateFile))
+	}
+	registry := newRegistry()
+	if err := c.Discovery.register(registry, c.Filenames, nil); err != nil {
+		return nil, err
+	}
+	out.StateFile, err = c.stateFile()
+	if err != nil {
+		return nil, err
+	}
+	if err := registry.LoadState(out.StateFile); err != nil {
+		return nil, err
+	}
+	out.StaleState, err = registry.PruneState(c.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// remove removes paths, unless DryRun is set, and returns them.
+func (c *cleanCommand) remove(paths []string, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	for _, path := range paths {
+		if !c.DryRun {
+			if err := os.RemoveAll(path); err != nil {
+				return nil, err
+			}
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
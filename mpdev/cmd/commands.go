@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
 	"github.com/GoogleContainerTools/kpt/commands"
 	"github.com/spf13/cobra"
 )
@@ -28,8 +29,26 @@ func GetMpdevCommands(name string) (c []*cobra.Command) {
 	cfgCmd := commands.GetConfigCommand(name)
 	fixDocs(regexp.MustCompile(`\bkpt\b`), name, pkgCmd, cfgCmd)
 	applyCmd := GetApplyCommand()
+	diffCmd := GetDiffCommand()
+	testCmd := GetTestCommand()
+	publishCmd := GetPublishCommand()
+	generateCmd := GetGenerateCommand()
+	authCmd := GetAuthCommand()
+	doctorCmd := GetDoctorCommand()
+	cleanCmd := GetCleanCommand()
+	telemetryCmd := GetTelemetryCommand()
+	initCmd := GetInitCommand()
+	lintCmd := GetLintCommand()
+	convertCmd := GetConvertCommand()
+	listCmd := GetListCommand()
+	getCmd := GetGetCommand()
+	explainCmd := GetExplainCommand()
+	openCmd := GetOpenCommand()
+	versionCmd := GetVersionCommand()
+	completionCmd := GetCompletionCommand()
+	selfUpdateCmd := GetSelfUpdateCommand()
 
-	c = append(c, pkgCmd, cfgCmd, applyCmd, versionCmd)
+	c = append(c, pkgCmd, cfgCmd, initCmd, lintCmd, convertCmd, listCmd, getCmd, explainCmd, openCmd, applyCmd, diffCmd, testCmd, publishCmd, generateCmd, authCmd, doctorCmd, cleanCmd, telemetryCmd, completionCmd, selfUpdateCmd, versionCmd)
 
 	// apply cross-cutting issues to command
 	commands.NormalizeCommand(c...)
@@ -52,19 +71,59 @@ func fixDocs(old *regexp.Regexp, new string, cmd ...*cobra.Command) {
 var (
 	version   string
 	gitCommit string
+	// telemetryEndpoint is the endpoint that usage metrics are posted to,
+	// unless `telemetry enable` is passed another one
+	telemetryEndpoint string
 )
 
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print the version number of mpdev",
-	Run: func(cmd *cobra.Command, args []string) {
-		if version == "" {
-			version = "unknown version (built from source)"
-		}
-		if gitCommit == "" {
-			gitCommit = "unknown commit (dirty git repo)"
-		}
-		fmt.Printf("Version: %s\n", version)
-		fmt.Printf("GitCommit: %s\n", gitCommit)
-	},
+// GetVersionCommand returns the `version` command.
+func GetVersionCommand() *cobra.Command {
+	var output string
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "version [--check]",
+		Short: "Print the version number of mpdev",
+		Long: `Print the version number of mpdev. With --check, the version is compared
+against the latest release of mpdev, and the command fails if a newer release
+is available.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			if version == "" {
+				version = "unknown version (built from source)"
+			}
+			if gitCommit == "" {
+				gitCommit = "unknown commit (dirty git repo)"
+			}
+			v := map[string]interface{}{"version": version, "gitCommit": gitCommit}
+			var latest string
+			if check {
+				var err error
+				latest, err = apply.LatestRelease()
+				if err != nil {
+					return err
+				}
+				v["latestRelease"] = latest
+				v["upToDate"] = !apply.IsNewerRelease(latest, version)
+			}
+			err := printOutput(output, v, func() {
+				fmt.Printf("Version: %s\n", version)
+				fmt.Printf("GitCommit: %s\n", gitCommit)
+				if check {
+					fmt.Printf("LatestRelease: %s\n", latest)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if check && apply.IsNewerRelease(latest, version) {
+				return apply.VerificationError(fmt.Errorf("mpdev %s is available, run `mpdev self-update` to install it", latest))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", check, "if set, fails if a newer release of mpdev is available")
+	addOutputFlag(cmd, &output, outputText)
+	return cmd
 }
@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// GetConvertCommand returns the `convert` command, which converts
+// resources to another kind or apiVersion.
+func GetConvertCommand() *cobra.Command {
+	var c convertCommand
+	cmd := &cobra.Command{
+		Use:     "convert -f FILENAME [--kind KIND] [--api-version VERSION]",
+		Short:   docs.ConvertShort,
+		Long:    docs.ConvertLong,
+		Example: docs.ConvertExamples,
+		RunE:    c.RunE,
+	}
+
+	cmd.Flags().StringVarP(&c.Filename, "filename", "f", c.Filename, "configuration file to convert")
+	addKindFlag(cmd, &c.Options.ToKind, "kind", "kind to convert resources to")
+	cmd.Flags().StringVar(&c.Options.ToAPIVersion, "api-version", c.Options.ToAPIVersion, "apiVersion to convert resources to")
+	cmd.Flags().StringVar(&c.Options.Name, "name", c.Options.Name, "if set, only converts the resource with this name")
+	cmd.Flags().BoolVar(&c.InPlace, "in-place", c.InPlace, "if set, overwrites the file instead of printing the converted configuration")
+	_ = cobra.MarkFlagFilename(cmd.Flags(), "filename", configExtensions...)
+	_ = cobra.MarkFlagRequired(cmd.Flags(), "filename")
+
+	return cmd
+}
+
+type convertCommand struct {
+	Filename string
+	Options  apply.ConvertOptions
+	InPlace  bool
+}
+
+// RunE executes the `convert` command
+func (c *convertCommand) RunE(_ *cobra.Command, _ []string) error {
+	in, err := ioutil.ReadFile(c.Filename)
+	if err != nil {
+		return err
+	}
+	out, converted, err := apply.Convert(in, c.Options)
+	if err != nil {
+		return apply.ValidationError(errors.Wrapf(err, "failed to convert %s", c.Filename))
+	}
+	if converted == 0 {
+		return fmt.Errorf("no resource in %s was converted", c.Filename)
+	}
+
+	if !c.InPlace {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	info, err := os.Stat(c.Filename)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(c.Filename, out, info.Mode())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d resources in %s\n", converted, c.Filename)
+	return nil
+}
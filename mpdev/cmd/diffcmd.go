@@ -0,0 +1,90 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetDiffCommand returns the `diff` command, which compares published
+// packages with the packages produced from configuration files.
+func GetDiffCommand() *cobra.Command {
+	var c diffCommand
+	cmd := &cobra.Command{
+		Use:     "diff -f FILENAME",
+		Short:   docs.DiffShort,
+		Long:    docs.DiffLong,
+		Example: docs.DiffExamples,
+		RunE:    c.RunE,
+	}
+
+	addFilenamesFlag(cmd, &c.Filenames, "that contains the configuration to compare")
+	addDiscoveryFlags(cmd, &c.Discovery)
+	cmd.Flags().BoolVar(&c.ExitCode, "exit-code", c.ExitCode, "if set, fails if any published package differs from the local configuration")
+	addOutputFlag(cmd, &c.Output, outputText)
+	return cmd
+}
+
+type diffCommand struct {
+	Filenames []string
+	ExitCode  bool
+	Output    string
+	Discovery fileDiscovery
+}
+
+// RunE executes the `diff` command
+func (c *diffCommand) RunE(_ *cobra.Command, _ []string) error {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	registry := newRegistry()
+	if err := c.Discovery.register(registry, c.Filenames, nil); err != nil {
+		return err
+	}
+
+	restore := redirectProgress(c.Output)
+	diffs, err := registry.Diff()
+	restore()
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, d := range diffs {
+		changed += len(d.Changes)
+	}
+	err = printOutput(c.Output, diffs, func() {
+		for _, d := range diffs {
+			fmt.Printf("%s/%s compared with %s: %d files changed\n", d.Reference.Kind, d.Reference.Name, d.Published, len(d.Changes))
+			for _, change := range d.Changes {
+				fmt.Printf("  %s: %s\n", change.Status, change.Path)
+			}
+			for _, change := range d.Changes {
+				fmt.Print(change.Diff)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if c.ExitCode && changed > 0 {
+		return apply.VerificationError(fmt.Errorf("%d files differ from the published packages", changed))
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetDoctorCommand returns the `doctor` command, which checks the
+// prerequisites of mpdev.
+func GetDoctorCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:     "doctor [--project PROJECT_ID]",
+		Short:   docs.DoctorShort,
+		Long:    docs.DoctorLong,
+		Example: docs.DoctorExamples,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			diagnostics := apply.Diagnose(newExecutor(), cloudDefaults.Project)
+			failed := 0
+			for _, d := range diagnostics {
+				if d.Err != nil {
+					failed++
+				}
+			}
+			err := printOutput(output, diagnostics, func() {
+				for _, d := range diagnostics {
+					if d.Err == nil {
+						fmt.Printf("%s   %s\n", apply.Green("[OK]"), d.Name)
+						continue
+					}
+					fmt.Printf("%s %s: %s\n", apply.Red("[FAIL]"), d.Name, d.Err)
+					fmt.Printf("       To fix: %s\n", d.Hint)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if failed > 0 {
+				return apply.VerificationError(fmt.Errorf("%d prerequisite checks failed", failed))
+			}
+			return nil
+		},
+	}
+	addOutputFlag(cmd, &output, outputText)
+	return cmd
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// explainWidth is the width that descriptions are wrapped at.
+const explainWidth = 80
+
+// GetExplainCommand returns the `explain` command, which prints the
+// documentation of a kind of resource or of one of its fields.
+func GetExplainCommand() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:               "explain KIND[.FIELD]...",
+		Short:             docs.ExplainShort,
+		Long:              docs.ExplainLong,
+		Example:           docs.ExplainExamples,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeFieldPaths,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			e, err := apply.Explain(args[0])
+			if err != nil {
+				return apply.UsageError(err)
+			}
+			return printOutput(output, e, func() {
+				fmt.Printf("KIND:     %s\n", e.Kind)
+				if e.Field != "" {
+					fmt.Printf("FIELD:    %s <%s>\n", e.Field, e.Type)
+				}
+				if e.Description != "" {
+					fmt.Printf("\nDESCRIPTION:\n%s", wrap(e.Description, "     "))
+				}
+				if len(e.Fields) > 0 {
+					fmt.Printf("\nFIELDS:\n")
+					for _, f := range e.Fields {
+						fmt.Printf("   %s <%s>\n", f.Name, f.Type)
+						fmt.Print(wrap(f.Description, "     "))
+						fmt.Println()
+					}
+				}
+			})
+		},
+	}
+	addOutputFlag(cmd, &output, outputText)
+	return cmd
+}
+
+// completeFieldPaths completes the argument of `explain` with kinds, or with
+// the fields of the path before the last dot.
+func completeFieldPaths(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	i := strings.LastIndex(toComplete, ".")
+	if i < 0 {
+		return filterPrefix(apply.Kinds(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+	e, err := apply.Explain(toComplete[:i])
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var paths []string
+	for _, f := range e.Fields {
+		paths = append(paths, toComplete[:i+1]+f.Name)
+	}
+	return filterPrefix(paths, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// wrap wraps text at explainWidth, with indent before every line.
+func wrap(text string, indent string) string {
+	var b strings.Builder
+	line := indent
+	for _, word := range strings.Fields(text) {
+		if line != indent && len(line)+1+len(word) > explainWidth {
+			b.WriteString(line + "\n")
+			line = indent
+		}
+		if line != indent {
+			line += " "
+		}
+		line += word
+	}
+	if line != indent {
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
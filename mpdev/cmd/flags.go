@@ -0,0 +1,294 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// configExtensions are the extensions of configuration files, completed
+// for --filename flags.
+var configExtensions = []string{"yaml", "yml"}
+
+// stdinFilename is passed to --filename to read configurations from stdin.
+const stdinFilename = "-"
+
+// addFilenamesFlag adds the required --filename flag, accepting several
+// configuration files, to cmd.
+func addFilenamesFlag(cmd *cobra.Command, filenames *[]string, usage string) {
+	cmd.Flags().StringSliceVarP(filenames, "filename", "f", *filenames, usage)
+	_ = cobra.MarkFlagFilename(cmd.Flags(), "filename", configExtensions...)
+	_ = cobra.MarkFlagRequired(cmd.Flags(), "filename")
+}
+
+// fileDiscovery selects the configuration files in the directories passed
+// to --filename.
+type fileDiscovery struct {
+	Recursive bool
+	Include   []string
+	Exclude   []string
+}
+
+// addDiscoveryFlags adds the flags loading the configuration files in
+// directories passed to --filename to cmd.
+func addDiscoveryFlags(cmd *cobra.Command, d *fileDiscovery) {
+	cmd.Flags().BoolVarP(&d.Recursive, "recursive", "R", d.Recursive, "if set, loads the configuration files containing mpdev resources in the directories passed to --filename and their subdirectories")
+	cmd.Flags().StringSliceVar(&d.Include, "include", d.Include, "with --recursive, only loads files whose path relative to the directory matches one of these globs, such as solutions/*/mpdev/*.yaml")
+	cmd.Flags().StringSliceVar(&d.Exclude, "exclude", d.Exclude, "with --recursive, skips files whose path relative to the directory matches one of these globs, such as **/testdata/**")
+}
+
+// costLimit configures the confirmation of deployments whose estimated
+// cost exceeds a threshold.
+type costLimit struct {
+	Confirm   bool
+	Threshold float64
+}
+
+// addCostFlags adds the flags confirming costly deployments to cmd.
+func addCostFlags(cmd *cobra.Command, l *costLimit) {
+	cmd.Flags().BoolVar(&l.Confirm, "confirm-cost", l.Confirm, "if set, creates test deployments without estimating their cost")
+	cmd.Flags().Float64Var(&l.Threshold, "cost-threshold", l.Threshold, fmt.Sprintf("estimated cost, in USD, of the deployments of a resource above which --confirm-cost is required. Defaults to the costThreshold of the selected profile, or %v", apply.DefaultCostThreshold))
+}
+
+// use applies the cost limit to resources, with the threshold of the
+// selected profile if none was passed.
+func (l costLimit) use() error {
+	threshold := l.Threshold
+	if threshold == 0 {
+		threshold = profile.CostThreshold
+	}
+	return apply.UsageError(apply.LimitCost(threshold, l.Confirm))
+}
+
+// files returns the configuration files to load for filenames, in which
+// directories are replaced by the files they contain.
+func (d *fileDiscovery) files(filenames []string) ([]string, error) {
+	if !d.Recursive && (len(d.Include) > 0 || len(d.Exclude) > 0) {
+		return nil, apply.UsageError(errors.New("--include and --exclude can only be used with --recursive"))
+	}
+	var files []string
+	for _, file := range filenames {
+		if file == stdinFilename {
+			files = append(files, file)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() || apply.IsOverlay(file) {
+			files = append(files, file)
+			continue
+		}
+		if !d.Recursive {
+			return nil, apply.UsageError(fmt.Errorf("%s is a directory. Pass --recursive to load the configuration files it contains", file))
+		}
+		found, err := apply.FindConfigFiles(file, d.Include, d.Exclude)
+		if err != nil {
+			return nil, apply.UsageError(err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("no configuration files containing mpdev resources found in %s", file)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// decode decodes the resources in a configuration file or overlay
+// directory, along with the directories that relative paths in each
+// resource are resolved against. Files found in directories may also
+// contain other KRM resources, which are skipped.
+func (d *fileDiscovery) decode(file string) ([]apply.OverlayResource, error) {
+	if file != stdinFilename && apply.IsOverlay(file) {
+		resources, err := apply.BuildOverlay(file)
+		if err != nil {
+			return nil, apply.ValidationError(err)
+		}
+		for _, rs := range resources {
+			cloudDefaults.SetDefaults(rs.Object)
+		}
+		return resources, nil
+	}
+
+	objs, err := decodeFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var resources []apply.OverlayResource
+	for _, obj := range objs {
+		if !d.Recursive || apply.IsResource(obj) {
+			resources = append(resources, apply.OverlayResource{Object: obj, Dir: configDir(file)})
+		}
+	}
+	return resources, nil
+}
+
+// loadedResource is a resource of the configuration files, with the
+// directories that its relative paths are resolved against.
+type loadedResource struct {
+	resource  apply.Resource
+	dir       string
+	patchDirs map[string]string
+}
+
+// register registers the resources of the configuration files in filenames
+// with registry. If p is set, it prompts for the required fields that are
+// missing from the resources.
+func (d *fileDiscovery) register(registry apply.Registry, filenames []string, p *prompter) error {
+	resources, err := d.load(filenames, p)
+	if err != nil {
+		return err
+	}
+	for _, rs := range resources {
+		if err := registry.RegisterResource(rs.resource, rs.dir); err != nil {
+			return apply.ValidationError(err)
+		}
+		registry.SetPatchDirs(rs.resource, rs.patchDirs)
+	}
+	return nil
+}
+
+// load decodes the resources of the configuration files in filenames. If p
+// is set, it prompts for the required fields that are missing from the
+// resources.
+func (d *fileDiscovery) load(filenames []string, p *prompter) ([]loadedResource, error) {
+	if err := checkStdinFilenames(filenames); err != nil {
+		return nil, err
+	}
+	files, err := d.files(filenames)
+	if err != nil {
+		return nil, err
+	}
+	var resources []loadedResource
+	for _, file := range files {
+		decoded, err := d.decode(file)
+		if err != nil {
+			return nil, err
+		}
+		objs := make([]apply.Unstructured, len(decoded))
+		for i, rs := range decoded {
+			objs[i] = rs.Object
+		}
+		// Answers cannot be saved to overlays, since the fields may be
+		// missing from a base.
+		if p != nil && !apply.IsOverlay(file) {
+			if err := p.promptMissingFields(file, objs); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, obj := range objs {
+			resource, err := apply.UnstructuredToResource(obj)
+			if err != nil {
+				return nil, apply.ValidationError(err)
+			}
+			resources = append(resources, loadedResource{resource: resource, dir: decoded[i].Dir, patchDirs: decoded[i].PatchDirs})
+			usedKinds = append(usedKinds, resource.GetReference().Kind)
+		}
+	}
+	return resources, nil
+}
+
+// checkStdinFilenames returns an error if stdin is passed more than once to
+// --filename, since it can only be read once.
+func checkStdinFilenames(filenames []string) error {
+	count := 0
+	for _, file := range filenames {
+		if file == stdinFilename {
+			count++
+		}
+	}
+	if count > 1 {
+		return apply.UsageError(fmt.Errorf("%s can only be passed once to --filename", stdinFilename))
+	}
+	return nil
+}
+
+// readsStdin returns whether configurations are read from stdin.
+func readsStdin(filenames []string) bool {
+	for _, file := range filenames {
+		if file == stdinFilename {
+			return true
+		}
+	}
+	return false
+}
+
+// configDir returns the directory that relative paths in the configurations
+// of file are resolved against. For stdin, it is the current directory.
+func configDir(file string) string {
+	if file == stdinFilename {
+		return "."
+	}
+	return filepath.Dir(file)
+}
+
+// addKindFlag adds a flag selecting the kind of a resource, completed with
+// the kinds supported by mpdev, to cmd.
+func addKindFlag(cmd *cobra.Command, kind *string, name string, usage string) {
+	cmd.Flags().StringVar(kind, name, *kind, usage)
+	_ = cmd.RegisterFlagCompletionFunc(name, func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return filterPrefix(apply.Kinds(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// completeResourceNames completes the first argument of cmd with the names
+// of the resources in the files passed to --filename, or in the current
+// directory if --filename is not set.
+func completeResourceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	filenames, err := cmd.Flags().GetStringSlice("filename")
+	if err != nil || len(filenames) == 0 {
+		filenames = []string{"."}
+	}
+	if readsStdin(filenames) {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	kind, _ := cmd.Flags().GetString("kind")
+	resources, err := loadResources(filenames)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, rs := range resources {
+		ref := rs.GetReference()
+		if kind == "" || ref.Kind == kind {
+			names = append(names, ref.Name)
+		}
+	}
+	return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// filterPrefix returns the values that start with prefix.
+func filterPrefix(values []string, prefix string) []string {
+	var matches []string
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			matches = append(matches, v)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// mpdevDir is where the generated build installs mpdev. Directories
+	// under /workspace are shared by the steps of a build.
+	mpdevDir       = "/workspace/.mpdev"
+	cloudBuildFile = "cloudbuild.yaml"
+)
+
+// GetGenerateCommand returns the `generate` command, whose subcommands
+// generate files that run mpdev.
+func GetGenerateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: docs.GenerateShort,
+		Long:  docs.GenerateLong,
+	}
+	cmd.AddCommand(getGenerateCloudBuildCommand())
+	return cmd
+}
+
+func getGenerateCloudBuildCommand() *cobra.Command {
+	c := cloudBuildCommand{
+		OutFile:      cloudBuildFile,
+		MpdevVersion: version,
+		BuilderImage: "gcr.io/google.com/cloudsdktool/cloud-sdk",
+		MachineType:  "E2_HIGHCPU_8",
+		Timeout:      "3600s",
+	}
+	cmd := &cobra.Command{
+		Use:     "cloudbuild -f FILENAME",
+		Short:   docs.GenerateCloudBuildShort,
+		Long:    docs.GenerateCloudBuildLong,
+		Example: docs.GenerateCloudBuildExamples,
+		RunE:    c.RunE,
+	}
+
+	addFilenamesFlag(cmd, &c.Filenames, "configuration files applied by the build, relative to the root of the build source")
+	cmd.Flags().StringVar(&c.OutFile, "out-file", c.OutFile, "file the build configuration is written to, or - for stdout")
+	cmd.Flags().StringVar(&c.MpdevVersion, "mpdev-version", c.MpdevVersion, "release of mpdev installed by the build, such as v0.1.0. Defaults to the version of this mpdev")
+	cmd.Flags().StringVar(&c.BuilderImage, "builder-image", c.BuilderImage, "image the build steps run in. Must contain gcloud, gsutil, curl and the docker client")
+	cmd.Flags().StringVar(&c.MachineType, "machine-type", c.MachineType, "machine type of the build")
+	cmd.Flags().StringVar(&c.Timeout, "timeout", c.Timeout, "timeout of the build")
+	cmd.Flags().StringVar(&c.StateCache, "state-cache", c.StateCache, "GCS path, such as gs://bucket/mpdev_state.json, that the state file is restored from and saved to so that unchanged resources are skipped between builds")
+
+	return cmd
+}
+
+type cloudBuildCommand struct {
+	Filenames    []string
+	OutFile      string
+	MpdevVersion string
+	BuilderImage string
+	MachineType  string
+	Timeout      string
+	StateCache   string
+}
+
+type cloudBuildConfig struct {
+	Steps   []cloudBuildStep  `yaml:"steps"`
+	Timeout string            `yaml:"timeout"`
+	Options cloudBuildOptions `yaml:"options"`
+}
+
+type cloudBuildStep struct {
+	ID         string   `yaml:"id"`
+	Name       string   `yaml:"name"`
+	Entrypoint string   `yaml:"entrypoint,omitempty"`
+	Args       []string `yaml:"args"`
+	Env        []string `yaml:"env,omitempty"`
+}
+
+type cloudBuildOptions struct {
+	MachineType string `yaml:"machineType"`
+}
+
+// RunE Executes the `generate cloudbuild` command
+func (c *cloudBuildCommand) RunE(_ *cobra.Command, _ []string) error {
+	config, err := c.generate()
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("# Generated by mpdev generate cloudbuild. Submit with:\n")
+	b.WriteString("#   gcloud builds submit --config " + cloudBuildFile + " .\n")
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	err = enc.Encode(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode build configuration")
+	}
+
+	if c.OutFile == "-" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	err = ioutil.WriteFile(c.OutFile, b.Bytes(), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write build configuration to %s", c.OutFile)
+	}
+	fmt.Printf("Wrote build configuration to %s\n", c.OutFile)
+	return nil
+}
+
+// generate returns a build that installs mpdev, validates the
+// configuration files with a dry run, and then applies them. Resources that
+// verify the solution, such as DeploymentManagerDeployment, run as part of
+// the apply step.
+func (c *cloudBuildCommand) generate() (*cloudBuildConfig, error) {
+	if !strings.HasPrefix(c.MpdevVersion, "v") {
+		return nil, errors.New("mpdev version is unknown for a build from source. Set --mpdev-version to a release, such as v0.1.0")
+	}
+	if c.StateCache != "" && !strings.HasPrefix(c.StateCache, "gs://") {
+		return nil, fmt.Errorf("state cache must be a GCS path starting with gs://: %s", c.StateCache)
+	}
+
+	mpdev := mpdevDir + "/mpdev"
+	stateFile := mpdevDir + "/mpdev_state.json"
+	archive := apply.ReleaseArchiveURL(c.MpdevVersion, "linux", "amd64")
+	// Temporary directories are created in the workspace, so that they can
+	// be mounted in the containers that mpdev runs with docker.
+	env := []string{"TMPDIR=" + mpdevDir + "/tmp"}
+
+	var globalArgs []string
+	if impersonateServiceAccount != "" {
+		globalArgs = append(globalArgs, "--impersonate-service-account="+impersonateServiceAccount)
+	}
+	applyArgs := append(append([]string{}, globalArgs...), "apply", "-f", strings.Join(c.Filenames, ","))
+	if c.StateCache != "" {
+		applyArgs = append(applyArgs, "--state-file", stateFile)
+	}
+
+	steps := []cloudBuildStep{{
+		ID:         "install-mpdev",
+		Name:       c.BuilderImage,
+		Entrypoint: "bash",
+		Args: []string{"-c", fmt.Sprintf("mkdir -p %s/tmp && curl -sSLf %s | tar -xz -C %s && %s version",
+			mpdevDir, archive, mpdevDir, mpdev)},
+	}}
+	if c.StateCache != "" {
+		steps = append(steps, cloudBuildStep{
+			ID:         "restore-state",
+			Name:       c.BuilderImage,
+			Entrypoint: "bash",
+			Args:       []string{"-c", fmt.Sprintf("gsutil cp %s %s || echo 'No cached state found'", c.StateCache, stateFile)},
+		})
+	}
+	steps = append(steps, cloudBuildStep{
+		ID:         "validate",
+		Name:       c.BuilderImage,
+		Entrypoint: mpdev,
+		Args:       append(append([]string{}, applyArgs...), "--dryrun"),
+		Env:        env,
+	}, cloudBuildStep{
+		ID:         "apply",
+		Name:       c.BuilderImage,
+		Entrypoint: mpdev,
+		Args:       applyArgs,
+		Env:        env,
+	})
+	if c.StateCache != "" {
+		steps = append(steps, cloudBuildStep{
+			ID:         "save-state",
+			Name:       c.BuilderImage,
+			Entrypoint: "gsutil",
+			Args:       []string{"cp", stateFile, c.StateCache},
+		})
+	}
+
+	return &cloudBuildConfig{
+		Steps:   steps,
+		Timeout: c.Timeout,
+		Options: cloudBuildOptions{MachineType: c.MachineType},
+	}, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCloudBuild(t *testing.T) {
+	install := cloudBuildStep{
+		ID:         "install-mpdev",
+		Name:       "cloud-sdk",
+		Entrypoint: "bash",
+		Args: []string{"-c", "mkdir -p /workspace/.mpdev/tmp && curl -sSLf " +
+			apply.ReleaseArchiveURL("v0.3.0", "linux", "amd64") +
+			" | tar -xz -C /workspace/.mpdev && /workspace/.mpdev/mpdev version"},
+	}
+	env := []string{"TMPDIR=/workspace/.mpdev/tmp"}
+
+	testCases := []struct {
+		name          string
+		command       cloudBuildCommand
+		impersonate   string
+		expectedSteps []cloudBuildStep
+		errorContains string
+	}{{
+		name:    "Validate and apply",
+		command: cloudBuildCommand{Filenames: []string{"configurations.yaml", "images.yaml"}},
+		expectedSteps: []cloudBuildStep{install, {
+			ID:         "validate",
+			Name:       "cloud-sdk",
+			Entrypoint: "/workspace/.mpdev/mpdev",
+			Args:       []string{"apply", "-f", "configurations.yaml,images.yaml", "--dryrun"},
+			Env:        env,
+		}, {
+			ID:         "apply",
+			Name:       "cloud-sdk",
+			Entrypoint: "/workspace/.mpdev/mpdev",
+			Args:       []string{"apply", "-f", "configurations.yaml,images.yaml"},
+			Env:        env,
+		}},
+	}, {
+		name:        "State cache and impersonation",
+		command:     cloudBuildCommand{Filenames: []string{"configurations.yaml"}, StateCache: "gs://bucket/state.json"},
+		impersonate: "deployer@project.iam.gserviceaccount.com",
+		expectedSteps: []cloudBuildStep{install, {
+			ID:         "restore-state",
+			Name:       "cloud-sdk",
+			Entrypoint: "bash",
+			Args:       []string{"-c", "gsutil cp gs://bucket/state.json /workspace/.mpdev/mpdev_state.json || echo 'No cached state found'"},
+		}, {
+			ID:         "validate",
+			Name:       "cloud-sdk",
+			Entrypoint: "/workspace/.mpdev/mpdev",
+			Args: []string{"--impersonate-service-account=deployer@project.iam.gserviceaccount.com", "apply",
+				"-f", "configurations.yaml", "--state-file", "/workspace/.mpdev/mpdev_state.json", "--dryrun"},
+			Env: env,
+		}, {
+			ID:         "apply",
+			Name:       "cloud-sdk",
+			Entrypoint: "/workspace/.mpdev/mpdev",
+			Args: []string{"--impersonate-service-account=deployer@project.iam.gserviceaccount.com", "apply",
+				"-f", "configurations.yaml", "--state-file", "/workspace/.mpdev/mpdev_state.json"},
+			Env: env,
+		}, {
+			ID:         "save-state",
+			Name:       "cloud-sdk",
+			Entrypoint: "gsutil",
+			Args:       []string{"cp", "/workspace/.mpdev/mpdev_state.json", "gs://bucket/state.json"},
+		}},
+	}, {
+		name:          "Version built from source",
+		command:       cloudBuildCommand{Filenames: []string{"configurations.yaml"}, MpdevVersion: "dev"},
+		errorContains: "Set --mpdev-version to a release",
+	}, {
+		name:          "State cache not in GCS",
+		command:       cloudBuildCommand{Filenames: []string{"configurations.yaml"}, StateCache: "/tmp/state.json"},
+		errorContains: "state cache must be a GCS path starting with gs://: /tmp/state.json",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func(account string) { impersonateServiceAccount = account }(impersonateServiceAccount)
+			impersonateServiceAccount = tc.impersonate
+
+			c := tc.command
+			c.BuilderImage = "cloud-sdk"
+			c.MachineType = "E2_HIGHCPU_8"
+			c.Timeout = "3600s"
+			if c.MpdevVersion == "" {
+				c.MpdevVersion = "v0.3.0"
+			}
+
+			config, err := c.generate()
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSteps, config.Steps)
+			assert.Equal(t, "3600s", config.Timeout)
+			assert.Equal(t, "E2_HIGHCPU_8", config.Options.MachineType)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// solutionNameRegex matches names that are valid in all generated files,
+// such as deployment names and image names.
+var solutionNameRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,40}[a-z0-9])?$`)
+
+// GetInitCommand returns the `init` command used to generate the skeleton
+// of a solution.
+func GetInitCommand() *cobra.Command {
+	var c initCommand
+	cmd := &cobra.Command{
+		Use:     "init TYPE DIR",
+		Short:   docs.InitShort,
+		Long:    docs.InitLong,
+		Example: docs.InitExamples,
+		Args:    cobra.ExactArgs(2),
+		RunE:    c.RunE,
+		ValidArgsFunction: func(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) == 0 {
+				return filterPrefix(scaffoldTypes(), toComplete), cobra.ShellCompDirectiveNoFileComp
+			}
+			return nil, cobra.ShellCompDirectiveDefault
+		},
+	}
+
+	cmd.Flags().StringVar(&c.Name, "name", c.Name, "name of the solution. Defaults to the name of DIR")
+	return cmd
+}
+
+type initCommand struct {
+	Name string
+}
+
+// RunE executes the `init` command
+func (c *initCommand) RunE(_ *cobra.Command, args []string) error {
+	kind, dir := args[0], args[1]
+	files, ok := scaffolds[kind]
+	if !ok {
+		return apply.UsageError(fmt.Errorf("unknown solution type %s. Must be one of: %s", kind, strings.Join(scaffoldTypes(), ", ")))
+	}
+
+	name := c.Name
+	if name == "" {
+		name = filepath.Base(filepath.Clean(dir))
+	}
+	if !solutionNameRegex.MatchString(name) {
+		return apply.UsageError(fmt.Errorf("invalid solution name: %s. Must match regex %s, set it with --name", name, solutionNameRegex))
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return apply.UsageError(fmt.Errorf("directory %s is not empty", dir))
+	}
+
+	// The test project and images are in the global --project, or left as
+	// a placeholder to be set with cfg set.
+	projectID := cloudDefaults.Project
+	if projectID == "" {
+		projectID = "PROJECT_ID"
+	}
+	err = writeScaffold(files, dir, name, projectID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nNext steps:\n  cd %s\n  mpdev apply --dryrun -f configurations.yaml\n", dir)
+	return nil
+}
+
+// writeScaffold writes the files of a scaffold to dir, for a solution
+// named name that is tested in project projectID.
+func writeScaffold(files map[string]string, dir string, name string, projectID string) error {
+	replacer := strings.NewReplacer("SOLUTION_NAME", name, "PROJECT_ID", projectID)
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		dst := filepath.Join(dir, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if strings.HasSuffix(path, ".sh") {
+			mode = 0755
+		}
+		err = ioutil.WriteFile(dst, []byte(replacer.Replace(files[path])), mode)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write %s", dst)
+		}
+		fmt.Printf("Created %s\n", dst)
+	}
+	return nil
+}
+
+func scaffoldTypes() []string {
+	types := make([]string, 0, len(scaffolds))
+	for t := range scaffolds {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+)
+
+// timeout is the duration after which the commands executed by mpdev are
+// killed, set with --timeout. Zero disables the timeout.
+var timeout time.Duration
+
+// commandTimeout is the duration after which each command executed by
+// resources, and each container they run, is stopped, set with
+// --command-timeout. Zero disables the timeout.
+var commandTimeout time.Duration
+
+// runContext is done when mpdev is interrupted or times out, which stops
+// the commands it executes.
+var runContext = context.Background()
+
+// cancelOnInterrupt sets runContext such that it is done once timeout
+// elapses or mpdev receives SIGINT or SIGTERM, such as on Ctrl-C or when a
+// CI pipeline times out. The resources being applied then fail and clean up
+// their temporary files. A second signal exits immediately.
+func cancelOnInterrupt() {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		runContext, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		runContext, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "Interrupted, stopping the commands being executed. Interrupt again to exit immediately")
+		cancel()
+		<-signals
+		os.Exit(apply.ExitCanceled)
+	}()
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetLintCommand returns the `lint` command, which runs static checks
+// against configuration files.
+func GetLintCommand() *cobra.Command {
+	var c lintCommand
+	cmd := &cobra.Command{
+		Use:     "lint [DIR]",
+		Short:   docs.LintShort,
+		Long:    docs.LintLong,
+		Example: docs.LintExamples,
+		Args:    cobra.MaximumNArgs(1),
+		RunE:    c.RunE,
+	}
+
+	cmd.Flags().BoolVar(&c.WarningsAsErrors, "warnings-as-errors", c.WarningsAsErrors, "if set, fails if any warning is found")
+	addOutputFlag(cmd, &c.Output, outputText)
+	return cmd
+}
+
+type lintCommand struct {
+	WarningsAsErrors bool
+	Output           string
+}
+
+// lintOutput is the json and yaml output of the `lint` command.
+type lintOutput struct {
+	Findings []apply.Finding `json:"findings"`
+	Errors   int             `json:"errors"`
+	Warnings int             `json:"warnings"`
+}
+
+// RunE executes the `lint` command
+func (c *lintCommand) RunE(_ *cobra.Command, args []string) error {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	findings, err := apply.Lint(dir, cloudDefaults, newExecutor())
+	if err != nil {
+		return err
+	}
+
+	out := lintOutput{Findings: []apply.Finding{}}
+	for _, f := range findings {
+		out.Findings = append(out.Findings, f)
+		if f.Severity == apply.SeverityError {
+			out.Errors++
+		} else {
+			out.Warnings++
+		}
+	}
+	errs, warnings := out.Errors, out.Warnings
+	err = printOutput(c.Output, out, func() {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		fmt.Printf("%d errors, %d warnings\n", errs, warnings)
+	})
+	if err != nil {
+		return err
+	}
+	if errs > 0 || (c.WarningsAsErrors && warnings > 0) {
+		return apply.ValidationError(fmt.Errorf("lint found %d errors and %d warnings", errs, warnings))
+	}
+	return nil
+}
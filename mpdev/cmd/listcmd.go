@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// maxListFields is the number of fields of a resource shown by `list`.
+const maxListFields = 3
+
+// listEntry is a resource in the json and yaml output of the `list`
+// command.
+type listEntry struct {
+	Kind       string   `json:"kind"`
+	Name       string   `json:"name"`
+	Fields     []string `json:"fields"`
+	References []string `json:"references"`
+}
+
+// GetListCommand returns the `list` command, which prints a table of the
+// resources in configuration files.
+func GetListCommand() *cobra.Command {
+	var filenames []string
+	var output string
+	cmd := &cobra.Command{
+		Use:     "list -f FILENAME",
+		Short:   docs.ListShort,
+		Long:    docs.ListLong,
+		Example: docs.ListExamples,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			resources, err := loadResources(filenames)
+			if err != nil {
+				return err
+			}
+
+			entries := []listEntry{}
+			for _, rs := range resources {
+				obj, err := apply.ResourceToUnstructured(rs)
+				if err != nil {
+					return err
+				}
+				ref := rs.GetReference()
+				entry := listEntry{Kind: ref.Kind, Name: ref.Name, Fields: keyFields(obj), References: []string{}}
+				for _, dep := range rs.GetDependencies() {
+					entry.References = append(entry.References, dep.Kind+"/"+dep.Name)
+				}
+				entries = append(entries, entry)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			err = printOutput(output, entries, func() {
+				fmt.Fprintln(w, "KIND\tNAME\tFIELDS\tREFERENCES")
+				for _, e := range entries {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Kind, e.Name, strings.Join(e.Fields, " "), strings.Join(e.References, ","))
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return w.Flush()
+		},
+	}
+
+	addFilenamesFlag(cmd, &filenames, "configuration files, or directories searched for configuration files")
+	addOutputFlag(cmd, &output, outputText)
+	return cmd
+}
+
+// GetGetCommand returns the `get` command, which prints a resource as it is
+// decoded by mpdev.
+func GetGetCommand() *cobra.Command {
+	var filenames []string
+	var kind, output string
+	cmd := &cobra.Command{
+		Use:               "get NAME -f FILENAME [-o yaml|json]",
+		Short:             docs.GetShort,
+		Long:              docs.GetLong,
+		Example:           docs.GetExamples,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeResourceNames,
+		RunE: func(_ *cobra.Command, args []string) error {
+			if output != outputYAML && output != outputJSON {
+				return apply.UsageError(fmt.Errorf("unsupported output format %s. Must be yaml or json", output))
+			}
+			resources, err := loadResources(filenames)
+			if err != nil {
+				return err
+			}
+
+			var matches []apply.Resource
+			for _, rs := range resources {
+				ref := rs.GetReference()
+				if ref.Name == args[0] && (kind == "" || ref.Kind == kind) {
+					matches = append(matches, rs)
+				}
+			}
+			switch {
+			case len(matches) == 0:
+				return apply.UsageError(fmt.Errorf("resource %s not found", args[0]))
+			case len(matches) > 1:
+				return apply.UsageError(fmt.Errorf("several resources are named %s, select one with --kind", args[0]))
+			}
+
+			obj, err := apply.ResourceToUnstructured(matches[0])
+			if err != nil {
+				return err
+			}
+			return printOutput(output, obj, nil)
+		},
+	}
+
+	addFilenamesFlag(cmd, &filenames, "configuration files, or directories searched for configuration files")
+	addKindFlag(cmd, &kind, "kind", "kind of the resource, if several resources have the same name")
+	cmd.Flags().StringVarP(&output, "output", "o", outputYAML, "output format. One of yaml or json")
+	_ = cmd.RegisterFlagCompletionFunc("output", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return []string{outputYAML, outputJSON}, cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+// keyFields summarizes the fields of a resource that are set to a string.
+func keyFields(obj apply.Unstructured) []string {
+	fields := []string{}
+	for key, value := range obj {
+		if key == "apiVersion" || key == "kind" {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				fields = append(fields, key+"="+v)
+			}
+		case []interface{}:
+			if len(v) == 1 {
+				if s, ok := v[0].(string); ok {
+					fields = append(fields, key+"="+s)
+				}
+			}
+		}
+	}
+	sort.Strings(fields)
+	if len(fields) > maxListFields {
+		fields = append(fields[:maxListFields], "...")
+	}
+	return fields
+}
+
+// loadResources decodes the resources in configuration files and overlays
+// as apply does. Directories are searched for configuration files as with
+// apply --recursive, and files that fail to parse are reported.
+func loadResources(paths []string) ([]apply.Resource, error) {
+	d := fileDiscovery{Recursive: true}
+	loaded, err := d.load(paths, nil)
+	resources := make([]apply.Resource, len(loaded))
+	for i, rs := range loaded {
+		resources[i] = rs.resource
+	}
+	return resources, err
+}
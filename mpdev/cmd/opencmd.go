@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+	"k8s.io/utils/exec"
+)
+
+// GetOpenCommand returns the `open` command, which opens the Cloud Console
+// or Producer Portal page of the resources in configuration files.
+func GetOpenCommand() *cobra.Command {
+	var filenames []string
+	var noBrowser bool
+	cmd := &cobra.Command{
+		Use:       "open listing|deployment|bucket -f FILENAME",
+		Short:     docs.OpenShort,
+		Long:      docs.OpenLong,
+		Example:   docs.OpenExamples,
+		Args:      cobra.ExactValidArgs(1),
+		ValidArgs: apply.ConsoleTargets,
+		RunE: func(_ *cobra.Command, args []string) error {
+			resources, err := loadResources(filenames)
+			if err != nil {
+				return err
+			}
+			urls, err := apply.ConsoleURLs(args[0], resources, cloudDefaults.Project)
+			if err != nil {
+				return apply.UsageError(err)
+			}
+
+			executor := newExecutor()
+			for _, url := range urls {
+				fmt.Println(url)
+				if noBrowser {
+					continue
+				}
+				if err := openBrowser(executor, url); err != nil {
+					fmt.Fprintf(os.Stderr, "WARNING: failed to open a browser: %v\n", err)
+					noBrowser = true
+				}
+			}
+			return nil
+		},
+	}
+
+	addFilenamesFlag(cmd, &filenames, "configuration files, or directories searched for configuration files")
+	cmd.Flags().BoolVar(&noBrowser, "no-browser", noBrowser, "if set, only prints the URLs instead of opening them in a browser")
+	return cmd
+}
+
+// openBrowser opens url in the default browser of the platform.
+func openBrowser(executor exec.Interface, url string) error {
+	var cmd exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = executor.Command("open", url)
+	case "windows":
+		cmd = executor.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = executor.Command("xdg-open", url)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// noColor disables colored output, which is otherwise used when stdout is a
+// terminal.
+var noColor bool
+
+// colorEnabled returns whether output is colored. Colors are disabled by
+// --no-color and by the NO_COLOR environment variable, see
+// https://no-color.org.
+func colorEnabled() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok || noColor || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// addOutputFlag adds the --output flag, selecting between the human
+// readable output of a command and json or yaml, to cmd.
+func addOutputFlag(cmd *cobra.Command, output *string, defaultOutput string) {
+	*output = defaultOutput
+	cmd.Flags().StringVarP(output, "output", "o", defaultOutput, "output format. One of text, json or yaml")
+	_ = cmd.RegisterFlagCompletionFunc("output", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return []string{outputText, outputJSON, outputYAML}, cobra.ShellCompDirectiveNoFileComp
+	})
+}
+
+// validateOutput returns an error if output is not a supported format.
+func validateOutput(output string) error {
+	switch output {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	default:
+		return apply.UsageError(fmt.Errorf("unsupported output format %s. Must be one of text, json or yaml", output))
+	}
+}
+
+// printOutput writes v to stdout in the json or yaml output format, using
+// the json field names of v for both. text is called for the text format.
+func printOutput(output string, v interface{}, text func()) error {
+	switch output {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var obj interface{}
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return err
+		}
+		return yaml.NewEncoder(os.Stdout).Encode(obj)
+	default:
+		text()
+		return nil
+	}
+}
+
+// redirectProgress sends the progress messages printed to stdout while a
+// command runs to stderr, such that stdout only contains the json or yaml
+// output. The returned function restores stdout.
+func redirectProgress(output string) func() {
+	if output == outputText {
+		return func() {}
+	}
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	return func() { os.Stdout = stdout }
+}
+
+// addJUnitReportFlag adds the --junit-report flag, selecting the file that the
+// JUnit XML report of a run is written to, to cmd.
+func addJUnitReportFlag(cmd *cobra.Command, path *string) {
+	cmd.Flags().StringVar(path, "junit-report", *path, "if set, writes a JUnit XML report of the resources, checks and probes to this file")
+	_ = cobra.MarkFlagFilename(cmd.Flags(), "junit-report", "xml")
+}
+
+// writeJUnitReport writes the JUnit XML report of summary to path, if path is
+// set. Nothing is written if no resource was applied.
+func writeJUnitReport(path string, summary *apply.RunSummary) error {
+	if path == "" || summary == nil {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create JUnit report")
+	}
+	defer f.Close()
+	return apply.WriteJUnitReport(f, summary)
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/pkg/errors"
+)
+
+// isInteractive returns whether mpdev can prompt for input, which requires
+// stdin to be a terminal, and --non-interactive not to be set.
+func isInteractive() bool {
+	return !nonInteractive && isTerminal(os.Stdin)
+}
+
+// isTerminal returns whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// prompter asks for values on stderr and reads the answers from stdin.
+type prompter struct {
+	in *bufio.Reader
+	// fail returns an error listing the missing fields instead of asking
+	// for them, such that --non-interactive fails before anything is
+	// applied
+	fail bool
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin)}
+}
+
+// ask prints question and returns the answer without surrounding spaces.
+func (p *prompter) ask(question string) (string, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return "", errors.Wrap(err, "failed to read answer")
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// confirm asks a yes or no question, defaulting to no.
+func (p *prompter) confirm(question string) (bool, error) {
+	answer, err := p.ask(question + " [y/N]: ")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// promptMissingFields asks for the required fields that are not set in the
+// resources of file, and offers to save the answers to file.
+func (p *prompter) promptMissingFields(file string, objs []apply.Unstructured) error {
+	if p.fail {
+		return checkMissingFields(file, objs)
+	}
+	for _, obj := range objs {
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		for _, field := range apply.MissingFields(obj) {
+			value, err := p.ask(fmt.Sprintf("Enter %s for %s/%s: ", field, kind, name))
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				// The resource fails for the missing field when it is
+				// applied.
+				continue
+			}
+			obj[field] = value
+
+			save, err := p.confirm(fmt.Sprintf("Save %s to %s?", field, file))
+			if err != nil {
+				return err
+			}
+			if save {
+				if err := saveField(file, kind, name, field, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkMissingFields returns an error listing the required fields that are
+// not set in the resources of file.
+func checkMissingFields(file string, objs []apply.Unstructured) error {
+	var missing []string
+	for _, obj := range objs {
+		kind, _ := obj["kind"].(string)
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		for _, field := range apply.MissingFields(obj) {
+			missing = append(missing, fmt.Sprintf("%s of %s/%s", field, kind, name))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return apply.ValidationError(fmt.Errorf("required fields are missing from %s, and --non-interactive does not prompt for them. Set them in the file: %s",
+		file, strings.Join(missing, ", ")))
+}
+
+func saveField(file string, kind string, name string, field string, value string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	b, err = apply.SetField(b, kind, name, field, value)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save %s to %s", field, file)
+	}
+	return ioutil.WriteFile(file, b, info.Mode().Perm())
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetPublishCommand returns the `publish` command, which applies the
+// resources of configuration files stage by stage.
+func GetPublishCommand() *cobra.Command {
+	var c publishCommand
+	cmd := &cobra.Command{
+		Use:     "publish -f FILENAME [--from-stage STAGE] [--until-stage STAGE]",
+		Short:   docs.PublishShort,
+		Long:    docs.PublishLong,
+		Example: docs.PublishExamples,
+		RunE:    c.RunE,
+	}
+
+	addFilenamesFlag(cmd, &c.Filenames, "that contains the configuration to publish")
+	addDiscoveryFlags(cmd, &c.Discovery)
+	addStageFlag(cmd, &c.FromStage, "from-stage", "first stage to run. Defaults to "+apply.Stages[0])
+	addStageFlag(cmd, &c.UntilStage, "until-stage", "last stage to run. Defaults to "+apply.Stages[len(apply.Stages)-1])
+	cmd.Flags().StringVar(&c.StateFile, "state-file", c.StateFile, stateFileUsage)
+	cmd.Flags().IntVar(&c.Parallelism, "parallelism", c.Parallelism, "maximum number of resources applied at once. Defaults to the parallelism of the selected profile, or 1")
+	cmd.Flags().BoolVar(&c.NoInput, "no-input", c.NoInput, "if set, fails instead of prompting for required fields that are missing")
+	addOutputFlag(cmd, &c.Output, outputText)
+	addJUnitReportFlag(cmd, &c.JUnitReport)
+	addCostFlags(cmd, &c.Cost)
+	return cmd
+}
+
+type publishCommand struct {
+	command
+	FromStage  string
+	UntilStage string
+}
+
+// RunE executes the `publish` command
+func (c *publishCommand) RunE(_ *cobra.Command, _ []string) error {
+	return c.run(func(registry apply.Registry) error {
+		return registry.Publish(c.FromStage, c.UntilStage)
+	})
+}
+
+func addStageFlag(cmd *cobra.Command, stage *string, name string, usage string) {
+	cmd.Flags().StringVar(stage, name, *stage, usage)
+	_ = cmd.RegisterFlagCompletionFunc(name, func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return filterPrefix(apply.Stages, toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+}
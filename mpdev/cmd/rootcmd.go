@@ -15,15 +15,122 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
 
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
 	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"k8s.io/utils/exec"
 	"sigs.k8s.io/kustomize/cmd/config/ext"
 )
 
 const kptFileName = "Kptfile"
 
+// impersonateServiceAccount is the service account that mpdev impersonates
+// when calling Google Cloud.
+var impersonateServiceAccount string
+
+// credentialFile is the workload identity federation credential
+// configuration that mpdev authenticates with when calling Google Cloud.
+var credentialFile string
+
+// cloudDefaults are the project, zone and billing project passed with global
+// flags. Values that are not passed are read from the selected profile of
+// the mpdev configuration file.
+var cloudDefaults apply.CloudDefaults
+
+// profileName is the profile of the mpdev configuration file selected with
+// --profile, and profile its options merged with the global flags.
+var (
+	profileName string
+	profile     apply.Profile
+)
+
+// verbosity is the level of the log messages written to stderr, and
+// logFormat their format.
+var (
+	verbosity int
+	logFormat = apply.LogFormatText
+)
+
+// pullPolicy is the pull policy of the images of containers run by
+// resources, set with --pull.
+var pullPolicy = apply.PullIfNotPresent
+
+// containerRuntime is the runtime of the containers run by resources, set
+// with --container-runtime.
+var containerRuntime = apply.RuntimeDocker
+
+// tmpDir is the directory in which temporary directories are created,
+// which defaults to MPDEV_TMPDIR, or the system temporary directory. The
+// temporary directories of a failed run are kept if keepTmpDir is set.
+var (
+	tmpDir     = os.Getenv("MPDEV_TMPDIR")
+	keepTmpDir bool
+)
+
+// auditLog is the file to which the commands executed by mpdev are
+// appended, set with --audit-log, and auditFile the opened file.
+var (
+	auditLog  string
+	auditFile *os.File
+)
+
+// recordFile is the file to which the commands executed by mpdev and their
+// output are recorded, set with --record, and recording the opened file.
+// replayFile is a recording whose commands are replayed instead of being
+// executed, set with --replay, and replayExecutor the executor replaying
+// them.
+var (
+	recordFile     string
+	recording      *os.File
+	replayFile     string
+	replayExecutor exec.Interface
+)
+
+// nonInteractive guarantees that neither mpdev nor the commands it executes
+// prompt for input, set with --non-interactive.
+var nonInteractive = os.Getenv("MPDEV_NON_INTERACTIVE") == "true"
+
+// printCommands prints the commands executed by mpdev before they start,
+// set with --print-commands.
+var printCommands bool
+
+// passEnv are the variables of the environment that the commands executed
+// by mpdev inherit in addition to the default ones, set with --pass-env.
+var passEnv []string
+
+// maxCommands is the maximum number of commands and containers run at once
+// by resources, set with --max-commands.
+var maxCommands int
+
+// buildHost is the ssh destination of the remote host on which container
+// images and archives are built, set with --build-host, and buildHostDir
+// the directory of the host that files are synced to.
+var (
+	buildHost    string
+	buildHostDir string
+)
+
+// fileMode and fileOwner are the permissions and the owner of the files
+// generated by resources, set with --file-mode and --file-owner.
+var (
+	fileMode  string
+	fileOwner string
+)
+
+// commandLogDir is the directory in which the commands executed by
+// resources are logged. Commands are not logged if it is empty.
+var commandLogDir string
+
+// logger writes the log messages enabled by --verbosity. It is nil if no
+// message is enabled.
+var logger *apply.Logger
+
 // GetMain returns the top level command, corresponding to `mpdev` itself.
 func GetMain() *cobra.Command {
 	cmd := &cobra.Command{
@@ -31,16 +138,286 @@ func GetMain() *cobra.Command {
 		Short:   docs.ReferenceShort,
 		Long:    docs.ReferenceLong,
 		Example: docs.ReferenceExamples,
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			l, err := apply.NewLogger(os.Stderr, verbosity, logFormat)
+			if err != nil {
+				return apply.UsageError(err)
+			}
+			if verbosity > 0 {
+				logger = l
+			}
+			apply.UseColor(colorEnabled())
+			if err := apply.UsePullPolicy(pullPolicy); err != nil {
+				return apply.UsageError(err)
+			}
+			if err := apply.UseContainerRuntime(containerRuntime); err != nil {
+				return apply.UsageError(err)
+			}
+			cancelOnInterrupt()
+			if err := apply.SetCommandTimeout(commandTimeout); err != nil {
+				return apply.UsageError(err)
+			}
+			if err := util.SetTempDirBase(tmpDir); err != nil {
+				return errors.Wrapf(err, "failed to create temporary directory %s", tmpDir)
+			}
+
 			// Override openApi file location such that KptFile will be modified
 			// by mpdev cfg commands.
 			// See: https://github.com/GoogleContainerTools/kpt/blob/bf211c225274fe6747304c9b6bf55ea5a98b603a/run/run.go#L48
 			ext.GetOpenAPIFile = func(args []string) (s string, err error) {
 				return filepath.Join(args[0], kptFileName), nil
 			}
+			if credentialFile != "" {
+				if _, err := apply.UseCredentialFile(credentialFile); err != nil {
+					return apply.AuthError(err)
+				}
+			}
+			config, err := apply.LoadConfig(configFile())
+			if err != nil {
+				return apply.ValidationError(err)
+			}
+			selected, err := config.SelectProfile(profileName)
+			if err != nil {
+				return apply.UsageError(err)
+			}
+			profile = selected.Override(apply.Profile{
+				CloudDefaults:             cloudDefaults,
+				ImpersonateServiceAccount: impersonateServiceAccount,
+				AuditLog:                  auditLog,
+				MaxCommands:               maxCommands,
+				PassEnv:                   passEnv,
+				BuildHost:                 buildHost,
+				BuildHostDir:              buildHostDir,
+				FileMode:                  fileMode,
+				FileOwner:                 fileOwner,
+			})
+			cloudDefaults = profile.CloudDefaults
+			impersonateServiceAccount = profile.ImpersonateServiceAccount
+			buildHost = profile.BuildHost
+			buildHostDir = profile.BuildHostDir
+			if buildHostDir == "" {
+				buildHostDir = apply.DefaultBuildHostDir
+			}
+			// The bind mounts of the docker CLI on the build host refer to
+			// paths of the host of its daemon, which are not those that
+			// files are synced to.
+			if buildHost != "" {
+				if !cmd.Flags().Changed("container-runtime") {
+					containerRuntime = apply.RuntimePodman
+					if err := apply.UseContainerRuntime(containerRuntime); err != nil {
+						return apply.UsageError(err)
+					}
+				} else if containerRuntime != apply.RuntimePodman {
+					return apply.UsageError(fmt.Errorf("--build-host requires --container-runtime %s, not %s", apply.RuntimePodman, containerRuntime))
+				}
+			}
+			if err := apply.LimitCommands(profile.MaxCommands); err != nil {
+				return apply.UsageError(err)
+			}
+			if profile.AuditLog != "" {
+				auditFile, err = os.OpenFile(profile.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err != nil {
+					return errors.Wrap(err, "failed to open audit log")
+				}
+			}
+			if recordFile != "" && replayFile != "" {
+				return apply.UsageError(errors.New("--record and --replay cannot be used together"))
+			}
+			if recordFile != "" {
+				recording, err = os.Create(recordFile)
+				if err != nil {
+					return errors.Wrap(err, "failed to create recording of commands")
+				}
+			}
+			if replayFile != "" {
+				f, err := os.Open(replayFile)
+				if err != nil {
+					return apply.UsageError(errors.Wrap(err, "failed to open recording of commands"))
+				}
+				replayExecutor, err = apply.NewReplayExecutor(f)
+				f.Close()
+				if err != nil {
+					return apply.ValidationError(err)
+				}
+			}
+			return apply.UseProfile(profile)
 		},
 	}
+	cmd.PersistentFlags().StringVar(&impersonateServiceAccount, "impersonate-service-account", impersonateServiceAccount,
+		"if set, gcloud and gsutil commands executed by mpdev use the credentials of this service account")
+	cmd.PersistentFlags().StringVar(&credentialFile, "credential-file", credentialFile,
+		"if set, commands executed by mpdev authenticate with this workload identity federation credential configuration")
+	_ = cobra.MarkFlagFilename(cmd.PersistentFlags(), "credential-file", "json")
+	cmd.PersistentFlags().StringVar(&cloudDefaults.Project, "project", cloudDefaults.Project,
+		"project of resources that do not set projectId, and of gcloud and gsutil commands that do not pass a project")
+	cmd.PersistentFlags().StringVar(&cloudDefaults.Zone, "zone", cloudDefaults.Zone,
+		"zone of resources that do not set a zone, and of gcloud commands that do not pass a zone")
+	cmd.PersistentFlags().StringVar(&cloudDefaults.BillingProject, "billing-project", cloudDefaults.BillingProject,
+		"project that API calls made by mpdev are billed to")
+	cmd.PersistentFlags().StringVar(&profileName, "profile", profileName,
+		"profile of the mpdev configuration file whose options are used. Defaults to the defaultProfile of the configuration file")
+	_ = cmd.RegisterFlagCompletionFunc("profile", func(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		config, err := apply.LoadConfig(configFile())
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		var names []string
+		for name := range config.Profiles {
+			names = append(names, name)
+		}
+		return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.PersistentFlags().IntVarP(&verbosity, "verbosity", "v", verbosity,
+		"level of the log messages written to stderr. 1 logs every command executed by mpdev, with its duration and exit status, 2 also logs commands when they start")
+	cmd.PersistentFlags().StringVar(&logFormat, "log-format", logFormat, "format of log messages. One of text or json")
+	cmd.PersistentFlags().StringVar(&pullPolicy, "pull", pullPolicy,
+		"when the images of containers run by resources, such as autogen, are pulled. One of always, if-not-present or never")
+	_ = cmd.RegisterFlagCompletionFunc("pull", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return apply.PullPolicies, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.PersistentFlags().StringVar(&containerRuntime, "container-runtime", containerRuntime,
+		"runtime of the containers run by resources, such as autogen, and of the images built by ContainerImage and K8sAppDeployer resources. One of docker or podman. Defaults to podman with --build-host")
+	_ = cmd.RegisterFlagCompletionFunc("container-runtime", func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+		return apply.ContainerRuntimes, cobra.ShellCompDirectiveNoFileComp
+	})
+	cmd.PersistentFlags().DurationVar(&timeout, "timeout", timeout,
+		"if set, such as to 30m, the commands executed by mpdev are stopped after this duration, and mpdev fails")
+	cmd.PersistentFlags().DurationVar(&commandTimeout, "command-timeout", commandTimeout,
+		"if set, such as to 10m, each command and container run by resources is sent SIGTERM after this duration, and killed if it has not exited 10s later")
+	cmd.PersistentFlags().BoolVar(&nonInteractive, "non-interactive", nonInteractive,
+		"if set, mpdev and the commands it executes never prompt, and fail with guidance if input is needed, such as in CI. Defaults to MPDEV_NON_INTERACTIVE=true")
+	cmd.PersistentFlags().BoolVar(&printCommands, "print-commands", printCommands,
+		"if set, prints every command executed by mpdev before it starts, such that a failing step can be reproduced in a shell")
+	cmd.PersistentFlags().IntVar(&maxCommands, "max-commands", maxCommands,
+		"maximum number of commands and containers run at once by resources applied in parallel. Defaults to the maxCommands of the selected profile, or no limit")
+	cmd.PersistentFlags().StringSliceVar(&passEnv, "pass-env", passEnv,
+		"variables of the environment, by name such as HTTPS_PROXY or by prefix such as TF_VAR_*, inherited by the commands executed by mpdev in addition to the default ones. * passes the whole environment")
+	cmd.PersistentFlags().StringVar(&buildHost, "build-host", buildHost,
+		"if set, such as to user@build-vm, the podman, zip and tar commands executed by mpdev run on this Linux host over ssh, to which their files are synced with rsync. Requires --container-runtime podman, which it implies. Defaults to the buildHost of the selected profile")
+	cmd.PersistentFlags().StringVar(&buildHostDir, "build-host-dir", buildHostDir,
+		"directory of the build host that files are synced to. Defaults to the buildHostDir of the selected profile, or "+apply.DefaultBuildHostDir)
+	cmd.PersistentFlags().StringVar(&fileMode, "file-mode", fileMode,
+		"if set, such as to 0664, the permissions of the files generated by resources, such as the autogen output and archives written to local paths. Directories and executable files also get execute permissions. Defaults to the fileMode of the selected profile")
+	cmd.PersistentFlags().StringVar(&fileOwner, "file-owner", fileOwner,
+		"if set, such as to 1000:1000, the numeric UID, or UID:GID, that owns the files generated by resources, which usually requires running mpdev as root. Defaults to the fileOwner of the selected profile")
+	cmd.PersistentFlags().StringVar(&auditLog, "audit-log", auditLog,
+		"if set, a json record of every command executed by mpdev, with its arguments and the resource that executed it, is appended to this file")
+	cmd.PersistentFlags().StringVar(&recordFile, "record", recordFile,
+		"if set, the commands executed by mpdev, with their arguments, output and exit status, are recorded to this file, which can be attached to a bug report and replayed with --replay. The output of commands printing credentials is not recorded")
+	cmd.PersistentFlags().StringVar(&replayFile, "replay", replayFile,
+		"if set, the commands executed by mpdev are not executed, and replay the output and exit status of the commands with the same arguments recorded in this file with --record")
+	cmd.PersistentFlags().StringVar(&tmpDir, "tmpdir", tmpDir,
+		"directory in which temporary files are created. Defaults to MPDEV_TMPDIR, or the system temporary directory")
+	_ = cobra.MarkFlagDirname(cmd.PersistentFlags(), "tmpdir")
+	cmd.PersistentFlags().BoolVar(&keepTmpDir, "keep-tmpdir", keepTmpDir,
+		"if set, the temporary files of a failed run are kept for debugging. They are always removed after a successful run")
+	cmd.PersistentFlags().BoolVar(&noColor, "no-color", noColor, "if set, disables colored output and spinners, which are otherwise used when stdout is a terminal")
 	cmd.AddCommand(GetMpdevCommands("mpdev")...)
+	markUsageErrors(cmd)
 
 	return cmd
 }
+
+// markUsageErrors marks the errors of parsing the flags and validating the
+// arguments of cmd and its subcommands as usage errors.
+func markUsageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return apply.UsageError(err)
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			return apply.UsageError(args(cmd, a))
+		}
+	}
+	for _, c := range cmd.Commands() {
+		markUsageErrors(c)
+	}
+}
+
+// RemoveTmpDirs removes the temporary directories created by the command,
+// unless it failed and --keep-tmpdir is set.
+func RemoveTmpDirs(err error) {
+	if err != nil && keepTmpDir {
+		for _, dir := range util.TmpDirs() {
+			if _, statErr := os.Stat(dir); statErr == nil {
+				fmt.Fprintf(os.Stderr, "Keeping temporary directory %s\n", dir)
+			}
+		}
+		return
+	}
+	if removeErr := util.RemoveTmpDirs(); removeErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove temporary directories: %v\n", removeErr)
+	}
+}
+
+// ExitCode returns the exit code of mpdev for an error returned by the
+// command, which depends on the class of the failure.
+func ExitCode(err error) int {
+	return apply.ExitCode(err)
+}
+
+// configFile returns the path of the mpdev configuration file, which sets
+// defaults for global flags in named profiles.
+func configFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mpdev", "config.yaml")
+}
+
+// newRegistry returns a registry whose resources execute commands with
+// newExecutor, and run the autogen image of the selected profile.
+func newRegistry() apply.Registry {
+	registry := apply.NewRegistry(newExecutor())
+	registry.SetAutogenImage(profile.AutogenImage)
+	return registry
+}
+
+// newExecutor returns the executor that runs the commands of mpdev, with the
+// impersonation and logging options of the global flags. Its commands
+// inherit the variables of --pass-env and the default ones, wait for one of
+// the slots of --max-commands, cannot prompt with --non-interactive, are
+// printed with --print-commands, are stopped when mpdev is interrupted or
+// they time out, are logged in commandLogDir if it is set, and are appended
+// to the audit log if it is enabled.
+func newExecutor() exec.Interface {
+	// Commands run with a curated environment, to which the other
+	// executors add variables.
+	// Commands are recorded, or replayed, as they would be executed.
+	base := apply.NewExecutor()
+	if replayExecutor != nil {
+		base = replayExecutor
+	}
+	if recording != nil {
+		base = apply.NewRecordingExecutor(base, recording)
+	}
+	executor := apply.NewAuthErrorExecutor(apply.NewSanitizingExecutor(base))
+	if auditFile != nil {
+		executor = apply.NewAuditExecutor(executor, auditFile)
+	}
+	if commandLogDir != "" {
+		executor = apply.NewCommandLogExecutor(executor, commandLogDir)
+	}
+	if logger != nil {
+		executor = apply.NewLoggingExecutor(executor, logger)
+	}
+	if printCommands {
+		executor = apply.NewPrintingExecutor(executor)
+	}
+	// The ssh and rsync commands running commands on the build host are
+	// printed and logged, and wait for the slot of the command.
+	if buildHost != "" {
+		executor = apply.NewBuildHostExecutor(executor, buildHost, buildHostDir)
+	}
+	// The options disabling prompts are printed and logged.
+	if nonInteractive {
+		executor = apply.NewNonInteractiveExecutor(executor)
+	}
+	// Commands wait for a slot before they are logged as started.
+	executor = apply.NewLimitingExecutor(executor)
+	if impersonateServiceAccount != "" {
+		executor = apply.NewImpersonatingExecutor(executor, impersonateServiceAccount)
+	}
+	return apply.NewCancelableExecutor(runContext, executor)
+}
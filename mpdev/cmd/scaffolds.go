@@ -0,0 +1,467 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+// Files generated by `mpdev init`, by path relative to the package
+// directory. SOLUTION_NAME and PROJECT_ID are replaced with the name of the
+// solution and the project ID passed to the command. The resources are
+// named after the solution, so that the packages of several solutions can
+// be applied together.
+var scaffolds = map[string]map[string]string{
+	"single-vm": {
+		"Kptfile":              dmKptfile,
+		"configurations.yaml":  singleVMConfigurations,
+		"checks/vm-running.sh": vmRunningCheck,
+		"README.md":            vmReadme,
+	},
+	"multi-vm": {
+		"Kptfile":              dmKptfile,
+		"configurations.yaml":  multiVMConfigurations,
+		"checks/vm-running.sh": vmRunningCheck,
+		"README.md":            vmReadme,
+	},
+	"k8s": {
+		"Kptfile":                         k8sKptfile,
+		"configurations.yaml":             k8sConfigurations,
+		"chart/Chart.yaml":                k8sChart,
+		"chart/values.yaml":               k8sValues,
+		"chart/templates/deployment.yaml": k8sDeployment,
+		"schema.yaml":                     k8sSchema,
+		"README.md":                       k8sReadme,
+	},
+	"terraform": {
+		"Kptfile":             terraformKptfile,
+		"configurations.yaml": terraformConfigurations,
+		"module/main.tf":      terraformMain,
+		"module/variables.tf": terraformVariables,
+		"module/outputs.tf":   terraformOutputs,
+		"README.md":           terraformReadme,
+	},
+}
+
+const dmKptfile = `apiVersion: kpt.dev/v1alpha1
+kind: Kptfile
+metadata:
+  name: SOLUTION_NAME
+packageMetadata:
+  shortDescription: Deployment Manager Autogen Template
+openAPI:
+  definitions:
+    io.k8s.cli.setters.projectId:
+      x-k8s-cli:
+        setter:
+          name: projectId
+          value: PROJECT_ID
+    io.k8s.cli.setters.image:
+      x-k8s-cli:
+        setter:
+          name: image
+          value: SOLUTION_NAME
+    io.k8s.cli.setters.zipPath:
+      x-k8s-cli:
+        setter:
+          name: zipPath
+          value: SOLUTION_NAME.zip
+`
+
+const dmResources = `# DeploymentManagerTemplate saves the generated template to zipFilePath
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerTemplate
+metadata:
+  name: SOLUTION_NAME-template
+deploymentManagerRef:
+  group: dev.marketplace.cloud.google.com
+  kind: DeploymentManagerAutogenTemplate
+  name: SOLUTION_NAME
+zipFilePath: SOLUTION_NAME.zip # {"$kpt-set":"zipPath"}
+---
+# DeploymentManagerDeployment deploys the generated template to a test
+# project and runs the checks against the deployment
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerDeployment
+metadata:
+  name: SOLUTION_NAME-test
+deploymentManagerRef:
+  group: dev.marketplace.cloud.google.com
+  kind: DeploymentManagerAutogenTemplate
+  name: SOLUTION_NAME
+projectId: PROJECT_ID # {"$ref":"#/definitions/io.k8s.cli.setters.projectId"}
+checks:
+- name: vm-running
+  script:
+    file: checks/vm-running.sh
+---
+`
+
+const singleVMConfigurations = dmResources + `# DeploymentManagerAutogenTemplate generates a Deployment Manager template.
+# See https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/autogen-reference.md
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerAutogenTemplate
+metadata:
+  name: SOLUTION_NAME
+spec:
+  packageInfo:
+    version: '1.0.0'
+    osInfo:
+      name: Debian
+      version: '10'
+    components:
+    - name: SOLUTION_NAME
+      version: '1.0.0'
+  deploymentSpec:
+    singleVm:
+      applicationStatus:
+        type: WAITER
+        waiter:
+          waiterTimeoutSecs: 300
+          # The startup script signals the waiter once the check succeeds
+          script:
+            checkTimeoutSecs: 300
+            checkScriptContent: curl -sf http://localhost/ > /dev/null
+      bootDisk:
+        diskSize:
+          defaultSizeGb: 10
+          minSizeGb: 10
+        diskType:
+          defaultType: pd-standard
+      firewallRules:
+      - port: '80'
+        protocol: TCP
+      images:
+      - name: SOLUTION_NAME # {"$ref":"#/definitions/io.k8s.cli.setters.image"}
+        project: PROJECT_ID # {"$ref":"#/definitions/io.k8s.cli.setters.projectId"}
+      machineType:
+        defaultMachineType:
+          gceMachineType: e2-small
+      networkInterfaces:
+        minCount: 1
+        maxCount: 8
+`
+
+const multiVMConfigurations = dmResources + `# DeploymentManagerAutogenTemplate generates a Deployment Manager template.
+# See https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/autogen-reference.md
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerAutogenTemplate
+metadata:
+  name: SOLUTION_NAME
+spec:
+  packageInfo:
+    version: '1.0.0'
+    osInfo:
+      name: Debian
+      version: '10'
+    components:
+    - name: SOLUTION_NAME
+      version: '1.0.0'
+  deploymentSpec:
+    multiVm:
+      tiers:
+      - name: server
+        title: SOLUTION_NAME
+        applicationStatus:
+          type: WAITER
+          waiter:
+            waiterTimeoutSecs: 300
+            # The startup script signals the waiter once the check succeeds
+            script:
+              checkTimeoutSecs: 300
+              checkScriptContent: curl -sf http://localhost/ > /dev/null
+        bootDisk:
+          diskSize:
+            defaultSizeGb: 10
+            minSizeGb: 10
+          diskType:
+            defaultType: pd-standard
+        firewallRules:
+        - port: '80'
+          protocol: TCP
+          allowed_source: TIER
+        images:
+        - name: SOLUTION_NAME # {"$ref":"#/definitions/io.k8s.cli.setters.image"}
+          project: PROJECT_ID # {"$ref":"#/definitions/io.k8s.cli.setters.projectId"}
+        instanceCount:
+          defaultValue: 2
+          range:
+            startValue: 2
+            endValue: 8
+        machineType:
+          defaultMachineType:
+            gceMachineType: e2-standard-2
+        networkInterfaces:
+          minCount: 1
+          maxCount: 8
+`
+
+const vmRunningCheck = `#!/bin/bash
+# Checks run after the test deployment is created. The deployment name,
+# project and outputs are passed as environment variables, such as
+# DEPLOYMENT_NAME, DEPLOYMENT_PROJECT and DEPLOYMENT_OUTPUT_<NAME>.
+set -euo pipefail
+
+instances=$(gcloud compute instances list --project "${DEPLOYMENT_PROJECT}" \
+  --filter "name~^${DEPLOYMENT_NAME}- AND status=RUNNING" --format "value(name)")
+if [[ -z "${instances}" ]]; then
+  echo "no running instances found for deployment ${DEPLOYMENT_NAME}"
+  exit 1
+fi
+echo "running instances: ${instances}"
+`
+
+const vmReadme = `# SOLUTION_NAME
+
+This package was generated by ` + "`mpdev init`" + `. It generates a Deployment
+Manager template for SOLUTION_NAME, deploys it to a test project and checks
+that the VMs are running.
+
+1. Create a VM image named SOLUTION_NAME in project PROJECT_ID, or set the
+   image and project with ` + "`mpdev cfg set . image IMAGE`" + ` and
+   ` + "`mpdev cfg set . projectId PROJECT_ID`" + `.
+1. Validate the configuration: ` + "`mpdev apply --dryrun -f configurations.yaml`" + `
+1. Generate and test the template: ` + "`mpdev apply -f configurations.yaml`" + `
+
+See the [autogen reference](https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/autogen-reference.md)
+to customize the template.
+`
+
+const k8sKptfile = `apiVersion: kpt.dev/v1alpha1
+kind: Kptfile
+metadata:
+  name: SOLUTION_NAME
+packageMetadata:
+  shortDescription: Kubernetes app
+openAPI:
+  definitions:
+    io.k8s.cli.setters.projectId:
+      x-k8s-cli:
+        setter:
+          name: projectId
+          value: PROJECT_ID
+`
+
+const k8sConfigurations = `# HelmChart lints and packages the chart of the app
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: HelmChart
+metadata:
+  name: SOLUTION_NAME
+dir: chart
+destination: out
+---
+# K8sAppDeployer builds the deployer image of the app and pushes it to
+# gcr.io/PROJECT_ID/SOLUTION_NAME/deployer
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: K8sAppDeployer
+metadata:
+  name: SOLUTION_NAME-deployer
+flavor: helm
+helmChartRef:
+  group: dev.marketplace.cloud.google.com
+  kind: HelmChart
+  name: SOLUTION_NAME
+schemaFile: schema.yaml
+image: gcr.io/PROJECT_ID/SOLUTION_NAME
+track: '1.0'
+version: 1.0.0
+---
+# QuotaCheck verifies that the test project has enough quota for a GKE
+# cluster to test the app
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: QuotaCheck
+metadata:
+  name: SOLUTION_NAME-quota
+projectId: PROJECT_ID # {"$ref":"#/definitions/io.k8s.cli.setters.projectId"}
+zone: us-central1-a
+machineTypes:
+- e2-standard-2
+instances: 3
+diskSizeGb: 100
+`
+
+const k8sChart = `apiVersion: v2
+name: SOLUTION_NAME
+version: 1.0.0
+appVersion: 1.0.0
+`
+
+const k8sValues = `image:
+  repo: nginx
+  tag: '1.19'
+`
+
+const k8sDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+  labels:
+    app.kubernetes.io/name: {{ .Release.Name }}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app.kubernetes.io/name: {{ .Release.Name }}
+  template:
+    metadata:
+      labels:
+        app.kubernetes.io/name: {{ .Release.Name }}
+    spec:
+      containers:
+      - name: SOLUTION_NAME
+        image: "{{ .Values.image.repo }}:{{ .Values.image.tag }}"
+        ports:
+        - containerPort: 80
+`
+
+const k8sSchema = `x-google-marketplace:
+  schemaVersion: v2
+  applicationApiVersion: v1beta1
+  publishedVersion: 1.0.0
+  publishedVersionMetadata:
+    releaseNote: Initial release.
+  images:
+    '':
+      properties:
+        image.repo:
+          type: REPO_WITH_REGISTRY
+        image.tag:
+          type: TAG
+properties:
+  name:
+    type: string
+    x-google-marketplace:
+      type: NAME
+  namespace:
+    type: string
+    x-google-marketplace:
+      type: NAMESPACE
+required:
+- name
+- namespace
+`
+
+const k8sReadme = `# SOLUTION_NAME
+
+This package was generated by ` + "`mpdev init`" + `. It packages the Helm chart in
+chart/, builds the deployer image of the SOLUTION_NAME Kubernetes app and checks
+that the test project has enough quota for a GKE cluster.
+
+1. Validate the configuration: ` + "`mpdev apply --dryrun -f configurations.yaml`" + `
+1. Package the chart and push the deployer: ` + "`mpdev apply -f configurations.yaml`" + `
+
+See [building a deployer](https://github.com/GoogleCloudPlatform/marketplace-k8s-app-tools/blob/master/docs/building-deployer.md)
+for how to customize schema.yaml.
+`
+
+const terraformKptfile = `apiVersion: kpt.dev/v1alpha1
+kind: Kptfile
+metadata:
+  name: SOLUTION_NAME
+packageMetadata:
+  shortDescription: Terraform module
+openAPI:
+  definitions:
+    io.k8s.cli.setters.projectId:
+      x-k8s-cli:
+        setter:
+          name: projectId
+          value: PROJECT_ID
+`
+
+const terraformConfigurations = `# TerraformModule validates the module and archives it to zipFilePath
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: SOLUTION_NAME
+dir: module
+zipFilePath: SOLUTION_NAME.zip
+---
+# QuotaCheck verifies that the test project has enough quota to deploy the
+# module
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: QuotaCheck
+metadata:
+  name: SOLUTION_NAME-quota
+projectId: PROJECT_ID # {"$ref":"#/definitions/io.k8s.cli.setters.projectId"}
+zone: us-central1-a
+machineTypes:
+- e2-small
+externalIps: 1
+diskSizeGb: 10
+`
+
+const terraformMain = `provider "google" {
+  project = var.project_id
+}
+
+resource "google_compute_instance" "instance" {
+  name         = var.goog_cm_deployment_name
+  machine_type = var.machine_type
+  zone         = var.zone
+
+  boot_disk {
+    initialize_params {
+      image = var.source_image
+      size  = 10
+    }
+  }
+
+  network_interface {
+    network = "default"
+    access_config {}
+  }
+}
+`
+
+const terraformVariables = `variable "project_id" {
+  description = "The ID of the project in which to provision resources."
+  type        = string
+}
+
+variable "goog_cm_deployment_name" {
+  description = "The name of the deployment and VM instance."
+  type        = string
+}
+
+variable "source_image" {
+  description = "The image name for the disk for the VM instance."
+  type        = string
+  default     = "projects/PROJECT_ID/global/images/SOLUTION_NAME"
+}
+
+variable "zone" {
+  description = "The zone for the solution to be deployed."
+  type        = string
+  default     = "us-central1-a"
+}
+
+variable "machine_type" {
+  description = "The machine type to create."
+  type        = string
+  default     = "e2-small"
+}
+`
+
+const terraformOutputs = `output "instance_self_link" {
+  description = "Self-link for the compute instance."
+  value       = google_compute_instance.instance.self_link
+}
+`
+
+const terraformReadme = `# SOLUTION_NAME
+
+This package was generated by ` + "`mpdev init`" + `. It validates and archives the
+Terraform module in module/, and checks the quotas of the test project.
+
+1. Validate the configuration: ` + "`mpdev apply --dryrun -f configurations.yaml`" + `
+1. Validate and archive the module: ` + "`mpdev apply -f configurations.yaml`" + `
+`
@@ -0,0 +1,81 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the scaffolds in testdata")
+
+// TestScaffolds compares the files generated by `mpdev init` with the
+// golden files in testdata/scaffolds, and applies them with --dryrun. Run
+// go test ./mpdev/cmd -run TestScaffolds -update to update the golden files.
+func TestScaffolds(t *testing.T) {
+	for _, kind := range scaffoldTypes() {
+		t.Run(kind, func(t *testing.T) {
+			files := scaffolds[kind]
+			golden := filepath.Join("testdata", "scaffolds", kind)
+			if *updateGolden {
+				assert.NoError(t, os.RemoveAll(golden))
+				assert.NoError(t, writeScaffold(files, golden, "wordpress", "my-project"))
+			}
+
+			dir, err := ioutil.TempDir("", "scaffold")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			assert.NoError(t, writeScaffold(files, dir, "wordpress", "my-project"))
+
+			var goldenFiles []string
+			err = filepath.Walk(golden, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(golden, path)
+				if err != nil {
+					return err
+				}
+				goldenFiles = append(goldenFiles, filepath.ToSlash(rel))
+
+				expected, err := ioutil.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				actual, err := ioutil.ReadFile(filepath.Join(dir, rel))
+				if err != nil {
+					return err
+				}
+				assert.Equal(t, string(expected), string(actual), rel+" differs from its golden file")
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, goldenFiles, len(files))
+
+			// A dry run executes no commands, so no command actions are set.
+			registry := apply.NewRegistry(&testingexec.FakeExec{})
+			var d fileDiscovery
+			assert.NoError(t, d.register(registry, []string{filepath.Join(dir, "configurations.yaml")}, nil))
+			assert.NoError(t, registry.Apply(true))
+		})
+	}
+}
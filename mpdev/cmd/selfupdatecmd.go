@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetSelfUpdateCommand returns the `self-update` command, which replaces
+// the mpdev binary with a release.
+func GetSelfUpdateCommand() *cobra.Command {
+	var release string
+	cmd := &cobra.Command{
+		Use:     "self-update [--version VERSION]",
+		Short:   docs.SelfUpdateShort,
+		Long:    docs.SelfUpdateLong,
+		Example: docs.SelfUpdateExamples,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			path, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			path, err = filepath.EvalSymlinks(path)
+			if err != nil {
+				return err
+			}
+			// Binaries installed by Homebrew are replaced by brew upgrade.
+			if strings.Contains(path, "/Cellar/") {
+				return fmt.Errorf("mpdev was installed with Homebrew, run `brew upgrade mpdev` instead")
+			}
+
+			if release == "" {
+				release, err = apply.LatestRelease()
+				if err != nil {
+					return err
+				}
+				if !apply.IsNewerRelease(release, version) {
+					fmt.Printf("mpdev %s is the latest release\n", version)
+					return nil
+				}
+			}
+
+			fmt.Printf("Installing mpdev %s to %s\n", release, path)
+			err = apply.InstallRelease(release, runtime.GOOS, runtime.GOARCH, path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Installed mpdev %s\n", release)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&release, "version", release, "release to install, such as v0.1.0. Defaults to the latest release")
+	return cmd
+}
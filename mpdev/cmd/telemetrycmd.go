@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// usedKinds are the kinds of the resources loaded by the command, which are
+// recorded in its usage metrics.
+var usedKinds []string
+
+// GetTelemetryCommand returns the `telemetry` command, whose subcommands
+// give or withdraw consent to send anonymous usage metrics.
+func GetTelemetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: docs.TelemetryShort,
+		Long:  docs.TelemetryLong,
+	}
+
+	endpoint := telemetryEndpoint
+	enableCmd := &cobra.Command{
+		Use:   "enable [--endpoint URL]",
+		Short: "Agrees to send anonymous usage metrics to an endpoint",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if endpoint == "" {
+				return apply.UsageError(errors.New("--endpoint must be set, since this build of mpdev has no default endpoint of usage metrics"))
+			}
+			c := &apply.TelemetryConsent{Enabled: true, Endpoint: endpoint}
+			if err := c.Save(telemetryFile()); err != nil {
+				return apply.UsageError(err)
+			}
+			fmt.Printf("Usage metrics are sent to %s\n", endpoint)
+			return nil
+		},
+	}
+	enableCmd.Flags().StringVar(&endpoint, "endpoint", endpoint, "https URL that usage metrics are posted to. Defaults to the endpoint of the maintainers of mpdev in released builds")
+
+	disableCmd := &cobra.Command{
+		Use:   "disable",
+		Short: "Withdraws consent to send usage metrics",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			c := &apply.TelemetryConsent{}
+			if err := c.Save(telemetryFile()); err != nil {
+				return err
+			}
+			fmt.Println("Usage metrics are not sent")
+			return nil
+		},
+	}
+
+	var output string
+	statusCmd := &cobra.Command{
+		Use:   "status [-o FORMAT]",
+		Short: "Prints whether usage metrics are sent",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if err := validateOutput(output); err != nil {
+				return err
+			}
+			c, err := apply.LoadTelemetryConsent(telemetryFile())
+			if err != nil {
+				return apply.ValidationError(err)
+			}
+			out := telemetryStatusOutput{Sent: c.Active(), TelemetryConsent: c}
+			return printOutput(output, out, func() {
+				switch {
+				case c.Active():
+					fmt.Printf("Usage metrics are sent to %s, consent given on %s\n", c.Endpoint, c.ConsentTime.Format(time.RFC3339))
+				case c.Enabled:
+					fmt.Printf("Usage metrics are not sent, since %s is set\n", apply.TelemetryKillSwitch)
+				default:
+					fmt.Println("Usage metrics are not sent")
+				}
+			})
+		},
+	}
+	addOutputFlag(statusCmd, &output, outputText)
+
+	cmd.AddCommand(enableCmd, disableCmd, statusCmd)
+	return cmd
+}
+
+// telemetryStatusOutput is the json and yaml output of the `telemetry status`
+// command. Sent is false when consent was given but the kill switch is set.
+type telemetryStatusOutput struct {
+	Sent bool `json:"sent"`
+	*apply.TelemetryConsent
+}
+
+// telemetryFile returns the path of the file recording consent to send
+// usage metrics, next to the mpdev configuration file.
+func telemetryFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mpdev", "telemetry.json")
+}
+
+// RecordUsage sends the anonymous usage metrics of a command that started
+// at start and returned err, if consent was given. Failures to send metrics
+// are ignored, so that they never affect the command.
+func RecordUsage(cmd *cobra.Command, start time.Time, err error) {
+	if cmd == nil {
+		return
+	}
+	name := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+	if name == cmd.Root().Name() || strings.HasPrefix(name, "telemetry") {
+		return
+	}
+	c, loadErr := apply.LoadTelemetryConsent(telemetryFile())
+	if loadErr != nil {
+		return
+	}
+	_ = c.SendUsage(apply.NewUsageEvent(name, version, start, usedKinds, err))
+}
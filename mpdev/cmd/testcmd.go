@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/apply"
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/docs"
+	"github.com/spf13/cobra"
+)
+
+// GetTestCommand returns the `test` command, which applies the verification
+// resources of configuration files against published artifacts.
+func GetTestCommand() *cobra.Command {
+	var c testCommand
+	// Directories are searched for configuration files by default, as
+	// verification suites are usually spread across solutions.
+	c.Discovery.Recursive = true
+	cmd := &cobra.Command{
+		Use:     "test -f FILENAME",
+		Short:   docs.TestShort,
+		Long:    docs.TestLong,
+		Example: docs.TestExamples,
+		RunE:    c.RunE,
+	}
+
+	addFilenamesFlag(cmd, &c.Filenames, "that contains the verification resources to apply")
+	addDiscoveryFlags(cmd, &c.Discovery)
+	cmd.Flags().IntVar(&c.Parallelism, "parallelism", c.Parallelism, "maximum number of resources applied at once. Defaults to the parallelism of the selected profile, or 1")
+	addOutputFlag(cmd, &c.Output, outputText)
+	addJUnitReportFlag(cmd, &c.JUnitReport)
+	addCostFlags(cmd, &c.Cost)
+	return cmd
+}
+
+type testCommand struct {
+	Filenames   []string
+	Discovery   fileDiscovery
+	Parallelism int
+	Output      string
+	JUnitReport string
+	Cost        costLimit
+}
+
+// RunE executes the `test` command
+func (c *testCommand) RunE(_ *cobra.Command, _ []string) error {
+	if err := validateOutput(c.Output); err != nil {
+		return err
+	}
+	registry := newRegistry()
+	parallelism := c.Parallelism
+	if parallelism == 0 {
+		parallelism = profile.Parallelism
+	}
+	registry.SetParallelism(parallelism)
+	apply.UseSpinner(colorEnabled() && parallelism <= 1 && c.Output == outputText)
+	if err := c.Cost.use(); err != nil {
+		return err
+	}
+	if err := c.Discovery.register(registry, c.Filenames, nil); err != nil {
+		return err
+	}
+
+	restore := redirectProgress(c.Output)
+	err := registry.Test()
+	restore()
+	if reportErr := writeJUnitReport(c.JUnitReport, registry.Summary()); reportErr != nil && err == nil {
+		err = reportErr
+	}
+	if c.Output != outputText {
+		if printErr := printOutput(c.Output, registry.Summary(), nil); printErr != nil && err == nil {
+			err = printErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+#!/bin/bash
+# Checks run after the test deployment is created. The deployment name,
+# project and outputs are passed as environment variables, such as
+# DEPLOYMENT_NAME, DEPLOYMENT_PROJECT and DEPLOYMENT_OUTPUT_<NAME>.
+set -euo pipefail
+
+instances=$(gcloud compute instances list --project "${DEPLOYMENT_PROJECT}" \
+  --filter "name~^${DEPLOYMENT_NAME}- AND status=RUNNING" --format "value(name)")
+if [[ -z "${instances}" ]]; then
+  echo "no running instances found for deployment ${DEPLOYMENT_NAME}"
+  exit 1
+fi
+echo "running instances: ${instances}"
@@ -0,0 +1,21 @@
+provider "google" {
+  project = var.project_id
+}
+
+resource "google_compute_instance" "instance" {
+  name         = var.goog_cm_deployment_name
+  machine_type = var.machine_type
+  zone         = var.zone
+
+  boot_disk {
+    initialize_params {
+      image = var.source_image
+      size  = 10
+    }
+  }
+
+  network_interface {
+    network = "default"
+    access_config {}
+  }
+}
@@ -0,0 +1,4 @@
+output "instance_self_link" {
+  description = "Self-link for the compute instance."
+  value       = google_compute_instance.instance.self_link
+}
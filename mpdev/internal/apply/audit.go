@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// resourceKey is the key of the reference of the resource executing a
+// command in the context of the command.
+type resourceKey struct{}
+
+// resourceFromContext returns the resource executing the commands bound to
+// ctx, if any.
+func resourceFromContext(ctx context.Context) (Reference, bool) {
+	ref, ok := ctx.Value(resourceKey{}).(Reference)
+	return ref, ok
+}
+
+// resourceRegistry is the registry passed to a resource when it is applied,
+// whose executor binds commands to a context carrying the reference of the
+// resource, such that they can be attributed to it.
+type resourceRegistry struct {
+	*registry
+	executor exec.Interface
+}
+
+func (r *resourceRegistry) GetExecutor() exec.Interface {
+	return r.executor
+}
+
+// forResource returns the registry passed to rs when it is applied.
+func (r *registry) forResource(rs Resource) Registry {
+	ctx := context.WithValue(executorContext(r.executor), resourceKey{}, rs.GetReference())
+	return &resourceRegistry{registry: r, executor: &resourceExecutor{Interface: r.executor, ctx: ctx}}
+}
+
+type resourceExecutor struct {
+	exec.Interface
+	ctx context.Context
+}
+
+func (e *resourceExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return e.Interface.CommandContext(e.ctx, cmd, args...)
+}
+
+func (e *resourceExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	if ref, ok := resourceFromContext(e.ctx); ok {
+		ctx = context.WithValue(ctx, resourceKey{}, ref)
+	}
+	return e.Interface.CommandContext(ctx, cmd, args...)
+}
+
+// Context returns the context that commands of the executor are bound to.
+func (e *resourceExecutor) Context() context.Context {
+	return e.ctx
+}
+
+// auditRecord is the record of an executed command in the audit log.
+type auditRecord struct {
+	Time       string   `json:"time"`
+	Resource   string   `json:"resource,omitempty"`
+	Command    []string `json:"command"`
+	Dir        string   `json:"dir,omitempty"`
+	Duration   string   `json:"duration"`
+	ExitStatus int      `json:"exitStatus"`
+}
+
+// NewAuditExecutor returns an executor that appends a json record of every
+// command it executes to w once the command exits: its arguments, as passed
+// to the executable, the resource that executed it, its directory, duration
+// and exit status. Records are written with a single call to w, such that
+// several mpdev processes can append to the same file. Commands fail if
+// their record cannot be written.
+func NewAuditExecutor(executor exec.Interface, w io.Writer) exec.Interface {
+	return &auditExecutor{Interface: executor, audit: &auditLog{w: w, now: time.Now}}
+}
+
+type auditLog struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+func (l *auditLog) write(record auditRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(b, '\n'))
+	return errors.Wrap(err, "failed to write audit log")
+}
+
+type auditExecutor struct {
+	exec.Interface
+	audit *auditLog
+}
+
+func (e *auditExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &auditCmd{Cmd: e.Interface.Command(cmd, args...), audit: e.audit, argv: append([]string{cmd}, args...)}
+}
+
+func (e *auditExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	c := &auditCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), audit: e.audit, argv: append([]string{cmd}, args...)}
+	if ref, ok := resourceFromContext(ctx); ok {
+		c.resource = ref.Kind + "/" + ref.Name
+	}
+	return c
+}
+
+type auditCmd struct {
+	exec.Cmd
+	audit    *auditLog
+	argv     []string
+	resource string
+	dir      string
+	start    time.Time
+}
+
+func (c *auditCmd) SetDir(dir string) {
+	c.dir = dir
+	c.Cmd.SetDir(dir)
+}
+
+func (c *auditCmd) Run() error {
+	c.start = c.audit.now()
+	return c.exited(c.Cmd.Run())
+}
+
+func (c *auditCmd) Output() ([]byte, error) {
+	c.start = c.audit.now()
+	out, err := c.Cmd.Output()
+	return out, c.exited(err)
+}
+
+func (c *auditCmd) CombinedOutput() ([]byte, error) {
+	c.start = c.audit.now()
+	out, err := c.Cmd.CombinedOutput()
+	return out, c.exited(err)
+}
+
+func (c *auditCmd) Start() error {
+	c.start = c.audit.now()
+	err := c.Cmd.Start()
+	if err != nil {
+		return c.exited(err)
+	}
+	return nil
+}
+
+func (c *auditCmd) Wait() error {
+	return c.exited(c.Cmd.Wait())
+}
+
+// exited writes the record of the command, and returns the error of the
+// command, or the error writing the record if the command succeeded.
+func (c *auditCmd) exited(err error) error {
+	writeErr := c.audit.write(auditRecord{
+		Time:       c.start.UTC().Format(time.RFC3339Nano),
+		Resource:   c.resource,
+		Command:    redactArgs(c.argv),
+		Dir:        c.dir,
+		Duration:   c.audit.now().Sub(c.start).Round(time.Millisecond).String(),
+		ExitStatus: exitStatus(err),
+	})
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
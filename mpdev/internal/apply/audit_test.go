@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestAuditExecutor(t *testing.T) {
+	exitErr := testingexec.FakeExitError{Status: 1}
+	fcmds := []testingexec.FakeCmd{{
+		RunScript: []testingexec.FakeRunAction{func() ([]byte, []byte, error) { return nil, nil, nil }},
+	}, {
+		OutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) { return nil, nil, exitErr }},
+	}, {
+		RunScript: []testingexec.FakeRunAction{func() ([]byte, []byte, error) { return nil, nil, nil }},
+	}}
+	fexec := &testingexec.FakeExec{}
+	for i := range fcmds {
+		fcmd := &fcmds[i]
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+
+	var audit bytes.Buffer
+	auditor := NewAuditExecutor(fexec, &audit)
+	auditor.(*auditExecutor).audit.now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+	executor := NewImpersonatingExecutor(auditor, "ci@project.iam.gserviceaccount.com")
+	registry := NewRegistry(NewCancelableExecutor(context.Background(), executor))
+	r1 := newTestResourceFunc("r1", func(r Registry, _ bool) error {
+		cmd := r.GetExecutor().Command("gsutil", "cp", "dm.zip", "gs://bucket/")
+		cmd.SetDir("/tmp/dm")
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		_, err := r.GetExecutor().Command("gcloud", "compute", "images", "describe", "image").Output()
+		assert.Equal(t, exitErr, err)
+		return nil
+	}, nil)
+	registry.RegisterResource(r1, "")
+	assert.NoError(t, registry.Apply(false))
+	// Commands executed outside of resources are not attributed.
+	assert.NoError(t, registry.GetExecutor().Command("docker", "version").Run())
+
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var record auditRecord
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, []auditRecord{{
+		Time:     "2020-06-01T12:00:00Z",
+		Resource: "testKind/r1",
+		Command:  []string{"gsutil", "-i", "ci@project.iam.gserviceaccount.com", "cp", "dm.zip", "gs://bucket/"},
+		Dir:      "/tmp/dm",
+		Duration: "0s",
+	}, {
+		Time:       "2020-06-01T12:00:00Z",
+		Resource:   "testKind/r1",
+		Command:    []string{"gcloud", "--impersonate-service-account=ci@project.iam.gserviceaccount.com", "compute", "images", "describe", "image"},
+		Duration:   "0s",
+		ExitStatus: 1,
+	}, {
+		Time:     "2020-06-01T12:00:00Z",
+		Command:  []string{"docker", "version"},
+		Duration: "0s",
+	}}, records)
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestAuditExecutorWriteError(t *testing.T) {
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{func() ([]byte, []byte, error) { return nil, nil, nil }}}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+	err := NewAuditExecutor(fexec, failingWriter{}).Command("gsutil", "ls").Run()
+	assert.EqualError(t, err, "failed to write audit log: disk full")
+}
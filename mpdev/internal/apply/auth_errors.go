@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"io"
+	"regexp"
+
+	"k8s.io/utils/exec"
+)
+
+// authFailureRegex matches the messages of gcloud, gsutil, docker and the
+// credential helpers when credentials are missing, expired or lack
+// permissions.
+var authFailureRegex = regexp.MustCompile(`(?i)(reauthentication|` +
+	`do not currently have an active account|` +
+	`does not have [a-z.]* ?permission|` +
+	`PERMISSION_DENIED|` +
+	`insufficient authentication scopes|` +
+	`invalid authentication credentials|` +
+	`could not find default credentials|` +
+	`refreshing your current auth tokens|` +
+	`invalid_grant|` +
+	`unauthorized:|` +
+	`denied: (requested access|permission)|` +
+	`authentication required|` +
+	`no basic auth credentials|` +
+	`AccessDeniedException|` +
+	`401 Anonymous caller)`)
+
+// authOutputLimit is the number of bytes at the end of the stderr of a
+// command in which authentication failures are looked for.
+const authOutputLimit = 16 * 1024
+
+// NewAuthErrorExecutor returns an executor whose commands fail with an
+// error of the ExitAuth class when they exit with a status other than 0 and
+// their stderr reports that credentials are missing or lack permissions.
+func NewAuthErrorExecutor(executor exec.Interface) exec.Interface {
+	return &authErrorExecutor{Interface: executor}
+}
+
+type authErrorExecutor struct {
+	exec.Interface
+}
+
+func (e *authErrorExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &authErrorCmd{Cmd: e.Interface.Command(cmd, args...)}
+}
+
+func (e *authErrorExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &authErrorCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...)}
+}
+
+type authErrorCmd struct {
+	exec.Cmd
+	stderr io.Writer
+	errBuf tailBuffer
+}
+
+func (c *authErrorCmd) SetStderr(w io.Writer) {
+	c.stderr = w
+	c.Cmd.SetStderr(w)
+}
+
+func (c *authErrorCmd) Run() error {
+	c.capture()
+	err := c.Cmd.Run()
+	return c.exited(c.errBuf.Bytes(), err)
+}
+
+func (c *authErrorCmd) Output() ([]byte, error) {
+	c.capture()
+	out, err := c.Cmd.Output()
+	return out, c.exited(c.errBuf.Bytes(), err)
+}
+
+func (c *authErrorCmd) CombinedOutput() ([]byte, error) {
+	out, err := c.Cmd.CombinedOutput()
+	return out, c.exited(out, err)
+}
+
+func (c *authErrorCmd) Start() error {
+	c.capture()
+	return c.Cmd.Start()
+}
+
+func (c *authErrorCmd) Wait() error {
+	err := c.Cmd.Wait()
+	return c.exited(c.errBuf.Bytes(), err)
+}
+
+// capture makes the command also write its stderr to the buffer in which
+// authentication failures are looked for.
+func (c *authErrorCmd) capture() {
+	c.Cmd.SetStderr(teeWriter(c.stderr, &c.errBuf))
+}
+
+// exited returns err, as an authentication failure if the command exited
+// with a status other than 0 and output reports one.
+func (c *authErrorCmd) exited(output []byte, err error) error {
+	exitErr, ok := err.(exec.ExitError)
+	if !ok || !authFailureRegex.Match(output) {
+		return err
+	}
+	return &authExitError{ExitError: exitErr}
+}
+
+// authExitError is the exit error of a command that failed because of
+// missing credentials or permissions. It is still an exec.ExitError, such
+// that the exit status of the command can be read.
+type authExitError struct {
+	exec.ExitError
+}
+
+// tailBuffer keeps the last authOutputLimit bytes written to it.
+type tailBuffer struct {
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > authOutputLimit {
+		b.buf = b.buf[len(b.buf)-authOutputLimit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) Bytes() []byte {
+	return b.buf
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestAuthErrorExecutor(t *testing.T) {
+	exitErr := testingexec.FakeExitError{Status: 1}
+	testCases := []struct {
+		name     string
+		stderr   string
+		err      error
+		combined bool
+		expected int
+	}{{
+		name:     "Succeeded",
+		stderr:   "ERROR: (gcloud.auth) Reauthentication failed.",
+		expected: 0,
+	}, {
+		name:     "Failed",
+		stderr:   "ERROR: (gcloud.compute.images.describe) Could not fetch resource: not found",
+		err:      exitErr,
+		expected: ExitTool,
+	}, {
+		name:     "Expired credentials",
+		stderr:   "ERROR: (gcloud.compute.images.describe) There was a problem refreshing your current auth tokens: Reauthentication failed.",
+		err:      exitErr,
+		expected: ExitAuth,
+	}, {
+		name:     "Missing permission",
+		stderr:   "ERROR: (gcloud.compute.images.create) Could not fetch resource:\n - Required 'compute.images.create' permission for 'projects/p/global/images/i'\n - PERMISSION_DENIED",
+		err:      exitErr,
+		expected: ExitAuth,
+	}, {
+		name:     "Denied push",
+		stderr:   "denied: Permission \"artifactregistry.repositories.uploadArtifacts\" denied on resource",
+		err:      exitErr,
+		combined: true,
+		expected: ExitAuth,
+	}, {
+		name:     "Not an exit error",
+		stderr:   "PERMISSION_DENIED",
+		err:      errors.New("failed to start"),
+		expected: ExitFailure,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript:            []testingexec.FakeRunAction{func() ([]byte, []byte, error) { return nil, []byte(tc.stderr), tc.err }},
+				CombinedOutputScript: []testingexec.FakeAction{func() ([]byte, []byte, error) { return []byte(tc.stderr), nil, tc.err }},
+			}
+			executor := NewAuthErrorExecutor(&testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}})
+
+			cmd := executor.Command("gcloud", "compute", "images", "describe", "image")
+			var err error
+			if tc.combined {
+				_, err = cmd.CombinedOutput()
+			} else {
+				var stderr bytes.Buffer
+				cmd.SetStderr(&stderr)
+				err = cmd.Run()
+				assert.Equal(t, tc.stderr, stderr.String())
+			}
+			assert.Equal(t, tc.expected, ExitCode(err))
+			if tc.expected == ExitAuth {
+				assert.Equal(t, 1, err.(exec.ExitError).ExitStatus())
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// DefaultBuildHostDir is the directory of the build host that local files
+// are synced to.
+const DefaultBuildHostDir = "/tmp/mpdev"
+
+// buildHostCommands are the commands that build and package, which run on
+// the build host. docker is not one of them, since the bind mounts of the
+// docker CLI refer to paths of the host of its daemon, which are not those
+// that files are synced to, and builds use the podman runtime instead.
+var buildHostCommands = map[string]bool{
+	"podman": true,
+	"tar":    true,
+	"zip":    true,
+}
+
+// NewBuildHostExecutor returns an executor that runs the commands building
+// container images and archives, such as podman and zip, on a remote Linux
+// host over ssh. The other commands run locally.
+//
+// Local files are synced with rsync to the same absolute path under dir on
+// the host, before each command runs: its directory and the files in its
+// arguments. Arguments that are absolute paths are rewritten to their path
+// on the host, and files written by the command are synced back once it
+// exits. host is an ssh destination, such as user@build-vm, which must
+// accept keys of the ssh agent or of the ssh configuration, since commands
+// cannot prompt for passwords.
+func NewBuildHostExecutor(executor exec.Interface, host string, dir string) exec.Interface {
+	return &buildHostExecutor{Interface: executor, host: host, dir: dir}
+}
+
+type buildHostExecutor struct {
+	exec.Interface
+	host string
+	dir  string
+}
+
+func (e *buildHostExecutor) Command(cmd string, args ...string) exec.Cmd {
+	if !buildHostCommands[filepath.Base(cmd)] {
+		return e.Interface.Command(cmd, args...)
+	}
+	return &buildHostCmd{executor: e, name: cmd, args: args}
+}
+
+func (e *buildHostExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	if !buildHostCommands[filepath.Base(cmd)] {
+		return e.Interface.CommandContext(ctx, cmd, args...)
+	}
+	return &buildHostCmd{executor: e, ctx: ctx, name: cmd, args: args}
+}
+
+// LookPath looks up the commands of the build host on the host.
+func (e *buildHostExecutor) LookPath(file string) (string, error) {
+	if !buildHostCommands[filepath.Base(file)] {
+		return e.Interface.LookPath(file)
+	}
+	stdout, err := e.Interface.Command("ssh", e.sshArgs("command -v "+quoteArgs([]string{file})[0])...).Output()
+	if err != nil {
+		if _, ok := err.(exec.ExitError); ok {
+			return "", exec.ErrExecutableNotFound
+		}
+		return "", errors.Wrapf(err, "failed to connect to build host %s", e.host)
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// sshArgs returns the arguments of ssh running script on the host.
+// BatchMode fails instead of asking for passwords.
+func (e *buildHostExecutor) sshArgs(script string) []string {
+	return []string{"-o", "BatchMode=yes", e.host, script}
+}
+
+// remotePath returns the path on the host of the local absolute path p.
+func (e *buildHostExecutor) remotePath(p string) string {
+	return path.Join(e.dir, hostPath(p))
+}
+
+// hostPath returns the local absolute path p as a path of the host, relative
+// to the directory that files are synced to. The volume of Windows paths is
+// a directory, such as /C/src for C:\src, since a colon would be taken for
+// the separator of volumes of containers.
+func hostPath(p string) string {
+	volume := filepath.VolumeName(p)
+	return path.Clean("/" + filepath.ToSlash(strings.TrimSuffix(volume, ":")) + filepath.ToSlash(p[len(volume):]))
+}
+
+// buildHostCmd runs a command on the build host. The ssh command is created
+// when the command starts, once its directory and environment are set.
+type buildHostCmd struct {
+	executor *buildHostExecutor
+	ctx      context.Context
+	name     string
+	args     []string
+	dir      string
+	env      []string
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+	cmd      exec.Cmd
+	// synced are the local paths synced to the host, and back once the
+	// command exits
+	synced []string
+	// envFile is a local file exporting the environment of the command
+	envFile string
+}
+
+func (c *buildHostCmd) SetDir(dir string)       { c.dir = dir }
+func (c *buildHostCmd) SetEnv(env []string)     { c.env = env }
+func (c *buildHostCmd) SetStdin(in io.Reader)   { c.stdin = in }
+func (c *buildHostCmd) SetStdout(out io.Writer) { c.stdout = out }
+func (c *buildHostCmd) SetStderr(out io.Writer) { c.stderr = out }
+
+// prepare syncs the files of the command to the host, and creates the ssh
+// command running it there.
+func (c *buildHostCmd) prepare() error {
+	if c.cmd != nil {
+		return nil
+	}
+	e := c.executor
+	dir := c.dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir = wd
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// Files written by the command, which do not exist yet, need their
+	// directory on the host. The directories of inputs are created by
+	// rsync.
+	var inputs []string
+	mkdirs := []string{e.remotePath(dir)}
+	if c.dir != "" {
+		inputs = append(inputs, dir)
+		c.synced = append(c.synced, dir)
+	}
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg
+		prefix, p, suffix := splitPathArg(arg)
+		if !filepath.IsAbs(p) {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			inputs = append(inputs, p)
+		} else {
+			mkdirs = append(mkdirs, e.remotePath(filepath.Dir(p)))
+		}
+		c.synced = append(c.synced, p)
+		args[i] = prefix + e.remotePath(p) + suffix
+	}
+	// The variables set by mpdev, which may be secrets, are passed in a
+	// file instead of the arguments of ssh.
+	script := "mkdir -p " + strings.Join(quoteArgs(mkdirs), " ") + " && cd " + quoteArgs([]string{e.remotePath(dir)})[0] + " && "
+	if vars := addedEnv(c.env, os.Environ()); len(vars) > 0 {
+		envFile, err := writeEnvFile(vars)
+		if err != nil {
+			return err
+		}
+		c.envFile = envFile
+		inputs = append(inputs, envFile)
+		remoteEnvFile := quoteArgs([]string{e.remotePath(envFile)})[0]
+		script += ". " + remoteEnvFile + " && rm " + remoteEnvFile + " && "
+	}
+	script += strings.Join(quoteArgs(append([]string{filepath.Base(c.name)}, args...)), " ")
+
+	if len(inputs) > 0 {
+		rsyncArgs := append(append([]string{"-aR"}, inputs...), e.host+":"+e.dir+"/")
+		if err := runCommand(e.Interface, "rsync", rsyncArgs...); err != nil {
+			return errors.Wrapf(err, "failed to sync files to build host %s", e.host)
+		}
+	}
+
+	if c.ctx != nil {
+		c.cmd = e.Interface.CommandContext(c.ctx, "ssh", e.sshArgs(script)...)
+	} else {
+		c.cmd = e.Interface.Command("ssh", e.sshArgs(script)...)
+	}
+	if c.stdin != nil {
+		c.cmd.SetStdin(c.stdin)
+	}
+	if c.stdout != nil {
+		c.cmd.SetStdout(c.stdout)
+	}
+	if c.stderr != nil {
+		c.cmd.SetStderr(c.stderr)
+	}
+	return nil
+}
+
+// syncBack syncs the files of the command from the host once it exited,
+// unless err is set. Files that the command did not write are ignored.
+func (c *buildHostCmd) syncBack(err error) error {
+	if c.envFile != "" {
+		os.RemoveAll(filepath.Dir(c.envFile))
+	}
+	if err != nil || len(c.synced) == 0 {
+		return err
+	}
+	e := c.executor
+	args := []string{"-aR", "--ignore-missing-args"}
+	for _, p := range c.synced {
+		// The relative path after /./ is created in the destination.
+		args = append(args, e.host+":"+e.dir+"/."+hostPath(p))
+	}
+	err = runCommand(e.Interface, "rsync", append(args, "/")...)
+	return errors.Wrapf(err, "failed to sync files from build host %s", e.host)
+}
+
+func (c *buildHostCmd) Run() error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	return c.syncBack(c.cmd.Run())
+}
+
+func (c *buildHostCmd) Output() ([]byte, error) {
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+	out, err := c.cmd.Output()
+	return out, c.syncBack(err)
+}
+
+func (c *buildHostCmd) CombinedOutput() ([]byte, error) {
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+	out, err := c.cmd.CombinedOutput()
+	return out, c.syncBack(err)
+}
+
+func (c *buildHostCmd) StdoutPipe() (io.ReadCloser, error) {
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+	return c.cmd.StdoutPipe()
+}
+
+func (c *buildHostCmd) StderrPipe() (io.ReadCloser, error) {
+	if err := c.prepare(); err != nil {
+		return nil, err
+	}
+	return c.cmd.StderrPipe()
+}
+
+func (c *buildHostCmd) Start() error {
+	if err := c.prepare(); err != nil {
+		return err
+	}
+	return c.cmd.Start()
+}
+
+func (c *buildHostCmd) Wait() error {
+	return c.syncBack(c.cmd.Wait())
+}
+
+func (c *buildHostCmd) Stop() {
+	if c.cmd != nil {
+		c.cmd.Stop()
+	}
+}
+
+// splitPathArg splits an argument into the path it may contain and the
+// text around it: the option of --option=PATH, and the container path of
+// volumes such as PATH:/dir:ro. The colon of the volume of Windows paths,
+// such as C:\src:/dir, does not separate them.
+func splitPathArg(arg string) (prefix string, p string, suffix string) {
+	if strings.HasPrefix(arg, "-") {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			return arg, "", ""
+		}
+		prefix, arg = arg[:i+1], arg[i+1:]
+	}
+	volume := len(filepath.VolumeName(arg))
+	if i := strings.Index(arg[volume:], ":"); i >= 0 {
+		return prefix, arg[:volume+i], arg[volume+i:]
+	}
+	return prefix, arg, ""
+}
+
+// writeEnvFile writes a shell script exporting the variables vars to a file
+// in a temporary directory, which only the current user can read.
+func writeEnvFile(vars []string) (string, error) {
+	dir, err := util.CreateTmpDir("buildEnv")
+	if err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "env.sh"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	defer f.Close()
+	for _, v := range vars {
+		if i := strings.Index(v, "="); i > 0 {
+			if _, err := fmt.Fprintf(f, "export %s=%s\n", v[:i], quoteArgs([]string{v[i+1:]})[0]); err != nil {
+				os.RemoveAll(dir)
+				return "", err
+			}
+		}
+	}
+	return f.Name(), nil
+}
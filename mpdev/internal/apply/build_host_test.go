@@ -0,0 +1,202 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// newRecordingExec returns an executor whose n commands succeed, and the
+// arguments of the commands it ran.
+func newRecordingExec(n int) (*testingexec.FakeExec, *[][]string) {
+	var argv [][]string
+	executor := &testingexec.FakeExec{}
+	for i := 0; i < n; i++ {
+		executor.CommandScript = append(executor.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			argv = append(argv, append([]string{cmd}, args...))
+			return &testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+			}}
+		})
+	}
+	return executor, &argv
+}
+
+func TestBuildHostExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildhost")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	assert.NoError(t, ioutil.WriteFile(dockerfile, []byte("FROM scratch"), 0644))
+	zipFile := filepath.Join(dir, "out", "package.zip")
+
+	testCases := []struct {
+		name     string
+		cmd      string
+		args     []string
+		dir      string
+		expected [][]string
+	}{{
+		name: "Local command",
+		cmd:  "gcloud",
+		args: []string{"config", "list"},
+		expected: [][]string{
+			{"gcloud", "config", "list"},
+		},
+	}, {
+		name: "Inputs",
+		cmd:  "podman",
+		args: []string{"build", "--file=" + dockerfile, "-t", "gcr.io/project/app:1.0", dir},
+		expected: [][]string{
+			{"rsync", "-aR", dockerfile, dir, "builder@vm:/tmp/mpdev/"},
+			{"ssh", "-o", "BatchMode=yes", "builder@vm", "mkdir -p /tmp/mpdev" + wd(t) + " && cd /tmp/mpdev" + wd(t) +
+				" && podman build --file=/tmp/mpdev" + dockerfile + " -t gcr.io/project/app:1.0 /tmp/mpdev" + dir},
+			{"rsync", "-aR", "--ignore-missing-args", "builder@vm:/tmp/mpdev/." + dockerfile, "builder@vm:/tmp/mpdev/." + dir, "/"},
+		},
+	}, {
+		name: "Outputs",
+		cmd:  "zip",
+		args: []string{"-r", zipFile, "."},
+		dir:  dir,
+		expected: [][]string{
+			{"rsync", "-aR", dir, "builder@vm:/tmp/mpdev/"},
+			{"ssh", "-o", "BatchMode=yes", "builder@vm", "mkdir -p /tmp/mpdev" + dir + " /tmp/mpdev" + filepath.Dir(zipFile) +
+				" && cd /tmp/mpdev" + dir + " && zip -r /tmp/mpdev" + zipFile + " ."},
+			{"rsync", "-aR", "--ignore-missing-args", "builder@vm:/tmp/mpdev/." + dir, "builder@vm:/tmp/mpdev/." + zipFile, "/"},
+		},
+	}, {
+		name: "Volumes",
+		cmd:  "podman",
+		args: []string{"run", "--volume", dir + ":/data:ro", "--read-only", "busybox"},
+		expected: [][]string{
+			{"rsync", "-aR", dir, "builder@vm:/tmp/mpdev/"},
+			{"ssh", "-o", "BatchMode=yes", "builder@vm", "mkdir -p /tmp/mpdev" + wd(t) + " && cd /tmp/mpdev" + wd(t) +
+				" && podman run --volume /tmp/mpdev" + dir + ":/data:ro --read-only busybox"},
+			{"rsync", "-aR", "--ignore-missing-args", "builder@vm:/tmp/mpdev/." + dir, "/"},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fexec, argv := newRecordingExec(len(tc.expected))
+			executor := NewBuildHostExecutor(fexec, "builder@vm", DefaultBuildHostDir)
+			cmd := executor.Command(tc.cmd, tc.args...)
+			if tc.dir != "" {
+				cmd.SetDir(tc.dir)
+			}
+			assert.NoError(t, cmd.Run())
+			assert.Equal(t, tc.expected, *argv)
+		})
+	}
+}
+
+func TestBuildHostEnv(t *testing.T) {
+	fexec, argv := newRecordingExec(3)
+	executor := NewBuildHostExecutor(fexec, "builder@vm", DefaultBuildHostDir)
+	cmd := executor.Command("podman", "push", "gcr.io/project/app:1.0")
+	cmd.SetEnv(append(os.Environ(), "DOCKER_TOKEN=s3cr3t value"))
+	assert.NoError(t, cmd.Run())
+
+	assert.Len(t, *argv, 2)
+	push, ssh := (*argv)[0], (*argv)[1]
+	envFile := push[2]
+	assert.Equal(t, []string{"rsync", "-aR", envFile, "builder@vm:/tmp/mpdev/"}, push)
+	assert.Equal(t, []string{"ssh", "-o", "BatchMode=yes", "builder@vm", "mkdir -p /tmp/mpdev" + wd(t) + " && cd /tmp/mpdev" + wd(t) +
+		" && . /tmp/mpdev" + envFile + " && rm /tmp/mpdev" + envFile + " && podman push gcr.io/project/app:1.0"}, ssh)
+	assert.False(t, strings.Contains(strings.Join(ssh, " "), "s3cr3t"), "secrets are not passed in arguments")
+	_, err := os.Stat(filepath.Dir(envFile))
+	assert.True(t, os.IsNotExist(err), "the directory of the environment file is removed")
+}
+
+func TestBuildHostLookPath(t *testing.T) {
+	fcmd := testingexec.FakeCmd{OutputScript: []testingexec.FakeAction{
+		func() ([]byte, []byte, error) { return []byte("/usr/bin/podman\n"), nil, nil },
+		func() ([]byte, []byte, error) { return nil, nil, testingexec.FakeExitError{Status: 1} },
+	}}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	fexec := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction},
+		LookPathFunc:  func(file string) (string, error) { return "/local/bin/" + file, nil },
+	}
+	executor := NewBuildHostExecutor(fexec, "builder@vm", DefaultBuildHostDir)
+
+	p, err := executor.LookPath("podman")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin/podman", p)
+	_, err = executor.LookPath("zip")
+	assert.Equal(t, exec.ErrExecutableNotFound, err)
+	assert.Equal(t, [][]string{
+		{"ssh", "-o", "BatchMode=yes", "builder@vm", "command -v podman"},
+		{"ssh", "-o", "BatchMode=yes", "builder@vm", "command -v zip"},
+	}, fcmd.OutputLog)
+
+	for _, local := range []string{"gcloud", "docker"} {
+		p, err = executor.LookPath(local)
+		assert.NoError(t, err)
+		assert.Equal(t, "/local/bin/"+local, p)
+	}
+}
+
+func TestBuildHostWindowsPaths(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Windows paths only have volumes on Windows")
+	}
+	testCases := []struct {
+		arg            string
+		expectedPath   string
+		expectedSuffix string
+		expectedRemote string
+	}{{
+		arg:            `C:\src\app`,
+		expectedPath:   `C:\src\app`,
+		expectedRemote: "/tmp/mpdev/C/src/app",
+	}, {
+		arg:            `C:\src\app:/data:ro`,
+		expectedPath:   `C:\src\app`,
+		expectedSuffix: ":/data:ro",
+		expectedRemote: "/tmp/mpdev/C/src/app",
+	}, {
+		arg:            `\\server\share\app:/data`,
+		expectedPath:   `\\server\share\app`,
+		expectedSuffix: ":/data",
+		expectedRemote: "/tmp/mpdev/server/share/app",
+	}}
+
+	e := &buildHostExecutor{host: "builder@vm", dir: DefaultBuildHostDir}
+	for _, tc := range testCases {
+		t.Run(tc.arg, func(t *testing.T) {
+			prefix, p, suffix := splitPathArg(tc.arg)
+			assert.Equal(t, "", prefix)
+			assert.Equal(t, tc.expectedPath, p)
+			assert.Equal(t, tc.expectedSuffix, suffix)
+			assert.Equal(t, tc.expectedRemote, e.remotePath(p))
+		})
+	}
+}
+
+func wd(t *testing.T) string {
+	dir, err := os.Getwd()
+	assert.NoError(t, err)
+	return dir
+}
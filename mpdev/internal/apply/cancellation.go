@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// NewCancelableExecutor returns an executor whose commands are killed when
+// ctx is done, such as when mpdev is interrupted or times out.
+func NewCancelableExecutor(ctx context.Context, executor exec.Interface) exec.Interface {
+	return &cancelableExecutor{Interface: executor, ctx: ctx}
+}
+
+type cancelableExecutor struct {
+	exec.Interface
+	ctx context.Context
+}
+
+func (e *cancelableExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return e.Interface.CommandContext(e.ctx, cmd, args...)
+}
+
+// Context returns the context that commands of the executor are bound to.
+func (e *cancelableExecutor) Context() context.Context {
+	return e.ctx
+}
+
+// executorContext returns the context that the commands of executor are
+// bound to, or a context that is never done if they are not bound to one.
+func executorContext(executor exec.Interface) context.Context {
+	if e, ok := executor.(interface{ Context() context.Context }); ok {
+		return e.Context()
+	}
+	return context.Background()
+}
+
+// canceled marks err as caused by the cancellation of ctx, if ctx is done.
+// Commands killed by the cancellation otherwise fail as if they had failed
+// on their own.
+func canceled(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	reason := "interrupted"
+	if ctx.Err() == context.DeadlineExceeded {
+		reason = "timed out"
+	}
+	return withExitCode(ExitCanceled, errors.Wrap(err, reason))
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+)
+
+func TestApplyCanceled(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		dryRun    bool
+		expectErr string
+	}{{
+		name:      "Killed command",
+		err:       errors.New("signal: killed"),
+		expectErr: "interrupted",
+	}, {
+		name:      "Resource that succeeds",
+		expectErr: "interrupted: 1 resources were not applied",
+	}, {
+		name:      "Dry run",
+		dryRun:    true,
+		expectErr: "interrupted: 1 resources were not applied",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var applied []string
+			r1 := newTestResourceFunc("r1", func(Registry, bool) error {
+				applied = append(applied, "r1")
+				cancel()
+				return tc.err
+			}, nil)
+			r2 := newTestResourceFunc("r2", func(Registry, bool) error {
+				applied = append(applied, "r2")
+				return nil
+			}, func() []Reference { return []Reference{r1.GetReference()} })
+
+			registry := NewRegistry(NewCancelableExecutor(ctx, exec.New()))
+			registry.RegisterResource(r1, "dirpath")
+			registry.RegisterResource(r2, "dirpath")
+			err := registry.Apply(tc.dryRun)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expectErr)
+			assert.Equal(t, ExitCanceled, ExitCode(err))
+			assert.Equal(t, []string{"r1"}, applied)
+		})
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	err := errors.New("signal: killed")
+	assert.Equal(t, err, canceled(context.Background(), err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	timedOut := canceled(ctx, err)
+	assert.EqualError(t, timedOut, "timed out: signal: killed")
+	assert.Equal(t, ExitCanceled, ExitCode(timedOut))
+	assert.NoError(t, canceled(ctx, nil))
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+)
+
+// TempDirs returns the temporary directories created by mpdev in
+// util.TempRoot that were last modified before cutoff, such as the output
+// directories of autogen templates.
+func TempDirs(cutoff time.Time) ([]string, error) {
+	root, err := util.TempRoot()
+	if err != nil {
+		return nil, err
+	}
+	return entriesBefore(root, cutoff, nil)
+}
+
+// CacheFiles returns the files and directories that mpdev keeps in the user
+// cache directory that were last modified before cutoff. State files are
+// not returned, since they are pruned with PruneState.
+func CacheFiles(cutoff time.Time) ([]string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		// Without a user cache directory, nothing was cached.
+		return nil, nil
+	}
+	return entriesBefore(filepath.Join(cacheDir, "mpdev"), cutoff, map[string]bool{"state": true})
+}
+
+// entriesBefore returns the entries of dir that were last modified before
+// cutoff, other than those in skipped. A missing dir has no entries.
+func entriesBefore(dir string, cutoff time.Time, skipped map[string]bool) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, info := range infos {
+		if !skipped[info.Name()] && info.ModTime().Before(cutoff) {
+			entries = append(entries, filepath.Join(dir, info.Name()))
+		}
+	}
+	sort.Strings(entries)
+	return entries, nil
+}
+
+// PruneState removes the entries of the state file of resources that are
+// not in the registry, such as resources that were renamed or deleted from
+// the configuration, and returns their keys. The state file is written
+// unless dryRun is set.
+func (r *registry) PruneState(dryRun bool) ([]string, error) {
+	registered := map[string]bool{}
+	for ref := range r.refMap {
+		registered[stateKey(ref)] = true
+	}
+	var stale []string
+	for key := range r.state.Resources {
+		if !registered[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	if dryRun || len(stale) == 0 || r.statePath == "" {
+		return stale, nil
+	}
+	for _, key := range stale {
+		delete(r.state.Resources, key)
+	}
+	return stale, r.saveState()
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestTempDirs(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "clean")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	assert.NoError(t, os.Setenv("TMPDIR", tmpDir))
+
+	dirs, err := TempDirs(time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	var created []string
+	for _, prefix := range []string{"autogen", "terraform", "autogen"} {
+		dir, err := util.CreateTmpDir(prefix)
+		assert.NoError(t, err)
+		created = append(created, dir)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(created[0], old, old))
+	assert.NoError(t, os.Chtimes(created[1], old, old))
+	// Directories of other tools are not in the root of mpdev.
+	assert.NoError(t, os.Mkdir(filepath.Join(tmpDir, "autogen123"), 0755))
+	assert.NoError(t, os.Chtimes(filepath.Join(tmpDir, "autogen123"), old, old))
+
+	dirs, err = TempDirs(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	expected := []string{created[0], created[1]}
+	sort.Strings(expected)
+	assert.Equal(t, expected, dirs)
+	root, err := util.TempRoot()
+	assert.NoError(t, err)
+	for _, dir := range dirs {
+		assert.Equal(t, root, filepath.Dir(dir))
+	}
+}
+
+func TestCacheFiles(t *testing.T) {
+	home, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	assert.NoError(t, os.Setenv("HOME", home))
+	assert.NoError(t, os.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache")))
+
+	files, err := CacheFiles(time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+
+	cacheDir, err := os.UserCacheDir()
+	assert.NoError(t, err)
+	cacheDir = filepath.Join(cacheDir, "mpdev")
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{"state", "skus", "recent"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(cacheDir, name), 0755))
+		if name != "recent" {
+			assert.NoError(t, os.Chtimes(filepath.Join(cacheDir, name), old, old))
+		}
+	}
+
+	files, err = CacheFiles(time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(cacheDir, "skus")}, files)
+}
+
+func TestPruneState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	rs := newTestResource("kept")
+	s := newState()
+	s.set(rs.GetReference(), "contentHash", "abc")
+	s.set(Reference{Group: "testv1", Kind: "testKind", Name: "renamed"}, "contentHash", "def")
+	assert.NoError(t, s.save(path))
+
+	r := NewRegistry(&testingexec.FakeExec{})
+	r.RegisterResource(rs, dir)
+	assert.NoError(t, r.LoadState(path))
+
+	stale, err := r.PruneState(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testv1/testKind/renamed"}, stale)
+	saved, err := loadState(path)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Resources, 2)
+
+	stale, err = r.PruneState(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testv1/testKind/renamed"}, stale)
+	saved, err = loadState(path)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Resources, 1)
+	assert.Equal(t, "abc", saved.get(rs.GetReference(), "contentHash"))
+}
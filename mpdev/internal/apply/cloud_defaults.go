@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+// CloudDefaults are the project, zone and billing project used when calling
+// Google Cloud, such that the same configuration files can be applied to
+// several projects.
+type CloudDefaults struct {
+	// Project is the projectId of resources that do not set it, and the
+	// project of commands that do not pass one
+	Project string `yaml:"project"`
+	// Zone is the zone of resources that do not set it, and the zone of
+	// commands that do not pass one
+	Zone string `yaml:"zone"`
+	// BillingProject is the project that API calls are billed to and whose
+	// quota they use
+	BillingProject string `yaml:"billingProject"`
+}
+
+// Override returns the defaults with the values set in o replacing those
+// of d.
+func (d CloudDefaults) Override(o CloudDefaults) CloudDefaults {
+	if o.Project != "" {
+		d.Project = o.Project
+	}
+	if o.Zone != "" {
+		d.Zone = o.Zone
+	}
+	if o.BillingProject != "" {
+		d.BillingProject = o.BillingProject
+	}
+	return d
+}
+
+// UseCloudDefaults sets the project, zone and billing project of the
+// commands executed by mpdev. gcloud and gsutil, as well as Terraform's
+// Google provider, use them unless a command passes its own project or
+// zone.
+func UseCloudDefaults(d CloudDefaults) error {
+	env := map[string]string{}
+	if d.Project != "" {
+		env["CLOUDSDK_CORE_PROJECT"] = d.Project
+		env["GOOGLE_PROJECT"] = d.Project
+	}
+	if d.Zone != "" {
+		env["CLOUDSDK_COMPUTE_ZONE"] = d.Zone
+		env["GOOGLE_ZONE"] = d.Zone
+	}
+	if d.BillingProject != "" {
+		env["CLOUDSDK_BILLING_QUOTA_PROJECT"] = d.BillingProject
+		env["GOOGLE_BILLING_PROJECT"] = d.BillingProject
+		env["USER_PROJECT_OVERRIDE"] = "true"
+	}
+	for _, key := range sortedKeys(env) {
+		if err := setCommandEnv(key, env[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDefaults sets the projectId and zone of a resource to the defaults,
+// if the kind of the resource has the field and the resource does not set
+// it. Objects that are not mpdev resources are left unchanged.
+func (d CloudDefaults) SetDefaults(obj Unstructured) {
+	fn := typeMapper[obj.getTypeMeta()]
+	if fn == nil {
+		return
+	}
+	fields, err := ResourceToUnstructured(fn())
+	if err != nil {
+		return
+	}
+	for key, value := range map[string]string{"projectId": d.Project, "zone": d.Zone} {
+		if _, ok := fields[key]; !ok || value == "" {
+			continue
+		}
+		if v, ok := obj[key].(string); !ok || v == "" {
+			obj[key] = value
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudDefaultsOverride(t *testing.T) {
+	d := CloudDefaults{Project: "staging", Zone: "us-central1-a"}
+	d = d.Override(CloudDefaults{Project: "prod", BillingProject: "billing"})
+	assert.Equal(t, CloudDefaults{Project: "prod", Zone: "us-central1-a", BillingProject: "billing"}, d)
+}
+
+func TestSetDefaults(t *testing.T) {
+	defaults := CloudDefaults{Project: "prod", Zone: "us-east1-b"}
+
+	testCases := []struct {
+		name     string
+		obj      Unstructured
+		expected Unstructured
+	}{{
+		name: "Project and zone are not set",
+		obj:  Unstructured{"apiVersion": apiVersion, "kind": "QuotaCheck"},
+		expected: Unstructured{"apiVersion": apiVersion, "kind": "QuotaCheck",
+			"projectId": "prod", "zone": "us-east1-b"},
+	}, {
+		name: "Project is set",
+		obj:  Unstructured{"apiVersion": apiVersion, "kind": "DeploymentManagerDeployment", "projectId": "staging"},
+		expected: Unstructured{"apiVersion": apiVersion, "kind": "DeploymentManagerDeployment",
+			"projectId": "staging"},
+	}, {
+		name:     "Kind without project",
+		obj:      Unstructured{"apiVersion": apiVersion, "kind": "HelmChart"},
+		expected: Unstructured{"apiVersion": apiVersion, "kind": "HelmChart"},
+	}, {
+		name:     "Not an mpdev resource",
+		obj:      Unstructured{"apiVersion": "v1", "kind": "ConfigMap"},
+		expected: Unstructured{"apiVersion": "v1", "kind": "ConfigMap"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defaults.SetDefaults(tc.obj)
+			assert.Equal(t, tc.expected, tc.obj)
+		})
+	}
+}
+
+func TestUseCloudDefaults(t *testing.T) {
+	for _, key := range []string{"CLOUDSDK_CORE_PROJECT", "GOOGLE_PROJECT", "CLOUDSDK_BILLING_QUOTA_PROJECT", "CLOUDSDK_COMPUTE_ZONE"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+
+	assert.NoError(t, UseCloudDefaults(CloudDefaults{Project: "prod", BillingProject: "billing"}))
+	assert.Equal(t, "prod", os.Getenv("CLOUDSDK_CORE_PROJECT"))
+	assert.Equal(t, "prod", os.Getenv("GOOGLE_PROJECT"))
+	assert.Equal(t, "billing", os.Getenv("CLOUDSDK_BILLING_QUOTA_PROJECT"))
+	assert.Equal(t, "", os.Getenv("CLOUDSDK_COMPUTE_ZONE"))
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"os"
+
+	"k8s.io/utils/exec"
+)
+
+// runCommand executes a command, streaming its output to stdout and stderr.
+func runCommand(executor exec.Interface, name string, args ...string) error {
+	cmd := executor.Command(name, args...)
+	cmd.SetStdout(os.Stdout)
+	cmd.SetStderr(os.Stderr)
+	return cmd.Run()
+}
+
+// runCommandOutput executes a command and returns its stdout. The stderr of
+// the command is streamed to stderr.
+func runCommandOutput(executor exec.Interface, name string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd := executor.Command(name, args...)
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(os.Stderr)
+	err := cmd.Run()
+	return stdout.Bytes(), err
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// commandSlots bounds the number of commands executed by resources, and of
+// containers they run, that run at once. Running commands hold a value of
+// the channel. It is nil if the number is not bounded.
+var commandSlots chan struct{}
+
+// LimitCommands bounds the number of commands and containers that run at
+// once to n, such that resources applied in parallel do not overload the
+// docker daemon or the uplink with simultaneous builds and uploads. The
+// number is not bounded if n is 0.
+func LimitCommands(n int) error {
+	if n < 0 {
+		return errors.New("the maximum number of commands cannot be negative")
+	}
+	commandSlots = nil
+	if n > 0 {
+		commandSlots = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// acquireCommandSlot waits until a command can start, or ctx is done, and
+// returns the function releasing its slot.
+func acquireCommandSlot(ctx context.Context) (func(), error) {
+	slots := commandSlots
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "failed to wait for other commands to finish")
+	}
+}
+
+// NewLimitingExecutor returns an executor whose commands wait for one of
+// the slots of LimitCommands before starting.
+func NewLimitingExecutor(executor exec.Interface) exec.Interface {
+	return &limitingExecutor{Interface: executor}
+}
+
+type limitingExecutor struct {
+	exec.Interface
+}
+
+func (e *limitingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &limitingCmd{Cmd: e.Interface.Command(cmd, args...), ctx: context.Background()}
+}
+
+func (e *limitingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &limitingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), ctx: ctx}
+}
+
+type limitingCmd struct {
+	exec.Cmd
+	ctx     context.Context
+	release func()
+}
+
+func (c *limitingCmd) Run() error {
+	release, err := acquireCommandSlot(c.ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return c.Cmd.Run()
+}
+
+func (c *limitingCmd) Output() ([]byte, error) {
+	release, err := acquireCommandSlot(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.Cmd.Output()
+}
+
+func (c *limitingCmd) CombinedOutput() ([]byte, error) {
+	release, err := acquireCommandSlot(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return c.Cmd.CombinedOutput()
+}
+
+func (c *limitingCmd) Start() error {
+	release, err := acquireCommandSlot(c.ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Cmd.Start(); err != nil {
+		release()
+		return err
+	}
+	c.release = release
+	return nil
+}
+
+func (c *limitingCmd) Wait() error {
+	err := c.Cmd.Wait()
+	if c.release != nil {
+		c.release()
+		c.release = nil
+	}
+	return err
+}
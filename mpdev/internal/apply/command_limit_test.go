@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestLimitingExecutor(t *testing.T) {
+	defer func() { assert.NoError(t, LimitCommands(0)) }()
+	assert.NoError(t, LimitCommands(2))
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	run := func() ([]byte, []byte, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil, nil, nil
+	}
+	const commands = 8
+	fcmds := make([]testingexec.FakeCmd, commands)
+	fexec := &testingexec.FakeExec{}
+	for i := range fcmds {
+		fcmd := &fcmds[i]
+		fcmd.RunScript = []testingexec.FakeRunAction{run}
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+	executor := NewLimitingExecutor(fexec)
+	cmds := make([]exec.Cmd, commands)
+	for i := range cmds {
+		cmds[i] = executor.Command("gsutil", "cp", "file", "gs://bucket/")
+	}
+
+	var wg sync.WaitGroup
+	for _, cmd := range cmds {
+		wg.Add(1)
+		go func(cmd exec.Cmd) {
+			defer wg.Done()
+			assert.NoError(t, cmd.Run())
+		}(cmd)
+	}
+	wg.Wait()
+	assert.Equal(t, 2, maxRunning)
+	assert.Equal(t, 0, len(commandSlots))
+}
+
+func TestLimitingExecutorCanceled(t *testing.T) {
+	defer func() { assert.NoError(t, LimitCommands(0)) }()
+	assert.NoError(t, LimitCommands(1))
+	release, err := acquireCommandSlot(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(&testingexec.FakeCmd{}, cmd, args...)
+		},
+	}}
+	err = NewLimitingExecutor(fexec).CommandContext(ctx, "docker", "build", ".").Run()
+	assert.EqualError(t, err, "failed to wait for other commands to finish: context canceled")
+	assert.EqualError(t, LimitCommands(-1), "the maximum number of commands cannot be negative")
+}
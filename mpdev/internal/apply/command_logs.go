@@ -0,0 +1,247 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/utils/exec"
+)
+
+// commandLogTimeFormat names the directories of the command logs of each
+// run, such that they sort by time.
+const commandLogTimeFormat = "20060102-150405.000000"
+
+// NewCommandLogDir creates a directory for the command logs of a run in
+// dir, and removes the oldest directories in dir such that at most keep
+// remain.
+func NewCommandLogDir(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	logDir := filepath.Join(dir, time.Now().UTC().Format(commandLogTimeFormat))
+	if err := os.Mkdir(logDir, 0755); err != nil {
+		return "", err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var runs []string
+	for _, info := range infos {
+		if _, err := time.Parse(commandLogTimeFormat, info.Name()); err == nil && info.IsDir() {
+			runs = append(runs, info.Name())
+		}
+	}
+	sort.Strings(runs)
+	for len(runs) > keep {
+		if err := os.RemoveAll(filepath.Join(dir, runs[0])); err != nil {
+			return "", err
+		}
+		runs = runs[1:]
+	}
+	return logDir, nil
+}
+
+// commandRecord is the record of a command in its command log.
+type commandRecord struct {
+	Command    []string `json:"command"`
+	Dir        string   `json:"dir,omitempty"`
+	Start      string   `json:"start"`
+	Duration   string   `json:"duration"`
+	ExitStatus int      `json:"exitStatus"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// NewCommandLogExecutor returns an executor that records every command
+// executed by resources in dir. The arguments, directory, timing and exit
+// status of the nth command are written to NNN-NAME.json, and its output to
+// NNN-NAME.stdout and NNN-NAME.stderr, except for credentials. Failures to write the logs are
+// ignored, such that they do not fail commands.
+func NewCommandLogExecutor(executor exec.Interface, dir string) exec.Interface {
+	return &commandLogExecutor{Interface: executor, dir: dir}
+}
+
+type commandLogExecutor struct {
+	exec.Interface
+	dir string
+
+	mu    sync.Mutex
+	count int
+}
+
+func (e *commandLogExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &commandLogCmd{Cmd: e.Interface.Command(cmd, args...), prefix: e.prefix(cmd), argv: append([]string{cmd}, args...)}
+}
+
+func (e *commandLogExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &commandLogCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), prefix: e.prefix(cmd), argv: append([]string{cmd}, args...)}
+}
+
+// prefix returns the path, without extension, of the logs of the next
+// command.
+func (e *commandLogExecutor) prefix(cmd string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.count++
+	return filepath.Join(e.dir, fmt.Sprintf("%03d-%s", e.count, filepath.Base(cmd)))
+}
+
+type commandLogCmd struct {
+	exec.Cmd
+	prefix string
+	argv   []string
+	dir    string
+	// stdout and stderr are the writers set by the caller
+	stdout io.Writer
+	stderr io.Writer
+
+	start      time.Time
+	redacted   bool
+	stdoutFile *os.File
+	stderrFile *os.File
+}
+
+func (c *commandLogCmd) SetDir(dir string) {
+	c.dir = dir
+	c.Cmd.SetDir(dir)
+}
+
+func (c *commandLogCmd) SetStdout(w io.Writer) {
+	c.stdout = w
+	c.Cmd.SetStdout(w)
+}
+
+func (c *commandLogCmd) SetStderr(w io.Writer) {
+	c.stderr = w
+	c.Cmd.SetStderr(w)
+}
+
+func (c *commandLogCmd) Run() error {
+	c.started(true, true)
+	err := c.Cmd.Run()
+	c.exited(nil, err)
+	return err
+}
+
+func (c *commandLogCmd) Output() ([]byte, error) {
+	c.started(false, true)
+	out, err := c.Cmd.Output()
+	c.exited(out, err)
+	return out, err
+}
+
+func (c *commandLogCmd) CombinedOutput() ([]byte, error) {
+	c.started(false, false)
+	out, err := c.Cmd.CombinedOutput()
+	c.exited(out, err)
+	return out, err
+}
+
+func (c *commandLogCmd) Start() error {
+	c.started(true, true)
+	err := c.Cmd.Start()
+	if err != nil {
+		c.exited(nil, err)
+	}
+	return err
+}
+
+func (c *commandLogCmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.exited(nil, err)
+	return err
+}
+
+// redactedOutput replaces the stdout of commands that print credentials.
+const redactedOutput = "[REDACTED]\n"
+
+// printsCredentials returns whether the stdout of a command is a
+// credential, such as an access token or the credentials printed by a
+// docker credential helper, which is not logged.
+func printsCredentials(argv []string) bool {
+	if strings.HasPrefix(filepath.Base(argv[0]), "docker-credential-") {
+		return true
+	}
+	for _, arg := range argv {
+		if arg == "print-access-token" || arg == "print-identity-token" {
+			return true
+		}
+	}
+	return false
+}
+
+// started creates the output files of the command, to which its stdout and
+// stderr are also written if they are not returned by the command.
+func (c *commandLogCmd) started(stdout bool, stderr bool) {
+	c.start = time.Now()
+	c.redacted = printsCredentials(c.argv)
+	stdout = stdout && !c.redacted
+	c.stdoutFile, _ = os.Create(c.prefix + ".stdout")
+	c.stderrFile, _ = os.Create(c.prefix + ".stderr")
+	if stdout && c.stdoutFile != nil {
+		c.Cmd.SetStdout(teeWriter(c.stdout, c.stdoutFile))
+	}
+	if stderr && c.stderrFile != nil {
+		c.Cmd.SetStderr(teeWriter(c.stderr, c.stderrFile))
+	}
+}
+
+// exited writes the record of the command, along with out if it is the
+// output returned by the command.
+func (c *commandLogCmd) exited(out []byte, err error) {
+	if c.stdoutFile != nil {
+		if c.redacted {
+			out = []byte(redactedOutput)
+		}
+		_, _ = c.stdoutFile.Write(out)
+		c.stdoutFile.Close()
+	}
+	if c.stderrFile != nil {
+		c.stderrFile.Close()
+	}
+	record := commandRecord{
+		Command:    redactArgs(c.argv),
+		Dir:        c.dir,
+		Start:      c.start.UTC().Format(time.RFC3339Nano),
+		Duration:   time.Since(c.start).Round(time.Millisecond).String(),
+		ExitStatus: exitStatus(err),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	b, jsonErr := json.MarshalIndent(record, "", "  ")
+	if jsonErr == nil {
+		_ = ioutil.WriteFile(c.prefix+".json", append(b, '\n'), 0644)
+	}
+}
+
+// teeWriter returns a writer writing to w, if it is not nil, and to f.
+func teeWriter(w io.Writer, f io.Writer) io.Writer {
+	if w == nil {
+		return f
+	}
+	return io.MultiWriter(w, f)
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestCommandLogExecutor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	exitErr := testingexec.FakeExitError{Status: 2}
+	fcmds := []testingexec.FakeCmd{{
+		RunScript: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte("Copying file\n"), []byte("Warning\n"), nil },
+		},
+	}, {
+		OutputScript: []testingexec.FakeAction{
+			func() ([]byte, []byte, error) { return []byte(`{"name": "image"}`), nil, exitErr },
+		},
+	}}
+	fexec := &testingexec.FakeExec{}
+	for i := range fcmds {
+		fcmd := &fcmds[i]
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+	executor := NewCommandLogExecutor(fexec, dir)
+
+	var stdout bytes.Buffer
+	cmd := executor.Command("gsutil", "cp", "file.zip", "gs://bucket/")
+	cmd.SetDir("/tmp")
+	cmd.SetStdout(&stdout)
+	assert.NoError(t, cmd.Run())
+	assert.Equal(t, "Copying file\n", stdout.String())
+	_, err = executor.Command("/usr/bin/gcloud", "compute", "images", "describe", "image").Output()
+	assert.Equal(t, exitErr, err)
+
+	expectedFiles := map[string]string{
+		"001-gsutil.stdout": "Copying file\n",
+		"001-gsutil.stderr": "Warning\n",
+		"002-gcloud.stdout": `{"name": "image"}`,
+		"002-gcloud.stderr": "",
+	}
+	for name, expected := range expectedFiles {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(b), name)
+	}
+
+	expectedRecords := map[string]commandRecord{
+		"001-gsutil.json": {Command: []string{"gsutil", "cp", "file.zip", "gs://bucket/"}, Dir: "/tmp"},
+		"002-gcloud.json": {Command: []string{"/usr/bin/gcloud", "compute", "images", "describe", "image"}, ExitStatus: 2, Error: "exit 2"},
+	}
+	for name, expected := range expectedRecords {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		var record commandRecord
+		assert.NoError(t, json.Unmarshal(b, &record))
+		assert.NotEmpty(t, record.Start)
+		assert.NotEmpty(t, record.Duration)
+		record.Start, record.Duration = "", ""
+		assert.Equal(t, expected, record, name)
+	}
+}
+
+func TestNewCommandLogDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"20200601-120000.000000", "20200602-120000.000000", "notes"} {
+		assert.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+	}
+
+	logDir, err := NewCommandLogDir(dir, 2)
+	assert.NoError(t, err)
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	assert.Equal(t, []string{"20200602-120000.000000", filepath.Base(logDir), "notes"}, names)
+}
+
+func TestCommandLogExecutorCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return []byte("ya29.token\n"), nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+	token, err := runCommandOutput(NewCommandLogExecutor(fexec, dir), "gcloud", "auth", "print-access-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "ya29.token\n", string(token))
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "001-gcloud.stdout"))
+	assert.NoError(t, err)
+	assert.Equal(t, redactedOutput, string(b))
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	osexec "os/exec"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// commandTimeout is the duration after which commands executed by resources,
+// and containers they run, are stopped. They are not stopped if it is 0.
+var commandTimeout time.Duration
+
+// stopGracePeriod is how long a stopped command, or container, has to exit
+// after it receives SIGTERM, before it is killed with SIGKILL.
+var stopGracePeriod = 10 * time.Second
+
+// SetCommandTimeout sets the duration after which each command executed by
+// resources, and each container they run, is stopped. Commands are not
+// stopped if timeout is 0.
+func SetCommandTimeout(timeout time.Duration) error {
+	if timeout < 0 {
+		return errors.New("the command timeout cannot be negative")
+	}
+	commandTimeout = timeout
+	return nil
+}
+
+// NewExecutor returns an executor running commands with os/exec, like
+// exec.New(). Commands are stopped when their context is done, or when they
+// run for longer than the command timeout: they receive SIGTERM, such that
+// they can clean up, and are killed with SIGKILL if they have not exited
+// after stopGracePeriod. On Windows, they are killed right away.
+func NewExecutor() exec.Interface {
+	return &stoppingExecutor{}
+}
+
+type stoppingExecutor struct{}
+
+func (e *stoppingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return e.CommandContext(context.Background(), cmd, args...)
+}
+
+func (e *stoppingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	// The command is not bound to ctx with osexec.CommandContext, which
+	// would kill it with SIGKILL.
+	return &stoppingCmd{cmd: osexec.Command(cmd, args...), ctx: ctx}
+}
+
+func (e *stoppingExecutor) LookPath(file string) (string, error) {
+	return osexec.LookPath(file)
+}
+
+type stoppingCmd struct {
+	cmd *osexec.Cmd
+	ctx context.Context
+	// done is closed once the command exits
+	done     chan struct{}
+	timedOut int32
+}
+
+func (c *stoppingCmd) SetDir(dir string)       { c.cmd.Dir = dir }
+func (c *stoppingCmd) SetStdin(in io.Reader)   { c.cmd.Stdin = in }
+func (c *stoppingCmd) SetStdout(out io.Writer) { c.cmd.Stdout = out }
+func (c *stoppingCmd) SetStderr(out io.Writer) { c.cmd.Stderr = out }
+func (c *stoppingCmd) SetEnv(env []string)     { c.cmd.Env = env }
+
+func (c *stoppingCmd) StdoutPipe() (io.ReadCloser, error) {
+	return c.cmd.StdoutPipe()
+}
+
+func (c *stoppingCmd) StderrPipe() (io.ReadCloser, error) {
+	return c.cmd.StderrPipe()
+}
+
+func (c *stoppingCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+func (c *stoppingCmd) Output() ([]byte, error) {
+	if c.cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.cmd.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+func (c *stoppingCmd) CombinedOutput() ([]byte, error) {
+	if c.cmd.Stdout != nil || c.cmd.Stderr != nil {
+		return nil, errors.New("exec: Stdout or Stderr already set")
+	}
+	var output bytes.Buffer
+	c.cmd.Stdout = &output
+	c.cmd.Stderr = &output
+	err := c.Run()
+	return output.Bytes(), err
+}
+
+func (c *stoppingCmd) Start() error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	if err := c.cmd.Start(); err != nil {
+		return handleExecError(err)
+	}
+	c.done = make(chan struct{})
+	go c.watch()
+	return nil
+}
+
+func (c *stoppingCmd) Wait() error {
+	err := c.cmd.Wait()
+	if c.done != nil {
+		close(c.done)
+	}
+	err = handleExecError(err)
+	if err != nil && atomic.LoadInt32(&c.timedOut) == 1 {
+		return errors.Wrapf(err, "%s timed out after %s", c.cmd.Args[0], commandTimeout)
+	}
+	return err
+}
+
+// Stop stops the command, as when its context is done.
+func (c *stoppingCmd) Stop() {
+	if c.cmd.Process != nil {
+		go c.stop()
+	}
+}
+
+// watch stops the command if its context is done or it times out before
+// it exits.
+func (c *stoppingCmd) watch() {
+	var timeout <-chan time.Time
+	if commandTimeout > 0 {
+		timer := time.NewTimer(commandTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-c.done:
+		return
+	case <-c.ctx.Done():
+	case <-timeout:
+		atomic.StoreInt32(&c.timedOut, 1)
+	}
+	c.stop()
+}
+
+func (c *stoppingCmd) stop() {
+	if runtime.GOOS != "windows" {
+		if err := c.cmd.Process.Signal(syscall.SIGTERM); err == nil {
+			timer := time.NewTimer(stopGracePeriod)
+			defer timer.Stop()
+			select {
+			case <-c.done:
+				return
+			case <-timer.C:
+			}
+		}
+	}
+	_ = c.cmd.Process.Kill()
+}
+
+// handleExecError converts the errors of os/exec to those of
+// k8s.io/utils/exec, as exec.New() does.
+func handleExecError(err error) error {
+	switch e := err.(type) {
+	case *osexec.ExitError:
+		return &exec.ExitErrorWrapper{ExitError: e}
+	case *os.PathError:
+		return exec.ErrExecutableNotFound
+	case *osexec.Error:
+		if e.Err == osexec.ErrNotFound {
+			return exec.ErrExecutableNotFound
+		}
+	}
+	return err
+}
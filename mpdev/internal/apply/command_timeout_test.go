@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+)
+
+func TestExecutorStopsCommands(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands are killed right away on Windows")
+	}
+	defer func(d time.Duration) { stopGracePeriod = d }(stopGracePeriod)
+	stopGracePeriod = 200 * time.Millisecond
+	testCases := []struct {
+		name           string
+		script         string
+		timeout        time.Duration
+		cancel         bool
+		expectedStatus int
+		expectedError  string
+	}{{
+		name:   "exits",
+		script: "exit 0",
+	}, {
+		name:           "fails",
+		script:         "exit 2",
+		expectedStatus: 2,
+	}, {
+		name:           "timeout cleans up on SIGTERM",
+		script:         "trap 'exit 3' TERM; while true; do sleep 0.01; done",
+		timeout:        100 * time.Millisecond,
+		expectedStatus: 3,
+		expectedError:  "sh timed out after 100ms",
+	}, {
+		name:           "timeout kills commands ignoring SIGTERM",
+		script:         "trap '' TERM; while true; do sleep 0.01; done",
+		timeout:        100 * time.Millisecond,
+		expectedStatus: -1,
+		expectedError:  "sh timed out after 100ms",
+	}, {
+		name:           "canceled",
+		script:         "trap 'exit 3' TERM; while true; do sleep 0.01; done",
+		cancel:         true,
+		expectedStatus: 3,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer SetCommandTimeout(0)
+			assert.NoError(t, SetCommandTimeout(tc.timeout))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancel {
+				time.AfterFunc(100*time.Millisecond, cancel)
+			}
+
+			err := NewExecutor().CommandContext(ctx, "sh", "-c", tc.script).Run()
+			if tc.expectedStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			if tc.expectedError != "" {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+			exitErr, ok := errors.Cause(err).(exec.ExitError)
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.expectedStatus, exitErr.ExitStatus())
+			}
+		})
+	}
+}
+
+func TestExecutorNotFound(t *testing.T) {
+	err := NewExecutor().Command("mpdev-missing-command").Run()
+	assert.Equal(t, exec.ErrExecutableNotFound, err)
+}
+
+func TestExecutorCanceledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := NewExecutor().CommandContext(ctx, "sh", "-c", "exit 0").Run()
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a set of defaults for the options of mpdev, such that partners
+// working on several listings do not pass the same options to every
+// command.
+type Profile struct {
+	CloudDefaults `yaml:",inline"`
+	// ImpersonateServiceAccount is the default of the
+	// --impersonate-service-account option
+	ImpersonateServiceAccount string `yaml:"impersonateServiceAccount"`
+	// AutogenImage is the container image that generates Deployment Manager
+	// templates
+	AutogenImage string `yaml:"autogenImage"`
+	// Parallelism is the maximum number of resources applied at once
+	Parallelism int `yaml:"parallelism"`
+	// ImageDigests are the digests, such as sha256:0123, that the images
+	// of containers run by resources must have, by image
+	ImageDigests map[string]string `yaml:"imageDigests"`
+	// RequireImageDigests refuses to run images whose digest is not pinned
+	// in ImageDigests, unless they are referenced by digest
+	RequireImageDigests bool `yaml:"requireImageDigests"`
+	// AuditLog is the default of the --audit-log option
+	AuditLog string `yaml:"auditLog"`
+	// MaxCommands is the maximum number of commands and containers run at
+	// once by resources applied in parallel
+	MaxCommands int `yaml:"maxCommands"`
+	// PassEnv are variables of the environment, by name or by prefix such
+	// as TF_VAR_*, that the commands executed by mpdev inherit in addition
+	// to the default ones
+	PassEnv []string `yaml:"passEnv"`
+	// BuildHost is the default of the --build-host option
+	BuildHost string `yaml:"buildHost"`
+	// BuildHostDir is the default of the --build-host-dir option
+	BuildHostDir string `yaml:"buildHostDir"`
+	// RegistryAuth are the credentials with which the images of
+	// containers are pulled, by registry host
+	RegistryAuth map[string]RegistryAuth `yaml:"registryAuth"`
+	// FileMode is the default of the --file-mode option
+	FileMode string `yaml:"fileMode"`
+	// FileOwner is the default of the --file-owner option
+	FileOwner string `yaml:"fileOwner"`
+	// CostThreshold is the default of the --cost-threshold option
+	CostThreshold float64 `yaml:"costThreshold"`
+}
+
+// Config is the mpdev configuration file. The top-level options apply to
+// every profile, and are overridden by the options of the selected
+// profile.
+type Config struct {
+	Profile `yaml:",inline"`
+	// DefaultProfile is the profile used if none is selected with --profile
+	DefaultProfile string `yaml:"defaultProfile"`
+	// Profiles are the named profiles that can be selected with --profile
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// LoadConfig reads the mpdev configuration file. A missing file results in
+// an empty configuration.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return c, nil
+}
+
+// SelectProfile returns the options of the named profile, or of the default
+// profile if name is empty, merged with the top-level options.
+func (c *Config) SelectProfile(name string) (Profile, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return c.Profile, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("profile %s not found. Profiles: %s", name, strings.Join(names, ", "))
+	}
+	return c.Profile.Override(p), nil
+}
+
+// Override returns the profile with the options set in o replacing those
+// of p.
+func (p Profile) Override(o Profile) Profile {
+	p.CloudDefaults = p.CloudDefaults.Override(o.CloudDefaults)
+	if o.ImpersonateServiceAccount != "" {
+		p.ImpersonateServiceAccount = o.ImpersonateServiceAccount
+	}
+	if o.AutogenImage != "" {
+		p.AutogenImage = o.AutogenImage
+	}
+	if o.Parallelism != 0 {
+		p.Parallelism = o.Parallelism
+	}
+	if len(o.ImageDigests) > 0 {
+		digests := map[string]string{}
+		for image, digest := range p.ImageDigests {
+			digests[image] = digest
+		}
+		for image, digest := range o.ImageDigests {
+			digests[image] = digest
+		}
+		p.ImageDigests = digests
+	}
+	p.RequireImageDigests = p.RequireImageDigests || o.RequireImageDigests
+	if o.AuditLog != "" {
+		p.AuditLog = o.AuditLog
+	}
+	if o.MaxCommands != 0 {
+		p.MaxCommands = o.MaxCommands
+	}
+	if len(o.PassEnv) > 0 {
+		p.PassEnv = append(append([]string{}, p.PassEnv...), o.PassEnv...)
+	}
+	if o.BuildHost != "" {
+		p.BuildHost = o.BuildHost
+	}
+	if o.BuildHostDir != "" {
+		p.BuildHostDir = o.BuildHostDir
+	}
+	if len(o.RegistryAuth) > 0 {
+		auths := map[string]RegistryAuth{}
+		for registry, auth := range p.RegistryAuth {
+			auths[registry] = auth
+		}
+		for registry, auth := range o.RegistryAuth {
+			auths[registry] = auth
+		}
+		p.RegistryAuth = auths
+	}
+	if o.FileMode != "" {
+		p.FileMode = o.FileMode
+	}
+	if o.FileOwner != "" {
+		p.FileOwner = o.FileOwner
+	}
+	if o.CostThreshold != 0 {
+		p.CostThreshold = o.CostThreshold
+	}
+	return p
+}
+
+// UseProfile applies the options of a profile that affect resources: the
+// cloud defaults, the pinned image digests, the credentials of registries,
+// the variables passed to commands and the permissions of generated files.
+// The autogen image is set on the registries applying resources.
+func UseProfile(p Profile) error {
+	if err := UseCloudDefaults(p.CloudDefaults); err != nil {
+		return err
+	}
+	PinImageDigests(p.ImageDigests, p.RequireImageDigests)
+	if err := UseRegistryAuth(p.RegistryAuth); err != nil {
+		return err
+	}
+	PassEnv(p.PassEnv...)
+	return UseOutputPermissions(p.FileMode, p.FileOwner)
+}
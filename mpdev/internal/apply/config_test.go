@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	c, err := LoadConfig(path)
+	assert.NoError(t, err)
+	p, err := c.SelectProfile("")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{}, p)
+
+	config := `
+zone: us-central1-a
+parallelism: 2
+passEnv: [HTTPS_PROXY]
+imageDigests:
+  gcr.io/cloud-marketplace-tools/dm/autogen:latest: sha256:1111
+defaultProfile: staging
+profiles:
+  staging:
+    project: partner-staging
+  prod:
+    project: partner-prod
+    impersonateServiceAccount: publisher@partner-prod.iam.gserviceaccount.com
+    parallelism: 4
+    maxCommands: 2
+    imageDigests:
+      gcr.io/cloud-marketplace-tools/dm/autogen:latest: sha256:2222
+    requireImageDigests: true
+    auditLog: /var/log/mpdev/audit.jsonl
+    passEnv: [TF_VAR_*]
+    buildHost: builder@build-vm
+`
+	assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0644))
+	c, err = LoadConfig(path)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		profile     string
+		expected    Profile
+		expectedErr string
+	}{{
+		name:    "Default profile",
+		profile: "",
+		expected: Profile{
+			CloudDefaults: CloudDefaults{Project: "partner-staging", Zone: "us-central1-a"},
+			Parallelism:   2,
+			ImageDigests:  map[string]string{"gcr.io/cloud-marketplace-tools/dm/autogen:latest": "sha256:1111"},
+			PassEnv:       []string{"HTTPS_PROXY"},
+		},
+	}, {
+		name:    "Selected profile",
+		profile: "prod",
+		expected: Profile{
+			CloudDefaults:             CloudDefaults{Project: "partner-prod", Zone: "us-central1-a"},
+			ImpersonateServiceAccount: "publisher@partner-prod.iam.gserviceaccount.com",
+			Parallelism:               4,
+			MaxCommands:               2,
+			ImageDigests:              map[string]string{"gcr.io/cloud-marketplace-tools/dm/autogen:latest": "sha256:2222"},
+			RequireImageDigests:       true,
+			AuditLog:                  "/var/log/mpdev/audit.jsonl",
+			PassEnv:                   []string{"HTTPS_PROXY", "TF_VAR_*"},
+			BuildHost:                 "builder@build-vm",
+		},
+	}, {
+		name:        "Unknown profile",
+		profile:     "dev",
+		expectedErr: "profile dev not found. Profiles: prod, staging",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := c.SelectProfile(tc.profile)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, p)
+		})
+	}
+}
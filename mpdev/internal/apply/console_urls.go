@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Targets of ConsoleURLs.
+const (
+	// ConsoleListing is the Producer Portal of the project
+	ConsoleListing = "listing"
+	// ConsoleDeployment is the Deployment Manager page of each test
+	// deployment
+	ConsoleDeployment = "deployment"
+	// ConsoleBucket is the Cloud Storage browser of each GCS destination
+	ConsoleBucket = "bucket"
+)
+
+// ConsoleTargets are the targets accepted by ConsoleURLs.
+var ConsoleTargets = []string{ConsoleListing, ConsoleDeployment, ConsoleBucket}
+
+const consoleURL = "https://console.cloud.google.com"
+
+// ConsoleURLs returns the Cloud Console or Producer Portal URLs of target
+// for resources, in sorted order. project is the default project of the
+// configuration.
+func ConsoleURLs(target string, resources []Resource, project string) ([]string, error) {
+	urls := map[string]bool{}
+	switch target {
+	case ConsoleListing:
+		if project == "" {
+			return nil, fmt.Errorf("the project of the listing must be set with --project")
+		}
+		urls[consoleURL+"/producer-portal?project="+url.QueryEscape(project)] = true
+	case ConsoleDeployment:
+		for _, rs := range resources {
+			d, ok := rs.(*DeploymentManagerDeployment)
+			if !ok {
+				continue
+			}
+			projectID := d.ProjectID
+			if projectID == "" {
+				projectID = project
+			}
+			name := deploymentName(d.DeploymentName, d.Metadata.Name)
+			urls[fmt.Sprintf("%s/dm/deployments/details/%s?project=%s", consoleURL, url.PathEscape(name), url.QueryEscape(projectID))] = true
+		}
+	case ConsoleBucket:
+		for _, gcsPath := range gcsDestinations(resources) {
+			urls[storageBrowserURL(gcsPath)] = true
+		}
+	default:
+		return nil, fmt.Errorf("unknown target %s. Must be one of %s", target, strings.Join(ConsoleTargets, ", "))
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no resource has a %s", target)
+	}
+
+	sorted := make([]string, 0, len(urls))
+	for u := range urls {
+		sorted = append(sorted, u)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// gcsDestinations returns the GCS paths that resources save artifacts to.
+func gcsDestinations(resources []Resource) []string {
+	var paths []string
+	for _, rs := range resources {
+		switch v := rs.(type) {
+		case *DeploymentManagerTemplate:
+			paths = append(paths, v.ZipFilePath...)
+		case *TerraformModule:
+			paths = append(paths, v.ZipFilePath)
+		case *HelmChart:
+			paths = append(paths, asDirectory(v.Destination))
+		case *ListingAssets:
+			paths = append(paths, asDirectory(v.Destination))
+		}
+	}
+	var gcsPaths []string
+	for _, p := range paths {
+		if isGCSPath(p) {
+			gcsPaths = append(gcsPaths, p)
+		}
+	}
+	return gcsPaths
+}
+
+// asDirectory returns the path of the directory dir, with a trailing slash.
+func asDirectory(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	return strings.TrimSuffix(dir, "/") + "/"
+}
+
+// storageBrowserURL returns the URL of the Cloud Storage browser at the
+// directory of gcsPath, or at gcsPath if it ends with a slash.
+func storageBrowserURL(gcsPath string) string {
+	dir := strings.TrimPrefix(gcsPath, "gs://")
+	if !strings.HasSuffix(dir, "/") && strings.Contains(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	dir = strings.TrimSuffix(dir, "/")
+	return consoleURL + "/storage/browser/" + dir
+}
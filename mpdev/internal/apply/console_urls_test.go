@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleURLs(t *testing.T) {
+	deployment := &DeploymentManagerDeployment{ProjectID: "test-project"}
+	deployment.Metadata.Name = "test-deployment"
+	defaultProject := &DeploymentManagerDeployment{DeploymentName: "solution"}
+	defaultProject.Metadata.Name = "other"
+	dm := &DeploymentManagerTemplate{ZipFilePath: StringList{"gs://bucket/solution/dm.zip", "local/dm.zip"}}
+	assets := &ListingAssets{Destination: "gs://bucket/listing"}
+	module := &TerraformModule{ZipFilePath: "gs://modules/module.zip"}
+	resources := []Resource{deployment, defaultProject, dm, assets, module}
+
+	testCases := []struct {
+		name     string
+		target   string
+		project  string
+		expected []string
+		errorMsg string
+	}{
+		{
+			name:     "listing",
+			target:   ConsoleListing,
+			project:  "publisher-project",
+			expected: []string{"https://console.cloud.google.com/producer-portal?project=publisher-project"},
+		},
+		{
+			name:     "listing without project",
+			target:   ConsoleListing,
+			errorMsg: "--project",
+		},
+		{
+			name:    "deployment",
+			target:  ConsoleDeployment,
+			project: "default-project",
+			expected: []string{
+				"https://console.cloud.google.com/dm/deployments/details/solution?project=default-project",
+				"https://console.cloud.google.com/dm/deployments/details/test-deployment?project=test-project",
+			},
+		},
+		{
+			name:   "bucket",
+			target: ConsoleBucket,
+			expected: []string{
+				"https://console.cloud.google.com/storage/browser/bucket/listing",
+				"https://console.cloud.google.com/storage/browser/bucket/solution",
+				"https://console.cloud.google.com/storage/browser/modules",
+			},
+		},
+		{
+			name:     "unknown target",
+			target:   "pipeline",
+			errorMsg: "unknown target",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			urls, err := ConsoleURLs(tc.target, resources, tc.project)
+			if tc.errorMsg != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorMsg)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, urls)
+		})
+	}
+
+	_, err := ConsoleURLs(ConsoleDeployment, []Resource{dm}, "")
+	assert.Error(t, err)
+}
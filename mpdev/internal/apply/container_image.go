@@ -0,0 +1,128 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// versionRegex matches a full semantic version, such as 1.2.3, capturing
+// the release track.
+var versionRegex = regexp.MustCompile(`^(([0-9]+)\.[0-9]+)\.[0-9]+$`)
+
+// ContainerImage builds a container image from a Dockerfile and pushes it
+// to Container Registry or Artifact Registry. The image is tagged with the
+// full version and the release track, following Marketplace conventions.
+// See https://cloud.google.com/marketplace/docs/partners/kubernetes/maintaining-app#deploying_to_release_tracks
+type ContainerImage struct {
+	BaseResource
+	// Context is the directory of the build context
+	Context string
+	// Dockerfile relative to Context. Defaults to Dockerfile
+	Dockerfile string
+	// Image is the repository the image is pushed to, such as
+	// gcr.io/project/app
+	Image string
+	// Version of the image, such as 1.2.3. The image is tagged with the
+	// version and its track, 1.2
+	Version string
+	// BuildArgs are passed to the build as --build-arg values
+	BuildArgs map[string]string
+}
+
+// Apply builds, tags and pushes the container image.
+func (c *ContainerImage) Apply(registry Registry, dryRun bool) error {
+	if c.Context == "" {
+		return errors.New("context cannot be empty for container image")
+	}
+	if c.Image == "" {
+		return errors.New("image cannot be empty for container image")
+	}
+	match := versionRegex.FindStringSubmatch(c.Version)
+	if match == nil {
+		return fmt.Errorf("invalid version: %s. Must be of the form MAJOR.MINOR.PATCH, such as 1.2.3", c.Version)
+	}
+	track := match[1]
+
+	if dryRun {
+		return nil
+	}
+
+	context, err := registry.ResolveFilePath(c, c.Context)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve path to build context: %s", c.Context)
+	}
+
+	tags := []string{c.Image + ":" + c.Version, c.Image + ":" + track}
+	spec := BuildSpec{Context: context, Tags: tags, BuildArgs: c.BuildArgs}
+	if c.Dockerfile != "" {
+		spec.Dockerfile = filepath.Join(context, c.Dockerfile)
+	}
+
+	executor := registry.GetExecutor()
+	runner, err := newContainerRunner(executor)
+	if err != nil {
+		return err
+	}
+	ctx := executorContext(executor)
+	err = runWithProgress("Building container image "+tags[0], func(stdout io.Writer, stderr io.Writer) error {
+		return runner.Build(ctx, spec, stdout, stderr)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to build container image %s", tags[0])
+	}
+
+	for _, tag := range tags {
+		err = runWithProgress("Pushing container image "+tag, func(stdout io.Writer, stderr io.Writer) error {
+			return runner.Push(ctx, tag, stdout, stderr)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to push container image %s", tag)
+		}
+	}
+
+	repoDigests, err := runner.RepoDigests(ctx, tags[0])
+	if err != nil {
+		return errors.Wrapf(err, "failed to get digest of container image %s", tags[0])
+	}
+	imageDigest := repoDigestOf(repoDigests, c.Image)
+	parts := strings.SplitN(imageDigest, "@", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "sha256:") {
+		return fmt.Errorf("no digest of container image %s in repository %s: %v", tags[0], c.Image, repoDigests)
+	}
+	fmt.Printf("Pushed container image %s\n", imageDigest)
+
+	registry.SetOutput(c, "image", imageDigest)
+	registry.SetOutput(c, "digest", parts[1])
+	return nil
+}
+
+// repoDigestOf returns the digest of repository among the repo digests of an
+// image, such as gcr.io/project/app@sha256:abc, since the image may also have
+// been pushed to other repositories.
+func repoDigestOf(repoDigests []string, repository string) string {
+	for _, digest := range repoDigests {
+		if strings.HasPrefix(digest, repository+"@") {
+			return digest
+		}
+	}
+	return ""
+}
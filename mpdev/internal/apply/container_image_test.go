@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestContainerImage(t *testing.T) {
+	pushedRunArgs := [][]string{
+		{"docker", "build", "-t", "gcr.io/project/app:1.2.3", "-t", "gcr.io/project/app:1.2",
+			"-f", "/resourcedir/app/Dockerfile.prod", "--build-arg", "A=1", "--build-arg", "B=2", "/resourcedir/app"},
+		{"docker", "push", "gcr.io/project/app:1.2.3"},
+		{"docker", "push", "gcr.io/project/app:1.2"},
+		{"docker", "image", "inspect", "--format", "{{json .RepoDigests}}", "gcr.io/project/app:1.2.3"},
+	}
+	testCases := []struct {
+		name            string
+		runtime         string
+		version         string
+		inspectOutput   string
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:            "Build and push",
+		version:         "1.2.3",
+		inspectOutput:   `["gcr.io/project/app@sha256:abc"]` + "\n",
+		expectedRunArgs: pushedRunArgs,
+	}, {
+		name:            "Digest of another repository first",
+		version:         "1.2.3",
+		inspectOutput:   `["us-docker.pkg.dev/project/mirror/app@sha256:def","gcr.io/project/app@sha256:abc"]`,
+		expectedRunArgs: pushedRunArgs,
+	}, {
+		name:            "Only digests of other repositories",
+		version:         "1.2.3",
+		inspectOutput:   `["gcr.io/project/app-base@sha256:def"]`,
+		expectErr:       true,
+		expectedRunArgs: pushedRunArgs,
+	}, {
+		name:            "Missing digest",
+		version:         "1.2.3",
+		inspectOutput:   "[]\n",
+		expectErr:       true,
+		expectedRunArgs: pushedRunArgs,
+	}, {
+		name:          "Podman",
+		runtime:       RuntimePodman,
+		version:       "1.2.3",
+		inspectOutput: `["gcr.io/project/app@sha256:abc"]`,
+		expectedRunArgs: [][]string{
+			{"podman", "build", "-t", "gcr.io/project/app:1.2.3", "-t", "gcr.io/project/app:1.2",
+				"-f", "/resourcedir/app/Dockerfile.prod", "--build-arg", "A=1", "--build-arg", "B=2", "/resourcedir/app"},
+			{"podman", "push", "gcr.io/project/app:1.2.3"},
+			{"podman", "push", "gcr.io/project/app:1.2"},
+			{"podman", "image", "inspect", "--format", "{{json .RepoDigests}}", "gcr.io/project/app:1.2.3"},
+		},
+	}, {
+		name:      "Invalid version",
+		version:   "1.2",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.runtime != "" {
+				defer func(runtime string) { containerRuntime = runtime }(containerRuntime)
+				containerRuntime = tc.runtime
+			}
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{noOutput, noOutput, noOutput,
+				func() ([]byte, []byte, error) { return []byte(tc.inspectOutput), nil, nil },
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			c := &ContainerImage{
+				BaseResource: newTestBaseResource("ContainerImage", "app"),
+				Context:      "app",
+				Dockerfile:   "Dockerfile.prod",
+				Image:        "gcr.io/project/app",
+				Version:      tc.version,
+				BuildArgs:    map[string]string{"B": "2", "A": "1"},
+			}
+			r.RegisterResource(c, "/resourcedir")
+
+			err := c.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					"image":  "gcr.io/project/app@sha256:abc",
+					"digest": "sha256:abc",
+				}, r.GetOutputs(c.GetReference()))
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
@@ -15,7 +15,20 @@
 package apply
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
 	"k8s.io/utils/exec"
 )
 
@@ -24,37 +37,310 @@ type containerProcess struct {
 	containerImage string
 	processArgs    []string
 	mounts         []mount
+	// name is the name of the container, which identifies containers left
+	// by mpdev if it is killed
+	name string
+	// credentials injects a short-lived access token of the active gcloud
+	// account in the container, for processes that call Google Cloud
+	credentials bool
+	env         []string
 }
 
-// newContainerProcess constructs a command to execute the container process
+// newContainerProcess constructs a process running in a container. The
+// container is run with the selected container runtime, and stopped when the
+// context of executor is done.
 func newContainerProcess(executor exec.Interface, containerImage string, processArgs []string, mounts []mount) *containerProcess {
 	return &containerProcess{
 		executor:       executor,
 		containerImage: containerImage,
 		processArgs:    processArgs,
 		mounts:         mounts,
+		name:           fmt.Sprintf("mpdev-%d-%d", os.Getpid(), time.Now().UnixNano()),
 	}
 }
 
 type mount interface {
-	getMount() string
+	getMount() dockerMount
 }
 
 type bindMount struct {
-	src string
-	dst string
+	src      string
+	dst      string
+	readOnly bool
+}
+
+func (bm *bindMount) getMount() dockerMount {
+	return dockerMount{Type: "bind", Source: bm.src, Target: bm.dst, ReadOnly: bm.readOnly}
 }
 
-func (bm *bindMount) getMount() string {
-	return fmt.Sprintf("type=bind,src=%s,dst=%s", bm.src, bm.dst)
+// credentialsDir is the directory of the access token file in containers.
+const credentialsDir = "/mpdev/credentials"
+
+// addCredentials writes an access token of the active gcloud account to a
+// temporary directory mounted read-only in the container, and points gcloud
+// and terraform in the container to it. The returned function removes the
+// directory. The token is not passed in the arguments of the container,
+// which are logged.
+func (cp *containerProcess) addCredentials() (token string, cleanup func(), err error) {
+	token, err = accessToken(cp.executor)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := util.CreateTmpDir("credentials")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	if err := ioutil.WriteFile(filepath.Join(dir, "access_token"), []byte(token), 0600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	cp.mounts = append(cp.mounts, &bindMount{src: dir, dst: credentialsDir, readOnly: true})
+	cp.env = append(cp.env,
+		"CLOUDSDK_AUTH_ACCESS_TOKEN_FILE="+path.Join(credentialsDir, "access_token"),
+		"GOOGLE_OAUTH_ACCESS_TOKEN="+token)
+	return token, cleanup, nil
 }
 
-func (cp *containerProcess) getCommand() exec.Cmd {
-	args := []string{"docker", "run", "--rm", "-i"}
+// redactingWriter replaces a secret in the output written to w. Secrets
+// split across writes are not replaced, which does not happen for the
+// output of containers, whose logs are written a line at a time.
+type redactingWriter struct {
+	w      io.Writer
+	secret []byte
+}
+
+func (r *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write(bytes.Replace(p, r.secret, []byte("[REDACTED]"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// getSpec returns the specification of the container.
+func (cp *containerProcess) getSpec() ContainerSpec {
+	spec := ContainerSpec{Name: cp.name, Image: cp.containerImage, Args: cp.processArgs, Env: cp.env}
 	for _, mount := range cp.mounts {
-		args = append(args, "--mount", mount.getMount())
+		spec.Mounts = append(spec.Mounts, mount.getMount())
+	}
+	return spec
+}
+
+// run runs the container process with the selected container runtime,
+// streaming its output to stdout and stderr, and removes the container once
+// it exits. The image is pulled according to the pull policy. The container
+// is stopped if the context of the executor is done, or if it runs for
+// longer than the command timeout.
+func (cp *containerProcess) run(stdout io.Writer, stderr io.Writer) (err error) {
+	runner, err := newContainerRunner(cp.executor)
+	if err != nil {
+		return err
+	}
+	ctx := executorContext(cp.executor)
+	if cp.credentials {
+		token, cleanup, err := cp.addCredentials()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		stdout = &redactingWriter{w: stdout, secret: []byte(token)}
+		stderr = &redactingWriter{w: stderr, secret: []byte(token)}
+	}
+	if err := ensureImage(ctx, runner, cp.containerImage, pullPolicy); err != nil {
+		return err
+	}
+	if err := verifyImageDigest(ctx, runner, cp.containerImage); err != nil {
+		return err
+	}
+	runCtx := ctx
+	if commandTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+	defer func() {
+		// The container is removed even if ctx is done.
+		removeErr := runner.Remove(context.Background(), cp.name)
+		if err == nil {
+			err = removeErr
+		}
+		if err != nil && ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+			err = errors.Wrapf(err, "container %s timed out after %s", cp.containerImage, commandTimeout)
+		}
+	}()
+	status, err := runner.Run(runCtx, cp.getSpec(), stdout, stderr)
+	if err != nil {
+		return err
+	}
+	if err := cp.reclaimOwnership(runCtx, runner); err != nil {
+		return err
+	}
+	if status != 0 {
+		return &dockerError{op: "run container " + cp.containerImage, message: fmt.Sprintf("exit status %d", status)}
+	}
+	return nil
+}
+
+// Strategies to give containers access to the directories of their mounts.
+const (
+	// MountBind bind mounts the directories in containers
+	MountBind = "bind"
+	// MountCopy copies the directories into containers before they start,
+	// and back once they exit
+	MountCopy = "copy"
+)
+
+// MountStrategyEnv selects the mount strategy, overriding its detection.
+const MountStrategyEnv = "MPDEV_MOUNT_STRATEGY"
+
+// mountStrategy returns how directories are mounted in containers. Bind
+// mounts refer to paths of the host of the docker daemon, so directories
+// are copied instead when mpdev runs in a container, such as a Cloud Build
+// step that uses the docker daemon of the build VM, or in Cloud Shell.
+func mountStrategy() string {
+	if strategy := os.Getenv(MountStrategyEnv); strategy == MountBind || strategy == MountCopy {
+		return strategy
+	}
+	if os.Getenv("CLOUD_SHELL") == "true" {
+		return MountCopy
+	}
+	if _, err := os.Stat(dockerEnvFile); err == nil {
+		return MountCopy
+	}
+	return MountBind
+}
+
+// dockerEnvFile is created by docker at the root of containers.
+var dockerEnvFile = "/.dockerenv"
+
+// tarDirectory writes a tar archive of dir to w, in which its files are in
+// the directory root.
+func tarDirectory(w io.Writer, dir string, root string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(root, filepath.ToSlash(rel))
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// untarDirectory extracts a tar archive whose entries are in a single root
+// directory into dir, without the root directory.
+func untarDirectory(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		parts := strings.SplitN(strings.TrimPrefix(header.Name, "/"), "/", 2)
+		if len(parts) < 2 {
+			continue
+		}
+		rel := path.Clean(parts[1])
+		if strings.HasPrefix(rel, "../") || rel == ".." {
+			return fmt.Errorf("invalid path %s in archive", header.Name)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(rel))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// containerUser returns the user that containers run as, such that the files
+// they write to bind mounts are owned by the current user. Rootless daemons
+// already map the root user of containers to the current user.
+func containerUser(info *dockerInfo) string {
+	if info.hasSecurityOption("rootless") || os.Getuid() < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
+
+// pinnedDigests are the digests that images run in containers must have,
+// by image, and requirePinnedDigests whether images without a pinned digest
+// are refused.
+var (
+	pinnedDigests        map[string]string
+	requirePinnedDigests bool
+)
+
+// PinImageDigests sets the digests, such as sha256:0123, that the images of
+// the containers run by resources must have, such that a release pipeline
+// fails if the tag of an image is moved. If required is set, images without
+// a pinned digest cannot be run, unless they are referenced by digest.
+func PinImageDigests(digests map[string]string, required bool) {
+	pinnedDigests = digests
+	requirePinnedDigests = required
+}
+
+// verifyImageDigest returns an error if the local image does not have the
+// digest pinned for it.
+func verifyImageDigest(ctx context.Context, runner ContainerRunner, image string) error {
+	pinned, ok := pinnedDigests[image]
+	if !ok {
+		if requirePinnedDigests && !strings.Contains(image, "@") {
+			return VerificationError(fmt.Errorf("no digest is pinned for image %s, and pinned digests are required", image))
+		}
+		return nil
+	}
+	digests, err := runner.RepoDigests(ctx, image)
+	if err != nil {
+		return err
+	}
+	for _, digest := range digests {
+		if strings.HasSuffix(digest, "@"+pinned) {
+			return nil
+		}
 	}
-	args = append(args, cp.containerImage)
-	args = append(args, cp.processArgs...)
-	return cp.executor.Command(args[0], args[1:]...)
+	return VerificationError(fmt.Errorf("image %s does not have the pinned digest %s, its tag may have been moved. Digests: %s",
+		image, pinned, strings.Join(digests, ", ")))
 }
@@ -0,0 +1,152 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"k8s.io/utils/exec"
+)
+
+// ContainerRunner runs the containers of resources, such as autogen, with a
+// container runtime.
+type ContainerRunner interface {
+	// Run runs a container until it exits, streaming its output to stdout
+	// and stderr, and returns its exit status. The container is stopped if
+	// ctx is done, and is left for Remove.
+	Run(ctx context.Context, spec ContainerSpec, stdout io.Writer, stderr io.Writer) (int, error)
+	// Pull pulls an image from its registry.
+	Pull(ctx context.Context, image string) error
+	// ImageExists returns whether an image is present locally.
+	ImageExists(ctx context.Context, image string) (bool, error)
+	// Remove removes a container by name, killing it if it is still
+	// running. Removing a container that does not exist is not an error.
+	Remove(ctx context.Context, name string) error
+	// Build builds an image, streaming the output of the build to stdout
+	// and stderr.
+	Build(ctx context.Context, spec BuildSpec, stdout io.Writer, stderr io.Writer) error
+	// Push pushes a tag of a local image to its registry, streaming the
+	// output of the push to stdout and stderr.
+	Push(ctx context.Context, image string, stdout io.Writer, stderr io.Writer) error
+	// RepoDigests returns the digests of a local image in the repositories
+	// it was pulled from or pushed to, such as
+	// gcr.io/project/image@sha256:0123.
+	RepoDigests(ctx context.Context, image string) ([]string, error)
+}
+
+// ContainerSpec is a container run by a ContainerRunner.
+type ContainerSpec struct {
+	// Name is the name of the container, which identifies containers left
+	// by mpdev if it is killed
+	Name  string
+	Image string
+	Args  []string
+	// Env are the environment variables of the process, such as KEY=value
+	Env    []string
+	Mounts []dockerMount
+	// User is the user the process runs as, such as 0:0, which overrides
+	// the user chosen by the runner
+	User string
+	// Entrypoint is the executable run with Args, which overrides the
+	// entrypoint of the image
+	Entrypoint string
+}
+
+// BuildSpec is an image built by a ContainerRunner.
+type BuildSpec struct {
+	// Context is the directory of the build context
+	Context string
+	// Dockerfile is the path of the Dockerfile, which defaults to the
+	// Dockerfile of Context
+	Dockerfile string
+	// Tags are the tags of the image, such as gcr.io/project/app:1.2.3
+	Tags []string
+	// BuildArgs are the values of the ARG instructions of the Dockerfile
+	BuildArgs map[string]string
+}
+
+// buildArgs returns the arguments of the build command of the docker and
+// podman CLIs building spec.
+func buildArgs(spec BuildSpec) []string {
+	args := []string{"build"}
+	for _, tag := range spec.Tags {
+		args = append(args, "-t", tag)
+	}
+	if spec.Dockerfile != "" {
+		args = append(args, "-f", spec.Dockerfile)
+	}
+	names := make([]string, 0, len(spec.BuildArgs))
+	for name := range spec.BuildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--build-arg", name+"="+spec.BuildArgs[name])
+	}
+	return append(args, spec.Context)
+}
+
+// Container runtimes that run the containers of resources, selected with
+// UseContainerRuntime.
+const (
+	// RuntimeDocker runs containers with the docker CLI
+	RuntimeDocker = "docker"
+	// RuntimePodman runs containers with the podman CLI
+	RuntimePodman = "podman"
+)
+
+// ContainerRuntimes are the supported container runtimes.
+var ContainerRuntimes = []string{RuntimeDocker, RuntimePodman}
+
+// containerRuntime is the runtime of the containers of resources.
+var containerRuntime = RuntimeDocker
+
+// UseContainerRuntime sets the runtime of the containers run by resources,
+// such as autogen. It must be one of ContainerRuntimes.
+func UseContainerRuntime(runtime string) error {
+	if !containsString(ContainerRuntimes, runtime) {
+		return fmt.Errorf("unsupported container runtime %s. Must be one of %v", runtime, ContainerRuntimes)
+	}
+	containerRuntime = runtime
+	return nil
+}
+
+// newContainerRunner returns the runner of the selected container runtime,
+// whose commands are executed with executor. It is replaced by a
+// fake in tests.
+var newContainerRunner = func(executor exec.Interface) (ContainerRunner, error) {
+	if containerRuntime == RuntimePodman {
+		return &podmanRunner{executor: executor}, nil
+	}
+	return &dockerRunner{executor: executor}, nil
+}
+
+// ensureImage pulls image according to policy.
+func ensureImage(ctx context.Context, runner ContainerRunner, image string, policy string) error {
+	if policy == PullAlways {
+		return runner.Pull(ctx, image)
+	}
+	exists, err := runner.ImageExists(ctx, image)
+	if err != nil || exists {
+		return err
+	}
+	if policy == PullNever {
+		return &dockerError{op: "run container " + image, message: fmt.Sprintf("the image is not present, and the pull policy is %s", PullNever)}
+	}
+	return runner.Pull(ctx, image)
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// fakeContainerRunner records the calls of containerProcess, and runs
+// containers that write output and exit with status.
+type fakeContainerRunner struct {
+	images  map[string]bool
+	digests []string
+	output  string
+	status  int
+	runErr  error
+	// onRun is called with the specification of the containers run
+	onRun func(spec ContainerSpec)
+
+	pulls   []string
+	runs    []ContainerSpec
+	removed []string
+	builds  []BuildSpec
+	pushes  []string
+}
+
+func (f *fakeContainerRunner) Run(ctx context.Context, spec ContainerSpec, stdout io.Writer, stderr io.Writer) (int, error) {
+	f.runs = append(f.runs, spec)
+	if f.onRun != nil {
+		f.onRun(spec)
+	}
+	_, _ = io.WriteString(stdout, f.output)
+	return f.status, f.runErr
+}
+
+func (f *fakeContainerRunner) Pull(ctx context.Context, image string) error {
+	f.pulls = append(f.pulls, image)
+	if f.images == nil {
+		f.images = map[string]bool{}
+	}
+	f.images[image] = true
+	return nil
+}
+
+func (f *fakeContainerRunner) ImageExists(ctx context.Context, image string) (bool, error) {
+	return f.images[image], nil
+}
+
+func (f *fakeContainerRunner) Remove(ctx context.Context, name string) error {
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+func (f *fakeContainerRunner) Build(ctx context.Context, spec BuildSpec, stdout io.Writer, stderr io.Writer) error {
+	f.builds = append(f.builds, spec)
+	return nil
+}
+
+func (f *fakeContainerRunner) Push(ctx context.Context, image string, stdout io.Writer, stderr io.Writer) error {
+	f.pushes = append(f.pushes, image)
+	return nil
+}
+
+func (f *fakeContainerRunner) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	return f.digests, nil
+}
+
+// useFakeContainerRunner makes containerProcess run containers with runner,
+// and returns a function restoring the selected runtime.
+func useFakeContainerRunner(runner ContainerRunner) func() {
+	newRunner := newContainerRunner
+	newContainerRunner = func(exec.Interface) (ContainerRunner, error) { return runner, nil }
+	return func() { newContainerRunner = newRunner }
+}
+
+func TestEnsureImage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		policy        string
+		exists        bool
+		expectedPulls []string
+		expectErr     string
+	}{{
+		name:   "Present image",
+		policy: PullIfNotPresent,
+		exists: true,
+	}, {
+		name:          "Missing image",
+		policy:        PullIfNotPresent,
+		expectedPulls: []string{"gcr.io/project/image"},
+	}, {
+		name:          "Always pull",
+		policy:        PullAlways,
+		exists:        true,
+		expectedPulls: []string{"gcr.io/project/image"},
+	}, {
+		name:   "Never pull present image",
+		policy: PullNever,
+		exists: true,
+	}, {
+		name:      "Never pull missing image",
+		policy:    PullNever,
+		expectErr: "failed to run container gcr.io/project/image: the image is not present, and the pull policy is never",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &fakeContainerRunner{images: map[string]bool{"gcr.io/project/image": tc.exists}}
+			err := ensureImage(context.Background(), runner, "gcr.io/project/image", tc.policy)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedPulls, runner.pulls)
+		})
+	}
+}
+
+func TestContainerProcessRunner(t *testing.T) {
+	runner := &fakeContainerRunner{output: "generated package\n", status: 2}
+	defer useFakeContainerRunner(runner)()
+
+	cp := newContainerProcess(&testingexec.FakeExec{}, "gcr.io/project/image", []string{"--output", "/out"},
+		[]mount{&bindMount{src: "/tmp/out", dst: "/out"}})
+	var stdout bytes.Buffer
+	err := cp.run(&stdout, &bytes.Buffer{})
+	assert.EqualError(t, err, "failed to run container gcr.io/project/image: exit status 2")
+	assert.Equal(t, ExitTool, ExitCode(err))
+	assert.Equal(t, "generated package\n", stdout.String())
+	assert.Equal(t, []string{"gcr.io/project/image"}, runner.pulls)
+	assert.Equal(t, []ContainerSpec{{
+		Name:   cp.name,
+		Image:  "gcr.io/project/image",
+		Args:   []string{"--output", "/out"},
+		Mounts: []dockerMount{{Type: "bind", Source: "/tmp/out", Target: "/out"}},
+	}}, runner.runs)
+	assert.Equal(t, []string{cp.name}, runner.removed)
+}
+
+func TestPodmanRunner(t *testing.T) {
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, testingexec.FakeExitError{Status: 1} },
+		func() ([]byte, []byte, error) {
+			return []byte("generated package\n"), nil, testingexec.FakeExitError{Status: 3}
+		},
+		func() ([]byte, []byte, error) { return []byte("mpdev-1\n"), nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{}
+	for range fcmd.RunScript {
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+		})
+	}
+	runner := &podmanRunner{executor: fexec}
+	ctx := context.Background()
+
+	exists, err := runner.ImageExists(ctx, "gcr.io/project/image")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	var stdout bytes.Buffer
+	status, err := runner.Run(ctx, ContainerSpec{
+		Name:   "mpdev-1",
+		Image:  "gcr.io/project/image",
+		Args:   []string{"--output", "/out"},
+		Env:    []string{"GOOGLE_OAUTH_ACCESS_TOKEN=ya29.token"},
+		Mounts: []dockerMount{{Source: "/tmp/out", Target: "/out"}, {Source: "/tmp/creds", Target: "/creds", ReadOnly: true}},
+	}, &stdout, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, status)
+	assert.Equal(t, "generated package\n", stdout.String())
+	assert.Contains(t, fcmd.Env, "GOOGLE_OAUTH_ACCESS_TOKEN=ya29.token")
+
+	assert.NoError(t, runner.Remove(ctx, "mpdev-1"))
+	assert.Equal(t, [][]string{
+		{"podman", "image", "exists", "gcr.io/project/image"},
+		{"podman", "run", "--name", "mpdev-1", "--env", "GOOGLE_OAUTH_ACCESS_TOKEN", "--volume", "/tmp/out:/out:Z",
+			"--volume", "/tmp/creds:/creds:ro,Z", "gcr.io/project/image", "--output", "/out"},
+		{"podman", "rm", "--force", "--ignore", "mpdev-1"},
+	}, fcmd.RunLog)
+}
+
+func TestUseContainerRuntime(t *testing.T) {
+	defer func(runtime string) { containerRuntime = runtime }(containerRuntime)
+	assert.NoError(t, UseContainerRuntime(RuntimePodman))
+	runner, err := newContainerRunner(&testingexec.FakeExec{})
+	assert.NoError(t, err)
+	assert.IsType(t, &podmanRunner{}, runner)
+	assert.EqualError(t, UseContainerRuntime("rkt"), "unsupported container runtime rkt. Must be one of [docker podman]")
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// apiVersions are the apiVersions that resources can be converted to.
+var apiVersions = []string{apiVersion}
+
+// kindConversions lists the kinds that resources of a kind can be converted
+// to. The fields of a kind must be a subset of the fields of the kinds it
+// converts to, so that converting does not drop any configuration.
+var kindConversions = map[string][]string{
+	"DeploymentManagerPreview": {"DeploymentManagerDeployment"},
+}
+
+var (
+	documentSeparatorRegex = regexp.MustCompile(`(?m)^---[ \t]*$`)
+	// topLevelFieldRegex matches an unindented field, capturing the field
+	// name, value and line comment.
+	topLevelFieldRegex = `(?m)^(%s:[ \t]*)([^#\s]+)([ \t]+#.*)?$`
+)
+
+// ConvertOptions selects the resources converted by Convert, and what they
+// are converted to.
+type ConvertOptions struct {
+	// Name of the resource to convert. If empty, all resources are
+	// converted.
+	Name string
+	// ToKind is the kind resources are converted to. Resources whose kind
+	// cannot be converted to ToKind are left unchanged.
+	ToKind string
+	// ToAPIVersion is the apiVersion resources are converted to.
+	ToAPIVersion string
+}
+
+// Convert rewrites the kind and apiVersion of the resources in a
+// configuration file. Only the kind and apiVersion lines of converted
+// resources are changed, so comments and formatting are preserved. It
+// returns the converted file and the number of converted resources.
+func Convert(in []byte, opts ConvertOptions) ([]byte, int, error) {
+	if opts.ToKind == "" && opts.ToAPIVersion == "" {
+		return nil, 0, errors.New("either the kind or apiVersion to convert to must be set")
+	}
+	if opts.ToAPIVersion != "" && !containsString(apiVersions, opts.ToAPIVersion) {
+		return nil, 0, fmt.Errorf("unknown apiVersion %s. Must be one of: %s", opts.ToAPIVersion, strings.Join(apiVersions, ", "))
+	}
+
+	docs, separators := splitDocuments(in)
+	converted := 0
+	for i, doc := range docs {
+		var obj Unstructured
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to parse document %d", i+1)
+		}
+		typeMeta := obj.getTypeMeta()
+		if !strings.HasPrefix(typeMeta.APIVersion, apiGroup+"/") {
+			continue
+		}
+		if opts.Name != "" {
+			if metadata, _ := obj["metadata"].(map[string]interface{}); metadata["name"] != opts.Name {
+				continue
+			}
+		}
+
+		newDoc := doc
+		if opts.ToKind != "" && typeMeta.Kind != opts.ToKind {
+			if !containsString(kindConversions[typeMeta.Kind], opts.ToKind) {
+				continue
+			}
+			newDoc = replaceTopLevelField(newDoc, "kind", opts.ToKind)
+		}
+		if opts.ToAPIVersion != "" {
+			newDoc = replaceTopLevelField(newDoc, "apiVersion", opts.ToAPIVersion)
+		}
+		if newDoc == doc {
+			continue
+		}
+
+		var newObj Unstructured
+		if err := yaml.Unmarshal([]byte(newDoc), &newObj); err != nil {
+			return nil, 0, errors.Wrapf(err, "failed to parse converted document %d", i+1)
+		}
+		if _, err := UnstructuredToResource(newObj); err != nil {
+			return nil, 0, errors.Wrapf(err, "invalid converted document %d", i+1)
+		}
+		docs[i] = newDoc
+		converted++
+	}
+
+	return joinDocuments(docs, separators), converted, nil
+}
+
+// splitDocuments splits a yaml stream into its documents, and the
+// separators between them.
+func splitDocuments(in []byte) ([]string, []string) {
+	var separators []string
+	for _, loc := range documentSeparatorRegex.FindAllIndex(in, -1) {
+		separators = append(separators, string(in[loc[0]:loc[1]]))
+	}
+	return documentSeparatorRegex.Split(string(in), -1), separators
+}
+
+// joinDocuments reverses splitDocuments.
+func joinDocuments(docs []string, separators []string) []byte {
+	var out strings.Builder
+	for i, doc := range docs {
+		if i > 0 {
+			out.WriteString(separators[i-1])
+		}
+		out.WriteString(doc)
+	}
+	return []byte(out.String())
+}
+
+func replaceTopLevelField(doc string, field string, value string) string {
+	re := regexp.MustCompile(fmt.Sprintf(topLevelFieldRegex, regexp.QuoteMeta(field)))
+	return re.ReplaceAllString(doc, "${1}"+strings.Replace(value, "$", "$$", -1)+"${3}")
+}
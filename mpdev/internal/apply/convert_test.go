@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	config := `# Previews the template
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerPreview # creates a preview only
+metadata:
+  name: preview
+deploymentManagerRef:
+  group: dev.marketplace.cloud.google.com
+  kind: DeploymentManagerAutogenTemplate
+  name: autogen
+projectId: test-project
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: module
+`
+
+	testCases := []struct {
+		name              string
+		opts              ConvertOptions
+		expected          string
+		expectedConverted int
+		errorContains     string
+	}{{
+		name: "Convert kind",
+		opts: ConvertOptions{ToKind: "DeploymentManagerDeployment"},
+		expected: `# Previews the template
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerDeployment # creates a preview only
+metadata:
+  name: preview
+deploymentManagerRef:
+  group: dev.marketplace.cloud.google.com
+  kind: DeploymentManagerAutogenTemplate
+  name: autogen
+projectId: test-project
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: module
+`,
+		expectedConverted: 1,
+	}, {
+		name:     "Name does not match",
+		opts:     ConvertOptions{ToKind: "DeploymentManagerDeployment", Name: "other"},
+		expected: config,
+	}, {
+		name:     "Already at apiVersion",
+		opts:     ConvertOptions{ToAPIVersion: apiVersion},
+		expected: config,
+	}, {
+		name:          "Unknown apiVersion",
+		opts:          ConvertOptions{ToAPIVersion: "dev.marketplace.cloud.google.com/v2"},
+		errorContains: "unknown apiVersion",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, converted, err := Convert([]byte(config), tc.opts)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(out))
+			assert.Equal(t, tc.expectedConverted, converted)
+		})
+	}
+}
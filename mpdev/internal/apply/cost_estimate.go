@@ -0,0 +1,429 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
+)
+
+const (
+	// billingCatalogAPI lists the SKUs of Google Cloud services and their
+	// prices.
+	billingCatalogAPI = "https://cloudbilling.googleapis.com/v1"
+	// computeServiceID is the ID of Compute Engine in the billing catalog.
+	computeServiceID = "6F81-5844-456A"
+	// DefaultCostThreshold is the estimated cost, in USD, of the
+	// deployments of a resource above which they must be confirmed.
+	DefaultCostThreshold = 10.0
+	// deploymentTestHours is the time the VMs of a test deployment are
+	// estimated to run for, from its creation to its deletion.
+	deploymentTestHours = 1.0
+	hoursPerMonth       = 730.0
+)
+
+var (
+	// costThreshold is the estimated cost above which deployments must be
+	// confirmed. Costs are not estimated if it is 0.
+	costThreshold float64
+	costConfirmed bool
+)
+
+// LimitCost requires confirming the deployments of a DeploymentManagerDeployment
+// whose estimated cost exceeds threshold, in USD, or DefaultCostThreshold if
+// threshold is 0. Costs are not estimated if confirmed is set.
+func LimitCost(threshold float64, confirmed bool) error {
+	if threshold < 0 {
+		return fmt.Errorf("invalid cost threshold: %v. Must not be negative", threshold)
+	}
+	if threshold == 0 {
+		threshold = DefaultCostThreshold
+	}
+	costThreshold = threshold
+	costConfirmed = confirmed
+	return nil
+}
+
+// zoneRegex matches a Compute Engine zone, such as us-central1-a, capturing
+// its region.
+var zoneRegex = regexp.MustCompile(`^([a-z]+-[a-z]+[0-9]+)-[a-z]$`)
+
+// diskSKUDescriptions match the descriptions of the SKUs of persistent
+// disks, by disk type.
+var diskSKUDescriptions = map[string]*regexp.Regexp{
+	"pd-standard": regexp.MustCompile(`(?i)^storage pd capacity`),
+	"pd-balanced": regexp.MustCompile(`(?i)^balanced pd capacity`),
+	"pd-ssd":      regexp.MustCompile(`(?i)^ssd backed pd capacity`),
+	"pd-extreme":  regexp.MustCompile(`(?i)^extreme pd capacity`),
+}
+
+// vmUsage is a group of identical VMs created by a deployment.
+type vmUsage struct {
+	count            float64
+	machineType      string
+	zone             string
+	diskType         string
+	diskSizeGb       float64
+	acceleratorType  string
+	acceleratorCount float64
+}
+
+// costLine is the estimated cost of a part of a deployment.
+type costLine struct {
+	description string
+	cost        float64
+}
+
+// billingSKU is a SKU of the billing catalog.
+type billingSKU struct {
+	Description string `json:"description"`
+	Category    struct {
+		UsageType string `json:"usageType"`
+	} `json:"category"`
+	ServiceRegions []string `json:"serviceRegions"`
+	PricingInfo    []struct {
+		PricingExpression struct {
+			UsageUnit   string `json:"usageUnit"`
+			TieredRates []struct {
+				UnitPrice struct {
+					Units string `json:"units"`
+					Nanos int64  `json:"nanos"`
+				} `json:"unitPrice"`
+			} `json:"tieredRates"`
+		} `json:"pricingExpression"`
+	} `json:"pricingInfo"`
+}
+
+// computeSKUs caches the SKUs of Compute Engine, which are listed once per
+// run.
+var (
+	computeSKUsMu sync.Mutex
+	computeSKUs   []billingSKU
+)
+
+// listComputeSKUs returns the SKUs of Compute Engine in the billing catalog.
+func listComputeSKUs(executor exec.Interface) ([]billingSKU, error) {
+	computeSKUsMu.Lock()
+	defer computeSKUsMu.Unlock()
+	if computeSKUs != nil {
+		return computeSKUs, nil
+	}
+
+	var skus []billingSKU
+	pageToken := ""
+	for {
+		url := fmt.Sprintf("%s/services/%s/skus?currencyCode=USD&pageSize=5000", billingCatalogAPI, computeServiceID)
+		if pageToken != "" {
+			url += "&pageToken=" + pageToken
+		}
+		var page struct {
+			Skus          []billingSKU `json:"skus"`
+			NextPageToken string       `json:"nextPageToken"`
+		}
+		err := callGoogleAPI(executor, "GET", url, nil, &page)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list prices of Compute Engine")
+		}
+		skus = append(skus, page.Skus...)
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+	computeSKUs = skus
+	return skus, nil
+}
+
+// hourlyPrice returns the on-demand price per hour of the first SKU whose
+// description matches in region. Prices per month, as of disks, are
+// converted to prices per hour.
+func hourlyPrice(skus []billingSKU, description *regexp.Regexp, region string) (float64, bool) {
+	for _, sku := range skus {
+		if sku.Category.UsageType != "OnDemand" || !containsString(sku.ServiceRegions, region) ||
+			!description.MatchString(sku.Description) || len(sku.PricingInfo) == 0 {
+			continue
+		}
+		expression := sku.PricingInfo[0].PricingExpression
+		if len(expression.TieredRates) == 0 {
+			continue
+		}
+		unitPrice := expression.TieredRates[len(expression.TieredRates)-1].UnitPrice
+		units, _ := strconv.ParseFloat(unitPrice.Units, 64)
+		price := units + float64(unitPrice.Nanos)/1e9
+		if expression.UsageUnit == "GiBy.mo" {
+			price /= hoursPerMonth
+		}
+		return price, true
+	}
+	return 0, false
+}
+
+// estimateCost returns the estimated cost of running vms for hours in
+// projectID: their cores and memory, GPUs and boot disks.
+func estimateCost(executor exec.Interface, projectID string, vms []vmUsage, hours float64) ([]costLine, error) {
+	if len(vms) == 0 {
+		return nil, nil
+	}
+	skus, err := listComputeSKUs(executor)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []costLine
+	for _, vm := range vms {
+		match := zoneRegex.FindStringSubmatch(vm.zone)
+		if match == nil {
+			return nil, fmt.Errorf("invalid zone of machine type %s: %q. Must be of the form REGION-LETTER, such as us-central1-a", vm.machineType, vm.zone)
+		}
+		region := match[1]
+		price := func(what string, description *regexp.Regexp) (float64, error) {
+			p, ok := hourlyPrice(skus, description, region)
+			if !ok {
+				return 0, fmt.Errorf("no on-demand price of %s in region %s in the Cloud Billing Catalog", what, region)
+			}
+			return p, nil
+		}
+
+		stdout, err := runCommandOutput(executor, "gcloud", "compute", "machine-types", "describe", vm.machineType,
+			"--zone", vm.zone, "--project", projectID, "--format", "json")
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to describe machine type %s in zone %s", vm.machineType, vm.zone)
+		}
+		var machineType struct {
+			GuestCpus    float64 `json:"guestCpus"`
+			MemoryMb     float64 `json:"memoryMb"`
+			Accelerators []struct {
+				GuestAcceleratorType  string  `json:"guestAcceleratorType"`
+				GuestAcceleratorCount float64 `json:"guestAcceleratorCount"`
+			} `json:"accelerators"`
+		}
+		err = json.Unmarshal(stdout, &machineType)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse description of machine type %s", vm.machineType)
+		}
+
+		series := regexp.QuoteMeta(strings.SplitN(vm.machineType, "-", 2)[0])
+		corePrice, err := price(vm.machineType+" cores", regexp.MustCompile(`(?i)^`+series+`( predefined)?( amd| intel| arm)? instance core running in`))
+		if err != nil {
+			return nil, err
+		}
+		ramPrice, err := price(vm.machineType+" memory", regexp.MustCompile(`(?i)^`+series+`( predefined)?( amd| intel| arm)? instance ram running in`))
+		if err != nil {
+			return nil, err
+		}
+		memoryGb := machineType.MemoryMb / 1024
+		lines = append(lines, costLine{
+			description: fmt.Sprintf("%v x %s in %s (%v vCPUs, %.1f GB)", vm.count, vm.machineType, vm.zone, machineType.GuestCpus, memoryGb),
+			cost:        vm.count * hours * (machineType.GuestCpus*corePrice + memoryGb*ramPrice),
+		})
+
+		accelerators := map[string]float64{}
+		for _, accelerator := range machineType.Accelerators {
+			accelerators[accelerator.GuestAcceleratorType] += accelerator.GuestAcceleratorCount
+		}
+		if vm.acceleratorType != "" {
+			accelerators[vm.acceleratorType] += vm.acceleratorCount
+		}
+		for accelerator, count := range accelerators {
+			words := regexp.QuoteMeta(strings.Replace(accelerator, "-", " ", -1))
+			gpuPrice, err := price(accelerator, regexp.MustCompile(`(?i)^`+words+` gpu running in`))
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, costLine{
+				description: fmt.Sprintf("%v x %v %s", vm.count, count, accelerator),
+				cost:        vm.count * hours * count * gpuPrice,
+			})
+		}
+
+		description, ok := diskSKUDescriptions[vm.diskType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported disk type %s", vm.diskType)
+		}
+		diskPrice, err := price(vm.diskType, description)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, costLine{
+			description: fmt.Sprintf("%v x %v GB %s disk", vm.count, vm.diskSizeGb, vm.diskType),
+			cost:        vm.count * hours * vm.diskSizeGb * diskPrice,
+		})
+	}
+	return lines, nil
+}
+
+// templateVMs returns the VMs created by the template resources of the
+// deployment configuration at path, from the machineType properties of the
+// resources and the defaults of their schemas, such as machineType, zone
+// and bootDiskSizeGb of a single VM, or the properties of a tier prefixed
+// by its name, such as tier0_machineType and tier0_instanceCount.
+// Properties in overrides replace those of the resources.
+func templateVMs(path string, overrides map[string]interface{}) ([]vmUsage, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Resources []struct {
+			Type       string                 `yaml:"type"`
+			Properties map[string]interface{} `yaml:"properties"`
+		} `yaml:"resources"`
+	}
+	err = yaml.Unmarshal(b, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse deployment configuration %s", path)
+	}
+
+	var vms []vmUsage
+	for _, resource := range config.Resources {
+		if !isTemplateFile(resource.Type) {
+			continue
+		}
+		properties, err := schemaDefaults(filepath.Join(filepath.Dir(path), resource.Type+".schema"))
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range resource.Properties {
+			properties[key] = value
+		}
+		for key, value := range overrides {
+			properties[key] = value
+		}
+
+		keys := make([]string, 0, len(properties))
+		for key := range properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := properties[key]
+			if !strings.HasSuffix(key, "machineType") {
+				continue
+			}
+			prefix := strings.TrimSuffix(key, "machineType")
+			vm := vmUsage{count: 1, diskType: "pd-standard", diskSizeGb: 10}
+			vm.machineType, _ = value.(string)
+			vm.zone, _ = field(properties, prefix+"zone", "zone").(string)
+			vm.acceleratorType, _ = field(properties, prefix+"acceleratorType").(string)
+			if diskType, ok := field(properties, prefix+"bootDiskType").(string); ok && diskType != "" {
+				vm.diskType = diskType
+			}
+			for name, n := range map[string]*float64{"instanceCount": &vm.count, "bootDiskSizeGb": &vm.diskSizeGb, "acceleratorCount": &vm.acceleratorCount} {
+				if v, ok := number(properties[prefix+name]); ok {
+					*n = v
+				}
+			}
+			if vm.machineType != "" && vm.count > 0 {
+				vms = append(vms, vm)
+			}
+		}
+	}
+	return vms, nil
+}
+
+// schemaDefaults returns the defaults of the properties of the schema of a
+// template. Templates without a schema have no defaults.
+func schemaDefaults(path string) (map[string]interface{}, error) {
+	defaults := map[string]interface{}{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return defaults, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema struct {
+		Properties map[string]struct {
+			Default interface{} `yaml:"default"`
+		} `yaml:"properties"`
+	}
+	err = yaml.Unmarshal(b, &schema)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse schema %s", path)
+	}
+	for name, property := range schema.Properties {
+		if property.Default != nil {
+			defaults[name] = property.Default
+		}
+	}
+	return defaults, nil
+}
+
+// checkCost estimates the cost of the deployments that Apply creates from
+// the configuration file at config, and fails if it exceeds the cost
+// threshold or cannot be estimated, and was not confirmed.
+func (d *DeploymentManagerDeployment) checkCost(executor exec.Interface, config string, name string) error {
+	if costThreshold == 0 || costConfirmed {
+		return nil
+	}
+
+	lines, err := d.estimateCost(executor, config)
+	if err != nil {
+		return UsageError(errors.Wrapf(err, "failed to estimate the cost of deployment %s. Pass --confirm-cost to create it without an estimate", name))
+	}
+	total := 0.0
+	for _, line := range lines {
+		total += line.cost
+	}
+	fmt.Printf("Estimated cost of deployment %s, for %v hour: $%.2f\n", name, deploymentTestHours, total)
+	for _, line := range lines {
+		fmt.Printf("  $%7.2f  %s\n", line.cost, line.description)
+	}
+	if total > costThreshold {
+		return UsageError(fmt.Errorf("estimated cost $%.2f of deployment %s exceeds the threshold of $%.2f. Pass --confirm-cost to create it",
+			total, name, costThreshold))
+	}
+	return nil
+}
+
+// estimateCost returns the estimated cost of the deployments that Apply
+// creates from the configuration file at config: one per combination of
+// Matrix, or ParallelDeployments.
+func (d *DeploymentManagerDeployment) estimateCost(executor exec.Interface, config string) ([]costLine, error) {
+	var vms []vmUsage
+	if d.Matrix != nil {
+		for _, combination := range d.Matrix.combinations() {
+			combinationVMs, err := templateVMs(config, combination.properties())
+			if err != nil {
+				return nil, err
+			}
+			vms = append(vms, combinationVMs...)
+		}
+	} else {
+		var err error
+		vms, err = templateVMs(config, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := range vms {
+			if d.ParallelDeployments > 1 {
+				vms[i].count *= float64(d.ParallelDeployments)
+			}
+		}
+	}
+	return estimateCost(executor, d.ProjectID, vms, deploymentTestHours)
+}
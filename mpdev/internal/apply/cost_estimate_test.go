@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+const computeSKUsPage = `{"skus": [{
+  "description": "Preemptible N1 Predefined Instance Core running in Americas",
+  "category": {"resourceFamily": "Compute", "usageType": "Preemptible"},
+  "serviceRegions": ["us-central1"],
+  "pricingInfo": [{"pricingExpression": {"usageUnit": "h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 6655000}}]}}]
+}, {
+  "description": "N1 Predefined Instance Core running in Americas",
+  "category": {"resourceFamily": "Compute", "usageType": "OnDemand"},
+  "serviceRegions": ["us-central1", "us-east1"],
+  "pricingInfo": [{"pricingExpression": {"usageUnit": "h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 31611000}}]}}]
+}, {
+  "description": "N1 Predefined Instance Ram running in Americas",
+  "category": {"resourceFamily": "Compute", "usageType": "OnDemand"},
+  "serviceRegions": ["us-central1", "us-east1"],
+  "pricingInfo": [{"pricingExpression": {"usageUnit": "GiBy.h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 4237000}}]}}]
+}, {
+  "description": "Nvidia Tesla T4 GPU running in Americas",
+  "category": {"resourceFamily": "Compute", "usageType": "OnDemand"},
+  "serviceRegions": ["us-central1"],
+  "pricingInfo": [{"pricingExpression": {"usageUnit": "h", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 350000000}}]}}]
+}, {
+  "description": "Storage PD Capacity",
+  "category": {"resourceFamily": "Storage", "usageType": "OnDemand"},
+  "serviceRegions": ["us-central1"],
+  "pricingInfo": [{"pricingExpression": {"usageUnit": "GiBy.mo", "tieredRates": [{"unitPrice": {"units": "0", "nanos": 40000000}}]}}]
+}]}`
+
+const n1Standard4Output = `{"name": "n1-standard-4", "guestCpus": 4, "memoryMb": 15360}`
+
+// n1Standard4Cost is the cost of an hour of an n1-standard-4 with a 10 GB
+// standard disk in computeSKUsPage.
+const n1Standard4Cost = 4*0.031611 + 15*0.004237 + 10*0.04/730
+
+func TestTemplateVMs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"test_config.yaml": `imports:
+- path: solution.jinja
+- path: cluster.py
+resources:
+- name: solution
+  type: solution.jinja
+  properties:
+    zone: us-central1-a
+    bootDiskSizeGb: 50
+- name: cluster
+  type: cluster.py
+  properties:
+    zone: us-east1-b
+    tier0_machineType: n1-standard-1
+    tier0_instanceCount: 3
+- name: firewall
+  type: compute.v1.firewall
+  properties:
+    machineType: ignored
+`,
+		"solution.jinja.schema": `properties:
+  machineType:
+    type: string
+    default: e2-medium
+  bootDiskType:
+    default: pd-ssd
+  bootDiskSizeGb:
+    default: 10
+`,
+	})
+
+	vms, err := templateVMs(filepath.Join(dir, "test_config.yaml"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []vmUsage{
+		{count: 1, machineType: "e2-medium", zone: "us-central1-a", diskType: "pd-ssd", diskSizeGb: 50},
+		{count: 3, machineType: "n1-standard-1", zone: "us-east1-b", diskType: "pd-standard", diskSizeGb: 10},
+	}, vms)
+
+	overrides := matrixCombination{machineType: "n1-standard-4", accelerator: MatrixAccelerator{Type: "nvidia-tesla-t4", Count: 2}}.properties()
+	vms, err = templateVMs(filepath.Join(dir, "test_config.yaml"), overrides)
+	assert.NoError(t, err)
+	assert.Equal(t, vmUsage{count: 1, machineType: "n1-standard-4", zone: "us-central1-a", diskType: "pd-ssd", diskSizeGb: 50,
+		acceleratorType: "nvidia-tesla-t4", acceleratorCount: 2}, vms[0])
+}
+
+// fakeCostExecutor returns an executor answering the requests of a cost
+// estimate: the access token and SKUs of the billing catalog, and the
+// description of a machine type for each of describes.
+func fakeCostExecutor(fcmd *testingexec.FakeCmd, describes int) *testingexec.FakeExec {
+	stdouts := []string{"token", computeSKUsPage}
+	for i := 0; i < describes; i++ {
+		stdouts = append(stdouts, n1Standard4Output)
+	}
+	executor := &testingexec.FakeExec{}
+	for _, stdout := range stdouts {
+		stdout := stdout
+		fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return []byte(stdout), nil, nil })
+		executor.CommandScript = append(executor.CommandScript,
+			func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(fcmd, cmd, args...) })
+	}
+	return executor
+}
+
+func TestEstimateCost(t *testing.T) {
+	testCases := []struct {
+		name          string
+		vm            vmUsage
+		expectedCost  float64
+		expectedLines int
+		errorContains string
+	}{{
+		name:          "VM",
+		vm:            vmUsage{count: 2, machineType: "n1-standard-4", zone: "us-central1-a", diskType: "pd-standard", diskSizeGb: 10},
+		expectedCost:  2 * n1Standard4Cost,
+		expectedLines: 2,
+	}, {
+		name: "VM with GPUs",
+		vm: vmUsage{count: 1, machineType: "n1-standard-4", zone: "us-central1-a", diskType: "pd-standard", diskSizeGb: 10,
+			acceleratorType: "nvidia-tesla-t4", acceleratorCount: 2},
+		expectedCost:  n1Standard4Cost + 2*0.35,
+		expectedLines: 3,
+	}, {
+		name:          "No price in region",
+		vm:            vmUsage{count: 1, machineType: "n1-standard-4", zone: "europe-west1-b", diskType: "pd-standard", diskSizeGb: 10},
+		errorContains: "no on-demand price of n1-standard-4 cores in region europe-west1",
+	}, {
+		name:          "Unsupported disk",
+		vm:            vmUsage{count: 1, machineType: "n1-standard-4", zone: "us-central1-a", diskType: "hyperdisk", diskSizeGb: 10},
+		errorContains: "unsupported disk type hyperdisk",
+	}, {
+		name:          "Malformed zone",
+		vm:            vmUsage{count: 1, machineType: "n1-standard-4", zone: "us-central1", diskType: "pd-standard", diskSizeGb: 10},
+		errorContains: `invalid zone of machine type n1-standard-4: "us-central1"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			computeSKUs = nil
+			defer func() { computeSKUs = nil }()
+			fcmd := testingexec.FakeCmd{}
+			executor := fakeCostExecutor(&fcmd, 1)
+
+			lines, err := estimateCost(executor, "test-project", []vmUsage{tc.vm}, 1)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, lines, tc.expectedLines)
+			total := 0.0
+			for _, line := range lines {
+				total += line.cost
+			}
+			assert.InDelta(t, tc.expectedCost, total, 1e-9)
+			assert.Equal(t, "https://cloudbilling.googleapis.com/v1/services/6F81-5844-456A/skus?currencyCode=USD&pageSize=5000",
+				fcmd.RunLog[1][len(fcmd.RunLog[1])-1])
+			assert.Equal(t, []string{"gcloud", "compute", "machine-types", "describe", "n1-standard-4",
+				"--zone", "us-central1-a", "--project", "test-project", "--format", "json"}, fcmd.RunLog[2])
+		})
+	}
+}
+
+func TestDeploymentManagerDeploymentCost(t *testing.T) {
+	defer func(threshold float64, confirmed bool) { costThreshold, costConfirmed = threshold, confirmed }(costThreshold, costConfirmed)
+
+	dir, err := ioutil.TempDir("", "template")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "test_config.yaml")
+	writeFiles(t, dir, map[string]string{
+		"test_config.yaml": "resources:\n- name: solution\n  type: solution.jinja\n  properties:\n    zone: us-central1-a\n    machineType: n1-standard-4\n",
+	})
+
+	testCases := []struct {
+		name          string
+		threshold     float64
+		confirmed     bool
+		parallel      int
+		matrix        *DeploymentMatrix
+		describes     int
+		errorContains string
+	}{{
+		name:      "Below threshold",
+		threshold: 1,
+		describes: 1,
+	}, {
+		name:          "Parallel deployments above threshold",
+		threshold:     1,
+		parallel:      10,
+		describes:     1,
+		errorContains: "estimated cost $1.91 of deployment wordpress exceeds the threshold of $1.00. Pass --confirm-cost to create it",
+	}, {
+		name:          "Matrix above threshold",
+		threshold:     0.5,
+		matrix:        &DeploymentMatrix{Zones: []string{"us-central1-a", "us-central1-b", "us-central1-c"}},
+		describes:     3,
+		errorContains: "estimated cost $0.57 of deployment wordpress exceeds the threshold of $0.50",
+	}, {
+		name:          "Estimate failure",
+		threshold:     0.5,
+		matrix:        &DeploymentMatrix{Zones: []string{"us-central1"}},
+		errorContains: `failed to estimate the cost of deployment wordpress. Pass --confirm-cost to create it without an estimate: invalid zone of machine type n1-standard-4: "us-central1"`,
+	}, {
+		name:      "Estimate failure confirmed",
+		threshold: 0.5,
+		matrix:    &DeploymentMatrix{Zones: []string{"us-central1"}},
+		confirmed: true,
+	}, {
+		name:      "Confirmed",
+		threshold: 1,
+		parallel:  10,
+		confirmed: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			computeSKUs = nil
+			defer func() { computeSKUs = nil }()
+			assert.NoError(t, LimitCost(tc.threshold, tc.confirmed))
+			fcmd := testingexec.FakeCmd{}
+			executor := fakeCostExecutor(&fcmd, tc.describes)
+			d := &DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: tc.parallel, Matrix: tc.matrix}
+
+			err := d.checkCost(executor, config, "wordpress")
+			if tc.confirmed {
+				assert.NoError(t, err)
+				assert.Equal(t, 0, fcmd.RunCalls)
+				return
+			}
+			assert.Equal(t, len(fcmd.RunScript), fcmd.RunCalls)
+			if tc.errorContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, ExitUsage, ExitCode(err))
+			assert.Contains(t, err.Error(), tc.errorContains)
+		})
+	}
+
+	assert.Error(t, LimitCost(-1, false))
+	assert.NoError(t, LimitCost(0, false))
+	assert.Equal(t, DefaultCostThreshold, costThreshold)
+}
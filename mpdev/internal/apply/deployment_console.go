@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// displayMetadata is the part of the display metadata of a template, such
+// as solution.jinja.display, that the Cloud Console shows once a
+// deployment is created.
+type displayMetadata struct {
+	Runtime struct {
+		PrimaryButton struct {
+			Type   string `yaml:"type"`
+			Action string `yaml:"action"`
+		} `yaml:"primaryButton"`
+	} `yaml:"runtime"`
+}
+
+// outputReferenceRegex matches the references to deployment outputs in
+// display metadata, such as {{ outputs().vmExternalIP }}.
+var outputReferenceRegex = regexp.MustCompile(`\{\{\s*outputs\(\)\.(\w+)\s*\}\}`)
+
+// adminURL returns the URL of the primary button of the display metadata
+// of the main template in dir, which usually opens the admin panel of the
+// solution, with the outputs of the deployment substituted. It returns an
+// empty URL if there is no display metadata, if the button is not a URL, or
+// if it references other values than outputs.
+func adminURL(dir string, outputs map[string]string) (string, error) {
+	template, err := findMainTemplate(dir)
+	if err != nil {
+		return "", nil
+	}
+	b, err := ioutil.ReadFile(template + ".display")
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	var display displayMetadata
+	if err := yaml.Unmarshal(b, &display); err != nil {
+		return "", errors.Wrapf(err, "failed to parse %s.display", template)
+	}
+	button := display.Runtime.PrimaryButton
+	if button.Type != "TYPE_URL" || button.Action == "" {
+		return "", nil
+	}
+	resolved := true
+	url := outputReferenceRegex.ReplaceAllStringFunc(button.Action, func(ref string) string {
+		value, ok := outputs[outputReferenceRegex.FindStringSubmatch(ref)[1]]
+		resolved = resolved && ok
+		return value
+	})
+	if !resolved || strings.Contains(url, "{{") {
+		return "", nil
+	}
+	return url, nil
+}
+
+// passwordSpec is a password generated at deployment time, as declared in
+// the passwords of an autogen spec. Autogen sets the nth generated password
+// as the passwordN output of the deployment. length is 0 if the spec does
+// not set it, in which case autogen picks the length.
+type passwordSpec struct {
+	length            int
+	allowSpecialChars bool
+}
+
+// passwordSpecs returns the generated passwords of an autogen deployment
+// spec, in order.
+func passwordSpecs(spec map[string]interface{}) []passwordSpec {
+	var specs []passwordSpec
+	for _, vm := range findFields(spec, "singleVm", "single_vm", "multiVm", "multi_vm") {
+		passwords, _ := field(vm, "passwords").([]interface{})
+		for _, password := range passwords {
+			p, _ := password.(map[string]interface{})
+			length, _ := number(field(p, "length"))
+			special, _ := field(p, "allowSpecialChars", "allow_special_chars").(bool)
+			specs = append(specs, passwordSpec{length: int(length), allowSpecialChars: special})
+		}
+	}
+	return specs
+}
+
+var (
+	alphanumericRegex = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+	printableRegex    = regexp.MustCompile(`^[!-~]*$`)
+)
+
+// check returns an error if a generated password does not have the
+// properties of its spec. The password is not included in errors, which
+// are printed.
+func (p passwordSpec) check(name string, password string) error {
+	if p.length > 0 && len(password) != p.length {
+		return fmt.Errorf("generated password %s has %d characters, expected %d", name, len(password), p.length)
+	}
+	if !p.allowSpecialChars && !alphanumericRegex.MatchString(password) {
+		return fmt.Errorf("generated password %s contains special characters, but allowSpecialChars is not set", name)
+	}
+	if !printableRegex.MatchString(password) {
+		return fmt.Errorf("generated password %s contains whitespace or characters that are not printable ASCII", name)
+	}
+	return nil
+}
+
+// runConsoleChecks checks what the Cloud Console shows to customers once
+// the deployment is created: that the admin URL of the display metadata
+// of the template can be fetched, and that the generated passwords have the
+// length and characters of the autogen spec. Generated passwords that are
+// not outputs of the deployment, such as those not generated because of
+// their generateIf condition, are skipped.
+func (d *DeploymentManagerDeployment) runConsoleChecks(dmTemplate *DeploymentManagerAutogenTemplate, outputs map[string]string, record func(CheckSummary)) error {
+	var result error
+	url, err := adminURL(dmTemplate.outDir, outputs)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the admin URL of the template")
+	}
+	if url != "" {
+		fmt.Printf("Fetching admin URL %s of deployment\n", url)
+		// Admin panels commonly use self-signed certificates, and may
+		// still be starting once the waiter is signaled.
+		probe := Probe{Name: "admin-url", HTTP: &HTTPProbe{URL: url, Insecure: true}, Retries: 5, RetryInterval: "10s"}
+		start := time.Now()
+		err := probe.run(nil, d.ProjectID, outputs)
+		record(newCheckSummary("console/admin-url", start, err))
+		if err != nil {
+			result = multierror.Append(result, errors.Wrap(err, "admin URL check failed"))
+		}
+	}
+
+	for i, spec := range passwordSpecs(dmTemplate.Spec.DeploymentSpec) {
+		name := fmt.Sprintf("password%d", i)
+		password, ok := outputs[name]
+		if !ok {
+			fmt.Printf("Skipping check of generated password %s, which is not an output of the deployment\n", name)
+			continue
+		}
+		start := time.Now()
+		err := spec.check(name, password)
+		record(newCheckSummary("console/"+name, start, err))
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
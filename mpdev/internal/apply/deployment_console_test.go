@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// writeDisplayTemplate writes a main template to a temporary directory,
+// whose display metadata has display as its primary button.
+func writeDisplayTemplate(t *testing.T, display string) string {
+	dir, err := ioutil.TempDir("", "display")
+	assert.NoError(t, err)
+	for name, contents := range map[string]string{
+		"solution.jinja":         "resources: []\n",
+		"solution.jinja.schema":  "info: {}\n",
+		"solution.jinja.display": display,
+	} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+	return dir
+}
+
+func TestAdminURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		display  string
+		expected string
+	}{{
+		name: "Admin panel",
+		display: `runtime:
+  primaryButton:
+    label: Log into the admin panel
+    type: TYPE_URL
+    action: http://{{ outputs().vmExternalIP }}/wp-admin
+`,
+		expected: "http://203.0.113.10/wp-admin",
+	}, {
+		name: "SSH button",
+		display: `runtime:
+  primaryButton:
+    label: SSH
+    type: TYPE_GCE_VM_SSH
+    action: '{{ outputs().vmSelfLink }}'
+`,
+	}, {
+		name: "Property reference",
+		display: `runtime:
+  primaryButton:
+    type: TYPE_URL
+    action: https://{{ outputs().vmExternalIP }}:{{ properties().port }}/
+`,
+	}, {
+		name: "Unknown output",
+		display: `runtime:
+  primaryButton:
+    type: TYPE_URL
+    action: http://{{ outputs().loadBalancerIP }}/
+`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeDisplayTemplate(t, tc.display)
+			defer os.RemoveAll(dir)
+			url, err := adminURL(dir, map[string]string{"vmExternalIP": "203.0.113.10", "vmSelfLink": "projects/p/zones/z/instances/vm"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, url)
+		})
+	}
+}
+
+func TestPasswordSpecCheck(t *testing.T) {
+	var spec map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+singleVm:
+  passwords:
+  - metadataKey: admin-password
+    length: 8
+    username: admin
+  - metadataKey: db-password
+    length: 12
+    allowSpecialChars: true
+  - metadataKey: api-key
+`), &spec))
+	specs := passwordSpecs(spec)
+	assert.Equal(t, []passwordSpec{{length: 8}, {length: 12, allowSpecialChars: true}, {}}, specs)
+
+	assert.NoError(t, specs[0].check("password0", "aB3dE6gH"))
+	assert.EqualError(t, specs[0].check("password0", "aB3dE6g"), "generated password password0 has 7 characters, expected 8")
+	assert.EqualError(t, specs[0].check("password0", "aB3d#6gH"),
+		"generated password password0 contains special characters, but allowSpecialChars is not set")
+	assert.NoError(t, specs[1].check("password1", "aB3d#6gH!j@L"))
+	assert.EqualError(t, specs[1].check("password1", "aB3d 6gH!j@L"),
+		"generated password password1 contains whitespace or characters that are not printable ASCII")
+	assert.NoError(t, specs[2].check("password2", "aB3dE6gHiJ"), "the length is not checked when the spec does not set it")
+	assert.EqualError(t, specs[2].check("password2", "aB3d#6gH"),
+		"generated password password2 contains special characters, but allowSpecialChars is not set")
+}
+
+func TestRunConsoleChecks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/wp-admin" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dir := writeDisplayTemplate(t, `runtime:
+  primaryButton:
+    type: TYPE_URL
+    action: http://{{ outputs().vmExternalIP }}/wp-admin
+`)
+	defer os.RemoveAll(dir)
+
+	var spec map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+singleVm:
+  passwords:
+  - metadataKey: admin-password
+    length: 8
+  - metadataKey: phpmyadmin-password
+    length: 8
+    generateIf:
+      booleanDeployInputField: installphpmyadmin
+`), &spec))
+	autogen := &DeploymentManagerAutogenTemplate{Spec: AutogenSpec{DeploymentSpec: spec}, outDir: dir}
+	d := &DeploymentManagerDeployment{ProjectID: "test-project"}
+
+	var results []CheckSummary
+	record := func(result CheckSummary) { results = append(results, result) }
+	outputs := map[string]string{"vmExternalIP": strings.TrimPrefix(server.URL, "http://"), "password0": "aB3dE6gH"}
+	assert.NoError(t, d.runConsoleChecks(autogen, outputs, record))
+	assert.Len(t, results, 2)
+	assert.Equal(t, "console/admin-url", results[0].Name)
+	assert.Equal(t, "console/password0", results[1].Name)
+
+	results = nil
+	outputs["password0"] = "secret"
+	err := d.runConsoleChecks(autogen, outputs, record)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "generated password password0 has 6 characters, expected 8")
+	assert.NotContains(t, err.Error(), "secret")
+	assert.Equal(t, "failed", results[1].Status)
+}
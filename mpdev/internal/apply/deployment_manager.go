@@ -18,11 +18,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
 )
 
 // DeploymentManagerAutogenTemplate generates a deployment manager template
@@ -30,6 +33,10 @@ import (
 type DeploymentManagerAutogenTemplate struct {
 	BaseResource
 	Spec AutogenSpec
+	// InjectCredentials passes a short-lived access token of the active
+	// gcloud account to the autogen container, for autogen images that call
+	// Google Cloud, such as a wrapper reading inputs from Cloud Storage
+	InjectCredentials bool `yaml:"injectCredentials"`
 
 	outDir string
 }
@@ -70,7 +77,7 @@ type convertedSpec struct {
 func (dm *DeploymentManagerAutogenTemplate) Apply(registry Registry, dryRun bool) error {
 	err := dm.validateSpec()
 	if err != nil {
-		return err
+		return ValidationError(err)
 	}
 
 	if dryRun {
@@ -103,11 +110,34 @@ func (dm *DeploymentManagerAutogenTemplate) Apply(registry Registry, dryRun bool
 	}
 
 	err = dm.runAutogen(registry, inputDir)
-	return err
+	if err != nil {
+		return err
+	}
+	err = setOutputPermissions(dm.outDir)
+	if err != nil {
+		return err
+	}
+	err = checkSecrets(dm.outDir, "generated DM template")
+	if err != nil {
+		return err
+	}
+
+	warnings, err := checkGeneratedWaiter(dm.outDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to check waiter of generated template")
+	}
+	for _, warning := range warnings {
+		fmt.Printf("WARNING: %s\n", warning)
+	}
+	return nil
 }
 
+// DefaultAutogenImage is the container image that generates Deployment
+// Manager templates from autogen specs, unless the registry sets another one.
+const DefaultAutogenImage = "gcr.io/cloud-marketplace-tools/dm/autogen"
+
 func (dm *DeploymentManagerAutogenTemplate) runAutogen(registry Registry, inputDir string) error {
-	autogenImg := "gcr.io/cloud-marketplace-tools/dm/autogen"
+	autogenImg := registry.GetAutogenImage()
 	args := []string{"--input_type", "YAML", "--single_input", "/autogen/autogen.yaml",
 		"--output_type", "PACKAGE", "--output", "/tmp/out"}
 
@@ -120,16 +150,14 @@ func (dm *DeploymentManagerAutogenTemplate) runAutogen(registry Registry, inputD
 			&bindMount{src: inputDir, dst: "/autogen"},
 		},
 	)
-	cmd := cp.getCommand()
-	cmd.SetStderr(os.Stderr)
-	cmd.SetStdout(os.Stdout)
-
-	fmt.Printf("Executing autogen container: %s\n", autogenImg)
-	err := cmd.Run()
+	cp.credentials = dm.InjectCredentials
+	err := runWithProgress("Executing autogen container "+autogenImg, cp.run)
 	if err != nil {
 		return errors.Wrap(err, "failed to execute autogen container with docker")
 	}
 
+	// The output is kept when mpdev exits, since its path is printed.
+	util.KeepTmpDir(dm.outDir)
 	fmt.Printf("Wrote autogen output to directory: %s\n", dm.outDir)
 
 	return nil
@@ -175,19 +203,82 @@ func (dm *DeploymentManagerAutogenTemplate) validateSpec() error {
 	if len(dm.Spec.DeploymentSpec) == 0 {
 		return fmt.Errorf("no deploymentSpec contents. Ensure spec.deploymentSpec in config file is set")
 	}
+
+	for _, warning := range checkWaiterSpec(dm.Spec.DeploymentSpec) {
+		fmt.Printf("WARNING: %s\n", warning)
+	}
 	return nil
 }
 
 // DeploymentManagerTemplate saves a referenced Deployment Manager
-// template to GCS or the local filesystem
+// template to GCS or the local filesystem. The template is not archived or
+// saved again if neither its contents nor its destinations changed since
+// the last apply recorded in the state file.
 type DeploymentManagerTemplate struct {
 	BaseResource
 	DeploymentManagerRef Reference
 	// Uploads to gcs if file path prefixed with "gs://". Otherwise will
-	// zip to given local file path.
-	ZipFilePath string
+	// zip to given local file path. Either a single path or a list of paths,
+	// in which case the template is saved to every path.
+	ZipFilePath StringList
+	// ArchiveFormat is the format of the archive written to ZipFilePath.
+	// One of "zip" (default) or "tgz".
+	ArchiveFormat string
+	// SignedURL optionally generates a time-limited signed URL for the
+	// package after it is uploaded to GCS.
+	SignedURL *SignedURLOptions `json:"signedUrl"`
+	// SizeLimit configures how the size of the archive is checked against
+	// the Marketplace package size limit.
+	SizeLimit SizeLimitOptions
+	// KMSKey is the resource name of a Cloud KMS key used to encrypt the
+	// objects uploaded to GCS, in the format
+	// projects/PROJECT/locations/LOCATION/keyRings/KEYRING/cryptoKeys/KEY.
+	// If empty, the default encryption of the bucket is used.
+	KMSKey string `json:"kmsKey"`
+	// ZipRoot is a directory of the template, relative to its root, whose
+	// contents are placed at the root of the archive. Files outside of
+	// ZipRoot are not archived. Defaults to the root of the template.
+	ZipRoot string
+	// StripPrefix is a directory, relative to ZipRoot, that is removed from
+	// the paths of the files it contains when they are archived. Files
+	// outside of StripPrefix keep their path.
+	StripPrefix string
+	// LicenseCheck, if set, fails the apply if the package bundles content,
+	// such as third-party scripts and binaries, whose license conflicts
+	// with the license of the solution.
+	LicenseCheck *LicenseCheckOptions
+}
+
+// kmsKeyRegex matches the resource name of a Cloud KMS key.
+var kmsKeyRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// SizeLimitOptions configures the check of an archive's size.
+type SizeLimitOptions struct {
+	// MaxBytes is the maximum size of the archive. Defaults to the
+	// Marketplace limit of 10MiB.
+	MaxBytes int64
+	// Enforce fails the apply when the archive exceeds MaxBytes. Otherwise
+	// only a warning is printed.
+	Enforce bool
+}
+
+// SignedURLOptions configures the signed URL generated for a package that
+// was uploaded to GCS.
+type SignedURLOptions struct {
+	// Duration the URL is valid for, using the gsutil signurl format
+	// (e.g. 10m, 1h or 7d). Defaults to 1h.
+	Duration string
+	// PrivateKeyFile is a service account key file used to sign the URL.
+	// If empty, the URL is signed using the active service account
+	// credentials.
+	PrivateKeyFile string
 }
 
+const (
+	zipArchiveFormat = "zip"
+	tgzArchiveFormat = "tgz"
+)
+
 // GetDependencies returns dependencies for DeploymentManagerTemplate
 func (dm *DeploymentManagerTemplate) GetDependencies() (r []Reference) {
 	r = append(r, dm.DeploymentManagerRef)
@@ -196,57 +287,439 @@ func (dm *DeploymentManagerTemplate) GetDependencies() (r []Reference) {
 
 // Apply uploads a Deployment Manager template to GCS.
 func (dm *DeploymentManagerTemplate) Apply(registry Registry, dryRun bool) error {
-	dmRef := registry.GetResource(dm.DeploymentManagerRef)
-	if dmRef == nil {
-		return fmt.Errorf("autogen template not found %+v", dm.DeploymentManagerRef)
+	dmTemplate, err := getAutogenTemplate(registry, dm.DeploymentManagerRef)
+	if err != nil {
+		return err
 	}
 
-	dmTemplate, ok := dmRef.(*DeploymentManagerAutogenTemplate)
-	if !ok {
-		return fmt.Errorf("referenced autogen template is not correct type %+v", dm.DeploymentManagerRef)
+	if len(dm.ZipFilePath) == 0 {
+		return errors.New("ZipFilePath cannot be empty for DM template")
 	}
 
-	if dm.ZipFilePath == "" {
-		return errors.New("ZipFilePath cannot be empty for DM template")
+	hasGCSPath := false
+	for _, path := range dm.ZipFilePath {
+		if path == "" {
+			return errors.New("ZipFilePath cannot contain an empty path for DM template")
+		}
+		hasGCSPath = hasGCSPath || isGCSPath(path)
+	}
+
+	format := dm.ArchiveFormat
+	if format == "" {
+		format = zipArchiveFormat
+	}
+	if format != zipArchiveFormat && format != tgzArchiveFormat {
+		return fmt.Errorf("unsupported archiveFormat: %s. Must be one of %s or %s", dm.ArchiveFormat, zipArchiveFormat, tgzArchiveFormat)
+	}
+
+	if dm.SignedURL != nil && !hasGCSPath {
+		return fmt.Errorf("signedUrl can only be set when zipFilePath contains a GCS path: %v", dm.ZipFilePath)
+	}
+
+	for name, path := range map[string]string{"zipRoot": dm.ZipRoot, "stripPrefix": dm.StripPrefix} {
+		p := filepath.Clean(path)
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s must be a relative path inside the DM template: %s", name, path)
+		}
+	}
+
+	if dm.KMSKey != "" {
+		if !hasGCSPath {
+			return fmt.Errorf("kmsKey can only be set when zipFilePath contains a GCS path: %v", dm.ZipFilePath)
+		}
+		if !kmsKeyRegex.MatchString(dm.KMSKey) {
+			return fmt.Errorf("invalid kmsKey: %s. Must be in the format projects/PROJECT/locations/LOCATION/keyRings/KEYRING/cryptoKeys/KEY", dm.KMSKey)
+		}
+	}
+
+	if dm.LicenseCheck != nil {
+		if err := dm.LicenseCheck.validate(); err != nil {
+			return ValidationError(err)
+		}
 	}
 
 	if dryRun {
 		return nil
 	}
 
+	// The template is archived once, to the first local path if there is one,
+	// and then copied to every other destination.
 	var localZipPath string
-	isGCSUpload := strings.HasPrefix(dm.ZipFilePath, "gs://")
-	if isGCSUpload {
-		localZipPath = filepath.Join(dmTemplate.outDir, "dm_template.zip")
-	} else {
-		var err error
-		localZipPath, err = registry.ResolveFilePath(dm, dm.ZipFilePath)
+	destinations := make([]string, len(dm.ZipFilePath))
+	for i, path := range dm.ZipFilePath {
+		destinations[i] = path
+		if isGCSPath(path) {
+			continue
+		}
+
+		resolved, err := registry.ResolveFilePath(dm, path)
 		if err != nil {
-			return errors.Wrapf(err, "failed to resolve path to zipFile: %s", dm.ZipFilePath)
+			return errors.Wrapf(err, "failed to resolve path to zipFile: %s", path)
+		}
+		if localZipPath == "" {
+			localZipPath = resolved
 		}
+		destinations[i] = resolved
+	}
+	if localZipPath == "" {
+		localZipPath = filepath.Join(dmTemplate.outDir, "dm_template."+format)
+	}
+
+	packageDir, err := stagePackage(dmTemplate.outDir, dm.ZipRoot, dm.StripPrefix)
+	if err != nil {
+		return errors.Wrap(err, "failed to arrange contents of DM template")
+	}
+	if packageDir != dmTemplate.outDir {
+		defer os.RemoveAll(packageDir)
+	}
+
+	err = checkPackageContents(packageDir)
+	if err != nil {
+		return err
+	}
+	warnings, err := checkTemplateSchema(packageDir)
+	for _, warning := range warnings {
+		fmt.Printf("WARNING: DM template in %s: %s\n", packageDir, warning)
+	}
+	if err != nil {
+		return err
+	}
+	if dm.LicenseCheck != nil {
+		err = dm.LicenseCheck.check(packageDir, "DM template")
+		if err != nil {
+			return err
+		}
+	}
+
+	contentHash, err := hashPackage(packageDir,
+		[]string{localZipPath, localZipPath + manifestSuffix},
+		append([]string{format, dm.KMSKey}, dm.ZipFilePath...)...)
+	if err != nil {
+		return errors.Wrap(err, "failed to hash DM template")
+	}
+	if dm.isUnchanged(registry, contentHash, destinations) {
+		fmt.Printf("DM template unchanged since last apply. Skipping archive and upload\n")
+		return dm.reportUnchanged(registry, destinations)
 	}
 
 	executor := registry.GetExecutor()
-	err := util.ZipDirectory(executor, localZipPath, dmTemplate.outDir)
+	err = archiveDirectory(executor, format, localZipPath, packageDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to archive DM template to %s", localZipPath)
+	}
+	fmt.Printf("DM template archived to %s\n", localZipPath)
+
+	err = dm.checkSize(registry, localZipPath, packageDir)
 	if err != nil {
-		return errors.Wrapf(err, "failed to zip DM template to %s", localZipPath)
+		return err
 	}
-	fmt.Printf("DM template zipped to %s\n", localZipPath)
 
-	if isGCSUpload {
-		cmd := executor.Command("gsutil", "cp", localZipPath, dm.ZipFilePath)
-		cmd.SetStdout(os.Stdout)
-		cmd.SetStderr(os.Stderr)
+	manifestPath := localZipPath + manifestSuffix
+	err = writePackageManifest(manifestPath, localZipPath, packageDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to write manifest of DM template")
+	}
+	fmt.Printf("DM template manifest written to %s\n", manifestPath)
+	registry.SetOutput(dm, "manifest", manifestPath)
+
+	results := make([]destinationResult, 0, len(destinations))
+	for i, path := range destinations {
+		err := dm.saveToDestination(registry, localZipPath, path)
+		if err == nil && isGCSPath(path) && dm.SignedURL != nil {
+			var signedURL string
+			signedURL, err = dm.signURL(registry, path)
+			if err == nil {
+				fmt.Printf("Signed URL for DM template: %s\n", signedURL)
+				registry.SetOutput(dm, outputName("signedUrl", i, len(destinations)), signedURL)
+			}
+		}
 
-		fmt.Printf("Uploading DM template to GCS from:%s to:%s\n", localZipPath, dm.ZipFilePath)
+		if err == nil {
+			registry.SetOutput(dm, outputName("zipFilePath", i, len(destinations)), path)
+		}
+		results = append(results, destinationResult{path: path, err: err})
+	}
+
+	err = reportDestinations(results)
+	if err == nil {
+		registry.SetState(dm, contentHashState, contentHash)
+	}
+	return err
+}
+
+// contentHashState is the state key of the hash of the template and
+// destinations that were last saved successfully.
+const contentHashState = "contentHash"
+
+// isUnchanged returns true if the template was already saved to all
+// destinations by a previous apply and has not changed since.
+func (dm *DeploymentManagerTemplate) isUnchanged(registry Registry, contentHash string, destinations []string) bool {
+	if registry.GetState(dm, contentHashState) != contentHash {
+		return false
+	}
+	for _, path := range destinations {
+		if isGCSPath(path) {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
 
-		err = cmd.Run()
+// reportUnchanged records the outputs of a template that was saved by a
+// previous apply. Signed URLs are regenerated since they expire.
+func (dm *DeploymentManagerTemplate) reportUnchanged(registry Registry, destinations []string) error {
+	for i, path := range destinations {
+		if isGCSPath(path) && dm.SignedURL != nil {
+			signedURL, err := dm.signURL(registry, path)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Signed URL for DM template: %s\n", signedURL)
+			registry.SetOutput(dm, outputName("signedUrl", i, len(destinations)), signedURL)
+		}
+		registry.SetOutput(dm, outputName("zipFilePath", i, len(destinations)), path)
+	}
+	return nil
+}
+
+// saveToDestination uploads or copies the archive and its manifest to path.
+func (dm *DeploymentManagerTemplate) saveToDestination(registry Registry, localZipPath string, path string) error {
+	if isGCSPath(path) {
+		err := dm.upload(registry, localZipPath, path)
 		if err != nil {
-			return errors.Wrap(err, "failed to copy DM template to GCS")
+			return err
+		}
+		err = dm.copyToGCS(registry.GetExecutor(), "", localZipPath+manifestSuffix, path+manifestSuffix)
+		return errors.Wrapf(err, "failed to copy DM template manifest to GCS path: %s", path+manifestSuffix)
+	}
+
+	if path != localZipPath {
+		for _, suffix := range []string{"", manifestSuffix} {
+			err := util.CopyFile(localZipPath+suffix, path+suffix)
+			if err != nil {
+				return errors.Wrapf(err, "failed to copy DM template to %s", path+suffix)
+			}
+		}
+		fmt.Printf("DM template copied to %s\n", path)
+	}
+	return setOutputPermissions(path, path+manifestSuffix)
+}
+
+func (dm *DeploymentManagerTemplate) checkSize(registry Registry, archive string, dir string) error {
+	size, err := analyzePackageSize(archive, dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to analyze size of DM template")
+	}
+
+	limit := dm.SizeLimit.MaxBytes
+	if limit <= 0 {
+		limit = defaultPackageSizeLimit
+	}
+	size.report(limit)
+	registry.SetOutput(dm, "archiveSizeBytes", fmt.Sprint(size.archiveBytes))
+
+	if size.archiveBytes <= limit {
+		return nil
+	}
+	if dm.SizeLimit.Enforce {
+		return fmt.Errorf("DM template archive size %s exceeds limit %s", formatBytes(size.archiveBytes), formatBytes(limit))
+	}
+	fmt.Printf("WARNING: DM template archive size %s exceeds limit %s. Marketplace will reject the package\n",
+		formatBytes(size.archiveBytes), formatBytes(limit))
+	return nil
+}
+
+// getAutogenTemplate returns the DeploymentManagerAutogenTemplate with the
+// given reference.
+func getAutogenTemplate(registry Registry, ref Reference) (*DeploymentManagerAutogenTemplate, error) {
+	dmRef := registry.GetResource(ref)
+	if dmRef == nil {
+		return nil, fmt.Errorf("autogen template not found %+v", ref)
+	}
+
+	dmTemplate, ok := dmRef.(*DeploymentManagerAutogenTemplate)
+	if !ok {
+		return nil, fmt.Errorf("referenced autogen template is not correct type %+v", ref)
+	}
+	return dmTemplate, nil
+}
+
+func isGCSPath(path string) bool {
+	return strings.HasPrefix(path, "gs://")
+}
+
+type destinationResult struct {
+	path string
+	err  error
+}
+
+// reportDestinations prints whether the template was saved to each
+// destination and returns the accumulated errors of failed destinations.
+func reportDestinations(results []destinationResult) error {
+	var err error
+	if len(results) > 1 {
+		fmt.Printf("DM template destinations:\n")
+	}
+	for _, result := range results {
+		if result.err != nil {
+			err = multierror.Append(err, result.err)
+		}
+		if len(results) == 1 {
+			continue
+		}
+		if result.err != nil {
+			fmt.Printf("  %s: failed: %v\n", result.path, result.err)
+		} else {
+			fmt.Printf("  %s: succeeded\n", result.path)
 		}
+	}
+	return err
+}
 
-		fmt.Printf("Uploaded DM template to GCS path: %s\n", dm.ZipFilePath)
+// outputName returns name if a resource produces a single output of that
+// kind, or name suffixed with the index otherwise.
+func outputName(name string, index int, total int) string {
+	if total == 1 {
+		return name
 	}
+	return fmt.Sprintf("%s[%d]", name, index)
+}
 
+func (dm *DeploymentManagerTemplate) upload(registry Registry, localZipPath string, gcsPath string) error {
+	description := fmt.Sprintf("Uploading DM template to GCS from:%s to:%s", localZipPath, gcsPath)
+	err := dm.copyToGCS(registry.GetExecutor(), description, localZipPath, gcsPath)
+	if err != nil {
+		return errors.Wrapf(err, "failed to copy DM template to GCS path: %s", gcsPath)
+	}
+
+	fmt.Printf("Uploaded DM template to GCS path: %s\n", gcsPath)
 	return nil
 }
+
+// copyToGCS copies the file src to the GCS path dst, encrypting dst with the
+// configured KMS key, with gsutil or with the Cloud Storage JSON API if
+// native tools are used. If description is set, the copy is a long command
+// described by it.
+func (dm *DeploymentManagerTemplate) copyToGCS(executor exec.Interface, description string, src string, dst string) error {
+	if useNativeTools {
+		if description != "" {
+			fmt.Println(description)
+		}
+		return uploadToGCS(executor, src, dst, dm.KMSKey)
+	}
+	if description != "" {
+		return runLongCommand(executor, description, "gsutil", dm.gsutilCopyArgs(src, dst)...)
+	}
+	return runCommand(executor, "gsutil", dm.gsutilCopyArgs(src, dst)...)
+}
+
+// gsutilCopyArgs returns the gsutil arguments to copy src to dst, encrypting
+// dst with the configured KMS key.
+func (dm *DeploymentManagerTemplate) gsutilCopyArgs(src string, dst string) []string {
+	var args []string
+	if dm.KMSKey != "" {
+		args = append(args, "-o", "GSUtil:encryption_key="+dm.KMSKey)
+	}
+	return append(args, "cp", src, dst)
+}
+
+func (dm *DeploymentManagerTemplate) signURL(registry Registry, gcsPath string) (string, error) {
+	duration := dm.SignedURL.Duration
+	if duration == "" {
+		duration = "1h"
+	}
+
+	args := []string{"signurl", "-d", duration}
+	if dm.SignedURL.PrivateKeyFile == "" {
+		args = append(args, "-u")
+	} else {
+		keyFile, err := registry.ResolveFilePath(dm, dm.SignedURL.PrivateKeyFile)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve path to privateKeyFile: %s", dm.SignedURL.PrivateKeyFile)
+		}
+		args = append(args, keyFile)
+	}
+	args = append(args, gcsPath)
+
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gsutil", args...)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to generate signed URL for %s", gcsPath)
+	}
+
+	return parseSignedURL(string(stdout))
+}
+
+// parseSignedURL extracts the URL from the table printed by `gsutil signurl`.
+// The signed URL is the last tab separated column of the last row.
+func parseSignedURL(output string) (string, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	columns := strings.Split(lines[len(lines)-1], "\t")
+	signedURL := strings.TrimSpace(columns[len(columns)-1])
+	if !strings.HasPrefix(signedURL, "https://") {
+		return "", fmt.Errorf("unable to parse signed URL from gsutil output: %s", output)
+	}
+	return signedURL, nil
+}
+
+func archiveDirectory(executor exec.Interface, format string, archiveFile string, directory string) error {
+	if format == tgzArchiveFormat {
+		return util.TarGzDirectory(executor, archiveFile, directory)
+	}
+	if useNativeTools {
+		return util.ZipDirectoryNative(archiveFile, directory)
+	}
+	return util.ZipDirectory(executor, archiveFile, directory)
+}
+
+// stagePackage returns a directory laid out as the archive of the template
+// in dir should be, given the zipRoot and stripPrefix options. If neither is
+// set, dir itself is returned. Otherwise the files are copied to a new
+// temporary directory, which the caller must remove.
+func stagePackage(dir string, zipRoot string, stripPrefix string) (string, error) {
+	if zipRoot == "" && stripPrefix == "" {
+		return dir, nil
+	}
+
+	root := filepath.Join(dir, zipRoot)
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", errors.Wrapf(err, "zipRoot %s not found in DM template", zipRoot)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("zipRoot %s is not a directory", zipRoot)
+	}
+
+	stagingDir, err := util.CreateTmpDir("dmpackage")
+	if err != nil {
+		return "", err
+	}
+
+	prefix := filepath.Clean(stripPrefix)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if stripPrefix != "" && strings.HasPrefix(rel, prefix+string(filepath.Separator)) {
+			rel = strings.TrimPrefix(rel, prefix+string(filepath.Separator))
+		}
+
+		dst := filepath.Join(stagingDir, rel)
+		if _, err := os.Stat(dst); err == nil {
+			return fmt.Errorf("stripping %s from %s conflicts with another file at %s", stripPrefix, path, rel)
+		}
+		return util.CopyFile(path, dst)
+	})
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return "", err
+	}
+	return stagingDir, nil
+}
@@ -0,0 +1,384 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// DeploymentManagerDeployment creates a deployment from a generated Deployment
+// Manager template in a test project, runs checks against the deployment and
+// then deletes it. Deployment outputs are recorded as outputs of the resource.
+type DeploymentManagerDeployment struct {
+	BaseResource
+	DeploymentManagerRef Reference
+	// ProjectID of the test project the deployment is created in
+	ProjectID string `json:"projectId"`
+	// DeploymentName of the deployment. Defaults to the resource name.
+	DeploymentName string
+	// ConfigFile is the deployment configuration, relative to the root of
+	// the template. Defaults to test_config.yaml
+	ConfigFile string
+	// KeepDeployment skips deleting the deployment after the checks are run,
+	// which can be useful for debugging failed checks.
+	KeepDeployment bool
+	// Checks are scripts executed after the deployment is created. The
+	// deployment name, project and outputs are passed to the scripts as
+	// environment variables. For example, the vmSelfLink output is passed as
+	// DEPLOYMENT_OUTPUT_VMSELFLINK.
+	Checks []DeploymentCheck
+	// TestRefs are DeploymentTest resources whose probes are run against
+	// the deployment after the checks.
+	TestRefs []Reference
+	// ServicePerimeter optionally verifies that the solution works inside a
+	// VPC Service Controls perimeter, such as
+	// accessPolicies/123/servicePerimeters/test. The test project must be
+	// protected by the perimeter, either enforced or in dry run mode. API
+	// calls blocked by the perimeter while the deployment is created and
+	// checked are reported as errors.
+	ServicePerimeter string
+	// SkipConsoleChecks skips fetching the admin URL shown by the Cloud
+	// Console once the deployment is created, and checking that the
+	// generated passwords have the length and characters of the autogen
+	// spec, such as for deployments without an external IP address
+	SkipConsoleChecks bool
+	// EnforceConsoleChecks fails the deployment when the console checks
+	// fail, which are otherwise reported as warnings
+	EnforceConsoleChecks bool
+	// SimulateWaiterFailure verifies the failure that customers see when a
+	// VM never signals the waiter, instead of running the checks. The
+	// status-variable-path metadata of the VMs is overridden such that the
+	// startup script signals a variable the waiter does not watch, and the
+	// deployment must fail within the waiterTimeoutSecs of the autogen spec.
+	SimulateWaiterFailure bool
+	// ExpectedWaiterError is a regular expression that the error of a
+	// simulated waiter failure must match. Defaults to waiter timeouts.
+	ExpectedWaiterError string
+	// Matrix optionally creates a deployment for every combination of its
+	// machine types, zones and accelerators, such as non-default machine
+	// types that reviewers test, and runs the checks and tests against
+	// each of them
+	Matrix *DeploymentMatrix
+	// ParallelDeployments optionally creates that many deployments of the
+	// template at the same time instead of running the checks, and fails
+	// if any of them fails, such as for firewall rules or addresses with
+	// names that are hard-coded instead of derived from the deployment name
+	ParallelDeployments int
+
+	// results of the checks and probes of the last apply
+	results []CheckSummary
+}
+
+// DeploymentCheck is a script run against a deployment. The check fails if
+// the script exits with a non-zero status.
+type DeploymentCheck struct {
+	Name   string
+	Script struct {
+		File string
+	}
+}
+
+// GetDependencies returns dependencies for DeploymentManagerDeployment
+func (d *DeploymentManagerDeployment) GetDependencies() (r []Reference) {
+	r = append(r, d.DeploymentManagerRef)
+	r = append(r, d.TestRefs...)
+	return r
+}
+
+// Apply creates a deployment, waits for it to complete, runs the console
+// checks and the configured checks and deletes the deployment. With
+// SimulateWaiterFailure, it instead checks that the deployment fails, and
+// with ParallelDeployments that concurrent deployments do not collide.
+func (d *DeploymentManagerDeployment) Apply(registry Registry, dryRun bool) (err error) {
+	dmTemplate, err := getAutogenTemplate(registry, d.DeploymentManagerRef)
+	if err != nil {
+		return err
+	}
+
+	name := deploymentName(d.DeploymentName, d.Metadata.Name)
+	err = validateDeploymentTarget(d.ProjectID, name)
+	if err != nil {
+		return err
+	}
+
+	if d.ServicePerimeter != "" {
+		err = validateServicePerimeter(d.ServicePerimeter)
+		if err != nil {
+			return err
+		}
+	}
+
+	checkFiles := make([]string, 0, len(d.Checks))
+	for _, check := range d.Checks {
+		if check.Script.File == "" {
+			return fmt.Errorf("script file not specified for check: %s", check.Name)
+		}
+		file, err := registry.ResolveFilePath(d, check.Script.File)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve path to script of check: %s", check.Name)
+		}
+		checkFiles = append(checkFiles, file)
+	}
+
+	tests := make([]*DeploymentTest, 0, len(d.TestRefs))
+	for _, ref := range d.TestRefs {
+		test, err := getDeploymentTest(registry, ref)
+		if err != nil {
+			return err
+		}
+		tests = append(tests, test)
+	}
+
+	var timeout time.Duration
+	if d.SimulateWaiterFailure {
+		var ok bool
+		timeout, ok = waiterTimeout(dmTemplate.Spec.DeploymentSpec)
+		if !ok {
+			return fmt.Errorf("simulateWaiterFailure is set, but the autogen spec of %s has no waiter with a waiterTimeoutSecs", d.DeploymentManagerRef.Name)
+		}
+		if _, err := d.expectedWaiterError(); err != nil {
+			return err
+		}
+	}
+
+	if d.Matrix != nil {
+		if d.SimulateWaiterFailure {
+			return errors.New("simulateWaiterFailure cannot be combined with matrix")
+		}
+		err = d.Matrix.validate(d.ProjectID, name)
+		if err != nil {
+			return ValidationError(err)
+		}
+	}
+
+	if d.ParallelDeployments != 0 {
+		err = d.validateParallelDeployments(name)
+		if err != nil {
+			return ValidationError(err)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+	d.results = nil
+
+	configFile := d.ConfigFile
+	if configFile == "" {
+		configFile = "test_config.yaml"
+	}
+
+	executor := registry.GetExecutor()
+	err = d.checkCost(executor, filepath.Join(dmTemplate.outDir, configFile), name)
+	if err != nil {
+		return err
+	}
+	if d.ServicePerimeter != "" {
+		err = checkProjectInPerimeter(executor, d.ProjectID, d.ServicePerimeter)
+		if err != nil {
+			return err
+		}
+	}
+	// The deployments of a matrix are deleted once each is checked, and
+	// parallel deployments once all of them complete.
+	if d.Matrix == nil && d.ParallelDeployments == 0 && !d.KeepDeployment {
+		defer func() {
+			if deleteErr := d.deleteDeployment(executor, name); deleteErr != nil {
+				err = multierror.Append(err, deleteErr)
+			}
+		}()
+	}
+	if d.ServicePerimeter != "" {
+		// Violations are reported before the deployment is deleted, so
+		// that calls made while deleting it are not included.
+		start := now()
+		defer func() {
+			violationErr := d.checkPerimeterViolations(executor, start)
+			if violationErr != nil {
+				err = multierror.Append(err, violationErr)
+			}
+		}()
+	}
+
+	if d.Matrix != nil {
+		return d.runMatrix(registry, dmTemplate, name, configFile, checkFiles, tests)
+	}
+	if d.ParallelDeployments != 0 {
+		return d.runParallel(executor, name, filepath.Join(dmTemplate.outDir, configFile))
+	}
+	if d.SimulateWaiterFailure {
+		return d.simulateWaiterFailure(executor, dmTemplate, name, configFile, timeout)
+	}
+	record := func(result CheckSummary) { d.results = append(d.results, result) }
+	return d.deploy(registry, dmTemplate, name, filepath.Join(dmTemplate.outDir, configFile), checkFiles, tests, record)
+}
+
+// deploy creates a deployment from config and runs the console checks, the
+// checks and the deployment tests against it. The results of the checks are
+// passed to record.
+func (d *DeploymentManagerDeployment) deploy(registry Registry, dmTemplate *DeploymentManagerAutogenTemplate, name string, config string,
+	checkFiles []string, tests []*DeploymentTest, record func(CheckSummary)) error {
+	executor := registry.GetExecutor()
+	// gcloud waits for the deployment, including its waiter, to complete.
+	fmt.Printf("Creating deployment %s in project %s\n", name, d.ProjectID)
+	err := runCommand(executor, "gcloud", "deployment-manager", "deployments", "create", name,
+		"--config", config, "--project", d.ProjectID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create deployment %s", name)
+	}
+
+	outputs, err := d.getOutputs(registry, name)
+	if err != nil {
+		return err
+	}
+
+	env := append(os.Environ(), "DEPLOYMENT_NAME="+name, "DEPLOYMENT_PROJECT="+d.ProjectID)
+	vars := map[string]string{"DEPLOYMENT_NAME": name, "DEPLOYMENT_PROJECT": d.ProjectID}
+	for outputName, value := range outputs {
+		registry.SetOutput(d, outputName, value)
+		env = append(env, fmt.Sprintf("%s=%s", outputEnvName(outputName), value))
+		vars[outputName] = value
+	}
+
+	var checkErr error
+	if !d.SkipConsoleChecks {
+		if err := d.runConsoleChecks(dmTemplate, outputs, record); err != nil && d.EnforceConsoleChecks {
+			checkErr = multierror.Append(checkErr, err)
+		} else if err != nil {
+			fmt.Printf("WARNING: console checks of deployment %s failed: %v\n", name, err)
+		}
+	}
+	for i, check := range d.Checks {
+		fmt.Printf("Running check %s against deployment %s\n", check.Name, name)
+		cmd := executor.Command("bash", checkFiles[i])
+		cmd.SetEnv(env)
+		cmd.SetStdout(os.Stdout)
+		cmd.SetStderr(os.Stderr)
+		start := time.Now()
+		err := cmd.Run()
+		record(newCheckSummary(check.Name, start, err))
+		if err != nil {
+			checkErr = multierror.Append(checkErr, errors.Wrapf(err, "check %s failed", check.Name))
+		}
+	}
+	for _, test := range tests {
+		if err := test.run(executor, d.ProjectID, vars, record); err != nil {
+			checkErr = multierror.Append(checkErr, errors.Wrapf(err, "deployment test %s failed", test.Metadata.Name))
+		}
+	}
+	if checkErr != nil {
+		return checkErr
+	}
+
+	fmt.Printf("All checks passed for deployment %s\n", name)
+	return nil
+}
+
+// deleteDeployment deletes the deployment named name.
+func (d *DeploymentManagerDeployment) deleteDeployment(executor exec.Interface, name string) error {
+	fmt.Printf("Deleting deployment %s\n", name)
+	err := runCommand(executor, "gcloud", "deployment-manager", "deployments", "delete", name,
+		"--project", d.ProjectID, "--quiet")
+	return errors.Wrapf(err, "failed to delete deployment %s", name)
+}
+
+func (d *DeploymentManagerDeployment) checkResults() []CheckSummary {
+	return d.results
+}
+
+func (d *DeploymentManagerDeployment) checkPerimeterViolations(executor exec.Interface, start time.Time) error {
+	fmt.Printf("Checking VPC Service Controls audit logs of project %s\n", d.ProjectID)
+	violations, err := perimeterViolations(executor, d.ProjectID, start)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("API calls blocked by service perimeter %s:\n  - %s", d.ServicePerimeter, strings.Join(violations, "\n  - "))
+	}
+	return nil
+}
+
+type deploymentDescription struct {
+	Outputs []struct {
+		Name       string
+		FinalValue interface{} `json:"finalValue"`
+	}
+}
+
+func (d *DeploymentManagerDeployment) getOutputs(registry Registry, name string) (map[string]string, error) {
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gcloud", "deployment-manager", "deployments", "describe", name,
+		"--project", d.ProjectID, "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe deployment %s", name)
+	}
+
+	var description deploymentDescription
+	err = json.Unmarshal(stdout, &description)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse description of deployment %s", name)
+	}
+
+	outputs := map[string]string{}
+	for _, output := range description.Outputs {
+		outputs[output.Name] = fmt.Sprint(output.FinalValue)
+	}
+	return outputs, nil
+}
+
+var nonAlphanumericRegex = regexp.MustCompile(`[^A-Za-z0-9]`)
+
+// outputEnvName returns the environment variable a deployment output is
+// passed to checks as.
+func outputEnvName(outputName string) string {
+	return "DEPLOYMENT_OUTPUT_" + strings.ToUpper(nonAlphanumericRegex.ReplaceAllString(outputName, "_"))
+}
+
+// copyTemplate copies the Deployment Manager template in src to dst, such
+// that the copy can be modified while other resources read the template.
+// The contents of each file are passed through rewrite, if set.
+func copyTemplate(src string, dst string, rewrite func(path string, contents []byte) []byte) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if rewrite != nil {
+			contents = rewrite(path, contents)
+		}
+		return ioutil.WriteFile(target, contents, info.Mode())
+	})
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+var describeOutput = `{
+  "deployment": {"name": "wordpress"},
+  "outputs": [
+    {"name": "vmSelfLink", "finalValue": "https://www.googleapis.com/compute/v1/projects/test-project/zones/us-central1-f/instances/wordpress-vm"},
+    {"name": "hasExternalIP", "finalValue": true}
+  ]
+}`
+
+func TestDeploymentManagerDeployment(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+
+	createArgs := []string{"gcloud", "deployment-manager", "deployments", "create", "wordpress", "--config", "/tmp/outdir/test_config.yaml", "--project", "test-project"}
+	describeArgs := []string{"gcloud", "deployment-manager", "deployments", "describe", "wordpress", "--project", "test-project", "--format", "json"}
+	checkArgs := []string{"bash", filepath.Join(wd, "dir/check.sh")}
+	deleteArgs := []string{"gcloud", "deployment-manager", "deployments", "delete", "wordpress", "--project", "test-project", "--quiet"}
+
+	testCases := []struct {
+		name            string
+		createErr       error
+		checkErr        error
+		keepDeployment  bool
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:            "Deployment checks pass",
+		expectedRunArgs: [][]string{createArgs, describeArgs, checkArgs, deleteArgs},
+	}, {
+		name:            "Deployment check fails",
+		checkErr:        fmt.Errorf("exit status 1"),
+		expectErr:       true,
+		expectedRunArgs: [][]string{createArgs, describeArgs, checkArgs, deleteArgs},
+	}, {
+		name:            "Deployment fails to create",
+		createErr:       fmt.Errorf("waiter timed out"),
+		expectErr:       true,
+		expectedRunArgs: [][]string{createArgs, deleteArgs},
+	}, {
+		name:            "Deployment kept",
+		keepDeployment:  true,
+		expectedRunArgs: [][]string{createArgs, describeArgs, checkArgs},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var runs []func() ([]byte, []byte, error)
+			runs = append(runs, func() ([]byte, []byte, error) { return nil, nil, tc.createErr })
+			if tc.createErr == nil {
+				runs = append(runs,
+					func() ([]byte, []byte, error) { return []byte(describeOutput), nil, nil },
+					func() ([]byte, []byte, error) { return nil, nil, tc.checkErr })
+			}
+			runs = append(runs, func() ([]byte, []byte, error) { return nil, nil, nil })
+
+			fcmd := testingexec.FakeCmd{}
+			var cmdActions []testingexec.FakeCommandAction
+			for _, run := range runs {
+				fcmd.RunScript = append(fcmd.RunScript, run)
+				cmdActions = append(cmdActions, func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			executor := &testingexec.FakeExec{CommandScript: cmdActions}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = "/tmp/outdir"
+			deployment := &DeploymentManagerDeployment{
+				BaseResource: BaseResource{
+					TypeMeta{
+						APIVersion: apiVersion,
+						Kind:       "DeploymentManagerDeployment",
+					},
+					Metadata{Name: "wordpress"},
+				},
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            "test-project",
+				KeepDeployment:       tc.keepDeployment,
+			}
+			check := DeploymentCheck{Name: "vm-running"}
+			check.Script.File = "check.sh"
+			deployment.Checks = []DeploymentCheck{check}
+
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(deployment, "dir")
+
+			err := deployment.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+
+			if tc.createErr == nil {
+				assert.Contains(t, fcmd.Env, "DEPLOYMENT_NAME=wordpress")
+				assert.Contains(t, fcmd.Env, "DEPLOYMENT_OUTPUT_HASEXTERNALIP=true")
+				assert.Equal(t, "true", r.GetOutputs(deployment.GetReference())["hasExternalIP"])
+
+				results := deployment.checkResults()
+				assert.Len(t, results, 1)
+				assert.Equal(t, "vm-running", results[0].Name)
+				assert.Equal(t, tc.checkErr != nil, results[0].Status == "failed")
+			}
+		})
+	}
+}
+
+func TestDeploymentManagerDeploymentConsoleChecks(t *testing.T) {
+	describe := `{
+  "deployment": {"name": "wordpress"},
+  "outputs": [{"name": "password0", "finalValue": "short"}]
+}`
+	for _, enforce := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Enforced %t", enforce), func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+				func() ([]byte, []byte, error) { return []byte(describe), nil, nil },
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+			}}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			r := NewRegistry(&testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction}})
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{DeploymentSpec: map[string]interface{}{
+				"singleVm": map[string]interface{}{"passwords": []interface{}{map[string]interface{}{"length": 8}}},
+			}})
+			autogen.outDir = "/tmp/outdir"
+			deployment := &DeploymentManagerDeployment{
+				BaseResource:         newTestBaseResource("DeploymentManagerDeployment", "wordpress"),
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            "test-project",
+				EnforceConsoleChecks: enforce,
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(deployment, "dir")
+
+			err := deployment.Apply(r, false)
+			if enforce {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "generated password password0 has 5 characters, expected 8")
+			} else {
+				assert.NoError(t, err, "failed console checks are warnings unless they are enforced")
+			}
+			results := deployment.checkResults()
+			assert.Len(t, results, 1)
+			assert.Equal(t, "failed", results[0].Status)
+		})
+	}
+}
+
+func TestDeploymentManagerDeploymentServicePerimeter(t *testing.T) {
+	defer func(d time.Duration) { perimeterLogDelay = d }(perimeterLogDelay)
+	perimeterLogDelay = 0
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	enforced := `{"status": {"resources": ["projects/123"]}}`
+	dryRun := `{"spec": {"resources": ["projects/123"]}, "useExplicitDryRunSpec": true}`
+	violations := `[
+		{"protoPayload": {"serviceName": "storage.googleapis.com", "methodName": "google.storage.objects.get",
+			"metadata": {"violationReason": "RESOURCES_NOT_IN_SAME_SERVICE_PERIMETER", "dryRun": true}}},
+		{"protoPayload": {"serviceName": "storage.googleapis.com", "methodName": "google.storage.objects.get",
+			"metadata": {"violationReason": "RESOURCES_NOT_IN_SAME_SERVICE_PERIMETER", "dryRun": true}}}
+	]`
+
+	testCases := []struct {
+		name          string
+		perimeter     string
+		logs          string
+		errorContains string
+		expectedRuns  int
+	}{{
+		name:         "No violations",
+		perimeter:    enforced,
+		logs:         `[]`,
+		expectedRuns: 6,
+	}, {
+		name:          "Dry run violations",
+		perimeter:     dryRun,
+		logs:          violations,
+		errorContains: "storage.googleapis.com google.storage.objects.get: RESOURCES_NOT_IN_SAME_SERVICE_PERIMETER (dry run)",
+		expectedRuns:  6,
+	}, {
+		name:          "Project outside perimeter",
+		perimeter:     `{"status": {"resources": ["projects/456"]}}`,
+		errorContains: "project test-project is not protected by service perimeter",
+		expectedRuns:  2,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputs := []string{"123\n", tc.perimeter, "", describeOutput, tc.logs, ""}
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for _, output := range outputs {
+				output := output
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return []byte(output), nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = "/tmp/outdir"
+			deployment := &DeploymentManagerDeployment{
+				BaseResource:         newTestBaseResource("DeploymentManagerDeployment", "wordpress"),
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            "test-project",
+				ServicePerimeter:     "accessPolicies/42/servicePerimeters/test",
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(deployment, "dir")
+
+			err := deployment.Apply(r, false)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+				assert.True(t, strings.Count(err.Error(), "\n  - ") <= 1, "violations should be deduplicated")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, fcmd.RunLog, tc.expectedRuns)
+			assert.Equal(t, []string{"gcloud", "access-context-manager", "perimeters", "describe", "test",
+				"--policy", "42", "--format", "json"}, fcmd.RunLog[1])
+			if tc.expectedRuns == 6 {
+				assert.Equal(t, []string{"gcloud", "logging", "read",
+					vpcServiceControlsLogFilter + ` AND timestamp>="2020-06-01T12:00:00Z"`,
+					"--project", "test-project", "--format", "json"}, fcmd.RunLog[4])
+				assert.Equal(t, "delete", fcmd.RunLog[5][3])
+			}
+		})
+	}
+}
+
+func TestValidateServicePerimeter(t *testing.T) {
+	assert.NoError(t, validateServicePerimeter("accessPolicies/42/servicePerimeters/test_perimeter"))
+	assert.Error(t, validateServicePerimeter("test_perimeter"))
+}
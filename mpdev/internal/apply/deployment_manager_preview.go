@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// deploymentNameRegex matches valid Deployment Manager deployment names.
+var deploymentNameRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// DeploymentManagerPreview verifies that a generated Deployment Manager
+// template expands, by creating a preview of a deployment in a test project.
+// The preview is deleted once it has been created.
+type DeploymentManagerPreview struct {
+	BaseResource
+	DeploymentManagerRef Reference
+	// ProjectID of the test project the preview is created in
+	ProjectID string `json:"projectId"`
+	// DeploymentName of the preview. Defaults to the resource name.
+	DeploymentName string
+	// ConfigFile is the deployment configuration, relative to the root of
+	// the template. Defaults to test_config.yaml
+	ConfigFile string
+}
+
+// GetDependencies returns dependencies for DeploymentManagerPreview
+func (p *DeploymentManagerPreview) GetDependencies() (r []Reference) {
+	r = append(r, p.DeploymentManagerRef)
+	return r
+}
+
+// Apply creates and then deletes a preview of a deployment from the
+// referenced template.
+func (p *DeploymentManagerPreview) Apply(registry Registry, dryRun bool) error {
+	dmTemplate, err := getAutogenTemplate(registry, p.DeploymentManagerRef)
+	if err != nil {
+		return err
+	}
+
+	name := deploymentName(p.DeploymentName, p.Metadata.Name)
+	err = validateDeploymentTarget(p.ProjectID, name)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	configFile := p.ConfigFile
+	if configFile == "" {
+		configFile = "test_config.yaml"
+	}
+	configPath := filepath.Join(dmTemplate.outDir, configFile)
+
+	executor := registry.GetExecutor()
+	fmt.Printf("Creating preview of deployment %s in project %s\n", name, p.ProjectID)
+	previewErr := runCommand(executor, "gcloud", "deployment-manager", "deployments", "create", name,
+		"--config", configPath, "--preview", "--project", p.ProjectID)
+
+	// A preview whose templates fail to expand can still leave a deployment
+	// behind, so always attempt to delete it.
+	fmt.Printf("Deleting preview of deployment %s\n", name)
+	deleteErr := runCommand(executor, "gcloud", "deployment-manager", "deployments", "delete", name,
+		"--project", p.ProjectID, "--quiet")
+
+	if previewErr != nil {
+		return errors.Wrapf(previewErr, "failed to expand DM template in preview of deployment %s", name)
+	}
+	if deleteErr != nil {
+		return errors.Wrapf(deleteErr, "failed to delete preview of deployment %s", name)
+	}
+
+	fmt.Printf("DM template expanded successfully in preview of deployment %s\n", name)
+	return nil
+}
+
+// deploymentName returns the name of a deployment, defaulting to the name
+// of the resource creating it.
+func deploymentName(name string, resourceName string) string {
+	if name != "" {
+		return name
+	}
+	return resourceName
+}
+
+func validateDeploymentTarget(projectID string, name string) error {
+	if projectID == "" {
+		return errors.New("projectId cannot be empty for deployment")
+	}
+	if !deploymentNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid deployment name: %s. Must match regex %s", name, deploymentNameRegex)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDeploymentManagerPreview(t *testing.T) {
+	testCases := []struct {
+		name            string
+		projectID       string
+		deploymentName  string
+		previewErr      error
+		dryRun          bool
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:      "Preview expands",
+		projectID: "test-project",
+		expectedRunArgs: [][]string{
+			{"gcloud", "deployment-manager", "deployments", "create", "preview", "--config", "/tmp/outdir/test_config.yaml", "--preview", "--project", "test-project"},
+			{"gcloud", "deployment-manager", "deployments", "delete", "preview", "--project", "test-project", "--quiet"},
+		},
+	}, {
+		name:       "Preview fails to expand",
+		projectID:  "test-project",
+		previewErr: fmt.Errorf("template expansion failed"),
+		expectErr:  true,
+		expectedRunArgs: [][]string{
+			{"gcloud", "deployment-manager", "deployments", "create", "preview", "--config", "/tmp/outdir/test_config.yaml", "--preview", "--project", "test-project"},
+			{"gcloud", "deployment-manager", "deployments", "delete", "preview", "--project", "test-project", "--quiet"},
+		},
+	}, {
+		name:      "Missing project",
+		expectErr: true,
+	}, {
+		name:           "Invalid deployment name",
+		projectID:      "test-project",
+		deploymentName: "Invalid_Name",
+		expectErr:      true,
+	}, {
+		name:      "Dry run",
+		projectID: "test-project",
+		dryRun:    true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) { return nil, nil, tc.previewErr },
+					func() ([]byte, []byte, error) { return nil, nil, nil },
+				},
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = "/tmp/outdir"
+			preview := &DeploymentManagerPreview{
+				BaseResource: BaseResource{
+					TypeMeta{
+						APIVersion: apiVersion,
+						Kind:       "DeploymentManagerPreview",
+					},
+					Metadata{Name: "preview"},
+				},
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            tc.projectID,
+				DeploymentName:       tc.deploymentName,
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(preview, "dir")
+
+			err := preview.Apply(r, tc.dryRun)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
@@ -16,11 +16,12 @@ package apply
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 	"k8s.io/utils/exec"
@@ -28,36 +29,75 @@ import (
 )
 
 func TestDeploymentManager(t *testing.T) {
-	wd, err := os.Getwd()
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	resourceDir, err := ioutil.TempDir("", "resourcedir")
 	assert.NoError(t, err)
+	defer os.RemoveAll(resourceDir)
 
 	testcases := []struct {
 		name            string
 		expectedRunArgs [][]string
 		zipFilePath     string
+		archiveFormat   string
 		missingRef      bool
 		badRefType      bool
+		badFormat       bool
 		dryRun          bool
 	}{{
 		name: "Deployment Manager GCS",
 		expectedRunArgs: [][]string{
-			{"zip", "-r", "/tmp/outdir/dm_template.zip", "."},
-			{"gsutil", "cp", "/tmp/outdir/dm_template.zip", "gs://project/dmtemppath.zip"},
+			{"zip", "-r", filepath.Join(outDir, "dm_template.zip"), "."},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip"), "gs://project/dmtemppath.zip"},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip.manifest.yaml"), "gs://project/dmtemppath.zip.manifest.yaml"},
 		},
 		zipFilePath: "gs://project/dmtemppath.zip",
 	}, {
 		name: "Deployment Manager Local Save Relative Path",
 		expectedRunArgs: [][]string{
-			{"zip", "-r", filepath.Join(wd, "resourcedir/dir2/localzippath.zip"), "."},
+			{"zip", "-r", filepath.Join(resourceDir, "dir2/localzippath.zip"), "."},
 		},
 		zipFilePath: "dir2/localzippath.zip",
 	},
 		{
 			name: "Deployment Manager Local Save Absolute Path",
 			expectedRunArgs: [][]string{
-				{"zip", "-r", "/tmp/dir3/localzippath.zip", "."},
+				{"zip", "-r", filepath.Join(resourceDir, "dir3/localzippath.zip"), "."},
+			},
+			zipFilePath: filepath.Join(resourceDir, "dir3/localzippath.zip"),
+		},
+		{
+			name: "Deployment Manager GCS tgz",
+			expectedRunArgs: [][]string{
+				{"tar", "-czf", filepath.Join(outDir, "dm_template.tgz"), "--exclude", "./dm_template.tgz", "."},
+				{"gsutil", "cp", filepath.Join(outDir, "dm_template.tgz"), "gs://project/dmtemppath.tgz"},
+				{"gsutil", "cp", filepath.Join(outDir, "dm_template.tgz.manifest.yaml"), "gs://project/dmtemppath.tgz.manifest.yaml"},
+			},
+			zipFilePath:   "gs://project/dmtemppath.tgz",
+			archiveFormat: "tgz",
+		},
+		{
+			name: "Deployment Manager Local Save tgz",
+			expectedRunArgs: [][]string{
+				{"tar", "-czf", filepath.Join(resourceDir, "dir3/localpath.tar.gz"), "."},
 			},
-			zipFilePath: "/tmp/dir3/localzippath.zip",
+			zipFilePath:   filepath.Join(resourceDir, "dir3/localpath.tar.gz"),
+			archiveFormat: "tgz",
+		},
+		{
+			name: "Deployment Manager Local Save tgz In Subdirectory",
+			expectedRunArgs: [][]string{
+				{"tar", "-czf", filepath.Join(outDir, "nested/dm_template.tgz"), "--exclude", "./nested/dm_template.tgz", "."},
+			},
+			zipFilePath:   filepath.Join(outDir, "nested/dm_template.tgz"),
+			archiveFormat: "tgz",
+		},
+		{
+			name:          "Deployment Manager Unsupported Archive Format",
+			zipFilePath:   "/tmp/dir3/localpath.rar",
+			archiveFormat: "rar",
+			badFormat:     true,
 		},
 		{
 			name:        "Deployment Manager Missing Reference",
@@ -79,23 +119,24 @@ func TestDeploymentManager(t *testing.T) {
 	}
 	for _, tc := range testcases {
 		t.Run(tc.name, func(t *testing.T) {
-			fcmd := testingexec.FakeCmd{
-				RunScript: []testingexec.FakeRunAction{
-					func() ([]byte, []byte, error) { return nil, nil, nil },
-					func() ([]byte, []byte, error) { return nil, nil, nil },
-				},
+			fcmd := testingexec.FakeCmd{}
+			fcmd.RunScript = []testingexec.FakeRunAction{
+				fakeArchiveAction(&fcmd),
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+				func() ([]byte, []byte, error) { return nil, nil, nil },
 			}
 
 			executor := &testingexec.FakeExec{
 				CommandScript: []testingexec.FakeCommandAction{
 					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
 					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
 				},
 			}
 			r := NewRegistry(executor)
 
 			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
-			autogen.outDir = "/tmp/outdir"
+			autogen.outDir = outDir
 
 			dm := &DeploymentManagerTemplate{
 				BaseResource: BaseResource{
@@ -106,7 +147,10 @@ func TestDeploymentManager(t *testing.T) {
 					Metadata{Name: "dm-temp"},
 				},
 				DeploymentManagerRef: autogen.GetReference(),
-				ZipFilePath:          tc.zipFilePath,
+				ArchiveFormat:        tc.archiveFormat,
+			}
+			if tc.zipFilePath != "" {
+				dm.ZipFilePath = StringList{tc.zipFilePath}
 			}
 
 			if tc.missingRef {
@@ -117,13 +161,13 @@ func TestDeploymentManager(t *testing.T) {
 				dm.DeploymentManagerRef = dm.GetReference()
 			}
 
-			dir := "resourcedir"
+			dir := resourceDir
 			r.RegisterResource(autogen, dir)
 			r.RegisterResource(dm, dir)
 
 			err := dm.Apply(r, tc.dryRun)
 
-			if tc.missingRef || tc.badRefType || tc.zipFilePath == "" {
+			if tc.missingRef || tc.badRefType || tc.zipFilePath == "" || tc.badFormat {
 				assert.Error(t, err)
 			} else {
 				assert.NoError(t, err)
@@ -135,6 +179,443 @@ func TestDeploymentManager(t *testing.T) {
 	}
 }
 
+func TestDeploymentManagerSignedURL(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	signURLOutput := "URL\tHTTP Method\tExpiration\tSigned URL\n" +
+		"gs://project/dm.zip\tGET\t2020-07-08 10:00:00\thttps://storage.googleapis.com/project/dm.zip?x-goog-signature=abc\n"
+
+	testcases := []struct {
+		name            string
+		zipFilePath     string
+		signedURL       *SignedURLOptions
+		expectedRunArgs [][]string
+		invalidConfig   bool
+	}{{
+		name:        "Signed URL with active credentials",
+		zipFilePath: "gs://project/dm.zip",
+		signedURL:   &SignedURLOptions{},
+		expectedRunArgs: [][]string{
+			{"zip", "-r", filepath.Join(outDir, "dm_template.zip"), "."},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip"), "gs://project/dm.zip"},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip.manifest.yaml"), "gs://project/dm.zip.manifest.yaml"},
+			{"gsutil", "signurl", "-d", "1h", "-u", "gs://project/dm.zip"},
+		},
+	}, {
+		name:        "Signed URL with private key",
+		zipFilePath: "gs://project/dm.zip",
+		signedURL:   &SignedURLOptions{Duration: "7d", PrivateKeyFile: "/tmp/key.json"},
+		expectedRunArgs: [][]string{
+			{"zip", "-r", filepath.Join(outDir, "dm_template.zip"), "."},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip"), "gs://project/dm.zip"},
+			{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip.manifest.yaml"), "gs://project/dm.zip.manifest.yaml"},
+			{"gsutil", "signurl", "-d", "7d", "/tmp/key.json", "gs://project/dm.zip"},
+		},
+	}, {
+		name:          "Signed URL for local zip",
+		zipFilePath:   "/tmp/dm.zip",
+		signedURL:     &SignedURLOptions{},
+		invalidConfig: true,
+	}}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd := testingexec.FakeCmd{}
+			fcmd.RunScript = []testingexec.FakeRunAction{
+				fakeArchiveAction(&fcmd),
+				noOutput,
+				noOutput,
+				func() ([]byte, []byte, error) { return []byte(signURLOutput), nil, nil },
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = outDir
+			dm := getDeploymentManagerTemplate(autogen, tc.zipFilePath)
+			dm.SignedURL = tc.signedURL
+
+			r.RegisterResource(autogen, "resourcedir")
+			r.RegisterResource(dm, "resourcedir")
+
+			err := dm.Apply(r, false)
+			if tc.invalidConfig {
+				assert.Error(t, err)
+				assert.Equal(t, 0, fcmd.RunCalls)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+			assert.Equal(t, map[string]string{
+				"zipFilePath":      tc.zipFilePath,
+				"signedUrl":        "https://storage.googleapis.com/project/dm.zip?x-goog-signature=abc",
+				"archiveSizeBytes": "7",
+				"manifest":         filepath.Join(outDir, "dm_template.zip.manifest.yaml"),
+			}, r.GetOutputs(dm.GetReference()))
+		})
+	}
+}
+
+func TestDeploymentManagerMultipleDestinations(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	fcmd := testingexec.FakeCmd{}
+	fcmd.RunScript = []testingexec.FakeRunAction{
+		fakeArchiveAction(&fcmd),
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+		func() ([]byte, []byte, error) { return nil, nil, fmt.Errorf("AccessDeniedException: 403") },
+	}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction},
+	}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = outDir
+	dm := getDeploymentManagerTemplate(autogen, "")
+	dm.ZipFilePath = StringList{"gs://staging/dm.zip", "gs://prod/dm.zip"}
+
+	r.RegisterResource(autogen, "resourcedir")
+	r.RegisterResource(dm, "resourcedir")
+
+	err := dm.Apply(r, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "gs://prod/dm.zip")
+
+	expectedRunArgs := [][]string{
+		{"zip", "-r", filepath.Join(outDir, "dm_template.zip"), "."},
+		{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip"), "gs://staging/dm.zip"},
+		{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip.manifest.yaml"), "gs://staging/dm.zip.manifest.yaml"},
+		{"gsutil", "cp", filepath.Join(outDir, "dm_template.zip"), "gs://prod/dm.zip"},
+	}
+	assert.Equal(t, expectedRunArgs, fcmd.RunLog)
+	assert.Equal(t, map[string]string{
+		"zipFilePath[0]":   "gs://staging/dm.zip",
+		"archiveSizeBytes": "7",
+		"manifest":         filepath.Join(outDir, "dm_template.zip.manifest.yaml"),
+	}, r.GetOutputs(dm.GetReference()))
+}
+
+func TestDeploymentManagerLocalAndGCS(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	fcmd := testingexec.FakeCmd{}
+	noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+	fcmd.RunScript = []testingexec.FakeRunAction{fakeArchiveAction(&fcmd), noOutput, noOutput}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction},
+	}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = outDir
+	localPath := filepath.Join(outDir, "release", "dm.zip")
+	dm := getDeploymentManagerTemplate(autogen, "")
+	dm.ZipFilePath = StringList{"gs://project/dm.zip", localPath}
+	r.RegisterResource(autogen, "resourcedir")
+	r.RegisterResource(dm, "resourcedir")
+
+	err := dm.Apply(r, false)
+	assert.NoError(t, err)
+
+	// The local archive is the file that is uploaded to GCS.
+	assert.Equal(t, [][]string{
+		{"zip", "-r", localPath, "."},
+		{"gsutil", "cp", localPath, "gs://project/dm.zip"},
+		{"gsutil", "cp", localPath + manifestSuffix, "gs://project/dm.zip" + manifestSuffix},
+	}, fcmd.RunLog)
+	b, err := ioutil.ReadFile(localPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "archive", string(b))
+	assert.Equal(t, map[string]string{
+		"zipFilePath[0]":   "gs://project/dm.zip",
+		"zipFilePath[1]":   localPath,
+		"archiveSizeBytes": "7",
+		"manifest":         localPath + manifestSuffix,
+	}, r.GetOutputs(dm.GetReference()))
+}
+
+func TestDeploymentManagerUnchanged(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	fcmd := testingexec.FakeCmd{}
+	noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+	fcmd.RunScript = []testingexec.FakeRunAction{
+		fakeArchiveAction(&fcmd), noOutput, noOutput,
+		fakeArchiveAction(&fcmd), noOutput, noOutput,
+	}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{
+			cmdAction, cmdAction, cmdAction, cmdAction, cmdAction, cmdAction,
+		},
+	}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = outDir
+	dm := getDeploymentManagerTemplate(autogen, "gs://project/dm.zip")
+	r.RegisterResource(autogen, "resourcedir")
+	r.RegisterResource(dm, "resourcedir")
+
+	err := dm.Apply(r, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fcmd.RunCalls)
+	assert.NotEmpty(t, r.GetState(dm, contentHashState))
+
+	// Nothing changed so the template is neither archived nor uploaded.
+	err = dm.Apply(r, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, fcmd.RunCalls)
+	assert.Equal(t, "gs://project/dm.zip", r.GetOutputs(dm.GetReference())["zipFilePath"])
+
+	err = ioutil.WriteFile(filepath.Join(outDir, "vm.jinja"), []byte("resources: []"), 0644)
+	assert.NoError(t, err)
+	err = dm.Apply(r, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, fcmd.RunCalls)
+}
+
+func TestDeploymentManagerKMSKey(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+
+	key := "projects/p/locations/us/keyRings/ring/cryptoKeys/key"
+	testCases := []struct {
+		name            string
+		kmsKey          string
+		zipFilePath     string
+		expectedRunArgs [][]string
+		expectErr       bool
+	}{{
+		name:        "Upload with KMS key",
+		kmsKey:      key,
+		zipFilePath: "gs://project/dm.zip",
+		expectedRunArgs: [][]string{
+			{"zip", "-r", filepath.Join(outDir, "dm_template.zip"), "."},
+			{"gsutil", "-o", "GSUtil:encryption_key=" + key, "cp", filepath.Join(outDir, "dm_template.zip"), "gs://project/dm.zip"},
+			{"gsutil", "-o", "GSUtil:encryption_key=" + key, "cp", filepath.Join(outDir, "dm_template.zip.manifest.yaml"), "gs://project/dm.zip.manifest.yaml"},
+		},
+	}, {
+		name:        "Invalid KMS key",
+		kmsKey:      "projects/p/keyRings/ring",
+		zipFilePath: "gs://project/dm.zip",
+		expectErr:   true,
+	}, {
+		name:        "KMS key without GCS path",
+		kmsKey:      key,
+		zipFilePath: filepath.Join(outDir, "out", "dm.zip"),
+		expectErr:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{fakeArchiveAction(&fcmd), noOutput, noOutput}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = outDir
+			dm := getDeploymentManagerTemplate(autogen, tc.zipFilePath)
+			dm.KMSKey = tc.kmsKey
+			r.RegisterResource(autogen, "resourcedir")
+			r.RegisterResource(dm, "resourcedir")
+
+			err := dm.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "kmsKey")
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestStagePackage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		zipRoot       string
+		stripPrefix   string
+		expectedFiles []string
+		expectErr     bool
+	}{{
+		name:          "No options",
+		expectedFiles: []string{"README.md", "dm/solution.jinja", "dm/templates/vm.jinja", "solution.jinja"},
+	}, {
+		name:          "Zip root",
+		zipRoot:       "dm",
+		expectedFiles: []string{"solution.jinja", "templates/vm.jinja"},
+	}, {
+		name:          "Strip prefix within zip root",
+		zipRoot:       "dm",
+		stripPrefix:   "templates",
+		expectedFiles: []string{"solution.jinja", "vm.jinja"},
+	}, {
+		name:        "Strip prefix conflicts",
+		stripPrefix: "dm",
+		expectErr:   true,
+	}, {
+		name:      "Missing zip root",
+		zipRoot:   "missing",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "stage")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			for _, name := range []string{"README.md", "solution.jinja", "dm/solution.jinja", "dm/templates/vm.jinja"} {
+				path := filepath.Join(dir, name)
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, ioutil.WriteFile(path, []byte(name), 0644))
+			}
+
+			staged, err := stagePackage(dir, tc.zipRoot, tc.stripPrefix)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if staged != dir {
+				defer os.RemoveAll(staged)
+			}
+
+			var files []string
+			err = filepath.Walk(staged, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					rel, _ := filepath.Rel(staged, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return err
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedFiles, files)
+		})
+	}
+}
+
+func TestDeploymentManagerInvalidZipRoot(t *testing.T) {
+	testCases := []struct {
+		zipRoot   string
+		expectErr bool
+	}{
+		{zipRoot: "../other", expectErr: true},
+		{zipRoot: "..", expectErr: true},
+		{zipRoot: "dm/../..", expectErr: true},
+		{zipRoot: "/dm", expectErr: true},
+		{zipRoot: "..dm"},
+		{zipRoot: "dm/..templates"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.zipRoot, func(t *testing.T) {
+			r := NewRegistry(&testingexec.FakeExec{})
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			dm := getDeploymentManagerTemplate(autogen, "gs://project/dm.zip")
+			dm.ZipRoot = tc.zipRoot
+			r.RegisterResource(autogen, "resourcedir")
+			r.RegisterResource(dm, "resourcedir")
+
+			err := dm.Apply(r, true)
+			if !tc.expectErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "zipRoot")
+		})
+	}
+}
+
+func TestDeploymentManagerSizeLimit(t *testing.T) {
+	testCases := []struct {
+		name      string
+		sizeLimit SizeLimitOptions
+		expectErr bool
+	}{{
+		name:      "Archive within limit",
+		sizeLimit: SizeLimitOptions{Enforce: true},
+	}, {
+		name:      "Archive exceeds limit with warning",
+		sizeLimit: SizeLimitOptions{MaxBytes: 5},
+	}, {
+		name:      "Archive exceeds enforced limit",
+		sizeLimit: SizeLimitOptions{MaxBytes: 5, Enforce: true},
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outDir := newTestPackageDir(t)
+			defer os.RemoveAll(outDir)
+
+			fcmd := testingexec.FakeCmd{}
+			fcmd.RunScript = []testingexec.FakeRunAction{fakeArchiveAction(&fcmd)}
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+				},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = outDir
+			dm := getDeploymentManagerTemplate(autogen, filepath.Join(outDir, "out", "dm.zip"))
+			dm.SizeLimit = tc.sizeLimit
+			r.RegisterResource(autogen, "resourcedir")
+			r.RegisterResource(dm, "resourcedir")
+
+			err := dm.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "exceeds limit")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeploymentManagerPreflightFailure(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+	assert.NoError(t, os.Remove(filepath.Join(outDir, "solution.jinja.display")))
+
+	executor := &testingexec.FakeExec{}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = outDir
+	dm := getDeploymentManagerTemplate(autogen, "gs://project/dm.zip")
+	r.RegisterResource(autogen, "resourcedir")
+	r.RegisterResource(dm, "resourcedir")
+
+	err := dm.Apply(r, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing display metadata solution.jinja.display")
+	assert.Equal(t, 0, executor.CommandCalls)
+}
+
 var validAutogenSpec = `
 packageInfo:
   version: '1.2.0'
@@ -286,41 +767,27 @@ packageInfo:
 
 			autogen := getDeploymentManagerAutogenTemplate(&autogenSpec)
 
-			mountRegex := regexp.MustCompile("type=bind,src=/(.*/autogen.*),dst=/autogen")
-			// docker run argv index for mounting autogen input file
-			mountIdx := 7
-			fcmd := testingexec.FakeCmd{}
-
-			fcmd.RunScript = []testingexec.FakeRunAction{
-				func() ([]byte, []byte, error) {
-					mountMatch := mountRegex.FindStringSubmatch(fcmd.Argv[mountIdx])
-					assert.Equal(t, 2, len(mountMatch))
-
-					f, err := os.Open(fmt.Sprintf("/%s/autogen.yaml", mountMatch[1]))
-					assert.NoError(t, err)
+			runner := &fakeContainerRunner{onRun: func(spec ContainerSpec) {
+				assert.Len(t, spec.Mounts, 2)
+				f, err := os.Open(filepath.Join(spec.Mounts[1].Source, "autogen.yaml"))
+				assert.NoError(t, err)
+				defer f.Close()
 
-					// Check that input file to autogen container matches convertedSpec
-					dec := yaml.NewDecoder(f)
-					var specOnFile interface{}
-					err = dec.Decode(&specOnFile)
-					assert.NoError(t, err)
+				// Check that input file to autogen container matches convertedSpec
+				dec := yaml.NewDecoder(f)
+				var specOnFile interface{}
+				err = dec.Decode(&specOnFile)
+				assert.NoError(t, err)
 
-					var expectedSpec interface{}
-					err = yaml.Unmarshal([]byte(expectedConvertedSpec), &expectedSpec)
-					assert.NoError(t, err)
+				var expectedSpec interface{}
+				err = yaml.Unmarshal([]byte(expectedConvertedSpec), &expectedSpec)
+				assert.NoError(t, err)
 
-					assert.Equal(t, expectedSpec, specOnFile)
-					return nil, nil, nil
-				},
-			}
+				assert.Equal(t, expectedSpec, specOnFile)
+			}}
+			defer useFakeContainerRunner(runner)()
 
-			executor := &testingexec.FakeExec{
-				CommandScript: []testingexec.FakeCommandAction{
-					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
-				},
-			}
-
-			r := NewRegistry(executor)
+			r := NewRegistry(&testingexec.FakeExec{LookPathFunc: newLookPathFunc(nil)})
 			dir := "dir2"
 			r.RegisterResource(autogen, dir)
 			err = r.Apply(tc.dryRun)
@@ -331,24 +798,101 @@ packageInfo:
 			}
 
 			if !tc.dryRun && !tc.invalidSpec {
-				assert.Equal(t, 1, fcmd.RunCalls)
+				assert.Len(t, runner.runs, 1)
 				// Temp directory created is random so check that bind mount matches regex
-				assert.Regexp(t, mountRegex, fcmd.RunLog[0][mountIdx])
+				inputDir := runner.runs[0].Mounts[1].Source
+				assert.Regexp(t, "/autogen", inputDir)
 
-				expectedArgs := []string{
-					"docker", "run", "--rm", "-i", "--mount", fmt.Sprintf("type=bind,src=%s,dst=/tmp/out", autogen.outDir),
-					"--mount", fcmd.RunLog[0][mountIdx], "gcr.io/cloud-marketplace-tools/dm/autogen",
-					"--input_type", "YAML", "--single_input", "/autogen/autogen.yaml",
-					"--output_type", "PACKAGE", "--output", "/tmp/out",
+				expectedSpec := ContainerSpec{
+					Name:  runner.removed[0],
+					Image: "gcr.io/cloud-marketplace-tools/dm/autogen",
+					Args: []string{
+						"--input_type", "YAML", "--single_input", "/autogen/autogen.yaml",
+						"--output_type", "PACKAGE", "--output", "/tmp/out",
+					},
+					Mounts: []dockerMount{
+						{Type: "bind", Source: autogen.outDir, Target: "/tmp/out"},
+						{Type: "bind", Source: inputDir, Target: "/autogen"},
+					},
 				}
-
-				assert.Equal(t, expectedArgs, fcmd.RunLog[0])
+				assert.Equal(t, expectedSpec, runner.runs[0])
+				assert.NotContains(t, util.TmpDirs(), autogen.outDir, "the output is kept when mpdev exits")
+				os.RemoveAll(autogen.outDir)
 			}
 		})
 	}
 
 }
 
+func TestAutogenInjectCredentials(t *testing.T) {
+	var autogenSpec AutogenSpec
+	assert.NoError(t, yaml.Unmarshal([]byte(validAutogenSpec), &autogenSpec))
+	autogen := getDeploymentManagerAutogenTemplate(&autogenSpec)
+	autogen.InjectCredentials = true
+	runner := &fakeContainerRunner{output: "Authenticated with ya29.token\n"}
+	defer useFakeContainerRunner(runner)()
+
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return []byte("ya29.token\n"), nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{
+		LookPathFunc: newLookPathFunc(nil),
+		CommandScript: []testingexec.FakeCommandAction{
+			func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+		},
+	}
+	r := NewRegistry(fexec)
+	r.RegisterResource(autogen, "dir2")
+	assert.NoError(t, r.Apply(false))
+	defer os.RemoveAll(autogen.outDir)
+
+	assert.Equal(t, [][]string{{"gcloud", "auth", "print-access-token"}}, fcmd.RunLog)
+	assert.Len(t, runner.runs, 1)
+	assert.Contains(t, runner.runs[0].Env, "GOOGLE_OAUTH_ACCESS_TOKEN=ya29.token")
+	mounts := runner.runs[0].Mounts
+	assert.Equal(t, dockerMount{Type: "bind", Source: mounts[2].Source, Target: credentialsDir, ReadOnly: true}, mounts[2])
+}
+
+// fakeArchiveAction returns a run action that writes a placeholder archive
+// to the path zip or tar were invoked with.
+func fakeArchiveAction(fcmd *testingexec.FakeCmd) testingexec.FakeRunAction {
+	return func() ([]byte, []byte, error) {
+		archive := fcmd.Argv[2]
+		err := os.MkdirAll(filepath.Dir(archive), 0755)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ioutil.WriteFile(archive, []byte("archive"), 0644)
+	}
+}
+
+// newTestPackageDir creates a directory containing the minimal files of a
+// valid Deployment Manager package.
+func newTestPackageDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dmpackage")
+	assert.NoError(t, err)
+
+	for _, name := range []string{"solution.jinja", "solution.jinja.schema", "solution.jinja.display", "vm.jinja"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	return dir
+}
+
+func getDeploymentManagerTemplate(autogen *DeploymentManagerAutogenTemplate, zipFilePath string) *DeploymentManagerTemplate {
+	return &DeploymentManagerTemplate{
+		BaseResource: BaseResource{
+			TypeMeta{
+				APIVersion: apiVersion,
+				Kind:       "DeploymentManagerTemplate",
+			},
+			Metadata{Name: "dm-temp"},
+		},
+		DeploymentManagerRef: autogen.GetReference(),
+		ZipFilePath:          StringList{zipFilePath},
+	}
+}
+
 func getDeploymentManagerAutogenTemplate(spec *AutogenSpec) *DeploymentManagerAutogenTemplate {
 	autogen := &DeploymentManagerAutogenTemplate{
 		BaseResource: BaseResource{
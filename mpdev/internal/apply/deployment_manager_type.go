@@ -0,0 +1,151 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+var compositeTypeStatuses = map[string]bool{
+	"":             true,
+	"SUPPORTED":    true,
+	"EXPERIMENTAL": true,
+	"DEPRECATED":   true,
+}
+
+// DeploymentManagerCompositeType registers a generated Deployment Manager
+// template as a composite type in a project. The composite type is created
+// if it doesn't exist, and updated otherwise.
+type DeploymentManagerCompositeType struct {
+	BaseResource
+	DeploymentManagerRef Reference
+	// ProjectID of the project the composite type is registered in
+	ProjectID string `json:"projectId"`
+	// TypeName of the composite type. Defaults to the resource name.
+	TypeName    string
+	Description string
+	// Status of the composite type. One of SUPPORTED, EXPERIMENTAL or
+	// DEPRECATED.
+	Status string
+	Labels map[string]string
+}
+
+// GetDependencies returns dependencies for DeploymentManagerCompositeType
+func (c *DeploymentManagerCompositeType) GetDependencies() (r []Reference) {
+	r = append(r, c.DeploymentManagerRef)
+	return r
+}
+
+// Apply creates or updates the composite type from the referenced template.
+func (c *DeploymentManagerCompositeType) Apply(registry Registry, dryRun bool) error {
+	dmTemplate, err := getAutogenTemplate(registry, c.DeploymentManagerRef)
+	if err != nil {
+		return err
+	}
+
+	typeName := deploymentName(c.TypeName, c.Metadata.Name)
+	err = validateDeploymentTarget(c.ProjectID, typeName)
+	if err != nil {
+		return err
+	}
+
+	if !compositeTypeStatuses[c.Status] {
+		return fmt.Errorf("invalid composite type status: %s. Must be one of SUPPORTED, EXPERIMENTAL or DEPRECATED", c.Status)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	template, err := findMainTemplate(dmTemplate.outDir)
+	if err != nil {
+		return err
+	}
+
+	executor := registry.GetExecutor()
+	exists, err := compositeTypeExists(executor, c.ProjectID, typeName)
+	if err != nil {
+		return err
+	}
+
+	verb, labelsFlag := "create", "--labels"
+	if exists {
+		verb, labelsFlag = "update", "--update-labels"
+	}
+
+	args := []string{"beta", "deployment-manager", "types", verb, typeName, "--template", template, "--project", c.ProjectID}
+	if c.Description != "" {
+		args = append(args, "--description", c.Description)
+	}
+	if c.Status != "" {
+		args = append(args, "--status", c.Status)
+	}
+	if len(c.Labels) > 0 {
+		args = append(args, labelsFlag, formatLabels(c.Labels))
+	}
+
+	fmt.Printf("Registering composite type %s in project %s (%s)\n", typeName, c.ProjectID, verb)
+	err = runCommand(executor, "gcloud", args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to %s composite type %s", verb, typeName)
+	}
+
+	registry.SetOutput(c, "compositeType", fmt.Sprintf("%s/composite:%s", c.ProjectID, typeName))
+	return nil
+}
+
+// compositeTypeExists returns whether the composite type typeName can be
+// described in project projectID. Only a NOT_FOUND error means that the type
+// does not exist: other failures, such as denied permissions or network
+// errors, are returned, so that an existing type is not created again.
+func compositeTypeExists(executor exec.Interface, projectID string, typeName string) (bool, error) {
+	var stderr bytes.Buffer
+	cmd := executor.Command("gcloud", "beta", "deployment-manager", "types", "describe", typeName,
+		"--project", projectID, "--format", "value(name)")
+	cmd.SetStdout(ioutil.Discard)
+	cmd.SetStderr(&stderr)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	if isNotFoundError(stderr.String()) {
+		return false, nil
+	}
+	return false, errors.Wrapf(err, "failed to describe composite type %s: %s", typeName, strings.TrimSpace(stderr.String()))
+}
+
+// isNotFoundError returns whether the stderr of a failed gcloud command
+// reports that the resource does not exist.
+func isNotFoundError(stderr string) bool {
+	return strings.Contains(stderr, "NOT_FOUND") || strings.Contains(stderr, "was not found") || strings.Contains(stderr, "code=404")
+}
+
+// formatLabels formats labels as a comma separated list of key=value pairs
+// sorted by key.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
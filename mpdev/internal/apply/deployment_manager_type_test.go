@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDeploymentManagerCompositeType(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+	template := filepath.Join(outDir, "solution.jinja")
+
+	describeArgs := []string{"gcloud", "beta", "deployment-manager", "types", "describe", "wordpress", "--project", "test-project", "--format", "value(name)"}
+
+	testCases := []struct {
+		name            string
+		exists          bool
+		describeStderr  string
+		status          string
+		expectErr       bool
+		errorContains   string
+		expectedRunArgs [][]string
+	}{{
+		name:           "Create composite type",
+		describeStderr: "ERROR: (gcloud.beta.deployment-manager.types.describe) NOT_FOUND: The resource 'projects/test-project/global/compositeTypes/wordpress' was not found",
+		expectedRunArgs: [][]string{
+			describeArgs,
+			{"gcloud", "beta", "deployment-manager", "types", "create", "wordpress", "--template", template, "--project", "test-project",
+				"--status", "EXPERIMENTAL", "--labels", "env=test,team=marketplace"},
+		},
+		status: "EXPERIMENTAL",
+	}, {
+		name:   "Update composite type",
+		exists: true,
+		expectedRunArgs: [][]string{
+			describeArgs,
+			{"gcloud", "beta", "deployment-manager", "types", "update", "wordpress", "--template", template, "--project", "test-project",
+				"--update-labels", "env=test,team=marketplace"},
+		},
+	}, {
+		name:            "Describe failure",
+		describeStderr:  "ERROR: (gcloud.beta.deployment-manager.types.describe) PERMISSION_DENIED: Required 'deploymentmanager.typeProviders.get' permission",
+		errorContains:   "failed to describe composite type wordpress: ERROR: (gcloud.beta.deployment-manager.types.describe) PERMISSION_DENIED",
+		expectedRunArgs: [][]string{describeArgs},
+	}, {
+		name:      "Invalid status",
+		status:    "BETA",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) {
+						if tc.exists {
+							return nil, nil, nil
+						}
+						return nil, []byte(tc.describeStderr), testingexec.FakeExitError{Status: 1}
+					},
+					func() ([]byte, []byte, error) { return nil, nil, nil },
+				},
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = outDir
+			compositeType := &DeploymentManagerCompositeType{
+				BaseResource: BaseResource{
+					TypeMeta{
+						APIVersion: apiVersion,
+						Kind:       "DeploymentManagerCompositeType",
+					},
+					Metadata{Name: "wordpress"},
+				},
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            "test-project",
+				Status:               tc.status,
+				Labels:               map[string]string{"team": "marketplace", "env": "test"},
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(compositeType, "dir")
+
+			err := compositeType.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Equal(t, 0, fcmd.RunCalls)
+				return
+			}
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+				assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+			assert.Equal(t, "test-project/composite:wordpress", r.GetOutputs(compositeType.GetReference())["compositeType"])
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// DeploymentMatrix is a set of machine types, zones and accelerators that a
+// DeploymentManagerDeployment is tested with. A deployment is created for
+// every combination, with the machineType, zone, acceleratorType and
+// acceleratorCount properties of the templates in its configuration set to
+// the values of the combination. Properties of dimensions that are empty are
+// left unchanged.
+type DeploymentMatrix struct {
+	// MachineTypes of the VMs, such as e2-standard-2 and n1-highmem-8
+	MachineTypes []string
+	// Zones of the VMs, such as us-central1-a and europe-west1-b
+	Zones []string
+	// Accelerators attached to the VMs. An accelerator without a type
+	// tests the solution without GPUs
+	Accelerators []MatrixAccelerator
+}
+
+// MatrixAccelerator is a GPU configuration of a DeploymentMatrix.
+type MatrixAccelerator struct {
+	// Type of the GPUs, such as nvidia-tesla-t4
+	Type string
+	// Count of GPUs. Defaults to 1
+	Count int
+}
+
+// matrixCombination is a combination of the values of a matrix. Empty
+// values are not set in the configuration of the deployment.
+type matrixCombination struct {
+	machineType string
+	zone        string
+	accelerator MatrixAccelerator
+}
+
+// label returns the values of the combination, such as
+// n1-standard-4/us-central1-a/nvidia-tesla-t4x1, or default if it sets no
+// value.
+func (c matrixCombination) label() string {
+	var values []string
+	for _, value := range []string{c.machineType, c.zone} {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	if c.accelerator.Type != "" {
+		values = append(values, fmt.Sprintf("%sx%d", c.accelerator.Type, c.accelerator.Count))
+	}
+	if len(values) == 0 {
+		return "default"
+	}
+	return strings.Join(values, "/")
+}
+
+// properties returns the template properties set by the combination.
+func (c matrixCombination) properties() map[string]interface{} {
+	properties := map[string]interface{}{}
+	if c.machineType != "" {
+		properties["machineType"] = c.machineType
+	}
+	if c.zone != "" {
+		properties["zone"] = c.zone
+	}
+	if c.accelerator.Type != "" {
+		properties["acceleratorType"] = c.accelerator.Type
+		properties["acceleratorCount"] = c.accelerator.Count
+	}
+	return properties
+}
+
+// combinations returns every combination of the values of the matrix.
+func (m *DeploymentMatrix) combinations() []matrixCombination {
+	machineTypes, zones, accelerators := m.MachineTypes, m.Zones, m.Accelerators
+	if len(machineTypes) == 0 {
+		machineTypes = []string{""}
+	}
+	if len(zones) == 0 {
+		zones = []string{""}
+	}
+	if len(accelerators) == 0 {
+		accelerators = []MatrixAccelerator{{}}
+	}
+	var combinations []matrixCombination
+	for _, machineType := range machineTypes {
+		for _, zone := range zones {
+			for _, accelerator := range accelerators {
+				if accelerator.Type != "" && accelerator.Count == 0 {
+					accelerator.Count = 1
+				}
+				combinations = append(combinations, matrixCombination{machineType: machineType, zone: zone, accelerator: accelerator})
+			}
+		}
+	}
+	return combinations
+}
+
+func (m *DeploymentMatrix) validate(projectID string, name string) error {
+	if len(m.MachineTypes)+len(m.Zones)+len(m.Accelerators) == 0 {
+		return errors.New("matrix must set machineTypes, zones or accelerators")
+	}
+	for _, accelerator := range m.Accelerators {
+		if accelerator.Count < 0 || accelerator.Count > 8 {
+			return fmt.Errorf("invalid accelerator count for matrix: %d. Must be between 0 and 8", accelerator.Count)
+		}
+	}
+	return validateDeploymentTarget(projectID, numberedDeploymentName(name, len(m.combinations())-1))
+}
+
+// numberedDeploymentName returns the name of the i-th of several deployments
+// of a template, such as the deployments of the combinations of a matrix.
+func numberedDeploymentName(name string, i int) string {
+	return fmt.Sprintf("%s-%d", name, i+1)
+}
+
+// writeMatrixConfig writes the deployment configuration in src to dst, with
+// the properties of the combination set on every resource whose type is a
+// template.
+func writeMatrixConfig(src string, dst string, combination matrixCombination) error {
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	var config map[string]interface{}
+	err = yaml.Unmarshal(b, &config)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse deployment configuration %s", src)
+	}
+	resources, _ := config["resources"].([]interface{})
+	set := false
+	for _, resource := range resources {
+		r, ok := resource.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if resourceType, _ := r["type"].(string); !isTemplateFile(resourceType) {
+			continue
+		}
+		properties, _ := r["properties"].(map[string]interface{})
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+		for key, value := range combination.properties() {
+			properties[key] = value
+		}
+		r["properties"] = properties
+		set = true
+	}
+	if !set {
+		return fmt.Errorf("deployment configuration %s has no template resource to set the properties of the matrix on", src)
+	}
+	b, err = yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, b, 0644)
+}
+
+// runMatrix creates a deployment for every combination of the matrix, one
+// at a time, and runs the checks and tests against each of them. The
+// result of each check is recorded with the label of its combination, and
+// a summary of the combinations is printed once all of them have run.
+func (d *DeploymentManagerDeployment) runMatrix(registry Registry, dmTemplate *DeploymentManagerAutogenTemplate, name string, configFile string,
+	checkFiles []string, tests []*DeploymentTest) error {
+	dir, err := util.CreateTmpDir("deploymentMatrix")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	err = copyTemplate(dmTemplate.outDir, dir, nil)
+	if err != nil {
+		return err
+	}
+
+	combinations := d.Matrix.combinations()
+	failures := map[int]error{}
+	for i, combination := range combinations {
+		label := combination.label()
+		deployment := numberedDeploymentName(name, i)
+		config := filepath.Join(dir, filepath.Dir(configFile), fmt.Sprintf("matrix-%d-%s", i+1, filepath.Base(configFile)))
+		fmt.Printf("Testing combination %s of deployment matrix with deployment %s\n", label, deployment)
+		err := writeMatrixConfig(filepath.Join(dmTemplate.outDir, configFile), config, combination)
+		if err == nil {
+			err = d.deployCombination(registry, dmTemplate, deployment, config, checkFiles, tests, label)
+		}
+		if err != nil {
+			failures[i] = err
+		}
+	}
+
+	fmt.Printf("Deployment matrix of %s:\n", name)
+	var problems []string
+	for i, combination := range combinations {
+		if err, failed := failures[i]; failed {
+			fmt.Println(Red("  FAILED  " + combination.label()))
+			if merr, ok := err.(*multierror.Error); ok {
+				for _, e := range merr.Errors {
+					problems = append(problems, fmt.Sprintf("%s: %v", combination.label(), e))
+				}
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: %v", combination.label(), err))
+			}
+		} else {
+			fmt.Println(Green("  PASSED  " + combination.label()))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d combinations of the deployment matrix failed:\n  - %s",
+			len(failures), len(combinations), strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// deployCombination deploys a combination of the matrix, and deletes the
+// deployment unless KeepDeployment is set.
+func (d *DeploymentManagerDeployment) deployCombination(registry Registry, dmTemplate *DeploymentManagerAutogenTemplate, name string, config string,
+	checkFiles []string, tests []*DeploymentTest, label string) (err error) {
+	if !d.KeepDeployment {
+		defer func() {
+			if deleteErr := d.deleteDeployment(registry.GetExecutor(), name); deleteErr != nil {
+				err = multierror.Append(err, deleteErr)
+			}
+		}()
+	}
+	record := func(result CheckSummary) {
+		result.Name = label + "/" + result.Name
+		d.results = append(d.results, result)
+	}
+	return d.deploy(registry, dmTemplate, name, config, checkFiles, tests, record)
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDeploymentMatrixCombinations(t *testing.T) {
+	testCases := []struct {
+		name     string
+		matrix   DeploymentMatrix
+		expected []string
+	}{{
+		name:     "Machine types and zones",
+		matrix:   DeploymentMatrix{MachineTypes: []string{"e2-standard-2", "n1-highmem-8"}, Zones: []string{"us-central1-a", "europe-west1-b"}},
+		expected: []string{"e2-standard-2/us-central1-a", "e2-standard-2/europe-west1-b", "n1-highmem-8/us-central1-a", "n1-highmem-8/europe-west1-b"},
+	}, {
+		name: "Optional GPU",
+		matrix: DeploymentMatrix{MachineTypes: []string{"n1-standard-4"},
+			Accelerators: []MatrixAccelerator{{}, {Type: "nvidia-tesla-t4"}, {Type: "nvidia-tesla-v100", Count: 4}}},
+		expected: []string{"n1-standard-4", "n1-standard-4/nvidia-tesla-t4x1", "n1-standard-4/nvidia-tesla-v100x4"},
+	}, {
+		name:     "No GPU only",
+		matrix:   DeploymentMatrix{Accelerators: []MatrixAccelerator{{}}},
+		expected: []string{"default"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var labels []string
+			for _, combination := range tc.matrix.combinations() {
+				labels = append(labels, combination.label())
+			}
+			assert.Equal(t, tc.expected, labels)
+		})
+	}
+}
+
+func TestWriteMatrixConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "matrix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "test_config.yaml")
+	assert.NoError(t, ioutil.WriteFile(src, []byte(`imports:
+- path: solution.jinja
+resources:
+- name: solution
+  type: solution.jinja
+  properties:
+    zone: us-central1-f
+    machineType: e2-small
+    installPhpMyAdmin: true
+`), 0644))
+
+	dst := filepath.Join(dir, "matrix-1-test_config.yaml")
+	combination := matrixCombination{machineType: "n1-standard-4", accelerator: MatrixAccelerator{Type: "nvidia-tesla-t4", Count: 2}}
+	assert.NoError(t, writeMatrixConfig(src, dst, combination))
+
+	b, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	var config map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(b, &config))
+	assert.Equal(t, []interface{}{map[string]interface{}{"path": "solution.jinja"}}, config["imports"])
+	assert.Equal(t, map[string]interface{}{
+		"zone":              "us-central1-f",
+		"machineType":       "n1-standard-4",
+		"acceleratorType":   "nvidia-tesla-t4",
+		"acceleratorCount":  2,
+		"installPhpMyAdmin": true,
+	}, config["resources"].([]interface{})[0].(map[string]interface{})["properties"])
+
+	assert.NoError(t, ioutil.WriteFile(src, []byte("resources:\n- name: vm\n  type: compute.v1.instance\n"), 0644))
+	assert.Error(t, writeMatrixConfig(src, dst, combination))
+}
+
+func TestDeploymentManagerDeploymentMatrix(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "outdir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "test_config.yaml"),
+		[]byte("resources:\n- name: solution\n  type: solution.jinja\n"), 0644))
+
+	runs := []error{nil, nil, nil, nil, nil, nil, fmt.Errorf("exit status 1"), nil}
+	var configs []string
+	fcmd := testingexec.FakeCmd{}
+	executor := &testingexec.FakeExec{}
+	for _, runErr := range runs {
+		runErr := runErr
+		fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) {
+			switch {
+			case fcmd.Argv[0] == "bash":
+			case fcmd.Argv[3] == "create":
+				b, err := ioutil.ReadFile(fcmd.Argv[6])
+				assert.NoError(t, err)
+				configs = append(configs, string(b))
+			case fcmd.Argv[3] == "describe":
+				return []byte(describeOutput), nil, nil
+			}
+			return nil, nil, runErr
+		})
+		executor.CommandScript = append(executor.CommandScript,
+			func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+	}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = outDir
+	deployment := &DeploymentManagerDeployment{
+		BaseResource:         newTestBaseResource("DeploymentManagerDeployment", "wordpress"),
+		DeploymentManagerRef: autogen.GetReference(),
+		ProjectID:            "test-project",
+		Matrix:               &DeploymentMatrix{MachineTypes: []string{"e2-standard-2", "n1-highmem-8"}},
+	}
+	check := DeploymentCheck{Name: "vm-running"}
+	check.Script.File = "check.sh"
+	deployment.Checks = []DeploymentCheck{check}
+	r.RegisterResource(autogen, "dir")
+	r.RegisterResource(deployment, "dir")
+
+	err = deployment.Apply(r, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 combinations of the deployment matrix failed:\n  - n1-highmem-8: check vm-running failed")
+
+	var commands []string
+	for _, args := range fcmd.RunLog {
+		if args[0] == "bash" {
+			commands = append(commands, "check")
+			continue
+		}
+		commands = append(commands, args[3]+" "+args[4])
+	}
+	assert.Equal(t, []string{"create wordpress-1", "describe wordpress-1", "check", "delete wordpress-1",
+		"create wordpress-2", "describe wordpress-2", "check", "delete wordpress-2"}, commands)
+	assert.Len(t, configs, 2)
+	assert.Contains(t, configs[0], "machineType: e2-standard-2")
+	assert.Contains(t, configs[1], "machineType: n1-highmem-8")
+
+	results := deployment.checkResults()
+	assert.Len(t, results, 2)
+	assert.Equal(t, "e2-standard-2/vm-running", results[0].Name)
+	assert.Equal(t, "succeeded", results[0].Status)
+	assert.Equal(t, "n1-highmem-8/vm-running", results[1].Name)
+	assert.Equal(t, "failed", results[1].Status)
+}
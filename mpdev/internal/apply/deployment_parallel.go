@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// maxParallelDeployments bounds the cost of a parallel deployment test.
+const maxParallelDeployments = 10
+
+// resourceExistsRegex matches the errors of resources whose name is
+// already used by another resource, such as a resource of another
+// deployment.
+var resourceExistsRegex = regexp.MustCompile(`The resource '([^']+)' already exists`)
+
+// parallelDeploymentDescription is the description of a deployment by
+// gcloud, with the errors of its last operation.
+type parallelDeploymentDescription struct {
+	Deployment struct {
+		Operation struct {
+			Status string
+			Error  struct {
+				Errors []struct {
+					Code    string
+					Message string
+				}
+			}
+		}
+	}
+}
+
+func (d *DeploymentManagerDeployment) validateParallelDeployments(name string) error {
+	if d.Matrix != nil || d.SimulateWaiterFailure {
+		return errors.New("parallelDeployments cannot be combined with matrix or simulateWaiterFailure")
+	}
+	if d.ParallelDeployments < 2 || d.ParallelDeployments > maxParallelDeployments {
+		return fmt.Errorf("invalid parallelDeployments: %d. Must be between 2 and %d", d.ParallelDeployments, maxParallelDeployments)
+	}
+	return validateDeploymentTarget(d.ProjectID, numberedDeploymentName(name, d.ParallelDeployments-1))
+}
+
+// runParallel creates ParallelDeployments deployments from config at the
+// same time, waits for all of them to complete and checks that each of
+// them succeeded. The deployments are deleted unless KeepDeployment is set.
+func (d *DeploymentManagerDeployment) runParallel(executor exec.Interface, name string, config string) (err error) {
+	var names, operations []string
+	if !d.KeepDeployment {
+		defer func() {
+			if len(names) == 0 {
+				return
+			}
+			fmt.Printf("Deleting deployments %s\n", strings.Join(names, ", "))
+			args := append([]string{"deployment-manager", "deployments", "delete"}, names...)
+			deleteErr := runCommand(executor, "gcloud", append(args, "--project", d.ProjectID, "--quiet")...)
+			if deleteErr != nil {
+				err = multierror.Append(err, errors.Wrapf(deleteErr, "failed to delete deployments %s", strings.Join(names, ", ")))
+			}
+		}()
+	}
+
+	start := now()
+	fmt.Printf("Creating %d deployments of %s in parallel in project %s\n", d.ParallelDeployments, name, d.ProjectID)
+	for i := 0; i < d.ParallelDeployments; i++ {
+		deployment := numberedDeploymentName(name, i)
+		stdout, err := runCommandOutput(executor, "gcloud", "deployment-manager", "deployments", "create", deployment,
+			"--config", config, "--project", d.ProjectID, "--async", "--format", "value(name)")
+		if err != nil {
+			return errors.Wrapf(err, "failed to create deployment %s", deployment)
+		}
+		names = append(names, deployment)
+		operations = append(operations, strings.TrimSpace(string(stdout)))
+	}
+
+	// Failed operations are reported from the descriptions of the
+	// deployments, which name the resources that failed.
+	args := append([]string{"deployment-manager", "operations", "wait"}, operations...)
+	_ = runCommand(executor, "gcloud", append(args, "--project", d.ProjectID)...)
+
+	var problems []string
+	failed, collided := 0, false
+	for _, deployment := range names {
+		deploymentErrs, err := d.parallelDeploymentErrors(executor, deployment)
+		if err != nil {
+			return err
+		}
+		var checkErr error
+		if len(deploymentErrs) > 0 {
+			checkErr = errors.New(strings.Join(deploymentErrs, "; "))
+			failed++
+		}
+		d.results = append(d.results, newCheckSummary("parallel/"+deployment, start, checkErr))
+		for _, deploymentErr := range deploymentErrs {
+			problems = append(problems, fmt.Sprintf("%s: %s", deployment, deploymentErr))
+			collided = collided || strings.HasPrefix(deploymentErr, "resource ")
+		}
+	}
+	if failed == 0 {
+		fmt.Printf("All %d parallel deployments of %s succeeded\n", len(names), name)
+		return nil
+	}
+	message := fmt.Sprintf("%d of %d parallel deployments failed", failed, len(names))
+	if collided {
+		message += `. Resources that are not unique to a deployment collide with the resources of other deployments. Include the deployment name, such as env["deployment"], in their names`
+	}
+	return fmt.Errorf("%s:\n  - %s", message, strings.Join(problems, "\n  - "))
+}
+
+// parallelDeploymentErrors returns the errors of the operation that created
+// a deployment. Resources whose name is used by another resource are
+// reported as collisions.
+func (d *DeploymentManagerDeployment) parallelDeploymentErrors(executor exec.Interface, name string) ([]string, error) {
+	stdout, err := runCommandOutput(executor, "gcloud", "deployment-manager", "deployments", "describe", name,
+		"--project", d.ProjectID, "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe deployment %s", name)
+	}
+	var description parallelDeploymentDescription
+	err = json.Unmarshal(stdout, &description)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse description of deployment %s", name)
+	}
+
+	operation := description.Deployment.Operation
+	var deploymentErrs []string
+	// Messages of resource errors repeat the error of the API.
+	collisions := map[string]bool{}
+	for _, e := range operation.Error.Errors {
+		matches := resourceExistsRegex.FindAllStringSubmatch(e.Message, -1)
+		for _, match := range matches {
+			if !collisions[match[1]] {
+				collisions[match[1]] = true
+				deploymentErrs = append(deploymentErrs, fmt.Sprintf("resource %s already exists", match[1]))
+			}
+		}
+		if len(matches) == 0 {
+			deploymentErrs = append(deploymentErrs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+		}
+	}
+	if len(deploymentErrs) == 0 && operation.Status != "DONE" {
+		deploymentErrs = append(deploymentErrs, fmt.Sprintf("operation did not complete, status is %s", operation.Status))
+	}
+	return deploymentErrs, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+const parallelSucceededOutput = `{"deployment": {"name": "wordpress-1", "operation": {"status": "DONE"}}}`
+
+const parallelCollisionOutput = `{"deployment": {"name": "wordpress-2", "operation": {"status": "DONE", "error": {"errors": [{
+  "code": "RESOURCE_ERROR",
+  "message": "{\"ResourceType\":\"compute.v1.firewall\",\"ResourceErrorCode\":\"409\",\"ResourceErrorMessage\":{\"code\":409,\"errors\":[{\"message\":\"The resource 'projects/test-project/global/firewalls/allow-http' already exists\",\"reason\":\"alreadyExists\"}],\"message\":\"The resource 'projects/test-project/global/firewalls/allow-http' already exists\"}}"
+}]}}}}`
+
+const parallelQuotaOutput = `{"deployment": {"name": "wordpress-3", "operation": {"status": "DONE", "error": {"errors": [{
+  "code": "QUOTA_EXCEEDED",
+  "message": "Quota 'CPUS' exceeded."
+}]}}}}`
+
+func TestDeploymentManagerDeploymentParallel(t *testing.T) {
+	testCases := []struct {
+		name             string
+		descriptions     []string
+		keepDeployment   bool
+		errorContains    []string
+		expectedStatuses []string
+	}{{
+		name:             "No collisions",
+		descriptions:     []string{parallelSucceededOutput, parallelSucceededOutput, parallelSucceededOutput},
+		expectedStatuses: []string{"succeeded", "succeeded", "succeeded"},
+	}, {
+		name:         "Collision",
+		descriptions: []string{parallelSucceededOutput, parallelCollisionOutput, parallelQuotaOutput},
+		errorContains: []string{
+			"2 of 3 parallel deployments failed. Resources that are not unique to a deployment collide",
+			"  - wordpress-2: resource projects/test-project/global/firewalls/allow-http already exists\n",
+			"  - wordpress-3: QUOTA_EXCEEDED: Quota 'CPUS' exceeded.",
+		},
+		expectedStatuses: []string{"succeeded", "failed", "failed"},
+	}, {
+		name:             "Keep deployments",
+		descriptions:     []string{parallelSucceededOutput, parallelSucceededOutput, parallelSucceededOutput},
+		keepDeployment:   true,
+		expectedStatuses: []string{"succeeded", "succeeded", "succeeded"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			executor := &testingexec.FakeExec{}
+			fcmd := testingexec.FakeCmd{}
+			stdouts := []string{"operation-1", "operation-2", "operation-3", ""}
+			stdouts = append(stdouts, tc.descriptions...)
+			if !tc.keepDeployment {
+				stdouts = append(stdouts, "")
+			}
+			for _, stdout := range stdouts {
+				stdout := stdout
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return []byte(stdout), nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = "/tmp/outdir"
+			deployment := &DeploymentManagerDeployment{
+				BaseResource:         newTestBaseResource("DeploymentManagerDeployment", "wordpress"),
+				DeploymentManagerRef: autogen.GetReference(),
+				ProjectID:            "test-project",
+				ParallelDeployments:  3,
+				KeepDeployment:       tc.keepDeployment,
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(deployment, "dir")
+
+			err := deployment.Apply(r, false)
+			if len(tc.errorContains) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+				for _, contains := range tc.errorContains {
+					assert.Contains(t, err.Error(), contains)
+				}
+			}
+
+			assert.Equal(t, len(stdouts), fcmd.RunCalls)
+			assert.Equal(t, []string{"gcloud", "deployment-manager", "deployments", "create", "wordpress-1",
+				"--config", "/tmp/outdir/test_config.yaml", "--project", "test-project", "--async", "--format", "value(name)"}, fcmd.RunLog[0])
+			assert.Equal(t, []string{"gcloud", "deployment-manager", "operations", "wait",
+				"operation-1", "operation-2", "operation-3", "--project", "test-project"}, fcmd.RunLog[3])
+			assert.Equal(t, "wordpress-3", fcmd.RunLog[6][4])
+			if !tc.keepDeployment {
+				assert.Equal(t, []string{"gcloud", "deployment-manager", "deployments", "delete",
+					"wordpress-1", "wordpress-2", "wordpress-3", "--project", "test-project", "--quiet"}, fcmd.RunLog[7])
+			}
+
+			results := deployment.checkResults()
+			var statuses []string
+			for _, result := range results {
+				statuses = append(statuses, result.Status)
+			}
+			assert.Equal(t, tc.expectedStatuses, statuses)
+			assert.Equal(t, "parallel/wordpress-1", results[0].Name)
+		})
+	}
+}
+
+func TestValidateParallelDeployments(t *testing.T) {
+	testCases := []struct {
+		name       string
+		deployment DeploymentManagerDeployment
+		expectErr  bool
+	}{
+		{"Valid", DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: 5}, false},
+		{"Single deployment", DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: 1}, true},
+		{"Too many deployments", DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: 11}, true},
+		{"Matrix", DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: 2, Matrix: &DeploymentMatrix{Zones: []string{"us-central1-a"}}}, true},
+		{"Waiter failure", DeploymentManagerDeployment{ProjectID: "test-project", ParallelDeployments: 2, SimulateWaiterFailure: true}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.deployment.validateParallelDeployments("wordpress")
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
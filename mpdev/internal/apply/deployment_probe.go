@@ -0,0 +1,390 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+const (
+	defaultProbeTimeout       = 30 * time.Second
+	defaultProbeRetryInterval = 10 * time.Second
+)
+
+// DeploymentTest describes smoke tests that are run against a deployment
+// created by a DeploymentManagerDeployment referencing it in TestRefs.
+// Values of probes can reference outputs of the deployment as ${outputName},
+// and the deployment name and project as ${DEPLOYMENT_NAME} and
+// ${DEPLOYMENT_PROJECT}. Applying a DeploymentTest only validates it.
+type DeploymentTest struct {
+	BaseResource
+	Probes []Probe
+}
+
+// Probe is a single check of a deployment. Exactly one of HTTP, TCP or SSH
+// must be set.
+type Probe struct {
+	Name string
+	HTTP *HTTPProbe `json:"http"`
+	TCP  *TCPProbe  `json:"tcp"`
+	SSH  *SSHProbe  `json:"ssh"`
+	// Retries is the number of times a failed probe is retried
+	Retries int
+	// RetryInterval between attempts of the probe. Defaults to 10s
+	RetryInterval string
+	// Timeout of each attempt of the probe. Defaults to 30s
+	Timeout string
+}
+
+// HTTPProbe sends a GET request to a URL, such as ${adminUrl}, and expects
+// a status code. Redirects are followed, unless the expected status is a
+// redirect.
+type HTTPProbe struct {
+	URL string `json:"url"`
+	// ExpectedStatus of the response. Defaults to 200
+	ExpectedStatus int
+	// Insecure skips verification of the TLS certificate of the server,
+	// which is needed for deployments with self-signed certificates
+	Insecure bool
+}
+
+// TCPProbe checks that a connection can be opened to a port.
+type TCPProbe struct {
+	Host string
+	Port int
+}
+
+// SSHProbe runs a command on a VM of the deployment with gcloud compute ssh,
+// such as to check that a service is running or that the expected version
+// of a package is installed. Exactly one of Command, Service or Package must
+// be set. Command, Instance, Zone, User and ExpectedOutput can reference
+// outputs of the deployment. The probe fails if the command exits with another status than
+// ExpectedExitStatus, or if its output does not contain ExpectedOutput or
+// does not match ExpectedOutputPattern.
+type SSHProbe struct {
+	Instance string
+	Zone     string
+	Command  string
+	// Service is a systemd unit that must be active, such as
+	// google-guest-agent
+	Service string
+	// Package is a deb or rpm package that must be installed, whose version
+	// is the output of the probe
+	Package        string
+	ExpectedOutput string
+	// ExpectedOutputPattern is a regular expression that the output must
+	// match, such as ^2\.4\.
+	ExpectedOutputPattern string
+	// ExpectedExitStatus of the command. Defaults to 0
+	ExpectedExitStatus int
+	// TunnelThroughIAP connects to the VM through Identity-Aware Proxy,
+	// such as for VMs without an external IP address
+	TunnelThroughIAP bool
+	// User that runs the command. Defaults to the user of gcloud
+	User string
+}
+
+// unitNameRegex matches the names of systemd units and of packages, which
+// are passed to the shell of the VM unquoted.
+var unitNameRegex = regexp.MustCompile(`^[A-Za-z0-9@._+:-]+$`)
+
+// command returns the command run by the probe on the VM.
+func (s *SSHProbe) command(vars map[string]string) (string, error) {
+	switch {
+	case s.Service != "":
+		return "systemctl is-active " + s.Service, nil
+	case s.Package != "":
+		return fmt.Sprintf("dpkg-query -W -f='${Version}' %[1]s 2>/dev/null || rpm -q --qf '%%{VERSION}-%%{RELEASE}' %[1]s", s.Package), nil
+	}
+	return expandProbeValue(s.Command, vars)
+}
+
+// Apply validates the probes of the deployment test.
+func (d *DeploymentTest) Apply(registry Registry, dryRun bool) error {
+	for _, probe := range d.Probes {
+		err := probe.validate()
+		if err != nil {
+			return ValidationError(errors.Wrapf(err, "invalid probe %s of deployment test %s", probe.Name, d.Metadata.Name))
+		}
+	}
+	return nil
+}
+
+// run runs every probe of the deployment test, after substituting vars in
+// their values. The result of each probe is passed to record, if set.
+func (d *DeploymentTest) run(executor exec.Interface, projectID string, vars map[string]string, record func(CheckSummary)) error {
+	var result error
+	for _, probe := range d.Probes {
+		fmt.Printf("Running probe %s of deployment test %s\n", probe.Name, d.Metadata.Name)
+		start := time.Now()
+		err := probe.run(executor, projectID, vars)
+		if record != nil {
+			record(newCheckSummary(d.Metadata.Name+"/"+probe.Name, start, err))
+		}
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+func (p *Probe) validate() error {
+	set := 0
+	for _, isSet := range []bool{p.HTTP != nil, p.TCP != nil, p.SSH != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("exactly one of http, tcp or ssh must be set")
+	}
+	if p.Retries < 0 {
+		return errors.New("retries cannot be negative")
+	}
+	_, _, err := p.durations()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.HTTP != nil:
+		if p.HTTP.URL == "" {
+			return errors.New("url cannot be empty for http probe")
+		}
+	case p.TCP != nil:
+		if p.TCP.Host == "" {
+			return errors.New("host cannot be empty for tcp probe")
+		}
+		if p.TCP.Port <= 0 || p.TCP.Port > 65535 {
+			return fmt.Errorf("invalid port for tcp probe: %d", p.TCP.Port)
+		}
+	case p.SSH != nil:
+		if p.SSH.Instance == "" || p.SSH.Zone == "" {
+			return errors.New("instance and zone must be set for ssh probe")
+		}
+		commands := 0
+		for _, command := range []string{p.SSH.Command, p.SSH.Service, p.SSH.Package} {
+			if command != "" {
+				commands++
+			}
+		}
+		if commands != 1 {
+			return errors.New("exactly one of command, service or package must be set for ssh probe")
+		}
+		for _, name := range []string{p.SSH.Service, p.SSH.Package} {
+			if name != "" && !unitNameRegex.MatchString(name) {
+				return fmt.Errorf("invalid service or package name for ssh probe: %s", name)
+			}
+		}
+		if _, err := regexp.Compile(p.SSH.ExpectedOutputPattern); err != nil {
+			return errors.Wrapf(err, "invalid expectedOutputPattern for ssh probe")
+		}
+	}
+	return nil
+}
+
+func (p *Probe) durations() (timeout time.Duration, interval time.Duration, err error) {
+	timeout, interval = defaultProbeTimeout, defaultProbeRetryInterval
+	if p.Timeout != "" {
+		timeout, err = time.ParseDuration(p.Timeout)
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "invalid timeout: %s", p.Timeout)
+		}
+	}
+	if p.RetryInterval != "" {
+		interval, err = time.ParseDuration(p.RetryInterval)
+		if err != nil {
+			return 0, 0, errors.Wrapf(err, "invalid retryInterval: %s", p.RetryInterval)
+		}
+	}
+	return timeout, interval, nil
+}
+
+func (p *Probe) run(executor exec.Interface, projectID string, vars map[string]string) error {
+	timeout, interval, err := p.durations()
+	if err != nil {
+		return err
+	}
+
+	attempts := p.Retries + 1
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			fmt.Printf("Probe %s failed, retrying in %s: %v\n", p.Name, interval, err)
+			time.Sleep(interval)
+		}
+		err = p.runOnce(executor, projectID, vars, timeout)
+		if err == nil {
+			return nil
+		}
+	}
+	return errors.Wrapf(err, "probe %s failed after %d attempts", p.Name, attempts)
+}
+
+func (p *Probe) runOnce(executor exec.Interface, projectID string, vars map[string]string, timeout time.Duration) error {
+	switch {
+	case p.HTTP != nil:
+		url, err := expandProbeValue(p.HTTP.URL, vars)
+		if err != nil {
+			return err
+		}
+		return probeHTTP(url, p.HTTP.ExpectedStatus, p.HTTP.Insecure, timeout)
+	case p.TCP != nil:
+		host, err := expandProbeValue(p.TCP.Host, vars)
+		if err != nil {
+			return err
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(p.TCP.Port)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case p.SSH != nil:
+		return p.SSH.run(executor, projectID, vars, timeout)
+	}
+	return errors.New("exactly one of http, tcp or ssh must be set")
+}
+
+// ssh runs the command of the probe on the VM, and returns the name of the
+// instance, the output of the command and its exit status. Errors are only
+// returned when gcloud cannot connect to the VM.
+func (s *SSHProbe) ssh(executor exec.Interface, projectID string, vars map[string]string, timeout time.Duration) (string, []byte, int, error) {
+	var values []string
+	for _, value := range []string{s.Instance, s.Zone, s.User} {
+		expanded, err := expandProbeValue(value, vars)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		values = append(values, expanded)
+	}
+	instance, zone, user := values[0], values[1], values[2]
+	command, err := s.command(vars)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	destination := instance
+	if user != "" {
+		destination = user + "@" + instance
+	}
+	args := []string{"compute", "ssh", destination, "--project", projectID, "--zone", zone, "--command", command, "--quiet"}
+	if s.TunnelThroughIAP {
+		args = append(args, "--tunnel-through-iap")
+	}
+	args = append(args, "--ssh-flag", fmt.Sprintf("-oConnectTimeout=%d", int(timeout.Seconds())))
+	stdout, err := runCommandOutput(executor, "gcloud", args...)
+	status := exitStatus(errors.Cause(err))
+	// gcloud compute ssh exits with 255 when it cannot connect.
+	if err != nil && (status < 0 || status == 255) {
+		return instance, nil, status, errors.Wrapf(err, "failed to connect to instance %s", instance)
+	}
+	return instance, stdout, status, nil
+}
+
+func (s *SSHProbe) run(executor exec.Interface, projectID string, vars map[string]string, timeout time.Duration) error {
+	instance, stdout, status, err := s.ssh(executor, projectID, vars, timeout)
+	if err != nil {
+		return err
+	}
+	if status != s.ExpectedExitStatus {
+		switch {
+		case s.Service != "" && s.ExpectedExitStatus == 0:
+			return fmt.Errorf("service %s is not active on instance %s: %s", s.Service, instance, strings.TrimSpace(string(stdout)))
+		case s.Package != "" && s.ExpectedExitStatus == 0:
+			return fmt.Errorf("package %s is not installed on instance %s", s.Package, instance)
+		}
+		return fmt.Errorf("command on instance %s exited with status %d, expected %d", instance, status, s.ExpectedExitStatus)
+	}
+	expectedOutput, err := expandProbeValue(s.ExpectedOutput, vars)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(stdout), expectedOutput) {
+		return fmt.Errorf("output of command on instance %s does not contain %q: %s",
+			instance, expectedOutput, stdout)
+	}
+	if s.ExpectedOutputPattern != "" && !regexp.MustCompile(s.ExpectedOutputPattern).Match(stdout) {
+		return fmt.Errorf("output of command on instance %s does not match %q: %s",
+			instance, s.ExpectedOutputPattern, stdout)
+	}
+	return nil
+}
+
+func probeHTTP(url string, expectedStatus int, insecure bool, timeout time.Duration) error {
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+	client := &http.Client{Timeout: timeout}
+	if expectedStatus >= 300 && expectedStatus < 400 {
+		// The redirect itself is checked, such as a redirect to a login
+		// page, so it is not followed.
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	if insecure {
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("GET %s returned status %d, expected %d", url, resp.StatusCode, expectedStatus)
+	}
+	return nil
+}
+
+// expandProbeValue substitutes ${name} references in value with vars. It
+// is an error to reference a variable that is not set.
+func expandProbeValue(value string, vars map[string]string) (string, error) {
+	var missing []string
+	expanded := os.Expand(value, func(name string) string {
+		v, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%q references unknown deployment outputs: %s", value, strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+func getDeploymentTest(registry Registry, ref Reference) (*DeploymentTest, error) {
+	rs := registry.GetResource(ref)
+	if rs == nil {
+		return nil, fmt.Errorf("deployment test not found %+v", ref)
+	}
+
+	test, ok := rs.(*DeploymentTest)
+	if !ok {
+		return nil, fmt.Errorf("referenced deployment test is not correct type %+v", ref)
+	}
+	return test, nil
+}
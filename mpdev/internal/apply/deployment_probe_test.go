@@ -0,0 +1,270 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestProbeValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		probe     Probe
+		expectErr bool
+	}{{
+		name:  "Valid HTTP probe",
+		probe: Probe{HTTP: &HTTPProbe{URL: "${adminUrl}"}, Timeout: "5s"},
+	}, {
+		name:      "No probe type",
+		probe:     Probe{},
+		expectErr: true,
+	}, {
+		name:      "Multiple probe types",
+		probe:     Probe{HTTP: &HTTPProbe{URL: "http://example.com"}, TCP: &TCPProbe{Host: "h", Port: 80}},
+		expectErr: true,
+	}, {
+		name:      "Invalid port",
+		probe:     Probe{TCP: &TCPProbe{Host: "h", Port: 70000}},
+		expectErr: true,
+	}, {
+		name:      "Invalid timeout",
+		probe:     Probe{TCP: &TCPProbe{Host: "h", Port: 80}, Timeout: "soon"},
+		expectErr: true,
+	}, {
+		name:      "SSH probe missing command",
+		probe:     Probe{SSH: &SSHProbe{Instance: "vm", Zone: "us-central1-a"}},
+		expectErr: true,
+	}, {
+		name:  "SSH service probe",
+		probe: Probe{SSH: &SSHProbe{Instance: "vm", Zone: "us-central1-a", Service: "google-guest-agent", TunnelThroughIAP: true}},
+	}, {
+		name:      "SSH probe with command and package",
+		probe:     Probe{SSH: &SSHProbe{Instance: "vm", Zone: "us-central1-a", Command: "apache2 -v", Package: "apache2"}},
+		expectErr: true,
+	}, {
+		name:      "SSH probe with invalid package",
+		probe:     Probe{SSH: &SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "apache2; reboot"}},
+		expectErr: true,
+	}, {
+		name:      "SSH probe with invalid pattern",
+		probe:     Probe{SSH: &SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "apache2", ExpectedOutputPattern: "^2.4.("}},
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.probe.validate()
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeploymentTestRun(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	fcmd := testingexec.FakeCmd{
+		RunScript: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte("active\n"), nil, nil },
+		},
+	}
+	executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+
+	test := &DeploymentTest{
+		BaseResource: newTestBaseResource("DeploymentTest", "smoke"),
+		Probes: []Probe{{
+			Name:          "admin-ui",
+			HTTP:          &HTTPProbe{URL: "${adminUrl}/login"},
+			Retries:       2,
+			RetryInterval: "1ms",
+		}, {
+			Name: "port",
+			TCP:  &TCPProbe{Host: "${ip}", Port: port},
+		}, {
+			Name: "service",
+			SSH:  &SSHProbe{Instance: "${DEPLOYMENT_NAME}-vm", Zone: "us-central1-a", Command: "systemctl is-active app", ExpectedOutput: "active"},
+		}},
+	}
+	assert.NoError(t, test.Apply(nil, false))
+
+	vars := map[string]string{"adminUrl": server.URL, "ip": "127.0.0.1", "DEPLOYMENT_NAME": "wordpress"}
+	err = test.run(executor, "test-project", vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, [][]string{{"gcloud", "compute", "ssh", "wordpress-vm", "--project", "test-project",
+		"--zone", "us-central1-a", "--command", "systemctl is-active app", "--quiet", "--ssh-flag", "-oConnectTimeout=30"}},
+		fcmd.RunLog)
+}
+
+func TestDeploymentTestRunFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Reserve a port and close it so that connections are refused.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+
+	test := &DeploymentTest{
+		BaseResource: newTestBaseResource("DeploymentTest", "smoke"),
+		Probes: []Probe{{
+			Name:          "admin-ui",
+			HTTP:          &HTTPProbe{URL: server.URL},
+			Retries:       1,
+			RetryInterval: "1ms",
+		}, {
+			Name:    "port",
+			TCP:     &TCPProbe{Host: addr.IP.String(), Port: addr.Port},
+			Timeout: "1s",
+		}, {
+			Name: "unknown-output",
+			HTTP: &HTTPProbe{URL: "${missing}"},
+		}},
+	}
+
+	err = test.run(&testingexec.FakeExec{}, "test-project", map[string]string{}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "returned status 404, expected 200")
+	assert.Contains(t, err.Error(), strconv.Itoa(addr.Port))
+	assert.Contains(t, err.Error(), "unknown deployment outputs: missing")
+}
+
+func TestProbeHTTPRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, probeHTTP(server.URL, http.StatusFound, false, defaultProbeTimeout), "an expected redirect is not followed")
+	assert.NoError(t, probeHTTP(server.URL, 0, false, defaultProbeTimeout), "redirects are followed by default")
+	err := probeHTTP(server.URL, http.StatusMovedPermanently, false, defaultProbeTimeout)
+	assert.EqualError(t, err, fmt.Sprintf("GET %s returned status 302, expected 301", server.URL))
+}
+
+func TestSSHProbeRun(t *testing.T) {
+	testCases := []struct {
+		name         string
+		probe        SSHProbe
+		stdout       string
+		err          error
+		expectedArgs []string
+		expectErr    string
+	}{{
+		name:   "Active service through IAP",
+		probe:  SSHProbe{Instance: "${DEPLOYMENT_NAME}-vm", Zone: "us-central1-a", Service: "google-guest-agent", TunnelThroughIAP: true},
+		stdout: "active\n",
+		expectedArgs: []string{"gcloud", "compute", "ssh", "wordpress-vm", "--project", "test-project", "--zone", "us-central1-a",
+			"--command", "systemctl is-active google-guest-agent", "--quiet", "--tunnel-through-iap", "--ssh-flag", "-oConnectTimeout=30"},
+	}, {
+		name:      "Inactive service",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Service: "apache2"},
+		stdout:    "inactive\n",
+		err:       testingexec.FakeExitError{Status: 3},
+		expectErr: "service apache2 is not active on instance vm: inactive",
+	}, {
+		name:   "Package version",
+		probe:  SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "apache2", ExpectedOutputPattern: `^2\.4\.`, User: "admin"},
+		stdout: "2.4.57-2",
+		expectedArgs: []string{"gcloud", "compute", "ssh", "admin@vm", "--project", "test-project", "--zone", "us-central1-a",
+			"--command", "dpkg-query -W -f='${Version}' apache2 2>/dev/null || rpm -q --qf '%{VERSION}-%{RELEASE}' apache2",
+			"--quiet", "--ssh-flag", "-oConnectTimeout=30"},
+	}, {
+		name:      "Unexpected package version",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "apache2", ExpectedOutputPattern: `^2\.4\.`},
+		stdout:    "2.2.34",
+		expectErr: `output of command on instance vm does not match "^2\\.4\\.": 2.2.34`,
+	}, {
+		name:      "Missing package",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "apache2"},
+		err:       testingexec.FakeExitError{Status: 1},
+		expectErr: "package apache2 is not installed on instance vm",
+	}, {
+		name:  "Absent package",
+		probe: SSHProbe{Instance: "vm", Zone: "us-central1-a", Package: "telnet", ExpectedExitStatus: 1},
+		err:   testingexec.FakeExitError{Status: 1},
+	}, {
+		name:      "Unexpected exit status",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Command: "test -e /etc/ssh/ssh_host_rsa_key", ExpectedExitStatus: 1},
+		expectErr: "command on instance vm exited with status 0, expected 1",
+	}, {
+		name:   "Expanded expected output",
+		probe:  SSHProbe{Instance: "vm", Zone: "us-central1-a", Command: "hostname", ExpectedOutput: "${DEPLOYMENT_NAME}-vm"},
+		stdout: "wordpress-vm\n",
+	}, {
+		name:      "Unexpected expanded output",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Command: "hostname", ExpectedOutput: "${DEPLOYMENT_NAME}-vm"},
+		stdout:    "other-vm\n",
+		expectErr: "output of command on instance vm does not contain \"wordpress-vm\": other-vm\n",
+	}, {
+		name:      "Connection failure",
+		probe:     SSHProbe{Instance: "vm", Zone: "us-central1-a", Command: "true"},
+		err:       testingexec.FakeExitError{Status: 255},
+		expectErr: "failed to connect to instance vm: exit 255",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return []byte(tc.stdout), nil, tc.err },
+			}}
+			executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+			p := Probe{SSH: &tc.probe}
+			assert.NoError(t, p.validate())
+
+			err := tc.probe.run(executor, "test-project", map[string]string{"DEPLOYMENT_NAME": "wordpress"}, defaultProbeTimeout)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.expectedArgs != nil {
+				assert.Equal(t, [][]string{tc.expectedArgs}, fcmd.RunLog)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// waiterFailureGrace is the time allowed, on top of waiterTimeoutSecs, for
+// creating the resources of a deployment before its waiter starts, and for
+// gcloud to report the failure.
+const waiterFailureGrace = 5 * time.Minute
+
+var (
+	// statusVariablePathRegex matches the status-variable-path metadata
+	// item that autogen templates pass to the software status script, in
+	// the YAML of Jinja templates and in the dicts of Python templates.
+	statusVariablePathRegex = regexp.MustCompile(`(['"]?key['"]?\s*:\s*['"]?status-variable-path['"]?\s*,?\s*['"]?value['"]?\s*:\s*)[^\s,}]+`)
+	// defaultWaiterErrorRegex matches the error of deployments whose waiter
+	// timed out.
+	defaultWaiterErrorRegex = regexp.MustCompile(`(?i)timed?\s?out`)
+)
+
+// brokenStatusVariablePath is the path that the startup script signals in
+// simulated waiter failures, which the waiter does not watch.
+const brokenStatusVariablePath = "mpdev-broken-signal"
+
+// waiterTimeout returns the waiterTimeoutSecs of the waiter of an autogen
+// deployment spec.
+func waiterTimeout(spec map[string]interface{}) (time.Duration, bool) {
+	for _, status := range findFields(spec, "applicationStatus", "application_status") {
+		if statusType, _ := field(status, "type").(string); statusType != "WAITER" {
+			continue
+		}
+		waiter, _ := field(status, "waiter").(map[string]interface{})
+		if timeout, ok := number(field(waiter, "waiterTimeoutSecs", "waiter_timeout_secs")); ok && timeout > 0 {
+			return time.Duration(timeout * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
+
+// breakWaiterSignal copies the Deployment Manager template in src to dst,
+// overriding the status-variable-path metadata of the VMs such that the
+// startup script signals a variable that the waiter does not watch.
+func breakWaiterSignal(src string, dst string) error {
+	overridden := false
+	err := copyTemplate(src, dst, func(path string, contents []byte) []byte {
+		if !isTemplateFile(path) || !statusVariablePathRegex.Match(contents) {
+			return contents
+		}
+		overridden = true
+		return statusVariablePathRegex.ReplaceAll(contents, []byte("${1}'"+brokenStatusVariablePath+"'"))
+	})
+	if err != nil {
+		return err
+	}
+	if !overridden {
+		return fmt.Errorf("no template in %s sets the status-variable-path metadata of a VM, so the startup signal cannot be broken", src)
+	}
+	return nil
+}
+
+// expectedWaiterError returns the regular expression that the error of a
+// simulated waiter failure must match.
+func (d *DeploymentManagerDeployment) expectedWaiterError() (*regexp.Regexp, error) {
+	if d.ExpectedWaiterError == "" {
+		return defaultWaiterErrorRegex, nil
+	}
+	expected, err := regexp.Compile(d.ExpectedWaiterError)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid expectedWaiterError")
+	}
+	return expected, nil
+}
+
+// simulateWaiterFailure creates the deployment with its startup signal
+// broken, and checks that it fails within the waiter timeout with the
+// error that customers would see.
+func (d *DeploymentManagerDeployment) simulateWaiterFailure(executor exec.Interface, dmTemplate *DeploymentManagerAutogenTemplate, name string, configFile string, timeout time.Duration) error {
+	dir, err := util.CreateTmpDir("waiterFailure")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	err = breakWaiterSignal(dmTemplate.outDir, dir)
+	if err != nil {
+		return err
+	}
+
+	expected, err := d.expectedWaiterError()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Creating deployment %s in project %s with a broken startup signal, which should fail within %s\n", name, d.ProjectID, timeout)
+	var stderr bytes.Buffer
+	cmd := executor.Command("gcloud", "deployment-manager", "deployments", "create", name,
+		"--config", filepath.Join(dir, configFile), "--project", d.ProjectID)
+	cmd.SetStdout(os.Stdout)
+	cmd.SetStderr(io.MultiWriter(os.Stderr, &stderr))
+	start := now()
+	err = cmd.Run()
+	elapsed := now().Sub(start)
+
+	var result error
+	switch {
+	case err == nil:
+		result = fmt.Errorf("deployment %s succeeded with a broken startup signal, so its waiter does not wait for the startup script", name)
+	case elapsed > timeout+waiterFailureGrace:
+		result = fmt.Errorf("deployment %s failed after %s, but waiterTimeoutSecs is %s", name, elapsed.Round(time.Second), timeout)
+	case !expected.Match(stderr.Bytes()):
+		result = errors.Wrapf(err, "deployment %s failed with an error that does not match %q", name, expected)
+	}
+	d.results = append(d.results, newCheckSummary("waiter-failure", start, result))
+	if result != nil {
+		return result
+	}
+	fmt.Printf("Deployment %s failed as expected after %s\n", name, elapsed.Round(time.Second))
+	return nil
+}
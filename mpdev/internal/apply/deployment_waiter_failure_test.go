@@ -0,0 +1,226 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+const waiterJinja = `resources:
+- name: {{ env["deployment"] }}-vm
+  type: compute.v1.instance
+  properties:
+    metadata:
+      items:
+      - key: startup-script
+        value: {{ imports['software_status.sh'] }}
+      - key: status-variable-path
+        value: status
+`
+
+const waiterPython = `def GenerateConfig(context):
+  metadata = [{'key': 'status-config-url', 'value': config_url},
+              {'key': 'status-variable-path', 'value': 'status'}]
+`
+
+func TestBreakWaiterSignal(t *testing.T) {
+	testCases := []struct {
+		name      string
+		files     map[string]string
+		expected  map[string]string
+		expectErr bool
+	}{{
+		name:     "Jinja template",
+		files:    map[string]string{"solution.jinja": waiterJinja, "test_config.yaml": "imports: []\n"},
+		expected: map[string]string{"test_config.yaml": "imports: []\n"},
+	}, {
+		name:  "Python template",
+		files: map[string]string{"vm/instance.py": waiterPython},
+	}, {
+		name:      "No status metadata",
+		files:     map[string]string{"solution.jinja": "resources: []\n"},
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := ioutil.TempDir("", "template")
+			assert.NoError(t, err)
+			defer os.RemoveAll(src)
+			dst, err := ioutil.TempDir("", "broken")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			for name, contents := range tc.files {
+				assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(src, name)), 0755))
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(src, name), []byte(contents), 0644))
+			}
+
+			err = breakWaiterSignal(src, dst)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for name, contents := range tc.files {
+				b, err := ioutil.ReadFile(filepath.Join(dst, name))
+				assert.NoError(t, err)
+				if expected, ok := tc.expected[name]; ok {
+					assert.Equal(t, expected, string(b))
+					continue
+				}
+				assert.NotEqual(t, contents, string(b))
+				assert.Contains(t, string(b), "'"+brokenStatusVariablePath+"'")
+				assert.Regexp(t, statusVariablePathRegex, string(b))
+			}
+		})
+	}
+}
+
+func TestSimulateWaiterFailure(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+
+	outDir, err := ioutil.TempDir("", "outdir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "solution.jinja"), []byte(waiterJinja), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outDir, "test_config.yaml"), []byte("imports: []\n"), 0644))
+
+	var spec map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+singleVm:
+  applicationStatus:
+    type: WAITER
+    waiter:
+      waiterTimeoutSecs: 300
+`), &spec))
+
+	timeoutErr := []byte("ERROR: (gcloud.deployment-manager.deployments.create) Waiter wordpress-software-status timed out\n")
+	testCases := []struct {
+		name          string
+		spec          map[string]interface{}
+		expectedError string
+		stderr        []byte
+		createErr     error
+		elapsed       time.Duration
+		errorContains string
+		expectedRuns  int
+	}{{
+		name:         "Waiter times out",
+		spec:         spec,
+		stderr:       timeoutErr,
+		createErr:    fmt.Errorf("exit status 1"),
+		elapsed:      6 * time.Minute,
+		expectedRuns: 2,
+	}, {
+		name:          "Deployment succeeds",
+		spec:          spec,
+		elapsed:       2 * time.Minute,
+		errorContains: "succeeded with a broken startup signal",
+		expectedRuns:  2,
+	}, {
+		name:          "Deployment fails too late",
+		spec:          spec,
+		stderr:        timeoutErr,
+		createErr:     fmt.Errorf("exit status 1"),
+		elapsed:       time.Hour,
+		errorContains: "failed after 1h0m0s, but waiterTimeoutSecs is 5m0s",
+		expectedRuns:  2,
+	}, {
+		name:          "Unexpected error",
+		spec:          spec,
+		expectedError: "Waiter .* failed",
+		stderr:        timeoutErr,
+		createErr:     fmt.Errorf("exit status 1"),
+		elapsed:       6 * time.Minute,
+		errorContains: `does not match "Waiter .* failed"`,
+		expectedRuns:  2,
+	}, {
+		name:          "No waiter",
+		spec:          map[string]interface{}{},
+		errorContains: "has no waiter with a waiterTimeoutSecs",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+			now = func() time.Time {
+				c := clock
+				clock = clock.Add(tc.elapsed)
+				return c
+			}
+
+			var config string
+			fcmd := testingexec.FakeCmd{}
+			fcmd.RunScript = append(fcmd.RunScript,
+				func() ([]byte, []byte, error) {
+					config = fcmd.Argv[6]
+					b, err := ioutil.ReadFile(filepath.Join(filepath.Dir(config), "solution.jinja"))
+					assert.NoError(t, err)
+					assert.Contains(t, string(b), brokenStatusVariablePath)
+					return nil, tc.stderr, tc.createErr
+				},
+				func() ([]byte, []byte, error) { return nil, nil, nil })
+			executor := &testingexec.FakeExec{}
+			for i := 0; i < 2; i++ {
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{DeploymentSpec: tc.spec})
+			autogen.outDir = outDir
+			deployment := &DeploymentManagerDeployment{
+				BaseResource:          newTestBaseResource("DeploymentManagerDeployment", "wordpress"),
+				DeploymentManagerRef:  autogen.GetReference(),
+				ProjectID:             "test-project",
+				SimulateWaiterFailure: true,
+				ExpectedWaiterError:   tc.expectedError,
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(deployment, "dir")
+
+			err := deployment.Apply(r, false)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, fcmd.RunLog, tc.expectedRuns)
+			if tc.expectedRuns == 0 {
+				return
+			}
+			assert.Equal(t, "delete", fcmd.RunLog[1][3])
+			assert.NotContains(t, config, outDir)
+			_, err = os.Stat(config)
+			assert.True(t, os.IsNotExist(err), "broken template is removed")
+
+			results := deployment.checkResults()
+			assert.Len(t, results, 1)
+			assert.Equal(t, "waiter-failure", results[0].Name)
+			assert.Equal(t, tc.errorContains != "", results[0].Status == "failed")
+		})
+	}
+}
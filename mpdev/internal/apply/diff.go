@@ -0,0 +1,267 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// Statuses of a file that differs between a published and a local package.
+const (
+	FileAdded    = "added"
+	FileRemoved  = "removed"
+	FileModified = "modified"
+)
+
+// FileChange is a file that differs between a published package and the
+// package produced from the local configuration.
+type FileChange struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	// Diff is the unified diff of a modified file.
+	Diff string `json:"diff,omitempty"`
+}
+
+// PackageDiff lists the files that applying a resource would change in its
+// published package.
+type PackageDiff struct {
+	Reference Reference    `json:"reference"`
+	Published string       `json:"published"`
+	Changes   []FileChange `json:"changes"`
+}
+
+// differ is implemented by resources whose published artifact can be
+// compared with the artifact produced from the local configuration.
+type differ interface {
+	diff(registry Registry) (*PackageDiff, error)
+}
+
+// generator is implemented by resources that only produce local files when
+// they are applied, which diff applies to produce the packages it compares.
+type generator interface {
+	generate(registry Registry) error
+}
+
+// generate runs autogen, without publishing anything.
+func (dm *DeploymentManagerAutogenTemplate) generate(registry Registry) error {
+	return dm.Apply(registry, false)
+}
+
+// Diff compares the published package of every resource that supports it
+// with the package that applying the resource would publish. The resources
+// that produce the packages, such as a DeploymentManagerAutogenTemplate, are
+// generated first. Other dependencies are only applied in dry run mode,
+// such that nothing is created or uploaded.
+func (r *registry) Diff() ([]PackageDiff, error) {
+	resources, err := r.topologicalSort()
+	if err != nil {
+		return nil, err
+	}
+
+	// needed contains the resources that support diffs and their transitive
+	// dependencies.
+	needed := r.withDependencies(resources, func(rs Resource) bool {
+		_, ok := rs.(differ)
+		return ok
+	})
+
+	diffs := []PackageDiff{}
+	for _, resource := range resources {
+		ref := resource.GetReference()
+		if !needed[ref] {
+			continue
+		}
+		if g, ok := resource.(generator); ok {
+			fmt.Printf("Generating resource %+v\n", ref)
+			if err := g.generate(r.forResource(resource)); err != nil {
+				return nil, errors.Wrapf(err, "Error in resource %+v\n", ref)
+			}
+			continue
+		}
+		d, ok := resource.(differ)
+		if !ok {
+			fmt.Printf("Validating resource %+v, which is not created by diff\n", ref)
+			if err := resource.Apply(r.forResource(resource), true); err != nil {
+				return nil, errors.Wrapf(err, "Error in resource %+v\n", ref)
+			}
+			continue
+		}
+
+		fmt.Printf("Comparing resource %+v with its published package\n", ref)
+		pd, err := d.diff(r.forResource(resource))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error in resource %+v\n", ref)
+		}
+		diffs = append(diffs, *pd)
+	}
+	return diffs, nil
+}
+
+// diff compares the published template, at the first GCS path of
+// ZipFilePath or otherwise its first local path, with the template
+// generated by the referenced autogen template.
+func (dm *DeploymentManagerTemplate) diff(registry Registry) (*PackageDiff, error) {
+	dmTemplate, err := getAutogenTemplate(registry, dm.DeploymentManagerRef)
+	if err != nil {
+		return nil, err
+	}
+	published, err := dm.publishedPath(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	packageDir, err := stagePackage(dmTemplate.outDir, dm.ZipRoot, dm.StripPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to arrange contents of DM template")
+	}
+	if packageDir != dmTemplate.outDir {
+		defer os.RemoveAll(packageDir)
+	}
+
+	publishedDir, err := util.CreateTmpDir("published")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(publishedDir)
+	err = dm.extractPublished(registry.GetExecutor(), published, publishedDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get published DM template %s", published)
+	}
+
+	changes, err := diffDirectories(registry.GetExecutor(), publishedDir, packageDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compare DM templates")
+	}
+	return &PackageDiff{Reference: dm.GetReference(), Published: published, Changes: changes}, nil
+}
+
+// publishedPath returns the destination of the template that it is compared
+// with.
+func (dm *DeploymentManagerTemplate) publishedPath(registry Registry) (string, error) {
+	if len(dm.ZipFilePath) == 0 {
+		return "", errors.New("ZipFilePath cannot be empty for DM template")
+	}
+	for _, path := range dm.ZipFilePath {
+		if isGCSPath(path) {
+			return path, nil
+		}
+	}
+	return registry.ResolveFilePath(dm, dm.ZipFilePath[0])
+}
+
+// extractPublished downloads the published archive if it is in GCS, and
+// extracts it to dir.
+func (dm *DeploymentManagerTemplate) extractPublished(executor exec.Interface, published string, dir string) error {
+	format := dm.ArchiveFormat
+	if format == "" {
+		format = zipArchiveFormat
+	}
+
+	archive := published
+	if isGCSPath(published) {
+		// The archive is downloaded next to dir, such that it is not
+		// mistaken for a file of the template.
+		archive = dir + "." + format
+		if err := runCommand(executor, "gsutil", "cp", published, archive); err != nil {
+			return err
+		}
+		defer os.Remove(archive)
+	}
+
+	if format == tgzArchiveFormat {
+		return runCommand(executor, "tar", "-xzf", archive, "-C", dir)
+	}
+	return runCommand(executor, "unzip", "-q", archive, "-d", dir)
+}
+
+// diffDirectories returns the files that were added, removed or modified in
+// newDir compared with oldDir, sorted by path. Modified files include their
+// unified diff.
+func diffDirectories(executor exec.Interface, oldDir string, newDir string) ([]FileChange, error) {
+	oldFiles, err := hashFiles(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := hashFiles(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FileChange{}
+	for path, hash := range newFiles {
+		oldHash, ok := oldFiles[path]
+		if !ok {
+			changes = append(changes, FileChange{Path: path, Status: FileAdded})
+			continue
+		}
+		if oldHash == hash {
+			continue
+		}
+		diff, err := diffFiles(executor, path, filepath.Join(oldDir, filepath.FromSlash(path)), filepath.Join(newDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, FileChange{Path: path, Status: FileModified, Diff: diff})
+	}
+	for path := range oldFiles {
+		if _, ok := newFiles[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Status: FileRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// hashFiles returns the digest of every file in dir, by slash separated
+// path relative to dir.
+func hashFiles(dir string) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	return hashes, err
+}
+
+// diffFiles returns the unified diff of two versions of the file at path.
+func diffFiles(executor exec.Interface, path string, oldFile string, newFile string) (string, error) {
+	out, err := runCommandOutput(executor, "diff", "-u", "--label", "a/"+path, "--label", "b/"+path, oldFile, newFile)
+	// diff exits with status 1 when the files differ.
+	if exitErr, ok := err.(exec.ExitError); ok && exitErr.ExitStatus() == 1 {
+		err = nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to diff %s", path)
+	}
+	return string(out), nil
+}
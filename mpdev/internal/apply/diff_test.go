@@ -0,0 +1,162 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDiff(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+	err := ioutil.WriteFile(filepath.Join(outDir, "vm.jinja"), []byte("resources: [vm]"), 0644)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		zipFilePath     StringList
+		archiveFormat   string
+		expectedRunArgs []string
+		expectedDiff    *PackageDiff
+	}{{
+		name:        "GCS package",
+		zipFilePath: StringList{"/tmp/dm.zip", "gs://project/dm.zip"},
+		expectedRunArgs: []string{
+			"gsutil cp gs://project/dm.zip",
+			"unzip -q",
+			"diff -u --label a/vm.jinja --label b/vm.jinja",
+		},
+	}, {
+		name:          "Local package",
+		zipFilePath:   StringList{"out/dm.tgz"},
+		archiveFormat: tgzArchiveFormat,
+		expectedRunArgs: []string{
+			"tar -xzf " + filepath.Join(os.TempDir(), "resourcedir", "out", "dm.tgz"),
+			"diff -u --label a/vm.jinja --label b/vm.jinja",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			// The published package has an older vm.jinja, no
+			// solution.jinja.display and a README.
+			extract := func() ([]byte, []byte, error) {
+				dir := fcmd.Argv[len(fcmd.Argv)-1]
+				files := map[string]string{
+					"solution.jinja":        "",
+					"solution.jinja.schema": "",
+					"vm.jinja":              "resources: []",
+					"README.md":             "readme",
+				}
+				for name, contents := range files {
+					if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+						return nil, nil, err
+					}
+				}
+				return nil, nil, nil
+			}
+			diff := func() ([]byte, []byte, error) {
+				return []byte("-resources: []\n+resources: [vm]\n"), nil, testingexec.FakeExitError{Status: 1}
+			}
+			fcmd.RunScript = []testingexec.FakeRunAction{extract, diff}
+			if len(tc.expectedRunArgs) == 3 {
+				fcmd.RunScript = append([]testingexec.FakeRunAction{noOutput}, fcmd.RunScript...)
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = outDir
+			dm := getDeploymentManagerTemplate(autogen, "")
+			dm.ZipFilePath = tc.zipFilePath
+			dm.ArchiveFormat = tc.archiveFormat
+			r.RegisterResource(autogen, filepath.Join(os.TempDir(), "resourcedir"))
+			r.RegisterResource(dm, filepath.Join(os.TempDir(), "resourcedir"))
+
+			pd, err := dm.diff(r)
+			assert.NoError(t, err)
+			assert.Equal(t, []FileChange{
+				{Path: "README.md", Status: FileRemoved},
+				{Path: "solution.jinja.display", Status: FileAdded},
+				{Path: "vm.jinja", Status: FileModified, Diff: "-resources: []\n+resources: [vm]\n"},
+			}, pd.Changes)
+			assert.Equal(t, dm.GetReference(), pd.Reference)
+
+			assert.Len(t, fcmd.RunLog, len(tc.expectedRunArgs))
+			for i, prefix := range tc.expectedRunArgs {
+				assert.Contains(t, strings.Join(fcmd.RunLog[i], " "), prefix)
+			}
+		})
+	}
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	oldDir := newTestPackageDir(t)
+	defer os.RemoveAll(oldDir)
+	newDir := newTestPackageDir(t)
+	defer os.RemoveAll(newDir)
+
+	changes, err := diffDirectories(&testingexec.FakeExec{}, oldDir, newDir)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+// testDiffer is a resource whose diff lists no change.
+type testDiffer struct {
+	*testResource
+}
+
+func (d *testDiffer) diff(registry Registry) (*PackageDiff, error) {
+	return &PackageDiff{Reference: d.GetReference()}, nil
+}
+
+func TestDiffDependencies(t *testing.T) {
+	applied := map[string]bool{}
+	applyFunc := func(name string) func(Registry, bool) error {
+		return func(_ Registry, dryRun bool) error {
+			applied[name] = dryRun
+			return nil
+		}
+	}
+	dep := newTestResourceFunc("dep", applyFunc("dep"), nil)
+	unrelated := newTestResourceFunc("unrelated", applyFunc("unrelated"), nil)
+	d := &testDiffer{newTestResourceFunc("differ", applyFunc("differ"), func() []Reference {
+		return []Reference{dep.GetReference()}
+	})}
+
+	r := NewRegistry(&testingexec.FakeExec{})
+	for _, rs := range []Resource{dep, unrelated, d} {
+		r.RegisterResource(rs, "dirpath")
+	}
+	diffs, err := r.Diff()
+	assert.NoError(t, err)
+	assert.Equal(t, []PackageDiff{{Reference: d.GetReference()}}, diffs)
+	// The dependency is only applied in dry run mode, and the differ is
+	// not applied.
+	assert.Equal(t, map[string]bool{"dep": true}, applied)
+}
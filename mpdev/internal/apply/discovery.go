@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IsResource returns whether obj is an mpdev resource, as opposed to another
+// KRM resource in the same file.
+func IsResource(obj Unstructured) bool {
+	return strings.HasPrefix(obj.getTypeMeta().APIVersion, apiGroup+"/")
+}
+
+// FindConfigFiles returns the YAML files containing mpdev resources in the
+// directory tree of dir, sorted. If include is set, only files whose path
+// relative to dir matches one of its patterns are returned, and files
+// matching a pattern of exclude are skipped. Patterns use the syntax of
+// path.Match with slash separated paths, and a "**" element matches any
+// number of directories. A pattern without a slash matches the name of a
+// file in any directory. Hidden directories, such as .git, are skipped.
+// Overlay directories are returned instead of the files they contain, and
+// are matched by the path of their overlay file. The files and directories
+// that are bases of the overlays found are not returned, since they are
+// loaded with the overlays.
+func FindConfigFiles(dir string, include []string, exclude []string) ([]string, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+		}
+	}
+
+	var files []string
+	var overlays []string
+	matches := func(file string) (bool, error) {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return false, err
+		}
+		rel = filepath.ToSlash(rel)
+		return (len(include) == 0 || matchAny(include, rel)) && !matchAny(exclude, rel), nil
+	}
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if file != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if file != dir && IsOverlay(file) {
+				ok, err := matches(filepath.Join(file, OverlayFile))
+				if ok {
+					overlays = append(overlays, file)
+				}
+				if err == nil {
+					err = filepath.SkipDir
+				}
+				return err
+			}
+			return nil
+		}
+		if ext := filepath.Ext(file); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		if ok, err := matches(file); !ok || err != nil {
+			return err
+		}
+		// Files without mpdev resources, such as Helm templates or
+		// kustomization files, are skipped.
+		if fileContains(file, apiGroup+"/") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bases := map[string]bool{}
+	for _, overlay := range overlays {
+		if err := addOverlayBases(bases, overlay); err != nil {
+			return nil, err
+		}
+	}
+	var found []string
+	for _, file := range append(files, overlays...) {
+		if !isBase(bases, file) {
+			found = append(found, file)
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// addOverlayBases adds the absolute paths of the bases of the overlay in
+// dir to bases, along with the bases of the overlays that are bases.
+func addOverlayBases(bases map[string]bool, dir string) error {
+	overlay, err := readOverlay(dir)
+	if err != nil {
+		return err
+	}
+	for _, base := range overlay.Bases {
+		path, err := filepath.Abs(filepath.Join(dir, base))
+		if err != nil {
+			return err
+		}
+		if bases[path] {
+			continue
+		}
+		bases[path] = true
+		if IsOverlay(path) {
+			if err := addOverlayBases(bases, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isBase returns whether file is one of bases, or is in one of them.
+func isBase(bases map[string]bool, file string) bool {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	for ; ; path = filepath.Dir(path) {
+		if bases[path] {
+			return true
+		}
+		if filepath.Dir(path) == path {
+			return false
+		}
+	}
+}
+
+// matchAny returns whether the slash separated path matches one of patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return true
+			}
+			continue
+		}
+		if matchGlob(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the elements of a path against the elements of a
+// pattern, where a "**" element matches zero or more path elements.
+func matchGlob(pattern []string, elems []string) bool {
+	if len(pattern) == 0 {
+		return len(elems) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(elems); i++ {
+			if matchGlob(pattern[1:], elems[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(elems) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+		return false
+	}
+	return matchGlob(pattern[1:], elems[1:])
+}
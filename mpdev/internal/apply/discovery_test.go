@@ -0,0 +1,117 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindConfigFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	resource := "apiVersion: " + apiVersion + "\nkind: DeploymentManagerTemplate\n"
+	files := map[string]string{
+		"solutions/vm/mpdev/configurations.yaml":     resource,
+		"solutions/vm/mpdev/images.yml":              resource,
+		"solutions/vm/chart/templates/service.yaml":  "{{ .Values.name }}",
+		"solutions/k8s/mpdev/configurations.yaml":    resource,
+		"solutions/k8s/mpdev/staging/overrides.yaml": resource,
+		"solutions/k8s/README.md":                    resource,
+		".git/configurations.yaml":                   resource,
+		"configurations.yaml":                        resource,
+		"solutions/web/base/configurations.yaml":     resource,
+		"solutions/web/prod/overlay.yaml":            "bases:\n- ../base\npatches:\n- patches.yaml\n",
+		"solutions/web/prod/patches.yaml":            resource,
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+
+	testCases := []struct {
+		name        string
+		include     []string
+		exclude     []string
+		expected    []string
+		expectedErr bool
+	}{{
+		name: "All files",
+		expected: []string{
+			"configurations.yaml",
+			"solutions/k8s/mpdev/configurations.yaml",
+			"solutions/k8s/mpdev/staging/overrides.yaml",
+			"solutions/vm/mpdev/configurations.yaml",
+			"solutions/vm/mpdev/images.yml",
+			"solutions/web/prod",
+		},
+	}, {
+		name:    "Include",
+		include: []string{"solutions/*/mpdev/*.yaml"},
+		expected: []string{
+			"solutions/k8s/mpdev/configurations.yaml",
+			"solutions/vm/mpdev/configurations.yaml",
+		},
+	}, {
+		name:    "Include recursive pattern",
+		include: []string{"solutions/k8s/**"},
+		expected: []string{
+			"solutions/k8s/mpdev/configurations.yaml",
+			"solutions/k8s/mpdev/staging/overrides.yaml",
+		},
+	}, {
+		name:     "Include overlay",
+		include:  []string{"solutions/web/**"},
+		expected: []string{"solutions/web/prod"},
+	}, {
+		name:    "Exclude",
+		exclude: []string{"**/staging/**", "*.yml", "solutions/web/prod/*"},
+		expected: []string{
+			"configurations.yaml",
+			"solutions/k8s/mpdev/configurations.yaml",
+			"solutions/vm/mpdev/configurations.yaml",
+			"solutions/web/base/configurations.yaml",
+		},
+	}, {
+		name:        "Invalid pattern",
+		include:     []string{"solutions/["},
+		expectedErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := FindConfigFiles(dir, tc.include, tc.exclude)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var rel []string
+			for _, file := range found {
+				r, err := filepath.Rel(dir, file)
+				assert.NoError(t, err)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			assert.Equal(t, tc.expected, rel)
+		})
+	}
+}
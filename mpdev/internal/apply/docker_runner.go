@@ -0,0 +1,398 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// dockerRunner runs containers with the docker CLI. Its commands are
+// executed with the executor of the resource, such that they are logged,
+// recorded and limited like other commands. The docker CLI selects the
+// daemon of DOCKER_HOST or of the current docker context, connects to it
+// with TLS or ssh, and authenticates with registries itself.
+type dockerRunner struct {
+	executor exec.Interface
+}
+
+func (r *dockerRunner) command(ctx context.Context, stdout io.Writer, stderr io.Writer, args ...string) exec.Cmd {
+	cmd := r.executor.CommandContext(ctx, "docker", args...)
+	cmd.SetStdout(stdout)
+	cmd.SetStderr(stderr)
+	return cmd
+}
+
+// output runs a docker command and returns its stdout. The error of a
+// failed command describes op, with the stderr of the command.
+func (r *dockerRunner) output(ctx context.Context, op string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	err := r.command(ctx, &stdout, &stderr, args...).Run()
+	return stdout.Bytes(), dockerCommandError(op, err, stderr.String())
+}
+
+// dockerCommandError returns the error of a docker command that failed to
+// do op, with the message that it wrote to stderr. Its cause is the error
+// of the command, such that its exit code is kept.
+func dockerCommandError(op string, err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+	if message := strings.TrimSpace(stderr); message != "" {
+		return errors.Wrapf(err, "failed to %s: %s", op, message)
+	}
+	return errors.Wrapf(err, "failed to %s", op)
+}
+
+// Run creates the container, copies the directories of its mounts into it
+// if they are not bind mounted, and starts it attached to stdout and stderr.
+// The exit status of docker start --attach is the exit status of the
+// container.
+func (r *dockerRunner) Run(ctx context.Context, spec ContainerSpec, stdout io.Writer, stderr io.Writer) (int, error) {
+	copyMounts := mountStrategy() == MountCopy
+	args := []string{"create", "--name", spec.Name}
+	// Files are copied in and out of the container instead of bind
+	// mounted, and the files copied out are owned by the current user.
+	if !copyMounts {
+		user := spec.User
+		if user == "" {
+			info, err := r.info(ctx)
+			if err != nil {
+				return 0, err
+			}
+			user = containerUser(info)
+		}
+		if user != "" {
+			args = append(args, "--user", user)
+		}
+	}
+	if spec.Entrypoint != "" {
+		args = append(args, "--entrypoint", spec.Entrypoint)
+	}
+	for _, env := range spec.Env {
+		// Only the names of the variables are passed, such that secrets in
+		// their values are not in the arguments of the command, which are
+		// logged. docker reads their values from its environment.
+		args = append(args, "--env", strings.SplitN(env, "=", 2)[0])
+	}
+	if !copyMounts {
+		for _, mount := range spec.Mounts {
+			args = append(args, "--mount", mount.option())
+		}
+	}
+	args = append(append(args, spec.Image), spec.Args...)
+	var stderrBuf bytes.Buffer
+	cmd := r.command(ctx, ioutil.Discard, &stderrBuf, args...)
+	if len(spec.Env) > 0 {
+		cmd.SetEnv(append(os.Environ(), spec.Env...))
+	}
+	if err := cmd.Run(); err != nil {
+		return 0, dockerCommandError("create container "+spec.Name, err, stderrBuf.String())
+	}
+	if copyMounts {
+		if err := r.copyIn(ctx, spec.Name, spec.Mounts); err != nil {
+			return 0, err
+		}
+	}
+
+	err := r.command(ctx, stdout, stderr, "start", "--attach", spec.Name).Run()
+	if ctx.Err() != nil {
+		// Killing docker start does not stop the container, which is given
+		// stopGracePeriod to exit before it is killed.
+		grace := strconv.Itoa(int(stopGracePeriod.Seconds()))
+		_ = r.command(context.Background(), ioutil.Discard, ioutil.Discard, "stop", "--time", grace, spec.Name).Run()
+		if err == nil {
+			err = ctx.Err()
+		}
+		return 0, errors.Wrapf(err, "failed to run container %s", spec.Name)
+	}
+	if e, ok := errors.Cause(err).(exec.ExitError); ok {
+		return e.ExitStatus(), nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "failed to run container %s", spec.Name)
+	}
+	if !copyMounts {
+		return 0, nil
+	}
+	return 0, r.copyOut(ctx, spec.Name, spec.Mounts)
+}
+
+// option returns the value of the --mount option of docker create mounting
+// m.
+func (m dockerMount) option() string {
+	option := fmt.Sprintf("type=%s,source=%s,target=%s", m.Type, m.Source, m.Target)
+	if m.ReadOnly {
+		option += ",readonly"
+	}
+	return option
+}
+
+// copyIn copies the source directories of mounts into a container, as tar
+// archives read by docker cp from its stdin.
+func (r *dockerRunner) copyIn(ctx context.Context, name string, mounts []dockerMount) error {
+	for _, mount := range mounts {
+		var archive, stderr bytes.Buffer
+		if err := tarDirectory(&archive, mount.Source, path.Base(mount.Target)); err != nil {
+			return errors.Wrapf(err, "failed to archive %s", mount.Source)
+		}
+		cmd := r.command(ctx, ioutil.Discard, &stderr, "cp", "-", name+":"+path.Dir(mount.Target))
+		cmd.SetStdin(&archive)
+		if err := cmd.Run(); err != nil {
+			return dockerCommandError("copy files to container", err, stderr.String())
+		}
+	}
+	return nil
+}
+
+// copyOut copies the target directories of the mounts that are not
+// read-only out of a container into their source directories. docker cp
+// writes them to its stdout as tar archives, whose entries start with the
+// base name of the target.
+func (r *dockerRunner) copyOut(ctx context.Context, name string, mounts []dockerMount) error {
+	for _, mount := range mounts {
+		if mount.ReadOnly {
+			continue
+		}
+		archive, err := r.output(ctx, "copy files from container", "cp", name+":"+mount.Target, "-")
+		if err != nil {
+			return err
+		}
+		if err := untarDirectory(bytes.NewReader(archive), mount.Source); err != nil {
+			return errors.Wrapf(err, "failed to copy %s out of container to %s", mount.Target, mount.Source)
+		}
+	}
+	return nil
+}
+
+// Pull pulls image, retrying transient failures of the registry. Failures
+// to authenticate with the registry are not retried, and are returned along
+// with the command configuring credentials for it. Registries configured
+// with UseRegistryAuth are authenticated with a temporary docker CLI
+// configuration.
+func (r *dockerRunner) Pull(ctx context.Context, image string) error {
+	args := []string{"pull", image}
+	if _, ok := registryAuths[registryOf(image)]; ok {
+		configDir, err := writeDockerConfig(r.executor, image)
+		if err != nil {
+			return AuthError(err)
+		}
+		defer os.RemoveAll(configDir)
+		args = append([]string{"--config", configDir}, args...)
+	}
+	fmt.Printf("Pulling image %s\n", image)
+	backoff := pullBackoff
+	var err error
+	for attempt := 1; attempt <= pullAttempts; attempt++ {
+		if attempt > 1 {
+			fmt.Printf("Pulling image %s failed, retrying in %s: %v\n", image, backoff, err)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var stderr bytes.Buffer
+		err = r.command(ctx, ioutil.Discard, &stderr, args...).Run()
+		if err == nil {
+			return nil
+		}
+		message := stderr.String()
+		err = dockerCommandError("pull image "+image, err, message)
+		if isPullAuthError(message) {
+			return AuthError(errors.Wrapf(err, "failed to authenticate with the registry of %s. Run `%s`", image, registryLoginCommand(image)))
+		}
+		if !isTransientPullError(message) {
+			return err
+		}
+	}
+	return errors.Wrapf(err, "failed to pull image %s after %d attempts", image, pullAttempts)
+}
+
+func (r *dockerRunner) ImageExists(ctx context.Context, image string) (bool, error) {
+	var stderr bytes.Buffer
+	err := r.command(ctx, ioutil.Discard, &stderr, "image", "inspect", "--format", "{{.Id}}", image).Run()
+	if _, ok := errors.Cause(err).(exec.ExitError); ok && strings.Contains(strings.ToLower(stderr.String()), "no such image") {
+		return false, nil
+	}
+	return err == nil, dockerCommandError("inspect image "+image, err, stderr.String())
+}
+
+func (r *dockerRunner) Remove(ctx context.Context, name string) error {
+	var stderr bytes.Buffer
+	err := r.command(ctx, ioutil.Discard, &stderr, "rm", "--force", name).Run()
+	if _, ok := errors.Cause(err).(exec.ExitError); ok && strings.Contains(strings.ToLower(stderr.String()), "no such container") {
+		return nil
+	}
+	return dockerCommandError("remove container "+name, err, stderr.String())
+}
+
+func (r *dockerRunner) Build(ctx context.Context, spec BuildSpec, stdout io.Writer, stderr io.Writer) error {
+	return r.command(ctx, stdout, stderr, buildArgs(spec)...).Run()
+}
+
+func (r *dockerRunner) Push(ctx context.Context, image string, stdout io.Writer, stderr io.Writer) error {
+	return r.command(ctx, stdout, stderr, "push", image).Run()
+}
+
+func (r *dockerRunner) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	stdout, err := r.output(ctx, "inspect image "+image, "image", "inspect", "--format", "{{json .RepoDigests}}", image)
+	if err != nil {
+		return nil, err
+	}
+	var digests []string
+	err = json.Unmarshal(stdout, &digests)
+	return digests, errors.Wrapf(err, "failed to inspect image %s", image)
+}
+
+// info returns the information of the docker daemon that the docker CLI
+// connects to.
+func (r *dockerRunner) info(ctx context.Context) (*dockerInfo, error) {
+	stdout, err := r.output(ctx, "get docker daemon information", "info", "--format", "{{json .}}")
+	if err != nil {
+		return nil, err
+	}
+	var info dockerInfo
+	if err := json.Unmarshal(stdout, &info); err != nil {
+		return nil, errors.Wrap(err, "failed to get docker daemon information: invalid output of docker info")
+	}
+	return &info, nil
+}
+
+// dockerError is the failure of a container.
+type dockerError struct {
+	// op is the operation that failed, such as "run container"
+	op      string
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.op, e.message)
+}
+
+// dockerMount is a mount of a container.
+type dockerMount struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// Pull policies of the images of containers run by mpdev, selected with
+// UsePullPolicy.
+const (
+	// PullAlways pulls images before every run
+	PullAlways = "always"
+	// PullIfNotPresent pulls images that are missing
+	PullIfNotPresent = "if-not-present"
+	// PullNever never pulls images, such as in air-gapped environments
+	PullNever = "never"
+)
+
+// PullPolicies are the supported pull policies.
+var PullPolicies = []string{PullAlways, PullIfNotPresent, PullNever}
+
+// pullPolicy is the pull policy of the images of containers.
+var pullPolicy = PullIfNotPresent
+
+// UsePullPolicy sets the pull policy of the images of the containers that
+// resources run, such as autogen.
+func UsePullPolicy(policy string) error {
+	if !containsString(PullPolicies, policy) {
+		return fmt.Errorf("unsupported pull policy %s. Must be one of %s", policy, strings.Join(PullPolicies, ", "))
+	}
+	pullPolicy = policy
+	return nil
+}
+
+// pullAttempts is the number of times that a pull failing with a
+// transient error is attempted, waiting pullBackoff before the second
+// attempt and twice as long before each following one.
+var (
+	pullAttempts = 4
+	pullBackoff  = 2 * time.Second
+)
+
+// isPullAuthError returns whether a pull failed because the registry
+// rejected the credentials of the docker CLI, or it has none, according to
+// the message of docker pull.
+func isPullAuthError(message string) bool {
+	message = strings.ToLower(message)
+	for _, s := range []string{"unauthorized", "authentication required", "denied", "no basic auth credentials", "403 forbidden"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransientPullError returns whether a pull failed because of the network
+// or the registry, such that it may succeed if it is attempted again,
+// according to the message of docker pull. Missing images are not
+// transient.
+func isTransientPullError(message string) bool {
+	message = strings.ToLower(message)
+	if strings.Contains(message, "manifest unknown") || strings.Contains(message, "not found") {
+		return false
+	}
+	for _, s := range []string{"timeout", "connection reset", "connection refused", "eof", "tls handshake", "temporary failure",
+		"too many requests", "service unavailable", "bad gateway", "internal server error"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryLoginCommand returns the command configuring the credentials of
+// the docker CLI for the registry of image.
+func registryLoginCommand(image string) string {
+	registry := registryOf(image)
+	if registry == "gcr.io" || strings.HasSuffix(registry, ".gcr.io") || strings.HasSuffix(registry, "-docker.pkg.dev") {
+		return "gcloud auth configure-docker " + registry
+	}
+	return "docker login " + registry
+}
+
+// dockerInfo is the information about the docker daemon that mpdev uses.
+type dockerInfo struct {
+	ServerVersion string
+	// SecurityOptions are the security features enabled in the daemon,
+	// such as name=rootless or name=userns
+	SecurityOptions []string
+}
+
+// hasSecurityOption returns whether a security feature, such as rootless,
+// is enabled in the daemon.
+func (i *dockerInfo) hasSecurityOption(name string) bool {
+	for _, option := range i.SecurityOptions {
+		if option == "name="+name || strings.HasPrefix(option, "name="+name+",") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,511 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// fakeDockerCLI executes the docker commands that run a container, whose
+// output is output and whose exit status is status. If missingImage is set,
+// the image is not present until it is pulled, and successive pulls fail
+// with the errors in pullErrors. Commands other than docker are run with
+// the actions of other.
+type fakeDockerCLI struct {
+	output       string
+	status       int
+	missingImage bool
+	pullErrors   []string
+	// securityOptions are the security features of the daemon
+	securityOptions []string
+	// repoDigests are the digests of the image
+	repoDigests []string
+	// mountStrategy is the strategy selected by MPDEV_MOUNT_STRATEGY,
+	// which defaults to bind mounts
+	mountStrategy string
+	// archive is written by docker cp for files copied out of the container
+	archive []byte
+	// onCreate is called with the command creating the container
+	onCreate func(fcmd *testingexec.FakeCmd)
+	// onStart is called when the container is started, before its output
+	// is written. The container fails with the error it returns, if any.
+	onStart func() error
+	other   []testingexec.FakeRunAction
+
+	// commands are the docker commands executed, without their options
+	commands []string
+	// create is the command creating the container
+	create   []string
+	copiedIn map[string][]byte
+	stop     []string
+}
+
+// start returns an executor of the commands of the fake, and points
+// MPDEV_MOUNT_STRATEGY to its mount strategy. The returned function
+// restores MPDEV_MOUNT_STRATEGY.
+func (f *fakeDockerCLI) start() (*testingexec.FakeExec, func()) {
+	fexec := &testingexec.FakeExec{}
+	for i := 0; i < 20; i++ {
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			fcmd := &testingexec.FakeCmd{}
+			fcmd.RunScript = []testingexec.FakeRunAction{func() ([]byte, []byte, error) { return f.run(fcmd) }}
+			return testingexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+	strategy := f.mountStrategy
+	if strategy == "" {
+		strategy = MountBind
+	}
+	restore := func(v string) func() { return func() { os.Setenv(MountStrategyEnv, v) } }(os.Getenv(MountStrategyEnv))
+	os.Setenv(MountStrategyEnv, strategy)
+	return fexec, restore
+}
+
+func (f *fakeDockerCLI) run(fcmd *testingexec.FakeCmd) ([]byte, []byte, error) {
+	if fcmd.Argv[0] != "docker" {
+		action := f.other[0]
+		f.other = f.other[1:]
+		return action()
+	}
+	args := fcmd.Argv[1:]
+	if args[0] == "--config" {
+		args = args[2:]
+	}
+	command := args[0]
+	if command == "image" {
+		command += " " + args[1]
+	}
+	f.commands = append(f.commands, command)
+	failed := func(stderr string) ([]byte, []byte, error) {
+		return nil, []byte(stderr + "\n"), testingexec.FakeExitError{Status: 1}
+	}
+	switch command {
+	case "info":
+		b, err := json.Marshal(dockerInfo{ServerVersion: "20.10.0", SecurityOptions: f.securityOptions})
+		return b, nil, err
+	case "image inspect":
+		if f.missingImage {
+			return failed("Error: No such image: " + args[len(args)-1])
+		}
+		if args[3] == "{{json .RepoDigests}}" {
+			b, err := json.Marshal(f.repoDigests)
+			return b, nil, err
+		}
+		return []byte("sha256:0123\n"), nil, nil
+	case "pull":
+		if len(f.pullErrors) > 0 {
+			message := f.pullErrors[0]
+			f.pullErrors = f.pullErrors[1:]
+			return failed(message)
+		}
+		f.missingImage = false
+	case "create":
+		f.create = args
+		if f.onCreate != nil {
+			f.onCreate(fcmd)
+		}
+	case "cp":
+		if args[1] == "-" {
+			if f.copiedIn == nil {
+				f.copiedIn = map[string][]byte{}
+			}
+			b, err := ioutil.ReadAll(fcmd.Stdin)
+			f.copiedIn[args[2]] = b
+			return nil, nil, err
+		}
+		return f.archive, nil, nil
+	case "start":
+		if f.onStart != nil {
+			if err := f.onStart(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if f.status != 0 {
+			return []byte(f.output), nil, testingexec.FakeExitError{Status: f.status}
+		}
+		return []byte(f.output), nil, nil
+	case "stop":
+		f.stop = args
+	}
+	return nil, nil, nil
+}
+
+func TestContainerProcessRun(t *testing.T) {
+	defer func(policy string) { pullPolicy = policy }(pullPolicy)
+	defer PinImageDigests(nil, false)
+	testCases := []struct {
+		name             string
+		docker           fakeDockerCLI
+		pullPolicy       string
+		pinnedDigests    map[string]string
+		requirePinned    bool
+		expectErr        string
+		expectedCommands []string
+	}{{
+		name:             "Success",
+		docker:           fakeDockerCLI{output: "generated package\n"},
+		expectedCommands: []string{"image inspect", "info", "create", "start", "rm"},
+	}, {
+		name:             "Exit status",
+		docker:           fakeDockerCLI{output: "invalid spec\n", status: 3},
+		expectErr:        "failed to run container gcr.io/project/image: exit status 3",
+		expectedCommands: []string{"image inspect", "info", "create", "start", "rm"},
+	}, {
+		name:             "Missing image",
+		docker:           fakeDockerCLI{output: "generated package\n", missingImage: true},
+		expectedCommands: []string{"image inspect", "pull", "info", "create", "start", "rm"},
+	}, {
+		name:             "Pull error",
+		docker:           fakeDockerCLI{missingImage: true, pullErrors: []string{"Error response from daemon: manifest unknown"}},
+		expectErr:        "failed to pull image gcr.io/project/image: Error response from daemon: manifest unknown: exit 1",
+		expectedCommands: []string{"image inspect", "pull"},
+	}, {
+		name:             "Pinned digest",
+		docker:           fakeDockerCLI{output: "generated package\n", repoDigests: []string{"gcr.io/project/image@sha256:1111"}},
+		pinnedDigests:    map[string]string{"gcr.io/project/image": "sha256:1111"},
+		expectedCommands: []string{"image inspect", "image inspect", "info", "create", "start", "rm"},
+	}, {
+		name:          "Moved tag",
+		docker:        fakeDockerCLI{repoDigests: []string{"gcr.io/project/image@sha256:2222"}},
+		pinnedDigests: map[string]string{"gcr.io/project/image": "sha256:1111"},
+		expectErr: "image gcr.io/project/image does not have the pinned digest sha256:1111, its tag may have been moved. " +
+			"Digests: gcr.io/project/image@sha256:2222",
+		expectedCommands: []string{"image inspect", "image inspect"},
+	}, {
+		name:             "Required digest",
+		requirePinned:    true,
+		expectErr:        "no digest is pinned for image gcr.io/project/image, and pinned digests are required",
+		expectedCommands: []string{"image inspect"},
+	}, {
+		name:             "Always pull",
+		docker:           fakeDockerCLI{output: "generated package\n"},
+		pullPolicy:       PullAlways,
+		expectedCommands: []string{"pull", "info", "create", "start", "rm"},
+	}, {
+		name:             "Never pull missing image",
+		docker:           fakeDockerCLI{missingImage: true},
+		pullPolicy:       PullNever,
+		expectErr:        "failed to run container gcr.io/project/image: the image is not present, and the pull policy is never",
+		expectedCommands: []string{"image inspect"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docker := tc.docker
+			fexec, restore := docker.start()
+			defer restore()
+			if tc.pullPolicy == "" {
+				tc.pullPolicy = PullIfNotPresent
+			}
+			assert.NoError(t, UsePullPolicy(tc.pullPolicy))
+			PinImageDigests(tc.pinnedDigests, tc.requirePinned)
+
+			cp := newContainerProcess(fexec, "gcr.io/project/image", []string{"--output", "/out"},
+				[]mount{&bindMount{src: "/tmp/out", dst: "/out"}})
+			var stdout, stderr bytes.Buffer
+			err := cp.run(&stdout, &stderr)
+			assert.Equal(t, tc.expectedCommands, docker.commands)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				if tc.pinnedDigests == nil && !tc.requirePinned {
+					assert.Equal(t, ExitTool, ExitCode(err))
+				} else {
+					assert.Equal(t, ExitVerification, ExitCode(err))
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.expectErr == "" {
+				assert.Equal(t, tc.docker.output, stdout.String())
+				assert.Equal(t, []string{
+					"create", "--name", cp.name, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+					"--mount", "type=bind,source=/tmp/out,target=/out", "gcr.io/project/image", "--output", "/out",
+				}, docker.create)
+			}
+		})
+	}
+}
+
+func TestContainerProcessCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	docker := fakeDockerCLI{onStart: func() error {
+		cancel()
+		return errors.New("signal: killed")
+	}}
+	fexec, restore := docker.start()
+	defer restore()
+
+	cp := newContainerProcess(NewCancelableExecutor(ctx, fexec), "gcr.io/project/image", nil, nil)
+	err := cp.run(&bytes.Buffer{}, &bytes.Buffer{})
+	assert.EqualError(t, err, fmt.Sprintf("failed to run container %s: signal: killed", cp.name))
+	assert.Equal(t, []string{"image inspect", "info", "create", "start", "stop", "rm"}, docker.commands)
+	assert.Equal(t, []string{"stop", "--time", "10", cp.name}, docker.stop)
+}
+
+func TestContainerProcessTimeout(t *testing.T) {
+	defer SetCommandTimeout(0)
+	assert.NoError(t, SetCommandTimeout(50*time.Millisecond))
+	docker := fakeDockerCLI{onStart: func() error {
+		time.Sleep(100 * time.Millisecond)
+		return errors.New("signal: killed")
+	}}
+	fexec, restore := docker.start()
+	defer restore()
+
+	cp := newContainerProcess(fexec, "gcr.io/project/image", nil, nil)
+	err := cp.run(&bytes.Buffer{}, &bytes.Buffer{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "container gcr.io/project/image timed out after 50ms")
+	assert.Equal(t, []string{"stop", "--time", "10", cp.name}, docker.stop)
+	assert.Equal(t, "rm", docker.commands[len(docker.commands)-1])
+	assert.Error(t, SetCommandTimeout(-time.Second))
+}
+
+func TestContainerProcessCopyMounts(t *testing.T) {
+	src, err := ioutil.TempDir("", "mounts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(src)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "input.yaml"), []byte("input"), 0644))
+
+	// The archive of /out has entries in the directory out.
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "out/", Typeflag: tar.TypeDir, Mode: 0755}))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "out/pkg/", Typeflag: tar.TypeDir, Mode: 0755}))
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "out/pkg/main.jinja", Typeflag: tar.TypeReg, Mode: 0644, Size: 9}))
+	_, err = tw.Write([]byte("generated"))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	docker := fakeDockerCLI{mountStrategy: MountCopy, archive: archive.Bytes()}
+	fexec, restore := docker.start()
+	defer restore()
+
+	cp := newContainerProcess(fexec, "gcr.io/project/image", nil, []mount{&bindMount{src: src, dst: "/out"}})
+	assert.NoError(t, cp.run(&bytes.Buffer{}, &bytes.Buffer{}))
+	assert.Equal(t, []string{"image inspect", "create", "cp", "start", "cp", "rm"}, docker.commands)
+	assert.Equal(t, []string{"create", "--name", cp.name, "gcr.io/project/image"}, docker.create)
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(docker.copiedIn[cp.name+":/"]))
+	for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"out/", "out/input.yaml"}, names)
+
+	b, err := ioutil.ReadFile(filepath.Join(src, "pkg", "main.jinja"))
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", string(b))
+}
+
+func TestContainerProcessCredentials(t *testing.T) {
+	var env []string
+	var tokenFile, tokenDir string
+	docker := fakeDockerCLI{
+		output: "Authenticated with ya29.token\n",
+		onCreate: func(fcmd *testingexec.FakeCmd) {
+			env = fcmd.Env
+			// The token is in the source of the mount of credentialsDir,
+			// such as type=bind,source=/tmp/mpdev/credentials123,target=...
+			option := fcmd.Argv[len(fcmd.Argv)-3]
+			tokenDir = strings.TrimPrefix(strings.Split(option, ",")[1], "source=")
+			b, err := ioutil.ReadFile(filepath.Join(tokenDir, "access_token"))
+			assert.NoError(t, err)
+			tokenFile = string(b)
+		},
+		other: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte("ya29.token\n"), nil, nil },
+		},
+	}
+	fexec, restore := docker.start()
+	defer restore()
+
+	cp := newContainerProcess(fexec, "gcr.io/project/terraform", []string{"apply"}, nil)
+	cp.credentials = true
+	var stdout bytes.Buffer
+	assert.NoError(t, cp.run(&stdout, &bytes.Buffer{}))
+
+	assert.Equal(t, "Authenticated with [REDACTED]\n", stdout.String())
+	assert.Equal(t, "ya29.token", tokenFile)
+	assert.Equal(t, []string{
+		"create", "--name", cp.name, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--env", "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE", "--env", "GOOGLE_OAUTH_ACCESS_TOKEN",
+		"--mount", "type=bind,source=" + tokenDir + ",target=" + credentialsDir + ",readonly", "gcr.io/project/terraform", "apply",
+	}, docker.create)
+	assert.Contains(t, env, "GOOGLE_OAUTH_ACCESS_TOKEN=ya29.token")
+	assert.Contains(t, env, "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE=/mpdev/credentials/access_token")
+	_, err := os.Stat(tokenDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUntarDirectoryTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "untar")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "out/../../escaped", Typeflag: tar.TypeReg, Mode: 0644}))
+	assert.NoError(t, tw.Close())
+	assert.Error(t, untarDirectory(&archive, dir))
+}
+
+func TestMountStrategy(t *testing.T) {
+	defer os.Setenv(MountStrategyEnv, os.Getenv(MountStrategyEnv))
+	defer os.Setenv("CLOUD_SHELL", os.Getenv("CLOUD_SHELL"))
+	defer func(file string) { dockerEnvFile = file }(dockerEnvFile)
+	dir, err := ioutil.TempDir("", "dockerenv")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name       string
+		env        string
+		cloudShell string
+		dockerEnv  bool
+		expected   string
+	}{
+		{name: "Host", expected: MountBind},
+		{name: "Cloud Shell", cloudShell: "true", expected: MountCopy},
+		{name: "Container", dockerEnv: true, expected: MountCopy},
+		{name: "Override", env: MountBind, dockerEnv: true, expected: MountBind},
+		{name: "Invalid override", env: "volume", expected: MountBind},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(MountStrategyEnv, tc.env)
+			os.Setenv("CLOUD_SHELL", tc.cloudShell)
+			dockerEnvFile = filepath.Join(dir, "missing")
+			if tc.dockerEnv {
+				dockerEnvFile = dir
+			}
+			assert.Equal(t, tc.expected, mountStrategy())
+		})
+	}
+}
+
+func TestPullImageRetries(t *testing.T) {
+	defer func(backoff time.Duration) { pullBackoff = backoff }(pullBackoff)
+	pullBackoff = time.Millisecond
+	testCases := []struct {
+		name         string
+		image        string
+		pullErrors   []string
+		expectErr    string
+		expectedCode int
+		expectedPull int
+	}{{
+		name:         "Transient",
+		image:        "gcr.io/project/image",
+		pullErrors:   []string{"Get https://gcr.io/v2/: net/http: TLS handshake timeout", "read: connection reset by peer"},
+		expectedPull: 3,
+	}, {
+		name:  "Persistent",
+		image: "gcr.io/project/image",
+		pullErrors: []string{
+			"received unexpected HTTP status: 503 Service Unavailable", "received unexpected HTTP status: 503 Service Unavailable",
+			"received unexpected HTTP status: 503 Service Unavailable", "received unexpected HTTP status: 503 Service Unavailable",
+		},
+		expectErr: "failed to pull image gcr.io/project/image after 4 attempts: " +
+			"failed to pull image gcr.io/project/image: received unexpected HTTP status: 503 Service Unavailable: exit 1",
+		expectedCode: ExitTool,
+		expectedPull: 4,
+	}, {
+		name:       "Artifact Registry credentials",
+		image:      "us-docker.pkg.dev/project/repo/image",
+		pullErrors: []string{"unauthorized: authentication failed"},
+		expectErr: "failed to authenticate with the registry of us-docker.pkg.dev/project/repo/image. " +
+			"Run `gcloud auth configure-docker us-docker.pkg.dev`: " +
+			"failed to pull image us-docker.pkg.dev/project/repo/image: unauthorized: authentication failed: exit 1",
+		expectedCode: ExitAuth,
+		expectedPull: 1,
+	}, {
+		name:       "Docker Hub credentials",
+		image:      "org/image",
+		pullErrors: []string{"pull access denied for org/image, repository does not exist or may require 'docker login'"},
+		expectErr: "failed to authenticate with the registry of org/image. Run `docker login docker.io`: " +
+			"failed to pull image org/image: pull access denied for org/image, repository does not exist or may require 'docker login': exit 1",
+		expectedCode: ExitAuth,
+		expectedPull: 1,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docker := fakeDockerCLI{missingImage: true, pullErrors: tc.pullErrors}
+			fexec, restore := docker.start()
+			defer restore()
+			runner := &dockerRunner{executor: fexec}
+
+			err := runner.Pull(context.Background(), tc.image)
+			assert.Len(t, docker.commands, tc.expectedPull)
+			if tc.expectErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expectErr)
+			assert.Equal(t, tc.expectedCode, ExitCode(err))
+		})
+	}
+}
+
+func TestDockerRunnerRemove(t *testing.T) {
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) {
+			return nil, []byte("Error: No such container: mpdev-1\n"), testingexec.FakeExitError{Status: 1}
+		},
+		func() ([]byte, []byte, error) {
+			return nil, []byte("Cannot connect to the Docker daemon\n"), testingexec.FakeExitError{Status: 1}
+		},
+	}}
+	fexec := &testingexec.FakeExec{}
+	for range fcmd.RunScript {
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+		})
+	}
+	runner := &dockerRunner{executor: fexec}
+
+	assert.NoError(t, runner.Remove(context.Background(), "mpdev-1"))
+	assert.EqualError(t, runner.Remove(context.Background(), "mpdev-1"),
+		"failed to remove container mpdev-1: Cannot connect to the Docker daemon: exit 1")
+	assert.Equal(t, []string{"docker", "rm", "--force", "mpdev-1"}, fcmd.RunLog[0])
+}
+
+func TestContainerUser(t *testing.T) {
+	assert.Equal(t, "", containerUser(&dockerInfo{SecurityOptions: []string{"name=seccomp,profile=default", "name=rootless"}}))
+	assert.Equal(t, fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), containerUser(&dockerInfo{SecurityOptions: []string{"name=seccomp,profile=default"}}))
+}
+
+func TestUsePullPolicy(t *testing.T) {
+	defer func(policy string) { pullPolicy = policy }(pullPolicy)
+	assert.NoError(t, UsePullPolicy(PullNever))
+	assert.Equal(t, PullNever, pullPolicy)
+	assert.EqualError(t, UsePullPolicy("sometimes"), "unsupported pull policy sometimes. Must be one of always, if-not-present, never")
+}
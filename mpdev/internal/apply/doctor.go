@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// RequiredAPIs are the APIs that must be enabled in the project that
+// resources are applied to.
+var RequiredAPIs = []string{
+	"compute.googleapis.com",
+	"deploymentmanager.googleapis.com",
+	"runtimeconfig.googleapis.com",
+	"storage.googleapis.com",
+}
+
+// Diagnostic is the result of checking a prerequisite of mpdev.
+type Diagnostic struct {
+	// Name of the prerequisite
+	Name string
+	// Err is set if the prerequisite is not met
+	Err error
+	// Hint describes how to fix the prerequisite if it is not met
+	Hint string
+}
+
+// MarshalJSON encodes the diagnostic with an ok field, and the error and
+// hint if the prerequisite is not met.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Name  string `json:"name"`
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		Hint  string `json:"hint,omitempty"`
+	}{Name: d.Name, OK: d.Err == nil}
+	if d.Err != nil {
+		v.Error = d.Err.Error()
+		v.Hint = d.Hint
+	}
+	return json.Marshal(v)
+}
+
+// Diagnose checks the prerequisites of mpdev: the tools it executes, the
+// gcloud credentials and Application Default Credentials, and the APIs
+// enabled in a project. If projectID is empty, the project of the active
+// gcloud configuration is checked.
+func Diagnose(executor exec.Interface, projectID string) []Diagnostic {
+	var diagnostics []Diagnostic
+	check := func(name string, hint string, err error) bool {
+		diagnostics = append(diagnostics, Diagnostic{Name: name, Err: err, Hint: hint})
+		return err == nil
+	}
+
+	if containerRuntime == RuntimePodman {
+		check("podman is installed", "install podman from https://podman.io/getting-started/installation, which runs the containers of resources and builds the images of ContainerImage and K8sAppDeployer resources with --container-runtime podman",
+			lookPath(executor, "podman"))
+	} else {
+		check("docker is installed", "install docker from https://docs.docker.com/get-docker/, whose CLI runs the containers of resources and builds the images of ContainerImage and K8sAppDeployer resources",
+			lookPath(executor, "docker"))
+		info, err := dockerDaemonInfo(executor)
+		if check("docker daemon is reachable",
+			"start the docker daemon, and make sure the current user can access it, for example by adding it to the docker group, or set DOCKER_HOST or DOCKER_CONTEXT to its address",
+			err) {
+			check("containers can write to bind mounts",
+				"disable userns-remap in the docker daemon configuration, or use rootless docker, whose containers write files as the current user",
+				bindMountsWritable(info))
+		}
+	}
+	// DM templates are archived and uploaded without zip and gsutil with
+	// native tools.
+	sdkTools := []string{"gcloud"}
+	if !useNativeTools {
+		check("zip is installed",
+			"install zip, for example with sudo apt-get install zip, or set archiveFormat: tgz on DeploymentManagerTemplate resources",
+			lookPath(executor, "zip"))
+		if check("gsutil is installed", "install gsutil with gcloud components install gsutil", lookPath(executor, "gsutil")) {
+			sdkTools = append(sdkTools, "gsutil")
+		}
+	}
+
+	if !check("gcloud is installed", "install gcloud from https://cloud.google.com/sdk/docs/install", lookPath(executor, "gcloud")) {
+		return diagnostics
+	}
+	check("the Google Cloud SDK is up to date",
+		"run gcloud components update, or upgrade the Google Cloud SDK with the package manager that installed it",
+		checkToolVersions(executor, sdkTools))
+	_, err := runCommandOutput(executor, "gcloud", "auth", "print-access-token")
+	check("gcloud is authenticated", "run gcloud auth login, or pass --credential-file",
+		errors.Wrap(err, "gcloud auth print-access-token failed"))
+	_, err = runCommandOutput(executor, "gcloud", "auth", "application-default", "print-access-token")
+	check("Application Default Credentials are present", "run gcloud auth application-default login",
+		errors.Wrap(err, "gcloud auth application-default print-access-token failed"))
+
+	if projectID == "" {
+		stdout, err := runCommandOutput(executor, "gcloud", "config", "get-value", "project")
+		projectID = strings.TrimSpace(string(stdout))
+		if err == nil && projectID == "" {
+			err = errors.New("no project is set in the active gcloud configuration")
+		}
+		if !check("a project is configured", "pass --project, or run gcloud config set project PROJECT_ID", err) {
+			return diagnostics
+		}
+	}
+	stdout, err := runCommandOutput(executor, "gcloud", "services", "list", "--enabled", "--project", projectID,
+		"--format", "value(config.name)")
+	if !check(fmt.Sprintf("enabled APIs of project %s can be listed", projectID),
+		"grant the active account the roles/serviceusage.serviceUsageConsumer role",
+		errors.Wrapf(err, "failed to list enabled APIs of project %s", projectID)) {
+		return diagnostics
+	}
+	enabled := strings.Fields(string(stdout))
+	for _, api := range RequiredAPIs {
+		var err error
+		if !containsString(enabled, api) {
+			err = fmt.Errorf("%s is not enabled", api)
+		}
+		check(fmt.Sprintf("%s is enabled in project %s", api, projectID),
+			fmt.Sprintf("run gcloud services enable %s --project %s", api, projectID), err)
+	}
+	return diagnostics
+}
+
+// dockerDaemonInfo returns the information of the docker daemon that
+// containers are run with.
+func dockerDaemonInfo(executor exec.Interface) (*dockerInfo, error) {
+	runner := &dockerRunner{executor: executor}
+	return runner.info(executorContext(executor))
+}
+
+// bindMountsWritable returns an error if the docker daemon remaps the users
+// of containers to subordinate users, which cannot write to the directories
+// that mpdev mounts in containers, such as the output of autogen. Rootless
+// daemons map the root user of containers to the current user instead,
+// which can write to them.
+func bindMountsWritable(info *dockerInfo) error {
+	if info.hasSecurityOption("userns") {
+		return errors.New("the docker daemon remaps the users of containers with userns-remap, so they cannot write to the directories of the current user")
+	}
+	return nil
+}
+
+func lookPath(executor exec.Interface, name string) error {
+	_, err := executor.LookPath(name)
+	return errors.Wrapf(err, "%s not found in PATH", name)
+}
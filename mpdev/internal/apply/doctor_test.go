@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	allAPIs := "compute.googleapis.com\ndeploymentmanager.googleapis.com\nruntimeconfig.googleapis.com\nstorage.googleapis.com\n"
+	versions := func() ([]byte, []byte, error) {
+		return []byte(`{"Google Cloud SDK": "400.0.0", "gsutil": "5.20"}`), nil, nil
+	}
+
+	testCases := []struct {
+		name         string
+		projectID    string
+		missingTools []string
+		runs         []testingexec.FakeRunAction
+		// daemonDown makes docker info fail, as if the docker daemon was
+		// not reachable
+		daemonDown      bool
+		securityOptions []string
+		expectedFailed  []string
+	}{{
+		name:      "All prerequisites met",
+		projectID: "test-project",
+		runs: []testingexec.FakeRunAction{
+			versions,
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte(allAPIs), nil, nil },
+		},
+	}, {
+		name:      "Outdated Google Cloud SDK",
+		projectID: "test-project",
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) {
+				return []byte(`{"Google Cloud SDK": "290.0.1", "gsutil": "4.50"}`), nil, nil
+			},
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte(allAPIs), nil, nil },
+		},
+		expectedFailed: []string{"the Google Cloud SDK is up to date"},
+	}, {
+		name:           "Missing gcloud",
+		missingTools:   []string{"gcloud", "zip"},
+		daemonDown:     true,
+		expectedFailed: []string{"docker daemon is reachable", "zip is installed", "gcloud is installed"},
+	}, {
+		name:            "User namespace remapping",
+		projectID:       "test-project",
+		securityOptions: []string{"name=seccomp,profile=default", "name=userns"},
+		runs: []testingexec.FakeRunAction{
+			versions,
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return []byte(allAPIs), nil, nil },
+		},
+		expectedFailed: []string{"containers can write to bind mounts"},
+	}, {
+		name: "Missing APIs in configured project",
+		runs: []testingexec.FakeRunAction{
+			versions,
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) { return nil, nil, fmt.Errorf("exit status 1") },
+			func() ([]byte, []byte, error) { return []byte("my-project\n"), nil, nil },
+			func() ([]byte, []byte, error) {
+				return []byte("compute.googleapis.com\nstorage.googleapis.com\n"), nil, nil
+			},
+		},
+		expectedFailed: []string{
+			"Application Default Credentials are present",
+			"deploymentmanager.googleapis.com is enabled in project my-project",
+			"runtimeconfig.googleapis.com is enabled in project my-project",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info := func() ([]byte, []byte, error) {
+				if tc.daemonDown {
+					return nil, []byte("Cannot connect to the Docker daemon at unix:///var/run/docker.sock\n"), testingexec.FakeExitError{Status: 1}
+				}
+				b, err := json.Marshal(dockerInfo{ServerVersion: "20.10.0", SecurityOptions: tc.securityOptions})
+				return b, nil, err
+			}
+			runs := append([]testingexec.FakeRunAction{info}, tc.runs...)
+			fcmd := testingexec.FakeCmd{RunScript: runs}
+			executor := &testingexec.FakeExec{
+				LookPathFunc: func(file string) (string, error) {
+					if containsString(tc.missingTools, file) {
+						return "", fmt.Errorf("executable file not found in $PATH")
+					}
+					return "/usr/bin/" + file, nil
+				},
+			}
+			for range runs {
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+
+			var failed []string
+			for _, d := range Diagnose(executor, tc.projectID) {
+				if d.Err != nil {
+					assert.NotEmpty(t, d.Hint)
+					failed = append(failed, d.Name)
+				}
+			}
+			assert.Equal(t, tc.expectedFailed, failed)
+			assert.Len(t, fcmd.RunLog, len(runs))
+			assert.Equal(t, []string{"docker", "info", "--format", "{{json .}}"}, fcmd.RunLog[0])
+		})
+	}
+}
+
+func TestDiagnosticMarshalJSON(t *testing.T) {
+	b, err := json.Marshal([]Diagnostic{
+		{Name: "gcloud is installed"},
+		{Name: "zip is installed", Err: fmt.Errorf("zip not found"), Hint: "sudo apt-get install zip"},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name": "gcloud is installed", "ok": true},
+		{"name": "zip is installed", "ok": false, "error": "zip not found", "hint": "sudo apt-get install zip"}]`, string(b))
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strings"
+
+	"k8s.io/utils/exec"
+)
+
+// defaultPassedEnv are the variables of the environment of mpdev that the
+// commands it executes inherit, by name. Names ending with * match the
+// variables that start with them. Other variables, such as DOCKER_BUILDKIT
+// or proxies, are not inherited unless they are passed with PassEnv.
+var defaultPassedEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_*", "TZ", "TERM",
+	"TMPDIR", "TMP", "TEMP", "XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_RUNTIME_DIR",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "SSH_AUTH_SOCK",
+	// the properties, configurations and credentials of gcloud, and the python
+	// running it
+	"CLOUDSDK_*", "GOOGLE_APPLICATION_CREDENTIALS",
+	// the docker daemon that mpdev runs containers with
+	"DOCKER_HOST", "DOCKER_CONTEXT", "DOCKER_CONFIG", "DOCKER_CERT_PATH", "DOCKER_TLS_VERIFY",
+	// the desktop session in which mpdev open starts a browser
+	"DISPLAY", "WAYLAND_DISPLAY", "DBUS_SESSION_BUS_ADDRESS", "BROWSER",
+	// Windows
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "USERPROFILE", "APPDATA", "LOCALAPPDATA",
+	"PROGRAMDATA", "PROGRAMFILES",
+}
+
+// passedEnv are the variables passed with PassEnv.
+var passedEnv []string
+
+// injectedEnv are the names of the variables that mpdev sets for the
+// commands it executes, such as the default project, which they inherit.
+var injectedEnv = map[string]bool{}
+
+// PassEnv adds variables of the environment of mpdev, by name such as
+// HTTPS_PROXY, or by prefix such as TF_VAR_*, to those that the commands it
+// executes inherit. * passes the whole environment.
+func PassEnv(names ...string) {
+	passedEnv = append(passedEnv, names...)
+}
+
+// setCommandEnv sets a variable of the environment of mpdev, which the
+// commands it executes inherit.
+func setCommandEnv(key string, value string) error {
+	injectedEnv[envName(key)] = true
+	return os.Setenv(key, value)
+}
+
+// envName returns the name of a variable as it is compared, which is case
+// insensitive on Windows.
+func envName(key string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(key)
+	}
+	return key
+}
+
+// isPassedEnv returns whether commands inherit the variable key.
+func isPassedEnv(key string) bool {
+	key = envName(key)
+	if injectedEnv[key] {
+		return true
+	}
+	for _, names := range [][]string{defaultPassedEnv, passedEnv} {
+		for _, name := range names {
+			name = envName(name)
+			if name == key || (strings.HasSuffix(name, "*") && strings.HasPrefix(key, strings.TrimSuffix(name, "*"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sanitizeEnv returns the variables of env that commands run with: the
+// variables of environ, the environment of mpdev, that they inherit, and
+// the variables that the command adds, as returned by addedEnv.
+func sanitizeEnv(env []string, environ []string) []string {
+	inherited, added := splitEnv(env, environ)
+	sanitized := []string{}
+	for _, kv := range inherited {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if isPassedEnv(key) {
+			sanitized = append(sanitized, kv)
+		}
+	}
+	return append(sanitized, added...)
+}
+
+// NewSanitizingExecutor returns an executor whose commands run with a
+// curated environment instead of the whole environment of mpdev: the
+// variables of defaultPassedEnv and PassEnv, those set by mpdev, such as
+// the default project, and those added by the resource executing them.
+func NewSanitizingExecutor(executor exec.Interface) exec.Interface {
+	return &sanitizingExecutor{Interface: executor}
+}
+
+type sanitizingExecutor struct {
+	exec.Interface
+}
+
+func (e *sanitizingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &sanitizingCmd{Cmd: e.Interface.Command(cmd, args...)}
+}
+
+func (e *sanitizingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &sanitizingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...)}
+}
+
+type sanitizingCmd struct {
+	exec.Cmd
+	env     []string
+	environ []string
+}
+
+// SetEnv sets the environment of the command, which is compared with the
+// environment of mpdev when it is set, from which env was built.
+func (c *sanitizingCmd) SetEnv(env []string) {
+	c.env = env
+	c.environ = os.Environ()
+}
+
+// setEnv sets the sanitized environment of the command.
+func (c *sanitizingCmd) setEnv() {
+	if c.env == nil {
+		environ := os.Environ()
+		c.Cmd.SetEnv(sanitizeEnv(environ, environ))
+		return
+	}
+	c.Cmd.SetEnv(sanitizeEnv(c.env, c.environ))
+}
+
+func (c *sanitizingCmd) Run() error {
+	c.setEnv()
+	return c.Cmd.Run()
+}
+
+func (c *sanitizingCmd) Output() ([]byte, error) {
+	c.setEnv()
+	return c.Cmd.Output()
+}
+
+func (c *sanitizingCmd) CombinedOutput() ([]byte, error) {
+	c.setEnv()
+	return c.Cmd.CombinedOutput()
+}
+
+func (c *sanitizingCmd) Start() error {
+	c.setEnv()
+	return c.Cmd.Start()
+}
+
+// addedEnv returns the variables that mpdev and resources set for a
+// command, as split by splitEnv.
+func addedEnv(env []string, environ []string) []string {
+	_, added := splitEnv(env, environ)
+	return added
+}
+
+// splitEnv splits the environment of a command into the variables that it
+// inherits from environ and those that mpdev and resources add. They append
+// them to environ, such as append(os.Environ(), "TF_IN_AUTOMATION=1"), so a
+// variable that is set to the value it already has in environ is still
+// added. The variables added to an env that does not extend environ are
+// those that are not in environ.
+func splitEnv(env []string, environ []string) (inherited []string, added []string) {
+	if len(env) >= len(environ) && equalEnv(env[:len(environ)], environ) {
+		return env[:len(environ)], env[len(environ):]
+	}
+	inEnviron := map[string]bool{}
+	for _, v := range environ {
+		inEnviron[v] = true
+	}
+	for _, v := range env {
+		if inEnviron[v] {
+			inherited = append(inherited, v)
+		} else {
+			added = append(added, v)
+		}
+	}
+	return inherited, added
+}
+
+func equalEnv(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
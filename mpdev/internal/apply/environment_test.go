@@ -0,0 +1,73 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestSanitizeEnv(t *testing.T) {
+	defer func(passed []string) { passedEnv = passed }(passedEnv)
+	defer func(injected map[string]bool) { injectedEnv = injected }(injectedEnv)
+	injectedEnv = map[string]bool{"CLOUDSDK_CORE_PROJECT": true}
+	PassEnv("HTTPS_PROXY", "TF_VAR_*")
+
+	environ := []string{
+		"PATH=/usr/bin", "HOME=/home/partner", "LC_ALL=C", "CLOUDSDK_CORE_PROJECT=partner-staging",
+		"CLOUDSDK_CORE_DISABLE_PROMPTS=1", "DOCKER_BUILDKIT=0", "HTTP_PROXY=http://proxy:3128",
+		"HTTPS_PROXY=http://proxy:3128", "TF_VAR_region=us-central1", "DOCKER_HOST=tcp://docker:2375",
+		"TF_IN_AUTOMATION=1",
+	}
+	env := append(append([]string{}, environ...), "TF_DATA_DIR=/tmp/tf", "DOCKER_BUILDKIT=1", "TF_IN_AUTOMATION=1")
+	assert.Equal(t, []string{
+		"PATH=/usr/bin", "HOME=/home/partner", "LC_ALL=C", "CLOUDSDK_CORE_PROJECT=partner-staging",
+		"CLOUDSDK_CORE_DISABLE_PROMPTS=1", "HTTPS_PROXY=http://proxy:3128", "TF_VAR_region=us-central1",
+		"DOCKER_HOST=tcp://docker:2375", "TF_DATA_DIR=/tmp/tf", "DOCKER_BUILDKIT=1", "TF_IN_AUTOMATION=1",
+	}, sanitizeEnv(env, environ), "a variable set to the value it has in the environment is kept")
+
+	env = []string{"PATH=/usr/bin", "DOCKER_BUILDKIT=0", "TF_DATA_DIR=/tmp/tf"}
+	assert.Equal(t, []string{"PATH=/usr/bin", "TF_DATA_DIR=/tmp/tf"}, sanitizeEnv(env, environ),
+		"the variables of an environment that does not extend it are those that it does not have")
+
+	PassEnv("*")
+	assert.Equal(t, environ, sanitizeEnv(environ, environ))
+}
+
+func TestSanitizingExecutor(t *testing.T) {
+	defer func(injected map[string]bool) { injectedEnv = injected }(injectedEnv)
+	injectedEnv = map[string]bool{}
+	assert.NoError(t, setCommandEnv("MPDEV_TEST_INJECTED", "1"))
+	defer os.Unsetenv("MPDEV_TEST_INJECTED")
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	assert.NoError(t, os.Setenv("HOME", "/home/partner"))
+	defer os.Unsetenv("MPDEV_TEST_STRAY")
+	assert.NoError(t, os.Setenv("MPDEV_TEST_STRAY", "1"))
+
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+	assert.NoError(t, NewSanitizingExecutor(fexec).Command("gcloud", "info").Run())
+	assert.Contains(t, fcmd.Env, "HOME=/home/partner")
+	assert.Contains(t, fcmd.Env, "MPDEV_TEST_INJECTED=1")
+	assert.NotContains(t, fcmd.Env, "MPDEV_TEST_STRAY=1")
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"github.com/hashicorp/go-multierror"
+	"k8s.io/utils/exec"
+)
+
+// Exit codes of mpdev, by class of failure, such that CI pipelines can act
+// on the class of a failure without parsing messages.
+const (
+	// ExitFailure is returned for failures that are not in another class
+	ExitFailure = 1
+	// ExitUsage is returned for invalid flags and arguments
+	ExitUsage = 2
+	// ExitValidation is returned for invalid configuration files
+	ExitValidation = 3
+	// ExitTool is returned when a command executed by mpdev, such as gcloud
+	// or docker, fails or cannot be found
+	ExitTool = 4
+	// ExitAuth is returned when credentials are missing or lack permissions
+	ExitAuth = 5
+	// ExitVerification is returned when a check fails, such as a
+	// verification resource or a published package that differs
+	ExitVerification = 6
+	// ExitCanceled is returned when mpdev is interrupted or times out, as
+	// shells do for processes killed by SIGINT
+	ExitCanceled = 130
+)
+
+// classError is an error with the exit code of its class.
+type classError struct {
+	code int
+	err  error
+}
+
+func (e *classError) Error() string { return e.err.Error() }
+
+func (e *classError) Cause() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{code: code, err: err}
+}
+
+// UsageError marks err as caused by invalid flags or arguments.
+func UsageError(err error) error { return withExitCode(ExitUsage, err) }
+
+// ValidationError marks err as caused by invalid configuration.
+func ValidationError(err error) error { return withExitCode(ExitValidation, err) }
+
+// AuthError marks err as caused by missing credentials or permissions.
+func AuthError(err error) error { return withExitCode(ExitAuth, err) }
+
+// VerificationError marks err as a failed check.
+func VerificationError(err error) error { return withExitCode(ExitVerification, err) }
+
+// ExitCode returns the exit code of mpdev for err. The outermost class that
+// err was marked with is used, such that a failed check in a verification
+// resource is a verification failure even if the command running it failed.
+// Otherwise errors of commands executed by mpdev are in the ExitTool class,
+// or in the ExitAuth class if the command reported missing credentials.
+// Accumulated errors have the class of their first error.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	for err != nil {
+		switch e := err.(type) {
+		case *classError:
+			return e.code
+		case *multierror.Error:
+			if len(e.Errors) == 0 {
+				return ExitFailure
+			}
+			return ExitCode(e.Errors[0])
+		case *authExitError:
+			return ExitAuth
+		case exec.ExitError, *dockerError:
+			return ExitTool
+		}
+		if err == exec.ErrExecutableNotFound {
+			return ExitTool
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return ExitFailure
+		}
+		err = causer.Cause()
+	}
+	return ExitFailure
+}
+
+// errorClasses are the names of the classes of failures, by exit code.
+var errorClasses = map[int]string{
+	ExitFailure:      "failure",
+	ExitUsage:        "usage",
+	ExitValidation:   "validation",
+	ExitTool:         "tool",
+	ExitAuth:         "auth",
+	ExitVerification: "verification",
+	ExitCanceled:     "canceled",
+}
+
+// ErrorClass returns the name of the class of err, such as validation, or
+// an empty string if err is nil.
+func ErrorClass(err error) string {
+	return errorClasses[ExitCode(err)]
+}
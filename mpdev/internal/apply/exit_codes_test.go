@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestExitCode(t *testing.T) {
+	toolErr := testingexec.FakeExitError{Status: 2}
+	testCases := []struct {
+		name     string
+		err      error
+		expected int
+	}{{
+		name:     "No error",
+		expected: 0,
+	}, {
+		name:     "Unclassified",
+		err:      errors.New("failed"),
+		expected: ExitFailure,
+	}, {
+		name:     "Wrapped validation error",
+		err:      errors.Wrap(ValidationError(errors.New("invalid")), "failed"),
+		expected: ExitValidation,
+	}, {
+		name:     "Tool error",
+		err:      errors.Wrap(toolErr, "failed to run gcloud"),
+		expected: ExitTool,
+	}, {
+		name:     "Tool not found",
+		err:      errors.Wrap(exec.ErrExecutableNotFound, "failed to run docker"),
+		expected: ExitTool,
+	}, {
+		name:     "Tool error in verification",
+		err:      VerificationError(errors.Wrap(toolErr, "check failed")),
+		expected: ExitVerification,
+	}, {
+		name:     "Accumulated errors",
+		err:      multierror.Append(AuthError(errors.New("denied")), ValidationError(errors.New("invalid"))),
+		expected: ExitAuth,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ExitCode(tc.err))
+		})
+	}
+}
+
+func TestApplyExitCode(t *testing.T) {
+	check := QuotaCheck{
+		BaseResource: BaseResource{TypeMeta{Kind: "QuotaCheck", APIVersion: apiVersion}, Metadata{Name: "quota"}},
+		ProjectID:    "project",
+		Zone:         "us-central1-a",
+		MachineTypes: []string{"e2-small"},
+	}
+	invalid := check
+	invalid.Zone = "us-central1"
+
+	failedCommand := func(cmd string, args ...string) exec.Cmd {
+		fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, testingexec.FakeExitError{Status: 1} },
+		}}
+		return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+	}
+
+	testCases := []struct {
+		name     string
+		resource Resource
+		dryRun   bool
+		commands []testingexec.FakeCommandAction
+		expected int
+	}{{
+		name:     "Invalid resource in dry run",
+		resource: &invalid,
+		dryRun:   true,
+		expected: ExitValidation,
+	}, {
+		name:     "Invalid verification resource",
+		resource: &invalid,
+		expected: ExitValidation,
+	}, {
+		name:     "Failed verification resource",
+		resource: &check,
+		commands: []testingexec.FakeCommandAction{failedCommand},
+		expected: ExitVerification,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry(&testingexec.FakeExec{
+				CommandScript: append([]testingexec.FakeCommandAction{gcloudVersionAction}, tc.commands...),
+				LookPathFunc:  func(file string) (string, error) { return "/usr/bin/" + file, nil },
+			})
+			r.RegisterResource(tc.resource, "")
+			err := r.Apply(tc.dryRun)
+			assert.Error(t, err)
+			assert.Equal(t, tc.expected, ExitCode(err))
+		})
+	}
+}
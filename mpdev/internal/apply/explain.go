@@ -0,0 +1,257 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:generate go run ../fielddocs -dir . -o field_docs.go -autogen ../../../docs/autogen-reference.md
+
+package apply
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Explanation is the documentation of a kind of resource, or of a field of
+// a resource, generated from the doc comments of the Go types of mpdev.
+type Explanation struct {
+	Kind string `json:"kind"`
+	// Field is the path of the field in the resource, such as
+	// spec.packageInfo, or empty if the kind is explained
+	Field       string             `json:"field,omitempty"`
+	Type        string             `json:"type"`
+	Description string             `json:"description,omitempty"`
+	Fields      []FieldExplanation `json:"fields,omitempty"`
+}
+
+// FieldExplanation is the documentation of a field whose parent is
+// explained.
+type FieldExplanation struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// autogenSchemas are the free-form fields of resources that are autogen
+// specs, keyed by TypeName.FieldName, with the message of the autogen spec
+// that documents them.
+var autogenSchemas = map[string]string{
+	"AutogenSpec.DeploymentSpec": "DeploymentPackageAutogenSpec",
+}
+
+// autogenType is a message or an enum of the autogen spec.
+type autogenType struct {
+	Description string
+	Fields      []autogenField
+	// Values are the values of an enum
+	Values []string
+}
+
+// autogenField is a field of a message of the autogen spec. Type is the
+// name of a message or an enum, or a scalar type such as int32.
+type autogenField struct {
+	Name        string
+	Type        string
+	Repeated    bool
+	Description string
+}
+
+// typeName returns the name of the type of f in configuration files.
+func (f autogenField) typeName() string {
+	name := f.Type
+	if t, ok := autogenTypes[f.Type]; ok {
+		name = "object"
+		if len(t.Values) > 0 {
+			name = "string"
+		}
+	}
+	if f.Repeated {
+		return "[]" + name
+	}
+	return name
+}
+
+// description returns the description of f, with the values of its enum.
+func (f autogenField) description() string {
+	t := autogenTypes[f.Type]
+	if len(t.Values) == 0 {
+		return f.Description
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s One of %s.", f.Description, strings.Join(t.Values, ", ")))
+}
+
+// resourceField is a field of a resource, with the struct that declares it.
+type resourceField struct {
+	owner reflect.Type
+	field reflect.StructField
+}
+
+func (f resourceField) name() string {
+	if tag := strings.Split(f.field.Tag.Get("json"), ",")[0]; tag != "" {
+		return tag
+	}
+	return lowerCamelCase(f.field.Name)
+}
+
+// description returns the doc comment of the field, or of its type if the
+// field has none, starting with the name used in configuration files.
+func (f resourceField) description() string {
+	text, ok := fieldDocs[f.owner.Name()+"."+f.field.Name]
+	if !ok {
+		text = fieldDocs[baseType(f.field.Type).Name()]
+	}
+	if strings.HasPrefix(text, f.field.Name+" ") {
+		text = f.name() + text[len(f.field.Name):]
+	}
+	return text
+}
+
+// Explain returns the documentation of path, which is a kind followed by
+// the names of nested fields, such as DeploymentManagerTemplate.zipFilePath.
+func Explain(path string) (*Explanation, error) {
+	segments := strings.Split(path, ".")
+	kind := segments[0]
+	fn := typeMapper[TypeMeta{Kind: kind, APIVersion: apiVersion}]
+	if fn == nil {
+		return nil, fmt.Errorf("unknown kind %s. Must be one of %s", kind, strings.Join(Kinds(), ", "))
+	}
+
+	t := reflect.TypeOf(fn()).Elem()
+	e := &Explanation{Kind: kind, Type: typeName(t), Description: fieldDocs[t.Name()]}
+	for i, segment := range segments[1:] {
+		parent := strings.Join(segments[:i+1], ".")
+		fields := structFields(t)
+		if fields == nil {
+			if t.Kind() == reflect.Map {
+				return nil, fmt.Errorf("%s is free-form, its fields are not described by mpdev: %s", parent, e.Description)
+			}
+			return nil, fmt.Errorf("%s has no fields, since it is a %s", parent, typeName(t))
+		}
+		var found *resourceField
+		var names []string
+		for j := range fields {
+			names = append(names, fields[j].name())
+			if strings.EqualFold(fields[j].name(), segment) {
+				found = &fields[j]
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("field %s not found in %s. Fields: %s", segment, parent, strings.Join(names, ", "))
+		}
+		t = found.field.Type
+		e.Field = strings.Join(append(segments[1:i+1], found.name()), ".")
+		e.Type = typeName(t)
+		e.Description = found.description()
+		if message, ok := autogenSchemas[found.owner.Name()+"."+found.field.Name]; ok {
+			e.Type = "object"
+			return explainAutogen(e, message, segments[i+2:])
+		}
+	}
+
+	for _, f := range structFields(t) {
+		e.Fields = append(e.Fields, FieldExplanation{Name: f.name(), Type: typeName(f.field.Type), Description: f.description()})
+	}
+	return e, nil
+}
+
+// explainAutogen explains the fields of e, which is the autogen message
+// named message, along the path of segments.
+func explainAutogen(e *Explanation, message string, segments []string) (*Explanation, error) {
+	for _, segment := range segments {
+		parent := e.Kind + "." + e.Field
+		fields := autogenTypes[message].Fields
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%s has no fields, since it is a %s", parent, e.Type)
+		}
+		var found *autogenField
+		var names []string
+		for j := range fields {
+			names = append(names, fields[j].Name)
+			// Autogen also accepts snake case names, such as boot_disk.
+			if strings.EqualFold(fields[j].Name, strings.ReplaceAll(segment, "_", "")) {
+				found = &fields[j]
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("field %s not found in %s. Fields: %s", segment, parent, strings.Join(names, ", "))
+		}
+		e.Field += "." + found.Name
+		e.Type = found.typeName()
+		e.Description = found.description()
+		message = found.Type
+	}
+
+	for _, f := range autogenTypes[message].Fields {
+		e.Fields = append(e.Fields, FieldExplanation{Name: f.Name, Type: f.typeName(), Description: f.description()})
+	}
+	return e, nil
+}
+
+// structFields returns the fields that configure a value of type t, or of
+// the elements of t if it is a list, or nil if t is not a struct. Fields of
+// embedded structs are included.
+func structFields(t reflect.Type) []resourceField {
+	t = baseType(t)
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(StringList{}) {
+		return nil
+	}
+	fields := []resourceField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("json") == "-" {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, structFields(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, resourceField{owner: t, field: f})
+	}
+	return fields
+}
+
+// baseType returns the type of the values of pointers and of the elements
+// of lists of type t.
+func baseType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		if t == reflect.TypeOf(StringList{}) {
+			return t
+		}
+		t = t.Elem()
+	}
+	return t
+}
+
+// typeName returns the name of type t in configuration files.
+func typeName(t reflect.Type) string {
+	if t == reflect.TypeOf(StringList{}) {
+		return "string or []string"
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeName(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", typeName(t.Key()), typeName(t.Elem()))
+	case reflect.Struct:
+		return "object"
+	case reflect.Interface:
+		return "any"
+	default:
+		return t.Kind().String()
+	}
+}
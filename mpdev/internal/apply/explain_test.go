@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	testCases := []struct {
+		path          string
+		expectedField string
+		expectedType  string
+		description   string
+		fields        []string
+	}{
+		{
+			path:         "DeploymentManagerTemplate",
+			expectedType: "object",
+			description:  "DeploymentManagerTemplate",
+			fields:       []string{"kind", "apiVersion", "metadata", "zipFilePath"},
+		},
+		{
+			path:          "DeploymentManagerTemplate.zipFilePath",
+			expectedField: "zipFilePath",
+			expectedType:  "string or []string",
+			description:   "Uploads to gcs",
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.packageInfo.osInfo",
+			expectedField: "spec.packageInfo.osInfo",
+			expectedType:  "object",
+			description:   "Name and version of OS",
+			fields:        []string{"name", "version"},
+		},
+		{
+			path:          "DeploymentManagerDeployment.Checks",
+			expectedField: "checks",
+			expectedType:  "[]object",
+			fields:        []string{"name", "script"},
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.deploymentSpec",
+			expectedField: "spec.deploymentSpec",
+			expectedType:  "object",
+			description:   "autogen-reference.md",
+			fields:        []string{"singleVm", "multiVm"},
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm",
+			expectedField: "spec.deploymentSpec.singleVm",
+			expectedType:  "object",
+			description:   "For solution deploying a single VM",
+			fields:        []string{"images", "bootDisk", "passwords"},
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.deploymentSpec.single_vm.bootDisk",
+			expectedField: "spec.deploymentSpec.singleVm.bootDisk",
+			expectedType:  "object",
+			description:   "Defines boot disk",
+			fields:        []string{"diskType", "diskSize"},
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.firewallRules",
+			expectedField: "spec.deploymentSpec.singleVm.firewallRules",
+			expectedType:  "[]object",
+			fields:        []string{"protocol", "port", "defaultOff"},
+		},
+		{
+			path:          "DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.applicationStatus.type",
+			expectedField: "spec.deploymentSpec.singleVm.applicationStatus.type",
+			expectedType:  "string",
+			description:   "One of NONE, LEGACY_DETECTOR, WAITER.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			e, err := Explain(tc.path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedField, e.Field)
+			assert.Equal(t, tc.expectedType, e.Type)
+			assert.Contains(t, e.Description, tc.description)
+			var names []string
+			for _, f := range e.Fields {
+				names = append(names, f.Name)
+			}
+			for _, name := range tc.fields {
+				assert.Contains(t, names, name)
+			}
+		})
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	testCases := map[string]string{
+		"VirtualMachine":                                                                   "unknown kind",
+		"DeploymentManagerTemplate.zipPath":                                                "field zipPath not found in DeploymentManagerTemplate",
+		"DeploymentManagerTemplate.zipFilePath.bucket":                                     "has no fields",
+		"DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.bootDisks":          "field bootDisks not found in DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm",
+		"DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.zone.defaultZone.x": "has no fields",
+		"DeploymentManagerAutogenTemplate.spec.packageInfo.version.prefix":                 "has no fields",
+	}
+
+	for path, expected := range testCases {
+		t.Run(path, func(t *testing.T) {
+			_, err := Explain(path)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), expected)
+		})
+	}
+}
+
+// TestFieldDocsUpToDate checks that field_docs.go documents every kind, which
+// fails if it was not regenerated with go generate after adding a kind.
+func TestFieldDocsUpToDate(t *testing.T) {
+	for _, kind := range Kinds() {
+		e, err := Explain(kind)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, e.Description, kind)
+	}
+}
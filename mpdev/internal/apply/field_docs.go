@@ -0,0 +1,848 @@
+// Code generated by mpdev/internal/fielddocs. DO NOT EDIT.
+
+package apply
+
+// fieldDocs are the doc comments of types and of their fields, keyed by
+// TypeName and TypeName.FieldName.
+var fieldDocs = map[string]string{
+	"AutogenSpec":                      "AutogenSpec is defines the spec used for auto-generating deployment packages.",
+	"AutogenSpec.DeploymentSpec":       "Deployment Spec is documented in https://github.com/GoogleCloudPlatform/marketplace-tools/docs/autogen-reference.md",
+	"BaseResource":                     "BaseResource contains fields should be present in all Resources. This struct should be embedded in types implementing the resource interface.",
+	"BuildSpec":                        "BuildSpec is an image built by a ContainerRunner.",
+	"BuildSpec.BuildArgs":              "BuildArgs are the values of the ARG instructions of the Dockerfile",
+	"BuildSpec.Context":                "Context is the directory of the build context",
+	"BuildSpec.Dockerfile":             "Dockerfile is the path of the Dockerfile, which defaults to the Dockerfile of Context",
+	"BuildSpec.Tags":                   "Tags are the tags of the image, such as gcr.io/project/app:1.2.3",
+	"CheckSummary":                     "CheckSummary records the result of a check or probe run by a resource, such as a smoke test of a deployment.",
+	"CheckSummary.Status":              "Status is one of succeeded or failed",
+	"CloudDefaults":                    "CloudDefaults are the project, zone and billing project used when calling Google Cloud, such that the same configuration files can be applied to several projects.",
+	"CloudDefaults.BillingProject":     "BillingProject is the project that API calls are billed to and whose quota they use",
+	"CloudDefaults.Project":            "Project is the projectId of resources that do not set it, and the project of commands that do not pass one",
+	"CloudDefaults.Zone":               "Zone is the zone of resources that do not set it, and the zone of commands that do not pass one",
+	"Config":                           "Config is the mpdev configuration file. The top-level options apply to every profile, and are overridden by the options of the selected profile.",
+	"Config.DefaultProfile":            "DefaultProfile is the profile used if none is selected with --profile",
+	"Config.Profiles":                  "Profiles are the named profiles that can be selected with --profile",
+	"ContainerImage":                   "ContainerImage builds a container image from a Dockerfile and pushes it to Container Registry or Artifact Registry. The image is tagged with the full version and the release track, following Marketplace conventions. See https://cloud.google.com/marketplace/docs/partners/kubernetes/maintaining-app#deploying_to_release_tracks",
+	"ContainerImage.BuildArgs":         "BuildArgs are passed to the build as --build-arg values",
+	"ContainerImage.Context":           "Context is the directory of the build context",
+	"ContainerImage.Dockerfile":        "Dockerfile relative to Context. Defaults to Dockerfile",
+	"ContainerImage.Image":             "Image is the repository the image is pushed to, such as gcr.io/project/app",
+	"ContainerImage.Version":           "Version of the image, such as 1.2.3. The image is tagged with the version and its track, 1.2",
+	"ContainerSpec":                    "ContainerSpec is a container run by a ContainerRunner.",
+	"ContainerSpec.Entrypoint":         "Entrypoint is the executable run with Args, which overrides the entrypoint of the image",
+	"ContainerSpec.Env":                "Env are the environment variables of the process, such as KEY=value",
+	"ContainerSpec.Name":               "Name is the name of the container, which identifies containers left by mpdev if it is killed",
+	"ContainerSpec.User":               "User is the user the process runs as, such as 0:0, which overrides the user chosen by the runner",
+	"ConvertOptions":                   "ConvertOptions selects the resources converted by Convert, and what they are converted to.",
+	"ConvertOptions.Name":              "Name of the resource to convert. If empty, all resources are converted.",
+	"ConvertOptions.ToAPIVersion":      "ToAPIVersion is the apiVersion resources are converted to.",
+	"ConvertOptions.ToKind":            "ToKind is the kind resources are converted to. Resources whose kind cannot be converted to ToKind are left unchanged.",
+	"CredentialConfig":                 "CredentialConfig is a workload identity federation credential configuration, as created by gcloud iam workload-identity-pools create-cred-config. See https://cloud.google.com/iam/docs/workload-identity-federation",
+	"DaisyGceImageBuilder":             "DaisyGceImageBuilder uses a Daisy workflow to create a GCEImage when applied. The workflow must declare the image_name variable, which is set to the name of the image to create.",
+	"DaisyGceImageBuilder.Workflow":    "Workflow is the Daisy workflow file",
+	"DaisyGceImageBuilder.Zone":        "Zone the workflow runs in. Defaults to the zone configured by Daisy.",
+	"DeploymentCheck":                  "DeploymentCheck is a script run against a deployment. The check fails if the script exits with a non-zero status.",
+	"DeploymentManagerAutogenTemplate": "DeploymentManagerAutogenTemplate generates a deployment manager template given an autogen.yaml file.",
+	"DeploymentManagerAutogenTemplate.InjectCredentials": "InjectCredentials passes a short-lived access token of the active gcloud account to the autogen container, for autogen images that call Google Cloud, such as a wrapper reading inputs from Cloud Storage",
+	"DeploymentManagerCompositeType":                     "DeploymentManagerCompositeType registers a generated Deployment Manager template as a composite type in a project. The composite type is created if it doesn't exist, and updated otherwise.",
+	"DeploymentManagerCompositeType.ProjectID":           "ProjectID of the project the composite type is registered in",
+	"DeploymentManagerCompositeType.Status":              "Status of the composite type. One of SUPPORTED, EXPERIMENTAL or DEPRECATED.",
+	"DeploymentManagerCompositeType.TypeName":            "TypeName of the composite type. Defaults to the resource name.",
+	"DeploymentManagerDeployment":                        "DeploymentManagerDeployment creates a deployment from a generated Deployment Manager template in a test project, runs checks against the deployment and then deletes it. Deployment outputs are recorded as outputs of the resource.",
+	"DeploymentManagerDeployment.Checks":                 "Checks are scripts executed after the deployment is created. The deployment name, project and outputs are passed to the scripts as environment variables. For example, the vmSelfLink output is passed as DEPLOYMENT_OUTPUT_VMSELFLINK.",
+	"DeploymentManagerDeployment.ConfigFile":             "ConfigFile is the deployment configuration, relative to the root of the template. Defaults to test_config.yaml",
+	"DeploymentManagerDeployment.DeploymentName":         "DeploymentName of the deployment. Defaults to the resource name.",
+	"DeploymentManagerDeployment.EnforceConsoleChecks":   "EnforceConsoleChecks fails the deployment when the console checks fail, which are otherwise reported as warnings",
+	"DeploymentManagerDeployment.ExpectedWaiterError":    "ExpectedWaiterError is a regular expression that the error of a simulated waiter failure must match. Defaults to waiter timeouts.",
+	"DeploymentManagerDeployment.KeepDeployment":         "KeepDeployment skips deleting the deployment after the checks are run, which can be useful for debugging failed checks.",
+	"DeploymentManagerDeployment.Matrix":                 "Matrix optionally creates a deployment for every combination of its machine types, zones and accelerators, such as non-default machine types that reviewers test, and runs the checks and tests against each of them",
+	"DeploymentManagerDeployment.ParallelDeployments":    "ParallelDeployments optionally creates that many deployments of the template at the same time instead of running the checks, and fails if any of them fails, such as for firewall rules or addresses with names that are hard-coded instead of derived from the deployment name",
+	"DeploymentManagerDeployment.ProjectID":              "ProjectID of the test project the deployment is created in",
+	"DeploymentManagerDeployment.ServicePerimeter":       "ServicePerimeter optionally verifies that the solution works inside a VPC Service Controls perimeter, such as accessPolicies/123/servicePerimeters/test. The test project must be protected by the perimeter, either enforced or in dry run mode. API calls blocked by the perimeter while the deployment is created and checked are reported as errors.",
+	"DeploymentManagerDeployment.SimulateWaiterFailure":  "SimulateWaiterFailure verifies the failure that customers see when a VM never signals the waiter, instead of running the checks. The status-variable-path metadata of the VMs is overridden such that the startup script signals a variable the waiter does not watch, and the deployment must fail within the waiterTimeoutSecs of the autogen spec.",
+	"DeploymentManagerDeployment.SkipConsoleChecks":      "SkipConsoleChecks skips fetching the admin URL shown by the Cloud Console once the deployment is created, and checking that the generated passwords have the length and characters of the autogen spec, such as for deployments without an external IP address",
+	"DeploymentManagerDeployment.TestRefs":               "TestRefs are DeploymentTest resources whose probes are run against the deployment after the checks.",
+	"DeploymentManagerPreview":                           "DeploymentManagerPreview verifies that a generated Deployment Manager template expands, by creating a preview of a deployment in a test project. The preview is deleted once it has been created.",
+	"DeploymentManagerPreview.ConfigFile":                "ConfigFile is the deployment configuration, relative to the root of the template. Defaults to test_config.yaml",
+	"DeploymentManagerPreview.DeploymentName":            "DeploymentName of the preview. Defaults to the resource name.",
+	"DeploymentManagerPreview.ProjectID":                 "ProjectID of the test project the preview is created in",
+	"DeploymentManagerTemplate":                          "DeploymentManagerTemplate saves a referenced Deployment Manager template to GCS or the local filesystem. The template is not archived or saved again if neither its contents nor its destinations changed since the last apply recorded in the state file.",
+	"DeploymentManagerTemplate.ArchiveFormat":            "ArchiveFormat is the format of the archive written to ZipFilePath. One of \"zip\" (default) or \"tgz\".",
+	"DeploymentManagerTemplate.KMSKey":                   "KMSKey is the resource name of a Cloud KMS key used to encrypt the objects uploaded to GCS, in the format projects/PROJECT/locations/LOCATION/keyRings/KEYRING/cryptoKeys/KEY. If empty, the default encryption of the bucket is used.",
+	"DeploymentManagerTemplate.LicenseCheck":             "LicenseCheck, if set, fails the apply if the package bundles content, such as third-party scripts and binaries, whose license conflicts with the license of the solution.",
+	"DeploymentManagerTemplate.SignedURL":                "SignedURL optionally generates a time-limited signed URL for the package after it is uploaded to GCS.",
+	"DeploymentManagerTemplate.SizeLimit":                "SizeLimit configures how the size of the archive is checked against the Marketplace package size limit.",
+	"DeploymentManagerTemplate.StripPrefix":              "StripPrefix is a directory, relative to ZipRoot, that is removed from the paths of the files it contains when they are archived. Files outside of StripPrefix keep their path.",
+	"DeploymentManagerTemplate.ZipFilePath":              "Uploads to gcs if file path prefixed with \"gs://\". Otherwise will zip to given local file path. Either a single path or a list of paths, in which case the template is saved to every path.",
+	"DeploymentManagerTemplate.ZipRoot":                  "ZipRoot is a directory of the template, relative to its root, whose contents are placed at the root of the archive. Files outside of ZipRoot are not archived. Defaults to the root of the template.",
+	"DeploymentMatrix":                                   "DeploymentMatrix is a set of machine types, zones and accelerators that a DeploymentManagerDeployment is tested with. A deployment is created for every combination, with the machineType, zone, acceleratorType and acceleratorCount properties of the templates in its configuration set to the values of the combination. Properties of dimensions that are empty are left unchanged.",
+	"DeploymentMatrix.Accelerators":                      "Accelerators attached to the VMs. An accelerator without a type tests the solution without GPUs",
+	"DeploymentMatrix.MachineTypes":                      "MachineTypes of the VMs, such as e2-standard-2 and n1-highmem-8",
+	"DeploymentMatrix.Zones":                             "Zones of the VMs, such as us-central1-a and europe-west1-b",
+	"DeploymentTest":                                     "DeploymentTest describes smoke tests that are run against a deployment created by a DeploymentManagerDeployment referencing it in TestRefs. Values of probes can reference outputs of the deployment as ${outputName}, and the deployment name and project as ${DEPLOYMENT_NAME} and ${DEPLOYMENT_PROJECT}. Applying a DeploymentTest only validates it.",
+	"Diagnostic":                                         "Diagnostic is the result of checking a prerequisite of mpdev.",
+	"Diagnostic.Err":                                     "Err is set if the prerequisite is not met",
+	"Diagnostic.Hint":                                    "Hint describes how to fix the prerequisite if it is not met",
+	"Diagnostic.Name":                                    "Name of the prerequisite",
+	"DocumentLink":                                       "DocumentLink is a titled link to a document.",
+	"Explanation":                                        "Explanation is the documentation of a kind of resource, or of a field of a resource, generated from the doc comments of the Go types of mpdev.",
+	"Explanation.Field":                                  "Field is the path of the field in the resource, such as spec.packageInfo, or empty if the kind is explained",
+	"FieldExplanation":                                   "FieldExplanation is the documentation of a field whose parent is explained.",
+	"FileChange":                                         "FileChange is a file that differs between a published package and the package produced from the local configuration.",
+	"FileChange.Diff":                                    "Diff is the unified diff of a modified file.",
+	"Finding":                                            "Finding is a problem found by Lint.",
+	"Finding.Resource":                                   "Resource is the kind and name of the resource, if the finding is specific to a resource",
+	"FlatFee":                                            "FlatFee is a fixed fee charged every period.",
+	"FlatFee.Period":                                     "Period is one of MONTHLY or YEARLY",
+	"GceImage":                                           "GceImage represents a Google Compute Engine image. One of BuilderRef or ImageRef must be specified",
+	"GceImage.BuilderRef":                                "References a builder resource which handles the actual creation of the GCE Image",
+	"GceImage.ImageRef":                                  "References another GCE Image resource",
+	"GceImageLicenseCheck":                               "GceImageLicenseCheck verifies that the latest image of a GCE image family has the Marketplace licenses of a solution attached, and that the image follows naming conventions. Licenses cannot be changed on an existing image, so images without the licenses must be published again, for example with the licenses field of a GceImage.",
+	"GceImageLicenseCheck.Family":                        "Family of images that is checked",
+	"GceImageLicenseCheck.Licenses":                      "Licenses that must be attached to the image, such as projects/PROJECT/global/licenses/LICENSE",
+	"GceImageLicenseCheck.ProjectID":                     "ProjectID of the project containing the image family",
+	"HTTPProbe":                                          "HTTPProbe sends a GET request to a URL, such as ${adminUrl}, and expects a status code. Redirects are followed, unless the expected status is a redirect.",
+	"HTTPProbe.ExpectedStatus":                           "ExpectedStatus of the response. Defaults to 200",
+	"HTTPProbe.Insecure":                                 "Insecure skips verification of the TLS certificate of the server, which is needed for deployments with self-signed certificates",
+	"HelmChart":                                          "HelmChart lints and packages a Helm chart, and pushes the package to an OCI registry, GCS or a local directory. Other resources, such as K8sAppDeployer, can reference the packaged chart.",
+	"HelmChart.AppVersion":                               "AppVersion overrides the appVersion in Chart.yaml",
+	"HelmChart.Destination":                              "Destination the packaged chart is pushed to. Pushes to an OCI registry if prefixed with \"oci://\", uploads to the GCS directory if prefixed with \"gs://\", and otherwise copies to the local directory.",
+	"HelmChart.Dir":                                      "Dir is the directory of the chart, containing Chart.yaml",
+	"HelmChart.LicenseCheck":                             "LicenseCheck, if set, fails the apply if the chart bundles content, such as third-party scripts and binaries, whose license conflicts with the license of the solution.",
+	"HelmChart.Version":                                  "Version overrides the version in Chart.yaml",
+	"IAMPolicy":                                          "IAMPolicy grants roles to members of a project, such as the roles needed to create test deployments of a solution in a fresh verification project. Existing bindings of the project are kept.",
+	"IAMPolicy.Members":                                  "Members that are granted the roles, such as user:someone@example.com or serviceAccount:ci@project.iam.gserviceaccount.com",
+	"IAMPolicy.ProjectID":                                "ProjectID of the project the roles are granted in",
+	"IAMPolicy.Roles":                                    "Roles granted to every member. Defaults to the roles needed to create test deployments: roles/deploymentmanager.editor, roles/compute.admin and roles/iam.serviceAccountUser",
+	"Image":                                              "Image defines the location of the GCE Image when published",
+	"Image.Family":                                       "Family the image is added to",
+	"Image.Labels":                                       "Labels added to the image",
+	"Image.Licenses":                                     "Licenses attached to the image, such as projects/PROJECT/global/licenses/LICENSE",
+	"ImageTest":                                          "ImageTest boots the latest image of a GCE image family on a standalone instance in a test project, without the templates of the solution, and checks that the instance accepts SSH connections, that the required packages are installed, that the image has Marketplace licenses attached and that no credentials or SSH keys are baked into the image. The instance is deleted once the checks are run.",
+	"ImageTest.Family":                                   "Family of images whose latest image is booted",
+	"ImageTest.ImageProject":                             "ImageProject is the project containing the image family. Defaults to ProjectID",
+	"ImageTest.InstanceName":                             "InstanceName of the instance. Defaults to the resource name",
+	"ImageTest.KeepInstance":                             "KeepInstance skips deleting the instance after the checks are run, which can be useful for debugging failed checks",
+	"ImageTest.Licenses":                                 "Licenses that must be attached to the image, such as projects/PROJECT/global/licenses/LICENSE. If empty, the image must have at least one license attached",
+	"ImageTest.MachineType":                              "MachineType of the instance. Defaults to e2-medium",
+	"ImageTest.ProjectID":                                "ProjectID of the test project the instance is created in",
+	"ImageTest.RequiredPackages":                         "RequiredPackages are deb or rpm packages that must be installed on the image",
+	"ImageTest.TunnelThroughIAP":                         "TunnelThroughIAP creates the instance without an external IP address and connects to it through Identity-Aware Proxy",
+	"ImageTest.Zone":                                     "Zone of the instance",
+	"K8sAppDeployer":                                     "K8sAppDeployer builds and pushes the deployer image of a Kubernetes app sold on GCP Marketplace. See https://github.com/GoogleCloudPlatform/marketplace-k8s-app-tools/blob/master/docs/building-deployer.md",
+	"K8sAppDeployer.BaseImage":                           "BaseImage overrides the onbuild image the deployer is built from. Defaults to gcr.io/cloud-marketplace-tools/k8s/deployer_FLAVOR/onbuild",
+	"K8sAppDeployer.Flavor":                              "Flavor of the deployer. One of \"helm\" or \"envsubst\"",
+	"K8sAppDeployer.HelmChartRef":                        "HelmChartRef references the HelmChart packaged in the deployer of the helm flavor.",
+	"K8sAppDeployer.Image":                               "Image is the repository of the app, such as gcr.io/project/app. The deployer is pushed to Image/deployer",
+	"K8sAppDeployer.ManifestsDir":                        "ManifestsDir is the directory of manifests packaged in the deployer of the envsubst flavor.",
+	"K8sAppDeployer.SchemaFile":                          "SchemaFile is the path to the schema.yaml of the app",
+	"K8sAppDeployer.Track":                               "Track is the release track of the deployer, such as 1.2, used as the tag of the deployer image",
+	"K8sAppDeployer.Version":                             "Version is the full version of the app, such as 1.2.3. If set, the deployer image is additionally tagged with Version.",
+	"K8sAppDeployer.VulnerabilityScan":                   "VulnerabilityScan, if set, fails the deployer before it is built if the images of the app have vulnerabilities",
+	"LicenseCheckOptions":                                "LicenseCheckOptions configures the check of the licenses of the content bundled in a package, such as scripts and binaries of third parties.",
+	"LicenseCheckOptions.AllowedLicenses":                "AllowedLicenses are SPDX identifiers of licenses of bundled content that are compatible with License, in addition to License itself and the permissive Apache-2.0, BSD-2-Clause, BSD-3-Clause, ISC and MIT licenses.",
+	"LicenseCheckOptions.IgnorePaths":                    "IgnorePaths are glob patterns of files that are not checked, relative to the root of the package, such as vendor/*.",
+	"LicenseCheckOptions.License":                        "License is the license of the solution, as an SPDX identifier such as Apache-2.0, or Proprietary.",
+	"ListingAssets":                                      "ListingAssets validates the logo, screenshots and video links of a listing against Marketplace asset requirements, and uploads the images to a GCS bucket. Images must be PNG or JPEG files of at most 5 MB. The logo must be square and at least 512x512 pixels. Up to 8 screenshots can be added, and they must have a 16:9 aspect ratio and be at least 1280x720 pixels. Videos must be YouTube links. Images are uploaded under their file names, so they must have distinct file names. The uploaded assets must still be selected in Partner Portal.",
+	"ListingAssets.Destination":                          "Destination is the GCS path the images are uploaded to, such as gs://bucket/listing. If empty, the assets are only validated.",
+	"ListingAssets.Logo":                                 "Logo is the path to the logo image",
+	"ListingAssets.Screenshots":                          "Screenshots are paths to screenshot images",
+	"ListingAssets.VideoURLs":                            "VideoURLs are links to videos of the solution",
+	"ListingDocuments":                                   "ListingDocuments checks the EULA and documentation links of a listing before they are entered in Partner Portal. Every URL must use https and respond without an error status. The documents must still be added in Partner Portal.",
+	"ListingDocuments.Documentation":                     "Documentation links, such as quick start guides",
+	"ListingDocuments.EulaFile":                          "EulaFile is the path to a local copy of the EULA, such as a PDF uploaded in Partner Portal. Either EulaURL or EulaFile must be set.",
+	"ListingDocuments.EulaURL":                           "EulaURL is a link to the end user license agreement of the solution",
+	"Logger":                                             "Logger writes structured log messages with a verbosity level. Messages with a level above the verbosity of the logger are discarded.",
+	"MatrixAccelerator":                                  "MatrixAccelerator is a GPU configuration of a DeploymentMatrix.",
+	"MatrixAccelerator.Count":                            "Count of GPUs. Defaults to 1",
+	"MatrixAccelerator.Type":                             "Type of the GPUs, such as nvidia-tesla-t4",
+	"Metadata":                                           "Metadata is metadata that all KRM resources must have",
+	"Notification":                                       "Notification publishes a summary of each run of mpdev apply, including the status, duration and outputs of each resource, when all resources have been applied or a resource fails. Failing to send a notification is reported as a warning and does not fail the run. URLs can reference environment variables, such as ${SLACK_WEBHOOK_URL}, so that secrets are not stored in configuration files.",
+	"Notification.DryRun":                                "DryRun also sends notifications for runs with --dryrun",
+	"Notification.OnFailureOnly":                         "OnFailureOnly sends notifications only for runs that fail",
+	"Notification.PubSub":                                "PubSub receives the summary as JSON in a message published to a topic",
+	"Notification.Slack":                                 "Slack receives a message through an incoming webhook",
+	"Notification.Webhook":                               "Webhook receives the summary as JSON in a POST request",
+	"OrgPolicyCheck":                                     "OrgPolicyCheck reports the organization policy constraints of a test project that will break the default deployment of a solution, before any deployment is attempted. The following constraints are checked against the generated templates: compute.requireShieldedVm, compute.vmExternalIpAccess and compute.trustedImageProjects. See https://cloud.google.com/resource-manager/docs/organization-policy/org-policy-constraints",
+	"OrgPolicyCheck.DeploymentManagerRef":                "DeploymentManagerRef references the autogen template whose generated templates are checked",
+	"OrgPolicyCheck.ImageProjects":                       "ImageProjects that the images of the solution are published in. Defaults to the projects of the images referenced by the templates.",
+	"OrgPolicyCheck.ProjectID":                           "ProjectID of the test project",
+	"Overlay":                                            "Overlay patches the resources of its bases, such that the configuration of an environment only contains what differs from the shared base.",
+	"Overlay.Bases":                                      "Bases are configuration files, directories searched for configuration files, or other overlays, relative to the overlay directory.",
+	"Overlay.Patches":                                    "Patches are files, relative to the overlay directory, containing strategic merge patches of the resources of the bases. Each patch selects the resource it patches with its kind and metadata.name, and its apiVersion if kinds of several groups have the same name. Relative paths set by a patch are relative to the overlay directory.",
+	"OverlayResource":                                    "OverlayResource is a resource built from an overlay.",
+	"OverlayResource.Dir":                                "Dir is the directory that relative paths in the resource are resolved against, which is the directory of the base file that defines the resource.",
+	"OverlayResource.PatchDirs":                          "PatchDirs are the directories that the relative paths set by patches are resolved against instead, by path.",
+	"PackageDiff":                                        "PackageDiff lists the files that applying a resource would change in its published package.",
+	"PackageInfo":                                        "PackageInfo describes the software packaged in a deployable solution. PackageInfo is metadata displayed on the VM solution details page in the GCP marketplace console.",
+	"PackageInfo.Components":                             "Names and versions of software components",
+	"PackageInfo.OsInfo":                                 "Name and version of OS",
+	"PackageInfo.Version":                                "Version of combined software components",
+	"PackerGceImageBuilder":                              "PackerGceImageBuilder uses Packer to create a GCEImage when applied. The Packer template must declare the project_id and image_name variables, which are set to the build project and the name of the image to create. The zone and licenses variables are also set if Zone and Licenses are specified and the template declares them. Templates are either JSON files, or HCL2 templates given as a .pkr.hcl file or a directory of them. The plugins required by HCL2 templates are installed with packer init before the build.",
+	"PackerGceImageBuilder.Licenses":                     "Licenses attached to the built image, passed to the template as a list, such as [\"projects/PROJECT/global/licenses/LICENSE\"]",
+	"PackerGceImageBuilder.Zone":                         "Zone the build VM runs in",
+	"PriceModel":                                         "PriceModel describes the pricing of a solution, so that it can be checked for consistency before it is entered in Partner Portal. Applying a PriceModel only validates it.",
+	"PriceModel.Currency":                                "Currency of all prices, as an ISO 4217 code such as USD",
+	"PriceModel.FlatFees":                                "FlatFees are charged once per period",
+	"PriceModel.Skus":                                    "Skus are the identifiers of the SKUs the solution is billed with. Every fee must reference one of them.",
+	"PriceModel.UsageFees":                               "UsageFees are charged per unit of a usage metric",
+	"PriceTier":                                          "PriceTier is the price per unit from StartUnits until the start of the next tier.",
+	"Probe":                                              "Probe is a single check of a deployment. Exactly one of HTTP, TCP or SSH must be set.",
+	"Probe.Retries":                                      "Retries is the number of times a failed probe is retried",
+	"Probe.RetryInterval":                                "RetryInterval between attempts of the probe. Defaults to 10s",
+	"Probe.Timeout":                                      "Timeout of each attempt of the probe. Defaults to 30s",
+	"Profile":                                            "Profile is a set of defaults for the options of mpdev, such that partners working on several listings do not pass the same options to every command.",
+	"Profile.AuditLog":                                   "AuditLog is the default of the --audit-log option",
+	"Profile.AutogenImage":                               "AutogenImage is the container image that generates Deployment Manager templates",
+	"Profile.BuildHost":                                  "BuildHost is the default of the --build-host option",
+	"Profile.BuildHostDir":                               "BuildHostDir is the default of the --build-host-dir option",
+	"Profile.CostThreshold":                              "CostThreshold is the default of the --cost-threshold option",
+	"Profile.FileMode":                                   "FileMode is the default of the --file-mode option",
+	"Profile.FileOwner":                                  "FileOwner is the default of the --file-owner option",
+	"Profile.ImageDigests":                               "ImageDigests are the digests, such as sha256:0123, that the images of containers run by resources must have, by image",
+	"Profile.ImpersonateServiceAccount":                  "ImpersonateServiceAccount is the default of the --impersonate-service-account option",
+	"Profile.MaxCommands":                                "MaxCommands is the maximum number of commands and containers run at once by resources applied in parallel",
+	"Profile.Parallelism":                                "Parallelism is the maximum number of resources applied at once",
+	"Profile.PassEnv":                                    "PassEnv are variables of the environment, by name or by prefix such as TF_VAR_*, that the commands executed by mpdev inherit in addition to the default ones",
+	"Profile.RegistryAuth":                               "RegistryAuth are the credentials with which the images of containers are pulled, by registry host",
+	"Profile.RequireImageDigests":                        "RequireImageDigests refuses to run images whose digest is not pinned in ImageDigests, unless they are referenced by digest",
+	"PubSubNotification":                                 "PubSubNotification is a Pub/Sub topic, such as projects/my-project/topics/mpdev",
+	"QuotaCheck":                                         "QuotaCheck verifies that the Compute Engine quotas of a test project are sufficient to deploy a solution, before a deployment is created. Each machine type of the solution is deployed separately, so the CPU quota must cover the largest machine type. See https://cloud.google.com/compute/quotas",
+	"QuotaCheck.DiskSizeGb":                              "DiskSizeGb of the disks of each instance",
+	"QuotaCheck.DiskType":                                "DiskType of the disks, such as pd-ssd. Defaults to pd-standard",
+	"QuotaCheck.ExternalIPs":                             "ExternalIPs created by a deployment",
+	"QuotaCheck.Instances":                               "Instances created by a deployment. Defaults to 1",
+	"QuotaCheck.MachineTypes":                            "MachineTypes that the solution is tested with, such as e2-standard-2",
+	"QuotaCheck.ProjectID":                               "ProjectID of the test project",
+	"QuotaCheck.Zone":                                    "Zone the solution is deployed to, such as us-central1-a",
+	"Reference":                                          "Reference allows a Resource to reference another Resource as part of its specification. The combination of Group, Kind, Name MUST be unique for all applied resources.",
+	"RegistryAuth":                                       "RegistryAuth configures the credentials with which the images of containers run by resources are pulled from a registry, such as a private mirror. Either CredentialHelper, or Username and PasswordEnv are set.",
+	"RegistryAuth.CredentialHelper":                      "CredentialHelper is a docker credential helper, such as gcloud for docker-credential-gcloud, which prints the credentials of the registry",
+	"RegistryAuth.PasswordEnv":                           "PasswordEnv is the variable of the environment holding the password of Username, such that the password is not in the configuration",
+	"RegistryAuth.Username":                              "Username is the user authenticating with the registry",
+	"ResourceSummary":                                    "ResourceSummary records the result of applying a resource.",
+	"ResourceSummary.Checks":                             "Checks are the checks and probes run by the resource",
+	"ResourceSummary.Stage":                              "Stage is the stage of a publish run that applied the resource",
+	"ResourceSummary.Status":                             "Status is one of succeeded, failed or skipped",
+	"RunSummary":                                         "RunSummary summarizes a run of mpdev apply.",
+	"SSHProbe":                                           "SSHProbe runs a command on a VM of the deployment with gcloud compute ssh, such as to check that a service is running or that the expected version of a package is installed. Exactly one of Command, Service or Package must be set. Command, Instance, Zone, User and ExpectedOutput can reference outputs of the deployment. The probe fails if the command exits with another status than ExpectedExitStatus, or if its output does not contain ExpectedOutput or does not match ExpectedOutputPattern.",
+	"SSHProbe.ExpectedExitStatus":                        "ExpectedExitStatus of the command. Defaults to 0",
+	"SSHProbe.ExpectedOutputPattern":                     "ExpectedOutputPattern is a regular expression that the output must match, such as ^2\\.4\\.",
+	"SSHProbe.Package":                                   "Package is a deb or rpm package that must be installed, whose version is the output of the probe",
+	"SSHProbe.Service":                                   "Service is a systemd unit that must be active, such as google-guest-agent",
+	"SSHProbe.TunnelThroughIAP":                          "TunnelThroughIAP connects to the VM through Identity-Aware Proxy, such as for VMs without an external IP address",
+	"SSHProbe.User":                                      "User that runs the command. Defaults to the user of gcloud",
+	"SaaSIntegration":                                    "SaaSIntegration tests the integration of a SaaS solution with the Partner Procurement API, using an entitlement created by a test purchase of the solution. The account and entitlement of the purchase are approved, as the partner backend would, and their states are verified to become active. See https://cloud.google.com/marketplace/docs/partners/integrated-saas/backend-integration",
+	"SaaSIntegration.AccountID":                          "AccountID of the test account. If set, the account is approved if its activation was requested.",
+	"SaaSIntegration.EntitlementID":                      "EntitlementID of the test purchase",
+	"SaaSIntegration.ProviderID":                         "ProviderID of the partner",
+	"SaaSIntegration.Timeout":                            "Timeout to wait for the entitlement to become active. Defaults to 5m",
+	"ShieldedVMCheck":                                    "ShieldedVMCheck verifies that the images and generated templates of a solution are compatible with Shielded VM, and optionally Confidential VM. Images must support UEFI, and Confidential VM images must also support SEV, and templates must enable Confidential Computing with onHostMaintenance set to TERMINATE. Options that usually need extra care, such as GPUs with Secure Boot or machine series that may not support Confidential VM, are reported as warnings. See https://cloud.google.com/compute/shielded-vm/docs/shielded-vm",
+	"ShieldedVMCheck.ConfidentialVM":                     "ConfidentialVM additionally checks compatibility with Confidential VM",
+	"ShieldedVMCheck.DeploymentManagerRef":               "DeploymentManagerRef optionally references the autogen template whose generated templates are checked",
+	"ShieldedVMCheck.Family":                             "Family of images that is checked. If empty, no image is checked",
+	"ShieldedVMCheck.ProjectID":                          "ProjectID of the project containing the image family",
+	"SignedURLOptions":                                   "SignedURLOptions configures the signed URL generated for a package that was uploaded to GCS.",
+	"SignedURLOptions.Duration":                          "Duration the URL is valid for, using the gsutil signurl format (e.g. 10m, 1h or 7d). Defaults to 1h.",
+	"SignedURLOptions.PrivateKeyFile":                    "PrivateKeyFile is a service account key file used to sign the URL. If empty, the URL is signed using the active service account credentials.",
+	"SizeLimitOptions":                                   "SizeLimitOptions configures the check of an archive's size.",
+	"SizeLimitOptions.Enforce":                           "Enforce fails the apply when the archive exceeds MaxBytes. Otherwise only a warning is printed.",
+	"SizeLimitOptions.MaxBytes":                          "MaxBytes is the maximum size of the archive. Defaults to the Marketplace limit of 10MiB.",
+	"SlackNotification":                                  "SlackNotification is a Slack incoming webhook. See https://api.slack.com/messaging/webhooks",
+	"StartupScript":                                      "StartupScript checks VM startup scripts included in a solution. Each script is parsed with the shell of its #! line, which defaults to bash, and linted with shellcheck, which flags problems such as unquoted variables and bash features used in /bin/sh scripts.",
+	"StartupScript.DeploymentManagerRef":                 "DeploymentManagerRef optionally references the autogen template the scripts are included in, in which case Files are relative to the root of the generated template.",
+	"StartupScript.Files":                                "Files of the startup scripts",
+	"StartupScript.SignalsWaiter":                        "SignalsWaiter requires every script to signal a Runtime Configurator waiter, without which deployments time out.",
+	"StartupScript.SkipShellcheck":                       "SkipShellcheck only parses the scripts",
+	"TCPProbe":                                           "TCPProbe checks that a connection can be opened to a port.",
+	"TelemetryConsent":                                   "TelemetryConsent records whether the user agreed to send anonymous usage metrics. Metrics are only sent after consent is given explicitly with `mpdev telemetry enable`.",
+	"TelemetryConsent.ConsentTime":                       "ConsentTime is when the consent was given or withdrawn",
+	"TelemetryConsent.Endpoint":                          "Endpoint is the URL that usage events are posted to",
+	"TerraformModule":                                    "TerraformModule validates a Terraform module used by a Terraform based VM solution, and saves it as a zip archive to GCS or the local filesystem. The .terraform directories and the lock file written by `terraform init` are not archived.",
+	"TerraformModule.Dir":                                "Dir is the directory containing the root of the module",
+	"TerraformModule.LicenseCheck":                       "LicenseCheck, if set, fails the apply if the module bundles content, such as third-party scripts and binaries, whose license conflicts with the license of the solution.",
+	"TerraformModule.SkipFormatCheck":                    "SkipFormatCheck disables the check that the module is formatted with `terraform fmt`.",
+	"TerraformModule.ZipFilePath":                        "Uploads to gcs if file path prefixed with \"gs://\". Otherwise will zip to given local file path.",
+	"TypeMeta":                                           "TypeMeta describes an individual KRM resource with strings representing the type of the object and its API schema version.",
+	"UsageEvent":                                         "UsageEvent is the anonymous usage metric of a command. It contains no identifiers: no resource names, projects, paths or error messages.",
+	"UsageEvent.ErrorClass":                              "ErrorClass is the class of the failure, such as validation or tool",
+	"UsageEvent.Kinds":                                   "Kinds counts the resources of each kind in the configuration",
+	"UsageFee":                                           "UsageFee is a fee charged for the usage reported for a metric.",
+	"UsageFee.Tiers":                                     "Tiers of prices. The first tier must start at 0 units, and each following tier must start at more units than the previous one.",
+	"UsageMetric":                                        "UsageMetric is a value reported for a metric of a service.",
+	"UsageMetric.Name":                                   "Name of the metric, such as example.endpoints.partner.cloud.goog/requests",
+	"UsageReport":                                        "UsageReport sends a synthetic usage report for the metrics of a solution to Service Control, and verifies that it is accepted. See https://cloud.google.com/marketplace/docs/partners/integrated-saas/reporting-usage",
+	"UsageReport.ConsumerID":                             "ConsumerID is the usage reporting ID of the test entitlement, such as project:some-project",
+	"UsageReport.Metrics":                                "Metrics reported and their values",
+	"UsageReport.ServiceName":                            "ServiceName of the solution, such as example.endpoints.partner.cloud.goog",
+	"VulnerabilityScan":                                  "VulnerabilityScan gates a deployer on the vulnerabilities of the images of the app, such that images with known vulnerabilities are not released.",
+	"VulnerabilityScan.AllowedVulnerabilities":           "AllowedVulnerabilities are the IDs of vulnerabilities that do not fail the scan, such as CVE-2021-44228 in a package the app does not use",
+	"VulnerabilityScan.Scanner":                          "Scanner is containerAnalysis, which reads the vulnerabilities found by Artifact Analysis in images pushed to Artifact Registry, or trivy, which scans images with a local trivy. Defaults to containerAnalysis",
+	"VulnerabilityScan.Severity":                         "Severity is the lowest severity of the vulnerabilities that fail the scan. One of CRITICAL, HIGH, MEDIUM or LOW. Defaults to CRITICAL",
+	"WebhookNotification":                                "WebhookNotification is an HTTP endpoint that notifications are posted to.",
+}
+
+// autogenTypes are the messages and enums of the autogen spec, keyed by
+// name, from docs/autogen-reference.md.
+var autogenTypes = map[string]autogenType{
+	"AcceleratorSpec": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "types", Type: "string", Repeated: true, Description: "One or more accelerator types. If the list contains exactly one item, the type will not be selectable by the user. Currently avaiable types: \"nvidia-tesla-k80\", \"nvidia-tesla-p100\", \"nvidia-tesla-v100\"."},
+			{Name: "defaultType", Type: "string", Repeated: false, Description: "Default accelerator type, which should be one of those listed above"},
+			{Name: "defaultCount", Type: "int32", Repeated: false, Description: "Default number of accelerators. Currently, only values of 0, 1, 2, 4, and 8 are supported."},
+			{Name: "minCount", Type: "int32", Repeated: false, Description: "Minimum number of accelerators (inclusive) that may be selected. Currently, only values of 0, 1, 2, 4, and 8 are supported."},
+			{Name: "maxCount", Type: "int32", Repeated: false, Description: "Maximum number of accelerators (inclusive) that may be selected. Currently, only values of 0, 1, 2, 4, and 8 are supported."},
+		},
+	},
+	"ApplicationStatusSpec": {
+		Description: "Specifies how to monitor application installation status in order to detect when the application is ready or has failed.",
+		Fields: []autogenField{
+			{Name: "type", Type: "ApplicationStatusSpec.StatusType", Repeated: false, Description: "Defines how to monitor application installation status. Required."},
+			{Name: "waiter", Type: "ApplicationStatusSpec.WaiterSpec", Repeated: false, Description: "Required if type is WAITER."},
+		},
+	},
+	"ApplicationStatusSpec.WaiterSpec": {
+		Description: "Specifies how the waiter is setup.",
+		Fields: []autogenField{
+			{Name: "waiterTimeoutSecs", Type: "int32", Repeated: false, Description: "Timeout when the waiter fails itself in absence of status signals. Required."},
+			{Name: "script", Type: "ApplicationStatusSpec.WaiterSpec.ScriptSpec", Repeated: false, Description: "Optional integration with the VM to signal the waiter via startup-script. If the script spec is not present, the application is expected to directly signal the waiter."},
+		},
+	},
+	"ApplicationStatusSpec.WaiterSpec.ScriptSpec": {
+		Description: "Specifies the integration with the VM to signal the waiter via startup-script.",
+		Fields: []autogenField{
+			{Name: "checkTimeoutSecs", Type: "int32", Repeated: false, Description: "If not set, the waiter timeout will be used."},
+			{Name: "checkScriptContent", Type: "string", Repeated: false, Description: "Optional bash script to check the status. This should return 0 if the application is ready, 1 if the application is not yet ready but the check should be retried, and greater than 1 if the check has failed permanently. If the script is not present, the waiter is signaled as soon as the VM finishes booting."},
+			{Name: "disableStartupScriptUrl", Type: "bool", Repeated: false, Description: "If true, the generated template will include an empty \"startup-script-url\" VM metadata value. This effectively disables project-wide startup_script_url settings which took precedence over instance-level startup_script settings in older versions of the Google instance init logic. This option is not necessary for images that use Google base packages newer than June, 2016. See b/31729022 for more context. TODO(volkman): Remove this once all images (Brocade, etc.) have moved to the new base package version."},
+		},
+	},
+	"BooleanExpression": {
+		Description: "Allows to build an expression which value should be evaluated to boolean.",
+		Fields: []autogenField{
+			{Name: "hasExternalIp", Type: "BooleanExpression.ExternalIpAvailability", Repeated: false, Description: ""},
+			{Name: "booleanDeployInputField", Type: "BooleanExpression.BooleanDeployInputField", Repeated: false, Description: ""},
+		},
+	},
+	"BooleanExpression.BooleanDeployInputField": {
+		Description: "Uses the value of a deploy input field of type boolean.",
+		Fields: []autogenField{
+			{Name: "name", Type: "string", Repeated: false, Description: "Name of the deploy input field. Required."},
+			{Name: "negated", Type: "bool", Repeated: false, Description: "If true, negate the value of the input field."},
+		},
+	},
+	"BooleanExpression.ExternalIpAvailability": {
+		Description: "Allows to specify a condition based on external ip configuration for a single instance (for single vm) or all instances in a tier (multi vm).",
+		Fields: []autogenField{
+			{Name: "negated", Type: "bool", Repeated: false, Description: "Specifies if expression is based on external IP being available or not."},
+			{Name: "tier", Type: "string", Repeated: false, Description: "Multi-vm's tier name. It is required for multi vm spec."},
+		},
+	},
+	"DeployInputField": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "name", Type: "string", Repeated: false, Description: "Name of the field. Letters, numbers, dashes, and underscores only. Required."},
+			{Name: "title", Type: "string", Repeated: false, Description: "Title of the field. Required."},
+			{Name: "description", Type: "string", Repeated: false, Description: "Optional description appearing below the title."},
+			{Name: "tooltip", Type: "string", Repeated: false, Description: "Optional tooltip."},
+			{Name: "level", Type: "int32", Repeated: false, Description: "Indicates the \"advanced\" level of the input property. Level 0 (default) will always be shown. Level 1 corresponds to one expansion (user clicks \"show advanced options\" or \"more options\"). Higher levels correspond to further expansions, or they may be collapsed to level 1 by the UI implementation. Optional."},
+			{Name: "required", Type: "bool", Repeated: false, Description: "If required, the user must input a valid value."},
+			{Name: "booleanCheckbox", Type: "DeployInputField.BooleanCheckbox", Repeated: false, Description: ""},
+			{Name: "groupedBooleanCheckbox", Type: "DeployInputField.GroupedBooleanCheckbox", Repeated: false, Description: ""},
+			{Name: "integerBox", Type: "DeployInputField.IntegerBox", Repeated: false, Description: ""},
+			{Name: "integerDropdown", Type: "DeployInputField.IntegerDropdown", Repeated: false, Description: ""},
+			{Name: "stringBox", Type: "DeployInputField.StringBox", Repeated: false, Description: ""},
+			{Name: "stringDropdown", Type: "DeployInputField.StringDropdown", Repeated: false, Description: ""},
+			{Name: "zoneDropdown", Type: "DeployInputField.GceZoneDropdown", Repeated: false, Description: ""},
+			{Name: "emailBox", Type: "DeployInputField.EmailBox", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputField.BooleanCheckbox": {
+		Description: "A checkbox for a boolean value.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "bool", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputField.EmailBox": {
+		Description: "A specialized textbox for email addresses.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "string", Repeated: false, Description: ""},
+			{Name: "validation", Type: "DeployInputField.EmailBox.Validation", Repeated: false, Description: ""},
+			{Name: "placeholder", Type: "string", Repeated: false, Description: "A placeholder to hint the user what to enter here. If not specified, user@example.com is used."},
+			{Name: "testDefaultValue", Type: "string", Repeated: false, Description: "This attribute is used as field's value in automated tests. Defaults to default-user@example.com if this field is required unless the default_value or this field is explicitly present. If present, it overrides the default_value."},
+		},
+	},
+	"DeployInputField.EmailBox.Validation": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "description", Type: "string", Repeated: false, Description: "Description shown to the user if the input value fails validation. If not specified, a default message is used."},
+			{Name: "regex", Type: "string", Repeated: false, Description: "Optional pattern."},
+		},
+	},
+	"DeployInputField.GceZoneDropdown": {
+		Description: "A dropdown with GCE zones as values.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "OptionalString", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputField.GroupedBooleanCheckbox": {
+		Description: "A checkbox displayed next to other checkboxes under a common group title. The group is intended for display purposes only. This is not a radio group; the checkboxes are still independently selectable by the user. The first checkbox in the group should define the display_group. The immediately following GroupedBooleanCheckboxes without a display_group are part of such group. In other words, the group ends when either a different field type or one with a display_group is encountered.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "bool", Repeated: false, Description: ""},
+			{Name: "displayGroup", Type: "DeployInputField.GroupedBooleanCheckbox.DisplayGroup", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputField.GroupedBooleanCheckbox.DisplayGroup": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "name", Type: "string", Repeated: false, Description: "Name of the group. Required. Convention is to use an UPPERCASE_UNDERSCORE name."},
+			{Name: "title", Type: "string", Repeated: false, Description: "Title of the group. Required."},
+			{Name: "description", Type: "string", Repeated: false, Description: "Optional description appearing below the title."},
+			{Name: "tooltip", Type: "string", Repeated: false, Description: "Optional tooltip."},
+		},
+	},
+	"DeployInputField.IntegerBox": {
+		Description: "A textbox for entering an integer, with optional validation.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "OptionalInt32", Repeated: false, Description: ""},
+			{Name: "validation", Type: "DeployInputField.IntegerBox.Validation", Repeated: false, Description: ""},
+			{Name: "placeholder", Type: "string", Repeated: false, Description: ""},
+			{Name: "testDefaultValue", Type: "OptionalInt32", Repeated: false, Description: "This attribute is used as field's value in automated tests. If present, it overrides the default_value. For required fields without default_value, it is required to set test_default_value."},
+		},
+	},
+	"DeployInputField.IntegerBox.Validation": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "description", Type: "string", Repeated: false, Description: "Description shown to the user if the input value fails validation."},
+			{Name: "min", Type: "OptionalInt32", Repeated: false, Description: "Optional inclusive minimum value."},
+			{Name: "max", Type: "OptionalInt32", Repeated: false, Description: "Optional inclusive maximum value."},
+		},
+	},
+	"DeployInputField.IntegerDropdown": {
+		Description: "A dropdown with integer values, with optional labels.",
+		Fields: []autogenField{
+			{Name: "values", Type: "int32", Repeated: true, Description: ""},
+			{Name: "defaultValueIndex", Type: "OptionalInt32", Repeated: false, Description: ""},
+			{Name: "valueLabels", Type: "DeployInputField.IntegerDropdown.ValueLabelsEntry", Repeated: true, Description: "Optional labels for values (not indices). If a value does not have a corresponding label, its numeric string is used."},
+		},
+	},
+	"DeployInputField.IntegerDropdown.ValueLabelsEntry": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "key", Type: "int32", Repeated: false, Description: ""},
+			{Name: "value", Type: "string", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputField.StringBox": {
+		Description: "A textbox for entering a string, with optional validation.",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "string", Repeated: false, Description: ""},
+			{Name: "validation", Type: "DeployInputField.StringBox.Validation", Repeated: false, Description: ""},
+			{Name: "placeholder", Type: "string", Repeated: false, Description: ""},
+			{Name: "testDefaultValue", Type: "string", Repeated: false, Description: "This attribute is used as field's value in automated tests. If present, it overrides the default_value. For required fields without default_value, it is required to set test_default_value."},
+		},
+	},
+	"DeployInputField.StringBox.Validation": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "description", Type: "string", Repeated: false, Description: "Description shown to the user if the input value fails validation."},
+			{Name: "regex", Type: "string", Repeated: false, Description: "Optional pattern."},
+		},
+	},
+	"DeployInputField.StringDropdown": {
+		Description: "A dropdown with string values, with optional labels.",
+		Fields: []autogenField{
+			{Name: "values", Type: "string", Repeated: true, Description: ""},
+			{Name: "defaultValueIndex", Type: "OptionalInt32", Repeated: false, Description: ""},
+			{Name: "valueLabels", Type: "DeployInputField.StringDropdown.ValueLabelsEntry", Repeated: true, Description: "Optional labels for values. If a value does not have a corresponding label, its raw value will be displayed."},
+		},
+	},
+	"DeployInputField.StringDropdown.ValueLabelsEntry": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "key", Type: "string", Repeated: false, Description: ""},
+			{Name: "value", Type: "string", Repeated: false, Description: ""},
+		},
+	},
+	"DeployInputSection": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "placement", Type: "DeployInputSection.Placement", Repeated: false, Description: "Required."},
+			{Name: "name", Type: "string", Repeated: false, Description: "Section name, required if this section is a custom one. Must be unique among all sections. Convention is to use an UPPERCASE_UNDERSCORE name."},
+			{Name: "tier", Type: "string", Repeated: false, Description: "For Placement.TIER, this specifies the required tier name."},
+			{Name: "title", Type: "string", Repeated: false, Description: "Section title, required if this section is a custom one."},
+			{Name: "description", Type: "string", Repeated: false, Description: "Optional description appearing below the title."},
+			{Name: "tooltip", Type: "string", Repeated: false, Description: "Optional tooltip."},
+			{Name: "fields", Type: "DeployInputField", Repeated: true, Description: ""},
+		},
+	},
+	"DeployInputSpec": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "sections", Type: "DeployInputSection", Repeated: true, Description: "One or more sections containing input fields."},
+		},
+	},
+	"DeploymentPackageAutogenSpec": {
+		Description: "Top level spec.",
+		Fields: []autogenField{
+			{Name: "singleVm", Type: "SingleVmDeploymentPackageSpec", Repeated: false, Description: "For solution deploying a single VM."},
+			{Name: "multiVm", Type: "MultiVmDeploymentPackageSpec", Repeated: false, Description: "For solution deploying multiple tiers of VMs."},
+			{Name: "version", Type: "string", Repeated: false, Description: "Human readable version of the deployment package."},
+		},
+	},
+	"DiskSpec": {
+		Description: "Specifies a persistent disk.",
+		Fields: []autogenField{
+			{Name: "diskSize", Type: "DiskSpec.DiskSize", Repeated: false, Description: ""},
+			{Name: "diskType", Type: "DiskSpec.DiskType", Repeated: false, Description: ""},
+			{Name: "displayLabel", Type: "string", Repeated: false, Description: "A short descriptive label for this disk. Optional for boot disk; default is 'Boot disk'. Optional if this is the only one additional disk; default is 'Data disk'. Required otherwise."},
+			{Name: "deviceNameSuffix", Type: "DiskSpec.DeviceName", Repeated: false, Description: "Specifies the device name suffix. Ignored for boot disk. Optional. The final device name will be a concatenation of an instance name with the specified device name."},
+			{Name: "preventAutoDeletion", Type: "bool", Repeated: false, Description: "Whether to leave the disk when the instance is deleted. Ignored for boot disk."},
+		},
+	},
+	"DiskSpec.DeviceName": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "name", Type: "string", Repeated: false, Description: "Device name specified as a constant string. Optional. By default takes the value of disk's name."},
+			{Name: "nameFromDeployInputField", Type: "string", Repeated: false, Description: "Specifies a deploy input field name from which the device name should be read."},
+		},
+	},
+	"DiskSpec.DiskSize": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultSizeGb", Type: "int32", Repeated: false, Description: "The default disk size in GB. Required."},
+			{Name: "minSizeGb", Type: "int32", Repeated: false, Description: "Specifies the min disk size allowed in GB."},
+			{Name: "maxSizeGb", Type: "int32", Repeated: false, Description: "Specifies the max disk size allowed in GB. Not supported yet."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false)."},
+		},
+	},
+	"DiskSpec.DiskType": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultType", Type: "string", Repeated: false, Description: "The default disk type. Required. See http://cloud.google.com/compute/docs/reference/latest/diskTypes."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false)."},
+		},
+	},
+	"ExternalIpSpec": {
+		Description: "Defines how a VM is exposed on the Internet.",
+		Fields: []autogenField{
+			{Name: "defaultType", Type: "ExternalIpSpec.Type", Repeated: false, Description: "Required."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings."},
+		},
+	},
+	"FirewallRuleSpec": {
+		Description: "Specifies a firewall rule.",
+		Fields: []autogenField{
+			{Name: "protocol", Type: "FirewallRuleSpec.Protocol", Repeated: false, Description: "The IP Protocol that the firewall rule allows. Required."},
+			{Name: "port", Type: "string", Repeated: false, Description: "The target ports on the VM, which could be a single port number like \"80\" or a port range like \"32768-40000\"."},
+			{Name: "defaultOff", Type: "bool", Repeated: false, Description: "Specifies that by default it should be off. Applicable to TrafficSource.PUBLIC only."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false). Applicable to TrafficSource.PUBLIC only."},
+			{Name: "allowedSource", Type: "FirewallRuleSpec.TrafficSource", Repeated: false, Description: "Source of traffic, wrapping range/tags with friendly enum. Defaults to TrafficSource.PUBLIC."},
+		},
+	},
+	"GceMetadataItem": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "key", Type: "string", Repeated: false, Description: "Metadata item key. Required."},
+			{Name: "value", Type: "string", Repeated: false, Description: "Static metadata item value."},
+			{Name: "tierVmNames", Type: "GceMetadataItem.TierVmNames", Repeated: false, Description: "The value is the names of one or more VMs in a tier."},
+			{Name: "valueFromDeployInputField", Type: "string", Repeated: false, Description: "Value referenced from deploy input field. Should specify existing input field's name."},
+		},
+	},
+	"GceMetadataItem.TierVmNames": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "tier", Type: "string", Repeated: false, Description: "The tier name."},
+			{Name: "vmIndex", Type: "int32", Repeated: false, Description: "0-based index of a VM. A negative index can be used, with -1 referring the last, -2 the second last, etc."},
+			{Name: "allVms", Type: "GceMetadataItem.TierVmNames.AllVmList", Repeated: false, Description: "All VM names as a string list."},
+		},
+	},
+	"GceMetadataItem.TierVmNames.AllVmList": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "delimiter", Type: "string", Repeated: false, Description: "Delimiter for the VM names in the list, for example a comma. Required."},
+		},
+	},
+	"GceStartupScriptSpec": {
+		Description: "Specifies the initial startup script for a VM instance.",
+		Fields: []autogenField{
+			{Name: "bashScriptContent", Type: "string", Repeated: false, Description: "Specifies a complete startup script. If waiter specifies its check script, those two will be combined with a software_status_script.py resource. Required."},
+		},
+	},
+	"GcpAuthScopeSpec": {
+		Description: "Specifies access to an GCP API on the VM. This effectively configures the corresponding scope under the VM's service account.",
+		Fields: []autogenField{
+			{Name: "scope", Type: "GcpAuthScopeSpec.Scope", Repeated: false, Description: "API scope. Required."},
+			{Name: "defaultOff", Type: "bool", Repeated: false, Description: "Specifies that by default it should be off."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false)."},
+		},
+	},
+	"ImageSpec": {
+		Description: "Specifies a disk image resource.",
+		Fields: []autogenField{
+			{Name: "project", Type: "string", Repeated: false, Description: "The GCP project containing the image. Required."},
+			{Name: "name", Type: "string", Repeated: false, Description: "The name of the image. Required."},
+			{Name: "label", Type: "string", Repeated: false, Description: "A descriptive label for this image, useful in a list of images for the user to select from."},
+		},
+	},
+	"InstanceUrlSpec": {
+		Description: "Specifies a URL used for accessing the application on the VM. The domain is implied as the VM instance address. Currently the machine IP is used, but that might change to another endpoint in the future.",
+		Fields: []autogenField{
+			{Name: "scheme", Type: "InstanceUrlSpec.Scheme", Repeated: false, Description: "The URL scheme."},
+			{Name: "port", Type: "int32", Repeated: false, Description: "The URL port."},
+			{Name: "path", Type: "string", Repeated: false, Description: "The URL path, without the leading forward slash."},
+			{Name: "query", Type: "string", Repeated: false, Description: "The URL query, without the leading question mark."},
+			{Name: "fragment", Type: "string", Repeated: false, Description: "The URL fragment, without the leading hash sign."},
+			{Name: "tierVm", Type: "TierVmInstance", Repeated: false, Description: "Specifies a VM from tier whose address would be used. Required in a multi-VM configuration."},
+		},
+	},
+	"Int32List": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "values", Type: "int32", Repeated: true, Description: ""},
+		},
+	},
+	"Int32Range": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "startValue", Type: "int32", Repeated: false, Description: "The inclusive starting value. Required."},
+			{Name: "endValue", Type: "int32", Repeated: false, Description: "The inclusive ending value. Required."},
+		},
+	},
+	"IpForwardingSpec": {
+		Description: "Specifies if the VM can route IP packets. See http://cloud.google.com/compute/docs/networking#eventualconsistency.",
+		Fields: []autogenField{
+			{Name: "defaultOff", Type: "bool", Repeated: false, Description: "Specifies that by default it should be off."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false)."},
+		},
+	},
+	"LocalSsdSpec": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "count", Type: "int32", Repeated: false, Description: "Specifies the number of local SSDs to be attached to a vm instance."},
+			{Name: "countFromDeployInputField", Type: "string", Repeated: false, Description: "Specifies the number of local SSDs by referencing a value from a deploy input field."},
+		},
+	},
+	"MachineTypeSpec": {
+		Description: "Specifies the default machine type, and any size constraints which restrict what the user can select.",
+		Fields: []autogenField{
+			{Name: "defaultMachineType", Type: "MachineTypeSpec.MachineType", Repeated: false, Description: "Specifies the machine type that should be selecteed by default. Required."},
+			{Name: "minimum", Type: "MachineTypeSpec.MachineTypeConstraint", Repeated: false, Description: "Specifies the minimum requirement for a user-selected machine type."},
+			{Name: "maximum", Type: "MachineTypeSpec.MachineTypeConstraint", Repeated: false, Description: "Specifies the minimum requirement for a user-selected machine type. Not supported yet (no max)."},
+			{Name: "notConfigurable", Type: "bool", Repeated: false, Description: "Whether to restrict the user from changing away from the default settings. Not supported yet (always false)."},
+		},
+	},
+	"MachineTypeSpec.MachineType": {
+		Description: "Specifies a machine type.",
+		Fields: []autogenField{
+			{Name: "gceMachineType", Type: "string", Repeated: false, Description: "A predefined or custom machine type. Required. See http://cloud.google.com/compute/docs/machine-types."},
+		},
+	},
+	"MachineTypeSpec.MachineTypeConstraint": {
+		Description: "Specifies an upper- or lower-bound constraint.",
+		Fields: []autogenField{
+			{Name: "cpu", Type: "int32", Repeated: false, Description: ""},
+			{Name: "ramGb", Type: "float", Repeated: false, Description: ""},
+		},
+	},
+	"MultiVmDeploymentPackageSpec": {
+		Description: "Specifies a solution that deploys Multiple VMs.",
+		Fields: []autogenField{
+			{Name: "tiers", Type: "VmTierSpec", Repeated: true, Description: "One or more tiers."},
+			{Name: "siteUrl", Type: "InstanceUrlSpec", Repeated: false, Description: "Declares a URL to access the deployed application."},
+			{Name: "adminUrl", Type: "InstanceUrlSpec", Repeated: false, Description: "Declares a URL to administer the deployed application."},
+			{Name: "passwords", Type: "PasswordSpec", Repeated: true, Description: "Defines how to generate passwords at deployment time."},
+			{Name: "postDeploy", Type: "PostDeployInfo", Repeated: false, Description: "Customizes post-deploy information displayed to the user. This helps get the user started with using the deployed solution."},
+			{Name: "deployInput", Type: "DeployInputSpec", Repeated: false, Description: "Customizes additional inputs configured by user prior to deployment. Currently, the configured values can be passed through to the VM via metadata items."},
+			{Name: "zone", Type: "ZoneSpec", Repeated: false, Description: "Customizes the zone selector."},
+			{Name: "stackdriver", Type: "StackdriverSpec", Repeated: false, Description: "Integration with Stackdriver."},
+		},
+	},
+	"NetworkInterfacesSpec": {
+		Description: "Network interfaces configuration for this solution.",
+		Fields: []autogenField{
+			{Name: "minCount", Type: "int32", Repeated: false, Description: "Minimum number of Network Interfaces (defaults to 1)."},
+			{Name: "maxCount", Type: "int32", Repeated: false, Description: "Maximum number of Network Interfaces (can't exceed 8 and if not specified, will take the value of min_count)."},
+			{Name: "externalIp", Type: "ExternalIpSpec", Repeated: false, Description: ""},
+			{Name: "labels", Type: "string", Repeated: true, Description: "Label that will be in front of each Network Interface (according to the index in this list). If the list is greater than min_count, the last label will be used to name all networks added beyond min_count."},
+		},
+	},
+	"OptionalInt32": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "value", Type: "int32", Repeated: false, Description: ""},
+		},
+	},
+	"OptionalString": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "value", Type: "string", Repeated: false, Description: ""},
+		},
+	},
+	"PasswordSpec": {
+		Description: "Specifies a generated password and username combination.",
+		Fields: []autogenField{
+			{Name: "metadataKey", Type: "string", Repeated: false, Description: "Specifies the name of the metadata entry, whose value contains the generated password, accessible to the VM. Must be unique per password spec in the same package spec. Required."},
+			{Name: "length", Type: "int32", Repeated: false, Description: "The length of the generated password. Required."},
+			{Name: "allowSpecialChars", Type: "bool", Repeated: false, Description: "Whether special characters should be included in the generated password."},
+			{Name: "username", Type: "string", Repeated: false, Description: "Specifies a static username accompanying this password."},
+			{Name: "usernameFromDeployInputField", Type: "string", Repeated: false, Description: "Specifies that the username should come from a deploy input field whose name is specified here."},
+			{Name: "displayLabel", Type: "string", Repeated: false, Description: "A label describing the purpose of this username/password. Required, unless this is the only password, in which case the label defaults to \"Admin\"."},
+			{Name: "generateIf", Type: "BooleanExpression", Repeated: false, Description: "Specifies a condition to decide if password should be generated or not. Optional. If it is not specified, the password is generated."},
+		},
+	},
+	"PostDeployInfo": {
+		Description: "Customizes post-deploy information displayed to the user. This information helps get the user started with using the deployed solution.",
+		Fields: []autogenField{
+			{Name: "actionItems", Type: "PostDeployInfo.ActionItem", Repeated: true, Description: ""},
+			{Name: "infoRows", Type: "PostDeployInfo.InfoRow", Repeated: true, Description: ""},
+			{Name: "connectButtonLabel", Type: "string", Repeated: false, Description: "Optional label to use for the button that connects to the VM. Deprecated in favor of connect_button.display_label."},
+			{Name: "connectButton", Type: "PostDeployInfo.ConnectToInstanceSpec", Repeated: false, Description: ""},
+		},
+	},
+	"PostDeployInfo.ActionItem": {
+		Description: "Specifies an action item for the user to take. Text content fields can either contain non-localized en-US text or a reference (e.g. @ACTION_1_HEADING) into a localized text file. The latter is not yet implemented, so only en-US text for now.",
+		Fields: []autogenField{
+			{Name: "heading", Type: "string", Repeated: false, Description: "Summary heading for the item. UTF-8 text. No markup. At most 64 characters. Required."},
+			{Name: "description", Type: "string", Repeated: false, Description: "Longer description of the item. UTF-8 text. HTML <code>&lt;a href&gt;</code> tags only. At most 512 characters. Optional. At least one of description or snippet is required."},
+			{Name: "snippet", Type: "string", Repeated: false, Description: "Fixed-width formatted code snippet. Accepts string expressions. UTF-8 text. No markup. At most 512 characters. Optional. At least one of description or snippet is required."},
+			{Name: "showIf", Type: "BooleanExpression", Repeated: false, Description: "Specify the condition to display this action item. Optional."},
+		},
+	},
+	"PostDeployInfo.ConnectToInstanceSpec": {
+		Description: "Specifies a connect button configuration.",
+		Fields: []autogenField{
+			{Name: "tierVm", Type: "TierVmInstance", Repeated: false, Description: "Specifies a VM from tier whose address would be used. Required in a multi-vm configuration. Mustn't be specified for a single-vm."},
+			{Name: "displayLabel", Type: "string", Repeated: false, Description: "Optional label to use for the button that connects to the VM."},
+		},
+	},
+	"PostDeployInfo.InfoRow": {
+		Description: "Specifies a row in the application info table. Text content fields can either contain non-localized en-US text or a reference (e.g. @ROW_1_HEADING) into a localized text file. The latter is not yet implemented, so only en-US text for now.",
+		Fields: []autogenField{
+			{Name: "label", Type: "string", Repeated: false, Description: "Row label. Required. Accepts string expressions. UTF-8 text. No markup. At most 64 characters."},
+			{Name: "value", Type: "string", Repeated: false, Description: "Row value. Accepts string expressions. UTF-8 text. HTML <code>&lt;a href&gt;</code> tags only. At most 128 characters."},
+			{Name: "valueFromDeployInputField", Type: "string", Repeated: false, Description: "Row value referenced from deploy input field. Should specify existing input field's name."},
+			{Name: "showIf", Type: "BooleanExpression", Repeated: false, Description: "Specify the condition to display this row. Optional."},
+		},
+	},
+	"SingleVmDeploymentPackageSpec": {
+		Description: "Specifies a solution that deploys a single VM.",
+		Fields: []autogenField{
+			{Name: "images", Type: "ImageSpec", Repeated: true, Description: "Defines the disk images. If there are more than one, the user can select which image to deploy with. The 1st image is the default. Required."},
+			{Name: "machineType", Type: "MachineTypeSpec", Repeated: false, Description: "Specifies the default machine type, and any size constraints which restrict what the user can select. Will use defaults if not specified."},
+			{Name: "bootDisk", Type: "DiskSpec", Repeated: false, Description: "Defines boot disk. Will use defaults if not specified."},
+			{Name: "localSsds", Type: "LocalSsdSpec", Repeated: false, Description: "Specifies additionally added local SSD disks (with a default naming convention)."},
+			{Name: "additionalDisks", Type: "DiskSpec", Repeated: true, Description: "Defines additional persistent disks. Optional."},
+			{Name: "ipForwarding", Type: "IpForwardingSpec", Repeated: false, Description: "If not specified, IP forwarding is forced off and not user-configurable."},
+			{Name: "networkInterfaces", Type: "NetworkInterfacesSpec", Repeated: false, Description: "Spec to define Multi/Single NIC(s) usage for this solution."},
+			{Name: "firewallRules", Type: "FirewallRuleSpec", Repeated: true, Description: "Specifies the default firewall rules to access the deployed application. They could be off by default, but should still be listed so that the user can get instructions on how to enable them post-deployment."},
+			{Name: "siteUrl", Type: "InstanceUrlSpec", Repeated: false, Description: "Declares a URL to access the deployed application."},
+			{Name: "adminUrl", Type: "InstanceUrlSpec", Repeated: false, Description: "Declares a URL to administer the deployed application."},
+			{Name: "passwords", Type: "PasswordSpec", Repeated: true, Description: "Defines how to generate passwords at deployment time."},
+			{Name: "gcpAuthScopes", Type: "GcpAuthScopeSpec", Repeated: true, Description: "Declares what GCP APIs should be available to the VM."},
+			{Name: "gceStartupScript", Type: "GceStartupScriptSpec", Repeated: false, Description: "Specifies a startup script for a VM instance."},
+			{Name: "applicationStatus", Type: "ApplicationStatusSpec", Repeated: false, Description: "Defines how to determine the application installation status in post-deployment. This tells when the application is ready for consumption."},
+			{Name: "externalIp", Type: "ExternalIpSpec", Repeated: false, Description: "Defines how the VM is accessible from the Internet. Will use defaults if not specified. DEPRECATED! Use NetworkInterfacesSpec instead."},
+			{Name: "postDeploy", Type: "PostDeployInfo", Repeated: false, Description: "Customizes post-deploy information displayed to the user. This helps get the user started with using the deployed solution."},
+			{Name: "gceMetadataItems", Type: "GceMetadataItem", Repeated: true, Description: "Customizes metadata items on a GCE VM instance."},
+			{Name: "accelerators", Type: "AcceleratorSpec", Repeated: true, Description: "Attach accelerator hardware (GPU) to the VM. Currently at most one accelerator spec is supported."},
+			{Name: "deployInput", Type: "DeployInputSpec", Repeated: false, Description: "Customizes additional inputs configured by user prior to deployment. Currently, the configured values can be passed through to the VM via metadata items."},
+			{Name: "zone", Type: "ZoneSpec", Repeated: false, Description: "Customizes the zone selector."},
+			{Name: "stackdriver", Type: "StackdriverSpec", Repeated: false, Description: "Integration with Stackdriver."},
+		},
+	},
+	"StackdriverSpec": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "logging", Type: "StackdriverSpec.Logging", Repeated: false, Description: "Shows a checkbox that enable Stackdriver Logging."},
+			{Name: "monitoring", Type: "StackdriverSpec.Monitoring", Repeated: false, Description: "Shows a checkbox that enable Stackdriver Monitoring."},
+		},
+	},
+	"StackdriverSpec.Logging": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultOn", Type: "bool", Repeated: false, Description: "Specifies that by default it should be on."},
+		},
+	},
+	"StackdriverSpec.Monitoring": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultOn", Type: "bool", Repeated: false, Description: "Specifies that by default it should be on."},
+		},
+	},
+	"TierVmInstance": {
+		Description: "Identifies a specific VM in a tier.",
+		Fields: []autogenField{
+			{Name: "tier", Type: "string", Repeated: false, Description: "Name of the tier."},
+			{Name: "index", Type: "int32", Repeated: false, Description: "0-based index of the VM in the tier. A negative index can be used, with -1 referring the last, -2 the second last, etc."},
+		},
+	},
+	"VmTierSpec": {
+		Description: "A tier consists of one or more VMs of the same type. Each VM is uniquely identified by its index.",
+		Fields: []autogenField{
+			{Name: "name", Type: "string", Repeated: false, Description: "Unique name for this tier. Only lowercases. Required."},
+			{Name: "title", Type: "string", Repeated: false, Description: "Display title for this tier. Required."},
+			{Name: "instanceCount", Type: "VmTierSpec.TierInstanceCount", Repeated: false, Description: "Defines the number of VM instances in this tier."},
+			{Name: "images", Type: "ImageSpec", Repeated: true, Description: "Defines the disk images. If there are more than one, the user can select which image to deploy with. The 1st image is the default. Required."},
+			{Name: "machineType", Type: "MachineTypeSpec", Repeated: false, Description: "Specifies the default machine type, and any size constraints which restrict what the user can select. Will use defaults if not specified."},
+			{Name: "bootDisk", Type: "DiskSpec", Repeated: false, Description: "Defines boot disk. Will use defaults if not specified."},
+			{Name: "additionalDisks", Type: "DiskSpec", Repeated: true, Description: "Defines additional persistent disks to attach to each VM. Optional"},
+			{Name: "localSsds", Type: "LocalSsdSpec", Repeated: false, Description: "Specifies additionally added local SSD disks (with a default naming convention)."},
+			{Name: "ipForwarding", Type: "IpForwardingSpec", Repeated: false, Description: "If not specified, IP forwarding is forced off and not user-configurable."},
+			{Name: "networkInterfaces", Type: "NetworkInterfacesSpec", Repeated: false, Description: "Spec to define Multi/Single NIC(s) usage for this solution."},
+			{Name: "gcpAuthScopes", Type: "GcpAuthScopeSpec", Repeated: true, Description: "Declares what GCP APIs should be available to the VM."},
+			{Name: "gceStartupScript", Type: "GceStartupScriptSpec", Repeated: false, Description: "Specifies a startup script for each VM instance in this tier."},
+			{Name: "applicationStatus", Type: "ApplicationStatusSpec", Repeated: false, Description: "Defines how to determine that VMs in this tier are ready to serve. The entire deployment is ready to serve when all tiers are."},
+			{Name: "externalIp", Type: "ExternalIpSpec", Repeated: false, Description: "Defines how the VMs are accessible from the Internet. Will use defaults if not specified. DEPRECATED! Use NetworkInterfacesSpec instead."},
+			{Name: "gceMetadataItems", Type: "GceMetadataItem", Repeated: true, Description: "Customizes metadata items on each GCE VM instance."},
+			{Name: "accelerators", Type: "AcceleratorSpec", Repeated: true, Description: "Attach accelerator hardware (GPU) to the VM. Currently at most accelerator is supported."},
+			{Name: "firewallRules", Type: "FirewallRuleSpec", Repeated: true, Description: "Specifies the default firewall rules to access the VMs in this tier. They could be off by default, but should still be listed so that the user can get instructions on how to enable them post-deployment."},
+		},
+	},
+	"VmTierSpec.TierInstanceCount": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultValue", Type: "int32", Repeated: false, Description: "The default number of instances. Must satisfy the constraint."},
+			{Name: "range", Type: "Int32Range", Repeated: false, Description: "Specifies a range of contiguous values."},
+			{Name: "list", Type: "Int32List", Repeated: false, Description: "Explicitly lists out the supported values."},
+			{Name: "tooltip", Type: "string", Repeated: false, Description: "Optional. Specify the tooltip text. If not specified, it will get a default value."},
+			{Name: "description", Type: "string", Repeated: false, Description: "Optional. Field's description."},
+		},
+	},
+	"ZoneSpec": {
+		Description: "",
+		Fields: []autogenField{
+			{Name: "defaultZone", Type: "string", Repeated: false, Description: "Sets the default zone."},
+			{Name: "whitelistedZones", Type: "string", Repeated: true, Description: "Lists the zones that are allowed to be used in this DM package. If list is empty, all zones are allowed."},
+			{Name: "whitelistedRegions", Type: "string", Repeated: true, Description: "Lists the regions that are allowed to be used in this DM package. Only the zones that belong to the specified regions will be allowed to be used."},
+		},
+	},
+	"ApplicationStatusSpec.StatusType": {
+		Description: "Defines how to monitor application installation status.",
+		Values:      []string{"NONE", "LEGACY_DETECTOR", "WAITER"},
+	},
+	"DeployInputSection.Placement": {
+		Description: "Defines where this section should be placed.",
+		Values:      []string{"PLACEMENT_UNSPECIFIED", "MAIN", "CUSTOM_TOP", "CUSTOM_BOTTOM", "TIER"},
+	},
+	"ExternalIpSpec.Type": {
+		Description: "How the VM is exposed on the Internet.",
+		Values:      []string{"TYPE_UNSPECIFIED", "NONE", "EPHEMERAL"},
+	},
+	"FirewallRuleSpec.Protocol": {
+		Description: "The IP Protocol that the firewall rule allows.",
+		Values:      []string{"PROTOCOL_UNSPECIFIED", "TCP", "UDP", "ICMP"},
+	},
+	"FirewallRuleSpec.TrafficSource": {
+		Description: "Description of network source.",
+		Values:      []string{"SOURCE_UNSPECIFIED", "PUBLIC", "TIER", "DEPLOYMENT"},
+	},
+	"GcpAuthScopeSpec.Scope": {
+		Description: "API scope.",
+		Values:      []string{"SCOPE_UNSPECIFIED", "CLOUD_PLATFORM_READONLY", "CLOUD_PLATFORM", "COMPUTE_READONLY", "COMPUTE", "SOURCE_READ_WRITE", "PROJECTHOSTING"},
+	},
+	"InstanceUrlSpec.Scheme": {
+		Description: "The URL scheme. Required.",
+		Values:      []string{"SCHEME_UNSPECIFIED", "HTTP", "HTTPS"},
+	},
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// accessToken returns a short-lived access token of the active gcloud
+// account.
+func accessToken(executor exec.Interface) (string, error) {
+	token, err := runCommandOutput(executor, "gcloud", "auth", "print-access-token")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get access token from gcloud")
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// callGoogleAPI sends a request to a Google API with curl, authenticated
+// with the access token of the active gcloud account. If body is not nil,
+// it is sent as JSON. The response is decoded into response if it is not
+// nil.
+func callGoogleAPI(executor exec.Interface, method string, url string, body interface{}, response interface{}) error {
+	token, err := accessToken(executor)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-sS", "--fail", "-X", method, "-H", "@-", "-H", "Content-Type: application/json"}
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--data-binary", string(b))
+	}
+	args = append(args, url)
+
+	// The authorization header is passed on stdin so that the token does
+	// not appear in the arguments of the process.
+	var stdout bytes.Buffer
+	cmd := executor.Command("curl", args...)
+	cmd.SetStdin(strings.NewReader("Authorization: Bearer " + token + "\n"))
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(os.Stderr)
+	err = cmd.Run()
+	if err != nil {
+		return errors.Wrapf(err, "%s request to %s failed", method, url)
+	}
+
+	if response == nil {
+		return nil
+	}
+	err = json.Unmarshal(stdout.Bytes(), response)
+	return errors.Wrapf(err, "failed to parse response of %s request to %s", method, url)
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestCallGoogleAPI(t *testing.T) {
+	var header string
+	fcmd := testingexec.FakeCmd{}
+	fcmd.RunScript = []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return []byte("token\n"), nil, nil },
+		func() ([]byte, []byte, error) {
+			b, err := ioutil.ReadAll(fcmd.Stdin)
+			header = string(b)
+			return []byte(`{"state": "ACCOUNT_ACTIVE"}`), nil, err
+		},
+	}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction}}
+
+	var account procurementAccount
+	err := callGoogleAPI(executor, "POST", "https://example.googleapis.com/v1/a", map[string]string{"k": "v"}, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, "ACCOUNT_ACTIVE", account.State)
+	assert.Equal(t, "Authorization: Bearer token\n", header)
+	assert.Equal(t, [][]string{
+		{"gcloud", "auth", "print-access-token"},
+		{"curl", "-sS", "--fail", "-X", "POST", "-H", "@-", "-H", "Content-Type: application/json",
+			"--data-binary", `{"k":"v"}`, "https://example.googleapis.com/v1/a"},
+	}, fcmd.RunLog)
+}
+
+// fakeGoogleAPI returns an executor that responds to each call of
+// callGoogleAPI with the next response. A response starting with "error"
+// fails the request.
+func fakeGoogleAPI(fcmd *testingexec.FakeCmd, responses ...string) *testingexec.FakeExec {
+	executor := &testingexec.FakeExec{}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(fcmd, cmd, args...) }
+	for _, response := range responses {
+		response := response
+		fcmd.RunScript = append(fcmd.RunScript,
+			func() ([]byte, []byte, error) { return []byte("token"), nil, nil },
+			func() ([]byte, []byte, error) {
+				if len(response) >= 5 && response[:5] == "error" {
+					return nil, nil, fmt.Errorf("%s", response)
+				}
+				return []byte(response), nil, nil
+			})
+		executor.CommandScript = append(executor.CommandScript, cmdAction, cmdAction)
+	}
+	return executor
+}
+
+// apiRequests returns the method and URL of the requests sent with curl.
+func apiRequests(fcmd *testingexec.FakeCmd) []string {
+	var requests []string
+	for _, argv := range fcmd.RunLog {
+		if argv[0] == "curl" {
+			requests = append(requests, argv[4]+" "+argv[len(argv)-1])
+		}
+	}
+	return requests
+}
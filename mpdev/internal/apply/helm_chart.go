@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// HelmChart lints and packages a Helm chart, and pushes the package to an
+// OCI registry, GCS or a local directory. Other resources, such as
+// K8sAppDeployer, can reference the packaged chart.
+type HelmChart struct {
+	BaseResource
+	// Dir is the directory of the chart, containing Chart.yaml
+	Dir string
+	// Destination the packaged chart is pushed to. Pushes to an OCI
+	// registry if prefixed with "oci://", uploads to the GCS directory if
+	// prefixed with "gs://", and otherwise copies to the local directory.
+	Destination string
+	// Version overrides the version in Chart.yaml
+	Version string
+	// AppVersion overrides the appVersion in Chart.yaml
+	AppVersion string
+	// LicenseCheck, if set, fails the apply if the chart bundles content,
+	// such as third-party scripts and binaries, whose license conflicts
+	// with the license of the solution.
+	LicenseCheck *LicenseCheckOptions
+
+	// packaged is the chart packaged by Apply, which resources referencing
+	// the chart extract, named packageName.
+	packaged    []byte
+	packageName string
+}
+
+type chartMetadata struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+// Apply lints, packages and pushes a Helm chart.
+func (h *HelmChart) Apply(registry Registry, dryRun bool) error {
+	if h.Dir == "" {
+		return errors.New("dir cannot be empty for Helm chart")
+	}
+	if h.Destination == "" {
+		return errors.New("destination cannot be empty for Helm chart")
+	}
+	if h.LicenseCheck != nil {
+		if err := h.LicenseCheck.validate(); err != nil {
+			return ValidationError(err)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	dir, err := registry.ResolveFilePath(h, h.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve path to Helm chart: %s", h.Dir)
+	}
+	chart, err := readChartMetadata(dir)
+	if err != nil {
+		return err
+	}
+	err = checkSecrets(dir, "Helm chart "+h.Dir)
+	if err != nil {
+		return err
+	}
+	if h.LicenseCheck != nil {
+		err = h.LicenseCheck.check(dir, "Helm chart "+h.Dir)
+		if err != nil {
+			return err
+		}
+	}
+	version := h.Version
+	if version == "" {
+		version = chart.Version
+	}
+
+	executor := registry.GetExecutor()
+	fmt.Printf("Linting Helm chart %s\n", dir)
+	err = runCommand(executor, "helm", "lint", dir)
+	if err != nil {
+		return errors.Wrapf(err, "helm lint failed for chart %s", dir)
+	}
+
+	packageDir, err := util.CreateTmpDir("helmchart")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(packageDir)
+	args := []string{"package", dir, "--destination", packageDir}
+	if h.Version != "" {
+		args = append(args, "--version", h.Version)
+	}
+	if h.AppVersion != "" {
+		args = append(args, "--app-version", h.AppVersion)
+	}
+	err = runCommand(executor, "helm", args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to package Helm chart %s", dir)
+	}
+	packageName := fmt.Sprintf("%s-%s.tgz", chart.Name, version)
+	packagePath := filepath.Join(packageDir, packageName)
+
+	chartLocation, err := h.push(registry, packagePath, chart.Name, version, packageName)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Helm chart pushed to %s\n", chartLocation)
+
+	h.packaged, err = ioutil.ReadFile(packagePath)
+	if err != nil {
+		return err
+	}
+	h.packageName = packageName
+	registry.SetOutput(h, "chart", chartLocation)
+	registry.SetOutput(h, "version", version)
+	return nil
+}
+
+// push saves the chart packaged at packagePath to the destination and
+// returns the location of the chart.
+func (h *HelmChart) push(registry Registry, packagePath string, name string, version string, packageName string) (string, error) {
+	executor := registry.GetExecutor()
+	destination := strings.TrimSuffix(h.Destination, "/")
+
+	switch {
+	case strings.HasPrefix(destination, "oci://"):
+		err := runCommand(executor, "helm", "push", packagePath, destination)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to push Helm chart to %s", destination)
+		}
+		return fmt.Sprintf("%s/%s:%s", destination, name, version), nil
+	case isGCSPath(destination):
+		gcsPath := destination + "/" + packageName
+		err := runCommand(executor, "gsutil", "cp", packagePath, gcsPath)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to copy Helm chart to GCS path: %s", gcsPath)
+		}
+		return gcsPath, nil
+	default:
+		dir, err := registry.ResolveFilePath(h, destination)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve path to destination: %s", destination)
+		}
+		path := filepath.Join(dir, packageName)
+		err = util.CopyFile(packagePath, path)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to copy Helm chart to %s", path)
+		}
+		return path, setOutputPermissions(path)
+	}
+}
+
+func readChartMetadata(dir string) (*chartMetadata, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read Chart.yaml of Helm chart %s", dir)
+	}
+
+	var chart chartMetadata
+	err = yaml.Unmarshal(b, &chart)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse Chart.yaml of Helm chart %s", dir)
+	}
+	if chart.Name == "" || chart.Version == "" {
+		return nil, fmt.Errorf("Chart.yaml of Helm chart %s must specify name and version", dir)
+	}
+	return &chart, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestHelmChart(t *testing.T) {
+	chartDir, err := ioutil.TempDir("", "chart")
+	assert.NoError(t, err)
+	defer os.RemoveAll(chartDir)
+	err = ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: wordpress\nversion: 1.2.0\n"), 0644)
+	assert.NoError(t, err)
+
+	gplChartDir, err := ioutil.TempDir("", "chart")
+	assert.NoError(t, err)
+	defer os.RemoveAll(gplChartDir)
+	writeFiles(t, gplChartDir, map[string]string{
+		"Chart.yaml": "name: wordpress\nversion: 1.2.0\n",
+		"COPYING":    gpl2Text,
+	})
+
+	localDir := filepath.Join(chartDir, "out")
+	testCases := []struct {
+		name            string
+		dir             string
+		destination     string
+		version         string
+		licenseCheck    *LicenseCheckOptions
+		lintErr         error
+		dryRun          bool
+		expectErr       bool
+		expectedChart   string
+		expectedVersion string
+	}{{
+		name:            "OCI registry",
+		dir:             chartDir,
+		destination:     "oci://us-docker.pkg.dev/project/charts",
+		expectedChart:   "oci://us-docker.pkg.dev/project/charts/wordpress:1.2.0",
+		expectedVersion: "1.2.0",
+	}, {
+		name:            "GCS with version override",
+		dir:             chartDir,
+		destination:     "gs://bucket/charts/",
+		version:         "1.3.0",
+		expectedChart:   "gs://bucket/charts/wordpress-1.3.0.tgz",
+		expectedVersion: "1.3.0",
+	}, {
+		name:            "Local directory",
+		dir:             chartDir,
+		destination:     localDir,
+		expectedChart:   filepath.Join(localDir, "wordpress-1.2.0.tgz"),
+		expectedVersion: "1.2.0",
+	}, {
+		name:            "License check",
+		dir:             chartDir,
+		destination:     localDir,
+		licenseCheck:    &LicenseCheckOptions{License: "Apache-2.0"},
+		expectedChart:   filepath.Join(localDir, "wordpress-1.2.0.tgz"),
+		expectedVersion: "1.2.0",
+	}, {
+		name:         "License conflict",
+		dir:          gplChartDir,
+		destination:  localDir,
+		licenseCheck: &LicenseCheckOptions{License: "Apache-2.0"},
+		expectErr:    true,
+	}, {
+		name:        "Lint failure",
+		dir:         chartDir,
+		destination: localDir,
+		lintErr:     fmt.Errorf("1 chart(s) linted, 1 chart(s) failed"),
+		expectErr:   true,
+	}, {
+		name:        "Missing Chart.yaml",
+		dir:         localDir,
+		destination: localDir,
+		expectErr:   true,
+	}, {
+		name:      "Missing destination",
+		dir:       chartDir,
+		expectErr: true,
+	}, {
+		name:        "Dry run",
+		dir:         chartDir,
+		destination: localDir,
+		dryRun:      true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			fcmd.RunScript = []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return nil, nil, tc.lintErr },
+				fakeHelmPackageAction(&fcmd),
+				func() ([]byte, []byte, error) { return nil, nil, nil },
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			h := newTestHelmChart(tc.dir, tc.destination)
+			h.Version = tc.version
+			h.LicenseCheck = tc.licenseCheck
+			r.RegisterResource(h, "resourcedir")
+
+			err := h.Apply(r, tc.dryRun)
+			if tc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.dryRun {
+				assert.Equal(t, 0, fcmd.RunCalls)
+				return
+			}
+
+			outputs := r.GetOutputs(h.GetReference())
+			assert.Equal(t, tc.expectedChart, outputs["chart"])
+			assert.Equal(t, tc.expectedVersion, outputs["version"])
+			assert.Equal(t, []string{"helm", "lint", chartDir}, fcmd.RunLog[0])
+			assert.Equal(t, []string{"helm", "package", chartDir, "--destination"}, fcmd.RunLog[1][:4])
+			assert.Equal(t, "wordpress-"+tc.expectedVersion+".tgz", h.packageName)
+			assert.NotNil(t, h.packaged)
+			packageDir := fcmd.RunLog[1][4]
+			_, err = os.Stat(packageDir)
+			assert.True(t, os.IsNotExist(err), "the package directory is removed")
+		})
+	}
+}
+
+// fakeHelmPackageAction writes a package to the destination directory passed
+// to `helm package`.
+func fakeHelmPackageAction(fcmd *testingexec.FakeCmd) testingexec.FakeRunAction {
+	return func() ([]byte, []byte, error) {
+		version := "1.2.0"
+		for i, arg := range fcmd.Argv {
+			if arg == "--version" {
+				version = fcmd.Argv[i+1]
+			}
+		}
+		path := filepath.Join(fcmd.Argv[4], fmt.Sprintf("wordpress-%s.tgz", version))
+		return nil, nil, ioutil.WriteFile(path, []byte("chart"), 0644)
+	}
+}
+
+func newTestHelmChart(dir string, destination string) *HelmChart {
+	return &HelmChart{
+		BaseResource: BaseResource{
+			TypeMeta{
+				APIVersion: apiVersion,
+				Kind:       "HelmChart",
+			},
+			Metadata{Name: "chart"},
+		},
+		Dir:         dir,
+		Destination: destination,
+	}
+}
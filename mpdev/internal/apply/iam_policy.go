@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTestDeploymentRoles are the roles needed to deploy and verify a
+// solution in a test project.
+var defaultTestDeploymentRoles = []string{
+	"roles/deploymentmanager.editor",
+	"roles/compute.admin",
+	"roles/iam.serviceAccountUser",
+}
+
+var memberPrefixes = []string{"user:", "serviceAccount:", "group:", "domain:"}
+
+// IAMPolicy grants roles to members of a project, such as the roles needed
+// to create test deployments of a solution in a fresh verification project.
+// Existing bindings of the project are kept.
+type IAMPolicy struct {
+	BaseResource
+	// ProjectID of the project the roles are granted in
+	ProjectID string `json:"projectId"`
+	// Members that are granted the roles, such as
+	// user:someone@example.com or serviceAccount:ci@project.iam.gserviceaccount.com
+	Members []string
+	// Roles granted to every member. Defaults to the roles needed to create
+	// test deployments: roles/deploymentmanager.editor, roles/compute.admin
+	// and roles/iam.serviceAccountUser
+	Roles []string
+}
+
+// Apply adds a binding of every role to every member.
+func (p *IAMPolicy) Apply(registry Registry, dryRun bool) error {
+	if p.ProjectID == "" {
+		return errors.New("projectId cannot be empty for IAM policy")
+	}
+	if len(p.Members) == 0 {
+		return errors.New("members cannot be empty for IAM policy")
+	}
+	for _, member := range p.Members {
+		if !hasMemberPrefix(member) {
+			return fmt.Errorf("invalid member: %s. Must be prefixed with one of %s", member, strings.Join(memberPrefixes, ", "))
+		}
+	}
+	roles := p.Roles
+	if len(roles) == 0 {
+		roles = defaultTestDeploymentRoles
+	}
+	for _, role := range roles {
+		if !strings.HasPrefix(role, "roles/") && !strings.HasPrefix(role, "projects/") {
+			return fmt.Errorf("invalid role: %s. Must be prefixed with roles/ or projects/", role)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	executor := registry.GetExecutor()
+	for _, member := range p.Members {
+		for _, role := range roles {
+			fmt.Printf("Granting %s to %s in project %s\n", role, member, p.ProjectID)
+			err := runCommand(executor, "gcloud", "projects", "add-iam-policy-binding", p.ProjectID,
+				"--member", member, "--role", role, "--format", "none")
+			if err != nil {
+				return errors.Wrapf(err, "failed to grant %s to %s in project %s", role, member, p.ProjectID)
+			}
+		}
+	}
+	return nil
+}
+
+func hasMemberPrefix(member string) bool {
+	for _, prefix := range memberPrefixes {
+		if strings.HasPrefix(member, prefix) && len(member) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
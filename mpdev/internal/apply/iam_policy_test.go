@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestIAMPolicy(t *testing.T) {
+	binding := func(member string, role string) []string {
+		return []string{"gcloud", "projects", "add-iam-policy-binding", "test-project",
+			"--member", member, "--role", role, "--format", "none"}
+	}
+	testCases := []struct {
+		name            string
+		members         []string
+		roles           []string
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:    "Default roles",
+		members: []string{"user:dev@example.com"},
+		expectedRunArgs: [][]string{
+			binding("user:dev@example.com", "roles/deploymentmanager.editor"),
+			binding("user:dev@example.com", "roles/compute.admin"),
+			binding("user:dev@example.com", "roles/iam.serviceAccountUser"),
+		},
+	}, {
+		name:    "Custom roles",
+		members: []string{"user:dev@example.com", "serviceAccount:ci@p.iam.gserviceaccount.com"},
+		roles:   []string{"roles/viewer"},
+		expectedRunArgs: [][]string{
+			binding("user:dev@example.com", "roles/viewer"),
+			binding("serviceAccount:ci@p.iam.gserviceaccount.com", "roles/viewer"),
+		},
+	}, {
+		name:      "Member without type",
+		members:   []string{"dev@example.com"},
+		expectErr: true,
+	}, {
+		name:      "Invalid role",
+		members:   []string{"user:dev@example.com"},
+		roles:     []string{"viewer"},
+		expectErr: true,
+	}, {
+		name:      "No members",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for i := 0; i < 3; i++ {
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return nil, nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			p := &IAMPolicy{
+				BaseResource: newTestBaseResource("IAMPolicy", "iam"),
+				ProjectID:    "test-project",
+				Members:      tc.members,
+				Roles:        tc.roles,
+			}
+			r.RegisterResource(p, "dir")
+
+			err := p.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
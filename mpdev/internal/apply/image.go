@@ -14,14 +14,111 @@
 
 package apply
 
-// PackerGceImageBuilder uses Packer to create a GCEImage when applied
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// imageNameRegex matches valid GCE image names.
+var imageNameRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// gceImageBuilder is implemented by resources that build a GCE image that a
+// GceImage can publish.
+type gceImageBuilder interface {
+	Resource
+	// getBuiltImage returns the image created when the builder was applied.
+	getBuiltImage() *builtImage
+}
+
+// builtImage identifies an image created in a build project.
+type builtImage struct {
+	project string
+	name    string
+}
+
+// imageBuild contains the fields shared by image builders.
+type imageBuild struct {
+	// ProjectID of the build project the image is created in
+	ProjectID string `json:"projectId"`
+	// ImageName of the created image. Defaults to the resource name.
+	ImageName string
+	// Vars are additional variables passed to the build
+	Vars map[string]string
+
+	built *builtImage
+}
+
+func (b *imageBuild) getBuiltImage() *builtImage {
+	return b.built
+}
+
+func (b *imageBuild) validate(resourceName string) (string, error) {
+	if b.ProjectID == "" {
+		return "", errors.New("projectId cannot be empty for image build")
+	}
+	name := b.ImageName
+	if name == "" {
+		name = resourceName
+	}
+	if !imageNameRegex.MatchString(name) {
+		return "", fmt.Errorf("invalid image name: %s. Must match regex %s", name, imageNameRegex)
+	}
+	return name, nil
+}
+
+// sortedVars returns the build variables and values sorted by variable name.
+func (b *imageBuild) sortedVars(extra map[string]string) [][2]string {
+	vars := map[string]string{}
+	for k, v := range b.Vars {
+		vars[k] = v
+	}
+	for k, v := range extra {
+		vars[k] = v
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := make([][2]string, 0, len(names))
+	for _, name := range names {
+		sorted = append(sorted, [2]string{name, vars[name]})
+	}
+	return sorted
+}
+
+// PackerGceImageBuilder uses Packer to create a GCEImage when applied. The
+// Packer template must declare the project_id and image_name variables,
+// which are set to the build project and the name of the image to create.
+// The zone and licenses variables are also set if Zone and Licenses are
+// specified and the template declares them. Templates are either JSON files,
+// or HCL2 templates given as a .pkr.hcl file or a directory of them. The
+// plugins required by HCL2 templates are installed with packer init before
+// the build.
 type PackerGceImageBuilder struct {
 	BaseResource
+	imageBuild
 	Builder struct {
 		Script struct {
+			// File is the Packer template
 			File string
 		}
 	}
+	// Zone the build VM runs in
+	Zone string
+	// Licenses attached to the built image, passed to the template as a
+	// list, such as ["projects/PROJECT/global/licenses/LICENSE"]
+	Licenses []string
 
 	Tests []struct {
 		Name   string
@@ -33,6 +130,197 @@ type PackerGceImageBuilder struct {
 
 // Apply build a GCE image using Packer
 func (p *PackerGceImageBuilder) Apply(registry Registry, dryRun bool) error {
+	name, err := p.validate(p.Metadata.Name)
+	if err != nil {
+		return ValidationError(err)
+	}
+	if p.Builder.Script.File == "" {
+		return errors.New("builder.script.file cannot be empty for Packer image build")
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	template, err := registry.ResolveFilePath(p, p.Builder.Script.File)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve path to Packer template: %s", p.Builder.Script.File)
+	}
+
+	vars, hcl2, err := p.templateVars(template, name)
+	if err != nil {
+		return err
+	}
+
+	executor := registry.GetExecutor()
+	if hcl2 {
+		fmt.Printf("Installing plugins of Packer template %s\n", p.Builder.Script.File)
+		err = runCommand(executor, "packer", "init", template)
+		if err != nil {
+			return errors.Wrapf(err, "failed to install plugins of Packer template %s", p.Builder.Script.File)
+		}
+	}
+
+	args := []string{"build"}
+	for _, v := range p.sortedVars(vars) {
+		args = append(args, "-var", v[0]+"="+v[1])
+	}
+	args = append(args, template)
+
+	fmt.Printf("Building image %s in project %s with Packer\n", name, p.ProjectID)
+	err = runCommand(executor, "packer", args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to build image %s with Packer", name)
+	}
+
+	p.built = &builtImage{project: p.ProjectID, name: name}
+	registry.SetOutput(p, "image", imageSelfLink(p.ProjectID, name))
+	registry.SetOutput(p, "imageName", name)
+	return nil
+}
+
+// packerVariableRegex matches variable declarations of HCL2 templates.
+var packerVariableRegex = regexp.MustCompile(`(?m)^\s*variable\s+"([^"]+)"`)
+
+// templateVars returns the Marketplace variables set for a Packer template,
+// and whether the template uses HCL2.
+func (p *PackerGceImageBuilder) templateVars(template string, name string) (map[string]string, bool, error) {
+	vars := map[string]string{"project_id": p.ProjectID, "image_name": name}
+	optional := map[string]string{}
+	if p.Zone != "" {
+		optional["zone"] = p.Zone
+	}
+	if len(p.Licenses) > 0 {
+		licenses, err := json.Marshal(p.Licenses)
+		if err != nil {
+			return nil, false, err
+		}
+		optional["licenses"] = string(licenses)
+	}
+
+	files := []string{template}
+	info, err := os.Stat(template)
+	hcl2 := strings.HasSuffix(template, ".pkr.hcl") || err == nil && info.IsDir()
+	if err == nil && info.IsDir() {
+		files, err = filepath.Glob(filepath.Join(template, "*.pkr.hcl"))
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	var declared map[string]bool
+	if hcl2 {
+		declared, err = hclTemplateVariables(files)
+		if err != nil {
+			return nil, false, err
+		}
+		for variable := range vars {
+			if !declared[variable] {
+				return nil, false, fmt.Errorf("Packer template %s must declare variable %s", p.Builder.Script.File, variable)
+			}
+		}
+	} else if len(optional) > 0 {
+		// JSON templates are only read when optional variables are set, as
+		// Packer fails on variables that a template does not declare.
+		declared, err = jsonTemplateVariables(template)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	for k, v := range optional {
+		if declared[k] {
+			vars[k] = v
+		} else {
+			fmt.Printf("Packer template %s does not declare variable %s, which is not set\n", p.Builder.Script.File, k)
+		}
+	}
+	return vars, hcl2, nil
+}
+
+// hclTemplateVariables returns the variables declared by the files of an
+// HCL2 template.
+func hclTemplateVariables(files []string) (map[string]bool, error) {
+	declared := map[string]bool{}
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read Packer template %s", file)
+		}
+		for _, match := range packerVariableRegex.FindAllStringSubmatch(string(contents), -1) {
+			declared[match[1]] = true
+		}
+	}
+	return declared, nil
+}
+
+// jsonTemplateVariables returns the variables declared by a JSON template.
+func jsonTemplateVariables(file string) (map[string]bool, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read Packer template %s", file)
+	}
+	var template struct {
+		Variables map[string]interface{} `json:"variables"`
+	}
+	err = json.Unmarshal(contents, &template)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse Packer template %s", file)
+	}
+	declared := map[string]bool{}
+	for variable := range template.Variables {
+		declared[variable] = true
+	}
+	return declared, nil
+}
+
+// DaisyGceImageBuilder uses a Daisy workflow to create a GCEImage when
+// applied. The workflow must declare the image_name variable, which is set
+// to the name of the image to create.
+type DaisyGceImageBuilder struct {
+	BaseResource
+	imageBuild
+	// Workflow is the Daisy workflow file
+	Workflow string
+	// Zone the workflow runs in. Defaults to the zone configured by Daisy.
+	Zone string
+}
+
+// Apply builds a GCE image using Daisy
+func (d *DaisyGceImageBuilder) Apply(registry Registry, dryRun bool) error {
+	name, err := d.validate(d.Metadata.Name)
+	if err != nil {
+		return ValidationError(err)
+	}
+	if d.Workflow == "" {
+		return errors.New("workflow cannot be empty for Daisy image build")
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	workflow, err := registry.ResolveFilePath(d, d.Workflow)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve path to Daisy workflow: %s", d.Workflow)
+	}
+
+	args := []string{"-project", d.ProjectID}
+	if d.Zone != "" {
+		args = append(args, "-zone", d.Zone)
+	}
+	for _, v := range d.sortedVars(map[string]string{"image_name": name}) {
+		args = append(args, "-var:"+v[0]+"="+v[1])
+	}
+	args = append(args, workflow)
+
+	fmt.Printf("Building image %s in project %s with Daisy\n", name, d.ProjectID)
+	err = runCommand(registry.GetExecutor(), "daisy", args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to build image %s with Daisy", name)
+	}
+
+	d.built = &builtImage{project: d.ProjectID, name: name}
+	registry.SetOutput(d, "image", imageSelfLink(d.ProjectID, name))
 	return nil
 }
 
@@ -50,15 +338,121 @@ type GceImage struct {
 	Image      Image
 }
 
+// GetDependencies returns dependencies for GceImage
+func (g *GceImage) GetDependencies() (r []Reference) {
+	if g.BuilderRef != (Reference{}) {
+		r = append(r, g.BuilderRef)
+	}
+	if g.ImageRef != (Reference{}) {
+		r = append(r, g.ImageRef)
+	}
+	return r
+}
+
 // Apply publishes an image to with the project and name specified in
 // the GceImage
 func (g *GceImage) Apply(registry Registry, dryRun bool) error {
+	err := g.validate(registry)
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	source, err := g.getSource(registry)
+	if err != nil {
+		return err
+	}
+
+	name := g.Image.name()
+	args := []string{"compute", "images", "create", name,
+		"--project", g.Image.ProjectID,
+		"--source-image", source.name,
+		"--source-image-project", source.project}
+	if len(g.Image.Licenses) > 0 {
+		args = append(args, "--licenses", strings.Join(g.Image.Licenses, ","))
+	}
+	if g.Image.Family != "" {
+		args = append(args, "--family", g.Image.Family)
+	}
+	if len(g.Image.Labels) > 0 {
+		args = append(args, "--labels", formatLabels(g.Image.Labels))
+	}
+
+	fmt.Printf("Publishing image %s to project %s\n", name, g.Image.ProjectID)
+	err = runCommand(registry.GetExecutor(), "gcloud", args...)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create image %s in project %s", name, g.Image.ProjectID)
+	}
+
+	registry.SetOutput(g, "selfLink", imageSelfLink(g.Image.ProjectID, name))
+	return nil
+}
+
+func (g *GceImage) validate(registry Registry) error {
+	hasBuilder := g.BuilderRef != (Reference{})
+	hasImage := g.ImageRef != (Reference{})
+	if hasBuilder == hasImage {
+		return errors.New("exactly one of builderRef or imageRef must be specified for GCE image")
+	}
+	if hasBuilder {
+		if _, ok := registry.GetResource(g.BuilderRef).(gceImageBuilder); !ok {
+			return fmt.Errorf("referenced image builder is not correct type %+v", g.BuilderRef)
+		}
+	} else if _, ok := registry.GetResource(g.ImageRef).(*GceImage); !ok {
+		return fmt.Errorf("referenced GCE image is not correct type %+v", g.ImageRef)
+	}
+
+	if g.Image.ProjectID == "" {
+		return errors.New("image.projectId cannot be empty for GCE image")
+	}
+	name := g.Image.name()
+	if !imageNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid image name: %s. Must match regex %s", name, imageNameRegex)
+	}
 	return nil
 }
 
+// getSource returns the image that is published.
+func (g *GceImage) getSource(registry Registry) (*builtImage, error) {
+	if g.BuilderRef != (Reference{}) {
+		builder := registry.GetResource(g.BuilderRef).(gceImageBuilder)
+		built := builder.getBuiltImage()
+		if built == nil {
+			return nil, fmt.Errorf("image builder %+v did not build an image", g.BuilderRef)
+		}
+		return built, nil
+	}
+
+	image := registry.GetResource(g.ImageRef).(*GceImage)
+	return &builtImage{project: image.Image.ProjectID, name: image.Image.name()}, nil
+}
+
 // Image defines the location of the GCE Image when published
 type Image struct {
 	ProjectID          string `json:"projectId"`
 	NamePartsSeparator string
 	NameParts          []string
+	// Family the image is added to
+	Family string
+	// Licenses attached to the image, such as
+	// projects/PROJECT/global/licenses/LICENSE
+	Licenses []string
+	// Labels added to the image
+	Labels map[string]string
+}
+
+// name joins the name parts of the image. The separator defaults to "-".
+func (i *Image) name() string {
+	separator := i.NamePartsSeparator
+	if separator == "" {
+		separator = "-"
+	}
+	return strings.Join(i.NameParts, separator)
+}
+
+func imageSelfLink(project string, name string) string {
+	return fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/global/images/%s", project, name)
 }
@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+const defaultImageTestMachineType = "e2-medium"
+
+// imageTestSSHProbe is the probe that waits for the booted instance to
+// accept SSH connections. Images commonly take a few minutes to boot and
+// to run the guest agent, which adds the SSH key of gcloud.
+var imageTestSSHProbe = Probe{Name: "ssh", Retries: 12, RetryInterval: "15s"}
+
+// bakedSecretsScript prints the files of the booted image that contain
+// credentials or SSH keys, which would be shared by every VM of the image:
+// the private keys and Cloud SDK or AWS credentials of users, authorized
+// keys that were not added by the guest agent from metadata, and SSH host
+// keys that are older than the boot, which were generated before the image
+// was created. It is passed base64 encoded, such that the shell of the VM
+// and the expansion of probe values leave it unchanged.
+const bakedSecretsScript = `for home in /root /home/*; do
+  for f in .ssh/id_rsa .ssh/id_dsa .ssh/id_ecdsa .ssh/id_ed25519 .config/gcloud/credentials.db .config/gcloud/access_tokens.db .config/gcloud/legacy_credentials .aws/credentials .git-credentials .netrc; do
+    [ -e "$home/$f" ] && echo "$home/$f"
+  done
+  [ -f "$home/.ssh/authorized_keys" ] && awk '/^# Added by Google/ { getline; next } NF && !/^#/ { print FILENAME; exit }' "$home/.ssh/authorized_keys"
+done
+find /etc/ssh -name 'ssh_host_*_key' ! -newer /proc/1 2>/dev/null
+true
+`
+
+// ImageTest boots the latest image of a GCE image family on a standalone
+// instance in a test project, without the templates of the solution, and
+// checks that the instance accepts SSH connections, that the required
+// packages are installed, that the image has Marketplace licenses attached
+// and that no credentials or SSH keys are baked into the image. The
+// instance is deleted once the checks are run.
+type ImageTest struct {
+	BaseResource
+	// ProjectID of the test project the instance is created in
+	ProjectID string `json:"projectId"`
+	// ImageProject is the project containing the image family. Defaults
+	// to ProjectID
+	ImageProject string
+	// Family of images whose latest image is booted
+	Family string
+	// Zone of the instance
+	Zone string
+	// MachineType of the instance. Defaults to e2-medium
+	MachineType string
+	// InstanceName of the instance. Defaults to the resource name
+	InstanceName string
+	// RequiredPackages are deb or rpm packages that must be installed on
+	// the image
+	RequiredPackages []string
+	// Licenses that must be attached to the image, such as
+	// projects/PROJECT/global/licenses/LICENSE. If empty, the image must
+	// have at least one license attached
+	Licenses []string
+	// TunnelThroughIAP creates the instance without an external IP address
+	// and connects to it through Identity-Aware Proxy
+	TunnelThroughIAP bool `json:"tunnelThroughIap"`
+	// KeepInstance skips deleting the instance after the checks are run,
+	// which can be useful for debugging failed checks
+	KeepInstance bool
+
+	// results of the checks of the last apply
+	results []CheckSummary
+}
+
+// Apply boots the image, runs the checks and deletes the instance.
+func (c *ImageTest) Apply(registry Registry, dryRun bool) (err error) {
+	err = c.validate()
+	if err != nil {
+		return ValidationError(err)
+	}
+	if dryRun {
+		return nil
+	}
+	c.results = nil
+
+	imageProject := c.ImageProject
+	if imageProject == "" {
+		imageProject = c.ProjectID
+	}
+	image, err := describeImageFamily(registry, imageProject, c.Family)
+	if err != nil {
+		return err
+	}
+
+	var checkErr error
+	start := time.Now()
+	licenseErr := c.checkLicenses(image)
+	c.results = append(c.results, newCheckSummary("licenses", start, licenseErr))
+	if licenseErr != nil {
+		checkErr = multierror.Append(checkErr, licenseErr)
+	}
+
+	name := deploymentName(c.InstanceName, c.Metadata.Name)
+	machineType := c.MachineType
+	if machineType == "" {
+		machineType = defaultImageTestMachineType
+	}
+	executor := registry.GetExecutor()
+	fmt.Printf("Booting image %s on instance %s in project %s\n", image.Name, name, c.ProjectID)
+	args := []string{"compute", "instances", "create", name, "--project", c.ProjectID, "--zone", c.Zone,
+		"--image", image.Name, "--image-project", imageProject, "--machine-type", machineType}
+	if c.TunnelThroughIAP {
+		args = append(args, "--no-address")
+	}
+	err = runCommand(executor, "gcloud", args...)
+	if err != nil {
+		return multierror.Append(checkErr, errors.Wrapf(err, "failed to create instance %s", name))
+	}
+	if !c.KeepInstance {
+		defer func() {
+			fmt.Printf("Deleting instance %s\n", name)
+			deleteErr := runCommand(executor, "gcloud", "compute", "instances", "delete", name,
+				"--project", c.ProjectID, "--zone", c.Zone, "--quiet")
+			if deleteErr != nil {
+				err = multierror.Append(err, errors.Wrapf(deleteErr, "failed to delete instance %s", name))
+			}
+		}()
+	}
+
+	// The other checks connect to the instance, so they are skipped if it
+	// does not accept SSH connections.
+	ssh := imageTestSSHProbe
+	ssh.SSH = c.sshProbe("true")
+	if err := c.runProbe(executor, ssh); err != nil {
+		return multierror.Append(checkErr, errors.Wrapf(err, "image %s does not accept SSH connections", image.Name))
+	}
+	for _, pkg := range c.RequiredPackages {
+		probe := Probe{Name: "packages/" + pkg, SSH: c.sshProbe("")}
+		probe.SSH.Package = pkg
+		if err := c.runProbe(executor, probe); err != nil {
+			checkErr = multierror.Append(checkErr, err)
+		}
+	}
+
+	start = time.Now()
+	secretsErr := c.checkBakedSecrets(executor, image.Name)
+	c.results = append(c.results, newCheckSummary("credentials", start, secretsErr))
+	if secretsErr != nil {
+		checkErr = multierror.Append(checkErr, secretsErr)
+	}
+
+	if checkErr != nil {
+		return checkErr
+	}
+	fmt.Printf("All checks passed for image %s\n", image.Name)
+	registry.SetOutput(c, "image", image.SelfLink)
+	return nil
+}
+
+func (c *ImageTest) checkResults() []CheckSummary {
+	return c.results
+}
+
+func (c *ImageTest) validate() error {
+	if c.ProjectID == "" {
+		return errors.New("projectId cannot be empty for image test")
+	}
+	if !imageNameRegex.MatchString(c.Family) {
+		return fmt.Errorf("invalid image family: %s. Must match regex %s", c.Family, imageNameRegex)
+	}
+	if c.Zone == "" {
+		return errors.New("zone cannot be empty for image test")
+	}
+	if name := deploymentName(c.InstanceName, c.Metadata.Name); !imageNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid instance name: %s. Must match regex %s", name, imageNameRegex)
+	}
+	for _, pkg := range c.RequiredPackages {
+		if !unitNameRegex.MatchString(pkg) {
+			return fmt.Errorf("invalid package name for image test: %s", pkg)
+		}
+	}
+	for _, license := range c.Licenses {
+		if !licenseRegex.MatchString(normalizeLicense(license)) {
+			return fmt.Errorf("invalid license: %s. Must be in the format projects/PROJECT/global/licenses/LICENSE", license)
+		}
+	}
+	return nil
+}
+
+// checkLicenses checks that the image has the licenses of the test, or any
+// license if the test has none.
+func (c *ImageTest) checkLicenses(image *imageDescription) error {
+	if len(c.Licenses) == 0 {
+		if len(image.Licenses) == 0 {
+			return fmt.Errorf("image %s has no licenses attached", image.Name)
+		}
+		return nil
+	}
+	if problems := checkImage(image, c.Family, c.Licenses); len(problems) > 0 {
+		return fmt.Errorf("image %s of family %s failed license checks:\n  - %s",
+			image.Name, c.Family, strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// sshProbe returns an ssh probe of the instance running command.
+func (c *ImageTest) sshProbe(command string) *SSHProbe {
+	return &SSHProbe{
+		Instance:         deploymentName(c.InstanceName, c.Metadata.Name),
+		Zone:             c.Zone,
+		Command:          command,
+		TunnelThroughIAP: c.TunnelThroughIAP,
+	}
+}
+
+func (c *ImageTest) runProbe(executor exec.Interface, probe Probe) error {
+	fmt.Printf("Running probe %s of image test %s\n", probe.Name, c.Metadata.Name)
+	start := time.Now()
+	err := probe.run(executor, c.ProjectID, nil)
+	c.results = append(c.results, newCheckSummary(probe.Name, start, err))
+	return err
+}
+
+// checkBakedSecrets checks that no credentials or SSH keys are baked into
+// the image.
+func (c *ImageTest) checkBakedSecrets(executor exec.Interface, imageName string) error {
+	fmt.Printf("Checking image %s for credentials and SSH keys\n", imageName)
+	timeout, _, err := imageTestSSHProbe.durations()
+	if err != nil {
+		return err
+	}
+	command := fmt.Sprintf("echo %s | base64 -d | sudo sh", base64.StdEncoding.EncodeToString([]byte(bakedSecretsScript)))
+	_, stdout, status, err := c.sshProbe(command).ssh(executor, c.ProjectID, nil, timeout)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("failed to check image %s for credentials and SSH keys: command exited with status %d", imageName, status)
+	}
+	if files := strings.Fields(string(stdout)); len(files) > 0 {
+		return fmt.Errorf("image %s contains credentials or SSH keys, which are shared by every VM of the image:\n  - %s",
+			imageName, strings.Join(files, "\n  - "))
+	}
+	return nil
+}
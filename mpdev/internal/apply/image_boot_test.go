@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestImageTest(t *testing.T) {
+	defer func(p Probe) { imageTestSSHProbe = p }(imageTestSSHProbe)
+	imageTestSSHProbe.Retries = 0
+
+	licensed := `{"name": "wordpress-v20200601", "family": "wordpress", "selfLink": "https://www.googleapis.com/compute/v1/projects/image-project/global/images/wordpress-v20200601",
+		"licenses": ["https://www.googleapis.com/compute/v1/projects/image-project/global/licenses/wordpress"]}`
+	unlicensed := `{"name": "wordpress-v20200601", "family": "wordpress"}`
+	describeArgs := []string{"gcloud", "compute", "images", "describe-from-family", "wordpress", "--project", "image-project", "--format", "json"}
+	createArgs := []string{"gcloud", "compute", "instances", "create", "wordpress-image", "--project", "test-project", "--zone", "us-central1-a",
+		"--image", "wordpress-v20200601", "--image-project", "image-project", "--machine-type", "e2-medium"}
+	deleteArgs := []string{"gcloud", "compute", "instances", "delete", "wordpress-image", "--project", "test-project", "--zone", "us-central1-a", "--quiet"}
+	ok := func(stdout string) func() ([]byte, []byte, error) {
+		return func() ([]byte, []byte, error) { return []byte(stdout), nil, nil }
+	}
+	exitStatus := func(status int) func() ([]byte, []byte, error) {
+		return func() ([]byte, []byte, error) { return nil, nil, testingexec.FakeExitError{Status: status} }
+	}
+
+	testCases := []struct {
+		name             string
+		zone             string
+		runs             []func() ([]byte, []byte, error)
+		errorContains    []string
+		expectedCommands [][]string
+		expectedChecks   []string
+	}{{
+		name:             "Checks pass",
+		runs:             []func() ([]byte, []byte, error){ok(licensed), ok(""), ok(""), ok("2.4.41-4"), ok(""), ok("")},
+		expectedCommands: [][]string{describeArgs, createArgs, {"true"}, {"dpkg-query"}, {"base64 -d | sudo sh"}, deleteArgs},
+		expectedChecks:   []string{"licenses", "ssh", "packages/apache2", "credentials"},
+	}, {
+		name: "Baked keys",
+		runs: []func() ([]byte, []byte, error){ok(licensed), ok(""), ok(""), ok("2.4.41-4"),
+			ok("/root/.ssh/id_rsa\n/home/builder/.ssh/authorized_keys\n/etc/ssh/ssh_host_ed25519_key\n"), ok("")},
+		errorContains: []string{"image wordpress-v20200601 contains credentials or SSH keys",
+			"  - /root/.ssh/id_rsa\n  - /home/builder/.ssh/authorized_keys\n  - /etc/ssh/ssh_host_ed25519_key"},
+		expectedCommands: [][]string{describeArgs, createArgs, {"true"}, {"dpkg-query"}, {"base64 -d | sudo sh"}, deleteArgs},
+		expectedChecks:   []string{"licenses", "ssh", "packages/apache2", "credentials"},
+	}, {
+		name:             "Missing license and package",
+		runs:             []func() ([]byte, []byte, error){ok(unlicensed), ok(""), ok(""), exitStatus(1), ok(""), ok("")},
+		errorContains:    []string{"image wordpress-v20200601 has no licenses attached", "package apache2 is not installed on instance wordpress-image"},
+		expectedCommands: [][]string{describeArgs, createArgs, {"true"}, {"dpkg-query"}, {"base64 -d | sudo sh"}, deleteArgs},
+		expectedChecks:   []string{"licenses", "ssh", "packages/apache2", "credentials"},
+	}, {
+		name:             "SSH fails",
+		runs:             []func() ([]byte, []byte, error){ok(licensed), ok(""), exitStatus(255), ok("")},
+		errorContains:    []string{"image wordpress-v20200601 does not accept SSH connections"},
+		expectedCommands: [][]string{describeArgs, createArgs, {"true"}, deleteArgs},
+		expectedChecks:   []string{"licenses", "ssh"},
+	}, {
+		name:          "Missing zone",
+		zone:          "-",
+		errorContains: []string{"zone cannot be empty for image test"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for _, run := range tc.runs {
+				fcmd.RunScript = append(fcmd.RunScript, run)
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			zone := "us-central1-a"
+			if tc.zone == "-" {
+				zone = ""
+			}
+			test := &ImageTest{
+				BaseResource:     newTestBaseResource("ImageTest", "wordpress-image"),
+				ProjectID:        "test-project",
+				ImageProject:     "image-project",
+				Family:           "wordpress",
+				Zone:             zone,
+				RequiredPackages: []string{"apache2"},
+			}
+			r.RegisterResource(test, "dir")
+
+			err := test.Apply(r, false)
+			if len(tc.errorContains) > 0 {
+				assert.Error(t, err)
+				for _, s := range tc.errorContains {
+					assert.Contains(t, err.Error(), s)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "https://www.googleapis.com/compute/v1/projects/image-project/global/images/wordpress-v20200601",
+					r.GetOutputs(test.GetReference())["image"])
+			}
+
+			assert.Len(t, fcmd.RunLog, len(tc.expectedCommands))
+			for i, expected := range tc.expectedCommands {
+				if i >= len(fcmd.RunLog) {
+					break
+				}
+				if len(expected) > 1 {
+					assert.Equal(t, expected, fcmd.RunLog[i])
+					continue
+				}
+				// ssh probes are identified by their command
+				assert.Equal(t, []string{"gcloud", "compute", "ssh", "wordpress-image"}, fcmd.RunLog[i][:4])
+				assert.Contains(t, strings.Join(fcmd.RunLog[i], " "), expected[0])
+			}
+
+			var checks []string
+			for _, result := range test.checkResults() {
+				checks = append(checks, result.Name)
+			}
+			assert.Equal(t, tc.expectedChecks, checks)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// licenseRegex matches the resource name of a GCE license.
+var licenseRegex = regexp.MustCompile(`^projects/[a-z0-9-.:]+/global/licenses/[a-z0-9-]+$`)
+
+const computeAPIPrefix = "https://www.googleapis.com/compute/v1/"
+
+// GceImageLicenseCheck verifies that the latest image of a GCE image family
+// has the Marketplace licenses of a solution attached, and that the image
+// follows naming conventions. Licenses cannot be changed on an existing
+// image, so images without the licenses must be published again, for
+// example with the licenses field of a GceImage.
+type GceImageLicenseCheck struct {
+	BaseResource
+	// ProjectID of the project containing the image family
+	ProjectID string `json:"projectId"`
+	// Family of images that is checked
+	Family string
+	// Licenses that must be attached to the image, such as
+	// projects/PROJECT/global/licenses/LICENSE
+	Licenses []string
+}
+
+type imageDescription struct {
+	Name            string   `json:"name"`
+	Family          string   `json:"family"`
+	Licenses        []string `json:"licenses"`
+	SelfLink        string   `json:"selfLink"`
+	GuestOsFeatures []struct {
+		Type string `json:"type"`
+	} `json:"guestOsFeatures"`
+}
+
+// describeImageFamily returns the description of the latest image of a
+// family.
+func describeImageFamily(registry Registry, projectID string, family string) (*imageDescription, error) {
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gcloud", "compute", "images", "describe-from-family",
+		family, "--project", projectID, "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe image family %s in project %s", family, projectID)
+	}
+
+	var image imageDescription
+	err = json.Unmarshal(stdout, &image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse description of image family %s", family)
+	}
+	return &image, nil
+}
+
+// Apply checks the licenses and name of the latest image in the family.
+func (c *GceImageLicenseCheck) Apply(registry Registry, dryRun bool) error {
+	err := c.validate()
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	image, err := describeImageFamily(registry, c.ProjectID, c.Family)
+	if err != nil {
+		return err
+	}
+
+	problems := checkImage(image, c.Family, c.Licenses)
+	if len(problems) > 0 {
+		return fmt.Errorf("image %s of family %s failed license checks:\n  - %s",
+			image.Name, c.Family, strings.Join(problems, "\n  - "))
+	}
+
+	fmt.Printf("Image %s of family %s has the expected licenses\n", image.Name, c.Family)
+	registry.SetOutput(c, "image", image.SelfLink)
+	return nil
+}
+
+func (c *GceImageLicenseCheck) validate() error {
+	if c.ProjectID == "" {
+		return errors.New("projectId cannot be empty for image license check")
+	}
+	if !imageNameRegex.MatchString(c.Family) {
+		return fmt.Errorf("invalid image family: %s. Must match regex %s", c.Family, imageNameRegex)
+	}
+	if len(c.Licenses) == 0 {
+		return errors.New("licenses cannot be empty for image license check")
+	}
+	for _, license := range c.Licenses {
+		if !licenseRegex.MatchString(normalizeLicense(license)) {
+			return fmt.Errorf("invalid license: %s. Must be in the format projects/PROJECT/global/licenses/LICENSE", license)
+		}
+	}
+	return nil
+}
+
+// checkImage returns the problems found with the image.
+func checkImage(image *imageDescription, family string, licenses []string) []string {
+	var problems []string
+	if !strings.HasPrefix(image.Name, family+"-") {
+		problems = append(problems, fmt.Sprintf("image name %s should start with the family name followed by a dash: %s-", image.Name, family))
+	}
+
+	attached := map[string]bool{}
+	for _, license := range image.Licenses {
+		attached[normalizeLicense(license)] = true
+	}
+	for _, license := range licenses {
+		if !attached[normalizeLicense(license)] {
+			problems = append(problems, fmt.Sprintf("license %s is not attached", license))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// normalizeLicense returns the resource name of a license given either its
+// resource name or URL.
+func normalizeLicense(license string) string {
+	return strings.TrimPrefix(license, computeAPIPrefix)
+}
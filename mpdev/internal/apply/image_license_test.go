@@ -0,0 +1,104 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestGceImageLicenseCheck(t *testing.T) {
+	license := "projects/my-project/global/licenses/wordpress"
+	testCases := []struct {
+		name          string
+		family        string
+		licenses      []string
+		describeJSON  string
+		dryRun        bool
+		errorContains string
+	}{{
+		name:     "Licensed image",
+		family:   "wordpress",
+		licenses: []string{license},
+		describeJSON: `{"name": "wordpress-v20200101", "family": "wordpress", "selfLink": "link",
+			"licenses": ["https://www.googleapis.com/compute/v1/projects/my-project/global/licenses/wordpress"]}`,
+	}, {
+		name:          "Missing license",
+		family:        "wordpress",
+		licenses:      []string{license},
+		describeJSON:  `{"name": "wordpress-v20200101", "family": "wordpress", "licenses": []}`,
+		errorContains: "license projects/my-project/global/licenses/wordpress is not attached",
+	}, {
+		name:          "Image name does not match family",
+		family:        "wordpress",
+		licenses:      []string{license},
+		describeJSON:  `{"name": "wp-v20200101", "family": "wordpress", "licenses": ["` + license + `"]}`,
+		errorContains: "should start with the family name",
+	}, {
+		name:          "Invalid license",
+		family:        "wordpress",
+		licenses:      []string{"wordpress"},
+		errorContains: "invalid license",
+	}, {
+		name:          "Invalid family",
+		family:        "WordPress",
+		licenses:      []string{license},
+		errorContains: "invalid image family",
+	}, {
+		name:     "Dry run",
+		family:   "wordpress",
+		licenses: []string{license},
+		dryRun:   true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) { return []byte(tc.describeJSON), nil, nil },
+				},
+			}
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+				},
+			}
+			r := NewRegistry(executor)
+
+			c := &GceImageLicenseCheck{
+				BaseResource: newTestBaseResource("GceImageLicenseCheck", "license"),
+				ProjectID:    "my-project",
+				Family:       tc.family,
+				Licenses:     tc.licenses,
+			}
+			r.RegisterResource(c, "dir")
+
+			err := c.Apply(r, tc.dryRun)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.describeJSON != "" {
+				assert.Equal(t, [][]string{{"gcloud", "compute", "images", "describe-from-family", "wordpress",
+					"--project", "my-project", "--format", "json"}}, fcmd.RunLog)
+			}
+		})
+	}
+}
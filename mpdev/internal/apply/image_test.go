@@ -0,0 +1,330 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestGceImage(t *testing.T) {
+	testCases := []struct {
+		name            string
+		builder         string
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:    "Packer build",
+		builder: "PackerGceImageBuilder",
+		expectedRunArgs: [][]string{
+			{"packer", "build", "-var", "image_name=wordpress-build", "-var", "project_id=build-project",
+				"-var", "zone=us-central1-a", "/resourcedir/packer.json"},
+			{"gcloud", "compute", "images", "create", "wordpress-v1-2",
+				"--project", "publish-project",
+				"--source-image", "wordpress-build",
+				"--source-image-project", "build-project",
+				"--licenses", "projects/publish-project/global/licenses/wordpress",
+				"--family", "wordpress",
+				"--labels", "app=wordpress"},
+		},
+	}, {
+		name:    "Daisy build",
+		builder: "DaisyGceImageBuilder",
+		expectedRunArgs: [][]string{
+			{"daisy", "-project", "build-project", "-zone", "us-central1-a",
+				"-var:image_name=wordpress-build", "-var:zone=us-central1-a", "/resourcedir/workflow.json"},
+			{"gcloud", "compute", "images", "create", "wordpress-v1-2",
+				"--project", "publish-project",
+				"--source-image", "wordpress-build",
+				"--source-image-project", "build-project",
+				"--licenses", "projects/publish-project/global/licenses/wordpress",
+				"--family", "wordpress",
+				"--labels", "app=wordpress"},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{noOutput, noOutput}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{gcloudVersionAction, cmdAction, cmdAction},
+				LookPathFunc:  func(file string) (string, error) { return "/usr/bin/" + file, nil },
+			}
+			r := NewRegistry(executor)
+
+			build := imageBuild{
+				ProjectID: "build-project",
+				ImageName: "wordpress-build",
+				Vars:      map[string]string{"zone": "us-central1-a"},
+			}
+			var builder Resource
+			if tc.builder == "PackerGceImageBuilder" {
+				p := &PackerGceImageBuilder{BaseResource: newTestBaseResource(tc.builder, "builder"), imageBuild: build}
+				p.Builder.Script.File = "packer.json"
+				builder = p
+			} else {
+				builder = &DaisyGceImageBuilder{
+					BaseResource: newTestBaseResource(tc.builder, "builder"),
+					imageBuild:   build,
+					Workflow:     "workflow.json",
+					Zone:         "us-central1-a",
+				}
+			}
+			image := &GceImage{
+				BaseResource: newTestBaseResource("GceImage", "image"),
+				BuilderRef:   builder.GetReference(),
+				Image: Image{
+					ProjectID: "publish-project",
+					NameParts: []string{"wordpress", "v1", "2"},
+					Family:    "wordpress",
+					Licenses:  []string{"projects/publish-project/global/licenses/wordpress"},
+					Labels:    map[string]string{"app": "wordpress"},
+				},
+			}
+			r.RegisterResource(builder, "/resourcedir")
+			r.RegisterResource(image, "/resourcedir")
+
+			err := r.Apply(false)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+			assert.Equal(t, "https://www.googleapis.com/compute/v1/projects/build-project/global/images/wordpress-build",
+				r.GetOutputs(builder.GetReference())["image"])
+			assert.Equal(t, "https://www.googleapis.com/compute/v1/projects/publish-project/global/images/wordpress-v1-2",
+				r.GetOutputs(image.GetReference())["selfLink"])
+		})
+	}
+}
+
+func TestPackerHCL2Template(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	variables := `
+variable "project_id" {
+  type = string
+}
+variable "image_name" {
+  type = string
+}
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "variables.pkr.hcl"), []byte(variables), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "build.pkr.hcl"),
+		[]byte("variable \"licenses\" {\n  type = list(string)\n}\n"), 0644))
+
+	testCases := []struct {
+		name            string
+		file            string
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name: "Template directory",
+		file: dir,
+		expectedRunArgs: [][]string{
+			{"packer", "init", dir},
+			{"packer", "build", "-var", "image_name=wordpress-build",
+				"-var", `licenses=["projects/p/global/licenses/wordpress"]`,
+				"-var", "project_id=build-project", dir},
+		},
+	}, {
+		name:      "Template file without required variable",
+		file:      filepath.Join(dir, "build.pkr.hcl"),
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{noOutput, noOutput}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			p := &PackerGceImageBuilder{
+				BaseResource: newTestBaseResource("PackerGceImageBuilder", "builder"),
+				imageBuild:   imageBuild{ProjectID: "build-project", ImageName: "wordpress-build"},
+				Zone:         "us-central1-a",
+				Licenses:     []string{"projects/p/global/licenses/wordpress"},
+			}
+			p.Builder.Script.File = tc.file
+			r.RegisterResource(p, dir)
+
+			err := p.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "wordpress-build", r.GetOutputs(p.GetReference())["imageName"])
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestPackerJSONTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packer")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "zone.json"),
+		[]byte(`{"variables": {"project_id": "", "image_name": "", "zone": "us-east1-b"}, "builders": []}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "plain.json"),
+		[]byte(`{"variables": {"project_id": "", "image_name": ""}, "builders": []}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte(`{"variables": [`), 0644))
+
+	testCases := []struct {
+		name            string
+		file            string
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name: "Template declaring zone",
+		file: "zone.json",
+		expectedRunArgs: [][]string{
+			{"packer", "build", "-var", "image_name=wordpress-build", "-var", "project_id=build-project",
+				"-var", "zone=us-central1-a", filepath.Join(dir, "zone.json")},
+		},
+	}, {
+		name: "Template without optional variables",
+		file: "plain.json",
+		expectedRunArgs: [][]string{
+			{"packer", "build", "-var", "image_name=wordpress-build", "-var", "project_id=build-project",
+				filepath.Join(dir, "plain.json")},
+		},
+	}, {
+		name:      "Invalid template",
+		file:      "invalid.json",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{noOutput}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			p := &PackerGceImageBuilder{
+				BaseResource: newTestBaseResource("PackerGceImageBuilder", "builder"),
+				imageBuild:   imageBuild{ProjectID: "build-project", ImageName: "wordpress-build"},
+				Zone:         "us-central1-a",
+				Licenses:     []string{"projects/p/global/licenses/wordpress"},
+			}
+			p.Builder.Script.File = tc.file
+			r.RegisterResource(p, dir)
+
+			err := p.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestGceImageValidation(t *testing.T) {
+	builder := &PackerGceImageBuilder{BaseResource: newTestBaseResource("PackerGceImageBuilder", "builder")}
+	other := &GceImage{
+		BaseResource: newTestBaseResource("GceImage", "other"),
+		Image:        Image{ProjectID: "p", NameParts: []string{"other"}},
+	}
+
+	testCases := []struct {
+		name  string
+		image GceImage
+	}{{
+		name:  "No reference",
+		image: GceImage{Image: Image{ProjectID: "p", NameParts: []string{"image"}}},
+	}, {
+		name: "Both references",
+		image: GceImage{
+			BuilderRef: builder.GetReference(),
+			ImageRef:   other.GetReference(),
+			Image:      Image{ProjectID: "p", NameParts: []string{"image"}},
+		},
+	}, {
+		name: "Builder reference of wrong type",
+		image: GceImage{
+			BuilderRef: other.GetReference(),
+			Image:      Image{ProjectID: "p", NameParts: []string{"image"}},
+		},
+	}, {
+		name: "Missing project",
+		image: GceImage{
+			ImageRef: other.GetReference(),
+			Image:    Image{NameParts: []string{"image"}},
+		},
+	}, {
+		name: "Invalid name",
+		image: GceImage{
+			ImageRef: other.GetReference(),
+			Image:    Image{ProjectID: "p", NameParts: []string{"Image", "V1"}, NamePartsSeparator: "_"},
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry(&testingexec.FakeExec{})
+			r.RegisterResource(builder, "dir")
+			r.RegisterResource(other, "dir")
+			image := tc.image
+			image.BaseResource = newTestBaseResource("GceImage", "image")
+			assert.Error(t, image.Apply(r, true))
+		})
+	}
+}
+
+func TestPackerGceImageBuilderDecode(t *testing.T) {
+	rs, err := UnstructuredToResource(Unstructured{
+		"apiVersion": apiVersion,
+		"kind":       "PackerGceImageBuilder",
+		"metadata":   map[string]interface{}{"name": "builder"},
+		"projectId":  "build-project",
+		"vars":       map[string]interface{}{"zone": "us-central1-a"},
+		"builder":    map[string]interface{}{"script": map[string]interface{}{"file": "packer.json"}},
+	})
+	assert.NoError(t, err)
+
+	builder := rs.(*PackerGceImageBuilder)
+	assert.Equal(t, "build-project", builder.ProjectID)
+	assert.Equal(t, map[string]string{"zone": "us-central1-a"}, builder.Vars)
+	assert.Equal(t, "packer.json", builder.Builder.Script.File)
+}
+
+func newTestBaseResource(kind string, name string) BaseResource {
+	return BaseResource{
+		TypeMeta{
+			APIVersion: apiVersion,
+			Kind:       kind,
+		},
+		Metadata{Name: name},
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"path/filepath"
+
+	"k8s.io/utils/exec"
+)
+
+// NewImpersonatingExecutor returns an executor that runs the gcloud and
+// gsutil commands executed by resources as the given service account.
+// Other commands are executed unchanged.
+func NewImpersonatingExecutor(executor exec.Interface, serviceAccount string) exec.Interface {
+	return &impersonatingExecutor{Interface: executor, serviceAccount: serviceAccount}
+}
+
+type impersonatingExecutor struct {
+	exec.Interface
+	serviceAccount string
+}
+
+func (e *impersonatingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return e.Interface.Command(cmd, e.impersonate(cmd, args)...)
+}
+
+func (e *impersonatingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return e.Interface.CommandContext(ctx, cmd, e.impersonate(cmd, args)...)
+}
+
+// impersonate prepends the option used by cmd to impersonate the service
+// account to args.
+func (e *impersonatingExecutor) impersonate(cmd string, args []string) []string {
+	switch filepath.Base(cmd) {
+	case "gcloud":
+		return append([]string{"--impersonate-service-account=" + e.serviceAccount}, args...)
+	case "gsutil":
+		return append([]string{"-i", e.serviceAccount}, args...)
+	default:
+		return args
+	}
+}
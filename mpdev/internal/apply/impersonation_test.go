@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestImpersonatingExecutor(t *testing.T) {
+	sa := "publisher@project.iam.gserviceaccount.com"
+	testCases := []struct {
+		name         string
+		cmd          []string
+		expectedArgv []string
+	}{{
+		name:         "gsutil",
+		cmd:          []string{"gsutil", "cp", "a.zip", "gs://bucket/a.zip"},
+		expectedArgv: []string{"gsutil", "-i", sa, "cp", "a.zip", "gs://bucket/a.zip"},
+	}, {
+		name:         "gcloud",
+		cmd:          []string{"/usr/bin/gcloud", "deployment-manager", "deployments", "list"},
+		expectedArgv: []string{"/usr/bin/gcloud", "--impersonate-service-account=" + sa, "deployment-manager", "deployments", "list"},
+	}, {
+		name:         "Other command",
+		cmd:          []string{"zip", "-r", "a.zip", "."},
+		expectedArgv: []string{"zip", "-r", "a.zip", "."},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) { return nil, nil, nil },
+				},
+			}
+			fexec := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+				},
+			}
+
+			executor := NewImpersonatingExecutor(fexec, sa)
+			err := executor.Command(tc.cmd[0], tc.cmd[1:]...).Run()
+			assert.NoError(t, err)
+			assert.Equal(t, [][]string{tc.expectedArgv}, fcmd.RunLog)
+		})
+	}
+}
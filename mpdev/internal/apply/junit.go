@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// junitTestSuites is the root element of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes summary to w as a JUnit XML report, such that CI
+// systems show the result of each resource, and of each check and probe
+// that the resources ran, as a test case. Resources are grouped in a test
+// suite per stage for publish runs, and in a single test suite otherwise.
+func WriteJUnitReport(w io.Writer, summary *RunSummary) error {
+	report := junitTestSuites{Name: "mpdev", Time: junitTime(summary.Duration)}
+	suites := map[string]int{}
+	// durations are the time spent applying the resources of each suite
+	var durations []time.Duration
+	for _, rs := range summary.Resources {
+		name := "mpdev"
+		if rs.Stage != "" {
+			name = rs.Stage
+		}
+		i, ok := suites[name]
+		if !ok {
+			i = len(report.Suites)
+			suites[name] = i
+			report.Suites = append(report.Suites, junitTestSuite{
+				Name:      name,
+				Timestamp: summary.StartTime.UTC().Format(time.RFC3339),
+			})
+			durations = append(durations, 0)
+		}
+		suite := &report.Suites[i]
+		d, _ := time.ParseDuration(rs.Duration)
+		durations[i] += d
+
+		ref := rs.Reference
+		suite.addCase(junitTestCase{
+			ClassName: ref.Kind,
+			Name:      ref.Name,
+			Time:      junitTime(rs.Duration),
+		}, rs.Status, rs.Error)
+		for _, check := range rs.Checks {
+			suite.addCase(junitTestCase{
+				ClassName: fmt.Sprintf("%s.%s", ref.Kind, ref.Name),
+				Name:      check.Name,
+				Time:      junitTime(check.Duration),
+			}, check.Status, check.Error)
+		}
+	}
+
+	for i := range report.Suites {
+		suite := &report.Suites[i]
+		suite.Time = junitTime(durations[i].String())
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// addCase adds a test case with the status of a resource or check.
+func (s *junitTestSuite) addCase(c junitTestCase, status string, message string) {
+	s.Tests++
+	switch status {
+	case "failed":
+		s.Failures++
+		c.Failure = &junitFailure{Message: message, Text: message}
+	case "skipped":
+		s.Skipped++
+		c.Skipped = &struct{}{}
+	}
+	s.Cases = append(s.Cases, c)
+}
+
+// junitTime converts a duration of a summary to seconds.
+func junitTime(duration string) string {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		d = 0
+	}
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
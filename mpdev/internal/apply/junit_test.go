@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	summary := &RunSummary{
+		StartTime: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC),
+		Duration:  "3.5s",
+		Resources: []ResourceSummary{
+			{
+				Reference: Reference{Kind: "DeploymentManagerAutogenTemplate", Name: "autogen"},
+				Status:    "succeeded",
+				Duration:  "1.5s",
+				Stage:     StageBuild,
+			},
+			{
+				Reference: Reference{Kind: "DeploymentManagerDeployment", Name: "deployment"},
+				Status:    "failed",
+				Error:     "deployment test smoke failed",
+				Duration:  "2s",
+				Stage:     StageVerify,
+				Checks: []CheckSummary{
+					{Name: "vm-running", Status: "succeeded", Duration: "500ms"},
+					{Name: "smoke/admin", Status: "failed", Error: "GET https://example.com returned status 500, expected 200", Duration: "1s"},
+				},
+			},
+			{
+				Reference: Reference{Kind: "QuotaCheck", Name: "quota"},
+				Status:    "skipped",
+				Stage:     StageVerify,
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	err := WriteJUnitReport(&b, summary)
+	assert.NoError(t, err)
+
+	var report junitTestSuites
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &report))
+	assert.Equal(t, 5, report.Tests)
+	assert.Equal(t, 2, report.Failures)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, "3.500", report.Time)
+
+	assert.Len(t, report.Suites, 2)
+	build, verify := report.Suites[0], report.Suites[1]
+	assert.Equal(t, StageBuild, build.Name)
+	assert.Equal(t, "1.500", build.Time)
+	assert.Equal(t, "2020-06-01T12:00:00Z", build.Timestamp)
+	assert.Equal(t, StageVerify, verify.Name)
+	assert.Equal(t, 4, verify.Tests)
+
+	probe := verify.Cases[2]
+	assert.Equal(t, "DeploymentManagerDeployment.deployment", probe.ClassName)
+	assert.Equal(t, "smoke/admin", probe.Name)
+	assert.Equal(t, "1.000", probe.Time)
+	assert.NotNil(t, probe.Failure)
+	assert.Contains(t, probe.Failure.Message, "status 500")
+	assert.Nil(t, verify.Cases[1].Failure)
+	assert.NotNil(t, verify.Cases[3].Skipped)
+}
+
+func TestWriteJUnitReportSingleSuite(t *testing.T) {
+	summary := &RunSummary{
+		Duration:  "1s",
+		Resources: []ResourceSummary{{Reference: Reference{Kind: "QuotaCheck", Name: "quota"}, Status: "succeeded", Duration: "1s"}},
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, WriteJUnitReport(&b, summary))
+	assert.Contains(t, b.String(), `<testcase classname="QuotaCheck" name="quota" time="1.000"></testcase>`)
+
+	var report junitTestSuites
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &report))
+	assert.Len(t, report.Suites, 1)
+	assert.Equal(t, "mpdev", report.Suites[0].Name)
+}
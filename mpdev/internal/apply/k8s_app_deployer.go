@@ -0,0 +1,241 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+)
+
+const (
+	helmDeployerFlavor     = "helm"
+	envsubstDeployerFlavor = "envsubst"
+)
+
+// trackRegex matches a Marketplace release track, such as 1.2
+var trackRegex = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// K8sAppDeployer builds and pushes the deployer image of a Kubernetes app
+// sold on GCP Marketplace. See
+// https://github.com/GoogleCloudPlatform/marketplace-k8s-app-tools/blob/master/docs/building-deployer.md
+type K8sAppDeployer struct {
+	BaseResource
+	// Flavor of the deployer. One of "helm" or "envsubst"
+	Flavor string
+	// HelmChartRef references the HelmChart packaged in the deployer of
+	// the helm flavor.
+	HelmChartRef Reference
+	// ManifestsDir is the directory of manifests packaged in the deployer
+	// of the envsubst flavor.
+	ManifestsDir string
+	// SchemaFile is the path to the schema.yaml of the app
+	SchemaFile string
+	// Image is the repository of the app, such as gcr.io/project/app. The
+	// deployer is pushed to Image/deployer
+	Image string
+	// Track is the release track of the deployer, such as 1.2, used as the
+	// tag of the deployer image
+	Track string
+	// Version is the full version of the app, such as 1.2.3. If set, the
+	// deployer image is additionally tagged with Version.
+	Version string
+	// BaseImage overrides the onbuild image the deployer is built from.
+	// Defaults to gcr.io/cloud-marketplace-tools/k8s/deployer_FLAVOR/onbuild
+	BaseImage string
+	// VulnerabilityScan, if set, fails the deployer before it is built if
+	// the images of the app have vulnerabilities
+	VulnerabilityScan *VulnerabilityScan
+}
+
+// GetDependencies returns dependencies for K8sAppDeployer
+func (d *K8sAppDeployer) GetDependencies() (r []Reference) {
+	if d.Flavor == helmDeployerFlavor {
+		r = append(r, d.HelmChartRef)
+	}
+	return r
+}
+
+// Apply builds and pushes the deployer image.
+func (d *K8sAppDeployer) Apply(registry Registry, dryRun bool) error {
+	err := d.validate(registry)
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	contextDir, err := util.CreateTmpDir("deployer")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(contextDir)
+
+	err = d.writeBuildContext(registry, contextDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to create build context of deployer image")
+	}
+
+	executor := registry.GetExecutor()
+	if d.VulnerabilityScan != nil {
+		images, err := deployerImages(contextDir, d.Image, d.Track)
+		if err != nil {
+			return errors.Wrap(err, "failed to find images of deployer")
+		}
+		err = d.VulnerabilityScan.scan(executor, images)
+		if err != nil {
+			return VerificationError(err)
+		}
+	}
+
+	repo := d.Image + "/deployer"
+	tags := []string{repo + ":" + d.Track}
+	if d.Version != "" {
+		tags = append(tags, repo+":"+d.Version)
+	}
+
+	runner, err := newContainerRunner(executor)
+	if err != nil {
+		return err
+	}
+	ctx := executorContext(executor)
+	err = runWithProgress("Building deployer image "+tags[0], func(stdout io.Writer, stderr io.Writer) error {
+		return runner.Build(ctx, BuildSpec{Context: contextDir, Tags: tags}, stdout, stderr)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to build deployer image %s", tags[0])
+	}
+
+	for _, tag := range tags {
+		err = runWithProgress("Pushing deployer image "+tag, func(stdout io.Writer, stderr io.Writer) error {
+			return runner.Push(ctx, tag, stdout, stderr)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to push deployer image %s", tag)
+		}
+	}
+
+	registry.SetOutput(d, "image", tags[0])
+	return nil
+}
+
+func (d *K8sAppDeployer) validate(registry Registry) error {
+	switch d.Flavor {
+	case helmDeployerFlavor:
+		_, err := getHelmChart(registry, d.HelmChartRef)
+		if err != nil {
+			return err
+		}
+	case envsubstDeployerFlavor:
+		if d.ManifestsDir == "" {
+			return errors.New("manifestsDir cannot be empty for deployer of envsubst flavor")
+		}
+	default:
+		return fmt.Errorf("unsupported deployer flavor: %s. Must be one of %s or %s", d.Flavor, helmDeployerFlavor, envsubstDeployerFlavor)
+	}
+
+	if d.SchemaFile == "" {
+		return errors.New("schemaFile cannot be empty for deployer")
+	}
+	if d.Image == "" {
+		return errors.New("image cannot be empty for deployer")
+	}
+	if !trackRegex.MatchString(d.Track) {
+		return fmt.Errorf("invalid track: %s. Must be of the form MAJOR.MINOR, such as 1.2", d.Track)
+	}
+	if d.VulnerabilityScan != nil {
+		return d.VulnerabilityScan.validate()
+	}
+	return nil
+}
+
+// writeBuildContext lays out the files expected by the onbuild deployer
+// image in dir.
+func (d *K8sAppDeployer) writeBuildContext(registry Registry, dir string) error {
+	schemaFile, err := registry.ResolveFilePath(d, d.SchemaFile)
+	if err != nil {
+		return err
+	}
+	err = util.CopyFile(schemaFile, filepath.Join(dir, "schema.yaml"))
+	if err != nil {
+		return err
+	}
+
+	if d.Flavor == helmDeployerFlavor {
+		chart, err := getHelmChart(registry, d.HelmChartRef)
+		if err != nil {
+			return err
+		}
+		if chart.packaged == nil {
+			return fmt.Errorf("Helm chart %+v has not been packaged", d.HelmChartRef)
+		}
+		chartDir := filepath.Join(dir, "chart")
+		err = os.MkdirAll(chartDir, 0755)
+		if err != nil {
+			return err
+		}
+		packagePath := filepath.Join(dir, chart.packageName)
+		err = ioutil.WriteFile(packagePath, chart.packaged, 0644)
+		if err != nil {
+			return err
+		}
+		err = runCommand(registry.GetExecutor(), "tar", "-xzf", packagePath, "-C", chartDir)
+		if err != nil {
+			return errors.Wrapf(err, "failed to extract Helm chart %s", chart.packageName)
+		}
+		err = os.Remove(packagePath)
+		if err != nil {
+			return err
+		}
+	} else {
+		manifestsDir, err := registry.ResolveFilePath(d, d.ManifestsDir)
+		if err != nil {
+			return err
+		}
+		err = util.CopyDirectory(manifestsDir, filepath.Join(dir, "manifest"))
+		if err != nil {
+			return err
+		}
+	}
+
+	baseImage := d.BaseImage
+	if baseImage == "" {
+		baseImage = fmt.Sprintf("gcr.io/cloud-marketplace-tools/k8s/deployer_%s/onbuild", d.Flavor)
+	}
+	dockerfile := fmt.Sprintf("FROM %s\n", baseImage)
+	return ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte(dockerfile), 0644)
+}
+
+// getHelmChart returns the HelmChart with the given reference.
+func getHelmChart(registry Registry, ref Reference) (*HelmChart, error) {
+	rs := registry.GetResource(ref)
+	if rs == nil {
+		return nil, fmt.Errorf("Helm chart not found %+v", ref)
+	}
+
+	chart, ok := rs.(*HelmChart)
+	if !ok {
+		return nil, fmt.Errorf("referenced Helm chart is not correct type %+v", ref)
+	}
+	return chart, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestK8sAppDeployer(t *testing.T) {
+	appDir, err := ioutil.TempDir("", "k8sapp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(appDir)
+	for _, name := range []string{"schema.yaml", "manifest/app.yaml"} {
+		path := filepath.Join(appDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(name), 0644))
+	}
+
+	testCases := []struct {
+		name               string
+		flavor             string
+		track              string
+		version            string
+		chartRef           bool
+		expectErr          bool
+		expectedDockerfile string
+		expectedFiles      []string
+		expectedCommands   [][]string
+	}{{
+		name:               "envsubst",
+		flavor:             "envsubst",
+		track:              "1.2",
+		version:            "1.2.3",
+		expectedDockerfile: "FROM gcr.io/cloud-marketplace-tools/k8s/deployer_envsubst/onbuild\n",
+		expectedFiles:      []string{"Dockerfile", "manifest/app.yaml", "schema.yaml"},
+		expectedCommands: [][]string{
+			{"docker", "build", "-t", "gcr.io/project/app/deployer:1.2", "-t", "gcr.io/project/app/deployer:1.2.3"},
+			{"docker", "push", "gcr.io/project/app/deployer:1.2"},
+			{"docker", "push", "gcr.io/project/app/deployer:1.2.3"},
+		},
+	}, {
+		name:               "helm",
+		flavor:             "helm",
+		track:              "1.2",
+		chartRef:           true,
+		expectedDockerfile: "FROM gcr.io/cloud-marketplace-tools/k8s/deployer_helm/onbuild\n",
+		expectedFiles:      []string{"Dockerfile", "schema.yaml"},
+		expectedCommands: [][]string{
+			{"tar", "-xzf"},
+			{"docker", "build", "-t", "gcr.io/project/app/deployer:1.2"},
+			{"docker", "push", "gcr.io/project/app/deployer:1.2"},
+		},
+	}, {
+		name:      "helm without chart",
+		flavor:    "helm",
+		track:     "1.2",
+		expectErr: true,
+	}, {
+		name:      "Invalid track",
+		flavor:    "envsubst",
+		track:     "1.2.3",
+		expectErr: true,
+	}, {
+		name:      "Unsupported flavor",
+		flavor:    "kustomize",
+		track:     "1.2",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var dockerfile string
+			var files []string
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			inspectContext := func() ([]byte, []byte, error) {
+				contextDir := fcmd.Argv[len(fcmd.Argv)-1]
+				b, err := ioutil.ReadFile(filepath.Join(contextDir, "Dockerfile"))
+				dockerfile = string(b)
+				_ = filepath.Walk(contextDir, func(path string, info os.FileInfo, err error) error {
+					if err == nil && !info.IsDir() {
+						rel, _ := filepath.Rel(contextDir, path)
+						files = append(files, filepath.ToSlash(rel))
+					}
+					return err
+				})
+				return nil, nil, err
+			}
+			if tc.chartRef {
+				fcmd.RunScript = []testingexec.FakeRunAction{noOutput, inspectContext, noOutput}
+			} else {
+				fcmd.RunScript = []testingexec.FakeRunAction{inspectContext, noOutput, noOutput}
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			d := &K8sAppDeployer{
+				BaseResource: BaseResource{
+					TypeMeta{
+						APIVersion: apiVersion,
+						Kind:       "K8sAppDeployer",
+					},
+					Metadata{Name: "deployer"},
+				},
+				Flavor:       tc.flavor,
+				ManifestsDir: "manifest",
+				SchemaFile:   "schema.yaml",
+				Image:        "gcr.io/project/app",
+				Track:        tc.track,
+				Version:      tc.version,
+			}
+			if tc.chartRef {
+				chart := newTestHelmChart("chart", "oci://registry/charts")
+				chart.packaged = []byte("chart")
+				chart.packageName = "wordpress-1.2.0.tgz"
+				r.RegisterResource(chart, appDir)
+				d.HelmChartRef = chart.GetReference()
+			}
+			r.RegisterResource(d, appDir)
+
+			err := d.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+				assert.Equal(t, 0, fcmd.RunCalls)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, tc.expectedDockerfile, dockerfile)
+			assert.Equal(t, tc.expectedFiles, files)
+			assert.Equal(t, len(tc.expectedCommands), fcmd.RunCalls)
+			for i, expected := range tc.expectedCommands {
+				assert.Equal(t, expected, fcmd.RunLog[i][:len(expected)])
+			}
+			assert.Equal(t, "gcr.io/project/app/deployer:1.2", r.GetOutputs(d.GetReference())["image"])
+		})
+	}
+}
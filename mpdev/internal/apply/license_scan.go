@@ -0,0 +1,327 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// unknownLicense is the license of bundled content whose license could not
+// be recognized.
+const unknownLicense = "unknown"
+
+// permissiveLicenses can be bundled in packages of any license.
+var permissiveLicenses = []string{"Apache-2.0", "BSD-2-Clause", "BSD-3-Clause", "ISC", "MIT"}
+
+var (
+	// licenseFileRegex matches the names of license files, such as
+	// LICENSE.txt or COPYING.LESSER.
+	licenseFileRegex = regexp.MustCompile(`(?i)^(licen[cs]e|copying)([.-].*)?$`)
+	// spdxRegex matches SPDX license identifiers of source files.
+	spdxRegex = regexp.MustCompile(`SPDX-License-Identifier:\s*([^*#\n]+?)\s*(\*/|-->|#}|\n|$)`)
+	// gnuLicenseRegex matches the title and version of the GNU licenses.
+	gnuLicenseRegex = regexp.MustCompile(`(?i)GNU (Affero |Lesser |Library )?General Public License(,?\s+Version (\d(\.\d)?))?`)
+	// Operators of SPDX license expressions.
+	spdxOrRegex  = regexp.MustCompile(`\s+OR\s+`)
+	spdxAndRegex = regexp.MustCompile(`\s+AND\s+`)
+)
+
+// licenseTexts recognize the texts of permissive licenses, in the
+// whitespace-normalized contents of license files.
+var licenseTexts = []struct {
+	license string
+	regex   *regexp.Regexp
+}{
+	{"Apache-2.0", regexp.MustCompile(`(?i)Apache License,? Version 2\.0`)},
+	{"MPL-2.0", regexp.MustCompile(`(?i)Mozilla Public License,? (v\. |version )?2\.0`)},
+	{"MIT", regexp.MustCompile(`(?i)Permission is hereby granted, free of charge`)},
+	{"BSD-3-Clause", regexp.MustCompile(`(?i)Redistribution and use in source and binary forms.*Neither the name`)},
+	{"BSD-2-Clause", regexp.MustCompile(`(?i)Redistribution and use in source and binary forms`)},
+	{"ISC", regexp.MustCompile(`(?i)Permission to use, copy, modify, and(/or)? distribute this software for any purpose`)},
+}
+
+// executableMagics are the leading bytes of executables and libraries, in
+// ELF, Mach-O and PE formats.
+var executableMagics = [][]byte{
+	[]byte("\x7fELF"),
+	{0xfe, 0xed, 0xfa, 0xce}, {0xfe, 0xed, 0xfa, 0xcf}, {0xce, 0xfa, 0xed, 0xfe}, {0xcf, 0xfa, 0xed, 0xfe},
+	[]byte("MZ"),
+}
+
+// LicenseCheckOptions configures the check of the licenses of the content
+// bundled in a package, such as scripts and binaries of third parties.
+type LicenseCheckOptions struct {
+	// License is the license of the solution, as an SPDX identifier such
+	// as Apache-2.0, or Proprietary.
+	License string
+	// AllowedLicenses are SPDX identifiers of licenses of bundled content
+	// that are compatible with License, in addition to License itself and
+	// the permissive Apache-2.0, BSD-2-Clause, BSD-3-Clause, ISC and MIT
+	// licenses.
+	AllowedLicenses []string
+	// IgnorePaths are glob patterns of files that are not checked, relative
+	// to the root of the package, such as vendor/*.
+	IgnorePaths []string
+}
+
+// licenseFinding is the license of a file of a package.
+type licenseFinding struct {
+	file    string
+	license string
+	reason  string
+}
+
+func (f licenseFinding) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.file, f.license, f.reason)
+}
+
+func (o *LicenseCheckOptions) validate() error {
+	if o.License == "" {
+		return fmt.Errorf("licenseCheck requires the license of the solution")
+	}
+	for _, pattern := range o.IgnorePaths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern in ignorePaths: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// check fails if dir, which is about to be published as description,
+// bundles content whose license is not allowed.
+func (o *LicenseCheckOptions) check(dir string, description string) error {
+	findings, err := scanLicenses(dir)
+	if err != nil {
+		return err
+	}
+	var conflicts []string
+	for _, finding := range findings {
+		if !o.ignored(finding.file) && !o.allows(finding.license) {
+			conflicts = append(conflicts, finding.String())
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return VerificationError(fmt.Errorf("%s bundles content whose license conflicts with the license %s of the solution. Remove it, or add licenses that it may bundle to allowedLicenses:\n  - %s",
+		description, o.License, strings.Join(conflicts, "\n  - ")))
+}
+
+func (o *LicenseCheckOptions) ignored(file string) bool {
+	for _, pattern := range o.IgnorePaths {
+		if matched, _ := filepath.Match(pattern, file); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// allows returns whether content of a license, which may be an SPDX license
+// expression such as MIT OR GPL-2.0, can be bundled. Licenses must match an
+// allowed license exactly, except that content under a -or-later version of
+// a GNU license is allowed by the same or a later version of that license.
+func (o *LicenseCheckOptions) allows(expression string) bool {
+	allowed := append(append([]string{o.License}, o.AllowedLicenses...), permissiveLicenses...)
+	expression = strings.NewReplacer("(", " ", ")", " ").Replace(expression)
+	for _, alternative := range spdxOrRegex.Split(expression, -1) {
+		all := true
+		for _, license := range spdxAndRegex.Split(alternative, -1) {
+			license = strings.TrimSpace(strings.SplitN(license, " WITH ", 2)[0])
+			if license == unknownLicense || !compatibleWithAny(license, allowed) {
+				all = false
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// compatibleWithAny returns whether content of an SPDX license can be
+// bundled in a package that allows the allowed licenses.
+func compatibleWithAny(license string, allowed []string) bool {
+	family, version, orLater := parseLicense(license)
+	for _, a := range allowed {
+		allowedFamily, allowedVersion, allowedOrLater := parseLicense(a)
+		if family != allowedFamily {
+			continue
+		}
+		if version == allowedVersion && orLater == allowedOrLater {
+			return true
+		}
+		if orLater && version != "" && allowedVersion != "" && compareVersions(allowedVersion, version) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLicense splits the SPDX identifier of a GNU license, such as
+// GPL-2.0-or-later, into its lower-case family, version, and whether later
+// versions may be used. The deprecated identifiers without a suffix, such as
+// GPL-2.0, are only that version, and GPL-2.0+ is GPL-2.0-or-later. Other
+// licenses are returned lower-cased, without a version.
+func parseLicense(license string) (string, string, bool) {
+	license = strings.ToLower(license)
+	parts := strings.SplitN(license, "-", 2)
+	switch parts[0] {
+	case "gpl", "lgpl", "agpl":
+	default:
+		return license, "", false
+	}
+	if len(parts) == 1 {
+		return parts[0], "", false
+	}
+	version, orLater := parts[1], false
+	switch {
+	case strings.HasSuffix(version, "+"):
+		version, orLater = strings.TrimSuffix(version, "+"), true
+	case strings.HasSuffix(version, "-or-later"):
+		version, orLater = strings.TrimSuffix(version, "-or-later"), true
+	default:
+		version = strings.TrimSuffix(version, "-only")
+	}
+	return parts[0], version, orLater
+}
+
+// scanLicenses returns the licenses of the license files, of the files with
+// SPDX identifiers or GNU license notices, and of the executables in dir,
+// with paths relative to dir. Executables without a license file in their
+// directory or its parents have an unknown license.
+func scanLicenses(dir string) ([]licenseFinding, error) {
+	var findings []licenseFinding
+	var executables []string
+	licensedDirs := map[string]bool{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case licenseFileRegex.MatchString(info.Name()):
+			licensedDirs[filepath.Dir(rel)] = true
+			findings = append(findings, licenseFinding{file: rel, license: licenseOfText(contents), reason: "license file"})
+		case isBinary(contents):
+			for _, magic := range executableMagics {
+				if bytes.HasPrefix(contents, magic) {
+					executables = append(executables, rel)
+					break
+				}
+			}
+		default:
+			if match := spdxRegex.FindSubmatch(contents); match != nil {
+				findings = append(findings, licenseFinding{file: rel, license: string(match[1]), reason: "SPDX identifier"})
+			} else if license := gnuLicenseOf(licenseHeader(contents)); license != "" {
+				findings = append(findings, licenseFinding{file: rel, license: license, reason: "license notice"})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, executable := range executables {
+		licensed := false
+		for d := filepath.Dir(executable); ; d = filepath.Dir(d) {
+			if licensedDirs[d] {
+				licensed = true
+				break
+			}
+			if d == "." {
+				break
+			}
+		}
+		if !licensed {
+			findings = append(findings, licenseFinding{file: executable, license: unknownLicense, reason: "executable without a license file"})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].file < findings[j].file })
+	return findings, nil
+}
+
+// licenseOfText returns the SPDX identifier of the license in the contents
+// of a license file.
+func licenseOfText(contents []byte) string {
+	text := strings.Join(strings.Fields(string(contents)), " ")
+	// Texts of other licenses, such as MPL-2.0, can mention the GNU
+	// licenses, which are only recognized in texts of no other license.
+	for _, candidate := range licenseTexts {
+		if candidate.regex.MatchString(text) {
+			return candidate.license
+		}
+	}
+	if license := gnuLicenseOf(text); license != "" {
+		return license
+	}
+	if match := spdxRegex.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	return unknownLicense
+}
+
+// gnuLicenseOf returns the SPDX identifier of the first GNU license that
+// text mentions, without a version if text does not state it, or an empty
+// string if text mentions none.
+func gnuLicenseOf(text string) string {
+	match := gnuLicenseRegex.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	license := "GPL"
+	switch strings.ToLower(strings.TrimSpace(match[1])) {
+	case "affero":
+		license = "AGPL"
+	case "lesser", "library":
+		license = "LGPL"
+	}
+	if version := match[3]; version != "" {
+		if !strings.Contains(version, ".") {
+			version += ".0"
+		}
+		license += "-" + version
+	}
+	return license
+}
+
+// licenseHeader returns the leading comments of a source file, which state
+// its license, whitespace-normalized.
+func licenseHeader(contents []byte) string {
+	lines := strings.SplitN(string(contents), "\n", 51)
+	if len(lines) > 50 {
+		lines = lines[:50]
+	}
+	return strings.Join(strings.Fields(strings.Join(lines, "\n")), " ")
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const gpl2Text = `                    GNU GENERAL PUBLIC LICENSE
+                       Version 2, June 1991
+
+ Copyright (C) 1989, 1991 Free Software Foundation, Inc.
+`
+
+const mitText = `MIT License
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+`
+
+const apacheText = `
+                                 Apache License
+                           Version 2.0, January 2004
+                        http://www.apache.org/licenses/
+`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+}
+
+func TestScanLicenses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "package")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"LICENSE":                  apacheText,
+		"solution.jinja":           "resources: []\n",
+		"scripts/install.sh":       "#!/bin/bash\n# SPDX-License-Identifier: GPL-2.0-or-later\necho install\n",
+		"scripts/helper.py":        "# This program is free software; you can redistribute it under the terms of the\n# GNU Lesser General Public License as published by the Free Software Foundation\n",
+		"vendor/tool/COPYING":      gpl2Text,
+		"vendor/tool/bin/tool":     "\x7fELF\x02\x01\x01\x00",
+		"vendor/other/LICENSE.txt": mitText,
+		"vendor/other/lib.so":      "\x7fELF\x02\x01\x01\x00",
+		"vendor/odd/LICENSE":       "All rights reserved.\n",
+		"images/logo.png":          "\x89PNG\r\n\x1a\n\x00",
+	})
+
+	findings, err := scanLicenses(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []licenseFinding{
+		{file: "LICENSE", license: "Apache-2.0", reason: "license file"},
+		{file: "scripts/helper.py", license: "LGPL", reason: "license notice"},
+		{file: "scripts/install.sh", license: "GPL-2.0-or-later", reason: "SPDX identifier"},
+		{file: "vendor/odd/LICENSE", license: "unknown", reason: "license file"},
+		{file: "vendor/other/LICENSE.txt", license: "MIT", reason: "license file"},
+		{file: "vendor/tool/COPYING", license: "GPL-2.0", reason: "license file"},
+	}, findings)
+
+	// Executables are only covered by license files of their directory or
+	// its parents.
+	assert.NoError(t, os.Remove(filepath.Join(dir, "LICENSE")))
+	writeFiles(t, dir, map[string]string{"bin/agent": "\x7fELF\x02\x01\x01\x00"})
+	findings, err = scanLicenses(dir)
+	assert.NoError(t, err)
+	assert.Contains(t, findings, licenseFinding{file: "bin/agent", license: "unknown", reason: "executable without a license file"})
+	assert.NotContains(t, findings, licenseFinding{file: "vendor/other/lib.so", license: "unknown", reason: "executable without a license file"})
+}
+
+func TestLicenseCheckAllows(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  LicenseCheckOptions
+		license  string
+		expected bool
+	}{
+		{"Permissive", LicenseCheckOptions{License: "Proprietary"}, "MIT", true},
+		{"Same license", LicenseCheckOptions{License: "Proprietary"}, "proprietary", true},
+		{"GPL in proprietary solution", LicenseCheckOptions{License: "Proprietary"}, "GPL-2.0-or-later", false},
+		{"GPL in GPL solution", LicenseCheckOptions{License: "GPL-3.0-only"}, "GPL-3.0", true},
+		{"GPL without version in GPL solution", LicenseCheckOptions{License: "GPL-3.0-only"}, "GPL", false},
+		{"GPL-2.0-only in GPL-3.0 solution", LicenseCheckOptions{License: "GPL-3.0-only"}, "GPL-2.0-only", false},
+		{"GPL-3.0 in GPL-2.0-only solution", LicenseCheckOptions{License: "GPL-2.0-only"}, "GPL-3.0-only", false},
+		{"GPL-3.0 in GPL-2.0-or-later solution", LicenseCheckOptions{License: "GPL-2.0-or-later"}, "GPL-3.0-only", false},
+		{"GPL-2.0-or-later in GPL-3.0 solution", LicenseCheckOptions{License: "GPL-3.0-only"}, "GPL-2.0-or-later", true},
+		{"GPL-2.0+ in GPL-2.0 solution", LicenseCheckOptions{License: "GPL-2.0"}, "GPL-2.0+", true},
+		{"GPL-3.0-or-later in GPL-2.0 solution", LicenseCheckOptions{License: "GPL-2.0-only"}, "GPL-3.0-or-later", false},
+		{"LGPL in GPL solution", LicenseCheckOptions{License: "GPL-3.0-only"}, "LGPL-2.1", false},
+		{"Allowed license", LicenseCheckOptions{License: "Apache-2.0", AllowedLicenses: []string{"LGPL-2.1-only"}}, "LGPL-2.1", true},
+		{"Other version of allowed license", LicenseCheckOptions{License: "Apache-2.0", AllowedLicenses: []string{"LGPL-2.1-only"}}, "LGPL-3.0", false},
+		{"Unknown", LicenseCheckOptions{License: "Apache-2.0"}, unknownLicense, false},
+		{"Dual license", LicenseCheckOptions{License: "Apache-2.0"}, "(MIT OR GPL-2.0-only)", true},
+		{"Conjunction", LicenseCheckOptions{License: "Apache-2.0"}, "MIT AND GPL-2.0-only", false},
+		{"Exception", LicenseCheckOptions{License: "Apache-2.0"}, "Apache-2.0 WITH LLVM-exception", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.options.allows(tc.license))
+		})
+	}
+}
+
+func TestLicenseOfText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"GPL", gpl2Text, "GPL-2.0"},
+		{"MIT", mitText, "MIT"},
+		{"MPL mentioning the GPL", "Mozilla Public License Version 2.0\n\n1.12. \"Secondary License\" means either the GNU General Public\nLicense, Version 2.0, the GNU Lesser General Public License, Version 2.1", "MPL-2.0"},
+		{"SPDX identifier", "SPDX-License-Identifier: EPL-2.0\n", "EPL-2.0"},
+		{"Unknown", "All rights reserved.\n", unknownLicense},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, licenseOfText([]byte(tc.text)))
+		})
+	}
+}
+
+func TestLicenseCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "package")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"LICENSE":              apacheText,
+		"vendor/tool/COPYING":  gpl2Text,
+		"vendor/tool/bin/tool": "\x7fELF\x02\x01\x01\x00",
+	})
+
+	options := &LicenseCheckOptions{License: "Apache-2.0"}
+	assert.NoError(t, options.validate())
+	err = options.check(dir, "DM template")
+	assert.Error(t, err)
+	assert.Equal(t, ExitVerification, ExitCode(err))
+	assert.Contains(t, err.Error(), "DM template bundles content whose license conflicts with the license Apache-2.0 of the solution")
+	assert.Contains(t, err.Error(), "vendor/tool/COPYING: GPL-2.0 (license file)")
+
+	options.IgnorePaths = []string{"vendor/tool/*"}
+	assert.NoError(t, options.check(dir, "DM template"))
+
+	assert.Error(t, (&LicenseCheckOptions{}).validate())
+	assert.Error(t, (&LicenseCheckOptions{License: "MIT", IgnorePaths: []string{"["}}).validate())
+}
@@ -0,0 +1,243 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
+)
+
+// Severities of lint findings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// resourceNameRegex matches the recommended names of resources, which are
+// also valid deployment and image names.
+var resourceNameRegex = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+
+// Finding is a problem found by Lint.
+type Finding struct {
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	// Resource is the kind and name of the resource, if the finding is
+	// specific to a resource
+	Resource string `json:"resource,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Resource == "" {
+		return fmt.Sprintf("%s: %s: %s", f.Severity, f.File, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", f.Severity, f.File, f.Resource, f.Message)
+}
+
+// Lint runs the static checks of mpdev against the configuration files in
+// a directory tree, without creating any resource: the validation done by
+// apply --dryrun, the checks of autogen specs, naming conventions and the
+// consistency of related resources. Files are found as by apply
+// --recursive, so YAML files that do not contain mpdev resources and
+// hidden directories are skipped. Resources that do not set a project or
+// zone use those of defaults. Identical findings are only reported once.
+// The commands run by the dry runs are executed with executor.
+func Lint(dir string, defaults CloudDefaults, executor exec.Interface) ([]Finding, error) {
+	var findings []Finding
+	add := func(severity string, file string, rs Resource, format string, args ...interface{}) {
+		f := Finding{Severity: severity, File: file, Message: fmt.Sprintf(format, args...)}
+		if rs != nil {
+			ref := rs.GetReference()
+			f.Resource = ref.Kind + "/" + ref.Name
+		}
+		findings = append(findings, f)
+	}
+
+	r := NewRegistry(executor).(*registry)
+	files := map[Reference]string{}
+	paths, err := FindConfigFiles(dir, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		objs, decodeErr := decodeLintPath(path)
+		for _, o := range objs {
+			obj := o.Object
+			if !IsResource(obj) {
+				continue
+			}
+			defaults.SetDefaults(obj)
+			rs, err := UnstructuredToResource(obj)
+			if err != nil {
+				add(SeverityError, path, nil, "%s", err)
+				continue
+			}
+			ref := rs.GetReference()
+			if other, ok := files[ref]; ok {
+				if rel, err := filepath.Rel(dir, other); err == nil {
+					other = rel
+				}
+				add(SeverityError, path, rs, "duplicate resource, also defined in %s", other)
+				continue
+			}
+			if !resourceNameRegex.MatchString(ref.Name) {
+				add(SeverityWarning, path, rs, "name should contain only lowercase letters, digits and dashes, and start with a letter")
+			}
+			files[ref] = path
+			// Duplicates were reported above.
+			_ = r.RegisterResource(rs, o.Dir)
+			r.SetPatchDirs(rs, o.PatchDirs)
+		}
+		if decodeErr != nil {
+			add(SeverityError, path, nil, "%s", decodeErr)
+		}
+	}
+
+	resources, err := r.topologicalSort()
+	if err != nil {
+		add(SeverityError, dir, nil, "%s", err)
+		return sortFindings(findings), nil
+	}
+
+	// The warnings printed by dry runs are reported as findings by
+	// lintWarnings, so the output of dry runs is discarded.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	for _, rs := range resources {
+		file := files[rs.GetReference()]
+		if applyErr := rs.Apply(r, true); applyErr != nil {
+			if merr, ok := applyErr.(*multierror.Error); ok {
+				for _, e := range merr.Errors {
+					add(SeverityError, file, rs, "%s", e)
+				}
+			} else {
+				add(SeverityError, file, rs, "%s", applyErr)
+			}
+		}
+		for _, warning := range lintWarnings(r, rs) {
+			add(SeverityWarning, file, rs, "%s", warning)
+		}
+	}
+	return sortFindings(findings), nil
+}
+
+// lintWarnings returns problems of a resource that do not prevent it from
+// being applied.
+func lintWarnings(registry Registry, rs Resource) []string {
+	var warnings []string
+	switch rs := rs.(type) {
+	case *DeploymentManagerAutogenTemplate:
+		warnings = checkWaiterSpec(rs.Spec.DeploymentSpec)
+	case *K8sAppDeployer:
+		if rs.Flavor != helmDeployerFlavor || rs.Version == "" {
+			break
+		}
+		chart, err := getHelmChart(registry, rs.HelmChartRef)
+		if err != nil {
+			break
+		}
+		if chart.AppVersion != "" && chart.AppVersion != rs.Version {
+			warnings = append(warnings, fmt.Sprintf("version %s differs from appVersion %s of HelmChart %s",
+				rs.Version, chart.AppVersion, chart.Metadata.Name))
+		}
+		if !strings.HasPrefix(rs.Version, rs.Track+".") {
+			warnings = append(warnings, fmt.Sprintf("version %s is not in track %s", rs.Version, rs.Track))
+		}
+	}
+	return warnings
+}
+
+// decodeLintPath decodes the objects of a configuration file, or the
+// resources built from an overlay directory. The objects decoded before a
+// parse error are returned along with the error.
+func decodeLintPath(path string) ([]OverlayResource, error) {
+	if IsOverlay(path) {
+		resources, err := BuildOverlay(path)
+		return resources, errors.Wrap(err, "failed to build overlay")
+	}
+	objs, err := decodeLintFile(path)
+	resources := make([]OverlayResource, len(objs))
+	for i, obj := range objs {
+		resources[i] = OverlayResource{Object: obj, Dir: filepath.Dir(path)}
+	}
+	return resources, errors.Wrap(err, "failed to parse YAML")
+}
+
+func decodeLintFile(path string) ([]Unstructured, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var objs []Unstructured
+	dec := yaml.NewDecoder(f)
+	for {
+		var obj Unstructured
+		err := dec.Decode(&obj)
+		if err == io.EOF {
+			return objs, nil
+		}
+		if err != nil {
+			return objs, err
+		}
+		if obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+}
+
+func fileContains(path string, s string) bool {
+	b, err := ioutil.ReadFile(path)
+	return err == nil && strings.Contains(string(b), s)
+}
+
+// sortFindings sorts findings by file and resource, and removes duplicate
+// findings, such as the same warning about several tiers of an autogen spec.
+func sortFindings(findings []Finding) []Finding {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Resource < findings[j].Resource
+	})
+	seen := map[Finding]bool{}
+	unique := findings[:0]
+	for _, f := range findings {
+		if !seen[f] {
+			seen[f] = true
+			unique = append(unique, f)
+		}
+	}
+	return unique
+}
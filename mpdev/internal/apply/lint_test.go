@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestLint(t *testing.T) {
+	testCases := []struct {
+		name             string
+		files            map[string]string
+		expectedFindings []string
+	}{{
+		name: "Valid configuration",
+		files: map[string]string{
+			"configurations.yaml": `
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: module
+dir: module
+zipFilePath: module.zip
+`,
+			"Kptfile": "apiVersion: kpt.dev/v1alpha1\nkind: Kptfile\n",
+			// Hidden directories are skipped, as by apply --recursive
+			".cache/broken.yaml": "apiVersion: dev.marketplace.cloud.google.com/v1alpha1\nkind: [",
+			// Helm templates are not valid YAML and are skipped
+			"chart/templates/deployment.yaml": "metadata:\n  name: {{ .Release.Name }}\n  {{- if .Values.labels }}\n",
+		},
+	}, {
+		name: "Invalid configuration",
+		files: map[string]string{
+			"a.yaml": `
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: My_Module
+dir: module
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: UnknownKind
+metadata:
+  name: unknown
+`,
+			"b/b.yaml": `
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: TerraformModule
+metadata:
+  name: My_Module
+dir: module
+zipFilePath: module.zip
+`,
+			"c.yaml": "apiVersion: dev.marketplace.cloud.google.com/v1alpha1\nkind: [",
+		},
+		expectedFindings: []string{
+			"error: a.yaml: unknown Kind: UnknownKind. APIVersion: dev.marketplace.cloud.google.com/v1alpha1",
+			"warning: a.yaml: TerraformModule/My_Module: name should contain only lowercase letters, digits and dashes, and start with a letter",
+			"error: a.yaml: TerraformModule/My_Module: zipFilePath cannot be empty for Terraform module",
+			"error: b/b.yaml: TerraformModule/My_Module: duplicate resource, also defined in a.yaml",
+			"error: c.yaml: failed to parse YAML",
+		},
+	}, {
+		name: "Same warning for several tiers",
+		files: map[string]string{
+			"configurations.yaml": `
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerAutogenTemplate
+metadata:
+  name: autogen
+spec:
+  packageInfo:
+    version: '1.0.0'
+    osInfo:
+      name: Debian
+      version: '10'
+    components:
+    - name: app
+      version: '1.0.0'
+  deploymentSpec:
+    multiVm:
+      tiers:
+      - name: frontend
+        applicationStatus:
+          type: WAITER
+      - name: backend
+        applicationStatus:
+          type: WAITER
+`,
+		},
+		expectedFindings: []string{
+			"warning: configurations.yaml: DeploymentManagerAutogenTemplate/autogen: applicationStatus type is WAITER, but no waiter is configured",
+		},
+	}, {
+		name: "Inconsistent deployer version",
+		files: map[string]string{
+			"configurations.yaml": `
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: HelmChart
+metadata:
+  name: chart
+dir: chart
+destination: out
+appVersion: 1.2.0
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: K8sAppDeployer
+metadata:
+  name: deployer
+flavor: helm
+helmChartRef:
+  group: dev.marketplace.cloud.google.com
+  kind: HelmChart
+  name: chart
+schemaFile: schema.yaml
+image: gcr.io/project/app
+track: '1.3'
+version: 1.2.1
+`,
+		},
+		expectedFindings: []string{
+			"warning: configurations.yaml: K8sAppDeployer/deployer: version 1.2.1 differs from appVersion 1.2.0 of HelmChart chart",
+			"warning: configurations.yaml: K8sAppDeployer/deployer: version 1.2.1 is not in track 1.3",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "lint")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			for name, contents := range tc.files {
+				path := filepath.Join(dir, name)
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+			}
+
+			findings, err := Lint(dir, CloudDefaults{}, &testingexec.FakeExec{})
+			assert.NoError(t, err)
+			var actual []string
+			for _, f := range findings {
+				rel, err := filepath.Rel(dir, f.File)
+				assert.NoError(t, err)
+				f.File = rel
+				actual = append(actual, f.String())
+			}
+			assert.Len(t, actual, len(tc.expectedFindings), strings.Join(actual, "\n"))
+			for i, expected := range tc.expectedFindings {
+				if i < len(actual) {
+					assert.Contains(t, actual[i], expected)
+				}
+			}
+		})
+	}
+}
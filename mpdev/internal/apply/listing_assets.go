@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"image"
+	// Register the decoders of the image formats accepted for listings.
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Requirements of Marketplace listing assets, which are checked before the
+// assets are uploaded.
+const (
+	minLogoSize         = 512
+	minScreenshotWidth  = 1280
+	minScreenshotHeight = 720
+	maxScreenshots      = 8
+	maxAssetBytes       = 5 * 1024 * 1024
+)
+
+var listingImageFormats = map[string]bool{"png": true, "jpeg": true}
+
+var videoHosts = map[string]bool{"www.youtube.com": true, "youtube.com": true, "youtu.be": true}
+
+// ListingAssets validates the logo, screenshots and video links of a
+// listing against Marketplace asset requirements, and uploads the images to
+// a GCS bucket. Images must be PNG or JPEG files of at most 5 MB. The logo
+// must be square and at least 512x512 pixels. Up to 8 screenshots can be
+// added, and they must have a 16:9 aspect ratio and be at least 1280x720
+// pixels. Videos must be YouTube links. Images are uploaded under their file
+// names, so they must have distinct file names. The uploaded assets must still
+// be selected in Partner Portal.
+type ListingAssets struct {
+	BaseResource
+	// Logo is the path to the logo image
+	Logo string
+	// Screenshots are paths to screenshot images
+	Screenshots []string
+	// VideoURLs are links to videos of the solution
+	VideoURLs []string `json:"videoUrls"`
+	// Destination is the GCS path the images are uploaded to, such as
+	// gs://bucket/listing. If empty, the assets are only validated.
+	Destination string
+}
+
+type listingAsset struct {
+	kind string
+	path string
+	file string
+}
+
+// Apply validates the listing assets and uploads the images.
+func (l *ListingAssets) Apply(registry Registry, dryRun bool) error {
+	if l.Destination != "" && !isGCSPath(l.Destination) {
+		return fmt.Errorf("destination must be a GCS path starting with gs://: %s", l.Destination)
+	}
+
+	var assets []listingAsset
+	if l.Logo != "" {
+		assets = append(assets, listingAsset{kind: "logo", path: l.Logo})
+	}
+	for _, screenshot := range l.Screenshots {
+		assets = append(assets, listingAsset{kind: "screenshot", path: screenshot})
+	}
+	for i := range assets {
+		file, err := registry.ResolveFilePath(l, assets[i].path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve path to %s: %s", assets[i].kind, assets[i].path)
+		}
+		assets[i].file = file
+	}
+
+	problems := l.check(assets)
+	if len(problems) > 0 {
+		return fmt.Errorf("listing assets %s failed checks:\n  - %s", l.Metadata.Name, strings.Join(problems, "\n  - "))
+	}
+	fmt.Printf("Listing assets %s are valid\n", l.Metadata.Name)
+
+	if dryRun || l.Destination == "" {
+		return nil
+	}
+
+	executor := registry.GetExecutor()
+	screenshots := 0
+	for _, asset := range assets {
+		dst := strings.TrimSuffix(l.Destination, "/") + "/" + filepath.Base(asset.file)
+		fmt.Printf("Uploading %s from:%s to:%s\n", asset.kind, asset.file, dst)
+		err := runCommand(executor, "gsutil", "cp", asset.file, dst)
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload %s %s", asset.kind, asset.path)
+		}
+		if asset.kind == "logo" {
+			registry.SetOutput(l, "logo", dst)
+		} else {
+			registry.SetOutput(l, outputName("screenshot", screenshots, len(l.Screenshots)), dst)
+			screenshots++
+		}
+	}
+	return nil
+}
+
+// check returns the problems found in the listing assets.
+func (l *ListingAssets) check(assets []listingAsset) []string {
+	var problems []string
+	if len(l.Screenshots) > maxScreenshots {
+		problems = append(problems, fmt.Sprintf("%d screenshots are listed, at most %d are allowed", len(l.Screenshots), maxScreenshots))
+	}
+	uploaded := map[string]listingAsset{}
+	for _, asset := range assets {
+		problem := checkListingImage(asset)
+		if problem != "" {
+			problems = append(problems, problem)
+		}
+		// Images are uploaded under their file name, so two different
+		// files with the same name would overwrite each other.
+		name := filepath.Base(asset.file)
+		if other, ok := uploaded[name]; ok && other.file != asset.file {
+			problems = append(problems, fmt.Sprintf("%s %s and %s %s are both uploaded as %s, they must have distinct file names",
+				other.kind, other.path, asset.kind, asset.path, name))
+		} else if !ok {
+			uploaded[name] = asset
+		}
+	}
+	for _, video := range l.VideoURLs {
+		u, err := url.Parse(video)
+		if err != nil || u.Scheme != "https" || !videoHosts[u.Host] {
+			problems = append(problems, fmt.Sprintf("video %s must be an https YouTube link", video))
+		}
+	}
+	return problems
+}
+
+func checkListingImage(asset listingAsset) string {
+	info, err := os.Stat(asset.file)
+	if err != nil {
+		return fmt.Sprintf("%s %s cannot be read: %v", asset.kind, asset.path, err)
+	}
+	if info.Size() > maxAssetBytes {
+		return fmt.Sprintf("%s %s is %d bytes, at most %d are allowed", asset.kind, asset.path, info.Size(), maxAssetBytes)
+	}
+
+	f, err := os.Open(asset.file)
+	if err != nil {
+		return fmt.Sprintf("%s %s cannot be read: %v", asset.kind, asset.path, err)
+	}
+	defer f.Close()
+	config, format, err := image.DecodeConfig(f)
+	if err != nil || !listingImageFormats[format] {
+		return fmt.Sprintf("%s %s must be a PNG or JPEG image", asset.kind, asset.path)
+	}
+
+	width, height := config.Width, config.Height
+	switch asset.kind {
+	case "logo":
+		if width != height {
+			return fmt.Sprintf("logo %s is %dx%d pixels, it must be square", asset.path, width, height)
+		}
+		if width < minLogoSize {
+			return fmt.Sprintf("logo %s is %dx%d pixels, it must be at least %dx%d", asset.path, width, height, minLogoSize, minLogoSize)
+		}
+	case "screenshot":
+		if width*9 != height*16 {
+			return fmt.Sprintf("screenshot %s is %dx%d pixels, it must have a 16:9 aspect ratio", asset.path, width, height)
+		}
+		if width < minScreenshotWidth {
+			return fmt.Sprintf("screenshot %s is %dx%d pixels, it must be at least %dx%d",
+				asset.path, width, height, minScreenshotWidth, minScreenshotHeight)
+		}
+	}
+	return ""
+}
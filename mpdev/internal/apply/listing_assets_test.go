@@ -0,0 +1,150 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"image"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func writeTestImage(t *testing.T, dir string, name string, width int, height int) {
+	f, err := os.Create(filepath.Join(dir, name))
+	assert.NoError(t, err)
+	defer f.Close()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if filepath.Ext(name) == ".gif" {
+		assert.NoError(t, gif.Encode(f, img, nil))
+	} else {
+		assert.NoError(t, png.Encode(f, img))
+	}
+}
+
+func TestListingAssets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "listing-assets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTestImage(t, dir, "logo.png", 512, 512)
+	writeTestImage(t, dir, "small-logo.png", 128, 128)
+	writeTestImage(t, dir, "wide-logo.png", 1024, 512)
+	writeTestImage(t, dir, "screenshot.png", 1280, 720)
+	writeTestImage(t, dir, "square-screenshot.png", 1000, 1000)
+	writeTestImage(t, dir, "animated.gif", 1280, 720)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "other"), 0755))
+	writeTestImage(t, dir, "other/screenshot.png", 1280, 720)
+
+	testCases := []struct {
+		name            string
+		assets          ListingAssets
+		expectedErrs    []string
+		expectedRunArgs [][]string
+		expectedOutputs map[string]string
+	}{{
+		name: "Valid assets are uploaded",
+		assets: ListingAssets{
+			Logo:        "logo.png",
+			Screenshots: []string{"screenshot.png"},
+			VideoURLs:   []string{"https://www.youtube.com/watch?v=abc"},
+			Destination: "gs://bucket/listing/",
+		},
+		expectedRunArgs: [][]string{
+			{"gsutil", "cp", filepath.Join(dir, "logo.png"), "gs://bucket/listing/logo.png"},
+			{"gsutil", "cp", filepath.Join(dir, "screenshot.png"), "gs://bucket/listing/screenshot.png"},
+		},
+		expectedOutputs: map[string]string{
+			"logo":       "gs://bucket/listing/logo.png",
+			"screenshot": "gs://bucket/listing/screenshot.png",
+		},
+	}, {
+		name: "Valid assets without destination",
+		assets: ListingAssets{
+			Logo:        "logo.png",
+			Screenshots: []string{"screenshot.png", "screenshot.png"},
+		},
+	}, {
+		name: "Invalid assets",
+		assets: ListingAssets{
+			Logo:        "wide-logo.png",
+			Screenshots: []string{"square-screenshot.png", "animated.gif", "missing.png"},
+			VideoURLs:   []string{"https://vimeo.com/123"},
+			Destination: "gs://bucket",
+		},
+		expectedErrs: []string{
+			"logo wide-logo.png is 1024x512 pixels, it must be square",
+			"screenshot square-screenshot.png is 1000x1000 pixels, it must have a 16:9 aspect ratio",
+			"screenshot animated.gif must be a PNG or JPEG image",
+			"screenshot missing.png cannot be read",
+			"video https://vimeo.com/123 must be an https YouTube link",
+		},
+	}, {
+		name: "Images with the same file name",
+		assets: ListingAssets{
+			Logo:        "logo.png",
+			Screenshots: []string{"screenshot.png", "other/screenshot.png"},
+			Destination: "gs://bucket/listing",
+		},
+		expectedErrs: []string{
+			"screenshot screenshot.png and screenshot other/screenshot.png are both uploaded as screenshot.png",
+		},
+	}, {
+		name:         "Logo too small",
+		assets:       ListingAssets{Logo: "small-logo.png"},
+		expectedErrs: []string{"logo small-logo.png is 128x128 pixels, it must be at least 512x512"},
+	}, {
+		name:         "Destination is not GCS",
+		assets:       ListingAssets{Logo: "logo.png", Destination: "/tmp/listing"},
+		expectedErrs: []string{"destination must be a GCS path"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for range tc.expectedRunArgs {
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return nil, nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			assets := tc.assets
+			assets.BaseResource = newTestBaseResource("ListingAssets", "assets")
+			r.RegisterResource(&assets, dir)
+
+			err := assets.Apply(r, false)
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+			if tc.expectedOutputs != nil {
+				assert.Equal(t, tc.expectedOutputs, r.GetOutputs(assets.GetReference()))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// documentURLTimeout is the timeout of requests checking that a linked
+// document is reachable.
+var documentURLTimeout = 30 * time.Second
+
+// ListingDocuments checks the EULA and documentation links of a listing
+// before they are entered in Partner Portal. Every URL must use https and
+// respond without an error status. The documents must still be added in
+// Partner Portal.
+type ListingDocuments struct {
+	BaseResource
+	// EulaURL is a link to the end user license agreement of the solution
+	EulaURL string `json:"eulaUrl"`
+	// EulaFile is the path to a local copy of the EULA, such as a PDF
+	// uploaded in Partner Portal. Either EulaURL or EulaFile must be set.
+	EulaFile string
+	// Documentation links, such as quick start guides
+	Documentation []DocumentLink
+}
+
+// DocumentLink is a titled link to a document.
+type DocumentLink struct {
+	Title string
+	URL   string `json:"url"`
+}
+
+// Apply checks that the EULA exists and that every linked document is
+// reachable.
+func (l *ListingDocuments) Apply(registry Registry, dryRun bool) error {
+	if l.EulaURL == "" && l.EulaFile == "" {
+		return errors.New("either eulaUrl or eulaFile must be set for listing documents")
+	}
+
+	var problems []string
+	if l.EulaFile != "" {
+		file, err := registry.ResolveFilePath(l, l.EulaFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve path to EULA: %s", l.EulaFile)
+		}
+		if info, err := os.Stat(file); err != nil || info.IsDir() || info.Size() == 0 {
+			problems = append(problems, fmt.Sprintf("EULA file %s does not exist or is empty", l.EulaFile))
+		}
+	}
+
+	links := l.Documentation
+	if l.EulaURL != "" {
+		links = append([]DocumentLink{{Title: "EULA", URL: l.EulaURL}}, links...)
+	}
+	for _, link := range links {
+		if link.Title == "" {
+			problems = append(problems, fmt.Sprintf("document %s does not have a title", link.URL))
+		}
+		u, err := url.Parse(link.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("document %q must be an https URL: %s", link.Title, link.URL))
+			continue
+		}
+		// Reachability is not checked in dry runs, which are expected not to
+		// contact external servers.
+		if dryRun {
+			continue
+		}
+		if err := checkDocumentURL(link.URL); err != nil {
+			problems = append(problems, fmt.Sprintf("document %q is not reachable: %v", link.Title, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("listing documents %s failed checks:\n  - %s", l.Metadata.Name, strings.Join(problems, "\n  - "))
+	}
+	fmt.Printf("Listing documents %s are valid\n", l.Metadata.Name)
+	return nil
+}
+
+func checkDocumentURL(documentURL string) error {
+	client := &http.Client{Timeout: documentURLTimeout}
+	resp, err := client.Get(documentURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s returned status %d", documentURL, resp.StatusCode)
+	}
+	return nil
+}
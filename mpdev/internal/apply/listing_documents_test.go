@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestListingDocuments(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	// The test server uses a self-signed certificate.
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = defaultTransport }()
+
+	dir, err := ioutil.TempDir("", "listing-documents")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "eula.pdf"), []byte("%PDF"), 0644))
+
+	testCases := []struct {
+		name         string
+		documents    ListingDocuments
+		dryRun       bool
+		expectedErrs []string
+	}{{
+		name: "Reachable documents",
+		documents: ListingDocuments{
+			EulaURL:       server.URL + "/eula",
+			Documentation: []DocumentLink{{Title: "Quick start", URL: server.URL + "/quickstart"}},
+		},
+	}, {
+		name: "Local EULA",
+		documents: ListingDocuments{
+			EulaFile: "eula.pdf",
+		},
+	}, {
+		name: "Unreachable documents",
+		documents: ListingDocuments{
+			EulaFile: "missing.pdf",
+			Documentation: []DocumentLink{
+				{Title: "Quick start", URL: server.URL + "/missing"},
+				{URL: "http://example.com/docs"},
+			},
+		},
+		expectedErrs: []string{
+			"EULA file missing.pdf does not exist or is empty",
+			`document "Quick start" is not reachable`,
+			"document http://example.com/docs does not have a title",
+			`document "" must be an https URL`,
+		},
+	}, {
+		name: "Reachability not checked in dry run",
+		documents: ListingDocuments{
+			EulaURL: server.URL + "/missing",
+		},
+		dryRun: true,
+	}, {
+		name:         "No EULA",
+		documents:    ListingDocuments{},
+		expectedErrs: []string{"either eulaUrl or eulaFile must be set"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry(&testingexec.FakeExec{})
+			documents := tc.documents
+			documents.BaseResource = newTestBaseResource("ListingDocuments", "documents")
+			r.RegisterResource(&documents, dir)
+
+			err := documents.Apply(r, tc.dryRun)
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/utils/exec"
+)
+
+// Verbosity levels of log messages.
+const (
+	// LogCommands logs every command executed by mpdev when it exits
+	LogCommands = 1
+	// LogDebug additionally logs commands when they start
+	LogDebug = 2
+)
+
+// Log formats supported by Logger.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Logger writes structured log messages with a verbosity level. Messages
+// with a level above the verbosity of the logger are discarded.
+type Logger struct {
+	mu        sync.Mutex
+	w         io.Writer
+	verbosity int
+	format    string
+	now       func() time.Time
+}
+
+// NewLogger creates a logger writing messages up to verbosity to w, as text
+// or as one json object per line.
+func NewLogger(w io.Writer, verbosity int, format string) (*Logger, error) {
+	if format != LogFormatText && format != LogFormatJSON {
+		return nil, fmt.Errorf("unsupported log format %s. Must be text or json", format)
+	}
+	return &Logger{w: w, verbosity: verbosity, format: format, now: time.Now}, nil
+}
+
+// Enabled returns whether messages at level are written.
+func (l *Logger) Enabled(level int) bool {
+	return l != nil && level <= l.verbosity
+}
+
+// Log writes a message with the given fields, passed as alternating keys and
+// values, if level is enabled.
+func (l *Logger) Log(level int, msg string, keysAndValues ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ts := l.now().UTC().Format(time.RFC3339Nano)
+	if l.format == LogFormatJSON {
+		entry := map[string]interface{}{"time": ts, "level": level, "msg": msg}
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			entry[fmt.Sprint(keysAndValues[i])] = keysAndValues[i+1]
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			b = []byte(strconv.Quote(msg))
+		}
+		fmt.Fprintf(l.w, "%s\n", b)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", ts, msg)
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		value := fmt.Sprint(keysAndValues[i+1])
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&b, " %v=%s", keysAndValues[i], value)
+	}
+	fmt.Fprintln(l.w, b.String())
+}
+
+// NewLoggingExecutor returns an executor that logs every command executed
+// by resources, with its duration and exit status.
+func NewLoggingExecutor(executor exec.Interface, logger *Logger) exec.Interface {
+	return &loggingExecutor{Interface: executor, logger: logger}
+}
+
+type loggingExecutor struct {
+	exec.Interface
+	logger *Logger
+}
+
+func (e *loggingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &loggingCmd{Cmd: e.Interface.Command(cmd, args...), logger: e.logger, argv: append([]string{cmd}, args...)}
+}
+
+func (e *loggingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &loggingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), logger: e.logger, argv: append([]string{cmd}, args...)}
+}
+
+type loggingCmd struct {
+	exec.Cmd
+	logger *Logger
+	argv   []string
+	dir    string
+	start  time.Time
+}
+
+func (c *loggingCmd) SetDir(dir string) {
+	c.dir = dir
+	c.Cmd.SetDir(dir)
+}
+
+func (c *loggingCmd) Run() error {
+	c.started()
+	err := c.Cmd.Run()
+	c.exited(err)
+	return err
+}
+
+func (c *loggingCmd) Output() ([]byte, error) {
+	c.started()
+	out, err := c.Cmd.Output()
+	c.exited(err)
+	return out, err
+}
+
+func (c *loggingCmd) CombinedOutput() ([]byte, error) {
+	c.started()
+	out, err := c.Cmd.CombinedOutput()
+	c.exited(err)
+	return out, err
+}
+
+func (c *loggingCmd) Start() error {
+	c.started()
+	err := c.Cmd.Start()
+	if err != nil {
+		c.exited(err)
+	}
+	return err
+}
+
+func (c *loggingCmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.exited(err)
+	return err
+}
+
+func (c *loggingCmd) started() {
+	c.start = c.logger.now()
+	c.logger.Log(LogDebug, "starting command", c.fields()...)
+}
+
+func (c *loggingCmd) exited(err error) {
+	fields := append(c.fields(), "duration", c.logger.now().Sub(c.start).Round(time.Millisecond).String(),
+		"exitStatus", exitStatus(err))
+	if err != nil {
+		fields = append(fields, "error", err.Error())
+	}
+	c.logger.Log(LogCommands, "command exited", fields...)
+}
+
+func (c *loggingCmd) fields() []interface{} {
+	fields := []interface{}{"command", strings.Join(quoteArgs(redactArgs(c.argv)), " ")}
+	if c.dir != "" {
+		fields = append(fields, "dir", c.dir)
+	}
+	return fields
+}
+
+// exitStatus returns the exit status of a command that returned err, or -1
+// if the command did not exit, for example because it was not found.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(exec.ExitError); ok && exitErr.Exited() {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// secretFlagRegex matches the flags whose value is a secret, such as
+// --password or --access-token.
+var secretFlagRegex = regexp.MustCompile(`(?i)^--?[a-z0-9-]*(?:password|passwd|token|secret)$`)
+
+// secretValueRegex matches the secrets in an argument, such as the value of
+// a secret flag in the script of a shell, or a bearer token in a header.
+var secretValueRegex = regexp.MustCompile(`(?i)(--?[a-z0-9-]*(?:password|passwd|token|secret)[= ]|authorization:\s*bearer\s+)('[^']*'|[^\s']+)`)
+
+// secretEnvRegex matches the names of the environment variables whose value
+// is a secret, such as GOOGLE_OAUTH_ACCESS_TOKEN or REGISTRY_PASSWORD.
+// Variables holding the path of a secret, such as
+// CLOUDSDK_AUTH_ACCESS_TOKEN_FILE, are not secrets.
+var secretEnvRegex = regexp.MustCompile(`(?i)(?:password|passwd|token|secret)$`)
+
+// redactArgs returns argv, in which the values of secret flags and bearer
+// tokens are replaced, for the command to be printed or logged.
+func redactArgs(argv []string) []string {
+	redacted := make([]string, len(argv))
+	for i, arg := range argv {
+		if i > 0 && secretFlagRegex.MatchString(argv[i-1]) {
+			redacted[i] = "[REDACTED]"
+			continue
+		}
+		redacted[i] = secretValueRegex.ReplaceAllString(arg, "${1}[REDACTED]")
+	}
+	return redacted
+}
+
+// quoteArgs quotes the arguments of a command that contain spaces, quotes
+// or characters special to the shell, such that the logged command can be
+// copied to a shell.
+func quoteArgs(argv []string) []string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"$\\`;&|<>()*?[]{}~#!") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		quoted[i] = arg
+	}
+	return quoted
+}
+
+// NewPrintingExecutor returns an executor that prints every command to
+// stdout before executing it, in a form that can be copied to a shell: its
+// directory, the environment variables it adds, and its quoted arguments.
+func NewPrintingExecutor(executor exec.Interface) exec.Interface {
+	return &printingExecutor{Interface: executor}
+}
+
+type printingExecutor struct {
+	exec.Interface
+}
+
+func (e *printingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &printingCmd{Cmd: e.Interface.Command(cmd, args...), argv: append([]string{cmd}, args...)}
+}
+
+func (e *printingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return &printingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), argv: append([]string{cmd}, args...)}
+}
+
+type printingCmd struct {
+	exec.Cmd
+	argv []string
+	dir  string
+	env  []string
+}
+
+func (c *printingCmd) SetDir(dir string) {
+	c.dir = dir
+	c.Cmd.SetDir(dir)
+}
+
+func (c *printingCmd) SetEnv(env []string) {
+	c.env = env
+	c.Cmd.SetEnv(env)
+}
+
+func (c *printingCmd) Run() error {
+	c.print()
+	return c.Cmd.Run()
+}
+
+func (c *printingCmd) Output() ([]byte, error) {
+	c.print()
+	return c.Cmd.Output()
+}
+
+func (c *printingCmd) CombinedOutput() ([]byte, error) {
+	c.print()
+	return c.Cmd.CombinedOutput()
+}
+
+func (c *printingCmd) Start() error {
+	c.print()
+	return c.Cmd.Start()
+}
+
+func (c *printingCmd) print() {
+	fmt.Println(printedCommand(c.argv, c.dir, c.env, os.Environ()))
+}
+
+// printedCommand returns the shell command running argv in dir with env,
+// in which only the variables of env that differ from environ are set, and
+// secrets are redacted.
+func printedCommand(argv []string, dir string, env []string, environ []string) string {
+	var b strings.Builder
+	b.WriteString("+ ")
+	if dir != "" {
+		fmt.Fprintf(&b, "cd %s && ", quoteArgs([]string{dir})[0])
+	}
+	for _, v := range addedEnv(env, environ) {
+		// Only the value is quoted, for the shell to parse an assignment.
+		if i := strings.Index(v, "="); i > 0 {
+			value := v[i+1:]
+			if secretEnvRegex.MatchString(v[:i]) {
+				value = "[REDACTED]"
+			}
+			b.WriteString(v[:i+1] + quoteArgs([]string{value})[0] + " ")
+		}
+	}
+	b.WriteString(strings.Join(quoteArgs(redactArgs(argv)), " "))
+	return b.String()
+}
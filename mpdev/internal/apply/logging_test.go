@@ -0,0 +1,157 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestLoggingExecutor(t *testing.T) {
+	exitErr := exec.CodeExitError{Err: fmt.Errorf("exit status 2"), Code: 2}
+
+	testCases := []struct {
+		name      string
+		verbosity int
+		format    string
+		err       error
+		expected  string
+	}{{
+		name:      "Text",
+		verbosity: LogCommands,
+		format:    LogFormatText,
+		expected: "2020-06-01T12:00:01.5Z command exited command=\"gsutil cp 'my file.zip' gs://bucket/\" " +
+			"dir=/tmp duration=1.5s exitStatus=0\n",
+	}, {
+		name:      "JSON with error",
+		verbosity: LogCommands,
+		format:    LogFormatJSON,
+		err:       exitErr,
+		expected: `{"command":"gsutil cp 'my file.zip' gs://bucket/","dir":"/tmp","duration":"1.5s",` +
+			`"error":"exit status 2","exitStatus":2,"level":1,"msg":"command exited","time":"2020-06-01T12:00:01.5Z"}` + "\n",
+	}, {
+		name:      "Debug",
+		verbosity: LogDebug,
+		format:    LogFormatText,
+		expected: "2020-06-01T12:00:00Z starting command command=\"gsutil cp 'my file.zip' gs://bucket/\" dir=/tmp\n" +
+			"2020-06-01T12:00:01.5Z command exited command=\"gsutil cp 'my file.zip' gs://bucket/\" " +
+			"dir=/tmp duration=1.5s exitStatus=0\n",
+	}, {
+		name:      "Disabled",
+		verbosity: 0,
+		format:    LogFormatText,
+		expected:  "",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger, err := NewLogger(&out, tc.verbosity, tc.format)
+			assert.NoError(t, err)
+			clock := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+			logger.now = func() time.Time { return clock }
+
+			cmdErr := tc.err
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) {
+					clock = clock.Add(1500 * time.Millisecond)
+					return nil, nil, cmdErr
+				},
+			}}
+			fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+
+			cmd := NewLoggingExecutor(fexec, logger).Command("gsutil", "cp", "my file.zip", "gs://bucket/")
+			cmd.SetDir("/tmp")
+			assert.Equal(t, tc.err, cmd.Run())
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+
+	_, err := NewLogger(&bytes.Buffer{}, 0, "xml")
+	assert.EqualError(t, err, "unsupported log format xml. Must be text or json")
+}
+
+func TestPrintedCommand(t *testing.T) {
+	testCases := []struct {
+		name     string
+		argv     []string
+		dir      string
+		env      []string
+		expected string
+	}{{
+		name:     "Command",
+		argv:     []string{"gsutil", "cp", "my file.zip", "gs://bucket/"},
+		expected: "+ gsutil cp 'my file.zip' gs://bucket/",
+	}, {
+		name:     "Directory",
+		argv:     []string{"zip", "-r", "dm.zip", "."},
+		dir:      "/tmp/dm package",
+		expected: "+ cd '/tmp/dm package' && zip -r dm.zip .",
+	}, {
+		name:     "Environment",
+		argv:     []string{"bash", "check.sh"},
+		env:      []string{"HOME=/home/dev", "DEPLOYMENT_NAME=wordpress", "SITE_URL=http://1.2.3.4/?a=b c"},
+		expected: "+ DEPLOYMENT_NAME=wordpress SITE_URL='http://1.2.3.4/?a=b c' bash check.sh",
+	}, {
+		name: "Secret environment",
+		argv: []string{"docker", "create", "--env", "GOOGLE_OAUTH_ACCESS_TOKEN", "gcr.io/project/terraform"},
+		env: []string{"GOOGLE_OAUTH_ACCESS_TOKEN=ya29.token", "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE=/mpdev/credentials/access_token",
+			"MIRROR_PASSWORD=s3cr3t"},
+		expected: "+ GOOGLE_OAUTH_ACCESS_TOKEN='[REDACTED]' CLOUDSDK_AUTH_ACCESS_TOKEN_FILE=/mpdev/credentials/access_token " +
+			"MIRROR_PASSWORD='[REDACTED]' docker create --env GOOGLE_OAUTH_ACCESS_TOKEN gcr.io/project/terraform",
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, printedCommand(tc.argv, tc.dir, tc.env, []string{"HOME=/home/dev"}))
+		})
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		argv     []string
+		expected []string
+	}{{
+		name:     "No secret",
+		argv:     []string{"gcloud", "auth", "print-access-token"},
+		expected: []string{"gcloud", "auth", "print-access-token"},
+	}, {
+		name:     "Secret flag",
+		argv:     []string{"docker", "login", "--password", "s3cret", "--username=oauth2accesstoken", "gcr.io"},
+		expected: []string{"docker", "login", "--password", "[REDACTED]", "--username=oauth2accesstoken", "gcr.io"},
+	}, {
+		name:     "Secret flag value",
+		argv:     []string{"tool", "--access-token=ya29.abc", "--client-secret", "xyz"},
+		expected: []string{"tool", "--access-token=[REDACTED]", "--client-secret", "[REDACTED]"},
+	}, {
+		name:     "Script",
+		argv:     []string{"ssh", "host", "cd /tmp && curl -H 'Authorization: Bearer ya29.abc' --token 'a b' https://example.com"},
+		expected: []string{"ssh", "host", "cd /tmp && curl -H 'Authorization: Bearer [REDACTED]' --token [REDACTED] https://example.com"},
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, redactArgs(tc.argv))
+		})
+	}
+}
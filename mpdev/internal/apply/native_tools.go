@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// useNativeTools archives and uploads DM templates without executing zip
+// and gsutil, which are rarely installed on Windows.
+var useNativeTools = runtime.GOOS == "windows"
+
+// gcsUploadURL is the endpoint of the Cloud Storage JSON API that objects
+// are uploaded to.
+var gcsUploadURL = "https://storage.googleapis.com/upload/storage/v1"
+
+// uploadToGCS uploads the file src to the GCS path dst with the Cloud
+// Storage JSON API, authenticated with the access token of the active
+// gcloud account and, if kmsKey is set, encrypted with it.
+func uploadToGCS(executor exec.Interface, src string, dst string, kmsKey string) error {
+	bucket, object, err := splitGCSPath(dst)
+	if err != nil {
+		return err
+	}
+	token, err := accessToken(executor)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"uploadType": {"media"}, "name": {object}}
+	if kmsKey != "" {
+		query.Set("kmsKeyName", kmsKey)
+	}
+	u := fmt.Sprintf("%s/b/%s/o?%s", gcsUploadURL, url.PathEscape(bucket), query.Encode())
+	req, err := http.NewRequest("POST", u, f)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(executorContext(executor))
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if project := os.Getenv("GOOGLE_BILLING_PROJECT"); project != "" {
+		req.Header.Set("X-Goog-User-Project", project)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to upload %s to %s", src, dst)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		message := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &apiErr) == nil && apiErr.Error.Message != "" {
+			message = apiErr.Error.Message
+		}
+		return fmt.Errorf("failed to upload %s to %s: status %d: %s", src, dst, resp.StatusCode, message)
+	}
+	return nil
+}
+
+// splitGCSPath returns the bucket and object of a GCS path such as
+// gs://bucket/dir/object.
+func splitGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if !isGCSPath(path) || len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path %s. Must be in the format gs://BUCKET/OBJECT", path)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestArchiveDirectoryNative(t *testing.T) {
+	defer func(native bool) { useNativeTools = native }(useNativeTools)
+	useNativeTools = true
+
+	dir := newTestPackageDir(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "scripts"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "scripts", "install.sh"), []byte("echo ok"), 0644))
+
+	// The archive is inside the directory, and excluded from itself.
+	archive := filepath.Join(dir, "dm_template.zip")
+	err := archiveDirectory(&testingexec.FakeExec{}, zipArchiveFormat, archive, dir)
+	assert.NoError(t, err)
+
+	r, err := zip.OpenReader(archive)
+	assert.NoError(t, err)
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		"scripts/", "scripts/install.sh", "solution.jinja", "solution.jinja.display", "solution.jinja.schema", "vm.jinja",
+	}, names)
+}
+
+func TestUploadToGCS(t *testing.T) {
+	defer func(u string) { gcsUploadURL = u }(gcsUploadURL)
+	defer os.Setenv("GOOGLE_BILLING_PROJECT", os.Getenv("GOOGLE_BILLING_PROJECT"))
+	assert.NoError(t, os.Setenv("GOOGLE_BILLING_PROJECT", "billing-project"))
+
+	src, err := ioutil.TempFile("", "dmtemplate")
+	assert.NoError(t, err)
+	defer os.Remove(src.Name())
+	_, err = src.WriteString("archive")
+	assert.NoError(t, err)
+	assert.NoError(t, src.Close())
+
+	testCases := []struct {
+		name      string
+		dst       string
+		kmsKey    string
+		status    int
+		response  string
+		expectErr string
+	}{{
+		name:   "Upload",
+		dst:    "gs://bucket/dir/solution.zip",
+		status: http.StatusOK,
+	}, {
+		name:   "Encrypted upload",
+		dst:    "gs://bucket/dir/solution.zip",
+		kmsKey: "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		status: http.StatusOK,
+	}, {
+		name:      "Permission denied",
+		dst:       "gs://bucket/dir/solution.zip",
+		status:    http.StatusForbidden,
+		response:  `{"error": {"code": 403, "message": "publisher does not have storage.objects.create access"}}`,
+		expectErr: "status 403: publisher does not have storage.objects.create access",
+	}, {
+		name:      "Invalid path",
+		dst:       "gs://bucket",
+		expectErr: "invalid GCS path gs://bucket. Must be in the format gs://BUCKET/OBJECT",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			uploaded := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				uploaded = true
+				assert.Equal(t, "POST", r.Method)
+				assert.Equal(t, "/b/bucket/o", r.URL.Path)
+				assert.Equal(t, "media", r.URL.Query().Get("uploadType"))
+				assert.Equal(t, "dir/solution.zip", r.URL.Query().Get("name"))
+				assert.Equal(t, tc.kmsKey, r.URL.Query().Get("kmsKeyName"))
+				assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+				assert.Equal(t, "billing-project", r.Header.Get("X-Goog-User-Project"))
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "archive", string(body))
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			defer server.Close()
+			gcsUploadURL = server.URL
+
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) { return []byte("token\n"), nil, nil },
+				},
+			}
+			executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+
+			err := uploadToGCS(executor, src.Name(), tc.dst, tc.kmsKey)
+			if tc.expectErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.status != 0, uploaded)
+		})
+	}
+}
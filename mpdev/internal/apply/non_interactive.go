@@ -0,0 +1,192 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// nonInteractiveEnv are the environment variables disabling the prompts of
+// the tools executed by mpdev.
+var nonInteractiveEnv = []string{
+	// gcloud, and gsutil, which authenticates with gcloud
+	"CLOUDSDK_CORE_DISABLE_PROMPTS=1",
+	"TF_INPUT=0",
+	"GIT_TERMINAL_PROMPT=0",
+}
+
+// promptFailures are messages that tools print when they fail because they
+// cannot prompt, and how to provide the input beforehand.
+var promptFailures = []struct {
+	message string
+	hint    string
+}{{
+	message: "not in an interactive session",
+	hint:    "set the gcloud properties it asks for with gcloud config set, or authenticate beforehand with --credential-file",
+}, {
+	message: "cannot perform an interactive login",
+	hint:    "log in to the registry beforehand, such as with gcloud auth configure-docker",
+}, {
+	message: "no value for required variable",
+	hint:    "set the variables of the Terraform configuration in the resource",
+}, {
+	message: "terminal prompts disabled",
+	hint:    "configure git credentials beforehand, such as with a credential helper",
+}}
+
+// NewNonInteractiveExecutor returns an executor whose commands cannot
+// prompt: gcloud is passed --quiet, commands never read the stdin of mpdev
+// but /dev/null, and prompts of gcloud, gsutil,
+// terraform and git are disabled in their environment. docker does not
+// prompt without input. Commands that fail because they needed input return
+// an error telling how to provide it beforehand.
+func NewNonInteractiveExecutor(executor exec.Interface) exec.Interface {
+	return &nonInteractiveExecutor{Interface: executor}
+}
+
+type nonInteractiveExecutor struct {
+	exec.Interface
+}
+
+func (e *nonInteractiveExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return newNonInteractiveCmd(e.Interface.Command(cmd, nonInteractiveArgs(cmd, args)...), cmd)
+}
+
+func (e *nonInteractiveExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	return newNonInteractiveCmd(e.Interface.CommandContext(ctx, cmd, nonInteractiveArgs(cmd, args)...), cmd)
+}
+
+// nonInteractiveArgs prepends the option disabling the prompts of cmd to
+// args.
+func nonInteractiveArgs(cmd string, args []string) []string {
+	if filepath.Base(cmd) == "gcloud" {
+		return append([]string{"--quiet"}, args...)
+	}
+	return args
+}
+
+type nonInteractiveCmd struct {
+	exec.Cmd
+	name   string
+	env    []string
+	stderr *promptDetector
+}
+
+func newNonInteractiveCmd(cmd exec.Cmd, name string) *nonInteractiveCmd {
+	return &nonInteractiveCmd{Cmd: cmd, name: filepath.Base(name)}
+}
+
+func (c *nonInteractiveCmd) SetEnv(env []string) {
+	c.env = env
+}
+
+// SetStdin sets the input of the command, unless it is the stdin of mpdev.
+// Commands without input read /dev/null.
+func (c *nonInteractiveCmd) SetStdin(in io.Reader) {
+	if in != os.Stdin {
+		c.Cmd.SetStdin(in)
+	}
+}
+
+func (c *nonInteractiveCmd) SetStderr(out io.Writer) {
+	c.stderr = &promptDetector{w: out}
+	c.Cmd.SetStderr(c.stderr)
+}
+
+// setEnv adds nonInteractiveEnv to the environment of the command.
+func (c *nonInteractiveCmd) setEnv() {
+	env := c.env
+	if env == nil {
+		env = os.Environ()
+	}
+	c.Cmd.SetEnv(append(append([]string{}, env...), nonInteractiveEnv...))
+}
+
+func (c *nonInteractiveCmd) Run() error {
+	c.setEnv()
+	return c.promptError(c.Cmd.Run(), nil)
+}
+
+func (c *nonInteractiveCmd) Output() ([]byte, error) {
+	c.setEnv()
+	out, err := c.Cmd.Output()
+	return out, c.promptError(err, nil)
+}
+
+func (c *nonInteractiveCmd) CombinedOutput() ([]byte, error) {
+	c.setEnv()
+	out, err := c.Cmd.CombinedOutput()
+	return out, c.promptError(err, out)
+}
+
+func (c *nonInteractiveCmd) Start() error {
+	c.setEnv()
+	return c.Cmd.Start()
+}
+
+func (c *nonInteractiveCmd) Wait() error {
+	return c.promptError(c.Cmd.Wait(), nil)
+}
+
+// promptError wraps the error of a command whose stderr, or output,
+// shows that it failed because it could not prompt.
+func (c *nonInteractiveCmd) promptError(err error, output []byte) error {
+	if err == nil {
+		return nil
+	}
+	if c.stderr != nil {
+		output = append(output, c.stderr.tail.Bytes()...)
+	}
+	if e, ok := err.(*exec.ExitErrorWrapper); ok {
+		// Output captures the stderr of commands that do not set it.
+		output = append(output, e.Stderr...)
+	}
+	message := strings.ToLower(string(output))
+	for _, failure := range promptFailures {
+		if strings.Contains(message, failure.message) {
+			return errors.Wrapf(err, "%s needed input, which --non-interactive does not allow. Instead, %s", c.name, failure.hint)
+		}
+	}
+	return err
+}
+
+// maxPromptTail is the size of the end of stderr searched for prompt
+// failures, which tools print last.
+const maxPromptTail = 4096
+
+// promptDetector keeps the end of the stderr of a command written to w.
+type promptDetector struct {
+	w    io.Writer
+	tail bytes.Buffer
+}
+
+func (d *promptDetector) Write(p []byte) (int, error) {
+	d.tail.Write(p)
+	if extra := d.tail.Len() - maxPromptTail; extra > 0 {
+		d.tail.Next(extra)
+	}
+	if d.w == nil {
+		return len(p), nil
+	}
+	return d.w.Write(p)
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestNonInteractiveExecutor(t *testing.T) {
+	testCases := []struct {
+		name         string
+		cmd          string
+		stderr       string
+		err          error
+		expectedArgv []string
+		expectErr    string
+	}{{
+		name:         "gcloud",
+		cmd:          "gcloud",
+		expectedArgv: []string{"gcloud", "--quiet", "compute", "images", "list"},
+	}, {
+		name:         "Other command",
+		cmd:          "gsutil",
+		expectedArgv: []string{"gsutil", "compute", "images", "list"},
+	}, {
+		name:         "Failure",
+		cmd:          "gcloud",
+		stderr:       "ERROR: (gcloud.compute.images.list) The project property is set to the empty string\n",
+		err:          testingexec.FakeExitError{Status: 1},
+		expectedArgv: []string{"gcloud", "--quiet", "compute", "images", "list"},
+		expectErr:    "exit 1",
+	}, {
+		name: "Prompt",
+		cmd:  "gcloud",
+		stderr: "ERROR: This prompt could not be answered because you are not in an interactive session. " +
+			"You can re-run the command with the --quiet flag to accept default answers for all prompts.\n",
+		err:          testingexec.FakeExitError{Status: 1},
+		expectedArgv: []string{"gcloud", "--quiet", "compute", "images", "list"},
+		expectErr: "gcloud needed input, which --non-interactive does not allow. Instead, set the gcloud properties it asks for " +
+			"with gcloud config set, or authenticate beforehand with --credential-file: exit 1",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return nil, []byte(tc.stderr), tc.err },
+			}}
+			fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+
+			cmd := NewNonInteractiveExecutor(fexec).Command(tc.cmd, "compute", "images", "list")
+			cmd.SetStdin(os.Stdin)
+			var stderr bytes.Buffer
+			cmd.SetStderr(&stderr)
+			err := cmd.Run()
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				assert.Equal(t, ExitTool, ExitCode(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedArgv, fcmd.Argv)
+			assert.Nil(t, fcmd.Stdin)
+			assert.Equal(t, tc.stderr, stderr.String())
+			assert.Subset(t, fcmd.Env, nonInteractiveEnv)
+			assert.Subset(t, fcmd.Env, os.Environ())
+		})
+	}
+}
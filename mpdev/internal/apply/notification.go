@@ -0,0 +1,261 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+const pubSubAPI = "https://pubsub.googleapis.com/v1"
+
+var pubSubTopicRegex = regexp.MustCompile(`^projects/[^/]+/topics/[^/]+$`)
+
+// notificationTimeout is the timeout of requests sending notifications.
+var notificationTimeout = 30 * time.Second
+
+// Notification publishes a summary of each run of mpdev apply, including
+// the status, duration and outputs of each resource, when all resources
+// have been applied or a resource fails. Failing to send a notification is
+// reported as a warning and does not fail the run.
+//
+// URLs can reference environment variables, such as ${SLACK_WEBHOOK_URL},
+// so that secrets are not stored in configuration files.
+type Notification struct {
+	BaseResource
+	// Webhook receives the summary as JSON in a POST request
+	Webhook *WebhookNotification
+	// Slack receives a message through an incoming webhook
+	Slack *SlackNotification
+	// PubSub receives the summary as JSON in a message published to a topic
+	PubSub *PubSubNotification `json:"pubsub"`
+	// OnFailureOnly sends notifications only for runs that fail
+	OnFailureOnly bool
+	// DryRun also sends notifications for runs with --dryrun
+	DryRun bool
+}
+
+// WebhookNotification is an HTTP endpoint that notifications are posted to.
+type WebhookNotification struct {
+	URL string `json:"url"`
+}
+
+// SlackNotification is a Slack incoming webhook. See
+// https://api.slack.com/messaging/webhooks
+type SlackNotification struct {
+	WebhookURL string `json:"webhookUrl"`
+}
+
+// PubSubNotification is a Pub/Sub topic, such as
+// projects/my-project/topics/mpdev
+type PubSubNotification struct {
+	Topic string
+}
+
+// RunSummary summarizes a run of mpdev apply.
+type RunSummary struct {
+	DryRun    bool              `json:"dryRun"`
+	Succeeded bool              `json:"succeeded"`
+	Error     string            `json:"error,omitempty"`
+	StartTime time.Time         `json:"startTime"`
+	Duration  string            `json:"duration"`
+	Resources []ResourceSummary `json:"resources"`
+}
+
+// ResourceSummary records the result of applying a resource.
+type ResourceSummary struct {
+	Reference Reference `json:"reference"`
+	// Status is one of succeeded, failed or skipped
+	Status   string            `json:"status"`
+	Error    string            `json:"error,omitempty"`
+	Duration string            `json:"duration,omitempty"`
+	Outputs  map[string]string `json:"outputs,omitempty"`
+	// Stage is the stage of a publish run that applied the resource
+	Stage string `json:"stage,omitempty"`
+	// Checks are the checks and probes run by the resource
+	Checks []CheckSummary `json:"checks,omitempty"`
+}
+
+// CheckSummary records the result of a check or probe run by a resource,
+// such as a smoke test of a deployment.
+type CheckSummary struct {
+	Name string `json:"name"`
+	// Status is one of succeeded or failed
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// newCheckSummary returns the summary of a check that started at start and
+// returned err.
+func newCheckSummary(name string, start time.Time, err error) CheckSummary {
+	summary := CheckSummary{
+		Name:     name,
+		Status:   "succeeded",
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		summary.Status = "failed"
+		summary.Error = err.Error()
+	}
+	return summary
+}
+
+// checkReporter is implemented by resources that run checks, whose results
+// are recorded in the summary of the run.
+type checkReporter interface {
+	checkResults() []CheckSummary
+}
+
+// notifier is implemented by resources that are notified of the summary of
+// a run after all other resources have been applied.
+type notifier interface {
+	notify(executor exec.Interface, summary *RunSummary) error
+}
+
+// Apply validates the notification targets. Notifications are sent by the
+// registry at the end of the run.
+func (n *Notification) Apply(registry Registry, dryRun bool) error {
+	if n.Webhook == nil && n.Slack == nil && n.PubSub == nil {
+		return errors.New("notification must specify at least one of webhook, slack or pubsub")
+	}
+	if n.Webhook != nil {
+		if err := validateNotificationURL(n.Webhook.URL); err != nil {
+			return errors.Wrap(err, "invalid webhook url")
+		}
+	}
+	if n.Slack != nil {
+		if err := validateNotificationURL(n.Slack.WebhookURL); err != nil {
+			return errors.Wrap(err, "invalid slack webhookUrl")
+		}
+	}
+	if n.PubSub != nil && !pubSubTopicRegex.MatchString(n.PubSub.Topic) {
+		return fmt.Errorf("pubsub topic %q must have the format projects/PROJECT/topics/TOPIC", n.PubSub.Topic)
+	}
+	return nil
+}
+
+func validateNotificationURL(s string) error {
+	if s == "" {
+		return errors.New("url cannot be empty")
+	}
+	// Environment variables may not be set when validating a dry run.
+	if strings.Contains(s, "$") {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("url %s must use http or https", s)
+	}
+	return nil
+}
+
+func (n *Notification) notify(executor exec.Interface, summary *RunSummary) error {
+	if summary.DryRun && !n.DryRun {
+		return nil
+	}
+	if summary.Succeeded && n.OnFailureOnly {
+		return nil
+	}
+
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+
+	var notifyErr error
+	if n.Webhook != nil {
+		err := postNotification(os.ExpandEnv(n.Webhook.URL), b)
+		if err != nil {
+			notifyErr = multierror.Append(notifyErr, errors.Wrap(err, "failed to send webhook notification"))
+		}
+	}
+	if n.Slack != nil {
+		message, err := json.Marshal(map[string]string{"text": summary.text()})
+		if err != nil {
+			return err
+		}
+		err = postNotification(os.ExpandEnv(n.Slack.WebhookURL), message)
+		if err != nil {
+			notifyErr = multierror.Append(notifyErr, errors.Wrap(err, "failed to send slack notification"))
+		}
+	}
+	if n.PubSub != nil {
+		body := map[string]interface{}{
+			"messages": []map[string]string{{"data": base64.StdEncoding.EncodeToString(b)}},
+		}
+		err := callGoogleAPI(executor, "POST", fmt.Sprintf("%s/%s:publish", pubSubAPI, n.PubSub.Topic), body, nil)
+		if err != nil {
+			notifyErr = multierror.Append(notifyErr, errors.Wrapf(err, "failed to publish notification to %s", n.PubSub.Topic))
+		}
+	}
+	return notifyErr
+}
+
+func postNotification(u string, body []byte) error {
+	client := &http.Client{Timeout: notificationTimeout}
+	resp, err := client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification was rejected with status %s", resp.Status)
+	}
+	return nil
+}
+
+// text formats the summary as a human readable message.
+func (s *RunSummary) text() string {
+	var b strings.Builder
+	status := "succeeded"
+	if !s.Succeeded {
+		status = "failed"
+	}
+	run := "apply"
+	if s.DryRun {
+		run = "apply --dryrun"
+	}
+	fmt.Fprintf(&b, "mpdev %s %s in %s\n", run, status, s.Duration)
+	for _, rs := range s.Resources {
+		fmt.Fprintf(&b, "• %s %s: %s", rs.Reference.Kind, rs.Reference.Name, rs.Status)
+		if rs.Duration != "" {
+			fmt.Fprintf(&b, " (%s)", rs.Duration)
+		}
+		if rs.Error != "" {
+			fmt.Fprintf(&b, ": %s", rs.Error)
+		}
+		b.WriteString("\n")
+		for _, name := range sortedKeys(rs.Outputs) {
+			fmt.Fprintf(&b, "    %s: %s\n", name, rs.Outputs[name])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestNotificationValidation(t *testing.T) {
+	testCases := []struct {
+		name          string
+		notification  Notification
+		errorContains string
+	}{{
+		name:          "No targets",
+		errorContains: "at least one of webhook, slack or pubsub",
+	}, {
+		name: "Valid targets",
+		notification: Notification{
+			Webhook: &WebhookNotification{URL: "https://example.com/hook"},
+			Slack:   &SlackNotification{WebhookURL: "${SLACK_WEBHOOK_URL}"},
+			PubSub:  &PubSubNotification{Topic: "projects/p/topics/mpdev"},
+		},
+	}, {
+		name:          "Invalid webhook scheme",
+		notification:  Notification{Webhook: &WebhookNotification{URL: "ftp://example.com"}},
+		errorContains: "must use http or https",
+	}, {
+		name:          "Invalid topic",
+		notification:  Notification{PubSub: &PubSubNotification{Topic: "mpdev"}},
+		errorContains: "must have the format projects/PROJECT/topics/TOPIC",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.notification.Apply(NewRegistry(&testingexec.FakeExec{}), true)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNotificationSummary(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, r.URL.Path+" "+string(b))
+	}))
+	defer server.Close()
+	defer os.Unsetenv("TEST_SLACK_URL")
+	assert.NoError(t, os.Setenv("TEST_SLACK_URL", server.URL+"/slack"))
+
+	testCases := []struct {
+		name             string
+		dryRun           bool
+		fail             bool
+		onFailureOnly    bool
+		expectedStatuses []string
+		expectedRequests int
+	}{{
+		name:             "Successful apply",
+		expectedStatuses: []string{"succeeded", "succeeded"},
+		expectedRequests: 2,
+	}, {
+		name:             "Failed apply",
+		fail:             true,
+		onFailureOnly:    true,
+		expectedStatuses: []string{"failed", "skipped"},
+		expectedRequests: 2,
+	}, {
+		name:          "Successful apply, failures only",
+		onFailureOnly: true,
+	}, {
+		name:   "Dry run",
+		dryRun: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bodies = nil
+			r1 := newTestResourceFunc("r1", func(r Registry, _ bool) error {
+				if tc.fail {
+					return fmt.Errorf("r1 failed")
+				}
+				return nil
+			}, nil)
+			r2 := newTestResourceFunc("r2", func(Registry, bool) error { return nil }, func() []Reference { return []Reference{r1.GetReference()} })
+			n := &Notification{
+				BaseResource:  newTestBaseResource("Notification", "notify"),
+				Webhook:       &WebhookNotification{URL: server.URL + "/hook"},
+				Slack:         &SlackNotification{WebhookURL: "${TEST_SLACK_URL}"},
+				OnFailureOnly: tc.onFailureOnly,
+			}
+			registry := NewRegistry(&testingexec.FakeExec{})
+			registry.RegisterResource(r1, "dir")
+			registry.RegisterResource(r2, "dir")
+			registry.RegisterResource(n, "dir")
+
+			err := registry.Apply(tc.dryRun)
+			assert.Equal(t, tc.fail, err != nil)
+			assert.Len(t, bodies, tc.expectedRequests)
+			if tc.expectedRequests == 0 {
+				return
+			}
+
+			for _, body := range bodies {
+				if body[:6] == "/slack" {
+					assert.Contains(t, body, "mpdev apply")
+					continue
+				}
+				var summary RunSummary
+				assert.NoError(t, json.Unmarshal([]byte(body[len("/hook "):]), &summary))
+				assert.Equal(t, !tc.fail, summary.Succeeded)
+				var statuses []string
+				for _, rs := range summary.Resources {
+					statuses = append(statuses, rs.Status)
+				}
+				assert.Equal(t, tc.expectedStatuses, statuses)
+			}
+		})
+	}
+}
+
+func TestNotificationPubSub(t *testing.T) {
+	fcmd := testingexec.FakeCmd{}
+	n := &Notification{PubSub: &PubSubNotification{Topic: "projects/p/topics/mpdev"}}
+
+	err := n.notify(fakeGoogleAPI(&fcmd, `{"messageIds": ["1"]}`), &RunSummary{Succeeded: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"POST " + pubSubAPI + "/projects/p/topics/mpdev:publish"}, apiRequests(&fcmd))
+}
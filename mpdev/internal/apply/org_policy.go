@@ -0,0 +1,221 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	accessConfigsRegex = regexp.MustCompile(`['"]?accessConfigs['"]?\s*:`)
+	imageProjectRegex  = regexp.MustCompile(`projects/([a-z][-a-z0-9.:]*[a-z0-9])/global/images/`)
+)
+
+// OrgPolicyCheck reports the organization policy constraints of a test
+// project that will break the default deployment of a solution, before any
+// deployment is attempted. The following constraints are checked against
+// the generated templates:
+// compute.requireShieldedVm, compute.vmExternalIpAccess and
+// compute.trustedImageProjects.
+// See https://cloud.google.com/resource-manager/docs/organization-policy/org-policy-constraints
+type OrgPolicyCheck struct {
+	BaseResource
+	// ProjectID of the test project
+	ProjectID string `json:"projectId"`
+	// DeploymentManagerRef references the autogen template whose generated
+	// templates are checked
+	DeploymentManagerRef Reference
+	// ImageProjects that the images of the solution are published in.
+	// Defaults to the projects of the images referenced by the templates.
+	ImageProjects []string
+}
+
+// orgPolicy is the effective policy of a constraint, as printed by
+// gcloud resource-manager org-policies describe --effective
+type orgPolicy struct {
+	BooleanPolicy *struct {
+		Enforced bool
+	} `json:"booleanPolicy"`
+	ListPolicy *struct {
+		AllValues     string   `json:"allValues"`
+		AllowedValues []string `json:"allowedValues"`
+		DeniedValues  []string `json:"deniedValues"`
+	} `json:"listPolicy"`
+}
+
+// GetDependencies returns dependencies for OrgPolicyCheck
+func (c *OrgPolicyCheck) GetDependencies() (r []Reference) {
+	return []Reference{c.DeploymentManagerRef}
+}
+
+// Apply checks the effective org policies of the project.
+func (c *OrgPolicyCheck) Apply(registry Registry, dryRun bool) error {
+	if c.ProjectID == "" {
+		return errors.New("projectId cannot be empty for org policy check")
+	}
+	dmTemplate, err := getAutogenTemplate(registry, c.DeploymentManagerRef)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	templates, err := readTemplates(dmTemplate.outDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to read generated templates")
+	}
+	imageProjects := c.ImageProjects
+	if len(imageProjects) == 0 {
+		imageProjects = templateImageProjects(templates)
+	}
+
+	var problems []string
+	policy, err := c.describePolicy(registry, "compute.requireShieldedVm")
+	if err != nil {
+		return err
+	}
+	if policy.BooleanPolicy != nil && policy.BooleanPolicy.Enforced {
+		for _, name := range sortedTemplateNames(templates) {
+			if !secureBootRegex.Match(templates[name]) && strings.Contains(string(templates[name]), "compute.v1.instance") {
+				problems = append(problems, fmt.Sprintf("compute.requireShieldedVm is enforced, but %s creates instances without Secure Boot", name))
+			}
+		}
+	}
+
+	policy, err = c.describePolicy(registry, "compute.vmExternalIpAccess")
+	if err != nil {
+		return err
+	}
+	if policy.ListPolicy != nil && (policy.ListPolicy.AllValues == "DENY" || len(policy.ListPolicy.AllowedValues) > 0) {
+		for _, name := range sortedTemplateNames(templates) {
+			if accessConfigsRegex.Match(templates[name]) {
+				problems = append(problems, fmt.Sprintf("compute.vmExternalIpAccess restricts external IPs, but %s creates instances with external IPs", name))
+			}
+		}
+	}
+
+	policy, err = c.describePolicy(registry, "compute.trustedImageProjects")
+	if err != nil {
+		return err
+	}
+	for _, project := range imageProjects {
+		if !policy.allows("projects/" + project) {
+			problems = append(problems, fmt.Sprintf("compute.trustedImageProjects does not allow images from project %s", project))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("org policy check %s failed for project %s:\n  - %s", c.Metadata.Name, c.ProjectID, strings.Join(problems, "\n  - "))
+	}
+	fmt.Printf("Org policies of project %s are compatible with the solution\n", c.ProjectID)
+	return nil
+}
+
+func (c *OrgPolicyCheck) describePolicy(registry Registry, constraint string) (*orgPolicy, error) {
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gcloud", "resource-manager", "org-policies", "describe",
+		constraint, "--project", c.ProjectID, "--effective", "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe org policy %s of project %s", constraint, c.ProjectID)
+	}
+	var policy orgPolicy
+	err = json.Unmarshal(stdout, &policy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse org policy %s", constraint)
+	}
+	return &policy, nil
+}
+
+// allows reports whether a list policy allows a value. Values of list
+// policies can be prefixed with is: or under:.
+func (p *orgPolicy) allows(value string) bool {
+	if p.ListPolicy == nil {
+		return true
+	}
+	matches := func(values []string) bool {
+		for _, v := range values {
+			v = strings.TrimPrefix(strings.TrimPrefix(v, "is:"), "under:")
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case p.ListPolicy.AllValues == "DENY":
+		return false
+	case matches(p.ListPolicy.DeniedValues):
+		return false
+	case p.ListPolicy.AllValues == "ALLOW" || len(p.ListPolicy.AllowedValues) == 0:
+		return true
+	}
+	return matches(p.ListPolicy.AllowedValues)
+}
+
+// readTemplates returns the contents of the templates in dir, by path
+// relative to dir.
+func readTemplates(dir string) (map[string][]byte, error) {
+	templates := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isTemplateFile(path) {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		templates[rel] = contents
+		return nil
+	})
+	return templates, err
+}
+
+func sortedTemplateNames(templates map[string][]byte) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// templateImageProjects returns the projects of the images referenced by
+// templates.
+func templateImageProjects(templates map[string][]byte) []string {
+	var projects []string
+	for _, contents := range templates {
+		for _, match := range imageProjectRegex.FindAllSubmatch(contents, -1) {
+			projects = append(projects, string(match[1]))
+		}
+	}
+	return uniqueStrings(projects)
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestOrgPolicyCheck(t *testing.T) {
+	template := `
+resources:
+- name: vm
+  type: compute.v1.instance
+  properties:
+    disks:
+    - initializeParams:
+        sourceImage: https://www.googleapis.com/compute/v1/projects/my-public-images/global/images/wordpress-v1
+    networkInterfaces:
+    - accessConfigs:
+      - type: ONE_TO_ONE_NAT
+`
+	noPolicy := `{"constraint": "constraints/compute.requireShieldedVm"}`
+
+	testCases := []struct {
+		name         string
+		policies     []string
+		expectedErrs []string
+	}{{
+		name:     "No policies",
+		policies: []string{noPolicy, noPolicy, noPolicy},
+	}, {
+		name: "Allowed image project",
+		policies: []string{
+			`{"booleanPolicy": {}}`,
+			`{"listPolicy": {"allValues": "ALLOW"}}`,
+			`{"listPolicy": {"allowedValues": ["projects/debian-cloud", "is:projects/my-public-images"]}}`,
+		},
+	}, {
+		name: "Breaking policies",
+		policies: []string{
+			`{"booleanPolicy": {"enforced": true}}`,
+			`{"listPolicy": {"allValues": "DENY"}}`,
+			`{"listPolicy": {"allowedValues": ["projects/debian-cloud"]}}`,
+		},
+		expectedErrs: []string{
+			"compute.requireShieldedVm is enforced, but solution.jinja creates instances without Secure Boot",
+			"compute.vmExternalIpAccess restricts external IPs, but solution.jinja creates instances with external IPs",
+			"compute.trustedImageProjects does not allow images from project my-public-images",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "org-policy")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), []byte(template), 0644))
+
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for _, policy := range tc.policies {
+				policy := policy
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return []byte(policy), nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = dir
+			check := &OrgPolicyCheck{
+				BaseResource:         newTestBaseResource("OrgPolicyCheck", "policies"),
+				ProjectID:            "test-project",
+				DeploymentManagerRef: autogen.GetReference(),
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(check, "dir")
+
+			err = check.Apply(r, false)
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, fcmd.RunLog, 3)
+			assert.Equal(t, []string{"gcloud", "resource-manager", "org-policies", "describe", "compute.requireShieldedVm",
+				"--project", "test-project", "--effective", "--format", "json"}, fcmd.RunLog[0])
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// outputFileMode are the permissions of the files generated by resources,
+// or 0 to keep those they were created with, and outputUID and outputGID
+// their owner, or -1 to keep it, set with UseOutputPermissions.
+var (
+	outputFileMode       os.FileMode
+	outputUID, outputGID = -1, -1
+)
+
+// UseOutputPermissions sets the permissions, such as 0644, and the owner,
+// such as 1000:1000, of the files generated by resources, such as the
+// autogen output and the archives written to local paths, such that the
+// later steps of a CI pipeline can read and write them. Directories and
+// executable files are also given the execute permission of the classes
+// that can read them. Empty values keep the permissions and the owner that
+// files are created with.
+func UseOutputPermissions(mode string, owner string) error {
+	outputFileMode, outputUID, outputGID = 0, -1, -1
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m == 0 || m > 0777 {
+			return fmt.Errorf("invalid file mode %s. Must be octal permissions, such as 0644", mode)
+		}
+		outputFileMode = os.FileMode(m)
+	}
+	if owner != "" {
+		parts := strings.SplitN(owner, ":", 2)
+		ids := []*int{&outputUID, &outputGID}
+		for i, part := range parts {
+			id, err := strconv.Atoi(part)
+			if err != nil || id < 0 {
+				outputUID, outputGID = -1, -1
+				return fmt.Errorf("invalid file owner %s. Must be a numeric UID, or UID:GID, such as 1000:1000", owner)
+			}
+			*ids[i] = id
+		}
+	}
+	return nil
+}
+
+// setOutputPermissions applies the permissions and the owner set with
+// UseOutputPermissions to the files generated by a resource, and to the
+// contents of directories. Symbolic links are not followed.
+func setOutputPermissions(paths ...string) error {
+	if outputFileMode == 0 && outputUID < 0 && outputGID < 0 {
+		return nil
+	}
+	for _, root := range paths {
+		err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if outputFileMode != 0 && info.Mode()&os.ModeSymlink == 0 {
+				if err := os.Chmod(file, outputMode(info)); err != nil {
+					return err
+				}
+			}
+			if outputUID < 0 && outputGID < 0 {
+				return nil
+			}
+			return os.Lchown(file, outputUID, outputGID)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to set the permissions of %s", root)
+		}
+	}
+	return nil
+}
+
+// outputMode returns the permissions of a generated file, adding execute
+// permissions to directories and executable files for the classes that can
+// read them.
+func outputMode(info os.FileInfo) os.FileMode {
+	mode := outputFileMode
+	if info.IsDir() || info.Mode()&0111 != 0 {
+		mode |= (mode & 0444) >> 2
+	}
+	return mode
+}
+
+// reclaimScript gives the directories passed to it after the owner, such as
+// 1000:1000, and their contents, to this owner. It only requires a shell
+// and chown, which are in the images of the containers run by resources.
+const reclaimScript = `owner="$1"; shift; for d; do chown -R "$owner" "$d"; done`
+
+// reclaimOwnership gives the files that the container wrote to its writable
+// bind mounts back to the current user when the container wrote them as
+// another user, such as root with a daemon remapping user namespaces, in
+// which case mpdev could neither set their permissions nor remove them. The
+// current user cannot chown them, so a container of the same image chowns
+// them as root.
+func (cp *containerProcess) reclaimOwnership(ctx context.Context, runner ContainerRunner) error {
+	if mountStrategy() == MountCopy {
+		return nil
+	}
+	spec := ContainerSpec{
+		Name:       cp.name + "-chown",
+		Image:      cp.containerImage,
+		User:       "0:0",
+		Entrypoint: "sh",
+		Args:       []string{"-c", reclaimScript, "sh", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())},
+	}
+	for _, mount := range cp.mounts {
+		m := mount.getMount()
+		if m.ReadOnly || m.Type != "bind" || !hasForeignFiles(m.Source) {
+			continue
+		}
+		spec.Mounts = append(spec.Mounts, m)
+		spec.Args = append(spec.Args, m.Target)
+	}
+	if len(spec.Mounts) == 0 {
+		return nil
+	}
+	fmt.Printf("Changing the owner of the files written by container %s to the current user\n", cp.containerImage)
+	defer func() { _ = runner.Remove(context.Background(), spec.Name) }()
+	var stderr bytes.Buffer
+	status, err := runner.Run(ctx, spec, ioutil.Discard, &stderr)
+	if err == nil && status != 0 {
+		err = &dockerError{op: "run container " + cp.containerImage, message: fmt.Sprintf("exit status %d: %s", status, strings.TrimSpace(stderr.String()))}
+	}
+	return errors.Wrapf(err, "failed to change the owner of the files written by container %s", cp.containerImage)
+}
+
+// hasForeignFiles returns whether dir contains files that the current user
+// does not own, according to their Lstat, or directories that it cannot
+// read. Root, and users on Windows, own every file in this sense. It is
+// replaced by a fake in tests, which run as any user.
+var hasForeignFiles = func(dir string) bool {
+	uid := os.Getuid()
+	if uid <= 0 {
+		return false
+	}
+	foreign := false
+	_ = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if os.IsPermission(err) || (err == nil && !ownedBy(info, uid)) {
+			foreign = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return foreign
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestUseOutputPermissions(t *testing.T) {
+	defer UseOutputPermissions("", "")
+	testCases := []struct {
+		name      string
+		mode      string
+		owner     string
+		expected  []int
+		expectErr string
+	}{{
+		name:     "Unset",
+		expected: []int{0, -1, -1},
+	}, {
+		name:     "Mode and owner",
+		mode:     "0664",
+		owner:    "1000:1001",
+		expected: []int{0664, 1000, 1001},
+	}, {
+		name:     "Owner without group",
+		mode:     "640",
+		owner:    "1000",
+		expected: []int{0640, 1000, -1},
+	}, {
+		name:      "Symbolic mode",
+		mode:      "u+rw",
+		expectErr: "invalid file mode u+rw. Must be octal permissions, such as 0644",
+	}, {
+		name:      "Mode with file type bits",
+		mode:      "01644",
+		expectErr: "invalid file mode 01644. Must be octal permissions, such as 0644",
+	}, {
+		name:      "User name",
+		owner:     "builder:builder",
+		expectErr: "invalid file owner builder:builder. Must be a numeric UID, or UID:GID, such as 1000:1000",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := UseOutputPermissions(tc.mode, tc.owner)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, []int{int(outputFileMode), outputUID, outputGID})
+		})
+	}
+}
+
+func TestSetOutputPermissions(t *testing.T) {
+	defer UseOutputPermissions("", "")
+	dir, err := ioutil.TempDir("", "output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "scripts"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), nil, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "scripts", "startup.sh"), nil, 0700))
+	assert.NoError(t, os.Symlink("solution.jinja", filepath.Join(dir, "main.jinja")))
+
+	assert.NoError(t, setOutputPermissions(dir))
+	info, err := os.Stat(filepath.Join(dir, "solution.jinja"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "permissions are kept when unset")
+
+	assert.NoError(t, UseOutputPermissions("0644", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())))
+	assert.NoError(t, setOutputPermissions(dir))
+	for file, expected := range map[string]os.FileMode{
+		"":                   0755,
+		"solution.jinja":     0644,
+		"scripts":            0755,
+		"scripts/startup.sh": 0755,
+	} {
+		info, err := os.Lstat(filepath.Join(dir, file))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, info.Mode().Perm(), file)
+	}
+
+	assert.EqualError(t, setOutputPermissions(filepath.Join(dir, "missing.zip")),
+		fmt.Sprintf("failed to set the permissions of %[1]s: lstat %[1]s: no such file or directory", filepath.Join(dir, "missing.zip")))
+}
+
+func TestReclaimOwnership(t *testing.T) {
+	defer func(f func(string) bool) { hasForeignFiles = f }(hasForeignFiles)
+	defer os.Setenv(MountStrategyEnv, os.Getenv(MountStrategyEnv))
+	os.Setenv(MountStrategyEnv, MountBind)
+	hasForeignFiles = func(dir string) bool { return dir == "/tmp/autogen" }
+
+	runner := &fakeContainerRunner{images: map[string]bool{"gcr.io/cloud-marketplace-tools/dm/autogen": true}}
+	defer useFakeContainerRunner(runner)()
+	cp := newContainerProcess(&testingexec.FakeExec{}, "gcr.io/cloud-marketplace-tools/dm/autogen", []string{"--output", "/tmp/out"}, []mount{
+		&bindMount{src: "/tmp/autogen", dst: "/tmp/out"},
+		&bindMount{src: "/tmp/autogenInput", dst: "/autogen"},
+		&bindMount{src: "/tmp/credentials", dst: "/mpdev/credentials", readOnly: true},
+	})
+
+	assert.NoError(t, cp.run(ioutil.Discard, ioutil.Discard))
+	assert.Len(t, runner.runs, 2)
+	assert.Equal(t, ContainerSpec{
+		Name:       cp.name + "-chown",
+		Image:      "gcr.io/cloud-marketplace-tools/dm/autogen",
+		User:       "0:0",
+		Entrypoint: "sh",
+		Args:       []string{"-c", reclaimScript, "sh", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()), "/tmp/out"},
+		Mounts:     []dockerMount{{Type: "bind", Source: "/tmp/autogen", Target: "/tmp/out"}},
+	}, runner.runs[1])
+	assert.Equal(t, []string{cp.name + "-chown", cp.name}, runner.removed)
+
+	runner.runs, runner.removed = nil, nil
+	hasForeignFiles = func(string) bool { return false }
+	assert.NoError(t, cp.run(ioutil.Discard, ioutil.Discard))
+	assert.Len(t, runner.runs, 1)
+}
+
+func TestOwnedBy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("files do not have a numeric owner on Windows")
+	}
+	dir, err := ioutil.TempDir("", "owned")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.Symlink("/", filepath.Join(dir, "root")))
+	info, err := os.Lstat(filepath.Join(dir, "root"))
+	assert.NoError(t, err)
+
+	assert.True(t, ownedBy(info, os.Getuid()), "the link is owned by the current user, not the owner of its target")
+	assert.False(t, ownedBy(info, os.Getuid()+1))
+}
@@ -0,0 +1,306 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// OverlayFile is the file that makes a directory an overlay.
+const OverlayFile = "overlay.yaml"
+
+// Overlay patches the resources of its bases, such that the configuration
+// of an environment only contains what differs from the shared base.
+type Overlay struct {
+	// Bases are configuration files, directories searched for configuration
+	// files, or other overlays, relative to the overlay directory.
+	Bases []string `yaml:"bases"`
+	// Patches are files, relative to the overlay directory, containing
+	// strategic merge patches of the resources of the bases. Each patch
+	// selects the resource it patches with its kind and metadata.name, and
+	// its apiVersion if kinds of several groups have the same name.
+	// Relative paths set by a patch are relative to the overlay directory.
+	Patches []string `yaml:"patches"`
+}
+
+// OverlayResource is a resource built from an overlay.
+type OverlayResource struct {
+	Object Unstructured
+	// Dir is the directory that relative paths in the resource are
+	// resolved against, which is the directory of the base file that
+	// defines the resource.
+	Dir string
+	// PatchDirs are the directories that the relative paths set by
+	// patches are resolved against instead, by path.
+	PatchDirs map[string]string
+}
+
+// IsOverlay returns whether path is an overlay directory.
+func IsOverlay(path string) bool {
+	info, err := os.Stat(filepath.Join(path, OverlayFile))
+	return err == nil && !info.IsDir()
+}
+
+// BuildOverlay returns the resources of the bases of the overlay in dir,
+// with its patches applied.
+func BuildOverlay(dir string) ([]OverlayResource, error) {
+	return buildOverlay(dir, nil)
+}
+
+// buildOverlay builds the overlay in dir. parents are the overlays that
+// have dir as a base, to detect cycles.
+func buildOverlay(dir string, parents []string) ([]OverlayResource, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, parent := range parents {
+		if parent == abs {
+			return nil, fmt.Errorf("overlay %s is its own base", dir)
+		}
+	}
+	parents = append(parents, abs)
+
+	overlayFile := filepath.Join(dir, OverlayFile)
+	overlay, err := readOverlay(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(overlay.Bases) == 0 {
+		return nil, fmt.Errorf("%s must contain at least one base", overlayFile)
+	}
+
+	var resources []OverlayResource
+	for _, base := range overlay.Bases {
+		baseResources, err := loadBase(filepath.Join(dir, base), parents)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load base %s of %s", base, overlayFile)
+		}
+		resources = append(resources, baseResources...)
+	}
+
+	for _, file := range overlay.Patches {
+		path := filepath.Join(dir, file)
+		patches, err := decodeLintFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse patch %s", path)
+		}
+		for _, patch := range patches {
+			if err := applyPatch(resources, patch, dir); err != nil {
+				return nil, errors.Wrapf(err, "failed to apply patch in %s", path)
+			}
+		}
+	}
+	return resources, nil
+}
+
+// readOverlay reads the overlay file of the overlay in dir.
+func readOverlay(dir string) (*Overlay, error) {
+	overlayFile := filepath.Join(dir, OverlayFile)
+	b, err := ioutil.ReadFile(overlayFile)
+	if err != nil {
+		return nil, err
+	}
+	overlay := &Overlay{}
+	if err := yaml.Unmarshal(b, overlay); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", overlayFile)
+	}
+	return overlay, nil
+}
+
+// loadBase returns the mpdev resources of a base, which is a file, a
+// directory or an overlay.
+func loadBase(path string, parents []string) ([]OverlayResource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if IsOverlay(path) {
+		return buildOverlay(path, parents)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		files, err = FindConfigFiles(path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var resources []OverlayResource
+	for _, file := range files {
+		if IsOverlay(file) {
+			overlayResources, err := buildOverlay(file, parents)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, overlayResources...)
+			continue
+		}
+		objs, err := decodeLintFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", file)
+		}
+		for _, obj := range objs {
+			if IsResource(obj) {
+				resources = append(resources, OverlayResource{Object: obj, Dir: filepath.Dir(file)})
+			}
+		}
+	}
+	return resources, nil
+}
+
+// applyPatch merges patch into the resource with the same kind and name,
+// and apiVersion if the patch sets it. The relative paths set by the patch
+// are resolved against dir, the directory of the overlay.
+func applyPatch(resources []OverlayResource, patch Unstructured, dir string) error {
+	// Patches may omit the apiVersion of the resource they patch.
+	apiVersion, _ := patch["apiVersion"].(string)
+	kind, _ := patch["kind"].(string)
+	name := metadataName(patch)
+	if kind == "" || name == "" {
+		return errors.New("patch must set kind and metadata.name")
+	}
+	target := -1
+	for i, rs := range resources {
+		if rs.Object["kind"] != kind || metadataName(rs.Object) != name {
+			continue
+		}
+		if apiVersion != "" && rs.Object["apiVersion"] != apiVersion {
+			continue
+		}
+		if target >= 0 {
+			return fmt.Errorf("patch of %s/%s matches several resources of the bases, set its apiVersion to select one", kind, name)
+		}
+		target = i
+	}
+	if target < 0 {
+		return fmt.Errorf("patch of %s/%s matches no resource of the bases", kind, name)
+	}
+
+	rs := &resources[target]
+	rs.Object = mergePatch(rs.Object, patch).(map[string]interface{})
+	if rs.PatchDirs == nil {
+		rs.PatchDirs = map[string]string{}
+	}
+	for key, value := range patch {
+		// The fields selecting the resource are not paths.
+		if key != "apiVersion" && key != "kind" && key != "metadata" {
+			addPatchDirs(rs.PatchDirs, value, dir)
+		}
+	}
+	return nil
+}
+
+// addPatchDirs records dir as the directory of the strings in patch that
+// may be relative paths. Which strings are paths is only known when they
+// are resolved, so every string that is not an absolute path or a URL is
+// recorded.
+func addPatchDirs(dirs map[string]string, patch interface{}, dir string) {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		for _, value := range p {
+			addPatchDirs(dirs, value, dir)
+		}
+	case []interface{}:
+		for _, item := range p {
+			addPatchDirs(dirs, item, dir)
+		}
+	case string:
+		if p != "" && !filepath.IsAbs(p) && !strings.Contains(p, "://") {
+			dirs[p] = dir
+		}
+	}
+}
+
+func metadataName(obj Unstructured) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// mergePatch returns the result of merging patch into obj, following the
+// rules of strategic merge patches: maps are merged recursively, a null
+// value deletes a field, lists of maps that all have a name are merged by
+// name, and other values, including other lists, are replaced.
+func mergePatch(obj interface{}, patch interface{}) interface{} {
+	switch p := patch.(type) {
+	case Unstructured:
+		return mergePatch(obj, map[string]interface{}(p))
+	case map[string]interface{}:
+		var o map[string]interface{}
+		switch v := obj.(type) {
+		case Unstructured:
+			o = v
+		case map[string]interface{}:
+			o = v
+		}
+		merged := map[string]interface{}{}
+		for key, value := range o {
+			merged[key] = value
+		}
+		for key, value := range p {
+			if value == nil {
+				delete(merged, key)
+				continue
+			}
+			merged[key] = mergePatch(merged[key], value)
+		}
+		return merged
+	case []interface{}:
+		o, ok := obj.([]interface{})
+		if !ok || !namedList(o) || !namedList(p) {
+			return p
+		}
+		merged := append([]interface{}{}, o...)
+		for _, item := range p {
+			name := item.(map[string]interface{})["name"]
+			found := false
+			for i, existing := range merged {
+				if existing.(map[string]interface{})["name"] == name {
+					merged[i] = mergePatch(existing, item)
+					found = true
+					break
+				}
+			}
+			if !found {
+				merged = append(merged, item)
+			}
+		}
+		return merged
+	default:
+		return patch
+	}
+}
+
+// namedList returns whether list only contains maps with a string name.
+func namedList(list []interface{}) bool {
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if name, ok := m["name"].(string); !ok || strings.TrimSpace(name) == "" {
+			return false
+		}
+	}
+	return len(list) > 0
+}
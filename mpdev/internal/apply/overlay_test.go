@@ -0,0 +1,206 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildOverlay(t *testing.T) {
+	base := `apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerTemplate
+metadata:
+  name: dmtemplate
+deploymentManagerRef:
+  name: autogen
+zipFilePath: gs://staging-bucket/solution.zip
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: ContainerImage
+metadata:
+  name: image
+context: .
+image: gcr.io/staging/image:latest
+env:
+- name: VERSION
+  value: dev
+- name: CHANNEL
+  value: beta
+`
+
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		dir      string
+		expected map[string]map[string]interface{}
+		// expectedPatchDirs are the directories of the paths set by
+		// patches, relative to the test directory, by resource name
+		expectedPatchDirs map[string]map[string]string
+		expectedErr       string
+	}{{
+		name: "Patch base",
+		files: map[string]string{
+			"base/configurations.yaml": base,
+			"prod/overlay.yaml":        "bases:\n- ../base\npatches:\n- patches.yaml\n",
+			"prod/patches.yaml": `kind: DeploymentManagerTemplate
+metadata:
+  name: dmtemplate
+zipFilePath: gs://prod-bucket/solution.zip
+---
+kind: ContainerImage
+metadata:
+  name: image
+image: gcr.io/prod/image:1.0
+env:
+- name: VERSION
+  value: "1.0"
+context: null
+`,
+		},
+		dir: "prod",
+		expected: map[string]map[string]interface{}{
+			"dmtemplate": {"zipFilePath": "gs://prod-bucket/solution.zip", "deploymentManagerRef": map[string]interface{}{"name": "autogen"}},
+			"image": {
+				"image": "gcr.io/prod/image:1.0",
+				"env": []interface{}{
+					map[string]interface{}{"name": "VERSION", "value": "1.0"},
+					map[string]interface{}{"name": "CHANNEL", "value": "beta"},
+				},
+				"context": nil,
+			},
+		},
+	}, {
+		name: "Overlay of overlay",
+		files: map[string]string{
+			"base/configurations.yaml": base,
+			"staging/overlay.yaml":     "bases:\n- ../base/configurations.yaml\n",
+			"canary/overlay.yaml":      "bases:\n- ../staging\npatches:\n- patches.yaml\n",
+			"canary/patches.yaml":      "kind: ContainerImage\nmetadata:\n  name: image\nimage: gcr.io/staging/image:canary\n",
+		},
+		dir: "canary",
+		expected: map[string]map[string]interface{}{
+			"dmtemplate": {"zipFilePath": "gs://staging-bucket/solution.zip"},
+			"image":      {"image": "gcr.io/staging/image:canary", "context": "."},
+		},
+	}, {
+		name: "Patch paths",
+		files: map[string]string{
+			"base/configurations.yaml": base,
+			"prod/overlay.yaml":        "bases:\n- ../base\npatches:\n- patches.yaml\n",
+			"prod/patches.yaml":        "kind: ContainerImage\nmetadata:\n  name: image\ncontext: ../prod-context\n",
+		},
+		dir: "prod",
+		expected: map[string]map[string]interface{}{
+			"dmtemplate": {"zipFilePath": "gs://staging-bucket/solution.zip"},
+			"image":      {"context": "../prod-context"},
+		},
+		expectedPatchDirs: map[string]map[string]string{
+			"image": {"../prod-context": "prod"},
+		},
+	}, {
+		name: "Patch with apiVersion",
+		files: map[string]string{
+			"base/configurations.yaml": base + "---\napiVersion: dev.marketplace.cloud.google.com/v1beta1\nkind: ContainerImage\nmetadata:\n  name: image\n",
+			"prod/overlay.yaml":        "bases:\n- ../base\npatches:\n- patches.yaml\n",
+			"prod/patches.yaml":        "apiVersion: dev.marketplace.cloud.google.com/v1beta1\nkind: ContainerImage\nmetadata:\n  name: image\nimage: gcr.io/prod/image:1.0\n",
+		},
+		dir: "prod",
+		expected: map[string]map[string]interface{}{
+			"dmtemplate": {"zipFilePath": "gs://staging-bucket/solution.zip"},
+			// Both images have the same name, the patched one is last.
+			"image": {"image": "gcr.io/prod/image:1.0"},
+		},
+	}, {
+		name: "Ambiguous patch",
+		files: map[string]string{
+			"base/configurations.yaml": base + "---\napiVersion: dev.marketplace.cloud.google.com/v1beta1\nkind: ContainerImage\nmetadata:\n  name: image\n",
+			"prod/overlay.yaml":        "bases:\n- ../base\npatches:\n- patches.yaml\n",
+			"prod/patches.yaml":        "kind: ContainerImage\nmetadata:\n  name: image\nimage: gcr.io/prod/image:1.0\n",
+		},
+		dir:         "prod",
+		expectedErr: "patch of ContainerImage/image matches several resources of the bases, set its apiVersion to select one",
+	}, {
+		name: "Patch without target",
+		files: map[string]string{
+			"base/configurations.yaml": base,
+			"prod/overlay.yaml":        "bases:\n- ../base\npatches:\n- patches.yaml\n",
+			"prod/patches.yaml":        "kind: HelmChart\nmetadata:\n  name: chart\n",
+		},
+		dir:         "prod",
+		expectedErr: "patch of HelmChart/chart matches no resource of the bases",
+	}, {
+		name: "Cycle",
+		files: map[string]string{
+			"a/overlay.yaml": "bases:\n- ../b\n",
+			"b/overlay.yaml": "bases:\n- ../a\n",
+		},
+		dir:         "a",
+		expectedErr: "is its own base",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "overlay")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			for name, contents := range tc.files {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+			}
+
+			resources, err := BuildOverlay(filepath.Join(dir, tc.dir))
+			if tc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			names := map[string]bool{}
+			for _, rs := range resources {
+				names[metadataName(rs.Object)] = true
+			}
+			assert.Len(t, names, len(tc.expected))
+			fields := map[string]map[string]interface{}{}
+			for _, rs := range resources {
+				assert.Equal(t, filepath.Join(dir, "base"), rs.Dir)
+				fields[metadataName(rs.Object)] = rs.Object
+			}
+			for name, expected := range tc.expected {
+				for field, value := range expected {
+					assert.Equal(t, value, fields[name][field], field)
+				}
+			}
+			for _, rs := range resources {
+				expectedDirs, ok := tc.expectedPatchDirs[metadataName(rs.Object)]
+				if !ok {
+					continue
+				}
+				dirs := map[string]string{}
+				for path, d := range rs.PatchDirs {
+					rel, err := filepath.Rel(dir, d)
+					assert.NoError(t, err)
+					dirs[path] = rel
+				}
+				assert.Equal(t, expectedDirs, dirs)
+			}
+		})
+	}
+}
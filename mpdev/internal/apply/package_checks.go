@@ -0,0 +1,337 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// manifestSuffix is appended to the path of an archive to get the path of
+// its manifest.
+const manifestSuffix = ".manifest.yaml"
+
+// defaultPackageSizeLimit is the maximum size of a deployment package
+// accepted by Marketplace.
+const defaultPackageSizeLimit = 10 * 1024 * 1024
+
+// checkPackageContents verifies that a Deployment Manager template directory
+// contains the files required by Marketplace: a top-level .jinja or .py
+// template with a matching .schema and .display file. All missing or
+// misnamed files are reported in the returned error.
+func checkPackageContents(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]bool{}
+	for _, info := range infos {
+		if !info.IsDir() {
+			files[info.Name()] = true
+		}
+	}
+
+	var templates []string
+	for name := range files {
+		if isTemplateFile(name) {
+			templates = append(templates, name)
+		}
+	}
+	sort.Strings(templates)
+
+	var problems []string
+	if len(templates) == 0 {
+		problems = append(problems, "no top-level .jinja or .py template found")
+	}
+
+	// The main template is the one with a schema. Other templates are
+	// imported by it and don't require a schema or display file.
+	mainTemplates := 0
+	for _, template := range templates {
+		if !files[template+".schema"] {
+			continue
+		}
+		mainTemplates++
+		if !files[template+".display"] {
+			problems = append(problems, fmt.Sprintf("missing display metadata %s.display for template %s", template, template))
+		}
+	}
+	if len(templates) > 0 && mainTemplates == 0 {
+		problems = append(problems, fmt.Sprintf("missing schema for template. Expected one of: %s", suffixAll(templates, ".schema")))
+	}
+
+	for name := range files {
+		for _, ext := range []string{".schema", ".display"} {
+			if !strings.HasSuffix(name, ext) {
+				continue
+			}
+			template := strings.TrimSuffix(name, ext)
+			if files[template] {
+				continue
+			}
+			problem := fmt.Sprintf("%s does not match any template", name)
+			for _, t := range templates {
+				if strings.TrimSuffix(t, filepath.Ext(t)) == template {
+					problem = fmt.Sprintf("%s is misnamed, expected %s%s", name, t, ext)
+				}
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("DM template in %s failed pre-flight checks:\n  - %s", dir, strings.Join(problems, "\n  - "))
+}
+
+// findMainTemplate returns the path of the top-level template with a
+// schema in a Deployment Manager template directory.
+func findMainTemplate(dir string) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	files := map[string]bool{}
+	for _, info := range infos {
+		files[info.Name()] = !info.IsDir()
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if files[name] && isTemplateFile(name) && files[name+".schema"] {
+			return filepath.Join(dir, name), nil
+		}
+	}
+	return "", fmt.Errorf("no top-level template with a schema found in %s", dir)
+}
+
+func isTemplateFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".jinja" || ext == ".py"
+}
+
+func suffixAll(names []string, suffix string) string {
+	suffixed := make([]string, 0, len(names))
+	for _, name := range names {
+		suffixed = append(suffixed, name+suffix)
+	}
+	return strings.Join(suffixed, ", ")
+}
+
+// packageSize describes the size of an archived Deployment Manager template.
+type packageSize struct {
+	archiveBytes int64
+	// dirBytes is the uncompressed size of each top-level directory of the
+	// template. Files at the root of the template are counted under ".".
+	dirBytes map[string]int64
+}
+
+// analyzePackageSize computes the size of archive, and the size of each
+// top-level directory of the template directory that was archived.
+func analyzePackageSize(archive string, dir string) (*packageSize, error) {
+	info, err := os.Stat(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	size := &packageSize{archiveBytes: info.Size(), dirBytes: map[string]int64{}}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || path == archive {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		topLevel := "."
+		if parts := strings.SplitN(filepath.ToSlash(rel), "/", 2); len(parts) == 2 {
+			topLevel = parts[0]
+		}
+		size.dirBytes[topLevel] += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return size, nil
+}
+
+// report prints the archive size and the size of each directory, largest
+// first.
+func (p *packageSize) report(limit int64) {
+	fmt.Printf("DM template archive size: %s (limit %s)\n", formatBytes(p.archiveBytes), formatBytes(limit))
+
+	dirs := make([]string, 0, len(p.dirBytes))
+	for dir := range p.dirBytes {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if p.dirBytes[dirs[i]] != p.dirBytes[dirs[j]] {
+			return p.dirBytes[dirs[i]] > p.dirBytes[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	fmt.Printf("Uncompressed size by directory:\n")
+	for _, dir := range dirs {
+		fmt.Printf("  %-30s %s\n", dir, formatBytes(p.dirBytes[dir]))
+	}
+}
+
+// formatBytes formats a number of bytes using binary units.
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// packageManifest lists the contents of an archived Deployment Manager
+// template, such that package contents can be compared between releases
+// without extracting the archive.
+type packageManifest struct {
+	Archive       string         `yaml:"archive"`
+	ArchiveSHA256 string         `yaml:"archiveSha256"`
+	Files         []manifestFile `yaml:"files"`
+}
+
+type manifestFile struct {
+	Path   string `yaml:"path"`
+	Size   int64  `yaml:"size"`
+	SHA256 string `yaml:"sha256"`
+}
+
+// writePackageManifest writes the manifest of archive, which contains the
+// files of dir, to manifestPath. The archive and manifest are excluded from
+// the list of files if they are inside dir.
+func writePackageManifest(manifestPath string, archive string, dir string) error {
+	archiveHash, err := hashFile(archive)
+	if err != nil {
+		return err
+	}
+	manifest := packageManifest{Archive: filepath.Base(archive), ArchiveSHA256: archiveHash, Files: []manifestFile{}}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || path == archive || path == manifestPath {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, manifestFile{Path: filepath.ToSlash(rel), Size: info.Size(), SHA256: hash})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(f)
+	err = enc.Encode(manifest)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// hashFile returns the hex encoded SHA-256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashPackage returns a digest of the relative paths and contents of the
+// files in dir, excluding the given paths, along with any extra values
+// that affect how the package is saved.
+func hashPackage(dir string, exclude []string, extra ...string) (string, error) {
+	excluded := map[string]bool{}
+	for _, path := range exclude {
+		excluded[path] = true
+	}
+
+	h := sha256.New()
+	for _, value := range extra {
+		fmt.Fprintf(h, "%s\n", value)
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || excluded[path] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %s\n", filepath.ToSlash(rel), hash)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
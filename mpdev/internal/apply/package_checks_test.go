@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckPackageContents(t *testing.T) {
+	testCases := []struct {
+		name             string
+		files            []string
+		expectedProblems []string
+	}{{
+		name:  "Jinja template",
+		files: []string{"wordpress.jinja", "wordpress.jinja.schema", "wordpress.jinja.display", "wordpress_vm.jinja", "test_config.yaml"},
+	}, {
+		name:  "Python template",
+		files: []string{"wordpress.py", "wordpress.py.schema", "wordpress.py.display"},
+	}, {
+		name:             "No template",
+		files:            []string{"test_config.yaml"},
+		expectedProblems: []string{"no top-level .jinja or .py template found"},
+	}, {
+		name:             "Missing schema",
+		files:            []string{"wordpress.jinja", "wordpress.jinja.display"},
+		expectedProblems: []string{"missing schema for template. Expected one of: wordpress.jinja.schema"},
+	}, {
+		name:             "Missing display",
+		files:            []string{"wordpress.jinja", "wordpress.jinja.schema"},
+		expectedProblems: []string{"missing display metadata wordpress.jinja.display for template wordpress.jinja"},
+	}, {
+		name:  "Misnamed files",
+		files: []string{"wordpress.jinja", "wordpress.schema", "wordpress.display", "other.schema"},
+		expectedProblems: []string{
+			"missing schema for template. Expected one of: wordpress.jinja.schema",
+			"other.schema does not match any template",
+			"wordpress.display is misnamed, expected wordpress.jinja.display",
+			"wordpress.schema is misnamed, expected wordpress.jinja.schema",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "preflight")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for _, name := range tc.files {
+				err = ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+				assert.NoError(t, err)
+			}
+
+			err = checkPackageContents(dir)
+			if len(tc.expectedProblems) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			for _, problem := range tc.expectedProblems {
+				assert.Contains(t, err.Error(), "  - "+problem)
+			}
+		})
+	}
+}
+
+func TestAnalyzePackageSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "packagesize")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]int{
+		"solution.jinja":         100,
+		"resources/en-us/a.png":  2048,
+		"resources/en-us/b.png":  1024,
+		"scripts/startup.sh":     10,
+		"dm_template.zip":        1500,
+		"solution.jinja.schema":  20,
+		"solution.jinja.display": 30,
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, make([]byte, size), 0644))
+	}
+
+	size, err := analyzePackageSize(filepath.Join(dir, "dm_template.zip"), dir)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), size.archiveBytes)
+	assert.Equal(t, map[string]int64{
+		".":         150,
+		"resources": 3072,
+		"scripts":   10,
+	}, size.dirBytes)
+}
+
+func TestFormatBytes(t *testing.T) {
+	testCases := map[int64]string{
+		512:              "512 B",
+		1536:             "1.5 KiB",
+		10 * 1024 * 1024: "10.0 MiB",
+	}
+	for b, expected := range testCases {
+		assert.Equal(t, expected, formatBytes(b))
+	}
+}
+
+func TestWritePackageManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"solution.jinja":        "resources: []",
+		"resources/en-us/a.png": "png",
+		"dm_template.zip":       "archive",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	archive := filepath.Join(dir, "dm_template.zip")
+	manifestPath := archive + manifestSuffix
+	err = writePackageManifest(manifestPath, archive, dir)
+	assert.NoError(t, err)
+
+	b, err := ioutil.ReadFile(manifestPath)
+	assert.NoError(t, err)
+	var manifest packageManifest
+	assert.NoError(t, yaml.Unmarshal(b, &manifest))
+
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	assert.Equal(t, packageManifest{
+		Archive:       "dm_template.zip",
+		ArchiveSHA256: sha("archive"),
+		Files: []manifestFile{
+			{Path: "resources/en-us/a.png", Size: 3, SHA256: sha("png")},
+			{Path: "solution.jinja", Size: 13, SHA256: sha("resources: []")},
+		},
+	}, manifest)
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// SetParallelism sets the maximum number of resources that are applied at
+// once. Resources are only applied once all their dependencies have been
+// applied.
+func (r *registry) SetParallelism(n int) {
+	if n < 1 {
+		n = 1
+	}
+	r.parallelism = n
+}
+
+// appliedResource is the result of applying a resource.
+type appliedResource struct {
+	resource Resource
+	start    time.Time
+	err      error
+}
+
+// applyResources applies resources, which are sorted topologically, with up
+// to parallelism resources applied at once. A resource is started once all
+// its dependencies have been applied, in the order of resources. Errors are
+// accumulated in dry run mode. Otherwise, no resource is started after a
+// resource fails, and the first error is returned once the resources being
+// applied finish. No resource is started either once the context of the
+// executor is done.
+func (r *registry) applyResources(resources []Resource, dryRun bool, summary *RunSummary) (err error) {
+	// remaining counts the dependencies of each resource that have not been
+	// applied yet. Dependencies that are not in resources were applied
+	// before.
+	remaining := map[Reference]int{}
+	dependents := map[Reference][]Reference{}
+	included := map[Reference]bool{}
+	for _, resource := range resources {
+		included[resource.GetReference()] = true
+	}
+	for _, resource := range resources {
+		ref := resource.GetReference()
+		for _, dep := range resource.GetDependencies() {
+			if !included[dep] {
+				continue
+			}
+			remaining[ref]++
+			dependents[dep] = append(dependents[dep], ref)
+		}
+	}
+
+	ctx := executorContext(r.executor)
+	started := make([]bool, len(resources))
+	results := make(chan appliedResource)
+	running := 0
+	pending := len(resources)
+	failed := false
+	for {
+		for i, resource := range resources {
+			if running >= r.parallelism || failed || ctx.Err() != nil {
+				break
+			}
+			if started[i] || remaining[resource.GetReference()] > 0 {
+				continue
+			}
+			started[i] = true
+			running++
+			pending--
+			go func(resource Resource) {
+				fmt.Printf("Starting to validate/create resource %+v\n", resource.GetReference())
+				start := time.Now()
+				applyErr := resource.Apply(r.forResource(resource), dryRun)
+				results <- appliedResource{resource: resource, start: start, err: applyErr}
+			}(resource)
+		}
+		if running == 0 {
+			if err == nil && pending > 0 && ctx.Err() != nil {
+				err = fmt.Errorf("%d resources were not applied", pending)
+			}
+			return canceled(ctx, err)
+		}
+
+		result := <-results
+		running--
+		ref := result.resource.GetReference()
+		if _, ok := result.resource.(notifier); !ok {
+			rs := ResourceSummary{
+				Reference: ref,
+				Status:    "succeeded",
+				Duration:  time.Since(result.start).Round(time.Millisecond).String(),
+				Outputs:   r.GetOutputs(ref),
+			}
+			if result.err != nil {
+				rs.Status = "failed"
+				rs.Error = result.err.Error()
+				fmt.Println(Red(fmt.Sprintf("Resource %+v failed after %s", ref, rs.Duration)))
+			} else {
+				fmt.Println(Green(fmt.Sprintf("Resource %+v succeeded in %s", ref, rs.Duration)))
+			}
+			if reporter, ok := result.resource.(checkReporter); ok {
+				rs.Checks = reporter.checkResults()
+			}
+			summary.Resources = append(summary.Resources, rs)
+		}
+		if result.err != nil {
+			applyErr := errors.Wrapf(result.err, "Error in resource %+v\n", ref)
+			// Failures of a dry run and of a verification resource are
+			// validation and verification failures, unless they already
+			// are in a class such as auth or validation
+			code := ExitCode(applyErr)
+			if dryRun && code == ExitFailure {
+				applyErr = ValidationError(applyErr)
+			} else if !dryRun && IsVerification(result.resource) && (code == ExitFailure || code == ExitTool) {
+				applyErr = VerificationError(applyErr)
+			}
+			// Accumulate errors if dryRun
+			if dryRun {
+				err = multierror.Append(applyErr, err)
+			} else if !failed {
+				failed = true
+				err = applyErr
+			}
+		}
+		for _, dependent := range dependents[ref] {
+			remaining[dependent]--
+		}
+	}
+}
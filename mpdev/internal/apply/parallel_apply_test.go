@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+)
+
+func TestApplyParallelism(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var applied []string
+	applyFunc := func(name string) func(r Registry, dryRun bool) error {
+		return func(Registry, bool) error {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			applied = append(applied, name)
+			mu.Unlock()
+			return nil
+		}
+	}
+	depFunc := func(resources ...Resource) func() []Reference {
+		return func() (refs []Reference) {
+			for _, r := range resources {
+				refs = append(refs, r.GetReference())
+			}
+			return refs
+		}
+	}
+
+	r1 := newTestResourceFunc("r1", applyFunc("r1"), nil)
+	r2 := newTestResourceFunc("r2", applyFunc("r2"), depFunc(r1))
+	r3 := newTestResourceFunc("r3", applyFunc("r3"), depFunc(r1))
+	r4 := newTestResourceFunc("r4", applyFunc("r4"), depFunc(r1))
+	r5 := newTestResourceFunc("r5", applyFunc("r5"), depFunc(r2, r3, r4))
+
+	registry := NewRegistry(exec.New())
+	for _, r := range []Resource{r1, r2, r3, r4, r5} {
+		registry.RegisterResource(r, "dirpath")
+	}
+	registry.SetParallelism(2)
+
+	err := registry.Apply(true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, maxRunning)
+	assert.Len(t, applied, 5)
+	assert.Equal(t, "r1", applied[0])
+	assert.Equal(t, "r5", applied[4])
+	assert.Len(t, registry.Summary().Resources, 5)
+}
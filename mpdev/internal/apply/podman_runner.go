@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// podmanRunner runs containers with the podman CLI. Its commands are
+// executed with the executor of the resource, such that they are logged and
+// limited like other commands. Rootless podman maps the root user of
+// containers to the current user, which owns the files they write to bind
+// mounts.
+type podmanRunner struct {
+	executor exec.Interface
+}
+
+func (r *podmanRunner) command(ctx context.Context, stdout io.Writer, stderr io.Writer, args ...string) exec.Cmd {
+	cmd := r.executor.CommandContext(ctx, "podman", args...)
+	cmd.SetStdout(stdout)
+	cmd.SetStderr(stderr)
+	return cmd
+}
+
+func (r *podmanRunner) Run(ctx context.Context, spec ContainerSpec, stdout io.Writer, stderr io.Writer) (int, error) {
+	args := []string{"run", "--name", spec.Name}
+	if spec.User != "" {
+		args = append(args, "--user", spec.User)
+	}
+	if spec.Entrypoint != "" {
+		args = append(args, "--entrypoint", spec.Entrypoint)
+	}
+	for _, env := range spec.Env {
+		// Only the names of the variables are passed, such that secrets in
+		// their values are not in the arguments of the command, which are
+		// logged. podman reads their values from its environment.
+		args = append(args, "--env", strings.SplitN(env, "=", 2)[0])
+	}
+	for _, mount := range spec.Mounts {
+		// The source directories are relabeled, such that the container
+		// can read and write them on hosts where SELinux is enforced.
+		volume := mount.Source + ":" + mount.Target + ":Z"
+		if mount.ReadOnly {
+			volume = mount.Source + ":" + mount.Target + ":ro,Z"
+		}
+		args = append(args, "--volume", volume)
+	}
+	args = append(append(args, spec.Image), spec.Args...)
+	cmd := r.command(ctx, stdout, stderr, args...)
+	if len(spec.Env) > 0 {
+		cmd.SetEnv(append(os.Environ(), spec.Env...))
+	}
+	err := cmd.Run()
+	if e, ok := errors.Cause(err).(exec.ExitError); ok && ctx.Err() == nil {
+		return e.ExitStatus(), nil
+	}
+	return 0, err
+}
+
+// Pull pulls image. podman reads the credentials of the docker CLI
+// configuration itself, and those configured with UseRegistryAuth are
+// passed in a temporary auth file.
+func (r *podmanRunner) Pull(ctx context.Context, image string) error {
+	fmt.Printf("Pulling image %s\n", image)
+	args := []string{"pull"}
+	if _, ok := registryAuths[registryOf(image)]; ok {
+		authFile, err := r.writeAuthFile(image)
+		if err != nil {
+			return AuthError(err)
+		}
+		defer os.RemoveAll(filepath.Dir(authFile))
+		args = append(args, "--authfile", authFile)
+	}
+	return errors.Wrapf(r.command(ctx, os.Stdout, os.Stderr, append(args, image)...).Run(), "failed to pull image %s", image)
+}
+
+// writeAuthFile writes the credentials of the registry of image to a
+// auth file in a temporary directory, which only the current user can read.
+func (r *podmanRunner) writeAuthFile(image string) (string, error) {
+	auth, err := registryAuthEntry(r.executor, image)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(map[string]interface{}{"auths": map[string]interface{}{registryOf(image): auth}})
+	if err != nil {
+		return "", err
+	}
+	dir, err := util.CreateTmpDir("podmanAuth")
+	if err != nil {
+		return "", err
+	}
+	authFile := filepath.Join(dir, "auth.json")
+	if err := ioutil.WriteFile(authFile, b, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return authFile, nil
+}
+
+func (r *podmanRunner) ImageExists(ctx context.Context, image string) (bool, error) {
+	err := r.command(ctx, os.Stdout, os.Stderr, "image", "exists", image).Run()
+	if e, ok := errors.Cause(err).(exec.ExitError); ok && e.ExitStatus() == 1 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *podmanRunner) Remove(ctx context.Context, name string) error {
+	return r.command(ctx, ioutil.Discard, os.Stderr, "rm", "--force", "--ignore", name).Run()
+}
+
+func (r *podmanRunner) Build(ctx context.Context, spec BuildSpec, stdout io.Writer, stderr io.Writer) error {
+	return r.command(ctx, stdout, stderr, buildArgs(spec)...).Run()
+}
+
+func (r *podmanRunner) Push(ctx context.Context, image string, stdout io.Writer, stderr io.Writer) error {
+	return r.command(ctx, stdout, stderr, "push", image).Run()
+}
+
+func (r *podmanRunner) RepoDigests(ctx context.Context, image string) ([]string, error) {
+	var stdout bytes.Buffer
+	err := r.command(ctx, &stdout, os.Stderr, "image", "inspect", "--format", "{{json .RepoDigests}}", image).Run()
+	if err != nil {
+		return nil, err
+	}
+	var digests []string
+	err = json.Unmarshal(stdout.Bytes(), &digests)
+	return digests, errors.Wrapf(err, "failed to inspect image %s", image)
+}
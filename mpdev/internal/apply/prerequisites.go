@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/utils/exec"
+)
+
+// requiredTools returns the executables that a resource runs when it is
+// applied, such that missing tools are reported before any resource is
+// applied.
+func requiredTools(resource Resource) []string {
+	switch rs := resource.(type) {
+	case *ContainerImage:
+		return []string{containerRuntime}
+	case *K8sAppDeployer:
+		tools := []string{containerRuntime}
+		if rs.Flavor == helmDeployerFlavor {
+			tools = append(tools, "tar")
+		}
+		if rs.VulnerabilityScan != nil {
+			if rs.VulnerabilityScan.scanner() == trivyScanner {
+				tools = append(tools, "trivy")
+			} else {
+				tools = append(tools, "gcloud")
+			}
+		}
+		return tools
+	case *DeploymentManagerAutogenTemplate:
+		return []string{containerRuntime}
+	case *DeploymentManagerTemplate:
+		return rs.requiredTools()
+	case *HelmChart:
+		if isGCSPath(rs.Destination) {
+			return []string{"helm", "gsutil"}
+		}
+		return []string{"helm"}
+	case *TerraformModule:
+		if isGCSPath(rs.ZipFilePath) {
+			return []string{"terraform", "zip", "gsutil"}
+		}
+		return []string{"terraform", "zip"}
+	case *ListingAssets:
+		return []string{"gsutil"}
+	case *PackerGceImageBuilder:
+		return []string{"packer"}
+	case *DaisyGceImageBuilder:
+		return []string{"daisy"}
+	case *Notification:
+		if rs.PubSub != nil {
+			return []string{"gcloud", "curl"}
+		}
+		return nil
+	case *DeploymentTest:
+		for _, probe := range rs.Probes {
+			if probe.SSH != nil {
+				return []string{"gcloud"}
+			}
+		}
+		return nil
+	case *SaaSIntegration, *UsageReport:
+		return []string{"gcloud", "curl"}
+	case *DeploymentManagerDeployment:
+		// The cost of deployments is estimated with the billing catalog.
+		if costThreshold != 0 && !costConfirmed {
+			return []string{"gcloud", "curl"}
+		}
+		return []string{"gcloud"}
+	case *GceImage, *GceImageLicenseCheck, *ImageTest, *DeploymentManagerPreview,
+		*DeploymentManagerCompositeType, *IAMPolicy, *OrgPolicyCheck, *QuotaCheck:
+		return []string{"gcloud"}
+	}
+	return nil
+}
+
+// requiredTools returns the executables that archive and upload the
+// template. Native tools replace zip and gsutil, except to sign URLs.
+func (dm *DeploymentManagerTemplate) requiredTools() []string {
+	var tools []string
+	uploaded := false
+	for _, path := range dm.ZipFilePath {
+		uploaded = uploaded || isGCSPath(path)
+	}
+	if dm.ArchiveFormat == tgzArchiveFormat {
+		tools = append(tools, "tar")
+	} else if !useNativeTools {
+		tools = append(tools, "zip")
+	}
+	if uploaded && useNativeTools {
+		tools = append(tools, "gcloud")
+	}
+	if uploaded && (!useNativeTools || dm.SignedURL != nil) {
+		tools = append(tools, "gsutil")
+	}
+	return tools
+}
+
+// checkTools looks up the executables required by resources, and returns a
+// single error listing every missing executable and the resources that
+// need it. Once every executable is found, the versions of gcloud and gsutil
+// are checked.
+func checkTools(executor exec.Interface, resources []Resource) error {
+	neededBy := map[string][]string{}
+	var tools []string
+	for _, resource := range resources {
+		ref := resource.GetReference()
+		for _, tool := range requiredTools(resource) {
+			if _, ok := neededBy[tool]; !ok {
+				tools = append(tools, tool)
+			}
+			neededBy[tool] = append(neededBy[tool], ref.Kind+"/"+ref.Name)
+		}
+	}
+	sort.Strings(tools)
+
+	var missing []string
+	for _, tool := range tools {
+		if _, err := executor.LookPath(tool); err != nil {
+			missing = append(missing, fmt.Sprintf("  %s, needed by %s", tool, strings.Join(neededBy[tool], ", ")))
+		}
+	}
+	if len(missing) == 0 {
+		return checkToolVersions(executor, tools)
+	}
+	return withExitCode(ExitTool, fmt.Errorf("missing tools, install them and run mpdev again, or run `mpdev doctor` for instructions:\n%s",
+		strings.Join(missing, "\n")))
+}
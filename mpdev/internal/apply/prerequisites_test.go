@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func newLookPathFunc(missingTools []string) func(string) (string, error) {
+	return func(file string) (string, error) {
+		if containsString(missingTools, file) {
+			return "", fmt.Errorf("executable file not found in $PATH")
+		}
+		return "/usr/bin/" + file, nil
+	}
+}
+
+func TestCheckTools(t *testing.T) {
+	image := &ContainerImage{BaseResource: newTestBaseResource("ContainerImage", "image")}
+	deployer := &K8sAppDeployer{BaseResource: newTestBaseResource("K8sAppDeployer", "deployer"), Flavor: helmDeployerFlavor}
+	chart := &HelmChart{BaseResource: newTestBaseResource("HelmChart", "chart"), Destination: "gs://bucket/charts"}
+	dm := &DeploymentManagerTemplate{BaseResource: newTestBaseResource("DeploymentManagerTemplate", "dm"),
+		ZipFilePath: StringList{"gs://bucket/dm.zip"}}
+
+	testCases := []struct {
+		name         string
+		resources    []Resource
+		nativeTools  bool
+		missingTools []string
+		errorMatches []string
+	}{{
+		name:      "All tools installed",
+		resources: []Resource{image, deployer, chart, dm},
+	}, {
+		name:         "Missing tools",
+		resources:    []Resource{image, deployer, chart, dm},
+		missingTools: []string{"docker", "gsutil", "zip"},
+		errorMatches: []string{
+			"  docker, needed by ContainerImage/image, K8sAppDeployer/deployer\n",
+			"  gsutil, needed by HelmChart/chart, DeploymentManagerTemplate/dm\n",
+			"  zip, needed by DeploymentManagerTemplate/dm",
+		},
+	}, {
+		name:         "Native upload",
+		resources:    []Resource{dm},
+		nativeTools:  true,
+		missingTools: []string{"zip", "gsutil", "curl"},
+	}, {
+		name:         "Native upload missing gcloud",
+		resources:    []Resource{dm},
+		nativeTools:  true,
+		missingTools: []string{"gcloud"},
+		errorMatches: []string{"  gcloud, needed by DeploymentManagerTemplate/dm"},
+	}, {
+		name:         "Resources without tools",
+		resources:    []Resource{newTestResource("r1")},
+		missingTools: []string{"docker", "gcloud", "gsutil"},
+	}}
+
+	defer func(native bool) { useNativeTools = native }(useNativeTools)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useNativeTools = tc.nativeTools
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{gcloudVersionAction},
+				LookPathFunc:  newLookPathFunc(tc.missingTools),
+			}
+			err := checkTools(executor, tc.resources)
+			if len(tc.errorMatches) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, ExitTool, ExitCode(err))
+			for _, match := range tc.errorMatches {
+				assert.Contains(t, err.Error(), match)
+			}
+		})
+	}
+}
+
+func TestApplyMissingTools(t *testing.T) {
+	r := NewRegistry(&testingexec.FakeExec{LookPathFunc: newLookPathFunc([]string{"docker"})})
+	applied := false
+	r.RegisterResource(newTestResourceFunc("first", func(Registry, bool) error {
+		applied = true
+		return nil
+	}, nil), "")
+	r.RegisterResource(&ContainerImage{BaseResource: newTestBaseResource("ContainerImage", "image")}, "")
+
+	err := r.Apply(false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "docker, needed by ContainerImage/image")
+	assert.False(t, applied, "no resource is applied if tools are missing")
+}
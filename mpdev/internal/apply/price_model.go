@@ -0,0 +1,168 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// currencyRegex matches an ISO 4217 currency code.
+var currencyRegex = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var flatFeePeriods = map[string]bool{"MONTHLY": true, "YEARLY": true}
+
+// PriceModel describes the pricing of a solution, so that it can be checked
+// for consistency before it is entered in Partner Portal. Applying a
+// PriceModel only validates it.
+type PriceModel struct {
+	BaseResource
+	// Currency of all prices, as an ISO 4217 code such as USD
+	Currency string
+	// Skus are the identifiers of the SKUs the solution is billed with.
+	// Every fee must reference one of them.
+	Skus []string
+	// FlatFees are charged once per period
+	FlatFees []FlatFee
+	// UsageFees are charged per unit of a usage metric
+	UsageFees []UsageFee
+}
+
+// FlatFee is a fixed fee charged every period.
+type FlatFee struct {
+	Name string
+	Sku  string
+	// Period is one of MONTHLY or YEARLY
+	Period string
+	Price  float64
+}
+
+// UsageFee is a fee charged for the usage reported for a metric.
+type UsageFee struct {
+	Metric string
+	Sku    string
+	Unit   string
+	// Tiers of prices. The first tier must start at 0 units, and each
+	// following tier must start at more units than the previous one.
+	Tiers []PriceTier
+}
+
+// PriceTier is the price per unit from StartUnits until the start of the
+// next tier.
+type PriceTier struct {
+	StartUnits float64
+	Price      float64
+}
+
+// Apply validates the price model.
+func (p *PriceModel) Apply(registry Registry, dryRun bool) error {
+	problems := p.check()
+	if len(problems) > 0 {
+		return fmt.Errorf("price model %s failed checks:\n  - %s", p.Metadata.Name, strings.Join(problems, "\n  - "))
+	}
+
+	fmt.Printf("Price model %s is valid\n", p.Metadata.Name)
+	return nil
+}
+
+// check returns the problems found in the price model.
+func (p *PriceModel) check() []string {
+	var problems []string
+	if !currencyRegex.MatchString(p.Currency) {
+		problems = append(problems, fmt.Sprintf("invalid currency %q, must be an ISO 4217 code such as USD", p.Currency))
+	}
+	if len(p.FlatFees) == 0 && len(p.UsageFees) == 0 {
+		problems = append(problems, "no flatFees or usageFees are defined")
+	}
+
+	skus := map[string]bool{}
+	for _, sku := range p.Skus {
+		if skus[sku] {
+			problems = append(problems, fmt.Sprintf("sku %s is declared more than once", sku))
+		}
+		skus[sku] = true
+	}
+	referenced := map[string]bool{}
+	checkSku := func(fee string, sku string) {
+		referenced[sku] = true
+		if sku == "" {
+			problems = append(problems, fmt.Sprintf("%s does not reference a sku", fee))
+		} else if !skus[sku] {
+			problems = append(problems, fmt.Sprintf("%s references undeclared sku %s", fee, sku))
+		}
+	}
+
+	for i, fee := range p.FlatFees {
+		name := fmt.Sprintf("flat fee %q", fee.Name)
+		if fee.Name == "" {
+			name = fmt.Sprintf("flat fee %d", i)
+		}
+		checkSku(name, fee.Sku)
+		if !flatFeePeriods[fee.Period] {
+			problems = append(problems, fmt.Sprintf("%s has invalid period %q, must be MONTHLY or YEARLY", name, fee.Period))
+		}
+		if fee.Price < 0 {
+			problems = append(problems, fmt.Sprintf("%s has negative price %v", name, fee.Price))
+		}
+	}
+
+	metrics := map[string]bool{}
+	for i, fee := range p.UsageFees {
+		name := fmt.Sprintf("usage fee for metric %q", fee.Metric)
+		if fee.Metric == "" {
+			name = fmt.Sprintf("usage fee %d", i)
+			problems = append(problems, fmt.Sprintf("%s does not specify a metric", name))
+		} else if metrics[fee.Metric] {
+			problems = append(problems, fmt.Sprintf("metric %s has more than one usage fee", fee.Metric))
+		}
+		metrics[fee.Metric] = true
+		checkSku(name, fee.Sku)
+		if fee.Unit == "" {
+			problems = append(problems, fmt.Sprintf("%s does not specify a unit", name))
+		}
+		problems = append(problems, checkTiers(name, fee.Tiers)...)
+	}
+
+	for _, sku := range p.Skus {
+		if !referenced[sku] {
+			problems = append(problems, fmt.Sprintf("sku %s is not referenced by any fee", sku))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func checkTiers(fee string, tiers []PriceTier) []string {
+	if len(tiers) == 0 {
+		return []string{fmt.Sprintf("%s has no price tiers", fee)}
+	}
+
+	var problems []string
+	if tiers[0].StartUnits != 0 {
+		problems = append(problems, fmt.Sprintf("first price tier of %s must start at 0 units", fee))
+	}
+	for i, tier := range tiers {
+		if tier.Price < 0 {
+			problems = append(problems, fmt.Sprintf("price tier %d of %s has negative price %v", i, fee, tier.Price))
+		}
+		if i > 0 && tier.StartUnits <= tiers[i-1].StartUnits {
+			problems = append(problems, fmt.Sprintf("price tier %d of %s must start at more units than the previous tier", i, fee))
+		}
+	}
+	return problems
+}
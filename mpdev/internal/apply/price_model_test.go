@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestPriceModel(t *testing.T) {
+	testCases := []struct {
+		name             string
+		model            PriceModel
+		expectedProblems []string
+	}{{
+		name: "Valid price model",
+		model: PriceModel{
+			Currency: "USD",
+			Skus:     []string{"base", "requests"},
+			FlatFees: []FlatFee{{Name: "base", Sku: "base", Period: "MONTHLY", Price: 10}},
+			UsageFees: []UsageFee{{
+				Metric: "requests",
+				Sku:    "requests",
+				Unit:   "1000 requests",
+				Tiers:  []PriceTier{{StartUnits: 0, Price: 0.1}, {StartUnits: 1000, Price: 0.05}},
+			}},
+		},
+	}, {
+		name: "Invalid currency and sku references",
+		model: PriceModel{
+			Currency: "usd",
+			Skus:     []string{"base", "unused"},
+			FlatFees: []FlatFee{{Name: "base", Sku: "other", Period: "WEEKLY", Price: -1}},
+		},
+		expectedProblems: []string{
+			`flat fee "base" has invalid period "WEEKLY", must be MONTHLY or YEARLY`,
+			`flat fee "base" has negative price -1`,
+			`flat fee "base" references undeclared sku other`,
+			`invalid currency "usd", must be an ISO 4217 code such as USD`,
+			"sku base is not referenced by any fee",
+			"sku unused is not referenced by any fee",
+		},
+	}, {
+		name: "Invalid tiers",
+		model: PriceModel{
+			Currency: "EUR",
+			Skus:     []string{"cpu"},
+			UsageFees: []UsageFee{
+				{Metric: "cpu", Sku: "cpu", Unit: "hour", Tiers: []PriceTier{{StartUnits: 10, Price: 1}, {StartUnits: 5, Price: 1}}},
+				{Metric: "cpu", Sku: "cpu", Unit: "hour"},
+			},
+		},
+		expectedProblems: []string{
+			"first price tier of usage fee for metric \"cpu\" must start at 0 units",
+			"metric cpu has more than one usage fee",
+			"price tier 1 of usage fee for metric \"cpu\" must start at more units than the previous tier",
+			"usage fee for metric \"cpu\" has no price tiers",
+		},
+	}, {
+		name:             "No fees",
+		model:            PriceModel{Currency: "USD"},
+		expectedProblems: []string{"no flatFees or usageFees are defined"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			model := tc.model
+			model.BaseResource = newTestBaseResource("PriceModel", "pricing")
+			assert.Equal(t, tc.expectedProblems, model.check())
+
+			err := model.Apply(NewRegistry(&testingexec.FakeExec{}), true)
+			if len(tc.expectedProblems) > 0 {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stages of a publish run, in the order they run.
+const (
+	// StageValidate validates all resources, as `apply --dryrun` does
+	StageValidate = "validate"
+	// StageBuild builds images and generates Deployment Manager templates
+	StageBuild = "build"
+	// StagePackage archives templates, charts and modules and saves them to
+	// their destinations
+	StagePackage = "package"
+	// StageUpload publishes images and listing assets
+	StageUpload = "upload"
+	// StageDraft applies the resources that are entered in the Partner
+	// Portal draft of the solution
+	StageDraft = "draft"
+	// StageVerify applies verification resources
+	StageVerify = "verify"
+)
+
+// Stages are the stages of a publish run, in order.
+var Stages = []string{StageValidate, StageBuild, StagePackage, StageUpload, StageDraft, StageVerify}
+
+// stageKinds are the stages of the kinds of resources that are not
+// verification resources. Other kinds are in the build stage.
+var stageKinds = map[string]string{
+	"ContainerImage":                   StageBuild,
+	"DaisyGceImageBuilder":             StageBuild,
+	"DeploymentManagerAutogenTemplate": StageBuild,
+	"K8sAppDeployer":                   StageBuild,
+	"PackerGceImageBuilder":            StageBuild,
+	"DeploymentManagerTemplate":        StagePackage,
+	"HelmChart":                        StagePackage,
+	"TerraformModule":                  StagePackage,
+	"DeploymentManagerCompositeType":   StageUpload,
+	"GceImage":                         StageUpload,
+	"IAMPolicy":                        StageUpload,
+	"ListingAssets":                    StageUpload,
+	"PriceModel":                       StageDraft,
+	"SaaSIntegration":                  StageDraft,
+	"DeploymentTest":                   StageVerify,
+	"UsageReport":                      StageVerify,
+}
+
+// StageOf returns the publish stage that rs is applied in.
+func StageOf(rs Resource) string {
+	if IsVerification(rs) {
+		return StageVerify
+	}
+	if stage, ok := stageKinds[rs.GetReference().Kind]; ok {
+		return stage
+	}
+	return StageBuild
+}
+
+// stageRange returns the stages from the stage from to the stage until,
+// which default to the first and last stages.
+func stageRange(from string, until string) ([]string, error) {
+	first, last := 0, len(Stages)-1
+	for i, stage := range Stages {
+		if stage == from {
+			first = i
+		}
+		if stage == until {
+			last = i
+		}
+	}
+	for _, stage := range []string{from, until} {
+		if stage != "" && !isStage(stage) {
+			return nil, fmt.Errorf("unknown stage %s. Must be one of %s", stage, strings.Join(Stages, ", "))
+		}
+	}
+	if first > last {
+		return nil, fmt.Errorf("stage %s is after stage %s", from, until)
+	}
+	return Stages[first : last+1], nil
+}
+
+func isStage(name string) bool {
+	for _, stage := range Stages {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish applies the resources of the registry stage by stage, from the
+// stage from to the stage until, and stops at the first stage that fails.
+// Each stage applies the resources in that stage, along with the resources
+// they depend on that were not applied by an earlier stage of the run,
+// since outputs such as generated templates are not kept between runs.
+func (r *registry) Publish(from string, until string) (err error) {
+	stages, err := stageRange(from, until)
+	if err != nil {
+		return UsageError(err)
+	}
+
+	summary := &RunSummary{StartTime: time.Now()}
+	r.summary = summary
+	var resources []Resource
+	defer func() {
+		r.notify(resources, summary, err)
+	}()
+
+	resources, err = r.topologicalSort()
+	if err != nil {
+		return ValidationError(err)
+	}
+	if r.statePath != "" {
+		defer func() {
+			if saveErr := r.saveState(); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}()
+	}
+
+	// Tools are only needed by the resources of the applied stages, and
+	// by their dependencies, which are applied with them.
+	needed := r.withDependencies(resources, func(rs Resource) bool {
+		for _, stage := range stages {
+			if stage != StageValidate && StageOf(rs) == stage {
+				return true
+			}
+		}
+		return false
+	})
+	var neededResources []Resource
+	for _, rs := range resources {
+		if needed[rs.GetReference()] {
+			neededResources = append(neededResources, rs)
+		}
+	}
+	if err = checkTools(r.executor, neededResources); err != nil {
+		return err
+	}
+
+	applied := map[Reference]bool{}
+	for i, stage := range stages {
+		selected := r.stageResources(resources, stage, applied)
+		fmt.Printf("Starting stage %s\n", stage)
+		n := len(summary.Resources)
+		err = r.applyResources(selected, stage == StageValidate, summary)
+		for j := n; j < len(summary.Resources); j++ {
+			summary.Resources[j].Stage = stage
+		}
+		if err != nil {
+			r.skipStages(resources, stages[i:], selected, summary)
+			return errors.Wrapf(err, "stage %s failed", stage)
+		}
+		if stage != StageValidate {
+			for _, rs := range selected {
+				applied[rs.GetReference()] = true
+			}
+		}
+	}
+	fmt.Println(Green("all stages have completed"))
+	r.printOutputs(resources)
+	return nil
+}
+
+// stageResources returns the resources that are applied in stage, which
+// are all resources for the validate stage.
+func (r *registry) stageResources(resources []Resource, stage string, applied map[Reference]bool) []Resource {
+	if stage == StageValidate {
+		return resources
+	}
+	needed := r.withDependencies(resources, func(rs Resource) bool {
+		return StageOf(rs) == stage
+	})
+	var selected []Resource
+	for _, rs := range resources {
+		ref := rs.GetReference()
+		if _, ok := rs.(notifier); ok || !needed[ref] || applied[ref] {
+			continue
+		}
+		selected = append(selected, rs)
+	}
+	return selected
+}
+
+// skipStages records the resources of a failed stage that were not applied,
+// and the resources of the stages after it, as skipped. stages starts with
+// the failed stage.
+func (r *registry) skipStages(resources []Resource, stages []string, failed []Resource, summary *RunSummary) {
+	done := map[Reference]bool{}
+	for _, rs := range summary.Resources {
+		if rs.Stage == stages[0] {
+			done[rs.Reference] = true
+		}
+	}
+	seen := map[Reference]bool{}
+	for _, rs := range failed {
+		ref := rs.GetReference()
+		seen[ref] = true
+		if _, ok := rs.(notifier); !ok && !done[ref] {
+			summary.Resources = append(summary.Resources, ResourceSummary{Reference: ref, Status: "skipped", Stage: stages[0]})
+		}
+	}
+	for _, stage := range stages[1:] {
+		for _, rs := range resources {
+			ref := rs.GetReference()
+			if _, ok := rs.(notifier); ok || seen[ref] || StageOf(rs) != stage {
+				continue
+			}
+			seen[ref] = true
+			summary.Resources = append(summary.Resources, ResourceSummary{Reference: ref, Status: "skipped", Stage: stage})
+		}
+	}
+}
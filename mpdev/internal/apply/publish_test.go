@@ -0,0 +1,132 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// newStageResources returns a build resource, a package resource that
+// depends on it and a verification resource, which append their name to
+// calls when applied.
+func newStageResources(calls *[]string, failing string) []Resource {
+	apply := func(name string) func(Registry, bool) error {
+		return func(_ Registry, dryRun bool) error {
+			*calls = append(*calls, fmt.Sprintf("%s dryRun=%t", name, dryRun))
+			if name == failing && !dryRun {
+				return errors.New("failed")
+			}
+			return nil
+		}
+	}
+	build := newTestResourceFunc("build", apply("build"), nil)
+	pkg := newTestResourceFunc("package", apply("package"), func() []Reference {
+		return []Reference{build.GetReference()}
+	})
+	pkg.TypeMeta = TypeMeta{Kind: "DeploymentManagerTemplate", APIVersion: apiVersion}
+	check := newTestResourceFunc("check", apply("check"), nil)
+	check.TypeMeta = TypeMeta{Kind: "QuotaCheck", APIVersion: apiVersion}
+	return []Resource{build, pkg, check}
+}
+
+func TestPublish(t *testing.T) {
+	testCases := []struct {
+		name          string
+		from          string
+		until         string
+		expectedCalls []string
+	}{
+		{
+			name: "all stages",
+			expectedCalls: []string{
+				"build dryRun=true", "package dryRun=true", "check dryRun=true",
+				"build dryRun=false", "package dryRun=false", "check dryRun=false",
+			},
+		},
+		{
+			name:          "dependencies of skipped stages",
+			from:          StagePackage,
+			until:         StagePackage,
+			expectedCalls: []string{"build dryRun=false", "package dryRun=false"},
+		},
+		{
+			name:          "verify only",
+			from:          StageVerify,
+			expectedCalls: []string{"check dryRun=false"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			r := NewRegistry(&testingexec.FakeExec{})
+			for _, rs := range newStageResources(&calls, "") {
+				r.RegisterResource(rs, "resourcedir")
+			}
+
+			err := r.Publish(tc.from, tc.until)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tc.expectedCalls, calls)
+			assert.True(t, r.Summary().Succeeded)
+		})
+	}
+}
+
+func TestPublishStageFailure(t *testing.T) {
+	var calls []string
+	r := NewRegistry(&testingexec.FakeExec{})
+	for _, rs := range newStageResources(&calls, "package") {
+		r.RegisterResource(rs, "resourcedir")
+	}
+
+	err := r.Publish(StageBuild, "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "stage package failed")
+	assert.Equal(t, []string{"build dryRun=false", "package dryRun=false"}, calls)
+
+	stages := map[string]string{}
+	statuses := map[string]string{}
+	for _, rs := range r.Summary().Resources {
+		stages[rs.Reference.Name] = rs.Stage
+		statuses[rs.Reference.Name] = rs.Status
+	}
+	assert.Equal(t, map[string]string{"build": StageBuild, "package": StagePackage, "check": StageVerify}, stages)
+	assert.Equal(t, map[string]string{"build": "succeeded", "package": "failed", "check": "skipped"}, statuses)
+}
+
+func TestPublishStageRange(t *testing.T) {
+	testCases := []struct {
+		name  string
+		from  string
+		until string
+	}{
+		{name: "unknown stage", from: "deploy"},
+		{name: "from after until", from: StageVerify, until: StageBuild},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRegistry(&testingexec.FakeExec{})
+			err := r.Publish(tc.from, tc.until)
+			assert.Error(t, err)
+			assert.Equal(t, ExitUsage, ExitCode(err))
+		})
+	}
+}
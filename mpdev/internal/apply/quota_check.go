@@ -0,0 +1,208 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QuotaCheck verifies that the Compute Engine quotas of a test project are
+// sufficient to deploy a solution, before a deployment is created. Each
+// machine type of the solution is deployed separately, so the CPU quota
+// must cover the largest machine type.
+// See https://cloud.google.com/compute/quotas
+type QuotaCheck struct {
+	BaseResource
+	// ProjectID of the test project
+	ProjectID string `json:"projectId"`
+	// Zone the solution is deployed to, such as us-central1-a
+	Zone string
+	// MachineTypes that the solution is tested with, such as e2-standard-2
+	MachineTypes []string
+	// Instances created by a deployment. Defaults to 1
+	Instances int
+	// ExternalIPs created by a deployment
+	ExternalIPs int `json:"externalIps"`
+	// DiskSizeGb of the disks of each instance
+	DiskSizeGb int
+	// DiskType of the disks, such as pd-ssd. Defaults to pd-standard
+	DiskType string
+}
+
+type quota struct {
+	Metric string
+	Limit  float64
+	Usage  float64
+}
+
+// quotaRequirement is an amount of a quota metric needed by a deployment.
+type quotaRequirement struct {
+	metric string
+	amount float64
+}
+
+// Apply checks the quotas of the region of the zone, and of the project.
+func (c *QuotaCheck) Apply(registry Registry, dryRun bool) error {
+	err := c.validate()
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	region := c.Zone[:strings.LastIndex(c.Zone, "-")]
+	regionQuotas, err := c.describeQuotas(registry, "regions", "describe", region)
+	if err != nil {
+		return err
+	}
+	projectQuotas, err := c.describeQuotas(registry, "project-info", "describe")
+	if err != nil {
+		return err
+	}
+
+	requirements, err := c.requirements(registry, regionQuotas)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, req := range requirements {
+		quotas, scope := regionQuotas, "region "+region
+		if req.metric == "CPUS_ALL_REGIONS" {
+			quotas, scope = projectQuotas, "project"
+		}
+		q, ok := quotas[req.metric]
+		if !ok {
+			continue
+		}
+		if available := q.Limit - q.Usage; available < req.amount {
+			problems = append(problems, fmt.Sprintf("%s in %s: %g needed, %g available (limit %g, usage %g)",
+				req.metric, scope, req.amount, available, q.Limit, q.Usage))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("quota check %s failed in project %s:\n  - %s\nRequest a quota increase at https://console.cloud.google.com/iam-admin/quotas?project=%s",
+			c.Metadata.Name, c.ProjectID, strings.Join(problems, "\n  - "), c.ProjectID)
+	}
+	fmt.Printf("Quotas of project %s are sufficient\n", c.ProjectID)
+	return nil
+}
+
+func (c *QuotaCheck) validate() error {
+	if c.ProjectID == "" {
+		return errors.New("projectId cannot be empty for quota check")
+	}
+	if strings.Count(c.Zone, "-") < 2 {
+		return fmt.Errorf("zone %q of quota check must have the format REGION-ZONE, such as us-central1-a", c.Zone)
+	}
+	if len(c.MachineTypes) == 0 {
+		return errors.New("machineTypes cannot be empty for quota check")
+	}
+	if c.Instances < 0 || c.ExternalIPs < 0 || c.DiskSizeGb < 0 {
+		return errors.New("instances, externalIps and diskSizeGb of quota check cannot be negative")
+	}
+	return nil
+}
+
+// requirements returns the quotas needed by the largest deployment.
+func (c *QuotaCheck) requirements(registry Registry, regionQuotas map[string]quota) ([]quotaRequirement, error) {
+	instances := c.Instances
+	if instances == 0 {
+		instances = 1
+	}
+
+	// CPUs of some machine families are limited by a separate quota.
+	cpus := map[string]float64{}
+	for _, machineType := range c.MachineTypes {
+		guestCpus, err := c.machineTypeCpus(registry, machineType)
+		if err != nil {
+			return nil, err
+		}
+		metric := strings.ToUpper(strings.Split(machineType, "-")[0]) + "_CPUS"
+		if _, ok := regionQuotas[metric]; !ok {
+			metric = "CPUS"
+		}
+		amount := guestCpus * float64(instances)
+		for _, m := range []string{metric, "CPUS_ALL_REGIONS"} {
+			if amount > cpus[m] {
+				cpus[m] = amount
+			}
+		}
+	}
+
+	var requirements []quotaRequirement
+	for metric, amount := range cpus {
+		requirements = append(requirements, quotaRequirement{metric, amount})
+	}
+	requirements = append(requirements, quotaRequirement{"INSTANCES", float64(instances)})
+	if c.ExternalIPs > 0 {
+		requirements = append(requirements, quotaRequirement{"IN_USE_ADDRESSES", float64(c.ExternalIPs)})
+	}
+	if c.DiskSizeGb > 0 {
+		metric := "DISKS_TOTAL_GB"
+		if c.DiskType != "" && c.DiskType != "pd-standard" {
+			metric = "SSD_TOTAL_GB"
+		}
+		requirements = append(requirements, quotaRequirement{metric, float64(c.DiskSizeGb * instances)})
+	}
+	sort.Slice(requirements, func(i, j int) bool { return requirements[i].metric < requirements[j].metric })
+	return requirements, nil
+}
+
+func (c *QuotaCheck) machineTypeCpus(registry Registry, machineType string) (float64, error) {
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gcloud", "compute", "machine-types", "describe", machineType,
+		"--zone", c.Zone, "--project", c.ProjectID, "--format", "json")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to describe machine type %s in zone %s", machineType, c.Zone)
+	}
+	var description struct {
+		GuestCpus float64 `json:"guestCpus"`
+	}
+	err = json.Unmarshal(stdout, &description)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to parse description of machine type %s", machineType)
+	}
+	return description.GuestCpus, nil
+}
+
+// describeQuotas returns the quotas of a region or project, by metric.
+func (c *QuotaCheck) describeQuotas(registry Registry, args ...string) (map[string]quota, error) {
+	args = append([]string{"compute"}, args...)
+	args = append(args, "--project", c.ProjectID, "--format", "json(quotas)")
+	stdout, err := runCommandOutput(registry.GetExecutor(), "gcloud", args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get quotas of project %s", c.ProjectID)
+	}
+	var description struct {
+		Quotas []quota
+	}
+	err = json.Unmarshal(stdout, &description)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse quotas of project %s", c.ProjectID)
+	}
+	quotas := map[string]quota{}
+	for _, q := range description.Quotas {
+		quotas[q.Metric] = q
+	}
+	return quotas, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestQuotaCheck(t *testing.T) {
+	regionQuotas := `{"quotas": [
+		{"metric": "CPUS", "limit": 24, "usage": 20},
+		{"metric": "N2_CPUS", "limit": 24, "usage": 0},
+		{"metric": "INSTANCES", "limit": 100, "usage": 3},
+		{"metric": "IN_USE_ADDRESSES", "limit": 8, "usage": 8},
+		{"metric": "SSD_TOTAL_GB", "limit": 500, "usage": 0}
+	]}`
+	projectQuotas := `{"quotas": [{"metric": "CPUS_ALL_REGIONS", "limit": 32, "usage": 20}]}`
+
+	testCases := []struct {
+		name          string
+		check         QuotaCheck
+		machineTypes  []string
+		errorContains []string
+	}{{
+		name: "Sufficient quotas",
+		check: QuotaCheck{
+			MachineTypes: []string{"e2-standard-2", "n2-standard-8"},
+			DiskSizeGb:   100,
+			DiskType:     "pd-ssd",
+		},
+		machineTypes: []string{`{"guestCpus": 2}`, `{"guestCpus": 8}`},
+	}, {
+		name: "Insufficient quotas",
+		check: QuotaCheck{
+			MachineTypes: []string{"e2-standard-8"},
+			Instances:    2,
+			ExternalIPs:  1,
+		},
+		machineTypes: []string{`{"guestCpus": 8}`},
+		errorContains: []string{
+			"CPUS in region us-central1: 16 needed, 4 available (limit 24, usage 20)",
+			"CPUS_ALL_REGIONS in project: 16 needed, 12 available",
+			"IN_USE_ADDRESSES in region us-central1: 1 needed, 0 available",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			responses := append([]string{regionQuotas, projectQuotas}, tc.machineTypes...)
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for _, response := range responses {
+				response := response
+				fcmd.RunScript = append(fcmd.RunScript, func() ([]byte, []byte, error) { return []byte(response), nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+
+			c := tc.check
+			c.BaseResource = newTestBaseResource("QuotaCheck", "quota")
+			c.ProjectID = "test-project"
+			c.Zone = "us-central1-a"
+			r := NewRegistry(executor)
+
+			err := c.Apply(r, false)
+			if len(tc.errorContains) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.errorContains {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []string{"gcloud", "compute", "regions", "describe", "us-central1",
+				"--project", "test-project", "--format", "json(quotas)"}, fcmd.RunLog[0])
+			assert.Equal(t, []string{"gcloud", "compute", "machine-types", "describe", tc.check.MachineTypes[0],
+				"--zone", "us-central1-a", "--project", "test-project", "--format", "json"}, fcmd.RunLog[2])
+		})
+	}
+}
+
+func TestQuotaCheckValidation(t *testing.T) {
+	c := QuotaCheck{ProjectID: "p", Zone: "us-central1", MachineTypes: []string{"e2-small"}}
+	err := c.Apply(NewRegistry(&testingexec.FakeExec{}), true)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must have the format REGION-ZONE")
+}
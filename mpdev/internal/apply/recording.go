@@ -0,0 +1,554 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// recordedCall is a command executed by mpdev, or a lookup of an
+// executable, in a recording.
+type recordedCall struct {
+	// Resource is the resource that executed the command, such as
+	// DeploymentManagerTemplate/solution
+	Resource string   `json:"resource,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Dir      string   `json:"dir,omitempty"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	// ExitStatus is -1 if the command could not be run, in which case
+	// Error is the error running it
+	ExitStatus int    `json:"exitStatus"`
+	Error      string `json:"error,omitempty"`
+	// LookPath is the executable that was looked up, and Path the path it
+	// was found at
+	LookPath string `json:"lookPath,omitempty"`
+	Path     string `json:"path,omitempty"`
+	// Files are the files that the command wrote to paths in its arguments
+	Files []recordedFile `json:"files,omitempty"`
+}
+
+// recordedFile is a file written by a recorded command to the path in its
+// argument Arg, such as the archive written by zip, whose contents later
+// steps read.
+type recordedFile struct {
+	Arg     int    `json:"arg"`
+	Content []byte `json:"content"`
+}
+
+// maxRecordedFileBytes is the size of the largest file written by a command
+// that is recorded.
+const maxRecordedFileBytes = 4 * defaultPackageSizeLimit
+
+// outputArg is an argument of a command that is the path of a file that
+// did not exist before the command ran.
+type outputArg struct {
+	arg  int
+	path string
+}
+
+// outputArgs returns the arguments of argv, run in dir, that are the paths
+// of files that do not exist, which the command may write. Paths can be
+// the values of options, such as --output=PATH, and URLs are ignored.
+func outputArgs(argv []string, dir string) []outputArg {
+	var outputs []outputArg
+	seen := map[string]bool{}
+	for i, arg := range argv[1:] {
+		p := argPath(arg, dir)
+		if p == "" || seen[p] {
+			continue
+		}
+		seen[p] = true
+		if _, err := os.Lstat(p); os.IsNotExist(err) {
+			outputs = append(outputs, outputArg{arg: i + 1, path: p})
+		}
+	}
+	return outputs
+}
+
+// argPath returns the path in the argument arg of a command run in dir, or
+// an empty string if it does not contain one.
+func argPath(arg string, dir string) string {
+	if strings.Contains(arg, "://") {
+		return ""
+	}
+	_, p, _ := splitPathArg(arg)
+	if p == "" {
+		return ""
+	}
+	if !filepath.IsAbs(p) && dir != "" {
+		p = filepath.Join(dir, p)
+	}
+	return p
+}
+
+// pathPlaceholders replace the paths that differ between the machine
+// recording commands and the one replaying them in the arguments and the
+// directories of commands: the temporary directories created by mpdev,
+// whose random suffix is removed, and the working directory.
+type pathPlaceholders struct {
+	tmpDirs    *regexp.Regexp
+	workingDir string
+}
+
+func newPathPlaceholders() *pathPlaceholders {
+	p := &pathPlaceholders{}
+	if tmp, err := util.TempRoot(); err == nil {
+		p.tmpDirs = regexp.MustCompile(regexp.QuoteMeta(tmp) + `([/\\][A-Za-z_-]*)[0-9]+`)
+	}
+	if wd, err := os.Getwd(); err == nil && wd != "/" {
+		p.workingDir = wd
+	}
+	return p
+}
+
+func (p *pathPlaceholders) replace(s string) string {
+	if p.tmpDirs != nil {
+		s = p.tmpDirs.ReplaceAllString(s, "$$TMPDIR$1")
+	}
+	if p.workingDir != "" {
+		s = strings.Replace(s, p.workingDir, "$PWD", -1)
+	}
+	return s
+}
+
+func (p *pathPlaceholders) replaceAll(args []string) []string {
+	replaced := make([]string, len(args))
+	for i, arg := range args {
+		replaced[i] = p.replace(arg)
+	}
+	return replaced
+}
+
+// NewRecordingExecutor returns an executor that writes a json record of
+// every command it executes and of every executable it looks up to w, such
+// that a failing run can be replayed with NewReplayExecutor by someone
+// without access to its project: the arguments and directory of commands,
+// the resource that executed them, their output and exit status. The
+// output of commands printing credentials, such as access tokens, and the
+// environment of commands are not recorded. Commands fail if their record
+// cannot be written.
+func NewRecordingExecutor(executor exec.Interface, w io.Writer) exec.Interface {
+	return &recordingExecutor{Interface: executor, recording: &recording{w: w, placeholders: newPathPlaceholders(), lookups: map[string]bool{}}}
+}
+
+type recording struct {
+	mu           sync.Mutex
+	w            io.Writer
+	placeholders *pathPlaceholders
+	// lookups are the executables whose lookup is recorded
+	lookups map[string]bool
+}
+
+func (r *recording) write(call recordedCall) error {
+	call.Command = r.placeholders.replaceAll(call.Command)
+	call.Dir = r.placeholders.replace(call.Dir)
+	b, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(b, '\n'))
+	return errors.Wrap(err, "failed to write recording of commands")
+}
+
+type recordingExecutor struct {
+	exec.Interface
+	recording *recording
+}
+
+func (e *recordingExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return &recordingCmd{Cmd: e.Interface.Command(cmd, args...), recording: e.recording, argv: append([]string{cmd}, args...)}
+}
+
+func (e *recordingExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	c := &recordingCmd{Cmd: e.Interface.CommandContext(ctx, cmd, args...), recording: e.recording, argv: append([]string{cmd}, args...)}
+	if ref, ok := resourceFromContext(ctx); ok {
+		c.resource = ref.Kind + "/" + ref.Name
+	}
+	return c
+}
+
+// LookPath records the first lookup of each executable, which mpdev looks
+// up before running commands.
+func (e *recordingExecutor) LookPath(file string) (string, error) {
+	path, err := e.Interface.LookPath(file)
+	e.recording.mu.Lock()
+	recorded := e.recording.lookups[file]
+	e.recording.lookups[file] = true
+	e.recording.mu.Unlock()
+	if recorded {
+		return path, err
+	}
+	call := recordedCall{LookPath: file, Path: path}
+	if err != nil {
+		call.ExitStatus, call.Error = -1, err.Error()
+	}
+	if writeErr := e.recording.write(call); writeErr != nil {
+		return "", writeErr
+	}
+	return path, err
+}
+
+type recordingCmd struct {
+	exec.Cmd
+	recording *recording
+	argv      []string
+	resource  string
+	dir       string
+	// stdout and stderr are the writers set by the caller, and outBuf and
+	// errBuf the output of the command
+	stdout io.Writer
+	stderr io.Writer
+	outBuf bytes.Buffer
+	errBuf bytes.Buffer
+	// outputs are the arguments that are paths of files that did not exist
+	// when the command started
+	outputs []outputArg
+}
+
+func (c *recordingCmd) SetDir(dir string) {
+	c.dir = dir
+	c.Cmd.SetDir(dir)
+}
+
+func (c *recordingCmd) SetStdout(w io.Writer) {
+	c.stdout = w
+	c.Cmd.SetStdout(w)
+}
+
+func (c *recordingCmd) SetStderr(w io.Writer) {
+	c.stderr = w
+	c.Cmd.SetStderr(w)
+}
+
+func (c *recordingCmd) Run() error {
+	c.capture(true)
+	return c.exited(nil, c.Cmd.Run())
+}
+
+func (c *recordingCmd) Output() ([]byte, error) {
+	c.capture(false)
+	out, err := c.Cmd.Output()
+	return out, c.exited(out, err)
+}
+
+func (c *recordingCmd) CombinedOutput() ([]byte, error) {
+	c.outputs = outputArgs(c.argv, c.dir)
+	out, err := c.Cmd.CombinedOutput()
+	return out, c.exited(out, err)
+}
+
+func (c *recordingCmd) Start() error {
+	c.capture(true)
+	err := c.Cmd.Start()
+	if err != nil {
+		return c.exited(nil, err)
+	}
+	return nil
+}
+
+func (c *recordingCmd) Wait() error {
+	return c.exited(nil, c.Cmd.Wait())
+}
+
+// capture makes the command also write its stderr, and its stdout if it is
+// not returned by the command, to the buffers of the recording, and finds
+// the files that it may write.
+func (c *recordingCmd) capture(stdout bool) {
+	c.outputs = outputArgs(c.argv, c.dir)
+	if stdout {
+		c.Cmd.SetStdout(teeWriter(c.stdout, &c.outBuf))
+	}
+	c.Cmd.SetStderr(teeWriter(c.stderr, &c.errBuf))
+}
+
+// exited writes the record of the command, along with out if it is the
+// output returned by the command, and returns the error of the command, or
+// the error writing the record if the command succeeded.
+func (c *recordingCmd) exited(out []byte, err error) error {
+	if out == nil {
+		out = c.outBuf.Bytes()
+	}
+	if printsCredentials(c.argv) {
+		out = []byte(redactedOutput)
+	}
+	call := recordedCall{
+		Resource:   c.resource,
+		Command:    c.argv,
+		Dir:        c.dir,
+		Stdout:     string(out),
+		Stderr:     c.errBuf.String(),
+		ExitStatus: exitStatus(err),
+	}
+	if call.ExitStatus < 0 {
+		call.Error = err.Error()
+	} else if !printsCredentials(c.argv) {
+		call.Files = writtenFiles(c.outputs)
+	}
+	writeErr := c.recording.write(call)
+	if err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// writtenFiles returns the files of outputs that the command wrote, up to
+// maxRecordedFileBytes.
+func writtenFiles(outputs []outputArg) []recordedFile {
+	var files []recordedFile
+	for _, output := range outputs {
+		info, err := os.Stat(output.path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxRecordedFileBytes {
+			continue
+		}
+		content, err := ioutil.ReadFile(output.path)
+		if err != nil {
+			continue
+		}
+		files = append(files, recordedFile{Arg: output.arg, Content: content})
+	}
+	return files
+}
+
+// NewReplayExecutor returns an executor that replays the commands recorded
+// by NewRecordingExecutor in r instead of executing them: each command
+// writes the output of a recorded command with the same arguments and the
+// files it wrote, and exits with its status. Commands are matched to the recorded commands of
+// the same resource in the order they were recorded, and commands that are
+// not in the recording fail. Executables that were not looked up in the
+// recording are found.
+func NewReplayExecutor(r io.Reader) (exec.Interface, error) {
+	e := &replayExecutor{placeholders: newPathPlaceholders(), lookups: map[string]recordedCall{}}
+	dec := json.NewDecoder(r)
+	for {
+		var call recordedCall
+		err := dec.Decode(&call)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "failed to parse recording of commands")
+		}
+		if call.LookPath != "" {
+			e.lookups[call.LookPath] = call
+			continue
+		}
+		e.calls = append(e.calls, call)
+	}
+	e.replayed = make([]bool, len(e.calls))
+	return e, nil
+}
+
+type replayExecutor struct {
+	placeholders *pathPlaceholders
+	lookups      map[string]recordedCall
+
+	mu       sync.Mutex
+	calls    []recordedCall
+	replayed []bool
+}
+
+func (e *replayExecutor) Command(cmd string, args ...string) exec.Cmd {
+	return e.CommandContext(context.Background(), cmd, args...)
+}
+
+func (e *replayExecutor) CommandContext(ctx context.Context, cmd string, args ...string) exec.Cmd {
+	c := &replayCmd{executor: e, ctx: ctx, argv: append([]string{cmd}, args...)}
+	if ref, ok := resourceFromContext(ctx); ok {
+		c.resource = ref.Kind + "/" + ref.Name
+	}
+	return c
+}
+
+func (e *replayExecutor) LookPath(file string) (string, error) {
+	call, ok := e.lookups[file]
+	if !ok {
+		return file, nil
+	}
+	if call.ExitStatus != 0 {
+		return "", exec.ErrExecutableNotFound
+	}
+	return call.Path, nil
+}
+
+// next returns the first recorded command with the arguments of argv that
+// has not been replayed, preferring those of resource.
+func (e *replayExecutor) next(argv []string, resource string) (recordedCall, error) {
+	argv = e.placeholders.replaceAll(argv)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	match := -1
+	for i, call := range e.calls {
+		if e.replayed[i] || !equalStrings(call.Command, argv) {
+			continue
+		}
+		if call.Resource == resource {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return recordedCall{}, fmt.Errorf("command %s is not in the recording", strings.Join(quoteArgs(argv), " "))
+	}
+	e.replayed[match] = true
+	return e.calls[match], nil
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// replayCmd is a command replayed from a recording. Its input and
+// environment are ignored.
+type replayCmd struct {
+	executor *replayExecutor
+	ctx      context.Context
+	argv     []string
+	resource string
+	dir      string
+	stdout   io.Writer
+	stderr   io.Writer
+	// err is the error of the command started by Start
+	err error
+}
+
+func (c *replayCmd) SetDir(dir string)       { c.dir = dir }
+func (c *replayCmd) SetStdin(io.Reader)      {}
+func (c *replayCmd) SetStdout(out io.Writer) { c.stdout = out }
+func (c *replayCmd) SetStderr(out io.Writer) { c.stderr = out }
+func (c *replayCmd) SetEnv([]string)         {}
+func (c *replayCmd) Stop()                   {}
+
+func (c *replayCmd) StdoutPipe() (io.ReadCloser, error) {
+	return nil, errors.New("pipes are not supported by replayed commands")
+}
+
+func (c *replayCmd) StderrPipe() (io.ReadCloser, error) {
+	return nil, errors.New("pipes are not supported by replayed commands")
+}
+
+// replay returns the recorded command, after writing its stderr and the
+// files that it wrote to the paths of its arguments.
+func (c *replayCmd) replay() (recordedCall, error) {
+	if err := c.ctx.Err(); err != nil {
+		return recordedCall{}, err
+	}
+	call, err := c.executor.next(c.argv, c.resource)
+	if err != nil {
+		return recordedCall{}, err
+	}
+	for _, file := range call.Files {
+		if file.Arg <= 0 || file.Arg >= len(c.argv) {
+			return recordedCall{}, fmt.Errorf("invalid file of recorded command %s", strings.Join(quoteArgs(c.argv), " "))
+		}
+		p := argPath(c.argv[file.Arg], c.dir)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return recordedCall{}, err
+		}
+		if err := ioutil.WriteFile(p, file.Content, 0644); err != nil {
+			return recordedCall{}, errors.Wrap(err, "failed to write file of recorded command")
+		}
+	}
+	if c.stderr != nil {
+		_, _ = io.WriteString(c.stderr, call.Stderr)
+	}
+	return call, nil
+}
+
+func (c *replayCmd) Run() error {
+	call, err := c.replay()
+	if err != nil {
+		return err
+	}
+	if c.stdout != nil {
+		_, _ = io.WriteString(c.stdout, call.Stdout)
+	}
+	return replayedError(call)
+}
+
+func (c *replayCmd) Output() ([]byte, error) {
+	call, err := c.replay()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(call.Stdout), replayedError(call)
+}
+
+func (c *replayCmd) CombinedOutput() ([]byte, error) {
+	c.stderr = nil
+	call, err := c.replay()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(call.Stdout + call.Stderr), replayedError(call)
+}
+
+func (c *replayCmd) Start() error {
+	c.err = c.Run()
+	return nil
+}
+
+func (c *replayCmd) Wait() error {
+	return c.err
+}
+
+// replayedError returns the error of a recorded command.
+func replayedError(call recordedCall) error {
+	switch {
+	case call.ExitStatus > 0:
+		return &replayedExitError{status: call.ExitStatus}
+	case call.ExitStatus < 0 && strings.HasSuffix(call.Error, exec.ErrExecutableNotFound.Error()):
+		return exec.ErrExecutableNotFound
+	case call.ExitStatus < 0:
+		return errors.New(call.Error)
+	}
+	return nil
+}
+
+// replayedExitError is the exit status of a replayed command.
+type replayedExitError struct {
+	status int
+}
+
+func (e *replayedExitError) String() string  { return e.Error() }
+func (e *replayedExitError) Error() string   { return fmt.Sprintf("exit status %d", e.status) }
+func (e *replayedExitError) Exited() bool    { return true }
+func (e *replayedExitError) ExitStatus() int { return e.status }
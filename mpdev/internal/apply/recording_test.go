@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	tmpDir, err := util.TempRoot()
+	assert.NoError(t, err)
+	autogenDir := filepath.Join(tmpDir, "autogen123456")
+	fcmd := testingexec.FakeCmd{
+		RunScript: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte("adding: solution.jinja\n"), nil, nil },
+			func() ([]byte, []byte, error) {
+				return nil, []byte("AccessDeniedException: 403\n"), testingexec.FakeExitError{Status: 1}
+			},
+		},
+		OutputScript: []testingexec.FakeAction{
+			func() ([]byte, []byte, error) { return []byte("ya29.token\n"), nil, nil },
+		},
+	}
+	fexec := &testingexec.FakeExec{LookPathFunc: newLookPathFunc([]string{"packer"})}
+	for i := 0; i < 3; i++ {
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd {
+			return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+		})
+	}
+
+	var bundle bytes.Buffer
+	recorder := NewRecordingExecutor(fexec, &bundle)
+	_, err = recorder.LookPath("packer")
+	assert.Equal(t, exec.ErrExecutableNotFound, err)
+	_, err = recorder.LookPath("packer")
+	assert.Equal(t, exec.ErrExecutableNotFound, err)
+	ctx := context.WithValue(context.Background(), resourceKey{}, Reference{Kind: "DeploymentManagerTemplate", Name: "solution"})
+	cmd := recorder.CommandContext(ctx, "zip", "-r", filepath.Join(autogenDir, "dm_template.zip"), ".")
+	cmd.SetDir(autogenDir)
+	var stdout bytes.Buffer
+	cmd.SetStdout(&stdout)
+	assert.NoError(t, cmd.Run())
+	assert.Equal(t, "adding: solution.jinja\n", stdout.String())
+	token, err := recorder.Command("gcloud", "auth", "print-access-token").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "ya29.token\n", string(token))
+	cmd = recorder.CommandContext(ctx, "gsutil", "cp", "dm_template.zip", "gs://bucket/solution.zip")
+	var stderr bytes.Buffer
+	cmd.SetStderr(&stderr)
+	assert.Equal(t, 1, exitStatus(cmd.Run()))
+
+	lines := strings.Split(strings.TrimSpace(bundle.String()), "\n")
+	assert.Equal(t, []string{
+		`{"exitStatus":-1,"error":"executable file not found in $PATH","lookPath":"packer"}`,
+		`{"resource":"DeploymentManagerTemplate/solution","command":["zip","-r","$TMPDIR/autogen/dm_template.zip","."],"dir":"$TMPDIR/autogen","stdout":"adding: solution.jinja\n","exitStatus":0}`,
+		`{"command":["gcloud","auth","print-access-token"],"stdout":"[REDACTED]\n","exitStatus":0}`,
+		`{"resource":"DeploymentManagerTemplate/solution","command":["gsutil","cp","dm_template.zip","gs://bucket/solution.zip"],"stderr":"AccessDeniedException: 403\n","exitStatus":1}`,
+	}, lines)
+
+	replayer, err := NewReplayExecutor(&bundle)
+	assert.NoError(t, err)
+	_, err = replayer.LookPath("packer")
+	assert.Equal(t, exec.ErrExecutableNotFound, err)
+	path, err := replayer.LookPath("gcloud")
+	assert.NoError(t, err)
+	assert.Equal(t, "gcloud", path)
+
+	// Commands are replayed from other temporary directories, in another
+	// order.
+	cmd = replayer.CommandContext(ctx, "gsutil", "cp", "dm_template.zip", "gs://bucket/solution.zip")
+	stderr.Reset()
+	cmd.SetStderr(&stderr)
+	err = cmd.Run()
+	assert.Equal(t, ExitTool, ExitCode(err))
+	assert.Equal(t, 1, exitStatus(err))
+	assert.Equal(t, "AccessDeniedException: 403\n", stderr.String())
+	out, err := replayer.CommandContext(ctx, "zip", "-r", filepath.Join(tmpDir, "autogen987/dm_template.zip"), ".").CombinedOutput()
+	assert.NoError(t, err)
+	assert.Equal(t, "adding: solution.jinja\n", string(out))
+	token, err = replayer.Command("gcloud", "auth", "print-access-token").Output()
+	assert.NoError(t, err)
+	assert.Equal(t, redactedOutput, string(token))
+
+	assert.EqualError(t, replayer.Command("gcloud", "auth", "print-access-token").Run(),
+		"command gcloud auth print-access-token is not in the recording")
+}
+
+func TestRecordingPlaceholders(t *testing.T) {
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	tmpDir, err := util.TempRoot()
+	assert.NoError(t, err)
+	p := newPathPlaceholders()
+
+	assert.Equal(t, []string{"--config=$PWD/testdata/solution.yaml", "$TMPDIR/terraform/module.zip", "$TMPDIR/mpdev-auth", "/opt/autogen123"},
+		p.replaceAll([]string{"--config=" + filepath.Join(wd, "testdata", "solution.yaml"), filepath.Join(tmpDir, "terraform42", "module.zip"),
+			filepath.Join(tmpDir, "mpdev-auth7"), "/opt/autogen123"}))
+}
+
+func TestNewReplayExecutorInvalid(t *testing.T) {
+	_, err := NewReplayExecutor(strings.NewReader("{\"command\": [\"gcloud\"]}\nnot json\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse recording of commands")
+	_, err = NewReplayExecutor(strings.NewReader(""))
+	assert.NoError(t, err)
+}
+
+func TestReplayDeploymentManagerTemplate(t *testing.T) {
+	outDir := newTestPackageDir(t)
+	defer os.RemoveAll(outDir)
+	resourceDir, err := ioutil.TempDir("", "resourcedir")
+	assert.NoError(t, err)
+	defer os.RemoveAll(resourceDir)
+	zipPath := filepath.Join(resourceDir, "solution.zip")
+	apply := func(executor exec.Interface) (map[string]string, error) {
+		r := NewRegistry(executor)
+		autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+		autogen.outDir = outDir
+		dm := getDeploymentManagerTemplate(autogen, zipPath)
+		r.RegisterResource(autogen, resourceDir)
+		r.RegisterResource(dm, resourceDir)
+		err := dm.Apply(r, false)
+		return r.GetOutputs(dm.GetReference()), err
+	}
+
+	fcmd := testingexec.FakeCmd{}
+	fcmd.RunScript = []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, util.ZipDirectoryNative(fcmd.Argv[2], outDir) },
+	}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+	var bundle bytes.Buffer
+	recorded, err := apply(NewRecordingExecutor(fexec, &bundle))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"zip", "-r", zipPath, "."}}, fcmd.RunLog)
+	archive, err := ioutil.ReadFile(zipPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(zipPath))
+	assert.NoError(t, os.Remove(zipPath+manifestSuffix))
+
+	// The archive written by zip is restored, such that its size and
+	// contents are checked as they were by the recorded run.
+	replayer, err := NewReplayExecutor(&bundle)
+	assert.NoError(t, err)
+	replayed, err := apply(replayer)
+	assert.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+	assert.NotEmpty(t, replayed["archiveSizeBytes"])
+	restored, err := ioutil.ReadFile(zipPath)
+	assert.NoError(t, err)
+	assert.Equal(t, archive, restored)
+}
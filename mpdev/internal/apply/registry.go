@@ -17,8 +17,10 @@ package apply
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
-	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/topo"
@@ -28,25 +30,58 @@ import (
 // Registry stores references to all resources and can apply
 // all resources in the registry
 type Registry interface {
-	RegisterResource(resource Resource, workingDirectory string)
+	RegisterResource(resource Resource, workingDirectory string) error
+	SetPatchDirs(resource Resource, dirs map[string]string)
 	GetExecutor() exec.Interface
 	GetResource(reference Reference) Resource
 	ResolveFilePath(rs Resource, path string) (string, error)
+	SetOutput(rs Resource, name string, value string)
+	GetOutputs(reference Reference) map[string]string
+	GetState(rs Resource, key string) string
+	SetState(rs Resource, key string, value string)
+	LoadState(path string) error
+	PruneState(dryRun bool) ([]string, error)
 	Apply(dryRun bool) error
+	Diff() ([]PackageDiff, error)
+	Test() error
+	Publish(from string, until string) error
+	SetParallelism(n int)
+	SetAutogenImage(image string)
+	GetAutogenImage() string
+	Summary() *RunSummary
 }
 
 type registry struct {
-	refMap   map[Reference]Resource
-	dirMap   map[Reference]string
-	executor exec.Interface
+	refMap map[Reference]Resource
+	dirMap map[Reference]string
+	// patchDirMap are the directories of the relative paths set by the
+	// patches of overlays, by path, of each resource
+	patchDirMap map[Reference]map[string]string
+	outputMap   map[Reference]map[string]string
+	state       *state
+	statePath   string
+	executor    exec.Interface
+	summary     *RunSummary
+	// parallelism is the maximum number of resources applied at once
+	parallelism int
+	// autogenImage is the container image run by autogen templates
+	autogenImage string
+	// mu guards outputMap and state while resources are applied in
+	// parallel
+	mu sync.Mutex
 }
 
 // NewRegistry creates a registry that stores references to all resources
 func NewRegistry(executor exec.Interface) Registry {
 	return &registry{
-		refMap:   map[Reference]Resource{},
-		dirMap:   map[Reference]string{},
-		executor: executor,
+		refMap:       map[Reference]Resource{},
+		dirMap:       map[Reference]string{},
+		patchDirMap:  map[Reference]map[string]string{},
+		outputMap:    map[Reference]map[string]string{},
+		state:        newState(),
+		executor:     executor,
+		parallelism:  1,
+		autogenImage: DefaultAutogenImage,
 	}
 }
 
@@ -58,36 +93,232 @@ func (r *registry) GetExecutor() exec.Interface {
 	return r.executor
 }
 
-// RegisterResource adds a resource to the registry
-func (r *registry) RegisterResource(rs Resource, workingDirectory string) {
+// RegisterResource adds a resource to the registry. Resources are unique by
+// reference, such that a resource defined twice, for example in two of the
+// directories loaded by apply --recursive, is an error.
+func (r *registry) RegisterResource(rs Resource, workingDirectory string) error {
 	ref := rs.GetReference()
+	if _, ok := r.refMap[ref]; ok {
+		return fmt.Errorf("resource %s/%s is defined more than once, in %s and in %s",
+			ref.Kind, ref.Name, r.dirMap[ref], workingDirectory)
+	}
 	r.refMap[ref] = rs
 	r.dirMap[ref] = workingDirectory
+	return nil
+}
+
+// SetPatchDirs sets the directories that the relative paths set by the
+// patches of overlays in a resource are resolved against, by path, instead
+// of its working directory.
+func (r *registry) SetPatchDirs(rs Resource, dirs map[string]string) {
+	if len(dirs) > 0 {
+		r.patchDirMap[rs.GetReference()] = dirs
+	}
+}
+
+// SetOutput records a named value produced when applying a resource, such
+// as the location of an uploaded artifact.
+func (r *registry) SetOutput(rs Resource, name string, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ref := rs.GetReference()
+	if r.outputMap[ref] == nil {
+		r.outputMap[ref] = map[string]string{}
+	}
+	r.outputMap[ref][name] = value
+}
+
+// GetOutputs returns the outputs recorded for the referenced resource.
+func (r *registry) GetOutputs(reference Reference) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.outputMap[reference]
+}
+
+// LoadState reads the state of previously applied resources from path.
+// The state is written back to path after resources are applied.
+func (r *registry) LoadState(path string) error {
+	s, err := loadState(path)
+	if err != nil {
+		return err
+	}
+	r.state = s
+	r.statePath = path
+	return nil
+}
+
+// GetState returns a value recorded for a resource by a previous apply.
+func (r *registry) GetState(rs Resource, key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.get(rs.GetReference(), key)
+}
+
+// SetState records a value for a resource that is persisted to the state
+// file.
+func (r *registry) SetState(rs Resource, key string, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state.set(rs.GetReference(), key, value)
+}
+
+// SetAutogenImage sets the container image that generates the Deployment
+// Manager templates of autogen templates. An empty image keeps the current
+// one.
+func (r *registry) SetAutogenImage(image string) {
+	if image != "" {
+		r.autogenImage = image
+	}
+}
+
+// GetAutogenImage returns the container image that generates the Deployment
+// Manager templates of autogen templates.
+func (r *registry) GetAutogenImage() string {
+	return r.autogenImage
 }
 
 // Apply invokes `Apply` on all resources in the registry.
 func (r *registry) Apply(dryRun bool) error {
-	resources, err := r.topologicalSort()
+	return r.run(dryRun, false)
+}
+
+// run applies the resources of the registry, or only the verification
+// resources and what they depend on if test is set.
+func (r *registry) run(dryRun bool, test bool) (err error) {
+	summary := &RunSummary{DryRun: dryRun, StartTime: time.Now()}
+	r.summary = summary
+	var resources []Resource
+	defer func() {
+		r.notify(resources, summary, err)
+	}()
+
+	resources, err = r.topologicalSort()
 	if err != nil {
+		return ValidationError(err)
+	}
+	if test {
+		resources = r.testResources(resources)
+	}
+	if !dryRun {
+		if err = checkTools(r.executor, resources); err != nil {
+			return err
+		}
+	}
+
+	if !dryRun && !test && r.statePath != "" {
+		defer func() {
+			if saveErr := r.saveState(); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}()
+	}
+
+	err = r.applyResources(resources, dryRun, summary)
+	if err != nil && !dryRun {
 		return err
 	}
+	fmt.Println(Green("all resources have been validated/created"))
+	r.printOutputs(resources)
+
+	return err
+}
+
+// saveState writes the state of applied resources to the state file.
+func (r *registry) saveState() error {
+	err := r.state.save(r.statePath)
+	return errors.Wrapf(err, "failed to write state file %s", r.statePath)
+}
+
+// verificationKinds are the kinds of resources that check artifacts or test
+// deployments, instead of publishing artifacts.
+var verificationKinds = map[string]bool{
+	"DeploymentManagerDeployment": true,
+	"DeploymentManagerPreview":    true,
+	"GceImageLicenseCheck":        true,
+	"ImageTest":                   true,
+	"ListingDocuments":            true,
+	"OrgPolicyCheck":              true,
+	"QuotaCheck":                  true,
+	"ShieldedVMCheck":             true,
+	"StartupScript":               true,
+}
+
+// IsVerification returns whether rs is a verification resource, whose
+// failures are in the ExitVerification class.
+func IsVerification(rs Resource) bool {
+	return verificationKinds[rs.GetReference().Kind]
+}
+
+// Summary returns the summary of the last call to Apply, or nil if Apply
+// has not been called.
+func (r *registry) Summary() *RunSummary {
+	return r.summary
+}
+
+// notify sends the summary of the run to the notifications in the registry.
+// Resources that were not applied because an earlier resource failed are
+// recorded as skipped.
+func (r *registry) notify(resources []Resource, summary *RunSummary, err error) {
+	applied := map[Reference]bool{}
+	for _, rs := range summary.Resources {
+		// Validating a resource in a publish run does not apply it.
+		if rs.Stage != StageValidate {
+			applied[rs.Reference] = true
+		}
+	}
+	for _, resource := range resources {
+		if _, ok := resource.(notifier); ok || applied[resource.GetReference()] {
+			continue
+		}
+		summary.Resources = append(summary.Resources, ResourceSummary{Reference: resource.GetReference(), Status: "skipped"})
+	}
 
+	if summary.Resources == nil {
+		summary.Resources = []ResourceSummary{}
+	}
+	summary.Succeeded = err == nil
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	summary.Duration = time.Since(summary.StartTime).Round(time.Millisecond).String()
 	for _, resource := range resources {
-		fmt.Printf("Starting to validate/create resource %+v\n", resource.GetReference())
-		applyErr := resource.Apply(r, dryRun)
-		if applyErr != nil {
-			applyErr := errors.Wrapf(applyErr, "Error in resource %+v\n", resource.GetReference())
-			// Accumulate errors if dryRun
-			if dryRun {
-				err = multierror.Append(applyErr, err)
-			} else {
-				return applyErr
-			}
+		n, ok := resource.(notifier)
+		if !ok {
+			continue
+		}
+		if notifyErr := n.notify(r.executor, summary); notifyErr != nil {
+			fmt.Printf("WARNING: %s\n", errors.Wrapf(notifyErr, "failed to notify %+v", resource.GetReference()))
 		}
 	}
-	fmt.Printf("all resources have been validated/created\n")
+}
 
-	return err
+func (r *registry) printOutputs(resources []Resource) {
+	if len(r.outputMap) == 0 {
+		return
+	}
+
+	fmt.Printf("Outputs:\n")
+	for _, resource := range resources {
+		outputs := r.outputMap[resource.GetReference()]
+		if len(outputs) == 0 {
+			continue
+		}
+
+		fmt.Printf("  %+v\n", resource.GetReference())
+		for _, name := range sortedKeys(outputs) {
+			fmt.Printf("    %s: %s\n", name, outputs[name])
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (r *registry) ResolveFilePath(rs Resource, path string) (string, error) {
@@ -95,7 +326,33 @@ func (r *registry) ResolveFilePath(rs Resource, path string) (string, error) {
 		return path, nil
 	}
 
-	return filepath.Abs(filepath.Join(r.dirMap[rs.GetReference()], path))
+	dir := r.dirMap[rs.GetReference()]
+	if patchDir, ok := r.patchDirMap[rs.GetReference()][path]; ok {
+		dir = patchDir
+	}
+	return filepath.Abs(filepath.Join(dir, path))
+}
+
+// withDependencies returns the references of the resources for which
+// selected returns true, and of their transitive dependencies.
+func (r *registry) withDependencies(resources []Resource, selected func(Resource) bool) map[Reference]bool {
+	refs := map[Reference]bool{}
+	var visit func(ref Reference)
+	visit = func(ref Reference) {
+		if refs[ref] {
+			return
+		}
+		refs[ref] = true
+		for _, dep := range r.refMap[ref].GetDependencies() {
+			visit(dep)
+		}
+	}
+	for _, resource := range resources {
+		if selected(resource) {
+			visit(resource.GetReference())
+		}
+	}
+	return refs
 }
 
 // topologicalSort returns a list of resources such that each
@@ -0,0 +1,216 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// RegistryAuth configures the credentials with which the images of
+// containers run by resources are pulled from a registry, such as a
+// private mirror. Either CredentialHelper, or Username and PasswordEnv are
+// set.
+type RegistryAuth struct {
+	// CredentialHelper is a docker credential helper, such as gcloud for
+	// docker-credential-gcloud, which prints the credentials of the
+	// registry
+	CredentialHelper string `yaml:"credentialHelper"`
+	// Username is the user authenticating with the registry
+	Username string `yaml:"username"`
+	// PasswordEnv is the variable of the environment holding the password
+	// of Username, such that the password is not in the configuration
+	PasswordEnv string `yaml:"passwordEnv"`
+}
+
+// registryAuths are the credentials of registries configured by the
+// selected profile, by registry host.
+var registryAuths = map[string]RegistryAuth{}
+
+// dockerHubRegistry is the key of Docker Hub in the docker CLI
+// configuration and credential helpers.
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// UseRegistryAuth sets the credentials of registries, by registry host such
+// as us-docker.pkg.dev, that images are pulled with. Registries that are not
+// configured use the credentials of the docker CLI configuration, which the
+// docker and podman CLIs read themselves.
+func UseRegistryAuth(auths map[string]RegistryAuth) error {
+	for registry, auth := range auths {
+		hasPassword := auth.Username != "" || auth.PasswordEnv != ""
+		if auth.CredentialHelper != "" && hasPassword {
+			return fmt.Errorf("registryAuth of %s sets both credentialHelper and username", registry)
+		}
+		if auth.CredentialHelper == "" && (auth.Username == "" || auth.PasswordEnv == "") {
+			return fmt.Errorf("registryAuth of %s must set a credentialHelper, or a username and a passwordEnv", registry)
+		}
+	}
+	registryAuths = auths
+	return nil
+}
+
+// registryOf returns the host of the registry of image, which is Docker Hub
+// for images without a host.
+func registryOf(image string) string {
+	if i := strings.Index(image, "/"); i > 0 {
+		if host := image[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			return host
+		}
+	}
+	return "docker.io"
+}
+
+// registryCredentials are credentials of a registry.
+type registryCredentials struct {
+	Username      string
+	Password      string
+	IdentityToken string
+	ServerAddress string
+}
+
+// lookupRegistryCredentials returns the credentials of the registry of
+// image configured with UseRegistryAuth, from its credential helper or its
+// password. It returns nil if the credential helper has no credentials of
+// the registry, such that images are pulled anonymously.
+func lookupRegistryCredentials(executor exec.Interface, image string) (*registryCredentials, error) {
+	registry := registryOf(image)
+	auth := registryAuths[registry]
+	if auth.CredentialHelper != "" {
+		return runCredentialHelper(executor, auth.CredentialHelper, registry)
+	}
+	password := os.Getenv(auth.PasswordEnv)
+	if password == "" {
+		return nil, fmt.Errorf("the password of registry %s is not set in %s", registry, auth.PasswordEnv)
+	}
+	return &registryCredentials{Username: auth.Username, Password: password, ServerAddress: registry}, nil
+}
+
+// registryAuthEntry returns the entry of the credentials of the registry of
+// image in the auths of a docker CLI configuration or of a podman auth file.
+func registryAuthEntry(executor exec.Interface, image string) (map[string]string, error) {
+	creds, err := lookupRegistryCredentials(executor, image)
+	if err != nil {
+		return nil, err
+	}
+	auth := map[string]string{}
+	if creds != nil && creds.IdentityToken != "" {
+		auth["identitytoken"] = creds.IdentityToken
+	} else if creds != nil {
+		auth["auth"] = base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+	}
+	return auth, nil
+}
+
+// dockerConfigDir returns the directory of the docker CLI configuration.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+// writeDockerConfig writes a docker CLI configuration to a temporary
+// directory, which only the current user can read, in which the credentials
+// of the registry of image are those configured with UseRegistryAuth. The
+// rest of the configuration of the current user is kept, and its docker
+// contexts are linked, such that the docker CLI connects to the same daemon.
+func writeDockerConfig(executor exec.Interface, image string) (string, error) {
+	auth, err := registryAuthEntry(executor, image)
+	if err != nil {
+		return "", err
+	}
+	config := map[string]interface{}{}
+	b, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+	if err == nil {
+		if err := json.Unmarshal(b, &config); err != nil {
+			return "", errors.Wrap(err, "failed to parse docker configuration")
+		}
+	} else if !os.IsNotExist(err) {
+		return "", errors.Wrap(err, "failed to read docker configuration")
+	}
+	registry := registryOf(image)
+	// Credential helpers of the registry, and the credentials store, take
+	// precedence over the auths of the configuration.
+	delete(config, "credsStore")
+	if helpers, ok := config["credHelpers"].(map[string]interface{}); ok {
+		delete(helpers, registry)
+	}
+	key := registry
+	if registry == "docker.io" {
+		key = dockerHubRegistry
+	}
+	config["auths"] = map[string]interface{}{key: auth}
+	b, err = json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	dir, err := util.CreateTmpDir("dockerConfig")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), b, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	contexts := filepath.Join(dockerConfigDir(), "contexts")
+	if _, err := os.Stat(contexts); err == nil {
+		if err := os.Symlink(contexts, filepath.Join(dir, "contexts")); err != nil {
+			os.RemoveAll(dir)
+			return "", errors.Wrap(err, "failed to link docker contexts")
+		}
+	}
+	return dir, nil
+}
+
+// runCredentialHelper returns the credentials of registry printed by the
+// docker credential helper named helper, or nil if it has none.
+func runCredentialHelper(executor exec.Interface, helper string, registry string) (*registryCredentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := executor.Command("docker-credential-"+helper, "get")
+	cmd.SetStdin(strings.NewReader(registry))
+	cmd.SetStdout(&stdout)
+	cmd.SetStderr(&stderr)
+	if err := cmd.Run(); err != nil {
+		// Helpers print this message for registries that they store no
+		// credentials of.
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "credential helper docker-credential-%s failed for registry %s: %s", helper, registry, strings.TrimSpace(stderr.String()))
+	}
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return nil, errors.Wrapf(err, "invalid output of credential helper docker-credential-%s", helper)
+	}
+	// Helpers return identity tokens with the <token> username.
+	if creds.Username == "<token>" {
+		return &registryCredentials{IdentityToken: creds.Secret, ServerAddress: registry}, nil
+	}
+	return &registryCredentials{Username: creds.Username, Password: creds.Secret, ServerAddress: registry}, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestLookupRegistryCredentials(t *testing.T) {
+	defer UseRegistryAuth(nil)
+	defer os.Setenv("MIRROR_PASSWORD", os.Getenv("MIRROR_PASSWORD"))
+	os.Setenv("MIRROR_PASSWORD", "s3cr3t")
+
+	testCases := []struct {
+		name         string
+		image        string
+		auths        map[string]RegistryAuth
+		runs         []testingexec.FakeRunAction
+		expected     *registryCredentials
+		expectedArgs [][]string
+		expectErr    string
+	}{{
+		name:  "Configured credential helper",
+		image: "europe-docker.pkg.dev/project/gcr-mirror/autogen",
+		auths: map[string]RegistryAuth{"europe-docker.pkg.dev": {CredentialHelper: "gcr"}},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) {
+				return []byte(`{"Username": "<token>", "Secret": "refresh"}`), nil, nil
+			},
+		},
+		expected:     &registryCredentials{IdentityToken: "refresh", ServerAddress: "europe-docker.pkg.dev"},
+		expectedArgs: [][]string{{"docker-credential-gcr", "get"}},
+	}, {
+		name:  "Credential helper without credentials",
+		image: "us-docker.pkg.dev/project/repo/autogen:latest",
+		auths: map[string]RegistryAuth{"us-docker.pkg.dev": {CredentialHelper: "desktop"}},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) {
+				return []byte("credentials not found in native keychain\n"), nil, testingexec.FakeExitError{Status: 1}
+			},
+		},
+		expectedArgs: [][]string{{"docker-credential-desktop", "get"}},
+	}, {
+		name:     "Configured password",
+		image:    "registry.corp.example/mirror/autogen",
+		auths:    map[string]RegistryAuth{"registry.corp.example": {Username: "mirror", PasswordEnv: "MIRROR_PASSWORD"}},
+		expected: &registryCredentials{Username: "mirror", Password: "s3cr3t", ServerAddress: "registry.corp.example"},
+	}, {
+		name:      "Unset password",
+		image:     "registry.corp.example/mirror/autogen",
+		auths:     map[string]RegistryAuth{"registry.corp.example": {Username: "mirror", PasswordEnv: "UNSET_MIRROR_PASSWORD"}},
+		expectErr: "the password of registry registry.corp.example is not set in UNSET_MIRROR_PASSWORD",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.NoError(t, UseRegistryAuth(tc.auths))
+			fcmd := testingexec.FakeCmd{RunScript: tc.runs}
+			executor := &testingexec.FakeExec{}
+			for range tc.runs {
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+
+			creds, err := lookupRegistryCredentials(executor, tc.image)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, creds)
+			assert.Equal(t, tc.expectedArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestUseRegistryAuth(t *testing.T) {
+	defer UseRegistryAuth(nil)
+	assert.EqualError(t, UseRegistryAuth(map[string]RegistryAuth{"gcr.io": {Username: "ci"}}),
+		"registryAuth of gcr.io must set a credentialHelper, or a username and a passwordEnv")
+	assert.EqualError(t, UseRegistryAuth(map[string]RegistryAuth{"gcr.io": {CredentialHelper: "gcloud", Username: "ci"}}),
+		"registryAuth of gcr.io sets both credentialHelper and username")
+}
+
+func TestDockerPullWithRegistryAuth(t *testing.T) {
+	defer UseRegistryAuth(nil)
+	defer os.Setenv("MIRROR_PASSWORD", os.Getenv("MIRROR_PASSWORD"))
+	defer os.Setenv("DOCKER_CONFIG", os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("MIRROR_PASSWORD", "s3cr3t")
+	assert.NoError(t, UseRegistryAuth(map[string]RegistryAuth{"registry.corp.example": {Username: "mirror", PasswordEnv: "MIRROR_PASSWORD"}}))
+	userConfig, err := ioutil.TempDir("", "dockerconfig")
+	assert.NoError(t, err)
+	defer os.RemoveAll(userConfig)
+	os.Setenv("DOCKER_CONFIG", userConfig)
+	assert.NoError(t, os.MkdirAll(filepath.Join(userConfig, "contexts", "meta"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(userConfig, "config.json"), []byte(`{
+  "currentContext": "remote",
+  "credsStore": "desktop",
+  "credHelpers": {"registry.corp.example": "corp", "gcr.io": "gcloud"}
+}`), 0600))
+
+	var configDir string
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd {
+			configDir = args[1]
+			b, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{
+  "currentContext": "remote",
+  "credHelpers": {"gcr.io": "gcloud"},
+  "auths": {"registry.corp.example": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("mirror:s3cr3t"))+`"}}
+}`, string(b))
+			contexts, err := os.Readlink(filepath.Join(configDir, "contexts"))
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(userConfig, "contexts"), contexts)
+			return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+		},
+	}}
+	runner := &dockerRunner{executor: fexec}
+
+	assert.NoError(t, runner.Pull(context.Background(), "registry.corp.example/mirror/autogen"))
+	assert.Equal(t, [][]string{{"docker", "--config", configDir, "pull", "registry.corp.example/mirror/autogen"}}, fcmd.RunLog)
+	_, err = os.Stat(configDir)
+	assert.True(t, os.IsNotExist(err), "the configuration is removed")
+}
+
+func TestPodmanPullWithRegistryAuth(t *testing.T) {
+	defer UseRegistryAuth(nil)
+	defer os.Setenv("MIRROR_PASSWORD", os.Getenv("MIRROR_PASSWORD"))
+	os.Setenv("MIRROR_PASSWORD", "s3cr3t")
+	assert.NoError(t, UseRegistryAuth(map[string]RegistryAuth{"registry.corp.example": {Username: "mirror", PasswordEnv: "MIRROR_PASSWORD"}}))
+
+	var authFile string
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+	}}
+	fexec := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd {
+			authFile = args[2]
+			b, err := ioutil.ReadFile(authFile)
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"auths": {"registry.corp.example": {"auth": "`+base64.StdEncoding.EncodeToString([]byte("mirror:s3cr3t"))+`"}}}`, string(b))
+			return testingexec.InitFakeCmd(&fcmd, cmd, args...)
+		},
+	}}
+	runner := &podmanRunner{executor: fexec}
+
+	assert.NoError(t, runner.Pull(context.Background(), "registry.corp.example/mirror/autogen"))
+	assert.Equal(t, [][]string{{"podman", "pull", "--authfile", authFile, "registry.corp.example/mirror/autogen"}}, fcmd.RunLog)
+	_, err := os.Stat(authFile)
+	assert.True(t, os.IsNotExist(err), "the auth file is removed")
+}
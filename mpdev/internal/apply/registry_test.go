@@ -16,6 +16,7 @@ package apply
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,17 +39,38 @@ func TestResolveFilePath(t *testing.T) {
 		// Relative path
 		"foo/2.txt":    filepath.Join(wd, "dir/foo/2.txt"),
 		"../foo/2.txt": filepath.Join(wd, "foo/2.txt"),
+		// Relative path set by the patch of an overlay
+		"prod.txt": filepath.Join(wd, "overlays/prod/prod.txt"),
 	}
 
 	for path, expected := range testCases {
 		registry := NewRegistry(exec.New())
 		registry.RegisterResource(r, "dir")
+		registry.SetPatchDirs(r, map[string]string{"prod.txt": "overlays/prod"})
 		resolvedPath, err := registry.ResolveFilePath(r, path)
 		assert.NoError(t, err)
 		assert.Equal(t, expected, resolvedPath)
 	}
 }
 
+func TestRegisterDuplicate(t *testing.T) {
+	r := NewRegistry(nil)
+	assert.NoError(t, r.RegisterResource(newTestResource("r1"), "solutions/a/mpdev"))
+	assert.NoError(t, r.RegisterResource(newTestResource("r2"), "solutions/b/mpdev"))
+	err := r.RegisterResource(newTestResource("r1"), "solutions/b/mpdev")
+	assert.EqualError(t, err, "resource testKind/r1 is defined more than once, in solutions/a/mpdev and in solutions/b/mpdev")
+	assert.Equal(t, "solutions/a/mpdev", r.(*registry).dirMap[newTestResource("r1").GetReference()])
+}
+
+func TestAutogenImage(t *testing.T) {
+	r := NewRegistry(nil)
+	assert.Equal(t, DefaultAutogenImage, r.GetAutogenImage())
+	r.SetAutogenImage("")
+	assert.Equal(t, DefaultAutogenImage, r.GetAutogenImage())
+	r.SetAutogenImage("gcr.io/partner/autogen:1.0")
+	assert.Equal(t, "gcr.io/partner/autogen:1.0", r.GetAutogenImage())
+}
+
 func TestApplyOrder(t *testing.T) {
 	order := 1
 	applyFunc := func(expectedOrder int) func(r Registry, dryRun bool) error {
@@ -152,3 +174,63 @@ func TestApplyError(t *testing.T) {
 	}
 
 }
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	var rs *testResource
+	rs = newTestResourceFunc("r1", func(r Registry, _ bool) error {
+		r.SetState(rs, "hash", "abc")
+		return nil
+	}, nil)
+	registry := NewRegistry(exec.New())
+	registry.RegisterResource(rs, dir)
+	assert.NoError(t, registry.LoadState(path))
+	assert.Equal(t, "", registry.GetState(rs, "hash"))
+
+	assert.NoError(t, registry.Apply(true))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "state file should not be written on dry run")
+
+	assert.NoError(t, registry.Apply(false))
+
+	registry = NewRegistry(exec.New())
+	assert.NoError(t, registry.LoadState(path))
+	assert.Equal(t, "abc", registry.GetState(rs, "hash"))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0644))
+	assert.Error(t, registry.LoadState(path))
+}
+
+func TestStateFilePath(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+	defer os.Setenv("XDG_CACHE_HOME", os.Getenv("XDG_CACHE_HOME"))
+	os.Setenv("XDG_CACHE_HOME", cacheDir)
+
+	path, err := StateFilePath("solutions/wordpress")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(cacheDir, "mpdev", "state"), filepath.Dir(path))
+	same, err := StateFilePath("./solutions/../solutions/wordpress")
+	assert.NoError(t, err)
+	assert.Equal(t, path, same, "state files are keyed by the absolute directory")
+	other, err := StateFilePath("solutions/drupal")
+	assert.NoError(t, err)
+	assert.NotEqual(t, path, other)
+
+	var rs *testResource
+	rs = newTestResourceFunc("r1", func(r Registry, _ bool) error {
+		r.SetState(rs, "hash", "abc")
+		return nil
+	}, nil)
+	registry := NewRegistry(exec.New())
+	registry.RegisterResource(rs, "solutions/wordpress")
+	assert.NoError(t, registry.LoadState(path))
+	assert.NoError(t, registry.Apply(false))
+	_, err = os.Stat(path)
+	assert.NoError(t, err, "the directory of the state file is created")
+}
@@ -0,0 +1,215 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const releaseTimeout = 5 * time.Minute
+
+var (
+	// releaseAPIURL is the GitHub API returning the latest release of mpdev.
+	releaseAPIURL = "https://api.github.com/repos/GoogleCloudPlatform/marketplace-tools/releases/latest"
+	// releaseDownloadURL is the URL that release archives are downloaded
+	// from.
+	releaseDownloadURL = "https://github.com/GoogleCloudPlatform/marketplace-tools/releases/download"
+)
+
+// releaseVersionRegex matches release tags, such as v0.1.0.
+var releaseVersionRegex = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+
+// releasePlatforms are the operating systems and architectures that
+// release archives are built for.
+var releasePlatforms = map[string]bool{"darwin/amd64": true, "linux/amd64": true}
+
+// LatestRelease returns the tag of the latest release of mpdev, such as
+// v0.1.0.
+func LatestRelease() (string, error) {
+	client := &http.Client{Timeout: releaseTimeout}
+	resp, err := client.Get(releaseAPIURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get latest release of mpdev")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get latest release of mpdev: %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", errors.Wrap(err, "failed to parse latest release of mpdev")
+	}
+	if !releaseVersionRegex.MatchString(release.TagName) {
+		return "", fmt.Errorf("latest release of mpdev has an invalid tag: %q", release.TagName)
+	}
+	return release.TagName, nil
+}
+
+// IsNewerRelease returns whether release is newer than version. A version
+// that is not a release, such as a build from source, is older than every
+// release.
+func IsNewerRelease(release string, version string) bool {
+	r := releaseVersionRegex.FindStringSubmatch(release)
+	if r == nil {
+		return false
+	}
+	v := releaseVersionRegex.FindStringSubmatch(version)
+	if v == nil {
+		return true
+	}
+	for i := 1; i < len(r); i++ {
+		a, _ := strconv.Atoi(r[i])
+		b, _ := strconv.Atoi(v[i])
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// ReleaseArchiveURL returns the URL of the archive containing the mpdev
+// binary of a release, for the given operating system and architecture.
+func ReleaseArchiveURL(release string, goos string, goarch string) string {
+	return fmt.Sprintf("%s/%s/mpdev_%s_%s_%s.tar.gz", releaseDownloadURL, release, goos, goarch, release)
+}
+
+// releaseChecksumsURL returns the URL of the SHA-256 checksums of the
+// archives of a release, in the format of sha256sum.
+func releaseChecksumsURL(release string) string {
+	return fmt.Sprintf("%s/%s/mpdev_%s_checksums.txt", releaseDownloadURL, release, release)
+}
+
+// InstallRelease downloads the mpdev binary of a release and replaces the
+// binary at path with it. path is only replaced once the archive of the
+// binary has been downloaded completely, and its SHA-256 checksum matches
+// the one published with the release.
+func InstallRelease(release string, goos string, goarch string, path string) error {
+	if !releasePlatforms[goos+"/"+goarch] {
+		return fmt.Errorf("mpdev releases are not built for %s/%s", goos, goarch)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: releaseTimeout}
+	url := ReleaseArchiveURL(release, goos, goarch)
+	checksums, err := download(client, releaseChecksumsURL(release))
+	if err != nil {
+		return err
+	}
+	expected, err := releaseChecksum(checksums, filepath.Base(url))
+	if err != nil {
+		return errors.Wrapf(err, "failed to verify %s", url)
+	}
+	archive, err := download(client, url)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(archive); hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("failed to verify %s: its SHA-256 checksum is %x instead of %s", url, sum, expected)
+	}
+
+	// The binary is written next to path, such that it can be renamed
+	// over path.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".mpdev-update")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = extractBinary(bytes.NewReader(archive), tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to extract mpdev from %s", url)
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// download returns the content at url.
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return b, errors.Wrapf(err, "failed to download %s", url)
+}
+
+// releaseChecksum returns the SHA-256 checksum of the file name in the
+// checksums of a release, whose lines are a hex checksum followed by a file
+// name, as printed by sha256sum.
+func releaseChecksum(checksums []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("the checksums of the release do not contain %s", name)
+}
+
+// extractBinary writes the mpdev binary in a release archive to w.
+func extractBinary(r io.Reader, w io.Writer) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return errors.New("archive does not contain mpdev")
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == "mpdev" {
+			_, err := io.Copy(w, tr)
+			return err
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNewerRelease(t *testing.T) {
+	testCases := []struct {
+		release  string
+		version  string
+		expected bool
+	}{
+		{release: "v0.2.0", version: "v0.1.9", expected: true},
+		{release: "v0.10.0", version: "v0.9.0", expected: true},
+		{release: "v1.0.0", version: "v1.0.0", expected: false},
+		{release: "v0.1.0", version: "v0.2.0", expected: false},
+		{release: "v0.1.0", version: "", expected: true},
+		{release: "latest", version: "v0.1.0", expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.release+" "+tc.version, func(t *testing.T) {
+			assert.Equal(t, tc.expected, IsNewerRelease(tc.release, tc.version))
+		})
+	}
+}
+
+func releaseArchive(t *testing.T, binary string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for name, contents := range map[string]string{"LICENSE": "license", "mpdev": binary} {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(contents))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return b.Bytes()
+}
+
+func TestInstallRelease(t *testing.T) {
+	archive := releaseArchive(t, "new mpdev")
+	checksums := fmt.Sprintf("%x  mpdev_linux_amd64_v0.3.0.tar.gz\n", sha256.Sum256(archive))
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/latest":
+			_, _ = w.Write([]byte(`{"tag_name": "v0.3.0"}`))
+		case "/download/v0.3.0/mpdev_v0.3.0_checksums.txt":
+			_, _ = w.Write([]byte(checksums))
+		case "/download/v0.3.0/mpdev_linux_amd64_v0.3.0.tar.gz", "/download/v0.5.0/mpdev_linux_amd64_v0.5.0.tar.gz":
+			_, _ = w.Write(archive)
+		case "/download/v0.5.0/mpdev_v0.5.0_checksums.txt":
+			_, _ = w.Write([]byte("0123abcd  mpdev_linux_amd64_v0.5.0.tar.gz\n"))
+		case "/download/v0.6.0/mpdev_v0.6.0_checksums.txt":
+			_, _ = w.Write([]byte(checksums))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	apiURL, downloadURL := releaseAPIURL, releaseDownloadURL
+	defer func() { releaseAPIURL, releaseDownloadURL = apiURL, downloadURL }()
+	releaseAPIURL = server.URL + "/latest"
+	releaseDownloadURL = server.URL + "/download"
+
+	release, err := LatestRelease()
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.3.0", release)
+
+	dir, err := ioutil.TempDir("", "release")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mpdev")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("old mpdev"), 0700))
+
+	assert.NoError(t, InstallRelease(release, "linux", "amd64", path))
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "new mpdev", string(b))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0711), info.Mode().Perm())
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("installed mpdev"), 0700))
+	err = InstallRelease("v0.4.0", "linux", "amd64", path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "404 Not Found")
+
+	// The archive does not match the published checksum.
+	err = InstallRelease("v0.5.0", "linux", "amd64", path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "its SHA-256 checksum is")
+	assert.Contains(t, err.Error(), "instead of 0123abcd")
+
+	// The checksums do not contain the archive.
+	err = InstallRelease("v0.6.0", "linux", "amd64", path)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "the checksums of the release do not contain mpdev_linux_amd64_v0.6.0.tar.gz")
+
+	b, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "installed mpdev", string(b))
+
+	err = InstallRelease(release, "windows", "amd64", path)
+	assert.EqualError(t, err, "mpdev releases are not built for windows/amd64")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, []string{"/latest", "/download/v0.3.0/mpdev_v0.3.0_checksums.txt",
+		"/download/v0.3.0/mpdev_linux_amd64_v0.3.0.tar.gz", "/download/v0.4.0/mpdev_v0.4.0_checksums.txt",
+		"/download/v0.5.0/mpdev_v0.5.0_checksums.txt", "/download/v0.5.0/mpdev_linux_amd64_v0.5.0.tar.gz",
+		"/download/v0.6.0/mpdev_v0.6.0_checksums.txt"}, requests)
+}
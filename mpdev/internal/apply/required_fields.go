@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// requiredFields are the top-level string fields of each kind that a
+// resource fails to apply without.
+var requiredFields = map[string][]string{
+	"ContainerImage":              {"context", "image"},
+	"DaisyGceImageBuilder":        {"projectId", "workflow"},
+	"DeploymentManagerDeployment": {"projectId"},
+	"DeploymentManagerPreview":    {"projectId"},
+	"DeploymentManagerTemplate":   {"zipFilePath"},
+	"GceImageLicenseCheck":        {"projectId"},
+	"HelmChart":                   {"dir", "destination"},
+	"IAMPolicy":                   {"projectId"},
+	"ImageTest":                   {"projectId", "family", "zone"},
+	"OrgPolicyCheck":              {"projectId"},
+	"PackerGceImageBuilder":       {"projectId"},
+	"QuotaCheck":                  {"projectId"},
+	"SaaSIntegration":             {"providerId", "entitlementId"},
+	"TerraformModule":             {"dir", "zipFilePath"},
+	"UsageReport":                 {"serviceName", "consumerId"},
+}
+
+// MissingFields returns the required fields of a resource that are not set,
+// such that they can be asked for before the resource is applied.
+func MissingFields(obj Unstructured) []string {
+	typeMeta := obj.getTypeMeta()
+	if typeMeta.APIVersion != apiVersion {
+		return nil
+	}
+	var missing []string
+	for _, field := range requiredFields[typeMeta.Kind] {
+		switch v := obj[field].(type) {
+		case nil:
+			missing = append(missing, field)
+		case string:
+			if v == "" {
+				missing = append(missing, field)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				missing = append(missing, field)
+			}
+		}
+	}
+	return missing
+}
+
+// SetField sets a top-level string field of the resource with the given kind
+// and name in a configuration file. An empty value of the field is replaced,
+// otherwise the field is added at the end of the resource. The rest of the
+// file, including comments, is unchanged.
+func SetField(in []byte, kind string, name string, field string, value string) ([]byte, error) {
+	// A double-quoted Go string is also a valid double-quoted yaml string.
+	line := fmt.Sprintf("%s: %s", field, strconv.Quote(value))
+	emptyField := regexp.MustCompile(fmt.Sprintf(`(?m)^%s:[ \t]*(""|''|\[\])?[ \t]*(#.*)?$`, regexp.QuoteMeta(field)))
+
+	docs, separators := splitDocuments(in)
+	for i, doc := range docs {
+		var obj Unstructured
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse document %d", i+1)
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		if obj.getTypeMeta().Kind != kind || metadata["name"] != name {
+			continue
+		}
+
+		if loc := emptyField.FindStringIndex(doc); loc != nil {
+			docs[i] = doc[:loc[0]] + line + doc[loc[1]:]
+		} else {
+			trimmed := strings.TrimRight(doc, "\n")
+			trailing := doc[len(trimmed):]
+			if trailing == "" {
+				trailing = "\n"
+			}
+			docs[i] = trimmed + "\n" + line + trailing
+		}
+		return joinDocuments(docs, separators), nil
+	}
+	return nil, fmt.Errorf("resource %s/%s not found", kind, name)
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		obj      Unstructured
+		expected []string
+	}{{
+		name:     "Missing",
+		obj:      Unstructured{"apiVersion": apiVersion, "kind": "TerraformModule", "dir": "terraform", "zipFilePath": []interface{}{}},
+		expected: []string{"zipFilePath"},
+	}, {
+		name:     "Empty string",
+		obj:      Unstructured{"apiVersion": apiVersion, "kind": "SaaSIntegration", "providerId": ""},
+		expected: []string{"providerId", "entitlementId"},
+	}, {
+		name: "Set",
+		obj:  Unstructured{"apiVersion": apiVersion, "kind": "DeploymentManagerTemplate", "zipFilePath": "gs://bucket/a.zip"},
+	}, {
+		name: "Not an mpdev resource",
+		obj:  Unstructured{"apiVersion": "v1", "kind": "DeploymentManagerTemplate"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, MissingFields(tc.obj))
+		})
+	}
+}
+
+func TestSetField(t *testing.T) {
+	config := `# autogen template
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerAutogenTemplate
+metadata:
+  name: autogen
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: DeploymentManagerTemplate
+metadata:
+  name: dmtemplate
+deploymentManagerRef:
+  name: autogen # the template above
+zipFilePath: "" # set before release
+
+---
+apiVersion: dev.marketplace.cloud.google.com/v1alpha1
+kind: UsageReport
+metadata:
+  name: usage
+serviceName: solution.endpoints.partner.cloud.goog`
+
+	testCases := []struct {
+		name        string
+		kind        string
+		resource    string
+		field       string
+		value       string
+		expected    string
+		expectedErr string
+	}{{
+		name:     "Replace empty field",
+		kind:     "DeploymentManagerTemplate",
+		resource: "dmtemplate",
+		field:    "zipFilePath",
+		value:    "gs://bucket/solution.zip",
+		expected: `zipFilePath: "gs://bucket/solution.zip"
+
+---`,
+	}, {
+		name:     "Add field",
+		kind:     "UsageReport",
+		resource: "usage",
+		field:    "consumerId",
+		value:    "project:my-project",
+		expected: "serviceName: solution.endpoints.partner.cloud.goog\nconsumerId: \"project:my-project\"\n",
+	}, {
+		name:        "Unknown resource",
+		kind:        "UsageReport",
+		resource:    "other",
+		field:       "consumerId",
+		value:       "project:my-project",
+		expectedErr: "resource UsageReport/other not found",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := SetField([]byte(config), tc.kind, tc.resource, tc.field, tc.value)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, string(out), tc.expected)
+			assert.Contains(t, string(out), "# autogen template\n")
+			assert.Contains(t, string(out), "name: autogen # the template above\n")
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package apply
 
 import (
+	"encoding/json"
 	"strings"
 )
 
@@ -68,3 +69,23 @@ type Metadata struct {
 	Name        string
 	Annotations map[string]string
 }
+
+// StringList is a list of strings that can also be specified as a single
+// string in configuration files.
+type StringList []string
+
+// UnmarshalJSON unmarshals either a string or a list of strings.
+func (l *StringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
@@ -14,6 +14,13 @@
 
 package apply
 
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
 type testResource struct {
 	BaseResource
 	applyFunc func(r Registry, dryRun bool) error
@@ -48,3 +55,20 @@ func newTestResourceFunc(name string, applyFunc func(Registry, bool) error, depF
 		depFunc:   depFunc,
 	}
 }
+
+func TestStringListUnmarshal(t *testing.T) {
+	testCases := map[string]StringList{
+		`"gs://bucket/dm.zip"`:                   {"gs://bucket/dm.zip"},
+		`["gs://bucket/dm.zip", "local/dm.zip"]`: {"gs://bucket/dm.zip", "local/dm.zip"},
+	}
+
+	for in, expected := range testCases {
+		var l StringList
+		err := json.Unmarshal([]byte(in), &l)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, l)
+	}
+
+	var l StringList
+	assert.Error(t, json.Unmarshal([]byte(`{"path": "dm.zip"}`), &l))
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const procurementAPI = "https://cloudcommerceprocurement.googleapis.com/v1"
+
+// procurementPollInterval is how often the state of an entitlement is
+// checked while waiting for it to become active.
+var procurementPollInterval = 10 * time.Second
+
+const (
+	accountActivationRequested     = "ACCOUNT_ACTIVATION_REQUESTED"
+	accountActive                  = "ACCOUNT_ACTIVE"
+	entitlementActivationRequested = "ENTITLEMENT_ACTIVATION_REQUESTED"
+	entitlementActive              = "ENTITLEMENT_ACTIVE"
+)
+
+// SaaSIntegration tests the integration of a SaaS solution with the Partner
+// Procurement API, using an entitlement created by a test purchase of the
+// solution. The account and entitlement of the purchase are approved, as
+// the partner backend would, and their states are verified to become
+// active. See https://cloud.google.com/marketplace/docs/partners/integrated-saas/backend-integration
+type SaaSIntegration struct {
+	BaseResource
+	// ProviderID of the partner
+	ProviderID string `json:"providerId"`
+	// AccountID of the test account. If set, the account is approved if its
+	// activation was requested.
+	AccountID string `json:"accountId"`
+	// EntitlementID of the test purchase
+	EntitlementID string `json:"entitlementId"`
+	// Timeout to wait for the entitlement to become active. Defaults to 5m
+	Timeout string
+}
+
+type procurementAccount struct {
+	State string `json:"state"`
+}
+
+type procurementEntitlement struct {
+	State string `json:"state"`
+	Plan  string `json:"plan"`
+}
+
+// Apply approves the test account and entitlement and verifies that they
+// become active.
+func (s *SaaSIntegration) Apply(registry Registry, dryRun bool) error {
+	if s.ProviderID == "" {
+		return errors.New("providerId cannot be empty for SaaS integration test")
+	}
+	if s.EntitlementID == "" {
+		return errors.New("entitlementId cannot be empty for SaaS integration test")
+	}
+	timeout := 5 * time.Minute
+	if s.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(s.Timeout)
+		if err != nil {
+			return errors.Wrapf(err, "invalid timeout: %s", s.Timeout)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	if s.AccountID != "" {
+		state, err := s.approveAccount(registry)
+		if err != nil {
+			return err
+		}
+		registry.SetOutput(s, "accountState", state)
+	}
+
+	state, err := s.approveEntitlement(registry, timeout)
+	if err != nil {
+		return err
+	}
+	registry.SetOutput(s, "entitlementState", state)
+	fmt.Printf("Entitlement %s is active\n", s.EntitlementID)
+	return nil
+}
+
+func (s *SaaSIntegration) approveAccount(registry Registry) (string, error) {
+	executor := registry.GetExecutor()
+	url := fmt.Sprintf("%s/providers/%s/accounts/%s", procurementAPI, s.ProviderID, s.AccountID)
+
+	var account procurementAccount
+	err := callGoogleAPI(executor, "GET", url, nil, &account)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get account %s", s.AccountID)
+	}
+	fmt.Printf("Account %s is in state %s\n", s.AccountID, account.State)
+
+	if account.State == accountActivationRequested {
+		body := map[string]string{"approvalName": "signup", "reason": "Approved by mpdev SaaS integration test"}
+		err = callGoogleAPI(executor, "POST", url+":approve", body, nil)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to approve account %s", s.AccountID)
+		}
+		err = callGoogleAPI(executor, "GET", url, nil, &account)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get account %s", s.AccountID)
+		}
+	}
+
+	if account.State != accountActive {
+		return "", fmt.Errorf("account %s is in state %s, expected %s", s.AccountID, account.State, accountActive)
+	}
+	return account.State, nil
+}
+
+func (s *SaaSIntegration) approveEntitlement(registry Registry, timeout time.Duration) (string, error) {
+	executor := registry.GetExecutor()
+	url := fmt.Sprintf("%s/providers/%s/entitlements/%s", procurementAPI, s.ProviderID, s.EntitlementID)
+
+	var entitlement procurementEntitlement
+	err := callGoogleAPI(executor, "GET", url, nil, &entitlement)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get entitlement %s", s.EntitlementID)
+	}
+	fmt.Printf("Entitlement %s for plan %s is in state %s\n", s.EntitlementID, entitlement.Plan, entitlement.State)
+
+	switch entitlement.State {
+	case entitlementActive:
+		return entitlement.State, nil
+	case entitlementActivationRequested:
+	default:
+		return "", fmt.Errorf("entitlement %s is in state %s, expected %s or %s",
+			s.EntitlementID, entitlement.State, entitlementActivationRequested, entitlementActive)
+	}
+
+	err = callGoogleAPI(executor, "POST", url+":approve", map[string]string{}, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to approve entitlement %s", s.EntitlementID)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err = callGoogleAPI(executor, "GET", url, nil, &entitlement)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to get entitlement %s", s.EntitlementID)
+		}
+		if entitlement.State == entitlementActive {
+			return entitlement.State, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("entitlement %s is in state %s after %s, expected %s",
+				s.EntitlementID, entitlement.State, timeout, entitlementActive)
+		}
+		time.Sleep(procurementPollInterval)
+	}
+}
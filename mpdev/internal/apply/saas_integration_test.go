@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestSaaSIntegration(t *testing.T) {
+	defer func(interval time.Duration) { procurementPollInterval = interval }(procurementPollInterval)
+	procurementPollInterval = time.Millisecond
+
+	account := procurementAPI + "/providers/partner/accounts/acct"
+	entitlement := procurementAPI + "/providers/partner/entitlements/ent"
+	testCases := []struct {
+		name             string
+		accountID        string
+		timeout          string
+		responses        []string
+		expectErr        bool
+		expectedRequests []string
+	}{{
+		name:      "Approve account and entitlement",
+		accountID: "acct",
+		responses: []string{
+			`{"state": "ACCOUNT_ACTIVATION_REQUESTED"}`, `{}`, `{"state": "ACCOUNT_ACTIVE"}`,
+			`{"state": "ENTITLEMENT_ACTIVATION_REQUESTED"}`, `{}`,
+			`{"state": "ENTITLEMENT_ACTIVATION_REQUESTED"}`, `{"state": "ENTITLEMENT_ACTIVE"}`,
+		},
+		expectedRequests: []string{
+			"GET " + account, "POST " + account + ":approve", "GET " + account,
+			"GET " + entitlement, "POST " + entitlement + ":approve", "GET " + entitlement, "GET " + entitlement,
+		},
+	}, {
+		name:             "Entitlement already active",
+		responses:        []string{`{"state": "ENTITLEMENT_ACTIVE"}`},
+		expectedRequests: []string{"GET " + entitlement},
+	}, {
+		name:             "Entitlement in unexpected state",
+		responses:        []string{`{"state": "ENTITLEMENT_CANCELLED"}`},
+		expectErr:        true,
+		expectedRequests: []string{"GET " + entitlement},
+	}, {
+		name:             "Account not approved",
+		accountID:        "acct",
+		responses:        []string{`{"state": "ACCOUNT_ACTIVATION_REQUESTED"}`, `error: 403`},
+		expectErr:        true,
+		expectedRequests: []string{"GET " + account, "POST " + account + ":approve"},
+	}, {
+		name:    "Entitlement does not become active",
+		timeout: "1ns",
+		responses: []string{
+			`{"state": "ENTITLEMENT_ACTIVATION_REQUESTED"}`, `{}`, `{"state": "ENTITLEMENT_ACTIVATION_REQUESTED"}`,
+		},
+		expectErr:        true,
+		expectedRequests: []string{"GET " + entitlement, "POST " + entitlement + ":approve", "GET " + entitlement},
+	}, {
+		name:      "Invalid timeout",
+		timeout:   "5",
+		expectErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			r := NewRegistry(fakeGoogleAPI(&fcmd, tc.responses...))
+
+			s := &SaaSIntegration{
+				BaseResource:  newTestBaseResource("SaaSIntegration", "saas"),
+				ProviderID:    "partner",
+				AccountID:     tc.accountID,
+				EntitlementID: "ent",
+				Timeout:       tc.timeout,
+			}
+			r.RegisterResource(s, "dir")
+
+			err := s.Apply(r, false)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "ENTITLEMENT_ACTIVE", r.GetOutputs(s.GetReference())["entitlementState"])
+			}
+			assert.Equal(t, tc.expectedRequests, apiRequests(&fcmd))
+		})
+	}
+}
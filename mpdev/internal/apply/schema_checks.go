@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// propertyIndexRegex matches properties["name"] in jinja and python
+	// templates.
+	propertyIndexRegex = regexp.MustCompile(`properties\[\s*['"]([A-Za-z0-9_-]+)['"]\s*\]`)
+	// propertyAttrRegex matches properties.name in jinja templates.
+	propertyAttrRegex = regexp.MustCompile(`properties\.([A-Za-z_][A-Za-z0-9_]*)`)
+	// typeRegex matches resources whose type is another template, such as
+	// type: vm.jinja or 'type': 'vm.py'.
+	typeRegex = regexp.MustCompile(`['"]?type['"]?\s*:\s*['"]?([A-Za-z0-9_./-]+\.(?:jinja|py))\b`)
+)
+
+// propertyMethods are the methods of the properties dictionary, which are
+// matched by propertyAttrRegex but are not property names.
+var propertyMethods = map[string]bool{"get": true, "items": true, "keys": true, "values": true}
+
+type templateSchema struct {
+	Imports []struct {
+		Path string `yaml:"path"`
+		Name string `yaml:"name"`
+	} `yaml:"imports"`
+	Required   []string               `yaml:"required"`
+	Properties map[string]interface{} `yaml:"properties"`
+	Outputs    map[string]interface{} `yaml:"outputs"`
+}
+
+// checkTemplateSchema cross-validates the main template of a Deployment
+// Manager template directory against its schema. Required properties that
+// are not defined and imports that do not exist are reported in the
+// returned error. The other checks match the template source with regular
+// expressions, which cannot follow properties and outputs built
+// dynamically, so their problems are returned as warnings: required
+// properties that are not used, properties used by the template that are
+// not defined, outputs of the schema that are not set by the template, and
+// templates used as resource types that are not imported.
+func checkTemplateSchema(dir string) ([]string, error) {
+	template, err := findMainTemplate(dir)
+	if err != nil {
+		// Missing templates and schemas are reported by checkPackageContents.
+		return nil, nil
+	}
+	name := filepath.Base(template)
+
+	contents, err := ioutil.ReadFile(template)
+	if err != nil {
+		return nil, err
+	}
+	schemaContents, err := ioutil.ReadFile(template + ".schema")
+	if err != nil {
+		return nil, err
+	}
+	var schema templateSchema
+	err = yaml.Unmarshal(schemaContents, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("DM template in %s failed schema checks:\n  - failed to parse %s.schema: %v", dir, name, err)
+	}
+	source := string(contents)
+
+	var problems, warnings []string
+	used := usedProperties(source)
+	for _, property := range schema.Required {
+		if _, ok := schema.Properties[property]; !ok {
+			problems = append(problems, fmt.Sprintf("required property %s is not defined in %s.schema", property, name))
+		}
+		if !used[property] {
+			warnings = append(warnings, fmt.Sprintf("required property %s may not be used by %s", property, name))
+		}
+	}
+	for property := range used {
+		if _, ok := schema.Properties[property]; !ok {
+			warnings = append(warnings, fmt.Sprintf("property %s seems to be used by %s but is not defined in %s.schema", property, name, name))
+		}
+	}
+
+	for _, output := range schemaOutputs(schema) {
+		outputRegex := regexp.MustCompile(`['"]?name['"]?\s*:\s*['"]?` + regexp.QuoteMeta(output) + `\b`)
+		if !outputRegex.MatchString(source) {
+			warnings = append(warnings, fmt.Sprintf("output %s of %s.schema may not be set by %s", output, name, name))
+		}
+	}
+
+	imported := map[string]bool{}
+	for _, imp := range schema.Imports {
+		imported[imp.Path] = true
+		if imp.Name != "" {
+			imported[imp.Name] = true
+		}
+		if _, err := os.Stat(filepath.Join(dir, imp.Path)); err != nil {
+			problems = append(problems, fmt.Sprintf("import %s of %s.schema does not exist", imp.Path, name))
+		}
+	}
+	for _, match := range typeRegex.FindAllStringSubmatch(source, -1) {
+		if !imported[match[1]] {
+			warnings = append(warnings, fmt.Sprintf("%s seems to use type %s, which is not imported by %s.schema", name, match[1], name))
+		}
+	}
+
+	if len(warnings) > 0 {
+		warnings = uniqueStrings(warnings)
+	}
+	if len(problems) == 0 {
+		return warnings, nil
+	}
+	problems = uniqueStrings(problems)
+	return warnings, fmt.Errorf("DM template in %s failed schema checks:\n  - %s", dir, strings.Join(problems, "\n  - "))
+}
+
+// usedProperties returns the properties a template reads without a default
+// value. Properties read with properties.get() are not included.
+func usedProperties(source string) map[string]bool {
+	used := map[string]bool{}
+	for _, match := range propertyIndexRegex.FindAllStringSubmatch(source, -1) {
+		used[match[1]] = true
+	}
+	for _, match := range propertyAttrRegex.FindAllStringSubmatch(source, -1) {
+		if !propertyMethods[match[1]] {
+			used[match[1]] = true
+		}
+	}
+	return used
+}
+
+// schemaOutputs returns the names of the outputs of a schema. Outputs are
+// either listed directly, or as properties of the outputs object.
+func schemaOutputs(schema templateSchema) []string {
+	outputs := schema.Outputs
+	if properties, ok := outputs["properties"].(map[string]interface{}); ok {
+		outputs = properties
+	}
+
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uniqueStrings returns the sorted distinct values of values.
+func uniqueStrings(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
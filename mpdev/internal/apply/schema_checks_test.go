@@ -0,0 +1,203 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `
+imports:
+- path: vm.jinja
+required:
+- zone
+properties:
+  zone:
+    type: string
+  machineType:
+    type: string
+    default: e2-small
+outputs:
+  vmSelfLink:
+    type: string
+`
+
+const testTemplate = `
+resources:
+- name: {{ env['deployment'] }}-vm
+  type: vm.jinja
+  properties:
+    zone: {{ properties['zone'] }}
+    machineType: {{ properties.machineType }}
+outputs:
+- name: vmSelfLink
+  value: $(ref.{{ env['deployment'] }}-vm.selfLink)
+`
+
+func TestCheckTemplateSchema(t *testing.T) {
+	testCases := []struct {
+		name             string
+		files            map[string]string
+		expectedProblems []string
+		expectedWarnings []string
+	}{{
+		name: "Schema matches jinja template",
+		files: map[string]string{
+			"solution.jinja":        testTemplate,
+			"solution.jinja.schema": testSchema,
+			"vm.jinja":              "resources: []",
+		},
+	}, {
+		name: "Schema matches python template",
+		files: map[string]string{
+			"solution.py": `
+def GenerateConfig(context):
+  zone = context.properties['zone']
+  machine_type = context.properties.get('machineType', 'e2-small')
+  return {
+      'resources': [{'name': 'vm', 'type': 'vm.jinja', 'properties': {'zone': zone}}],
+      'outputs': [{'name': 'vmSelfLink', 'value': '$(ref.vm.selfLink)'}],
+  }
+`,
+			"solution.py.schema": testSchema,
+			"vm.jinja":           "resources: []",
+		},
+	}, {
+		name: "Nested outputs",
+		files: map[string]string{
+			"solution.jinja": testTemplate,
+			"solution.jinja.schema": `
+imports:
+- path: vm.jinja
+outputs:
+  properties:
+    vmSelfLink:
+      type: string
+    adminUrl:
+      type: string
+properties:
+  zone: {}
+  machineType: {}
+`,
+			"vm.jinja": "resources: []",
+		},
+		expectedWarnings: []string{"output adminUrl of solution.jinja.schema may not be set by solution.jinja"},
+	}, {
+		name: "Schema does not match template",
+		files: map[string]string{
+			"solution.jinja": testTemplate + `
+- name: password
+  value: {{ properties['adminPassword'] }}
+`,
+			"solution.jinja.schema": `
+imports:
+- path: missing.jinja
+required:
+- zone
+- network
+- machineType
+properties:
+  zone:
+    type: string
+  machineType:
+    type: string
+outputs:
+  vmSelfLink:
+    type: string
+  adminUrl:
+    type: string
+`,
+		},
+		expectedProblems: []string{
+			"import missing.jinja of solution.jinja.schema does not exist",
+			"required property network is not defined in solution.jinja.schema",
+		},
+		expectedWarnings: []string{
+			"output adminUrl of solution.jinja.schema may not be set by solution.jinja",
+			"property adminPassword seems to be used by solution.jinja but is not defined in solution.jinja.schema",
+			"required property network may not be used by solution.jinja",
+			"solution.jinja seems to use type vm.jinja, which is not imported by solution.jinja.schema",
+		},
+	}, {
+		name: "Dynamic python template",
+		files: map[string]string{
+			"solution.py": `
+"""Deploys the VM of the solution, see type: vm.jinja in the README."""
+
+OUTPUTS = ['vmSelfLink']
+
+def GenerateConfig(context):
+  props = context.properties
+  outputs = [{'name': output, 'value': '$(ref.vm.%s)' % output} for output in OUTPUTS]
+  return {
+      'resources': [{'name': 'vm', 'type': 'compute.v1.instance', 'properties': {'zone': props['zone']}}],
+      'outputs': outputs,
+  }
+`,
+			"solution.py.schema": `
+required:
+- zone
+properties:
+  zone:
+    type: string
+outputs:
+  vmSelfLink:
+    type: string
+`,
+		},
+		expectedWarnings: []string{
+			"output vmSelfLink of solution.py.schema may not be set by solution.py",
+			"required property zone may not be used by solution.py",
+			"solution.py seems to use type vm.jinja, which is not imported by solution.py.schema",
+		},
+	}, {
+		name: "Invalid schema",
+		files: map[string]string{
+			"solution.jinja":        testTemplate,
+			"solution.jinja.schema": "required: {",
+		},
+		expectedProblems: []string{"failed to parse solution.jinja.schema"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "schema-checks")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for name, contents := range tc.files {
+				err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+				assert.NoError(t, err)
+			}
+
+			warnings, err := checkTemplateSchema(dir)
+			assert.Equal(t, tc.expectedWarnings, warnings)
+			if len(tc.expectedProblems) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.Error(t, err)
+			for _, problem := range tc.expectedProblems {
+				assert.Contains(t, err.Error(), problem)
+			}
+		})
+	}
+}
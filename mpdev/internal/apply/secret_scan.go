@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ignoreSecretMarker is a comment that excludes a line from secret scans,
+// such as a line of documentation containing an example key.
+const ignoreSecretMarker = "mpdev:ignore-secret"
+
+// secretPatterns match the secrets that are commonly published by mistake
+// in deployment packages, which are readable by anyone from the public
+// bucket of a listing.
+var secretPatterns = []struct {
+	kind  string
+	regex *regexp.Regexp
+}{
+	{"private key", regexp.MustCompile(`-----BEGIN ((RSA|DSA|EC|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`)},
+	{"service account key", regexp.MustCompile(`"private_key_id"\s*:\s*"[0-9a-f]{40}"`)},
+	{"Google API key", regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`)},
+	{"OAuth client secret", regexp.MustCompile(`GOCSPX-[0-9A-Za-z_-]{28}`)},
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[0-9A-Za-z]{36}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"default password", regexp.MustCompile(`(?i)(password|passwd|pwd)['"]?\s*[:=]\s*['"]?(admin|changeme|default|letmein|passw0rd|password|root|secret|toor|123456|12345678)['"]?([\s,;}]|$)`)},
+}
+
+// secretFinding is a line of a file that looks like it contains a secret.
+type secretFinding struct {
+	file string
+	line int
+	kind string
+}
+
+func (f secretFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.file, f.line, f.kind)
+}
+
+// scanSecrets returns the lines of the files in dir that contain secrets,
+// with paths relative to dir. Binary files and lines containing
+// ignoreSecretMarker are skipped.
+func scanSecrets(dir string) ([]secretFinding, error) {
+	var findings []secretFinding
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isBinary(contents) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		for i, text := range strings.Split(string(contents), "\n") {
+			if strings.Contains(text, ignoreSecretMarker) {
+				continue
+			}
+			for _, pattern := range secretPatterns {
+				if pattern.regex.MatchString(text) {
+					findings = append(findings, secretFinding{file: rel, line: i + 1, kind: pattern.kind})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].file != findings[j].file {
+			return findings[i].file < findings[j].file
+		}
+		return findings[i].line < findings[j].line
+	})
+	return findings, nil
+}
+
+// checkSecrets fails if the files in dir, which are about to be published
+// as description, contain secrets.
+func checkSecrets(dir string, description string) error {
+	findings, err := scanSecrets(dir)
+	if err != nil {
+		return err
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+	lines := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		lines = append(lines, finding.String())
+	}
+	return fmt.Errorf("%s contains possible secrets, which would be published. Remove them, or add %s to lines that are not secrets:\n  - %s",
+		description, ignoreSecretMarker, strings.Join(lines, "\n  - "))
+}
+
+// isBinary returns whether contents look like a binary file, which contain
+// NUL bytes unlike text files.
+func isBinary(contents []byte) bool {
+	head := contents
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanSecrets(t *testing.T) {
+	// Secrets are split, such that this file is not reported by scanners.
+	testCases := []struct {
+		name     string
+		contents string
+		expected []string
+	}{{
+		name:     "Private key",
+		contents: "key: |\n  -----BEGIN RSA PRIVATE" + " KEY-----\n  MIIEow\n",
+		expected: []string{"file:2: private key"},
+	}, {
+		name:     "OpenSSH key",
+		contents: "-----BEGIN OPENSSH PRIVATE" + " KEY-----\n",
+		expected: []string{"file:1: private key"},
+	}, {
+		name:     "Public key",
+		contents: "-----BEGIN PUBLIC KEY-----\n",
+	}, {
+		name:     "Service account key",
+		contents: `{"type": "service_account", "private_key_id": "` + "0123456789abcdef0123456789abcdef01234567" + `"}`,
+		expected: []string{"file:1: service account key"},
+	}, {
+		name:     "API keys and tokens",
+		contents: "MAPS_KEY=AIza" + "SyD-0123456789abcdefghijklmnopqrstu\nexport AWS_ACCESS_KEY_ID=AKIA" + "IOSFODNN7EXAMPLE\ntoken: ghp_" + "0123456789abcdefghijklmnopqrstuvwxyz\n",
+		expected: []string{"file:1: Google API key", "file:2: AWS access key", "file:3: GitHub token"},
+	}, {
+		name:     "Default passwords",
+		contents: "ADMIN_PASSWORD=changeme\n  'password': 'admin',\nmysql -u root --password=\"$(get_metadata_value mysql-password)\"\npassword: admin123\n",
+		expected: []string{"file:1: default password", "file:2: default password"},
+	}, {
+		name:     "Ignored line",
+		contents: "# Example: -----BEGIN RSA PRIVATE" + " KEY----- mpdev:ignore-secret\n",
+	}, {
+		name:     "Binary file",
+		contents: "\x00\x01-----BEGIN RSA PRIVATE" + " KEY-----\n",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "secrets")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte(tc.contents), 0644))
+
+			findings, err := scanSecrets(dir)
+			assert.NoError(t, err)
+			var actual []string
+			for _, finding := range findings {
+				actual = append(actual, finding.String())
+			}
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCheckSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "scripts"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), []byte("resources: []\n"), 0644))
+	assert.NoError(t, checkSecrets(dir, "DM template"))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "scripts/install.sh"), []byte("#!/bin/bash\nDB_PASSWORD=secret\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "id_rsa"), []byte("-----BEGIN RSA PRIVATE"+" KEY-----\n"), 0600))
+	err = checkSecrets(dir, "DM template")
+	assert.EqualError(t, err, "DM template contains possible secrets, which would be published. Remove them, or add mpdev:ignore-secret to lines that are not secrets:\n"+
+		"  - id_rsa:1: private key\n  - scripts/install.sh:2: default password")
+}
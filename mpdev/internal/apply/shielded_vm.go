@@ -0,0 +1,179 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	secureBootRegex   = regexp.MustCompile(`['"]?enableSecureBoot['"]?\s*:\s*['"]?(?i:true)`)
+	acceleratorsRegex = regexp.MustCompile(`['"]?guestAccelerators['"]?\s*:`)
+	migrateRegex      = regexp.MustCompile(`['"]?onHostMaintenance['"]?\s*:\s*['"]?MIGRATE`)
+	confidentialRegex = regexp.MustCompile(`['"]?enableConfidentialCompute['"]?\s*:\s*['"]?(?i:true)`)
+	// confidentialTypesRegex matches the machine series that support
+	// Confidential VM.
+	confidentialTypesRegex = regexp.MustCompile(`\b(?:n2d|n2|c2d|c3|c3d)-`)
+)
+
+// ShieldedVMCheck verifies that the images and generated templates of a
+// solution are compatible with Shielded VM, and optionally Confidential VM.
+// Images must support UEFI, and Confidential VM images must also support
+// SEV, and templates must enable Confidential Computing with
+// onHostMaintenance set to TERMINATE. Options that usually need extra care,
+// such as GPUs with Secure Boot or machine series that may not support
+// Confidential VM, are reported as warnings.
+// See https://cloud.google.com/compute/shielded-vm/docs/shielded-vm
+type ShieldedVMCheck struct {
+	BaseResource
+	// ProjectID of the project containing the image family
+	ProjectID string `json:"projectId"`
+	// Family of images that is checked. If empty, no image is checked
+	Family string
+	// DeploymentManagerRef optionally references the autogen template
+	// whose generated templates are checked
+	DeploymentManagerRef Reference
+	// ConfidentialVM additionally checks compatibility with Confidential VM
+	ConfidentialVM bool
+}
+
+// GetDependencies returns dependencies for ShieldedVMCheck
+func (c *ShieldedVMCheck) GetDependencies() (r []Reference) {
+	if c.DeploymentManagerRef != (Reference{}) {
+		r = append(r, c.DeploymentManagerRef)
+	}
+	return r
+}
+
+// Apply checks the image and templates.
+func (c *ShieldedVMCheck) Apply(registry Registry, dryRun bool) error {
+	if c.Family == "" && c.DeploymentManagerRef == (Reference{}) {
+		return errors.New("either family or deploymentManagerRef must be set for Shielded VM check")
+	}
+	if c.Family != "" && c.ProjectID == "" {
+		return errors.New("projectId cannot be empty for Shielded VM check of an image family")
+	}
+	var dmTemplate *DeploymentManagerAutogenTemplate
+	if c.DeploymentManagerRef != (Reference{}) {
+		var err error
+		dmTemplate, err = getAutogenTemplate(registry, c.DeploymentManagerRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	var problems, validated []string
+	if c.Family != "" {
+		image, err := describeImageFamily(registry, c.ProjectID, c.Family)
+		if err != nil {
+			return err
+		}
+		features := map[string]bool{}
+		for _, feature := range image.GuestOsFeatures {
+			features[feature.Type] = true
+		}
+		if !features["UEFI_COMPATIBLE"] {
+			problems = append(problems, fmt.Sprintf("image %s does not have guest OS feature UEFI_COMPATIBLE", image.Name))
+		}
+		if c.ConfidentialVM && !features["SEV_CAPABLE"] {
+			problems = append(problems, fmt.Sprintf("image %s does not have guest OS feature SEV_CAPABLE", image.Name))
+		}
+		validated = append(validated, fmt.Sprintf("image %s", image.Name))
+	}
+
+	if dmTemplate != nil {
+		templateProblems, warnings, err := checkShieldedTemplates(dmTemplate.outDir, c.ConfidentialVM)
+		if err != nil {
+			return errors.Wrap(err, "failed to check generated templates")
+		}
+		for _, warning := range warnings {
+			fmt.Printf("WARNING: %s\n", warning)
+		}
+		problems = append(problems, templateProblems...)
+		validated = append(validated, fmt.Sprintf("templates of %s", c.DeploymentManagerRef.Name))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Shielded VM check %s failed:\n  - %s", c.Metadata.Name, strings.Join(problems, "\n  - "))
+	}
+	compatibility := "Shielded VM"
+	if c.ConfidentialVM {
+		compatibility = "Shielded VM and Confidential VM"
+	}
+	fmt.Printf("Checked %s for compatibility with %s\n", strings.Join(validated, " and "), compatibility)
+	return nil
+}
+
+// checkShieldedTemplates returns the options of the templates in dir that
+// conflict with Shielded VM, or Confidential VM if confidential is set, and
+// warnings about options that may conflict with them.
+func checkShieldedTemplates(dir string, confidential bool) (problems []string, warnings []string, err error) {
+	var confidentialTemplates []string
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isTemplateFile(path) {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if secureBootRegex.Match(contents) && acceleratorsRegex.Match(contents) {
+			warnings = append(warnings, fmt.Sprintf("%s enables Secure Boot with GPUs, the image must install signed GPU drivers", rel))
+		}
+		if !confidential {
+			return nil
+		}
+		if migrateRegex.Match(contents) {
+			problems = append(problems, fmt.Sprintf("%s sets onHostMaintenance to MIGRATE, Confidential VMs require TERMINATE", rel))
+		}
+		if confidentialRegex.Match(contents) {
+			confidentialTemplates = append(confidentialTemplates, rel)
+			if !confidentialTypesRegex.Match(contents) {
+				warnings = append(warnings, fmt.Sprintf("%s enables Confidential Computing without an N2D, N2, C2D, C3 or C3D machine type, check that its machine type supports Confidential VM", rel))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if confidential && len(confidentialTemplates) == 0 {
+		problems = append(problems, "no template enables Confidential Computing with confidentialInstanceConfig")
+	}
+	sort.Strings(problems)
+	sort.Strings(warnings)
+	return problems, warnings, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestShieldedVMCheck(t *testing.T) {
+	uefiImage := `{"name": "wordpress-v1", "guestOsFeatures": [{"type": "UEFI_COMPATIBLE"}, {"type": "VIRTIO_SCSI_MULTIQUEUE"}]}`
+	sevImage := `{"name": "wordpress-v1", "guestOsFeatures": [{"type": "UEFI_COMPATIBLE"}, {"type": "SEV_CAPABLE"}]}`
+	biosImage := `{"name": "wordpress-v1", "guestOsFeatures": [{"type": "VIRTIO_SCSI_MULTIQUEUE"}]}`
+
+	shieldedVM := `
+resources:
+- name: vm
+  type: compute.v1.instance
+  properties:
+    machineType: zones/us-central1-a/machineTypes/e2-small
+    shieldedInstanceConfig:
+      enableSecureBoot: true
+`
+	confidentialVM := `
+resources:
+- name: vm
+  type: compute.v1.instance
+  properties:
+    machineType: zones/us-central1-a/machineTypes/n2d-standard-2
+    scheduling:
+      onHostMaintenance: TERMINATE
+    confidentialInstanceConfig:
+      enableConfidentialCompute: true
+`
+	gpuVM := shieldedVM + `
+    guestAccelerators:
+    - acceleratorType: nvidia-tesla-t4
+      acceleratorCount: 1
+    scheduling:
+      onHostMaintenance: MIGRATE
+`
+
+	testCases := []struct {
+		name         string
+		image        string
+		template     string
+		confidential bool
+		expectedErrs []string
+	}{{
+		name:     "Shielded VM compatible",
+		image:    uefiImage,
+		template: shieldedVM,
+	}, {
+		name:         "Confidential VM compatible",
+		image:        sevImage,
+		template:     confidentialVM,
+		confidential: true,
+	}, {
+		name:     "GPUs with Secure Boot",
+		image:    uefiImage,
+		template: gpuVM,
+	}, {
+		name:         "Image without UEFI",
+		image:        biosImage,
+		template:     shieldedVM,
+		expectedErrs: []string{"image wordpress-v1 does not have guest OS feature UEFI_COMPATIBLE"},
+	}, {
+		name:         "Not Confidential VM compatible",
+		image:        uefiImage,
+		template:     gpuVM,
+		confidential: true,
+		expectedErrs: []string{
+			"image wordpress-v1 does not have guest OS feature SEV_CAPABLE",
+			"solution.jinja sets onHostMaintenance to MIGRATE, Confidential VMs require TERMINATE",
+			"no template enables Confidential Computing with confidentialInstanceConfig",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "shielded-vm")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), []byte(tc.template), 0644))
+
+			image := tc.image
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return []byte(image), nil, nil },
+			}}
+			executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+			r := NewRegistry(executor)
+
+			autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+			autogen.outDir = dir
+			check := &ShieldedVMCheck{
+				BaseResource:         newTestBaseResource("ShieldedVMCheck", "shielded"),
+				ProjectID:            "test-project",
+				Family:               "wordpress",
+				DeploymentManagerRef: autogen.GetReference(),
+				ConfidentialVM:       tc.confidential,
+			}
+			r.RegisterResource(autogen, "dir")
+			r.RegisterResource(check, "dir")
+
+			err = check.Apply(r, false)
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, [][]string{{"gcloud", "compute", "images", "describe-from-family", "wordpress",
+				"--project", "test-project", "--format", "json"}}, fcmd.RunLog)
+		})
+	}
+}
+
+func TestCheckShieldedTemplates(t *testing.T) {
+	confidentialVM := `
+resources:
+- name: vm
+  type: compute.v1.instance
+  properties:
+    machineType: zones/us-central1-a/machineTypes/%s
+    scheduling:
+      onHostMaintenance: TERMINATE
+    confidentialInstanceConfig:
+      enableConfidentialCompute: true
+`
+	testCases := []struct {
+		name             string
+		template         string
+		confidential     bool
+		expectedProblems []string
+		expectedWarnings []string
+	}{{
+		name: "GPUs with Secure Boot",
+		template: `
+resources:
+- name: vm
+  properties:
+    shieldedInstanceConfig:
+      enableSecureBoot: true
+    guestAccelerators:
+    - acceleratorType: nvidia-tesla-t4
+`,
+		expectedWarnings: []string{"solution.jinja enables Secure Boot with GPUs, the image must install signed GPU drivers"},
+	}, {
+		name:         "Confidential VM on N2D",
+		template:     fmt.Sprintf(confidentialVM, "n2d-standard-2"),
+		confidential: true,
+	}, {
+		name:         "Confidential VM on C3",
+		template:     fmt.Sprintf(confidentialVM, "c3-standard-4"),
+		confidential: true,
+	}, {
+		name:         "Confidential VM on E2",
+		template:     fmt.Sprintf(confidentialVM, "e2-standard-2"),
+		confidential: true,
+		expectedWarnings: []string{"solution.jinja enables Confidential Computing without an N2D, N2, C2D, C3 or C3D machine type, " +
+			"check that its machine type supports Confidential VM"},
+	}, {
+		name:             "Confidential VM not enabled",
+		template:         "resources: []",
+		confidential:     true,
+		expectedProblems: []string{"no template enables Confidential Computing with confidentialInstanceConfig"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "shielded-vm")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), []byte(tc.template), 0644))
+
+			problems, warnings, err := checkShieldedTemplates(dir, tc.confidential)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedProblems, problems)
+			assert.Equal(t, tc.expectedWarnings, warnings)
+		})
+	}
+}
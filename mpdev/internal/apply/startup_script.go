@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// StartupScript checks VM startup scripts included in a solution. Each
+// script is parsed with the shell of its #! line, which defaults to bash,
+// and linted with shellcheck, which flags problems such as unquoted
+// variables and bash features used in /bin/sh scripts.
+type StartupScript struct {
+	BaseResource
+	// DeploymentManagerRef optionally references the autogen template the
+	// scripts are included in, in which case Files are relative to the root
+	// of the generated template.
+	DeploymentManagerRef Reference
+	// Files of the startup scripts
+	Files []string
+	// SignalsWaiter requires every script to signal a Runtime
+	// Configurator waiter, without which deployments time out.
+	SignalsWaiter bool
+	// SkipShellcheck only parses the scripts
+	SkipShellcheck bool
+}
+
+// GetDependencies returns dependencies for StartupScript
+func (s *StartupScript) GetDependencies() (r []Reference) {
+	if s.DeploymentManagerRef != (Reference{}) {
+		r = append(r, s.DeploymentManagerRef)
+	}
+	return r
+}
+
+// Apply parses and lints the startup scripts.
+func (s *StartupScript) Apply(registry Registry, dryRun bool) error {
+	if len(s.Files) == 0 {
+		return errors.New("files cannot be empty for startup script")
+	}
+	var dmTemplate *DeploymentManagerAutogenTemplate
+	if s.DeploymentManagerRef != (Reference{}) {
+		var err error
+		dmTemplate, err = getAutogenTemplate(registry, s.DeploymentManagerRef)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	var problems []string
+	for _, path := range s.Files {
+		file, err := s.resolveFile(registry, dmTemplate, path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve path to startup script: %s", path)
+		}
+
+		scriptProblems, err := s.check(registry, file)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check startup script %s", path)
+		}
+		for _, problem := range scriptProblems {
+			problems = append(problems, fmt.Sprintf("%s: %s", path, problem))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("startup scripts %s failed checks:\n  - %s", s.Metadata.Name, strings.Join(problems, "\n  - "))
+	}
+	fmt.Printf("Startup scripts %s passed checks\n", s.Metadata.Name)
+	return nil
+}
+
+func (s *StartupScript) resolveFile(registry Registry, dmTemplate *DeploymentManagerAutogenTemplate, path string) (string, error) {
+	if dmTemplate == nil {
+		return registry.ResolveFilePath(s, path)
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(filepath.Clean(path), "..") {
+		return "", fmt.Errorf("path must be relative to the root of the template: %s", path)
+	}
+	return filepath.Join(dmTemplate.outDir, path), nil
+}
+
+func (s *StartupScript) check(registry Registry, file string) ([]string, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	shell := scriptShell(contents)
+	executor := registry.GetExecutor()
+
+	var problems []string
+	_, err = runCommandOutput(executor, shell, "-n", file)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s failed to parse script: %v", shell, err))
+	}
+
+	if !s.SkipShellcheck {
+		stdout, err := runCommandOutput(executor, "shellcheck", "--format", "gcc", "--shell", shell, file)
+		findings := nonEmptyLines(stdout)
+		// shellcheck exits with a non-zero status if it reports findings.
+		if err != nil && len(findings) == 0 {
+			return nil, errors.Wrap(err, "failed to run shellcheck")
+		}
+		for _, finding := range findings {
+			// Findings are formatted as file:line:column: level: message.
+			problems = append(problems, strings.TrimPrefix(finding, file+":"))
+		}
+	}
+
+	if s.SignalsWaiter && !waiterSignalRegex.Match(contents) {
+		problems = append(problems, "script does not signal the deployment waiter")
+	}
+	return problems, nil
+}
+
+// scriptShell returns the shell a script is run with, according to its #!
+// line.
+func scriptShell(contents []byte) string {
+	line, _ := bufio.NewReader(bytes.NewReader(contents)).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return "bash"
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "bash"
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	switch interpreter {
+	case "sh", "dash", "ksh":
+		return interpreter
+	}
+	return "bash"
+}
+
+func nonEmptyLines(b []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestStartupScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startup-script")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	signal := "gcloud beta runtime-config configs variables set success/vm ok --config-name waiter\n"
+	scripts := map[string]string{
+		"bash.sh":    "#!/bin/bash\napt-get install -y nginx\n" + signal,
+		"posix.sh":   "#!/bin/sh\n[[ -f $FILE ]] && echo ok\n",
+		"env.sh":     "#!/usr/bin/env bash\necho ok\n",
+		"no-shebang": "echo ok\n",
+	}
+	for name, contents := range scripts {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	posixFindings := filepath.Join(dir, "posix.sh") + ":2:1: warning: In POSIX sh, [[ ]] is undefined. [SC2039]\n" +
+		filepath.Join(dir, "posix.sh") + ":2:7: note: Double quote to prevent globbing and word splitting. [SC2086]\n"
+
+	testCases := []struct {
+		name            string
+		script          StartupScript
+		runs            []testingexec.FakeRunAction
+		expectedRunArgs [][]string
+		expectedErrs    []string
+	}{{
+		name:   "Script passes checks",
+		script: StartupScript{Files: []string{"bash.sh"}, SignalsWaiter: true},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+		},
+		expectedRunArgs: [][]string{
+			{"bash", "-n", filepath.Join(dir, "bash.sh")},
+			{"shellcheck", "--format", "gcc", "--shell", "bash", filepath.Join(dir, "bash.sh")},
+		},
+	}, {
+		name:   "Shellcheck findings in sh script",
+		script: StartupScript{Files: []string{"posix.sh"}, SignalsWaiter: true},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+			func() ([]byte, []byte, error) { return []byte(posixFindings), nil, fmt.Errorf("exit status 1") },
+		},
+		expectedRunArgs: [][]string{
+			{"sh", "-n", filepath.Join(dir, "posix.sh")},
+			{"shellcheck", "--format", "gcc", "--shell", "sh", filepath.Join(dir, "posix.sh")},
+		},
+		expectedErrs: []string{
+			"posix.sh: 2:1: warning: In POSIX sh, [[ ]] is undefined. [SC2039]",
+			"posix.sh: 2:7: note: Double quote to prevent globbing and word splitting. [SC2086]",
+			"posix.sh: script does not signal the deployment waiter",
+		},
+	}, {
+		name:   "Parse failure",
+		script: StartupScript{Files: []string{"env.sh", "no-shebang"}, SkipShellcheck: true},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, fmt.Errorf("exit status 2") },
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+		},
+		expectedRunArgs: [][]string{
+			{"bash", "-n", filepath.Join(dir, "env.sh")},
+			{"bash", "-n", filepath.Join(dir, "no-shebang")},
+		},
+		expectedErrs: []string{"env.sh: bash failed to parse script: exit status 2"},
+	}, {
+		name:   "Shellcheck not installed",
+		script: StartupScript{Files: []string{"bash.sh"}},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, nil },
+			func() ([]byte, []byte, error) { return nil, nil, fmt.Errorf("executable file not found") },
+		},
+		expectedRunArgs: [][]string{
+			{"bash", "-n", filepath.Join(dir, "bash.sh")},
+			{"shellcheck", "--format", "gcc", "--shell", "bash", filepath.Join(dir, "bash.sh")},
+		},
+		expectedErrs: []string{"failed to run shellcheck"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: tc.runs}
+			executor := &testingexec.FakeExec{}
+			for range tc.runs {
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+			r := NewRegistry(executor)
+
+			script := tc.script
+			script.BaseResource = newTestBaseResource("StartupScript", "startup")
+			r.RegisterResource(&script, dir)
+
+			err := script.Apply(r, false)
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestStartupScriptInTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startup-script")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "startup.sh"), []byte("echo ok\n"), 0644))
+
+	fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) { return nil, nil, nil },
+	}}
+	executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+		func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+	}}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	autogen.outDir = dir
+	script := &StartupScript{
+		BaseResource:         newTestBaseResource("StartupScript", "startup"),
+		DeploymentManagerRef: autogen.GetReference(),
+		Files:                []string{"startup.sh"},
+		SkipShellcheck:       true,
+	}
+	r.RegisterResource(autogen, "otherdir")
+	r.RegisterResource(script, "otherdir")
+	assert.Equal(t, []Reference{autogen.GetReference()}, script.GetDependencies())
+
+	assert.NoError(t, script.Apply(r, false))
+	assert.Equal(t, [][]string{{"bash", "-n", filepath.Join(dir, "startup.sh")}}, fcmd.RunLog)
+
+	script.Files = []string{"../startup.sh"}
+	assert.Error(t, script.Apply(r, false))
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// StateFilePath returns the default file that records the state of the
+// resources of the configuration in dir. State files are kept in the user
+// cache directory, keyed by the absolute path of dir, so that they don't
+// show up in the source trees of partners.
+func StateFilePath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find the directory of state files. Pass --state-file to set the state file")
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(cacheDir, "mpdev", "state", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// state records values of resources that were applied successfully, so
+// that later applies can skip work when nothing changed.
+type state struct {
+	Resources map[string]map[string]string `json:"resources"`
+}
+
+func newState() *state {
+	return &state{Resources: map[string]map[string]string{}}
+}
+
+// loadState reads the state file at path. A missing file is treated as an
+// empty state.
+func loadState(path string) (*state, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := newState()
+	err = json.Unmarshal(b, s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse state file %s", path)
+	}
+	if s.Resources == nil {
+		s.Resources = map[string]map[string]string{}
+	}
+	return s, nil
+}
+
+func (s *state) save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+func (s *state) get(ref Reference, key string) string {
+	return s.Resources[stateKey(ref)][key]
+}
+
+func (s *state) set(ref Reference, key string, value string) {
+	k := stateKey(ref)
+	if s.Resources[k] == nil {
+		s.Resources[k] = map[string]string{}
+	}
+	s.Resources[k][key] = value
+}
+
+func stateKey(ref Reference) string {
+	return fmt.Sprintf("%s/%s/%s", ref.Group, ref.Kind, ref.Name)
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TelemetryKillSwitch is the environment variable that disables usage
+// metrics when set to true, whatever the consent recorded, for example on
+// shared CI workers.
+const TelemetryKillSwitch = "MPDEV_NO_TELEMETRY"
+
+// telemetryTimeout bounds the time spent sending usage metrics, which must
+// not slow down commands noticeably.
+const telemetryTimeout = 2 * time.Second
+
+// TelemetryConsent records whether the user agreed to send anonymous usage
+// metrics. Metrics are only sent after consent is given explicitly with
+// `mpdev telemetry enable`.
+type TelemetryConsent struct {
+	Enabled bool `json:"enabled"`
+	// Endpoint is the URL that usage events are posted to
+	Endpoint string `json:"endpoint,omitempty"`
+	// ConsentTime is when the consent was given or withdrawn
+	ConsentTime time.Time `json:"consentTime"`
+}
+
+// UsageEvent is the anonymous usage metric of a command. It contains no
+// identifiers: no resource names, projects, paths or error messages.
+type UsageEvent struct {
+	Command   string `json:"command"`
+	Version   string `json:"version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Duration  string `json:"duration"`
+	Succeeded bool   `json:"succeeded"`
+	// ErrorClass is the class of the failure, such as validation or tool
+	ErrorClass string `json:"errorClass,omitempty"`
+	// Kinds counts the resources of each kind in the configuration
+	Kinds map[string]int `json:"kinds,omitempty"`
+}
+
+// LoadTelemetryConsent reads the consent file at path. A missing file means
+// that no consent was given.
+func LoadTelemetryConsent(path string) (*TelemetryConsent, error) {
+	c := &TelemetryConsent{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return c, nil
+}
+
+// Save writes the consent file to path.
+func (c *TelemetryConsent) Save(path string) error {
+	if c.Enabled {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("telemetry endpoint must be an https URL: %s", c.Endpoint)
+		}
+	}
+	c.ConsentTime = time.Now().UTC()
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Active returns whether usage metrics are sent, which requires consent and
+// an endpoint, and that the kill switch is not set.
+func (c *TelemetryConsent) Active() bool {
+	if telemetryDisabled() {
+		return false
+	}
+	return c.Enabled && c.Endpoint != ""
+}
+
+// telemetryDisabled returns whether the kill switch is set to a true
+// boolean, such as 1 or true. Other values that are not false, such as yes,
+// disable usage metrics as well, so that a typo never sends them.
+func telemetryDisabled() bool {
+	value := os.Getenv(TelemetryKillSwitch)
+	if value == "" {
+		return false
+	}
+	disabled, err := strconv.ParseBool(value)
+	return err != nil || disabled
+}
+
+// NewUsageEvent returns the usage event of a command that started at start
+// and returned err, with the kinds of resources, which may contain
+// duplicates.
+func NewUsageEvent(command string, version string, start time.Time, kinds []string, err error) UsageEvent {
+	event := UsageEvent{
+		Command:   command,
+		Version:   version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		Duration:  time.Since(start).Round(time.Millisecond).String(),
+		Succeeded: err == nil,
+	}
+	if err != nil {
+		event.ErrorClass = ErrorClass(err)
+	}
+	if len(kinds) > 0 {
+		sort.Strings(kinds)
+		event.Kinds = map[string]int{}
+		for _, kind := range kinds {
+			event.Kinds[kind]++
+		}
+	}
+	return event
+}
+
+// SendUsage posts event to the endpoint of the consent, if usage metrics
+// are active.
+func (c *TelemetryConsent) SendUsage(event UsageEvent) error {
+	if !c.Active() {
+		return nil
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: telemetryTimeout}
+	resp, err := client.Post(c.Endpoint, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("usage metrics were rejected with status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelemetryConsent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telemetry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mpdev", "telemetry.json")
+
+	c, err := LoadTelemetryConsent(path)
+	assert.NoError(t, err)
+	assert.False(t, c.Active())
+
+	c.Enabled = true
+	c.Endpoint = "http://example.com/usage"
+	assert.Error(t, c.Save(path))
+
+	c.Endpoint = "https://example.com/usage"
+	assert.NoError(t, c.Save(path))
+	c, err = LoadTelemetryConsent(path)
+	assert.NoError(t, err)
+	assert.True(t, c.Enabled)
+	assert.False(t, c.ConsentTime.IsZero())
+
+	defer os.Unsetenv(TelemetryKillSwitch)
+	assert.True(t, c.Active())
+	for value, active := range map[string]bool{"": true, "0": true, "false": true, "1": false, "true": false, "yes": false} {
+		assert.NoError(t, os.Setenv(TelemetryKillSwitch, value))
+		assert.Equal(t, active, c.Active(), value)
+	}
+}
+
+func TestNewUsageEvent(t *testing.T) {
+	start := time.Now()
+	kinds := []string{"QuotaCheck", "DeploymentManagerTemplate", "QuotaCheck"}
+
+	event := NewUsageEvent("apply", "v0.3.0", start, kinds, ValidationError(errors.New("invalid zipFilePath gs://secret-bucket")))
+	assert.Equal(t, "apply", event.Command)
+	assert.False(t, event.Succeeded)
+	assert.Equal(t, "validation", event.ErrorClass)
+	assert.Equal(t, map[string]int{"DeploymentManagerTemplate": 1, "QuotaCheck": 2}, event.Kinds)
+
+	b, err := json.Marshal(event)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "secret-bucket")
+
+	event = NewUsageEvent("version", "v0.3.0", start, nil, nil)
+	assert.True(t, event.Succeeded)
+	assert.Empty(t, event.ErrorClass)
+	assert.Nil(t, event.Kinds)
+}
+
+func TestSendUsage(t *testing.T) {
+	var received UsageEvent
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	event := UsageEvent{Command: "lint", Succeeded: true}
+	c := &TelemetryConsent{Endpoint: server.URL}
+	assert.NoError(t, c.SendUsage(event))
+	assert.Equal(t, 0, requests)
+
+	c.Enabled = true
+	assert.NoError(t, c.SendUsage(event))
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, event, received)
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/utils/exec"
+)
+
+// useColor enables colored status messages, and useSpinner replaces the
+// output of long commands with a spinner. Both are only enabled when output
+// is a terminal.
+var (
+	useColor   bool
+	useSpinner bool
+)
+
+// UseColor enables colored status messages.
+func UseColor(enabled bool) {
+	useColor = enabled
+}
+
+// UseSpinner enables spinners for long commands, such as docker builds.
+// Spinners rewrite the current line, so they can only be used when a single
+// resource is applied at a time.
+func UseSpinner(enabled bool) {
+	useSpinner = enabled
+}
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// Green returns s in green if colors are enabled.
+func Green(s string) string {
+	return colorize(colorGreen, s)
+}
+
+// Red returns s in red if colors are enabled.
+func Red(s string) string {
+	return colorize(colorRed, s)
+}
+
+func colorize(color string, s string) string {
+	if !useColor {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// spinnerFrames are the frames of the spinner, and spinnerInterval the time
+// between frames.
+var (
+	spinnerFrames   = []string{"|", "/", "-", "\\"}
+	spinnerInterval = 100 * time.Millisecond
+)
+
+const (
+	// maxSpinnerStatus is the number of characters of the last line of
+	// output shown next to a spinner
+	maxSpinnerStatus = 60
+	// quietAfter is the time without output after which a spinner shows for
+	// how long the command has been silent, to tell a stalled command from
+	// a command that works
+	quietAfter = 30 * time.Second
+)
+
+// runLongCommand executes a command that can take minutes, such as a docker
+// build, with the progress of runWithProgress.
+func runLongCommand(executor exec.Interface, description string, name string, args ...string) error {
+	return runWithProgress(description, func(stdout io.Writer, stderr io.Writer) error {
+		cmd := executor.Command(name, args...)
+		cmd.SetStdout(stdout)
+		cmd.SetStderr(stderr)
+		return cmd.Run()
+	})
+}
+
+// runWithProgress calls run, which can take minutes, such as a docker build
+// or a container, after printing description. If spinners are enabled, a
+// spinner with description replaces the output written by run, and shows its
+// last line of output as it is written. The whole output is only printed if
+// run fails. Otherwise the output is streamed to stdout and stderr.
+func runWithProgress(description string, run func(stdout io.Writer, stderr io.Writer) error) error {
+	if !useSpinner {
+		fmt.Println(description)
+		return run(os.Stdout, os.Stderr)
+	}
+	output := newOutputTail()
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		spin(os.Stdout, description, output, done)
+		close(stopped)
+	}()
+	err := run(output, output)
+	close(done)
+	<-stopped
+
+	if err != nil {
+		_, _ = os.Stdout.Write(output.bytes())
+		fmt.Printf("%s %s\n", Red("✗"), description)
+		return err
+	}
+	fmt.Printf("%s %s\n", Green("✓"), description)
+	return nil
+}
+
+// spin draws a spinner with description, the elapsed time and the status of
+// output on the current line of w until done is closed, and then clears the
+// line.
+func spin(w io.Writer, description string, output *outputTail, done <-chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(spinnerInterval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		elapsed := time.Since(start).Round(time.Second)
+		fmt.Fprintf(w, "\r\x1b[K%s %s (%s)%s", spinnerFrames[i%len(spinnerFrames)], description, elapsed, output.status(time.Now()))
+		select {
+		case <-done:
+			fmt.Fprint(w, "\r\x1b[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// outputTail records the output of a command along with its last line and
+// when it was written. It can be written by the command while the spinner
+// reads it.
+type outputTail struct {
+	mu        sync.Mutex
+	output    bytes.Buffer
+	lastLine  string
+	lastWrite time.Time
+}
+
+func newOutputTail() *outputTail {
+	return &outputTail{lastWrite: time.Now()}
+}
+
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.lastWrite = time.Now()
+	// Progress bars, such as those of docker push and gsutil cp, rewrite
+	// their line with carriage returns.
+	lines := strings.FieldsFunc(string(p), func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			o.lastLine = line
+			break
+		}
+	}
+	return o.output.Write(p)
+}
+
+// bytes returns the output written so far.
+func (o *outputTail) bytes() []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.output.Bytes()
+}
+
+// status returns the text shown after a spinner at now: the last line of
+// output, truncated to maxSpinnerStatus characters, or for how long the
+// command has been silent after quietAfter.
+func (o *outputTail) status(now time.Time) string {
+	if o == nil {
+		return ""
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if quiet := now.Sub(o.lastWrite); quiet >= quietAfter {
+		return fmt.Sprintf(" no output for %s", quiet.Round(time.Second))
+	}
+	line := []rune(o.lastLine)
+	if len(line) > maxSpinnerStatus {
+		line = append(line[:maxSpinnerStatus-3], []rune("...")...)
+	}
+	if len(line) == 0 {
+		return ""
+	}
+	return " " + string(line)
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestColorize(t *testing.T) {
+	defer UseColor(useColor)
+
+	UseColor(false)
+	assert.Equal(t, "succeeded", Green("succeeded"))
+	assert.Equal(t, "failed", Red("failed"))
+
+	UseColor(true)
+	assert.Equal(t, "\x1b[32msucceeded\x1b[0m", Green("succeeded"))
+	assert.Equal(t, "\x1b[31mfailed\x1b[0m", Red("failed"))
+}
+
+func TestRunLongCommandSpinner(t *testing.T) {
+	defer UseSpinner(useSpinner)
+	UseSpinner(true)
+
+	testCases := []struct {
+		name   string
+		runErr error
+	}{
+		{name: "success"},
+		{name: "failure", runErr: errors.New("exit status 1")},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{
+				RunScript: []testingexec.FakeRunAction{
+					func() ([]byte, []byte, error) { return []byte("Step 1/2"), nil, tc.runErr },
+				},
+			}
+			executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+
+			err := runLongCommand(executor, "Building container image gcr.io/project/image", "docker", "build", ".")
+			assert.Equal(t, tc.runErr, err)
+			assert.Equal(t, [][]string{{"docker", "build", "."}}, fcmd.RunLog)
+			// The output of the command is captured instead of streamed.
+			assert.NotNil(t, fcmd.Stdout)
+			assert.Equal(t, fcmd.Stdout, fcmd.Stderr)
+		})
+	}
+}
+
+func TestRunWithProgress(t *testing.T) {
+	defer UseSpinner(useSpinner)
+
+	for _, spinner := range []bool{false, true} {
+		UseSpinner(spinner)
+		runErr := errors.New("exit status 1")
+		err := runWithProgress("Executing autogen container gcr.io/cloud-marketplace-tools/dm/autogen", func(stdout io.Writer, stderr io.Writer) error {
+			// The output is captured by the spinner, or streamed.
+			assert.Equal(t, spinner, stdout != os.Stdout)
+			assert.Equal(t, spinner, stdout == stderr)
+			return runErr
+		})
+		assert.Equal(t, runErr, err)
+	}
+}
+
+func TestSpin(t *testing.T) {
+	var b bytes.Buffer
+	done := make(chan struct{})
+	close(done)
+	spin(&b, "Pushing image", nil, done)
+	assert.True(t, strings.HasPrefix(b.String(), "\r\x1b[K| Pushing image (0s)"))
+	assert.True(t, strings.HasSuffix(b.String(), "\r\x1b[K"))
+}
+
+func TestOutputTailStatus(t *testing.T) {
+	testCases := []struct {
+		name     string
+		writes   []string
+		quiet    time.Duration
+		expected string
+	}{{
+		name:     "No output",
+		expected: "",
+	}, {
+		name:     "Last line",
+		writes:   []string{"Step 1/3 : FROM debian\n", "Step 2/3 : RUN apt-get update\n\n"},
+		expected: " Step 2/3 : RUN apt-get update",
+	}, {
+		name:     "Progress bar",
+		writes:   []string{"Copying file://a.zip\n", "\r[0 files][ 10.0 MiB/ 40.0 MiB]", "\r[0 files][ 20.0 MiB/ 40.0 MiB]"},
+		expected: " [0 files][ 20.0 MiB/ 40.0 MiB]",
+	}, {
+		name:     "Long line",
+		writes:   []string{strings.Repeat("a", 100)},
+		expected: " " + strings.Repeat("a", maxSpinnerStatus-3) + "...",
+	}, {
+		name:     "Silent command",
+		writes:   []string{"Pushing layer\n"},
+		quiet:    45 * time.Second,
+		expected: " no output for 45s",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := newOutputTail()
+			for _, w := range tc.writes {
+				_, err := o.Write([]byte(w))
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, strings.Join(tc.writes, ""), string(o.bytes()))
+			assert.Equal(t, tc.expected, o.status(o.lastWrite.Add(tc.quiet)))
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+)
+
+// TerraformModule validates a Terraform module used by a Terraform based
+// VM solution, and saves it as a zip archive to GCS or the local
+// filesystem. The .terraform directories and the lock file written by
+// `terraform init` are not archived.
+type TerraformModule struct {
+	BaseResource
+	// Dir is the directory containing the root of the module
+	Dir string
+	// Uploads to gcs if file path prefixed with "gs://". Otherwise will
+	// zip to given local file path.
+	ZipFilePath string
+	// SkipFormatCheck disables the check that the module is formatted
+	// with `terraform fmt`.
+	SkipFormatCheck bool
+	// LicenseCheck, if set, fails the apply if the module bundles content,
+	// such as third-party scripts and binaries, whose license conflicts
+	// with the license of the solution.
+	LicenseCheck *LicenseCheckOptions
+}
+
+// Apply validates, archives and saves a Terraform module.
+func (tf *TerraformModule) Apply(registry Registry, dryRun bool) error {
+	if tf.Dir == "" {
+		return errors.New("dir cannot be empty for Terraform module")
+	}
+	if tf.ZipFilePath == "" {
+		return errors.New("zipFilePath cannot be empty for Terraform module")
+	}
+	if tf.LicenseCheck != nil {
+		if err := tf.LicenseCheck.validate(); err != nil {
+			return ValidationError(err)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	dir, err := registry.ResolveFilePath(tf, tf.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve path to Terraform module: %s", tf.Dir)
+	}
+	err = checkTerraformFiles(dir)
+	if err != nil {
+		return err
+	}
+	err = checkSecrets(dir, "Terraform module "+tf.Dir)
+	if err != nil {
+		return err
+	}
+
+	// `terraform init` writes a lock file to the module directory, and the
+	// providers and modules it downloads to TF_DATA_DIR. It runs in a copy
+	// of the module, and the module is archived from another copy without
+	// those files, so that they are neither archived nor added to the
+	// sources of the module.
+	dataDir, err := util.CreateTmpDir("terraform")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dataDir)
+
+	zipPath := filepath.Join(dataDir, "module.zip")
+	if !isGCSPath(tf.ZipFilePath) {
+		zipPath, err = registry.ResolveFilePath(tf, tf.ZipFilePath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve path to zipFile: %s", tf.ZipFilePath)
+		}
+	}
+
+	validateDir := filepath.Join(dataDir, "validate")
+	err = copyModule(dir, validateDir, zipPath, false)
+	if err != nil {
+		return err
+	}
+	err = tf.validate(registry, validateDir, filepath.Join(dataDir, "data"))
+	if err != nil {
+		return err
+	}
+
+	packageDir := filepath.Join(dataDir, "package")
+	err = copyModule(dir, packageDir, zipPath, true)
+	if err != nil {
+		return err
+	}
+	if tf.LicenseCheck != nil {
+		err = tf.LicenseCheck.check(packageDir, "Terraform module "+tf.Dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	executor := registry.GetExecutor()
+	err = util.ZipDirectory(executor, zipPath, packageDir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to zip Terraform module to %s", zipPath)
+	}
+	fmt.Printf("Terraform module zipped to %s\n", zipPath)
+	if !isGCSPath(tf.ZipFilePath) {
+		err = setOutputPermissions(zipPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isGCSPath(tf.ZipFilePath) {
+		err = runLongCommand(executor, "Uploading Terraform module to GCS path: "+tf.ZipFilePath, "gsutil", "cp", zipPath, tf.ZipFilePath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to copy Terraform module to GCS path: %s", tf.ZipFilePath)
+		}
+	}
+
+	registry.SetOutput(tf, "zipFilePath", tf.ZipFilePath)
+	return nil
+}
+
+func (tf *TerraformModule) validate(registry Registry, dir string, dataDir string) error {
+	steps := [][]string{
+		{"init", "-backend=false", "-input=false"},
+		{"validate"},
+	}
+	if !tf.SkipFormatCheck {
+		steps = append([][]string{{"fmt", "-check", "-recursive", "-diff"}}, steps...)
+	}
+
+	for _, args := range steps {
+		fmt.Printf("Running terraform %s in a copy of %s\n", args[0], tf.Dir)
+		cmd := registry.GetExecutor().Command("terraform", args...)
+		cmd.SetDir(dir)
+		cmd.SetEnv(append(os.Environ(), "TF_DATA_DIR="+dataDir, "TF_IN_AUTOMATION=1"))
+		cmd.SetStdout(os.Stdout)
+		cmd.SetStderr(os.Stderr)
+		err := cmd.Run()
+		if err != nil {
+			return errors.Wrapf(err, "terraform %s failed for module %s", args[0], dir)
+		}
+	}
+	return nil
+}
+
+// terraformLockFile is the lock file of the providers of a module, which
+// `terraform init` writes to the module directory.
+const terraformLockFile = ".terraform.lock.hcl"
+
+// copyModule copies the Terraform module in src to dst, without the
+// .terraform directories of previous runs of `terraform init` and without
+// the file skip, such as an archive of the module written inside src. The
+// lock file is left out if withoutLockFile is set.
+func copyModule(src string, dst string, skip string, withoutLockFile bool) error {
+	absSkip, err := filepath.Abs(skip)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".terraform" {
+			return filepath.SkipDir
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == absSkip {
+			return nil
+		}
+		if withoutLockFile && rel == terraformLockFile {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		err = util.CopyFile(path, target)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode())
+	})
+}
+
+// checkTerraformFiles verifies that dir is the root of a Terraform module.
+func checkTerraformFiles(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read Terraform module directory %s", dir)
+	}
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".tf" {
+			return nil
+		}
+	}
+	return fmt.Errorf("no .tf files found in Terraform module directory %s", dir)
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestTerraformModule(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "tfmodule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(moduleDir)
+	err = ioutil.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte{}, 0644)
+	assert.NoError(t, err)
+
+	emptyDir, err := ioutil.TempDir("", "tfempty")
+	assert.NoError(t, err)
+	defer os.RemoveAll(emptyDir)
+
+	localZip := filepath.Join(moduleDir, "out", "module.zip")
+	testCases := []struct {
+		name            string
+		dir             string
+		zipFilePath     string
+		skipFormatCheck bool
+		fmtErr          error
+		dryRun          bool
+		expectErr       bool
+		expectedRunArgs [][]string
+	}{{
+		name:        "Local zip",
+		dir:         moduleDir,
+		zipFilePath: localZip,
+		expectedRunArgs: [][]string{
+			{"terraform", "fmt", "-check", "-recursive", "-diff"},
+			{"terraform", "init", "-backend=false", "-input=false"},
+			{"terraform", "validate"},
+			{"zip", "-r", localZip, "."},
+		},
+	}, {
+		name:            "Skip format check",
+		dir:             moduleDir,
+		zipFilePath:     localZip,
+		skipFormatCheck: true,
+		expectedRunArgs: [][]string{
+			{"terraform", "init", "-backend=false", "-input=false"},
+			{"terraform", "validate"},
+			{"zip", "-r", localZip, "."},
+		},
+	}, {
+		name:        "Unformatted module",
+		dir:         moduleDir,
+		zipFilePath: localZip,
+		fmtErr:      fmt.Errorf("exit status 3"),
+		expectErr:   true,
+		expectedRunArgs: [][]string{
+			{"terraform", "fmt", "-check", "-recursive", "-diff"},
+		},
+	}, {
+		name:        "No Terraform files",
+		dir:         emptyDir,
+		zipFilePath: localZip,
+		expectErr:   true,
+	}, {
+		name:        "Missing dir",
+		zipFilePath: localZip,
+		expectErr:   true,
+	}, {
+		name:      "Missing zip path",
+		dir:       moduleDir,
+		expectErr: true,
+	}, {
+		name:        "Dry run",
+		dir:         moduleDir,
+		zipFilePath: localZip,
+		dryRun:      true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+			fcmd.RunScript = []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return nil, nil, tc.fmtErr },
+				noOutput, noOutput, noOutput,
+			}
+			cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+			executor := &testingexec.FakeExec{
+				CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction},
+			}
+			r := NewRegistry(executor)
+
+			tf := newTestTerraformModule(tc.dir, tc.zipFilePath)
+			tf.SkipFormatCheck = tc.skipFormatCheck
+			r.RegisterResource(tf, "resourcedir")
+
+			err := tf.Apply(r, tc.dryRun)
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunArgs, fcmd.RunLog)
+		})
+	}
+}
+
+func TestTerraformModuleGCS(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "tfmodule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(moduleDir)
+	err = ioutil.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte{}, 0644)
+	assert.NoError(t, err)
+
+	fcmd := testingexec.FakeCmd{}
+	noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+	fcmd.RunScript = []testingexec.FakeRunAction{noOutput, noOutput, noOutput, noOutput, noOutput}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction, cmdAction},
+	}
+	r := NewRegistry(executor)
+
+	tf := newTestTerraformModule(moduleDir, "gs://bucket/module.zip")
+	r.RegisterResource(tf, "resourcedir")
+
+	err = tf.Apply(r, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, fcmd.RunCalls)
+
+	// The module is zipped to a temporary file that is then uploaded.
+	zipArgs := fcmd.RunLog[3]
+	assert.Equal(t, []string{"zip", "-r"}, zipArgs[:2])
+	assert.Equal(t, []string{"gsutil", "cp", zipArgs[2], "gs://bucket/module.zip"}, fcmd.RunLog[4])
+	assert.Equal(t, map[string]string{"zipFilePath": "gs://bucket/module.zip"}, r.GetOutputs(tf.GetReference()))
+}
+
+func TestTerraformModuleInitFiles(t *testing.T) {
+	moduleDir, err := ioutil.TempDir("", "tfmodule")
+	assert.NoError(t, err)
+	defer os.RemoveAll(moduleDir)
+	writeFiles(t, moduleDir, map[string]string{
+		"main.tf":                 "",
+		"modules/vm/main.tf":      "",
+		".terraform.lock.hcl":     "lock",
+		".terraform/providers/x":  "",
+		"modules/vm/.terraform/y": "",
+		"scripts/install.sh":      "#!/bin/sh",
+	})
+	assert.NoError(t, os.Chmod(filepath.Join(moduleDir, "scripts/install.sh"), 0755))
+
+	var initFiles, zipFiles []string
+	fcmd := testingexec.FakeCmd{}
+	noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+	fcmd.RunScript = []testingexec.FakeRunAction{
+		noOutput,
+		func() ([]byte, []byte, error) {
+			dir := fcmd.Dirs[len(fcmd.Dirs)-1]
+			initFiles = listFiles(t, dir)
+			return nil, nil, ioutil.WriteFile(filepath.Join(dir, ".terraform.lock.hcl"), []byte("new lock"), 0644)
+		},
+		noOutput,
+		func() ([]byte, []byte, error) {
+			dir := fcmd.Dirs[len(fcmd.Dirs)-1]
+			zipFiles = listFiles(t, dir)
+			info, err := os.Stat(filepath.Join(dir, "scripts/install.sh"))
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+			return nil, nil, nil
+		},
+	}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction, cmdAction, cmdAction},
+	}
+	r := NewRegistry(executor)
+
+	tf := newTestTerraformModule(moduleDir, filepath.Join(moduleDir, "module.zip"))
+	r.RegisterResource(tf, "resourcedir")
+
+	assert.NoError(t, tf.Apply(r, false))
+	assert.Equal(t, []string{".terraform.lock.hcl", "main.tf", "modules/vm/main.tf", "scripts/install.sh"}, initFiles)
+	assert.Equal(t, []string{"main.tf", "modules/vm/main.tf", "scripts/install.sh"}, zipFiles)
+	assert.NotEqual(t, moduleDir, fcmd.Dirs[1], "terraform init runs in a copy of the module")
+	lock, err := ioutil.ReadFile(filepath.Join(moduleDir, ".terraform.lock.hcl"))
+	assert.NoError(t, err)
+	assert.Equal(t, "lock", string(lock), "the lock file of the module is not modified")
+}
+
+// listFiles returns the slash separated paths of the files in dir, relative
+// to dir.
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	assert.NoError(t, err)
+	return files
+}
+
+func newTestTerraformModule(dir string, zipFilePath string) *TerraformModule {
+	return &TerraformModule{
+		BaseResource: BaseResource{
+			TypeMeta{
+				APIVersion: apiVersion,
+				Kind:       "TerraformModule",
+			},
+			Metadata{Name: "module"},
+		},
+		Dir:         dir,
+		ZipFilePath: zipFilePath,
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// minimumToolVersions are the oldest versions of the Google Cloud SDK tools
+// that support the features used by mpdev, by tool, and the key of their
+// version in the output of `gcloud version`. Older versions of gsutil fail
+// uploads with KMS keys and signed URLs with misleading errors.
+var minimumToolVersions = []struct {
+	tool    string
+	key     string
+	version string
+}{
+	{tool: "gcloud", key: "Google Cloud SDK", version: "360.0.0"},
+	{tool: "gsutil", key: "gsutil", version: "5.4"},
+}
+
+// gsutilVersionRegex matches the output of `gsutil version`, and
+// toolVersionRegex the versions that are compared.
+var (
+	gsutilVersionRegex = regexp.MustCompile(`gsutil version: (\S+)`)
+	toolVersionRegex   = regexp.MustCompile(`^\d+(\.\d+)*$`)
+)
+
+// checkToolVersions returns an error listing the tools of the Google Cloud
+// SDK among tools that are older than their minimum version, with the
+// command upgrading them.
+func checkToolVersions(executor exec.Interface, tools []string) error {
+	var needed []string
+	for _, v := range minimumToolVersions {
+		if containsString(tools, v.tool) {
+			needed = append(needed, v.tool)
+		}
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+
+	// gcloud reports the versions of its components, and of gsutil if it
+	// is installed with it.
+	versions := map[string]string{}
+	stdout, err := runCommandOutput(executor, "gcloud", "version", "--format", "json")
+	if err == nil {
+		err = json.Unmarshal(stdout, &versions)
+	}
+	if err != nil && containsString(needed, "gcloud") {
+		return errors.Wrap(err, "failed to get the version of gcloud")
+	}
+	var outdated []string
+	for _, v := range minimumToolVersions {
+		if !containsString(needed, v.tool) {
+			continue
+		}
+		version := versions[v.key]
+		if version == "" && v.tool == "gsutil" {
+			// gsutil is installed without gcloud, such as with pip.
+			stdout, err := runCommandOutput(executor, "gsutil", "version")
+			if err != nil {
+				return errors.Wrap(err, "failed to get the version of gsutil")
+			}
+			if m := gsutilVersionRegex.FindSubmatch(stdout); m != nil {
+				version = string(m[1])
+			}
+		}
+		// Versions that cannot be compared do not fail the run.
+		if toolVersionRegex.MatchString(version) && compareVersions(version, v.version) < 0 {
+			outdated = append(outdated, fmt.Sprintf("  %s %s is older than %s", v.tool, version, v.version))
+		}
+	}
+	if len(outdated) == 0 {
+		return nil
+	}
+	return withExitCode(ExitTool, fmt.Errorf("outdated tools, run `gcloud components update`, or upgrade the Google Cloud SDK with the package manager that installed it:\n%s",
+		strings.Join(outdated, "\n")))
+}
+
+// compareVersions compares the dot separated numbers of the versions a and
+// b, and returns -1, 0 or 1 if a is older than, equal to or newer than b.
+// Missing numbers are 0.
+func compareVersions(a string, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+	}
+	return 0
+}
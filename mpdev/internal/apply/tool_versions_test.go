@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// gcloudVersionAction is the command of `gcloud version`, reporting
+// versions that are up to date.
+func gcloudVersionAction(cmd string, args ...string) exec.Cmd {
+	return &testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+		func() ([]byte, []byte, error) {
+			return []byte(`{"Google Cloud SDK": "400.0.0", "gsutil": "5.20", "core": "2022.08.19"}`), nil, nil
+		},
+	}}
+}
+
+func TestCheckToolVersions(t *testing.T) {
+	testCases := []struct {
+		name         string
+		tools        []string
+		runs         []testingexec.FakeRunAction
+		expectedArgs [][]string
+		errorMatches []string
+	}{{
+		name:  "Up to date",
+		tools: []string{"docker", "gcloud", "gsutil"},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) {
+				return []byte(`{"Google Cloud SDK": "360.0.0", "gsutil": "5.10"}`), nil, nil
+			},
+		},
+		expectedArgs: [][]string{{"gcloud", "version", "--format", "json"}},
+	}, {
+		name:  "Outdated",
+		tools: []string{"gcloud", "gsutil"},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) {
+				return []byte(`{"Google Cloud SDK": "290.0.1", "gsutil": "4.50"}`), nil, nil
+			},
+		},
+		expectedArgs: [][]string{{"gcloud", "version", "--format", "json"}},
+		errorMatches: []string{
+			"gcloud components update",
+			"  gcloud 290.0.1 is older than 360.0.0\n",
+			"  gsutil 4.50 is older than 5.4",
+		},
+	}, {
+		name:  "gsutil without gcloud",
+		tools: []string{"gsutil"},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return nil, nil, fmt.Errorf("executable file not found in $PATH") },
+			func() ([]byte, []byte, error) { return []byte("gsutil version: 4.61\n"), nil, nil },
+		},
+		expectedArgs: [][]string{{"gcloud", "version", "--format", "json"}, {"gsutil", "version"}},
+		errorMatches: []string{"  gsutil 4.61 is older than 5.4"},
+	}, {
+		name:  "Unknown version",
+		tools: []string{"gcloud"},
+		runs: []testingexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte(`{"Google Cloud SDK": "HEAD"}`), nil, nil },
+		},
+		expectedArgs: [][]string{{"gcloud", "version", "--format", "json"}},
+	}, {
+		name:  "Tools without minimum version",
+		tools: []string{"docker", "helm"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: tc.runs}
+			executor := &testingexec.FakeExec{}
+			for range tc.runs {
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+
+			err := checkToolVersions(executor, tc.tools)
+			assert.Equal(t, tc.expectedArgs, fcmd.RunLog)
+			if len(tc.errorMatches) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, ExitTool, ExitCode(err))
+			for _, match := range tc.errorMatches {
+				assert.Contains(t, err.Error(), match)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, compareVersions("290.0.1", "360.0.0"))
+	assert.Equal(t, 1, compareVersions("5.10", "5.4"))
+	assert.Equal(t, 0, compareVersions("5.4.0", "5.4"))
+}
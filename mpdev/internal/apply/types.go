@@ -17,17 +17,54 @@ package apply
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-const apiVersion = "dev.marketplace.cloud.google.com/v1alpha1"
+const (
+	apiGroup   = "dev.marketplace.cloud.google.com"
+	apiVersion = apiGroup + "/v1alpha1"
+)
 
 var typeMapper = map[TypeMeta]func() Resource{
 	{APIVersion: apiVersion, Kind: "GceImage"}:                         func() Resource { return &GceImage{} },
 	{APIVersion: apiVersion, Kind: "PackerGceImageBuilder"}:            func() Resource { return &PackerGceImageBuilder{} },
+	{APIVersion: apiVersion, Kind: "DaisyGceImageBuilder"}:             func() Resource { return &DaisyGceImageBuilder{} },
+	{APIVersion: apiVersion, Kind: "GceImageLicenseCheck"}:             func() Resource { return &GceImageLicenseCheck{} },
+	{APIVersion: apiVersion, Kind: "ImageTest"}:                        func() Resource { return &ImageTest{} },
+	{APIVersion: apiVersion, Kind: "ShieldedVMCheck"}:                  func() Resource { return &ShieldedVMCheck{} },
+	{APIVersion: apiVersion, Kind: "QuotaCheck"}:                       func() Resource { return &QuotaCheck{} },
+	{APIVersion: apiVersion, Kind: "OrgPolicyCheck"}:                   func() Resource { return &OrgPolicyCheck{} },
 	{APIVersion: apiVersion, Kind: "DeploymentManagerAutogenTemplate"}: func() Resource { return &DeploymentManagerAutogenTemplate{} },
 	{APIVersion: apiVersion, Kind: "DeploymentManagerTemplate"}:        func() Resource { return &DeploymentManagerTemplate{} },
+	{APIVersion: apiVersion, Kind: "DeploymentManagerPreview"}:         func() Resource { return &DeploymentManagerPreview{} },
+	{APIVersion: apiVersion, Kind: "DeploymentManagerDeployment"}:      func() Resource { return &DeploymentManagerDeployment{} },
+	{APIVersion: apiVersion, Kind: "DeploymentTest"}:                   func() Resource { return &DeploymentTest{} },
+	{APIVersion: apiVersion, Kind: "DeploymentManagerCompositeType"}:   func() Resource { return &DeploymentManagerCompositeType{} },
+	{APIVersion: apiVersion, Kind: "TerraformModule"}:                  func() Resource { return &TerraformModule{} },
+	{APIVersion: apiVersion, Kind: "HelmChart"}:                        func() Resource { return &HelmChart{} },
+	{APIVersion: apiVersion, Kind: "K8sAppDeployer"}:                   func() Resource { return &K8sAppDeployer{} },
+	{APIVersion: apiVersion, Kind: "ContainerImage"}:                   func() Resource { return &ContainerImage{} },
+	{APIVersion: apiVersion, Kind: "PriceModel"}:                       func() Resource { return &PriceModel{} },
+	{APIVersion: apiVersion, Kind: "SaaSIntegration"}:                  func() Resource { return &SaaSIntegration{} },
+	{APIVersion: apiVersion, Kind: "UsageReport"}:                      func() Resource { return &UsageReport{} },
+	{APIVersion: apiVersion, Kind: "IAMPolicy"}:                        func() Resource { return &IAMPolicy{} },
+	{APIVersion: apiVersion, Kind: "ListingAssets"}:                    func() Resource { return &ListingAssets{} },
+	{APIVersion: apiVersion, Kind: "ListingDocuments"}:                 func() Resource { return &ListingDocuments{} },
+	{APIVersion: apiVersion, Kind: "StartupScript"}:                    func() Resource { return &StartupScript{} },
+	{APIVersion: apiVersion, Kind: "Notification"}:                     func() Resource { return &Notification{} },
+}
+
+// Kinds returns the sorted kinds of the resources supported by mpdev.
+func Kinds() []string {
+	var kinds []string
+	for typeMeta := range typeMapper {
+		kinds = append(kinds, typeMeta.Kind)
+	}
+	sort.Strings(kinds)
+	return kinds
 }
 
 // UnstructuredToResource converts Unstructured to a specific type implementing the
@@ -72,3 +109,52 @@ func (u *Unstructured) getTypeMeta() TypeMeta {
 		APIVersion: apiVersion,
 	}
 }
+
+// ResourceToUnstructured converts a resource to Unstructured, as it would be
+// written in a configuration file, including fields that are not set. Field
+// names without a json tag are converted to lower camel case.
+func ResourceToUnstructured(rs Resource) (Unstructured, error) {
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to marshal resource %+v", rs.GetReference())
+	}
+	var obj map[string]interface{}
+	err = json.Unmarshal(b, &obj)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to unmarshal resource %+v", rs.GetReference())
+	}
+	return Unstructured(lowerCamelCaseKeys(obj).(map[string]interface{})), nil
+}
+
+// lowerCamelCaseKeys converts the keys of maps in v to lower camel case,
+// such that APIVersion becomes apiVersion and DeploymentManagerRef becomes
+// deploymentManagerRef.
+func lowerCamelCaseKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[lowerCamelCase(key)] = lowerCamelCaseKeys(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = lowerCamelCaseKeys(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func lowerCamelCase(s string) string {
+	upper := 0
+	for upper < len(s) && s[upper] >= 'A' && s[upper] <= 'Z' {
+		upper++
+	}
+	// Keep the last capital of an initialism that starts the next word.
+	if upper > 1 && upper < len(s) {
+		upper--
+	}
+	return strings.ToLower(s[:upper]) + s[upper:]
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceToUnstructured(t *testing.T) {
+	obj := Unstructured{
+		"apiVersion": apiVersion,
+		"kind":       "DeploymentManagerTemplate",
+		"metadata":   map[string]interface{}{"name": "dmtemplate"},
+		"deploymentManagerRef": map[string]interface{}{
+			"group": apiGroup,
+			"kind":  "DeploymentManagerAutogenTemplate",
+			"name":  "autogen",
+		},
+		"zipFilePath": "template.zip",
+	}
+	rs, err := UnstructuredToResource(obj)
+	assert.NoError(t, err)
+
+	converted, err := ResourceToUnstructured(rs)
+	assert.NoError(t, err)
+	assert.Equal(t, apiVersion, converted["apiVersion"])
+	assert.Equal(t, "DeploymentManagerTemplate", converted["kind"])
+	assert.Equal(t, map[string]interface{}{"name": "dmtemplate", "annotations": nil}, converted["metadata"])
+	assert.Equal(t, []interface{}{"template.zip"}, converted["zipFilePath"])
+	assert.Equal(t, "autogen", converted["deploymentManagerRef"].(map[string]interface{})["name"])
+
+	// The converted resource can be decoded again.
+	again, err := UnstructuredToResource(converted)
+	assert.NoError(t, err)
+	assert.Equal(t, rs, again)
+}
+
+func TestLowerCamelCase(t *testing.T) {
+	testCases := map[string]string{
+		"APIVersion":           "apiVersion",
+		"DeploymentManagerRef": "deploymentManagerRef",
+		"URL":                  "url",
+		"projectId":            "projectId",
+		"Kind":                 "kind",
+	}
+	for in, expected := range testCases {
+		assert.Equal(t, expected, lowerCamelCase(in))
+	}
+}
+
+func TestKinds(t *testing.T) {
+	kinds := Kinds()
+	assert.Len(t, kinds, len(typeMapper))
+	assert.True(t, sort.StringsAreSorted(kinds))
+	assert.Contains(t, kinds, "DeploymentManagerTemplate")
+}
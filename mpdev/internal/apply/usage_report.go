@@ -0,0 +1,184 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const serviceControlAPI = "https://servicecontrol.googleapis.com/v1"
+
+// now returns the current time. It is replaced in tests.
+var now = time.Now
+
+// UsageReport sends a synthetic usage report for the metrics of a solution
+// to Service Control, and verifies that it is accepted. See
+// https://cloud.google.com/marketplace/docs/partners/integrated-saas/reporting-usage
+type UsageReport struct {
+	BaseResource
+	// ServiceName of the solution, such as example.endpoints.partner.cloud.goog
+	ServiceName string
+	// ConsumerID is the usage reporting ID of the test entitlement, such as
+	// project:some-project
+	ConsumerID string `json:"consumerId"`
+	// Metrics reported and their values
+	Metrics []UsageMetric
+}
+
+// UsageMetric is a value reported for a metric of a service.
+type UsageMetric struct {
+	// Name of the metric, such as example.endpoints.partner.cloud.goog/requests
+	Name  string
+	Int64 int64
+}
+
+type serviceControlOperation struct {
+	OperationID     string              `json:"operationId"`
+	OperationName   string              `json:"operationName"`
+	ConsumerID      string              `json:"consumerId"`
+	StartTime       string              `json:"startTime"`
+	EndTime         string              `json:"endTime"`
+	MetricValueSets []serviceControlSet `json:"metricValueSets,omitempty"`
+}
+
+type serviceControlSet struct {
+	MetricName   string                `json:"metricName"`
+	MetricValues []serviceControlValue `json:"metricValues"`
+}
+
+type serviceControlValue struct {
+	Int64Value string `json:"int64Value"`
+}
+
+type serviceControlCheckError struct {
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+type serviceControlReportError struct {
+	OperationID string `json:"operationId"`
+	Status      struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// Apply checks the consumer and reports the usage to Service Control.
+func (u *UsageReport) Apply(registry Registry, dryRun bool) error {
+	err := u.validate()
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	operation, err := u.newOperation()
+	if err != nil {
+		return err
+	}
+	executor := registry.GetExecutor()
+	url := fmt.Sprintf("%s/services/%s", serviceControlAPI, u.ServiceName)
+
+	checkOperation := *operation
+	checkOperation.MetricValueSets = nil
+	var checkResponse struct {
+		CheckErrors []serviceControlCheckError `json:"checkErrors"`
+	}
+	err = callGoogleAPI(executor, "POST", url+":check", map[string]interface{}{"operation": checkOperation}, &checkResponse)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check consumer %s of service %s", u.ConsumerID, u.ServiceName)
+	}
+	if len(checkResponse.CheckErrors) > 0 {
+		var messages []string
+		for _, e := range checkResponse.CheckErrors {
+			messages = append(messages, fmt.Sprintf("%s: %s", e.Code, e.Detail))
+		}
+		return fmt.Errorf("consumer %s of service %s failed check: %s",
+			u.ConsumerID, u.ServiceName, strings.Join(messages, "; "))
+	}
+
+	var reportResponse struct {
+		ReportErrors []serviceControlReportError `json:"reportErrors"`
+	}
+	body := map[string]interface{}{"operations": []serviceControlOperation{*operation}}
+	err = callGoogleAPI(executor, "POST", url+":report", body, &reportResponse)
+	if err != nil {
+		return errors.Wrapf(err, "failed to report usage of service %s", u.ServiceName)
+	}
+	if len(reportResponse.ReportErrors) > 0 {
+		var messages []string
+		for _, e := range reportResponse.ReportErrors {
+			messages = append(messages, fmt.Sprintf("%d: %s", e.Status.Code, e.Status.Message))
+		}
+		return fmt.Errorf("usage report of service %s was rejected: %s", u.ServiceName, strings.Join(messages, "; "))
+	}
+
+	fmt.Printf("Usage report %s of service %s was accepted\n", operation.OperationID, u.ServiceName)
+	registry.SetOutput(u, "operationId", operation.OperationID)
+	return nil
+}
+
+func (u *UsageReport) validate() error {
+	if u.ServiceName == "" {
+		return errors.New("serviceName cannot be empty for usage report")
+	}
+	if u.ConsumerID == "" {
+		return errors.New("consumerId cannot be empty for usage report")
+	}
+	if len(u.Metrics) == 0 {
+		return errors.New("metrics cannot be empty for usage report")
+	}
+	for _, metric := range u.Metrics {
+		if !strings.HasPrefix(metric.Name, u.ServiceName+"/") {
+			return fmt.Errorf("metric %s must be prefixed with the service name %s/", metric.Name, u.ServiceName)
+		}
+		if metric.Int64 < 0 {
+			return fmt.Errorf("metric %s cannot have a negative value", metric.Name)
+		}
+	}
+	return nil
+}
+
+func (u *UsageReport) newOperation() (*serviceControlOperation, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	end := now().UTC()
+	operation := &serviceControlOperation{
+		OperationID:   hex.EncodeToString(id),
+		OperationName: "mpdev-usage-report",
+		ConsumerID:    u.ConsumerID,
+		StartTime:     end.Add(-time.Minute).Format(time.RFC3339),
+		EndTime:       end.Format(time.RFC3339),
+	}
+	for _, metric := range u.Metrics {
+		operation.MetricValueSets = append(operation.MetricValueSets, serviceControlSet{
+			MetricName:   metric.Name,
+			MetricValues: []serviceControlValue{{Int64Value: fmt.Sprint(metric.Int64)}},
+		})
+	}
+	return operation, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestUsageReport(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	service := "app.endpoints.partner.cloud.goog"
+	url := serviceControlAPI + "/services/" + service
+	testCases := []struct {
+		name             string
+		metrics          []UsageMetric
+		responses        []string
+		errorContains    string
+		expectedRequests []string
+	}{{
+		name:             "Report accepted",
+		metrics:          []UsageMetric{{Name: service + "/requests", Int64: 10}},
+		responses:        []string{`{}`, `{}`},
+		expectedRequests: []string{"POST " + url + ":check", "POST " + url + ":report"},
+	}, {
+		name:             "Consumer check fails",
+		metrics:          []UsageMetric{{Name: service + "/requests", Int64: 10}},
+		responses:        []string{`{"checkErrors": [{"code": "SERVICE_NOT_ACTIVATED", "detail": "not active"}]}`},
+		errorContains:    "SERVICE_NOT_ACTIVATED: not active",
+		expectedRequests: []string{"POST " + url + ":check"},
+	}, {
+		name:    "Report rejected",
+		metrics: []UsageMetric{{Name: service + "/requests", Int64: 10}},
+		responses: []string{`{}`,
+			`{"reportErrors": [{"operationId": "1", "status": {"code": 3, "message": "unknown metric"}}]}`},
+		errorContains:    "3: unknown metric",
+		expectedRequests: []string{"POST " + url + ":check", "POST " + url + ":report"},
+	}, {
+		name:          "Metric of another service",
+		metrics:       []UsageMetric{{Name: "other/requests", Int64: 10}},
+		errorContains: "must be prefixed with the service name",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{}
+			r := NewRegistry(fakeGoogleAPI(&fcmd, tc.responses...))
+
+			u := &UsageReport{
+				BaseResource: newTestBaseResource("UsageReport", "usage"),
+				ServiceName:  service,
+				ConsumerID:   "project:test-project",
+				Metrics:      tc.metrics,
+			}
+			r.RegisterResource(u, "dir")
+
+			err := u.Apply(r, false)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, r.GetOutputs(u.GetReference())["operationId"])
+			}
+			assert.Equal(t, tc.expectedRequests, apiRequests(&fcmd))
+		})
+	}
+}
+
+func TestUsageReportOperation(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC) }
+
+	u := &UsageReport{
+		ServiceName: "app.endpoints.partner.cloud.goog",
+		ConsumerID:  "project:test-project",
+		Metrics:     []UsageMetric{{Name: "app.endpoints.partner.cloud.goog/requests", Int64: 10}},
+	}
+	operation, err := u.newOperation()
+	assert.NoError(t, err)
+	assert.Len(t, operation.OperationID, 32)
+
+	operation.OperationID = "id"
+	b, err := json.Marshal(operation)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"operationId": "id",
+		"operationName": "mpdev-usage-report",
+		"consumerId": "project:test-project",
+		"startTime": "2020-06-01T11:59:00Z",
+		"endTime": "2020-06-01T12:00:00Z",
+		"metricValueSets": [{
+			"metricName": "app.endpoints.partner.cloud.goog/requests",
+			"metricValues": [{"int64Value": "10"}]
+		}]
+	}`, string(b))
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/internal/util"
+	"github.com/pkg/errors"
+)
+
+// Test applies the verification resources of the registry, such as
+// deployments and image checks, against artifacts that were already
+// published, without publishing anything. The resources they depend on are
+// applied first, except that the Deployment Manager template of an autogen
+// template saved by a DeploymentManagerTemplate is the published one,
+// instead of being generated again.
+func (r *registry) Test() error {
+	return r.run(false, true)
+}
+
+// testResources returns the verification resources among resources, which
+// are sorted topologically, along with their transitive dependencies and
+// notifications.
+func (r *registry) testResources(resources []Resource) []Resource {
+	needed := r.withDependencies(resources, IsVerification)
+
+	// published are the templates that save each autogen template.
+	published := map[Reference]*DeploymentManagerTemplate{}
+	for _, resource := range resources {
+		dm, ok := resource.(*DeploymentManagerTemplate)
+		if ok && dm.ZipRoot == "" && dm.StripPrefix == "" {
+			if _, ok := published[dm.DeploymentManagerRef]; !ok {
+				published[dm.DeploymentManagerRef] = dm
+			}
+		}
+	}
+
+	var selected []Resource
+	for _, resource := range resources {
+		ref := resource.GetReference()
+		if _, ok := resource.(notifier); ok {
+			selected = append(selected, resource)
+			continue
+		}
+		if !needed[ref] {
+			continue
+		}
+		if autogen, ok := resource.(*DeploymentManagerAutogenTemplate); ok && published[ref] != nil {
+			resource = &publishedTemplate{DeploymentManagerAutogenTemplate: autogen, dm: published[ref]}
+		}
+		selected = append(selected, resource)
+	}
+	return selected
+}
+
+// publishedTemplate is applied in place of an autogen template when testing.
+// It extracts the package published by a DeploymentManagerTemplate to the
+// output directory of the autogen template, instead of generating it.
+type publishedTemplate struct {
+	*DeploymentManagerAutogenTemplate
+	dm *DeploymentManagerTemplate
+}
+
+// Apply extracts the published package.
+func (p *publishedTemplate) Apply(registry Registry, dryRun bool) error {
+	path, err := p.dm.publishedPath(registry)
+	if err != nil {
+		return err
+	}
+	dir, err := util.CreateTmpDir("published")
+	if err != nil {
+		return err
+	}
+	err = p.dm.extractPublished(registry.GetExecutor(), path, dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get published DM template %s", path)
+	}
+	fmt.Printf("Using DM template published to %s\n", path)
+	p.outDir = dir
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestTest(t *testing.T) {
+	fcmd := testingexec.FakeCmd{}
+	noOutput := func() ([]byte, []byte, error) { return nil, nil, nil }
+	extract := func() ([]byte, []byte, error) {
+		dir := fcmd.Argv[len(fcmd.Argv)-1]
+		return nil, nil, ioutil.WriteFile(filepath.Join(dir, "solution.jinja"), []byte("published"), 0644)
+	}
+	fcmd.RunScript = []testingexec.FakeRunAction{noOutput, extract}
+	cmdAction := func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) }
+	executor := &testingexec.FakeExec{
+		CommandScript: []testingexec.FakeCommandAction{cmdAction, cmdAction},
+	}
+	r := NewRegistry(executor)
+
+	autogen := getDeploymentManagerAutogenTemplate(&AutogenSpec{})
+	dm := getDeploymentManagerTemplate(autogen, "gs://project/dm.zip")
+	published := false
+	publisher := newTestResourceFunc("publisher", func(Registry, bool) error {
+		published = true
+		return nil
+	}, nil)
+	var template []byte
+	check := newTestResourceFunc("check", func(Registry, bool) error {
+		var err error
+		template, err = ioutil.ReadFile(filepath.Join(autogen.outDir, "solution.jinja"))
+		return err
+	}, func() []Reference { return []Reference{autogen.GetReference()} })
+	check.TypeMeta = TypeMeta{Kind: "QuotaCheck", APIVersion: apiVersion}
+	for _, rs := range []Resource{autogen, dm, publisher, check} {
+		r.RegisterResource(rs, "resourcedir")
+	}
+
+	err := r.Test()
+	assert.NoError(t, err)
+	defer os.RemoveAll(autogen.outDir)
+
+	// Only the published template is downloaded, nothing is published.
+	assert.False(t, published)
+	assert.Equal(t, "published", string(template))
+	assert.Len(t, fcmd.RunLog, 2)
+	assert.Equal(t, []string{"gsutil", "cp", "gs://project/dm.zip"}, fcmd.RunLog[0][:3])
+	summary := r.Summary()
+	assert.Len(t, summary.Resources, 2)
+	assert.True(t, summary.Succeeded)
+}
+
+func TestTestFailure(t *testing.T) {
+	r := NewRegistry(&testingexec.FakeExec{})
+	check := newTestResourceFunc("check", func(Registry, bool) error {
+		return errors.New("quota exceeded")
+	}, nil)
+	check.TypeMeta = TypeMeta{Kind: "QuotaCheck", APIVersion: apiVersion}
+	r.RegisterResource(check, "resourcedir")
+
+	err := r.Test()
+	assert.Error(t, err)
+	assert.Equal(t, ExitVerification, ExitCode(err))
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+var servicePerimeterRegex = regexp.MustCompile(`^accessPolicies/([0-9]+)/servicePerimeters/([A-Za-z0-9_]+)$`)
+
+// perimeterLogDelay is how long to wait for VPC Service Controls audit logs
+// to be written before reading them. It is replaced in tests.
+var perimeterLogDelay = time.Minute
+
+const vpcServiceControlsLogFilter = `protoPayload.metadata."@type"="type.googleapis.com/google.cloud.audit.VpcServiceControlAuditMetadata"`
+
+type servicePerimeter struct {
+	Status *struct {
+		Resources []string
+	}
+	Spec *struct {
+		Resources []string
+	}
+	UseExplicitDryRunSpec bool `json:"useExplicitDryRunSpec"`
+}
+
+type perimeterViolation struct {
+	ProtoPayload struct {
+		ServiceName string `json:"serviceName"`
+		MethodName  string `json:"methodName"`
+		Metadata    struct {
+			ViolationReason string `json:"violationReason"`
+			DryRun          bool   `json:"dryRun"`
+		} `json:"metadata"`
+	} `json:"protoPayload"`
+}
+
+func validateServicePerimeter(perimeter string) error {
+	if !servicePerimeterRegex.MatchString(perimeter) {
+		return fmt.Errorf("invalid servicePerimeter: %s. Must have the format accessPolicies/POLICY/servicePerimeters/NAME", perimeter)
+	}
+	return nil
+}
+
+// checkProjectInPerimeter verifies that a project is protected by a service
+// perimeter, either enforced or in dry run mode.
+func checkProjectInPerimeter(executor exec.Interface, projectID string, perimeter string) error {
+	stdout, err := runCommandOutput(executor, "gcloud", "projects", "describe", projectID, "--format", "value(projectNumber)")
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe project %s", projectID)
+	}
+	resource := "projects/" + strings.TrimSpace(string(stdout))
+
+	match := servicePerimeterRegex.FindStringSubmatch(perimeter)
+	stdout, err = runCommandOutput(executor, "gcloud", "access-context-manager", "perimeters", "describe", match[2],
+		"--policy", match[1], "--format", "json")
+	if err != nil {
+		return errors.Wrapf(err, "failed to describe service perimeter %s", perimeter)
+	}
+	var p servicePerimeter
+	err = json.Unmarshal(stdout, &p)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse service perimeter %s", perimeter)
+	}
+
+	if p.Status != nil && containsString(p.Status.Resources, resource) {
+		return nil
+	}
+	if p.UseExplicitDryRunSpec && p.Spec != nil && containsString(p.Spec.Resources, resource) {
+		return nil
+	}
+	return fmt.Errorf("project %s is not protected by service perimeter %s", projectID, perimeter)
+}
+
+// perimeterViolations returns the API calls in a project blocked by VPC
+// Service Controls since a time. Calls that a dry run perimeter would block
+// are included.
+func perimeterViolations(executor exec.Interface, projectID string, since time.Time) ([]string, error) {
+	time.Sleep(perimeterLogDelay)
+	filter := fmt.Sprintf(`%s AND timestamp>="%s"`, vpcServiceControlsLogFilter, since.UTC().Format(time.RFC3339))
+	stdout, err := runCommandOutput(executor, "gcloud", "logging", "read", filter, "--project", projectID, "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read VPC Service Controls audit logs of project %s", projectID)
+	}
+	var entries []perimeterViolation
+	err = json.Unmarshal(stdout, &entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse VPC Service Controls audit logs of project %s", projectID)
+	}
+
+	var violations []string
+	for _, entry := range entries {
+		payload := entry.ProtoPayload
+		violation := fmt.Sprintf("%s %s: %s", payload.ServiceName, payload.MethodName, payload.Metadata.ViolationReason)
+		if payload.Metadata.DryRun {
+			violation += " (dry run)"
+		}
+		violations = append(violations, violation)
+	}
+	return uniqueStrings(violations), nil
+}
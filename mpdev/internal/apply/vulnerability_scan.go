@@ -0,0 +1,374 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"k8s.io/utils/exec"
+)
+
+const (
+	containerAnalysisScanner = "containerAnalysis"
+	trivyScanner             = "trivy"
+)
+
+// scanPollInterval is the time between the checks of the status of the
+// scan of an image by Artifact Analysis, and scanTimeout the time after
+// which an image that is still being scanned, or that was not scanned,
+// fails the scan.
+var (
+	scanPollInterval = 10 * time.Second
+	scanTimeout      = 10 * time.Minute
+)
+
+// vulnerabilitySeverities are the severities of vulnerabilities, from the
+// most to the least severe.
+var vulnerabilitySeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW"}
+
+// manifestImageRegex matches the image fields of Kubernetes manifests.
+var manifestImageRegex = regexp.MustCompile(`(?m)^\s*(?:-\s+)?image:\s*['"]?([^\s'"#]+)`)
+
+// VulnerabilityScan gates a deployer on the vulnerabilities of the images
+// of the app, such that images with known vulnerabilities are not released.
+type VulnerabilityScan struct {
+	// Scanner is containerAnalysis, which reads the vulnerabilities found by
+	// Artifact Analysis in images pushed to Artifact Registry, or trivy,
+	// which scans images with a local trivy. Defaults to containerAnalysis
+	Scanner string
+	// Severity is the lowest severity of the vulnerabilities that fail the
+	// scan. One of CRITICAL, HIGH, MEDIUM or LOW. Defaults to CRITICAL
+	Severity string
+	// AllowedVulnerabilities are the IDs of vulnerabilities that do not
+	// fail the scan, such as CVE-2021-44228 in a package the app does not
+	// use
+	AllowedVulnerabilities []string
+}
+
+// vulnerability is a vulnerability of a package in an image.
+type vulnerability struct {
+	id       string
+	pkg      string
+	severity string
+}
+
+func (v vulnerability) String() string {
+	return fmt.Sprintf("%s (%s, %s)", v.id, v.pkg, v.severity)
+}
+
+func (s *VulnerabilityScan) scanner() string {
+	if s.Scanner == "" {
+		return containerAnalysisScanner
+	}
+	return s.Scanner
+}
+
+// severities returns the severities that fail the scan.
+func (s *VulnerabilityScan) severities() []string {
+	severity := strings.ToUpper(s.Severity)
+	if severity == "" {
+		severity = vulnerabilitySeverities[0]
+	}
+	for i, candidate := range vulnerabilitySeverities {
+		if candidate == severity {
+			return vulnerabilitySeverities[:i+1]
+		}
+	}
+	return nil
+}
+
+func (s *VulnerabilityScan) validate() error {
+	if scanner := s.scanner(); scanner != containerAnalysisScanner && scanner != trivyScanner {
+		return fmt.Errorf("unsupported vulnerability scanner: %s. Must be one of %s or %s", scanner, containerAnalysisScanner, trivyScanner)
+	}
+	if s.severities() == nil {
+		return fmt.Errorf("invalid severity of vulnerability scan: %s. Must be one of %s", s.Severity, strings.Join(vulnerabilitySeverities, ", "))
+	}
+	return nil
+}
+
+// scan fails if any of images has vulnerabilities of the scanned severities
+// that are not allowed.
+func (s *VulnerabilityScan) scan(executor exec.Interface, images []string) error {
+	if len(images) == 0 {
+		fmt.Printf("WARNING: no images found to scan for vulnerabilities\n")
+		return nil
+	}
+
+	severities := s.severities()
+	allowed := map[string]bool{}
+	for _, id := range s.AllowedVulnerabilities {
+		allowed[id] = true
+	}
+
+	var problems []string
+	for _, image := range images {
+		fmt.Printf("Scanning image %s for vulnerabilities\n", image)
+		var vulnerabilities []vulnerability
+		var err error
+		if s.scanner() == trivyScanner {
+			vulnerabilities, err = trivyVulnerabilities(executor, image, severities)
+		} else {
+			vulnerabilities, err = containerAnalysisVulnerabilities(executor, image)
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range vulnerabilities {
+			if !allowed[v.id] && containsString(severities, v.severity) {
+				problems = append(problems, fmt.Sprintf("%s: %s", image, v))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("images have vulnerabilities of severity %s or higher. Update the vulnerable packages, or add vulnerabilities that do not affect the app to allowedVulnerabilities:\n  - %s",
+			severities[len(severities)-1], strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// imageAnalysis is the description of an image by gcloud artifacts docker
+// images describe --show-package-vulnerability: the vulnerabilities that
+// Artifact Analysis found, and the status of its scan of the image.
+type imageAnalysis struct {
+	DiscoverySummary struct {
+		Discovery []struct {
+			Discovered struct {
+				AnalysisStatus      string `json:"analysisStatus"`
+				AnalysisStatusError struct {
+					Message string `json:"message"`
+				} `json:"analysisStatusError"`
+			} `json:"discovered"`
+		} `json:"discovery"`
+	} `json:"discovery_summary"`
+	PackageVulnerabilitySummary struct {
+		Vulnerabilities map[string][]struct {
+			Vulnerability struct {
+				EffectiveSeverity string `json:"effectiveSeverity"`
+				ShortDescription  string `json:"shortDescription"`
+				PackageIssue      []struct {
+					AffectedPackage string `json:"affectedPackage"`
+				} `json:"packageIssue"`
+			} `json:"vulnerability"`
+		} `json:"vulnerabilities"`
+	} `json:"package_vulnerability_summary"`
+}
+
+// status returns the status of the scan of the image, such as
+// FINISHED_SUCCESS, and the error of a failed scan. The status is empty if
+// the image was not scanned.
+func (a *imageAnalysis) status() (string, string) {
+	for _, discovery := range a.DiscoverySummary.Discovery {
+		if status := discovery.Discovered.AnalysisStatus; status != "" {
+			return status, discovery.Discovered.AnalysisStatusError.Message
+		}
+	}
+	return "", ""
+}
+
+// describeImage returns the analysis of image by Artifact Analysis.
+func describeImage(executor exec.Interface, image string) (*imageAnalysis, error) {
+	stdout, err := runCommandOutput(executor, "gcloud", "artifacts", "docker", "images", "describe", image,
+		"--show-package-vulnerability", "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get vulnerabilities of image %s", image)
+	}
+	var analysis imageAnalysis
+	err = json.Unmarshal(stdout, &analysis)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse vulnerabilities of image %s", image)
+	}
+	return &analysis, nil
+}
+
+// containerAnalysisVulnerabilities returns the vulnerabilities that
+// Artifact Analysis found in an image, once it finished scanning it. Images
+// that are pushed are scanned asynchronously, so the scan is waited for
+// until scanTimeout. Images whose scan failed, or that are not scanned,
+// such as if the Container Scanning API is not enabled, fail the scan
+// instead of being reported without vulnerabilities.
+func containerAnalysisVulnerabilities(executor exec.Interface, image string) ([]vulnerability, error) {
+	ctx := executorContext(executor)
+	deadline := time.Now().Add(scanTimeout)
+	var analysis *imageAnalysis
+	for {
+		var err error
+		analysis, err = describeImage(executor, image)
+		if err != nil {
+			return nil, err
+		}
+		status, message := analysis.status()
+		if status == "FINISHED_SUCCESS" || status == "COMPLETE" {
+			break
+		}
+		if status != "" && status != "PENDING" && status != "SCANNING" {
+			return nil, fmt.Errorf("failed to scan image %s with Artifact Analysis: %s", image, strings.TrimSpace(status+" "+message))
+		}
+		if time.Now().After(deadline) {
+			if status == "" {
+				return nil, fmt.Errorf("image %s was not scanned by Artifact Analysis after %s. Enable the Container Scanning API, containerscanning.googleapis.com, in the project of its repository, or use the trivy scanner", image, scanTimeout)
+			}
+			return nil, fmt.Errorf("the scan of image %s by Artifact Analysis did not finish after %s: %s", image, scanTimeout, status)
+		}
+		fmt.Printf("Waiting for Artifact Analysis to scan image %s\n", image)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(scanPollInterval):
+		}
+	}
+
+	var vulnerabilities []vulnerability
+	for severity, occurrences := range analysis.PackageVulnerabilitySummary.Vulnerabilities {
+		for _, occurrence := range occurrences {
+			v := vulnerability{id: occurrence.Vulnerability.ShortDescription, severity: severity}
+			if occurrence.Vulnerability.EffectiveSeverity != "" {
+				v.severity = occurrence.Vulnerability.EffectiveSeverity
+			}
+			var packages []string
+			for _, issue := range occurrence.Vulnerability.PackageIssue {
+				packages = append(packages, issue.AffectedPackage)
+			}
+			v.pkg = strings.Join(packages, ", ")
+			vulnerabilities = append(vulnerabilities, v)
+		}
+	}
+	sortVulnerabilities(vulnerabilities)
+	return vulnerabilities, nil
+}
+
+// trivyVulnerabilities returns the vulnerabilities of the given severities
+// that trivy finds in an image.
+func trivyVulnerabilities(executor exec.Interface, image string, severities []string) ([]vulnerability, error) {
+	stdout, err := runCommandOutput(executor, "trivy", "image", "--quiet", "--format", "json",
+		"--severity", strings.Join(severities, ","), image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to scan image %s with trivy", image)
+	}
+
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID string `json:"VulnerabilityID"`
+				PkgName         string `json:"PkgName"`
+				Severity        string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	err = json.Unmarshal(stdout, &report)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse trivy report of image %s", image)
+	}
+
+	var vulnerabilities []vulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, vulnerability{id: v.VulnerabilityID, pkg: v.PkgName, severity: v.Severity})
+		}
+	}
+	sortVulnerabilities(vulnerabilities)
+	return vulnerabilities, nil
+}
+
+func sortVulnerabilities(vulnerabilities []vulnerability) {
+	sort.Slice(vulnerabilities, func(i, j int) bool {
+		if vulnerabilities[i].id != vulnerabilities[j].id {
+			return vulnerabilities[i].id < vulnerabilities[j].id
+		}
+		return vulnerabilities[i].pkg < vulnerabilities[j].pkg
+	})
+}
+
+// deployerImages returns the images of an app referenced in the build context
+// of its deployer: the defaults of IMAGE properties and the images declared
+// in the schema, and the images set in the manifests or chart. Images set
+// from variables or templates are resolved at deploy time, and are skipped.
+func deployerImages(contextDir string, repo string, track string) ([]string, error) {
+	images := map[string]bool{}
+	b, err := ioutil.ReadFile(filepath.Join(contextDir, "schema.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var schema struct {
+		Marketplace struct {
+			Images map[string]interface{} `yaml:"images"`
+		} `yaml:"x-google-marketplace"`
+		Properties map[string]struct {
+			Default     interface{} `yaml:"default"`
+			Marketplace struct {
+				Type string `yaml:"type"`
+			} `yaml:"x-google-marketplace"`
+		} `yaml:"properties"`
+	}
+	err = yaml.Unmarshal(b, &schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse schema.yaml")
+	}
+	// Schema v2 declares the images of the app, which are pushed next to
+	// the deployer with the tag of its track.
+	for name := range schema.Marketplace.Images {
+		image := repo
+		if name != "" {
+			image += "/" + name
+		}
+		images[image+":"+track] = true
+	}
+	for _, property := range schema.Properties {
+		if image, ok := property.Default.(string); ok && property.Marketplace.Type == "IMAGE" && image != "" {
+			images[image] = true
+		}
+	}
+
+	for _, dir := range []string{"chart", "manifest"} {
+		err = filepath.Walk(filepath.Join(contextDir, dir), func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil || info.IsDir() {
+				return err
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, match := range manifestImageRegex.FindAllStringSubmatch(string(b), -1) {
+				if !strings.ContainsAny(match[1], "${}") {
+					images[match[1]] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	for image := range images {
+		result = append(result, image)
+	}
+	sort.Strings(result)
+	return result, nil
+}
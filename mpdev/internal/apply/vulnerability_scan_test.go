@@ -0,0 +1,234 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+func TestDeployerImages(t *testing.T) {
+	testCases := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{{
+		name: "Schema v1",
+		files: map[string]string{
+			"schema.yaml": `properties:
+  name:
+    type: string
+    x-google-marketplace:
+      type: NAME
+  image:
+    type: string
+    default: gcr.io/project/app:1.2
+    x-google-marketplace:
+      type: IMAGE
+`,
+			"manifest/app.yaml": `spec:
+  containers:
+  - name: app
+    image: $IMAGE_APP
+  - image: "gcr.io/cloud-marketplace-tools/metering/ubbagent:0.1"
+    name: ubbagent
+`,
+		},
+		expected: []string{"gcr.io/cloud-marketplace-tools/metering/ubbagent:0.1", "gcr.io/project/app:1.2"},
+	}, {
+		name: "Schema v2",
+		files: map[string]string{
+			"schema.yaml": `x-google-marketplace:
+  schemaVersion: v2
+  images:
+    '':
+      properties: {}
+    mysql:
+      properties: {}
+`,
+			"chart/templates/app.yaml": "        image: {{ .Values.image }}\n        image: busybox:1.36 # init\n",
+		},
+		expected: []string{"busybox:1.36", "gcr.io/project/app/mysql:1.2", "gcr.io/project/app:1.2"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "deployer")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+			for name, contents := range tc.files {
+				assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+			}
+
+			images, err := deployerImages(dir, "gcr.io/project/app", "1.2")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, images)
+		})
+	}
+}
+
+const containerAnalysisOutput = `{
+  "image_summary": {"digest": "sha256:abc"},
+  "discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "FINISHED_SUCCESS"}}]},
+  "package_vulnerability_summary": {
+    "vulnerabilities": {
+      "CRITICAL": [{
+        "noteName": "projects/goog-vulnz/notes/CVE-2021-3711",
+        "vulnerability": {
+          "effectiveSeverity": "CRITICAL",
+          "shortDescription": "CVE-2021-3711",
+          "packageIssue": [{"affectedPackage": "openssl"}]
+        }
+      }],
+      "HIGH": [{
+        "vulnerability": {
+          "effectiveSeverity": "HIGH",
+          "shortDescription": "CVE-2022-0778",
+          "packageIssue": [{"affectedPackage": "openssl"}]
+        }
+      }]
+    }
+  }
+}`
+
+const trivyOutput = `{
+  "Results": [{
+    "Target": "gcr.io/project/app:1.2 (debian 11.2)",
+    "Vulnerabilities": [
+      {"VulnerabilityID": "CVE-2022-0778", "PkgName": "libssl1.1", "Severity": "HIGH"},
+      {"VulnerabilityID": "CVE-2021-3711", "PkgName": "libssl1.1", "Severity": "CRITICAL"}
+    ]
+  }]
+}`
+
+func TestVulnerabilityScan(t *testing.T) {
+	testCases := []struct {
+		name             string
+		scan             VulnerabilityScan
+		outputs          []string
+		timeout          time.Duration
+		expectedCommand  []string
+		expectValidation bool
+		errorContains    []string
+	}{{
+		name:            "Critical vulnerability",
+		outputs:         []string{containerAnalysisOutput},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe", "gcr.io/project/app:1.2", "--show-package-vulnerability"},
+		errorContains:   []string{"severity CRITICAL or higher", "gcr.io/project/app:1.2: CVE-2021-3711 (openssl, CRITICAL)"},
+	}, {
+		name:            "Allowed vulnerability",
+		scan:            VulnerabilityScan{AllowedVulnerabilities: []string{"CVE-2021-3711"}},
+		outputs:         []string{containerAnalysisOutput},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+	}, {
+		name:            "High severity",
+		scan:            VulnerabilityScan{Severity: "high", AllowedVulnerabilities: []string{"CVE-2021-3711"}},
+		outputs:         []string{containerAnalysisOutput},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+		errorContains:   []string{"severity HIGH or higher", "CVE-2022-0778 (openssl, HIGH)"},
+	}, {
+		name:            "No vulnerabilities",
+		outputs:         []string{`{"discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "FINISHED_SUCCESS"}}]}}`},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+	}, {
+		name: "Scan pending",
+		outputs: []string{
+			`{"image_summary": {"digest": "sha256:abc"}}`,
+			`{"discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "PENDING"}}]}}`,
+			`{"discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "SCANNING"}}]}}`,
+			containerAnalysisOutput,
+		},
+		timeout:         time.Minute,
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+		errorContains:   []string{"gcr.io/project/app:1.2: CVE-2021-3711 (openssl, CRITICAL)"},
+	}, {
+		name:            "Scan still pending",
+		outputs:         []string{`{"discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "SCANNING"}}]}}`},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+		errorContains:   []string{"the scan of image gcr.io/project/app:1.2 by Artifact Analysis did not finish after 0s: SCANNING"},
+	}, {
+		name:            "Unscanned",
+		outputs:         []string{`{"image_summary": {"digest": "sha256:abc"}}`},
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+		errorContains:   []string{"image gcr.io/project/app:1.2 was not scanned by Artifact Analysis", "containerscanning.googleapis.com"},
+	}, {
+		name: "Unsupported image",
+		outputs: []string{`{"discovery_summary": {"discovery": [{"discovered": {"analysisStatus": "FINISHED_UNSUPPORTED",
+  "analysisStatusError": {"message": "unsupported base image"}}}]}}`},
+		timeout:         time.Minute,
+		expectedCommand: []string{"gcloud", "artifacts", "docker", "images", "describe"},
+		errorContains:   []string{"failed to scan image gcr.io/project/app:1.2 with Artifact Analysis: FINISHED_UNSUPPORTED unsupported base image"},
+	}, {
+		name:            "Trivy",
+		scan:            VulnerabilityScan{Scanner: "trivy", Severity: "HIGH"},
+		outputs:         []string{trivyOutput},
+		expectedCommand: []string{"trivy", "image", "--quiet", "--format", "json", "--severity", "CRITICAL,HIGH", "gcr.io/project/app:1.2"},
+		errorContains:   []string{"CVE-2021-3711 (libssl1.1, CRITICAL)", "CVE-2022-0778 (libssl1.1, HIGH)"},
+	}, {
+		name:             "Unsupported scanner",
+		scan:             VulnerabilityScan{Scanner: "clair"},
+		expectValidation: true,
+	}, {
+		name:             "Invalid severity",
+		scan:             VulnerabilityScan{Severity: "SEVERE"},
+		expectValidation: true,
+	}}
+
+	defer func(interval time.Duration, timeout time.Duration) {
+		scanPollInterval, scanTimeout = interval, timeout
+	}(scanPollInterval, scanTimeout)
+	scanPollInterval = 0
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.expectValidation {
+				assert.Error(t, tc.scan.validate())
+				return
+			}
+			assert.NoError(t, tc.scan.validate())
+			scanTimeout = tc.timeout
+
+			fcmd := testingexec.FakeCmd{}
+			executor := &testingexec.FakeExec{}
+			for _, output := range tc.outputs {
+				output := output
+				fcmd.RunScript = append(fcmd.RunScript,
+					func() ([]byte, []byte, error) { return []byte(output), nil, nil })
+				executor.CommandScript = append(executor.CommandScript,
+					func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) })
+			}
+
+			err := tc.scan.scan(executor, []string{"gcr.io/project/app:1.2"})
+			assert.Equal(t, len(tc.outputs), fcmd.RunCalls)
+			assert.Equal(t, tc.expectedCommand, fcmd.RunLog[0][:len(tc.expectedCommand)])
+			if len(tc.errorContains) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			for _, contains := range tc.errorContains {
+				assert.Contains(t, err.Error(), contains)
+			}
+		})
+	}
+}
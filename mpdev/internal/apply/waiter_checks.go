@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Waiter timeouts outside of this range are a common cause of failed
+// deployments. VMs rarely boot and install software in less than the
+// minimum, and deployments with a longer timeout stay pending for over an
+// hour before reporting a failure.
+const (
+	minWaiterTimeoutSecs = 120
+	maxWaiterTimeoutSecs = 3600
+)
+
+var (
+	// waiterTypeRegex matches resources whose type is a waiter, such as
+	// type: runtimeconfig.v1beta1.waiter or 'type': 'runtimeconfig.v1beta1.waiter'.
+	waiterTypeRegex = regexp.MustCompile(`(?m)['"]?type['"]?\s*:\s*['"]?runtimeconfig\.v1beta1\.waiter['"]?\s*(?:[,}#]|$)`)
+	// waiterSignalRegex matches the ways a startup script can signal a
+	// waiter: the gcloud command, the Runtime Configurator API, or the
+	// software status script generated by autogen.
+	waiterSignalRegex = regexp.MustCompile(`runtime-config configs variables set|runtimeconfig\.googleapis\.com/v1beta1/\S*variables|software_status`)
+)
+
+// checkWaiterSpec returns warnings about the applicationStatus settings of
+// an autogen deployment spec that make deployments fail or commonly cause
+// them to time out. The spec itself is validated by autogen.
+func checkWaiterSpec(spec map[string]interface{}) []string {
+	var warnings []string
+	for _, status := range findFields(spec, "applicationStatus", "application_status") {
+		statusType, _ := field(status, "type").(string)
+		waiter, hasWaiter := field(status, "waiter").(map[string]interface{})
+		if statusType != "WAITER" {
+			if hasWaiter {
+				warnings = append(warnings, fmt.Sprintf("applicationStatus type is %q, so its waiter settings are ignored", statusType))
+			}
+			continue
+		}
+		if !hasWaiter {
+			warnings = append(warnings, "applicationStatus type is WAITER, but no waiter is configured")
+			continue
+		}
+
+		timeout, ok := number(field(waiter, "waiterTimeoutSecs", "waiter_timeout_secs"))
+		switch {
+		case !ok || timeout <= 0:
+			warnings = append(warnings, "waiter.waiterTimeoutSecs must be set to a positive number of seconds")
+		case timeout < minWaiterTimeoutSecs:
+			warnings = append(warnings, fmt.Sprintf("waiter.waiterTimeoutSecs is %v, deployments are likely to time out before the VM is ready. Use at least %d", timeout, minWaiterTimeoutSecs))
+		case timeout > maxWaiterTimeoutSecs:
+			warnings = append(warnings, fmt.Sprintf("waiter.waiterTimeoutSecs is %v, failed deployments are only reported after more than an hour", timeout))
+		}
+
+		script, hasScript := field(waiter, "script").(map[string]interface{})
+		if !hasScript {
+			warnings = append(warnings, "waiter has no script, so the application must signal the waiter itself or deployments time out")
+			continue
+		}
+		if content, _ := field(script, "checkScriptContent", "check_script_content").(string); strings.TrimSpace(content) == "" {
+			warnings = append(warnings, "waiter script has no checkScriptContent, so the waiter is signaled when the VM boots, before the application is ready")
+		}
+		checkTimeout, ok := number(field(script, "checkTimeoutSecs", "check_timeout_secs"))
+		if ok && timeout > 0 && checkTimeout > timeout {
+			warnings = append(warnings, fmt.Sprintf("waiter.script.checkTimeoutSecs %v exceeds waiter.waiterTimeoutSecs %v, so the waiter times out before the check completes", checkTimeout, timeout))
+		}
+	}
+	return warnings
+}
+
+// checkGeneratedWaiter returns warnings about the waiters declared by the
+// templates of a Deployment Manager template directory: waiters without a
+// failure condition, and packages where no file signals the waiter.
+func checkGeneratedWaiter(dir string) ([]string, error) {
+	var warnings []string
+	var waiterFiles []string
+	signaled := false
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if waiterSignalRegex.Match(contents) {
+			signaled = true
+		}
+		if !isTemplateFile(path) || !waiterTypeRegex.Match(contents) {
+			return nil
+		}
+		waiterFiles = append(waiterFiles, rel)
+		for _, condition := range []string{"success", "failure"} {
+			conditionRegex := regexp.MustCompile(`(?m)^\s*['"]?` + condition + `['"]?\s*:`)
+			if !conditionRegex.Match(contents) {
+				warnings = append(warnings, fmt.Sprintf("waiter in %s has no %s condition", rel, condition))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(waiterFiles) > 0 && !signaled {
+		warnings = append(warnings, fmt.Sprintf("no startup script in the template signals the waiter declared in %s, deployments will time out", strings.Join(waiterFiles, ", ")))
+	}
+	sort.Strings(warnings)
+	return warnings, nil
+}
+
+// findFields returns the values of every map with one of names as a key,
+// at any depth of value.
+func findFields(value interface{}, names ...string) []map[string]interface{} {
+	var found []map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if m, ok := v[key].(map[string]interface{}); ok && containsString(names, key) {
+				found = append(found, m)
+				continue
+			}
+			found = append(found, findFields(v[key], names...)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			found = append(found, findFields(item, names...)...)
+		}
+	}
+	return found
+}
+
+// field returns the value of the first of names set in m.
+func field(m map[string]interface{}, names ...string) interface{} {
+	for _, name := range names {
+		if v, ok := m[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// number converts a number decoded from YAML or JSON to a float64. Numbers
+// may be strings, as in the JSON encoding of protocol buffers.
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCheckWaiterSpec(t *testing.T) {
+	testCases := []struct {
+		name             string
+		spec             string
+		expectedWarnings []string
+	}{{
+		name: "Waiter with check script",
+		spec: `
+singleVm:
+  applicationStatus:
+    type: WAITER
+    waiter:
+      waiterTimeoutSecs: 300
+      script:
+        checkTimeoutSecs: 300
+        checkScriptContent: curl -f http://localhost/
+`,
+	}, {
+		name: "Waiter without script",
+		spec: `
+singleVm:
+  applicationStatus:
+    type: WAITER
+    waiter:
+      waiter_timeout_secs: 60
+`,
+		expectedWarnings: []string{
+			"waiter.waiterTimeoutSecs is 60, deployments are likely to time out before the VM is ready. Use at least 120",
+			"waiter has no script, so the application must signal the waiter itself or deployments time out",
+		},
+	}, {
+		name: "Misconfigured waiters of multiple tiers",
+		spec: `
+multiVm:
+  tiers:
+  - name: frontend
+    applicationStatus:
+      type: WAITER
+  - name: backend
+    applicationStatus:
+      type: WAITER
+      waiter:
+        waiterTimeoutSecs: "600"
+        script:
+          checkTimeoutSecs: 900
+`,
+		expectedWarnings: []string{
+			"applicationStatus type is WAITER, but no waiter is configured",
+			"waiter script has no checkScriptContent, so the waiter is signaled when the VM boots, before the application is ready",
+			"waiter.script.checkTimeoutSecs 900 exceeds waiter.waiterTimeoutSecs 600, so the waiter times out before the check completes",
+		},
+	}, {
+		name: "Waiter without timeout",
+		spec: `
+singleVm:
+  applicationStatus:
+    type: WAITER
+    waiter:
+      script:
+        checkScriptContent: "true"
+`,
+		expectedWarnings: []string{"waiter.waiterTimeoutSecs must be set to a positive number of seconds"},
+	}, {
+		name: "Waiter settings ignored",
+		spec: `
+singleVm:
+  applicationStatus:
+    type: NONE
+    waiter:
+      waiterTimeoutSecs: 300
+`,
+		expectedWarnings: []string{`applicationStatus type is "NONE", so its waiter settings are ignored`},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var spec map[string]interface{}
+			assert.NoError(t, yaml.Unmarshal([]byte(tc.spec), &spec))
+
+			assert.Equal(t, tc.expectedWarnings, checkWaiterSpec(spec))
+		})
+	}
+}
+
+func TestCheckGeneratedWaiter(t *testing.T) {
+	waiter := `
+resources:
+- name: waiter
+  type: runtimeconfig.v1beta1.waiter
+  properties:
+    timeout: 300s
+    success:
+      cardinality:
+        path: /success
+`
+	testCases := []struct {
+		name             string
+		files            map[string]string
+		expectedWarnings []string
+	}{{
+		name: "Waiter signaled by startup script",
+		files: map[string]string{
+			"solution.jinja": waiter + "    failure:\n      cardinality:\n        path: /failure\n",
+			"startup.sh":     "gcloud beta runtime-config configs variables set success/vm ok --config-name waiter-config",
+		},
+	}, {
+		name: "Waiter not signaled",
+		files: map[string]string{
+			"solution.jinja": waiter,
+		},
+		expectedWarnings: []string{
+			"no startup script in the template signals the waiter declared in solution.jinja, deployments will time out",
+			"waiter in solution.jinja has no failure condition",
+		},
+	}, {
+		name: "Waiter mentioned in a comment",
+		files: map[string]string{
+			"solution.jinja": "# Unlike runtimeconfig.v1beta1.waiter resources, this VM is not watched.\nresources: []",
+		},
+	}, {
+		name: "Python waiter without failure condition",
+		files: map[string]string{
+			"solution.py": `
+def GenerateConfig(context):
+  # Fails fast: no failure path is watched.
+  return {'resources': [{
+      'name': 'waiter',
+      'type': 'runtimeconfig.v1beta1.waiter',
+      'properties': {
+          'success': {'cardinality': {'path': '/success'}},
+      },
+  }]}
+`,
+			"startup.sh": "gcloud beta runtime-config configs variables set success/vm ok --config-name waiter-config",
+		},
+		expectedWarnings: []string{"waiter in solution.py has no failure condition"},
+	}, {
+		name: "No waiter",
+		files: map[string]string{
+			"solution.jinja": "resources: []",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "waiter-checks")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			for name, contents := range tc.files {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+			}
+
+			warnings, err := checkGeneratedWaiter(dir)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedWarnings, warnings)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/utils/exec"
+)
+
+// DefaultMpdevRoles are the roles needed to apply the resources that
+// publish a Deployment Manager solution.
+var DefaultMpdevRoles = []string{
+	"roles/storage.objectAdmin",
+	"roles/deploymentmanager.editor",
+	"roles/compute.admin",
+	"roles/iam.serviceAccountUser",
+}
+
+var (
+	// poolAudienceRegex matches the audience of a workload identity pool
+	// provider, capturing the resource name of the pool.
+	poolAudienceRegex = regexp.MustCompile(`^//iam\.googleapis\.com/(projects/[^/]+/locations/global/workloadIdentityPools/[^/]+)/providers/[^/]+$`)
+	// impersonationURLRegex matches the URL used to impersonate a service
+	// account, capturing the email of the service account.
+	impersonationURLRegex = regexp.MustCompile(`/serviceAccounts/([^/:]+):generateAccessToken$`)
+)
+
+// CredentialConfig is a workload identity federation credential
+// configuration, as created by
+// gcloud iam workload-identity-pools create-cred-config.
+// See https://cloud.google.com/iam/docs/workload-identity-federation
+type CredentialConfig struct {
+	Type                           string          `json:"type"`
+	Audience                       string          `json:"audience"`
+	SubjectTokenType               string          `json:"subject_token_type"`
+	TokenURL                       string          `json:"token_url"`
+	ServiceAccountImpersonationURL string          `json:"service_account_impersonation_url"`
+	CredentialSource               json.RawMessage `json:"credential_source"`
+}
+
+// LoadCredentialConfig reads and validates a workload identity federation
+// credential configuration.
+func LoadCredentialConfig(path string) (*CredentialConfig, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read credential configuration %s", path)
+	}
+	var config CredentialConfig
+	err = json.Unmarshal(b, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse credential configuration %s", path)
+	}
+
+	var problems []string
+	if config.Type != "external_account" {
+		problems = append(problems, fmt.Sprintf("type is %q, expected external_account. Service account keys are not supported", config.Type))
+	}
+	if !poolAudienceRegex.MatchString(config.Audience) {
+		problems = append(problems, fmt.Sprintf("audience %q is not a workload identity pool provider", config.Audience))
+	}
+	if config.SubjectTokenType == "" {
+		problems = append(problems, "subject_token_type is not set")
+	}
+	if config.TokenURL == "" {
+		problems = append(problems, "token_url is not set")
+	}
+	if len(config.CredentialSource) == 0 || string(config.CredentialSource) == "null" {
+		problems = append(problems, "credential_source is not set")
+	}
+	if config.ServiceAccountImpersonationURL != "" && !impersonationURLRegex.MatchString(config.ServiceAccountImpersonationURL) {
+		problems = append(problems, fmt.Sprintf("service_account_impersonation_url %q is invalid", config.ServiceAccountImpersonationURL))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid credential configuration %s:\n  - %s", path, strings.Join(problems, "\n  - "))
+	}
+	return &config, nil
+}
+
+// UseCredentialFile authenticates the commands executed by mpdev with a
+// workload identity federation credential configuration. gcloud and
+// gsutil use the configuration instead of the active account, and tools
+// using Application Default Credentials, such as Terraform and Packer, use
+// it as well.
+func UseCredentialFile(path string) (*CredentialConfig, error) {
+	config, err := LoadCredentialConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range []string{"CLOUDSDK_AUTH_CREDENTIAL_FILE_OVERRIDE", "GOOGLE_APPLICATION_CREDENTIALS"} {
+		if err := setCommandEnv(env, abs); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Principal returns the IAM member that the credentials authenticate as. If
+// the service account impersonation URL is set, the member is the service
+// account. Otherwise, it is the principalSet of all identities of the
+// workload identity pool.
+func (c *CredentialConfig) Principal() string {
+	if match := impersonationURLRegex.FindStringSubmatch(c.ServiceAccountImpersonationURL); match != nil {
+		return "serviceAccount:" + match[1]
+	}
+	pool := poolAudienceRegex.FindStringSubmatch(c.Audience)[1]
+	return "principalSet://iam.googleapis.com/" + pool + "/*"
+}
+
+// poolMember returns the resource name of the workload identity pool of the
+// credentials, as used in IAM members.
+func (c *CredentialConfig) poolMember() string {
+	return "iam.googleapis.com/" + poolAudienceRegex.FindStringSubmatch(c.Audience)[1] + "/"
+}
+
+// CheckPrincipal checks that principal, such as
+// principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/attribute.repository/org/repo,
+// is an identity of the workload identity pool of the credentials. It
+// cannot be set for credentials that impersonate a service account.
+func (c *CredentialConfig) CheckPrincipal(principal string) error {
+	if c.ServiceAccountImpersonationURL != "" {
+		return fmt.Errorf("credentials impersonate %s, so the principal cannot be set", strings.TrimPrefix(c.Principal(), "serviceAccount:"))
+	}
+	pool := c.poolMember()
+	if !strings.HasPrefix(principal, "principal://"+pool) && !strings.HasPrefix(principal, "principalSet://"+pool) {
+		return fmt.Errorf("principal %s is not in workload identity pool %s", principal, poolAudienceRegex.FindStringSubmatch(c.Audience)[1])
+	}
+	return nil
+}
+
+// grantedTo reports whether a member of an IAM binding includes principal.
+// Members that grant a role to the whole workload identity pool of the
+// credentials include all of its principals.
+func (c *CredentialConfig) grantedTo(principal string, member string) bool {
+	if member == principal {
+		return true
+	}
+	return !strings.HasPrefix(principal, "serviceAccount:") && member == "principalSet://"+c.poolMember()+"*"
+}
+
+// MissingRoles returns the roles that are not granted to principal, or to
+// the principal of the credentials if principal is empty, in the IAM policy
+// of a project. Roles granted on folders or the organization are not
+// considered.
+func (c *CredentialConfig) MissingRoles(executor exec.Interface, projectID string, principal string, roles []string) ([]string, error) {
+	if principal == "" {
+		principal = c.Principal()
+	}
+	stdout, err := runCommandOutput(executor, "gcloud", "projects", "get-iam-policy", projectID, "--format", "json")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get IAM policy of project %s", projectID)
+	}
+	var policy struct {
+		Bindings []struct {
+			Role    string   `json:"role"`
+			Members []string `json:"members"`
+		} `json:"bindings"`
+	}
+	err = json.Unmarshal(stdout, &policy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse IAM policy of project %s", projectID)
+	}
+
+	granted := map[string]bool{}
+	for _, binding := range policy.Bindings {
+		for _, member := range binding.Members {
+			if c.grantedTo(principal, member) {
+				granted[binding.Role] = true
+			}
+		}
+	}
+	var missing []string
+	for _, role := range roles {
+		if !granted[role] {
+			missing = append(missing, role)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apply
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+const testAudience = "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/providers/actions"
+
+func writeCredentialConfig(t *testing.T, dir string, contents string) string {
+	path := filepath.Join(dir, "credentials.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestLoadCredentialConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "credentials")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name              string
+		config            string
+		expectedPrincipal string
+		expectedErrs      []string
+	}{{
+		name: "Impersonated service account",
+		config: `{"type": "external_account", "audience": "` + testAudience + `",
+			"subject_token_type": "urn:ietf:params:oauth:token-type:jwt", "token_url": "https://sts.googleapis.com/v1/token",
+			"service_account_impersonation_url": "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/ci@p.iam.gserviceaccount.com:generateAccessToken",
+			"credential_source": {"url": "http://localhost/token"}}`,
+		expectedPrincipal: "serviceAccount:ci@p.iam.gserviceaccount.com",
+	}, {
+		name: "Direct federation",
+		config: `{"type": "external_account", "audience": "` + testAudience + `",
+			"subject_token_type": "urn:ietf:params:oauth:token-type:jwt", "token_url": "https://sts.googleapis.com/v1/token",
+			"credential_source": {"file": "/tmp/token"}}`,
+		expectedPrincipal: "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/*",
+	}, {
+		name:   "Service account key",
+		config: `{"type": "service_account", "private_key": "secret"}`,
+		expectedErrs: []string{
+			`type is "service_account", expected external_account`,
+			`audience "" is not a workload identity pool provider`,
+			"credential_source is not set",
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := LoadCredentialConfig(writeCredentialConfig(t, dir, tc.config))
+			if len(tc.expectedErrs) > 0 {
+				assert.Error(t, err)
+				for _, expected := range tc.expectedErrs {
+					assert.Contains(t, err.Error(), expected)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPrincipal, config.Principal())
+		})
+	}
+}
+
+func TestMissingRoles(t *testing.T) {
+	policy := `{"bindings": [
+		{"role": "roles/storage.objectAdmin", "members": ["serviceAccount:ci@p.iam.gserviceaccount.com"]},
+		{"role": "roles/compute.admin", "members": ["principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/attribute.repository/org/repo"]},
+		{"role": "roles/deploymentmanager.editor", "members": ["principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/*"]},
+		{"role": "roles/viewer", "members": ["user:dev@example.com"]}
+	]}`
+
+	testCases := []struct {
+		name            string
+		config          CredentialConfig
+		principal       string
+		expectedMissing []string
+	}{{
+		name: "Service account",
+		config: CredentialConfig{
+			Audience:                       testAudience,
+			ServiceAccountImpersonationURL: "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/ci@p.iam.gserviceaccount.com:generateAccessToken",
+		},
+		expectedMissing: []string{"roles/compute.admin", "roles/deploymentmanager.editor", "roles/viewer"},
+	}, {
+		name:            "Workload identity pool",
+		config:          CredentialConfig{Audience: testAudience},
+		expectedMissing: []string{"roles/storage.objectAdmin", "roles/compute.admin", "roles/viewer"},
+	}, {
+		name:            "Repository of the pool",
+		config:          CredentialConfig{Audience: testAudience},
+		principal:       "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/attribute.repository/org/repo",
+		expectedMissing: []string{"roles/storage.objectAdmin", "roles/viewer"},
+	}, {
+		name:            "Other repository of the pool",
+		config:          CredentialConfig{Audience: testAudience},
+		principal:       "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/attribute.repository/org/other",
+		expectedMissing: []string{"roles/storage.objectAdmin", "roles/compute.admin", "roles/viewer"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fcmd := testingexec.FakeCmd{RunScript: []testingexec.FakeRunAction{
+				func() ([]byte, []byte, error) { return []byte(policy), nil, nil },
+			}}
+			executor := &testingexec.FakeExec{CommandScript: []testingexec.FakeCommandAction{
+				func(cmd string, args ...string) exec.Cmd { return testingexec.InitFakeCmd(&fcmd, cmd, args...) },
+			}}
+
+			missing, err := tc.config.MissingRoles(executor, "test-project", tc.principal,
+				[]string{"roles/storage.objectAdmin", "roles/compute.admin", "roles/deploymentmanager.editor", "roles/viewer"})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMissing, missing)
+			assert.Equal(t, [][]string{{"gcloud", "projects", "get-iam-policy", "test-project", "--format", "json"}}, fcmd.RunLog)
+		})
+	}
+}
+
+func TestCheckPrincipal(t *testing.T) {
+	pool := CredentialConfig{Audience: testAudience}
+	impersonated := CredentialConfig{
+		Audience:                       testAudience,
+		ServiceAccountImpersonationURL: "https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/ci@p.iam.gserviceaccount.com:generateAccessToken",
+	}
+
+	testCases := []struct {
+		name          string
+		config        CredentialConfig
+		principal     string
+		errorContains string
+	}{{
+		name:      "Subject of the pool",
+		config:    pool,
+		principal: "principal://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/subject/repo:org/repo:ref:refs/heads/main",
+	}, {
+		name:          "Other pool",
+		config:        pool,
+		principal:     "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/gitlab/*",
+		errorContains: "is not in workload identity pool projects/123/locations/global/workloadIdentityPools/github",
+	}, {
+		name:          "Impersonated service account",
+		config:        impersonated,
+		principal:     "principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/*",
+		errorContains: "credentials impersonate ci@p.iam.gserviceaccount.com",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.CheckPrincipal(tc.principal)
+			if tc.errorContains != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -54,11 +54,445 @@ const ApplyExamples = `
   mpdev apply -f dm.yaml
 
   # apply the yaml configuration passed into stdin
-  cat mpdev.yaml | mpdev apply -f
+  cat mpdev.yaml | mpdev apply -f -
+
+  # apply configurations generated by kustomize, without a temporary file
+  kustomize build overlays/prod | mpdev apply -f -
 
   # apply the configuration in dm.yaml and gce.yaml
   mpdev apply -f dm.yaml,gce.yaml
 
   # dryrun of configuration in dm.yaml
   mpdev apply -f dm.yaml --dryrun
+
+  # apply the configuration in dm.yaml, recording state in a custom file
+  mpdev apply -f dm.yaml --state-file /tmp/mpdev_state.json
+
+  # apply the configuration in dm.yaml without prompting for missing fields
+  mpdev apply -f dm.yaml --no-input
+
+  # apply the configurations of every solution in a repository
+  mpdev apply -R -f . --include 'solutions/*/mpdev/*.yaml'
+
+  # apply the resources of the base patched by the prod overlay
+  mpdev apply -f overlays/prod
+`
+
+// DiffShort contains short help text for diff command.
+const DiffShort = `Compares published packages with the packages produced by configuration files`
+
+// DiffLong contains expanded help text for diff command.
+const DiffLong = `Compares the published package of every DeploymentManagerTemplate in the
+configuration files with the package that apply would publish, file by file.
+The package is downloaded from the first GCS path in zipFilePath, or read from
+its first local path. The autogen templates that generate the package are run,
+and the other resources it depends on are only validated as with apply
+--dryrun, such that nothing is created or uploaded.
+
+Drafts in Partner Portal are not compared. See
+https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/mpdev-reference.md#partner-portal
+`
+
+// DiffExamples contains examples for diff command.
+const DiffExamples = `
+  # compare the published package with the configuration in configurations.yaml
+  mpdev diff -f configurations.yaml
+
+  # fail if the published package differs, such as in a CI check
+  mpdev diff -f configurations.yaml --exit-code
+`
+
+// TestShort contains short help text for test command.
+const TestShort = `Runs the verification resources of configuration files against published artifacts`
+
+// TestLong contains expanded help text for test command.
+const TestLong = `Applies only the verification resources of the configuration files, such as
+DeploymentManagerDeployment, DeploymentManagerPreview, GceImageLicenseCheck and
+QuotaCheck, along with the resources they depend on. Nothing is published.
+The Deployment Manager template saved by a DeploymentManagerTemplate is
+downloaded from its zipFilePath instead of being generated again, so that the
+published template is verified.
+
+Directories passed to --filename are searched for configuration files.
+`
+
+// TestExamples contains examples for test command.
+const TestExamples = `
+  # run the verification resources of the solutions in a repository
+  mpdev test -f solutions/
+
+  # only run the verification suites of staging
+  mpdev test -f solutions/ --include '**/staging/*.yaml'
+`
+
+// PublishShort contains short help text for publish command.
+const PublishShort = `Validates, builds, packages, uploads and verifies a solution`
+
+// PublishLong contains expanded help text for publish command.
+const PublishLong = `Applies the resources of the configuration files stage by stage, and stops at
+the first stage that fails. The stages run in this order:
+
+  validate  validates all resources, as apply --dryrun does
+  build     builds images and generates Deployment Manager templates
+  package   archives templates, Helm charts and Terraform modules and saves
+            them to their destinations
+  upload    publishes GCE images and listing assets
+  draft     applies the resources entered in the Partner Portal draft, such
+            as PriceModel and SaaSIntegration
+  verify    applies verification resources
+
+--from-stage and --until-stage select the stages to run. A stage also applies
+the resources it depends on from the stages that were not run, since outputs
+such as generated templates are not kept between runs. Partner Portal drafts
+are not created by mpdev. See
+https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/mpdev-reference.md#partner-portal
+`
+
+// PublishExamples contains examples for publish command.
+const PublishExamples = `
+  # publish a solution
+  mpdev publish -f configurations.yaml
+
+  # build and package a solution without uploading it
+  mpdev publish -f configurations.yaml --until-stage package
+
+  # resume a run that failed in the upload stage
+  mpdev publish -f configurations.yaml --from-stage upload
+`
+
+// OpenShort contains short help text for open command.
+const OpenShort = `Opens the Producer Portal or Cloud Console page of resources`
+
+// OpenLong contains expanded help text for open command.
+const OpenLong = `Opens the page of the resources in the configuration files in the default
+browser, and prints its URL:
+
+  listing     the Producer Portal of the project selected with --project
+  deployment  the Deployment Manager page of each DeploymentManagerDeployment
+  bucket      the Cloud Storage browser of each GCS destination of templates,
+              charts, modules and listing assets
+`
+
+// OpenExamples contains examples for open command.
+const OpenExamples = `
+  # open the test deployments of a solution
+  mpdev open deployment -f configurations.yaml
+
+  # print the URL of the Producer Portal without opening a browser
+  mpdev --project my-project open listing -f configurations.yaml --no-browser
+`
+
+// CleanShort contains short help text for clean command.
+const CleanShort = `Removes temporary directories, cached files and stale state of mpdev`
+
+// CleanLong contains expanded help text for clean command.
+const CleanLong = `Removes the temporary directories that mpdev creates, such as the output
+directories of DeploymentManagerAutogenTemplate resources and the staging
+directories of packages, which are left behind when a run is killed, or kept
+with --keep-tmpdir. mpdev creates them in a directory of its own in the system
+temporary directory, or in the directory passed to --tmpdir, such as
+/tmp/mpdev-1000 for the user with uid 1000, so that directories of other
+tools are kept. The files that mpdev caches in the user cache directory, such
+as ~/.cache/mpdev, are removed as well, except for state files.
+Directories and files modified in the last hour are kept, since they may
+belong to a running command; --older-than changes this duration.
+
+With --filename, the entries of the state file of resources that are no
+longer in the configuration files, such as renamed resources, are removed as
+well.
+`
+
+// CleanExamples contains examples for clean command.
+const CleanExamples = `
+  # list what would be removed
+  mpdev clean --dryrun
+
+  # remove temporary directories, and prune the state of a configuration
+  mpdev clean -f configurations.yaml
+
+  # remove all temporary directories on a CI worker
+  mpdev clean --older-than 0s
+`
+
+// TelemetryShort contains short help text for telemetry command.
+const TelemetryShort = `Manages consent to send anonymous usage metrics`
+
+// TelemetryLong contains expanded help text for telemetry command.
+const TelemetryLong = `Usage metrics are only sent after consent is given with
+"mpdev telemetry enable", and can be stopped at any time with
+"mpdev telemetry disable". Released builds of mpdev send them to the endpoint of
+the maintainers of mpdev, unless --endpoint is passed; builds from source
+require --endpoint. Setting the MPDEV_NO_TELEMETRY environment variable to true
+or 1 stops them whatever the consent, for example on shared CI workers.
+
+For each command, the metrics are the command, its duration, the number of
+resources of each kind, whether it succeeded and the class of its failure, as
+well as the version, operating system and architecture of mpdev. They contain no
+identifiers: no resource names, projects, paths or error messages.
+`
+
+// ExplainShort contains short help text for explain command.
+const ExplainShort = `Prints the documentation of a kind of resource or of one of its fields`
+
+// ExplainLong contains expanded help text for explain command.
+const ExplainLong = `Prints the documentation of a kind of resource, or of a field selected with
+its path in the resource, such as DeploymentManagerTemplate.zipFilePath,
+followed by the fields it contains. Fields are named as in configuration files.
+
+The fields of the deploymentSpec of a DeploymentManagerAutogenTemplate are
+explained from
+https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/docs/autogen-reference.md,
+such as DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.bootDisk.
+`
+
+// ExplainExamples contains examples for explain command.
+const ExplainExamples = `
+  # list the fields of a DeploymentManagerDeployment
+  mpdev explain DeploymentManagerDeployment
+
+  # explain a nested field
+  mpdev explain DeploymentManagerAutogenTemplate.spec.packageInfo
+
+  # explain a field of the autogen spec
+  mpdev explain DeploymentManagerAutogenTemplate.spec.deploymentSpec.singleVm.bootDisk
+`
+
+// GenerateShort contains short help text for generate command.
+const GenerateShort = `Generates files that run mpdev`
+
+// GenerateLong contains expanded help text for generate command.
+const GenerateLong = `Generates files that run mpdev, such as continuous integration pipelines.
+`
+
+// GenerateCloudBuildShort contains short help text for generate cloudbuild command.
+const GenerateCloudBuildShort = `Generates a Cloud Build configuration that applies mpdev configurations`
+
+// GenerateCloudBuildLong contains expanded help text for generate cloudbuild command.
+const GenerateCloudBuildLong = `Generates a Cloud Build configuration that installs mpdev, validates
+the configurations in filename with a dry run, and then applies them.
+
+The build steps run in an image with gcloud, gsutil and the docker client,
+and use the Docker daemon of Cloud Build to run the containers needed by mpdev.
+With --state-cache, the state file is restored from and saved to GCS, so that
+resources that are unchanged since the previous build are skipped.
+`
+
+// GenerateCloudBuildExamples contains examples for generate cloudbuild command.
+const GenerateCloudBuildExamples = `
+  # generate cloudbuild.yaml applying configurations.yaml
+  mpdev generate cloudbuild -f configurations.yaml
+
+  # cache the state file between builds, and print the configuration
+  mpdev generate cloudbuild -f configurations.yaml --state-cache gs://my-bucket/mpdev_state.json --out-file -
+
+  # submit the build
+  gcloud builds submit --config cloudbuild.yaml .
+`
+
+// AuthShort contains short help text for auth command.
+const AuthShort = `Checks the credentials used by mpdev`
+
+// AuthLong contains expanded help text for auth command.
+const AuthLong = `Checks the credentials used by mpdev to call Google Cloud.
+`
+
+// AuthCheckShort contains short help text for auth check command.
+const AuthCheckShort = `Checks that the federated principal has the roles needed by mpdev`
+
+// AuthCheckLong contains expanded help text for auth check command.
+const AuthCheckLong = `Validates the workload identity federation credential configuration passed
+to --credential-file, and checks that the principal it authenticates as is
+granted the roles needed by mpdev in the IAM policy of project.
+
+If the configuration impersonates a service account, the roles of the service
+account are checked. Otherwise, the roles of the principal passed to
+--principal are checked, such as the principalSet of the repository that runs
+mpdev. Roles granted to the whole workload identity pool apply to all of its
+principals. Without --principal, only roles granted to the whole pool are
+accepted. Roles granted on folders or the organization are not considered.
+`
+
+// AuthCheckExamples contains examples for auth check command.
+const AuthCheckExamples = `
+  # check the default roles in my-project
+  mpdev --credential-file gha-creds.json auth check --project my-project
+
+  # check specific roles
+  mpdev --credential-file gha-creds.json auth check --project my-project --role roles/storage.objectAdmin
+
+  # check the roles of the identities of a GitHub repository
+  mpdev --credential-file gha-creds.json auth check --project my-project \
+    --principal principalSet://iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/github/attribute.repository/org/repo
+`
+
+// DoctorShort contains short help text for doctor command.
+const DoctorShort = `Checks that the prerequisites of mpdev are met`
+
+// DoctorLong contains expanded help text for doctor command.
+const DoctorLong = `Checks that the prerequisites of mpdev are met, and prints how to fix each
+prerequisite that is not:
+  - docker is installed and its daemon is reachable
+  - containers can write to the directories that mpdev mounts in them
+  - zip and gsutil are installed
+  - gcloud is installed and authenticated
+  - Application Default Credentials are present
+  - the APIs used by mpdev resources are enabled in project
+`
+
+// DoctorExamples contains examples for doctor command.
+const DoctorExamples = `
+  # check the prerequisites, using the project of the active gcloud configuration
+  mpdev doctor
+
+  # check the APIs enabled in my-project
+  mpdev doctor --project my-project
+`
+
+// InitShort contains short help text for init command.
+const InitShort = `Generates the skeleton of a solution`
+
+// InitLong contains expanded help text for init command.
+const InitLong = `Generates the skeleton of a solution of TYPE in DIR, which must be empty or
+not exist. TYPE is one of single-vm, multi-vm, k8s or terraform.
+
+The skeleton contains the mpdev configuration, a minimal autogen specification,
+Helm chart or Terraform module, and an example resource that verifies the
+solution, so that it can be applied right away with mpdev apply.
+`
+
+// InitExamples contains examples for init command.
+const InitExamples = `
+  # generate a single VM solution in the wordpress directory
+  mpdev init single-vm wordpress --project my-project
+
+  # generate a Terraform module named my-module
+  mpdev init terraform ./module-dir --name my-module
+`
+
+// LintShort contains short help text for lint command.
+const LintShort = `Runs static checks against mpdev configuration files`
+
+// LintLong contains expanded help text for lint command.
+const LintLong = `Runs static checks against the mpdev configuration files in the directory
+tree of DIR, which defaults to the current directory, without creating any
+resource. Configuration files are found as with apply --recursive. Findings
+are printed with a severity of error or warning, and identical findings are
+printed once.
+
+The checks include the validation done by apply --dryrun, checks of autogen
+specs, resource naming conventions, duplicate resources and the consistency of
+related resources, such as the versions of a deployer and its Helm chart. The
+command fails if an error is found, or a warning with --warnings-as-errors.
+`
+
+// LintExamples contains examples for lint command.
+const LintExamples = `
+  # lint the configuration files in the current directory
+  mpdev lint
+
+  # fail on warnings in CI
+  mpdev lint mypackage/ --warnings-as-errors
+`
+
+// ConvertShort contains short help text for convert command.
+const ConvertShort = `Converts resources to another kind or apiVersion`
+
+// ConvertLong contains expanded help text for convert command.
+const ConvertLong = `Converts the resources in filename to another kind or apiVersion, and prints
+the converted configuration, or overwrites filename with --in-place.
+
+Only the kind and apiVersion lines of converted resources are rewritten, so
+comments and formatting are preserved. A resource can only be converted to a
+kind whose fields are a superset of its own, for example a
+DeploymentManagerPreview to a DeploymentManagerDeployment. Resources that
+cannot be converted are left unchanged.
+`
+
+// ConvertExamples contains examples for convert command.
+const ConvertExamples = `
+  # convert the preview named preview to a deployment, in place
+  mpdev convert -f configurations.yaml --kind DeploymentManagerDeployment --name preview --in-place
+
+  # print the configuration converted to the current apiVersion
+  mpdev convert -f configurations.yaml --api-version dev.marketplace.cloud.google.com/v1alpha1
+`
+
+// ListShort contains short help text for list command.
+const ListShort = `Lists the resources in mpdev configuration files`
+
+// ListLong contains expanded help text for list command.
+const ListLong = `Prints a table of the resources in filename, with their kind, name, the
+fields set to a string and the resources they reference. Directories passed to
+filename are searched for configuration files as with
+apply --recursive.
+`
+
+// ListExamples contains examples for list command.
+const ListExamples = `
+  # list the resources of a package
+  mpdev list -f mypackage/
+`
+
+// GetShort contains short help text for get command.
+const GetShort = `Prints a resource as it is decoded by mpdev`
+
+// GetLong contains expanded help text for get command.
+const GetLong = `Prints the resource named NAME in filename as it is decoded by mpdev,
+including fields that are not set, in yaml or json format. Directories passed to
+filename are searched for configuration files as with
+apply --recursive.
+`
+
+// GetExamples contains examples for get command.
+const GetExamples = `
+  # print the resource named autogen
+  mpdev get autogen -f mypackage/
+
+  # print the DeploymentManagerTemplate named dmtemplate as json
+  mpdev get dmtemplate --kind DeploymentManagerTemplate -f mypackage/ -o json
+`
+
+// CompletionShort contains short help text for completion command.
+const CompletionShort = `Generates shell completion scripts`
+
+// CompletionLong contains expanded help text for completion command.
+const CompletionLong = `Writes a completion script for bash, zsh, fish or powershell to stdout.
+Commands, flags and their values are completed. In bash and fish, the names of
+resources are completed from the files passed to --filename, or from the
+current directory, and --kind is completed with the kinds supported by mpdev.
+`
+
+// CompletionExamples contains examples for completion command.
+const CompletionExamples = `
+  # load completions in the current bash session
+  source <(mpdev completion bash)
+
+  # load completions for every zsh session
+  mpdev completion zsh > "${fpath[1]}/_mpdev"
+
+  # load completions for every fish session
+  mpdev completion fish > ~/.config/fish/completions/mpdev.fish
+`
+
+// SelfUpdateShort contains short help text for self-update command.
+const SelfUpdateShort = `Replaces mpdev with its latest release`
+
+// SelfUpdateLong contains expanded help text for self-update command.
+const SelfUpdateLong = `Downloads the latest release of mpdev, or the release passed to --version,
+and replaces the running mpdev binary with it. The downloaded archive is only
+installed if its SHA-256 checksum matches the checksums published with the
+release. Nothing is installed if mpdev is already the latest release. mpdev
+installed with Homebrew is updated with brew upgrade instead.
+`
+
+// SelfUpdateExamples contains examples for self-update command.
+const SelfUpdateExamples = `
+  # update mpdev to the latest release
+  mpdev self-update
+
+  # install a specific release of mpdev
+  mpdev self-update --version v0.1.0
+
+  # fail a CI job if mpdev is not the latest release
+  mpdev version --check
 `
@@ -0,0 +1,241 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command fielddocs generates the documentation of the fields of mpdev
+// resources, which `mpdev explain` prints, from the doc comments of the Go
+// types of the apply package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"html"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package whose types are documented")
+	out := flag.String("o", "field_docs.go", "file that the documentation is written to, relative to dir")
+	autogen := flag.String("autogen", "", "markdown reference of the autogen spec, whose messages are documented as well, relative to dir")
+	flag.Parse()
+
+	var messages []autogenMessage
+	if *autogen != "" {
+		var err error
+		messages, err = parseAutogenReference(filepath.Join(*dir, *autogen))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	src, err := generate(*dir, filepath.Base(*out), messages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(*dir, *out), src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate returns the source of a file declaring fieldDocs, which maps
+// type names and TypeName.FieldName to their doc comments, for the exported
+// struct types of the package in dir and their exported fields, and
+// autogenTypes, which maps the names of the
+// messages of the autogen spec to their fields. The file out is excluded
+// from parsing.
+func generate(dir string, out string, messages []autogenMessage) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go") && info.Name() != out
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected a single package in %s, found %d", dir, len(pkgs))
+	}
+
+	docs := map[string]string{}
+	var name string
+	for pkgName, pkg := range pkgs {
+		name = pkgName
+		p := doc.New(pkg, "", doc.AllDecls|doc.PreserveAST)
+		for _, t := range p.Types {
+			for _, spec := range t.Decl.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || !ts.Name.IsExported() {
+					continue
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				if text := clean(t.Doc); text != "" {
+					docs[ts.Name.Name] = text
+				}
+				for _, field := range st.Fields.List {
+					text := clean(field.Doc.Text())
+					if text == "" {
+						text = clean(field.Comment.Text())
+					}
+					for _, n := range field.Names {
+						if text != "" && n.IsExported() {
+							docs[ts.Name.Name+"."+n.Name] = text
+						}
+					}
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by mpdev/internal/fielddocs. DO NOT EDIT.\n\npackage %s\n\n", name)
+	fmt.Fprintf(&b, "// fieldDocs are the doc comments of types and of their fields, keyed by\n// TypeName and TypeName.FieldName.\n")
+	fmt.Fprintf(&b, "var fieldDocs = map[string]string{\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%q: %q,\n", key, docs[key])
+	}
+	fmt.Fprintf(&b, "}\n\n")
+	fmt.Fprintf(&b, "// autogenTypes are the messages and enums of the autogen spec, keyed by\n// name, from docs/autogen-reference.md.\n")
+	fmt.Fprintf(&b, "var autogenTypes = map[string]autogenType{\n")
+	for _, m := range messages {
+		fmt.Fprintf(&b, "%q: {\nDescription: %q,\n", m.name, m.description)
+		if len(m.fields) > 0 {
+			fmt.Fprintf(&b, "Fields: []autogenField{\n")
+			for _, f := range m.fields {
+				fmt.Fprintf(&b, "{Name: %q, Type: %q, Repeated: %t, Description: %q},\n", f.name, f.typ, f.repeated, f.description)
+			}
+			fmt.Fprintf(&b, "},\n")
+		}
+		if len(m.values) > 0 {
+			fmt.Fprintf(&b, "Values: %#v,\n", m.values)
+		}
+		fmt.Fprintf(&b, "},\n")
+	}
+	fmt.Fprintf(&b, "}\n")
+	return format.Source(b.Bytes())
+}
+
+// autogenMessage is a message or an enum of the autogen spec.
+type autogenMessage struct {
+	name        string
+	description string
+	fields      []autogenField
+	values      []string
+}
+
+type autogenField struct {
+	name        string
+	typ         string
+	repeated    bool
+	description string
+}
+
+// parseAutogenReference returns the messages and enums of the autogen
+// reference at path, which protoc-gen-doc generated, in the order they are
+// documented. Fields are named in lower camel case, as in configuration
+// files.
+func parseAutogenReference(path string) ([]autogenMessage, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var messages []autogenMessage
+	var m *autogenMessage
+	inTable := false
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "## "):
+			// Sections of files and of scalar types end the messages.
+			m = nil
+		case strings.HasPrefix(line, "### "):
+			messages = append(messages, autogenMessage{name: strings.TrimPrefix(line, "### ")})
+			m = &messages[len(messages)-1]
+			inTable = false
+		case m == nil:
+		case strings.HasPrefix(line, "| ---"):
+			inTable = true
+		case strings.HasPrefix(line, "| Field |"), strings.HasPrefix(line, "| Name |"):
+		case inTable && strings.HasPrefix(line, "|"):
+			cells := strings.Split(strings.Trim(line, "|"), "|")
+			for i := range cells {
+				cells[i] = strings.TrimSpace(cells[i])
+			}
+			if len(cells) >= 4 {
+				m.fields = append(m.fields, autogenField{
+					name:        lowerCamelCase(cells[0]),
+					typ:         linkText(cells[1]),
+					repeated:    cells[2] == "repeated",
+					description: html.UnescapeString(strings.Join(cells[3:], "|")),
+				})
+			} else if len(cells) == 3 {
+				m.values = append(m.values, cells[0])
+			}
+		case !inTable && line != "" && !strings.HasPrefix(line, "<") && !nextIDRegex.MatchString(line):
+			m.description = strings.TrimSpace(m.description + " " + html.UnescapeString(line))
+		}
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages found in %s", path)
+	}
+	return messages, nil
+}
+
+// nextIDRegex matches the notes of the next free field numbers of messages,
+// which are not relevant to configuration files.
+var nextIDRegex = regexp.MustCompile(`^Next (ID|id|available id): [0-9]+\.?$`)
+
+// linkText returns the text of a markdown link, such as DiskSpec for
+// [DiskSpec](#cloud.deploymentmanager.autogen.DiskSpec).
+func linkText(s string) string {
+	if i := strings.Index(s, "]("); strings.HasPrefix(s, "[") && i > 0 {
+		return s[1:i]
+	}
+	return s
+}
+
+// lowerCamelCase converts a snake case name, such as boot_disk, to lower
+// camel case, such as bootDisk.
+func lowerCamelCase(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// clean joins the lines of a doc comment into a paragraph.
+func clean(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFieldDocsUpToDate fails when the doc comments of the types of the
+// apply package changed without regenerating field_docs.go with go generate.
+func TestFieldDocsUpToDate(t *testing.T) {
+	dir := filepath.Join("..", "apply")
+	messages, err := parseAutogenReference(filepath.Join(dir, "../../../docs/autogen-reference.md"))
+	assert.NoError(t, err)
+	expected, err := generate(dir, "field_docs.go", messages)
+	assert.NoError(t, err)
+	actual, err := ioutil.ReadFile(filepath.Join(dir, "field_docs.go"))
+	assert.NoError(t, err)
+	assert.True(t, string(expected) == string(actual),
+		"field_docs.go is stale. Run go generate ./mpdev/internal/apply")
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fielddocs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := `package apply
+
+// Resource is documented.
+type Resource struct {
+	// Name is documented
+	Name string
+	// cache is not exported
+	cache map[string]string
+}
+
+// spec is not exported.
+type spec struct {
+	// Image is a field of a type that is not exported
+	Image string
+}
+`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "resource.go"), []byte(src), 0644))
+
+	out, err := generate(dir, "field_docs.go", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"Resource":      "Resource is documented.",`)
+	assert.Contains(t, string(out), `"Resource.Name": "Name is documented",`)
+	assert.NotContains(t, string(out), `"Resource.cache"`)
+	assert.NotContains(t, string(out), `"spec`)
+}
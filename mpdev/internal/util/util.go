@@ -15,10 +15,14 @@
 package util
 
 import (
+	"archive/zip"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"k8s.io/utils/exec"
 )
@@ -39,11 +43,181 @@ func ZipDirectory(executor exec.Interface, zipFile string, directory string) err
 	return err
 }
 
-// OsTempDir gets os.TempDir() (usually provided by $TMPDIR) but expands any symlinks found within it.
-// This wrapper function can prevent problems with docker-for-mac trying to use /var/..., which is not typically
-// shared/mounted. It will be expanded via the /var symlink to /private/var/...
+// ZipDirectoryNative zips the given directory to the given zipFile like
+// ZipDirectory, without executing zip, such as on Windows where zip is not
+// installed. Paths in the archive are separated by slashes. The zipFile is
+// excluded from the archive if it is inside directory.
+func ZipDirectoryNative(zipFile string, directory string) error {
+	if directory == "" || zipFile == "" {
+		return fmt.Errorf("directory: %s or zipFile: %s cannot be empty string", directory, zipFile)
+	}
+	absZipFile, err := filepath.Abs(zipFile)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(zipFile)
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(out)
+	err = filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == absZipFile {
+			return nil
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = w.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+		dst, err := w.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		w.Close()
+		out.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// TarGzDirectory archives the given directory to the given gzip compressed
+// tarFile. The tarFile is excluded from the archive if it is inside directory.
+// The exclusion is anchored at the root of the archive, such that files of
+// subdirectories with the same name as tarFile are kept.
+func TarGzDirectory(executor exec.Interface, tarFile string, directory string) error {
+	if directory == "" || tarFile == "" {
+		return fmt.Errorf("directory: %s or tarFile: %s cannot be empty string", directory, tarFile)
+	}
+
+	args := []string{"-czf", tarFile}
+	if rel, ok := relativePath(directory, tarFile); ok {
+		args = append(args, "--exclude", "./"+filepath.ToSlash(rel))
+	}
+	cmd := executor.Command("tar", append(args, ".")...)
+	cmd.SetDir(directory)
+	cmd.SetStdout(os.Stdout)
+	cmd.SetStderr(os.Stderr)
+
+	err := cmd.Run()
+	return err
+}
+
+// relativePath returns the path of file relative to directory, and whether
+// file is inside directory.
+func relativePath(directory string, file string) (string, bool) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", false
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absDir, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// CopyFile copies the contents of the src file to the dst file, creating
+// the parent directories of dst if needed.
+func CopyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// CopyDirectory recursively copies the files in the src directory to the dst
+// directory.
+func CopyDirectory(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		return CopyFile(path, filepath.Join(dst, rel))
+	})
+}
+
+// tempDirs are the temporary directories created by CreateTmpDir that have
+// not been removed, in the base directory set by SetTempDirBase, if any.
+var (
+	tempDirsMu  sync.Mutex
+	tempDirs    []string
+	tempDirBase string
+)
+
+// SetTempDirBase sets the directory in which temporary directories are
+// created, instead of os.TempDir(), such as when /tmp is small or mounted
+// noexec. The directory is created if it does not exist.
+func SetTempDirBase(dir string) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tempDirBase = dir
+	return nil
+}
+
+// OsTempDir gets the directory set by SetTempDirBase, or os.TempDir() (usually provided by $TMPDIR), but expands any
+// symlinks found within it. This wrapper function can prevent problems with docker-for-mac trying to use /var/...,
+// which is not typically shared/mounted. It will be expanded via the /var symlink to /private/var/...
 func OsTempDir() (string, error) {
-	dirName := os.TempDir()
+	dirName := tempDirBase
+	if dirName == "" {
+		dirName = os.TempDir()
+	}
 	tmpDir, err := filepath.EvalSymlinks(dirName)
 	if err != nil {
 		return "", err
@@ -52,15 +226,76 @@ func OsTempDir() (string, error) {
 	return tmpDir, nil
 }
 
-// CreateTmpDir creates a temporary directory and returns its path as a string.
+// TempRoot returns the directory of OsTempDir in which CreateTmpDir creates
+// temporary directories, such that they can be found and removed without
+// matching those of other tools. The directory is per user, since the
+// system temporary directory is shared.
+func TempRoot() (string, error) {
+	tmpDir, err := OsTempDir()
+	if err != nil {
+		return "", err
+	}
+	name := "mpdev"
+	if uid := os.Getuid(); uid >= 0 {
+		name = fmt.Sprintf("mpdev-%d", uid)
+	}
+	return filepath.Join(tmpDir, name), nil
+}
+
+// CreateTmpDir creates a temporary directory in TempRoot and returns its path as a string.
+// The directory is removed by RemoveTmpDirs.
 func CreateTmpDir(prefix string) (string, error) {
-	systemTempDir, err := OsTempDir()
+	root, err := TempRoot()
 	if err != nil {
 		return "", err
 	}
-	fullPath, err := ioutil.TempDir(systemTempDir, prefix)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return "", err
+	}
+	fullPath, err := ioutil.TempDir(root, prefix)
 	if err != nil {
 		return "", err
 	}
+	tempDirsMu.Lock()
+	tempDirs = append(tempDirs, fullPath)
+	tempDirsMu.Unlock()
 	return fullPath, nil
 }
+
+// TmpDirs returns the temporary directories created by CreateTmpDir that
+// have not been removed by RemoveTmpDirs. Some of them may have already been
+// removed by their creator.
+func TmpDirs() []string {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	return append([]string(nil), tempDirs...)
+}
+
+// KeepTmpDir keeps a temporary directory created by CreateTmpDir when
+// RemoveTmpDirs is called, such as an output whose path is printed to the
+// user.
+func KeepTmpDir(dir string) {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	for i, d := range tempDirs {
+		if d == dir {
+			tempDirs = append(tempDirs[:i], tempDirs[i+1:]...)
+			return
+		}
+	}
+}
+
+// RemoveTmpDirs removes the temporary directories created by CreateTmpDir,
+// such as the output of resources that other resources read.
+func RemoveTmpDirs() error {
+	tempDirsMu.Lock()
+	defer tempDirsMu.Unlock()
+	var firstErr error
+	for _, dir := range tempDirs {
+		if err := os.RemoveAll(dir); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	tempDirs = nil
+	return firstErr
+}
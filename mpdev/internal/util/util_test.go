@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useTempDirBase points SetTempDirBase to a new directory, and returns it
+// with a function removing it and restoring the base directory.
+func useTempDirBase(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "tmpdirbase")
+	assert.NoError(t, err)
+	base := filepath.Join(dir, "base")
+	assert.NoError(t, SetTempDirBase(base))
+	return base, func() {
+		_ = SetTempDirBase("")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestTempRoot(t *testing.T) {
+	base, cleanup := useTempDirBase(t)
+	defer cleanup()
+	info, err := os.Stat(base)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir(), "the base directory is created")
+
+	root, err := TempRoot()
+	assert.NoError(t, err)
+	expected, err := filepath.EvalSymlinks(base)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(expected, fmt.Sprintf("mpdev-%d", os.Getuid())), root)
+}
+
+func TestCreateTmpDir(t *testing.T) {
+	_, cleanup := useTempDirBase(t)
+	defer cleanup()
+	defer RemoveTmpDirs()
+	root, err := TempRoot()
+	assert.NoError(t, err)
+
+	output, err := CreateTmpDir("autogen")
+	assert.NoError(t, err)
+	input, err := CreateTmpDir("autogenInput")
+	assert.NoError(t, err)
+	assert.Equal(t, root, filepath.Dir(output))
+	assert.Regexp(t, "^autogen", filepath.Base(output))
+	info, err := os.Stat(root)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+	assert.Equal(t, []string{output, input}, TmpDirs())
+
+	KeepTmpDir(output)
+	assert.Equal(t, []string{input}, TmpDirs())
+	assert.NoError(t, RemoveTmpDirs())
+	assert.Empty(t, TmpDirs())
+	_, err = os.Stat(input)
+	assert.True(t, os.IsNotExist(err), "the temporary directory is removed")
+	_, err = os.Stat(output)
+	assert.NoError(t, err, "the kept directory is not removed")
+}
@@ -16,13 +16,18 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"github.com/GoogleCloudPlatform/marketplace-tools/mpdev/cmd"
 )
 
 func main() {
-	cmd := cmd.GetMain()
-	if err := cmd.Execute(); err != nil {
-		os.Exit(1)
+	mpdev := cmd.GetMain()
+	start := time.Now()
+	executed, err := mpdev.ExecuteC()
+	cmd.RecordUsage(executed, start, err)
+	cmd.RemoveTmpDirs(err)
+	if err != nil {
+		os.Exit(cmd.ExitCode(err))
 	}
 }
@@ -18,3 +18,4 @@ if [ -z "$(git status --porcelain)" ]; then
 fi
 # Value set in https://github.com/GoogleCloudPlatform/marketplace-tools/blob/master/.github/workflows/tag.yaml
 echo "STABLE_VERSION $MPDEV_VERSION"
+echo "STABLE_TELEMETRY_ENDPOINT $MPDEV_TELEMETRY_ENDPOINT"